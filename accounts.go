@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/state"
+	"gopkg.in/yaml.v3"
+)
+
+//nolint:gochecknoglobals
+var (
+	// accountFlags are the flags that aren't passed on from a run of several accounts to the run of each account,
+	// as they are set per account (or only apply to the run of several accounts).
+	accountFlags = map[string]bool{
+		"account-parallelism": true,
+		"aws-assume-role-arn": true,
+		"config":              true,
+		"manifest":            true,
+		"state":               true,
+	}
+
+	// accountFileFlags are the flags naming files that are written by a run, whose names get the name of the account
+	// as suffix when passed on to the run of each account (e.g., drift-dev.json), so that runs don't overwrite them.
+	accountFileFlags = map[string]bool{
+		"drift-report": true,
+		"report":       true,
+		"trace-file":   true,
+	}
+)
+
+// manifestAccount is an account listed in a manifest (see -manifest).
+type manifestAccount struct {
+	// Name identifies the account in the logs and the summary (e.g., dev).
+	Name string `yaml:"name"`
+	// AssumeRoleARN is the role assumed to destroy resources in the account (see provider.AWSConfig.AssumeRoleARN).
+	AssumeRoleARN string `yaml:"assume_role_arn"`
+	// Region is the region of the account's resources (defaults to -aws-region).
+	Region string `yaml:"region"`
+	// State is the path to the account's state (relative to the manifest) or its URL (see state.IsRemote);
+	// S3 objects are read with the credentials of the assumed role.
+	State string `yaml:"state"`
+}
+
+// accountResult is the exit code of the run of an account.
+type accountResult struct {
+	account manifestAccount
+	code    int
+}
+
+// readManifest reads the accounts listed in the manifest at the given path, which is a YAML file
+// with a list of accounts (e.g., "accounts: [{name: dev, state: dev.tfstate}]").
+func readManifest(path string) ([]manifestAccount, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		Accounts []manifestAccount `yaml:"accounts"`
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if len(manifest.Accounts) == 0 {
+		return nil, fmt.Errorf("%s: no accounts listed", path)
+	}
+
+	seen := map[string]bool{}
+
+	for i, a := range manifest.Accounts {
+		switch {
+		case a.Name == "":
+			return nil, fmt.Errorf("%s: name of account %d is missing", path, i+1)
+		case seen[a.Name]:
+			return nil, fmt.Errorf("%s: account %s is listed more than once", path, a.Name)
+		case a.State == "":
+			return nil, fmt.Errorf("%s: state of account %s is missing", path, a.Name)
+		}
+
+		seen[a.Name] = true
+
+		if !state.IsRemote(a.State) && !filepath.IsAbs(a.State) {
+			manifest.Accounts[i].State = filepath.Join(filepath.Dir(path), a.State)
+		}
+	}
+
+	return manifest.Accounts, nil
+}
+
+// runAccounts runs the plan or destroy command for each account listed in the manifest given by -manifest,
+// with the flags set for this run plus the account's state, region, and role. A failure in one account doesn't
+// stop the runs of the others. Up to -account-parallelism accounts are run at the same time (whose logs are then
+// interleaved). Returns 0 if all runs succeeded, otherwise the exit code of the first failed account (in the order
+// of the manifest).
+func runAccounts(ctx context.Context, name string, flags *flag.FlagSet, shared stateFlags,
+	providerFactory provider.Factory) int {
+	accounts, err := readManifest(shared.manifest)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read manifest: %s\n", err))
+
+		return 1
+	}
+
+	// the first signal cancels the context to stop gracefully (also the run of each account),
+	// a second one terminates immediately
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// accounts that haven't been started once the context is done count as interrupted
+	results := make([]accountResult, len(accounts))
+	for i, a := range accounts {
+		results[i] = accountResult{account: a, code: exitCodeInterrupted}
+	}
+
+	sem := make(chan struct{}, shared.accountParallelism)
+
+	var wg sync.WaitGroup
+
+	for i, a := range accounts {
+		sem <- struct{}{}
+
+		if ctx.Err() != nil {
+			<-sem
+
+			break
+		}
+
+		wg.Add(1)
+
+		go func(i int, a manifestAccount) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i].code = runAccount(ctx, name, flags, a, providerFactory)
+		}(i, a)
+	}
+
+	wg.Wait()
+
+	return logAccountSummary(results)
+}
+
+// runAccount runs the command for the given account and returns the exit code.
+func runAccount(ctx context.Context, name string, flags *flag.FlagSet, account manifestAccount,
+	providerFactory provider.Factory) int {
+	internal.LogTitle(fmt.Sprintf("account: %s", account.Name))
+
+	// remote states are read by the run with the credentials of the account's role (see state.Read)
+	return runDestroy(ctx, name, accountArgs(flags, account, account.State), providerFactory)
+}
+
+// accountArgs returns the command line arguments of the run of the given account: the flags set for this run
+// (see accountFlags and accountFileFlags) plus the account's state, region, and role.
+func accountArgs(flags *flag.FlagSet, account manifestAccount, statePath string) []string {
+	var args []string
+
+	flags.Visit(func(f *flag.Flag) {
+		if accountFlags[f.Name] || (f.Name == "aws-region" && account.Region != "") {
+			return
+		}
+
+		value := f.Value.String()
+		if accountFileFlags[f.Name] && value != "" {
+			ext := filepath.Ext(value)
+			value = strings.TrimSuffix(value, ext) + "-" + account.Name + ext
+		}
+
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, value))
+	})
+
+	// given explicitly, so that a manifest set by the environment isn't applied to the run of the account
+	args = append(args, "-manifest=", "-state", statePath)
+
+	if account.Region != "" {
+		args = append(args, "-aws-region", account.Region)
+	}
+
+	if account.AssumeRoleARN != "" {
+		args = append(args, "-aws-assume-role-arn", account.AssumeRoleARN)
+	}
+
+	return args
+}
+
+// logAccountSummary logs the exit code of each account and returns 0 if all runs succeeded,
+// otherwise the exit code of the first failed account.
+func logAccountSummary(results []accountResult) int {
+	internal.LogTitle("summary by account")
+
+	code, numOfFailed := 0, 0
+
+	for _, r := range results {
+		entry := log.WithFields(log.Fields{"exit_code": r.code, "status": accountStatus(r.code)})
+
+		if r.code == 0 {
+			entry.Info(internal.Pad(r.account.Name))
+
+			continue
+		}
+
+		entry.Error(internal.Pad(r.account.Name))
+
+		numOfFailed++
+
+		if code == 0 {
+			code = r.code
+		}
+	}
+
+	internal.LogTitle(fmt.Sprintf("accounts succeeded: %d, failed: %d", len(results)-numOfFailed, numOfFailed))
+
+	return code
+}
+
+// accountStatus describes the given exit code of the run of an account.
+func accountStatus(code int) string {
+	switch code {
+	case 0:
+		return "succeeded"
+	case exitCodeResourcesFailed:
+		return "resources failed to be destroyed"
+	case exitCodePermissionDenied:
+		return "permission denied"
+	case exitCodeCredentialsExpired:
+		return "credentials expired"
+	case exitCodeUnsupported:
+		return "unsupported resources"
+	case exitCodeAllGone:
+		return "all resources gone"
+	case exitCodeInterrupted:
+		return "interrupted"
+	case exitCodeUsage:
+		return "usage error"
+	default:
+		return "failed"
+	}
+}
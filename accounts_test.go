@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadManifest(t *testing.T) {
+	tests := []struct {
+		name             string
+		content          string
+		expectedAccounts []manifestAccount
+		expectedErr      string
+	}{
+		{
+			name: "accounts",
+			content: `accounts:
+  - name: dev
+    assume_role_arn: arn:aws:iam::111111111111:role/terradozer
+    region: eu-west-1
+    state: states/dev.tfstate
+  - name: prod
+    state: s3://states/prod/terraform.tfstate
+`,
+			expectedAccounts: []manifestAccount{
+				{
+					Name:          "dev",
+					AssumeRoleARN: "arn:aws:iam::111111111111:role/terradozer",
+					Region:        "eu-west-1",
+					State:         "states/dev.tfstate",
+				},
+				{Name: "prod", State: "s3://states/prod/terraform.tfstate"},
+			},
+		},
+		{
+			name:        "unknown key",
+			content:     "accounts:\n  - name: dev\n    state: dev.tfstate\n    role: admin\n",
+			expectedErr: "field role not found",
+		},
+		{
+			name:        "no accounts",
+			content:     "accounts: []\n",
+			expectedErr: "no accounts listed",
+		},
+		{
+			name:        "account without name",
+			content:     "accounts:\n  - state: dev.tfstate\n",
+			expectedErr: "name of account 1 is missing",
+		},
+		{
+			name:        "account without state",
+			content:     "accounts:\n  - name: dev\n",
+			expectedErr: "state of account dev is missing",
+		},
+		{
+			name:        "duplicate account",
+			content:     "accounts:\n  - {name: dev, state: a.tfstate}\n  - {name: dev, state: b.tfstate}\n",
+			expectedErr: "account dev is listed more than once",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "accounts.yaml")
+
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.content), 0600))
+
+			accounts, err := readManifest(path)
+
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			// relative paths to states are relative to the manifest
+			for i, a := range tc.expectedAccounts {
+				if !state.IsRemote(a.State) {
+					tc.expectedAccounts[i].State = filepath.Join(dir, a.State)
+				}
+			}
+
+			assert.Equal(t, tc.expectedAccounts, accounts)
+		})
+	}
+}
+
+func TestAccountArgs(t *testing.T) {
+	var shared stateFlags
+
+	var f destroyFlags
+
+	fs := newDestroyFlagSet("destroy", &shared, &f)
+
+	require.NoError(t, fs.Parse([]string{"-force", "-manifest", "accounts.yaml", "-aws-region", "us-east-1",
+		"-drift-report", "drift.json"}))
+
+	assert.Equal(t, []string{"-aws-region=us-east-1", "-drift-report=drift-dev.json", "-force=true", "-manifest=",
+		"-state", "dev.tfstate"}, accountArgs(fs, manifestAccount{Name: "dev"}, "dev.tfstate"))
+
+	assert.Equal(t, []string{"-drift-report=drift-prod.json", "-force=true", "-manifest=", "-state", "prod.tfstate",
+		"-aws-region", "eu-west-1", "-aws-assume-role-arn", "arn:aws:iam::222222222222:role/terradozer"},
+		accountArgs(fs, manifestAccount{
+			Name:          "prod",
+			Region:        "eu-west-1",
+			AssumeRoleARN: "arn:aws:iam::222222222222:role/terradozer",
+		}, "prod.tfstate"))
+}
+
+func TestMainExitCode_Accounts(t *testing.T) {
+	state, err := filepath.Abs("test/test-fixtures/tfstates/fake-providers.tfstate")
+	require.NoError(t, err)
+
+	// the state of another account with the same resources, but other IDs
+	content, err := ioutil.ReadFile(state)
+	require.NoError(t, err)
+
+	otherState := filepath.Join(t.TempDir(), "prod.tfstate")
+	content = bytes.ReplaceAll(content, []byte("vpc-039b3d3fb4ffcf0ea"), []byte("vpc-1234"))
+	require.NoError(t, ioutil.WriteFile(otherState, bytes.ReplaceAll(content, []byte("12375"), []byte("54321")), 0600))
+
+	tests := []struct {
+		name             string
+		args             []string
+		manifest         string
+		expectedExitCode int
+		expectedDeleted  int
+	}{
+		{
+			name:            "all accounts",
+			args:            []string{"destroy", "-force"},
+			manifest:        "accounts:\n  - {name: dev, state: " + state + "}\n  - {name: prod, state: " + otherState + "}\n",
+			expectedDeleted: 4,
+		},
+		{
+			name:            "in parallel",
+			args:            []string{"destroy", "-force", "-account-parallelism", "2"},
+			manifest:        "accounts:\n  - {name: dev, state: " + state + "}\n  - {name: prod, state: " + otherState + "}\n",
+			expectedDeleted: 4,
+		},
+		{
+			name: "failed account doesn't stop the others",
+			args: []string{"destroy", "-force"},
+			manifest: "accounts:\n  - {name: dev, state: does-not-exist.tfstate}\n" +
+				"  - {name: prod, state: " + otherState + "}\n",
+			expectedExitCode: exitCodeUsage,
+			expectedDeleted:  2,
+		},
+		{
+			name:     "plan",
+			args:     []string{"plan", "-account-parallelism", "2"},
+			manifest: "accounts:\n  - {name: dev, state: " + state + "}\n",
+		},
+		{
+			name:             "parallel destroy without force",
+			args:             []string{"destroy", "-account-parallelism", "2"},
+			manifest:         "accounts:\n  - {name: dev, state: " + state + "}\n",
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "manifest and state",
+			args:             []string{"plan", "-state", state},
+			manifest:         "accounts:\n  - {name: dev, state: " + state + "}\n",
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "invalid manifest",
+			args:             []string{"plan"},
+			manifest:         "accounts: []\n",
+			expectedExitCode: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "test")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			path := filepath.Join(t.TempDir(), "accounts.yaml")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.manifest), 0600))
+
+			fake := &fakeProvider{destroyed: map[string]bool{}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return fake, nil
+			}
+
+			actualExitCode := mainExitCode(append(tc.args, "-manifest", path), factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+			assert.Len(t, fake.deleted, tc.expectedDeleted)
+		})
+	}
+}
+
+func TestAccountStatus(t *testing.T) {
+	assert.Equal(t, "succeeded", accountStatus(0))
+	assert.Equal(t, "permission denied", accountStatus(exitCodePermissionDenied))
+	assert.Equal(t, "failed", accountStatus(1))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// readAllowList reads the resource types listed in the file at the given path (see -allow-only-types), one per line.
+// Blank lines and comments (starting with #) are ignored. A file that lists no type is an error, as no resource
+// could be destroyed.
+func readAllowList(path string) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.ContainsAny(line, " \t,") {
+			return nil, fmt.Errorf("%s: expected one resource type per line, got: %s", path, line)
+		}
+
+		if !contains(result, line) {
+			result = append(result, line)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%s: no resource types listed", path)
+	}
+
+	return result, nil
+}
+
+// logTypePolicy logs which resource types are eligible to be destroyed at all if only allow-listed types are
+// (see -allow-only-types), so that approvers of a run can see the effective policy: allow-listed types are eligible,
+// unless they are protected (see -protected-types); all other types are not.
+func logTypePolicy(shared stateFlags) {
+	if shared.allowOnlyTypes == "" {
+		return
+	}
+
+	protectedTypes := splitList(shared.protectedTypes)
+
+	allowedTypes := append([]string{}, shared.allowedTypes...)
+	sort.Strings(allowedTypes)
+
+	internal.LogTitle(fmt.Sprintf("resource types eligible for deletion (-allow-only-types): %d", len(allowedTypes)))
+
+	for _, t := range allowedTypes {
+		if contains(protectedTypes, t) {
+			log.WithField("policy", "protected (-protected-types wins over the allow list)").Warn(internal.Pad(t))
+
+			continue
+		}
+
+		log.WithField("policy", "allow-listed").Info(internal.Pad(t))
+	}
+
+	log.WithField("policy", "not allow-listed (never deleted)").Info(internal.Pad("all other types"))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAllowList(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedTypes  []string
+		expectedErrMsg string
+	}{
+		{
+			name:          "blank lines, comments, and duplicates",
+			content:       "# networking\naws_vpc\n\n  aws_subnet  \naws_vpc\n",
+			expectedTypes: []string{"aws_vpc", "aws_subnet"},
+		},
+		{
+			name:           "empty",
+			content:        "# nothing yet\n\n",
+			expectedErrMsg: "no resource types listed",
+		},
+		{
+			name:           "several types per line",
+			content:        "aws_vpc, aws_subnet\n",
+			expectedErrMsg: "expected one resource type per line, got: aws_vpc, aws_subnet",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "types.txt")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.content), 0600))
+
+			actualTypes, err := readAllowList(path)
+
+			if tc.expectedErrMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedTypes, actualTypes)
+		})
+	}
+}
+
+func TestStateFlags_AllowOnlyTypes(t *testing.T) {
+	shared := stateFlags{
+		allowOnlyTypes:   "types.txt",
+		allowedTypes:     []string{"aws_vpc", "aws_s3_bucket", "aws_default_vpc"},
+		protectedTypes:   "aws_s3_bucket",
+		excludeAddresses: "aws_vpc.shared",
+	}
+
+	tests := []struct {
+		name           string
+		candidate      destroy.ResourceCandidate
+		expectedReason destroy.SkipReason
+	}{
+		{
+			name:      "allow-listed",
+			candidate: destroy.ResourceCandidate{Address: "aws_vpc.test", Type: "aws_vpc"},
+		},
+		{
+			name:           "not allow-listed",
+			candidate:      destroy.ResourceCandidate{Address: "aws_subnet.test", Type: "aws_subnet"},
+			expectedReason: destroy.SkipReasonNotAllowListed,
+		},
+		{
+			name:           "protected wins over allow list",
+			candidate:      destroy.ResourceCandidate{Address: "aws_s3_bucket.test", Type: "aws_s3_bucket"},
+			expectedReason: destroy.SkipReasonProtectedType,
+		},
+		{
+			name:           "allow list doesn't override other filters",
+			candidate:      destroy.ResourceCandidate{Address: "aws_vpc.shared", Type: "aws_vpc"},
+			expectedReason: destroy.SkipReasonExcludedAddress,
+		},
+		{
+			name:           "allow-listed default resource",
+			candidate:      destroy.ResourceCandidate{Address: "aws_default_vpc.test", Type: "aws_default_vpc"},
+			expectedReason: destroy.SkipReasonDefaultResource,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualMatch, actualReason := shared.filter().Match(tc.candidate)
+
+			assert.Equal(t, tc.expectedReason == "", actualMatch)
+			assert.Equal(t, tc.expectedReason, actualReason)
+		})
+	}
+}
+
+func TestMainExitCode_AllowOnlyTypes(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "types.txt")
+	require.NoError(t, ioutil.WriteFile(empty, nil, 0600))
+
+	for _, path := range []string{filepath.Join(t.TempDir(), "missing.txt"), empty} {
+		actualExitCode := mainExitCode([]string{"plan", "-allow-only-types", path,
+			"test/test-fixtures/tfstates/fake-providers.tfstate"}, nil)
+
+		assert.Equal(t, exitCodeUsage, actualExitCode, "run must refuse to start (%s)", path)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/jckuester/terradozer/pkg/trace"
+)
+
+// exitCodeNotEmpty is the exit code if resources of the state still exist after they have been destroyed
+// (see -assert-empty).
+const exitCodeNotEmpty = 9
+
+// emptyAssertion is the result of asserting that no resource of the state exists anymore after a run
+// (see -assert-empty), which is part of the report of the run.
+type emptyAssertion struct {
+	// Passed is true if all resources of the state are gone (except the skipped ones).
+	Passed bool `json:"passed"`
+	// Survivors are the resources of the state that still exist, ordered by address.
+	Survivors []reportedResource `json:"survivors"`
+	// Unverified are the resources whose state couldn't be read (e.g., due to missing permissions), ordered
+	// by address.
+	Unverified []reportedResource `json:"unverified,omitempty"`
+}
+
+// assertEmpty lists the resources of the given state again after the run and reads them (without destroying
+// anything, as the verify command does) to check that none of them (except the skipped ones) exists anymore.
+func assertEmpty(ctx context.Context, tfstate *state.State, filter destroy.Filter, config destroy.Config,
+	providerFailures []destroy.RetryDestroyError) (*emptyAssertion, error) {
+	internal.LogTitle("asserting that all resources are gone")
+
+	// the resources are only read again, which isn't part of the events of the run
+	config.Events = nil
+
+	span := trace.Start(ctx, "run", "assert empty", nil)
+	plan, err := destroy.Plan(ctx, tfstate, filter, config)
+	span.End(err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := verifyPlan(plan, nil, providerFailures)
+
+	assertion := &emptyAssertion{
+		Passed:     len(result.Reappeared) == 0 && len(result.Unverified) == 0,
+		Survivors:  result.Reappeared,
+		Unverified: result.Unverified,
+	}
+
+	logEmptyAssertion(assertion)
+
+	return assertion, nil
+}
+
+// logEmptyAssertion logs the resources that still exist or couldn't be read, and the number of each.
+func logEmptyAssertion(assertion *emptyAssertion) {
+	if len(assertion.Survivors) > 0 {
+		internal.LogTitle(fmt.Sprintf("the following resources still exist: %d", len(assertion.Survivors)))
+
+		for _, r := range assertion.Survivors {
+			log.WithFields(log.Fields{"id": r.ID, "address": r.Address}).Error(internal.Pad(r.Type))
+		}
+	}
+
+	if len(assertion.Unverified) > 0 {
+		internal.LogTitle(fmt.Sprintf("failed to check whether the following resources still exist: %d",
+			len(assertion.Unverified)))
+
+		for _, r := range assertion.Unverified {
+			log.WithFields(log.Fields{"id": r.ID, "address": r.Address, "error": r.Error}).
+				Warn(internal.Pad(r.Type))
+		}
+	}
+
+	if assertion.Passed {
+		internal.LogTitle("assertion passed: all resources are gone")
+
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("assertion failed: resources still existing: %d, unverified: %d",
+		len(assertion.Survivors), len(assertion.Unverified)))
+}
+
+// withEmptyAssertion returns the exit code of a run given its exit code and the result of asserting
+// that all resources are gone (nil if not asserted).
+func withEmptyAssertion(code int, assertion *emptyAssertion) int {
+	switch {
+	case code != 0 || assertion == nil || assertion.Passed:
+		return code
+	case len(assertion.Survivors) > 0:
+		return exitCodeNotEmpty
+	default:
+		return 1
+	}
+}
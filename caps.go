@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+)
+
+// exitCodeCapExceeded is the exit code if more resources of a type would be destroyed than its cap allows
+// (see -max-per-type), so that nothing has been destroyed.
+const exitCodeCapExceeded = 10
+
+const (
+	// capBehaviorAbort stops a run before anything is destroyed if a cap per type is exceeded.
+	capBehaviorAbort = "abort"
+	// capBehaviorTrim destroys only up to the cap of each type and defers the rest (see destroy.DestroyPlan.Trim).
+	capBehaviorTrim = "trim"
+)
+
+// parseTypeCaps parses a comma-separated list of type=N pairs (e.g., aws_s3_bucket=5,aws_db_instance=2) into
+// the maximum number of resources to destroy per type.
+func parseTypeCaps(value string) (map[string]int, error) {
+	caps := map[string]int{}
+
+	for _, pair := range splitList(value) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("expected type=N, got: %s", pair)
+		}
+
+		t := strings.TrimSpace(kv[0])
+
+		n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("expected a non-negative number of resources of type %s, got: %s", t, kv[1])
+		}
+
+		if _, ok := caps[t]; ok {
+			return nil, fmt.Errorf("type %s is capped more than once", t)
+		}
+
+		caps[t] = n
+	}
+
+	return caps, nil
+}
+
+// applyTypeCaps checks the candidates of the given plan against the given caps per type (see -max-per-type).
+// If a cap is exceeded, the offending counts are printed and false is returned with the exit code, unless
+// the plan is trimmed to the caps instead (see -cap-behavior).
+func applyTypeCaps(plan *destroy.DestroyPlan, caps map[string]int, behavior string) (int, bool) {
+	if len(caps) == 0 {
+		return 0, true
+	}
+
+	if behavior == capBehaviorTrim {
+		exceeded := plan.Trim(caps)
+		if len(exceeded) == 0 {
+			return 0, true
+		}
+
+		internal.LogTitle("trimmed to the caps per type (-cap-behavior trim)")
+
+		for _, e := range exceeded {
+			log.WithFields(log.Fields{
+				"cap":      e.Cap,
+				"planned":  e.Planned,
+				"deferred": e.Planned - e.Cap,
+			}).Warn(internal.Pad(e.Type))
+		}
+
+		for _, c := range plan.Deferred {
+			log.WithFields(log.Fields{
+				"address": c.Address,
+				"id":      c.ID,
+			}).Info(internal.Pad("deferring resource"))
+		}
+
+		return 0, true
+	}
+
+	exceeded := plan.ExceededCaps(caps)
+	if len(exceeded) == 0 {
+		return 0, true
+	}
+
+	internal.LogTitle("caps per type exceeded (-max-per-type)")
+
+	for _, e := range exceeded {
+		log.WithFields(log.Fields{
+			"cap":     e.Cap,
+			"planned": e.Planned,
+		}).Error(internal.Pad(e.Type))
+	}
+
+	fmt.Fprint(os.Stderr, color.RedString("\nError:️ more resources of %d type(s) would be deleted than their caps "+
+		"allow, so nothing is deleted (check the filters, or pass -cap-behavior trim to delete up to the caps)\n",
+		len(exceeded)))
+
+	return exitCodeCapExceeded, false
+}
+
+// logDeferredResources logs the number of candidates of the plan that have been deferred as the caps of their
+// types have been exceeded, by type.
+func logDeferredResources(plan *destroy.DestroyPlan) {
+	if len(plan.Deferred) == 0 {
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("trimmed: total number of deferred resources (caps per type exceeded): %d",
+		len(plan.Deferred)))
+	logCounts(plan.DeferredByType())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTypeCaps(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedCaps   map[string]int
+		expectedErrMsg string
+	}{
+		{
+			name:         "several types",
+			value:        "aws_s3_bucket=5, aws_db_instance=0",
+			expectedCaps: map[string]int{"aws_s3_bucket": 5, "aws_db_instance": 0},
+		},
+		{
+			name:         "empty",
+			expectedCaps: map[string]int{},
+		},
+		{
+			name:           "missing number",
+			value:          "aws_s3_bucket",
+			expectedErrMsg: "expected type=N, got: aws_s3_bucket",
+		},
+		{
+			name:           "negative number",
+			value:          "aws_s3_bucket=-1",
+			expectedErrMsg: "expected a non-negative number of resources of type aws_s3_bucket, got: -1",
+		},
+		{
+			name:           "type capped twice",
+			value:          "aws_s3_bucket=1,aws_s3_bucket=2",
+			expectedErrMsg: "type aws_s3_bucket is capped more than once",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualCaps, err := parseTypeCaps(tc.value)
+
+			if tc.expectedErrMsg != "" {
+				require.EqualError(t, err, tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCaps, actualCaps)
+		})
+	}
+}
+
+func TestMainExitCode_MaxPerType(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+		expectedDeleted  []string
+		expectedDeferred []reportedResource
+	}{
+		{
+			name:             "cap exceeded",
+			args:             []string{"-max-per-type", "aws_vpc=0"},
+			expectedExitCode: exitCodeCapExceeded,
+		},
+		{
+			name:            "cap not exceeded",
+			args:            []string{"-max-per-type", "aws_vpc=1,random_integer=1"},
+			expectedDeleted: []string{"aws_vpc.vpc-039b3d3fb4ffcf0ea", "random_integer.12375"},
+		},
+		{
+			name:            "trimmed to cap",
+			args:            []string{"-max-per-type", "aws_vpc=0", "-cap-behavior", "trim"},
+			expectedDeleted: []string{"random_integer.12375"},
+			expectedDeferred: []reportedResource{
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeProvider{destroyed: map[string]bool{}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return fake, nil
+			}
+
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+
+			args := append([]string{"destroy", "-force", "-report", reportPath}, tc.args...)
+
+			actualExitCode := mainExitCode(append(args, "test/test-fixtures/tfstates/fake-providers.tfstate"), factory)
+			require.Equal(t, tc.expectedExitCode, actualExitCode)
+
+			assert.ElementsMatch(t, tc.expectedDeleted, fake.deleted)
+
+			if tc.expectedExitCode != 0 {
+				return
+			}
+
+			report, err := readRunReport(reportPath)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedDeferred, report.Deferred)
+		})
+	}
+}
+
+func TestMainExitCode_CapBehavior(t *testing.T) {
+	actualExitCode := mainExitCode([]string{"plan", "-cap-behavior", "skip",
+		"test/test-fixtures/tfstates/fake-providers.tfstate"}, nil)
+
+	assert.Equal(t, exitCodeUsage, actualExitCode)
+}
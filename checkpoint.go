@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+)
+
+// exitCodeStopped is the exit code if the run has been stopped at a checkpoint before all resources have been
+// destroyed (see -checkpoint-every); running the same command again destroys the remaining ones.
+const exitCodeStopped = 11
+
+// checkpoint pauses a run after every number of deleted resources, logs a summary of the run so far, writes
+// the report (see -report), and asks whether to continue (see -checkpoint-every).
+type checkpoint struct {
+	every int
+	// timeout is how long to wait for an answer before continuing; zero waits until answered.
+	timeout time.Duration
+	// interactive is true if answers are read from stdin; otherwise the run continues after the timeout.
+	interactive bool
+
+	reportPath string
+	report     *runReport
+	// plan is the plan of the run, which must be set before it's executed.
+	plan *destroy.DestroyPlan
+
+	answersOnce sync.Once
+	answers     chan string
+}
+
+// newCheckpoint returns the checkpoint of a run that pauses after every given number of deleted resources
+// (nil if every is zero). Checkpoints are disabled if stdin isn't a terminal, unless the run continues
+// automatically after the given timeout.
+func newCheckpoint(every int, timeout time.Duration, reportPath string, report *runReport) *checkpoint {
+	if every == 0 {
+		return nil
+	}
+
+	interactive := stdinIsTerminal()
+
+	if !interactive && timeout == 0 {
+		log.Warn(internal.Pad("checkpoints are disabled, since stdin isn't a terminal " +
+			"(set -checkpoint-timeout to pause anyway)"))
+
+		return nil
+	}
+
+	return &checkpoint{
+		every:       every,
+		timeout:     timeout,
+		interactive: interactive,
+		reportPath:  reportPath,
+		report:      report,
+	}
+}
+
+// destroyCheckpoint returns the checkpoint for destroy.Config (nil if disabled).
+func (c *checkpoint) destroyCheckpoint() *destroy.Checkpoint {
+	if c == nil {
+		return nil
+	}
+
+	return &destroy.Checkpoint{Every: c.every, Continue: c.continueRun}
+}
+
+// continueRun logs the summary of the given result of the run so far, writes the report,
+// and returns true if the run should continue.
+func (c *checkpoint) continueRun(ctx context.Context, result destroy.Result) bool {
+	logCheckpoint(result)
+
+	if c.plan != nil {
+		writeRunReport(c.reportPath, c.report, c.plan, result)
+	}
+
+	if !c.interactive {
+		log.WithField("timeout", c.timeout).Info(internal.Pad("continuing after timeout (interrupt to stop)"))
+
+		return waitFor(ctx, c.timeout)
+	}
+
+	question := "Do you want to continue deleting resources? Only YES will be accepted."
+	if c.timeout > 0 {
+		question += fmt.Sprintf(" Continues automatically in %s.", c.timeout)
+	}
+
+	log.Info(question)
+	fmt.Fprintf(os.Stderr, "%23v", "Enter a value: ")
+
+	var timeout <-chan time.Time
+
+	if c.timeout > 0 {
+		timer := time.NewTimer(c.timeout)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	select {
+	case answer, ok := <-c.readAnswers():
+		return ok && answer == "YES"
+	case <-timeout:
+		fmt.Fprintln(os.Stderr)
+
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// readAnswers returns the lines read from stdin; a line that isn't awaited anymore (e.g., after a timeout)
+// is the answer to the next question.
+func (c *checkpoint) readAnswers() <-chan string {
+	c.answersOnce.Do(func() {
+		c.answers = make(chan string)
+
+		go func() {
+			defer close(c.answers)
+
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				c.answers <- scanner.Text()
+			}
+		}()
+	})
+
+	return c.answers
+}
+
+// waitFor waits for the given amount of time and returns false if the context is done before.
+func waitFor(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// logCheckpoint logs the summary of a run at a checkpoint: the number of deleted, failed, and remaining
+// resources, the failures by class, and the diagnostics several failed resources have in common.
+func logCheckpoint(result destroy.Result) {
+	internal.LogTitle(fmt.Sprintf("checkpoint (deleted: %d, failed: %d, remaining: %d)",
+		result.Deleted, len(result.Failed), len(result.Remaining)))
+
+	numOfFailed := map[destroy.ErrorClass]int{}
+
+	for _, err := range result.Failed {
+		numOfFailed[err.Class]++
+	}
+
+	var classes []destroy.ErrorClass
+
+	for class := range numOfFailed {
+		classes = append(classes, class)
+	}
+
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+
+	for _, class := range classes {
+		log.WithField("resources", numOfFailed[class]).Warn(internal.Pad(class.String()))
+	}
+
+	logRepeatedDiagnostics(result.Failed)
+}
+
+// logStopped logs the summary of a run stopped at a checkpoint and returns the exit code.
+func logStopped(numOfDeletedResources int, numOfSkippedResources int) int {
+	internal.LogTitle(fmt.Sprintf("stopped at checkpoint (total number of deleted resources: %d)",
+		numOfDeletedResources))
+	logNumOfSkippedResources(numOfSkippedResources)
+	internal.LogTitle("run the same command again to destroy the remaining resources")
+
+	return exitCodeStopped
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMainExitCode_Checkpoint(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+		expectedDeleted  []string
+	}{
+		{
+			name:            "continued after timeout",
+			args:            []string{"-checkpoint-every", "1", "-checkpoint-timeout", "1ms"},
+			expectedDeleted: []string{"aws_vpc.vpc-039b3d3fb4ffcf0ea", "random_integer.12375"},
+		},
+		{
+			name:            "disabled without terminal",
+			args:            []string{"-checkpoint-every", "1"},
+			expectedDeleted: []string{"aws_vpc.vpc-039b3d3fb4ffcf0ea", "random_integer.12375"},
+		},
+		{
+			name:             "timeout without checkpoints",
+			args:             []string{"-checkpoint-timeout", "1m"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "invalid timeout",
+			args:             []string{"-checkpoint-every", "1", "-checkpoint-timeout", "0s"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "negative number of deletions",
+			args:             []string{"-checkpoint-every", "-1"},
+			expectedExitCode: exitCodeUsage,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeProvider{destroyed: map[string]bool{}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return fake, nil
+			}
+
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+
+			args := append([]string{"destroy", "-force", "-report", reportPath}, tc.args...)
+
+			actualExitCode := mainExitCode(append(args, "test/test-fixtures/tfstates/fake-providers.tfstate"), factory)
+			require.Equal(t, tc.expectedExitCode, actualExitCode)
+
+			assert.ElementsMatch(t, tc.expectedDeleted, fake.deleted)
+
+			if tc.expectedExitCode != 0 {
+				return
+			}
+
+			report, err := readRunReport(reportPath)
+			require.NoError(t, err)
+
+			assert.False(t, report.Interrupted)
+			assert.Empty(t, report.Remaining)
+		})
+	}
+}
+
+func TestNewCheckpoint_ClientTerminal(t *testing.T) {
+	isTerminal := stdinIsTerminal
+	defer func() { stdinIsTerminal = isTerminal }()
+
+	// while the daemon runs a request, stdin is a pipe, but the client's stdin may be a terminal
+	stdinIsTerminal = func() bool { return true }
+	assert.NotNil(t, newCheckpoint(10, 0, "", nil))
+
+	stdinIsTerminal = func() bool { return false }
+	assert.Nil(t, newCheckpoint(10, 0, "", nil))
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/state"
+)
+
+// completeCommand is the (hidden) command called by the completion scripts, which prints the candidates
+// to complete the last word of the command line.
+const completeCommand = "__complete"
+
+//nolint:gochecknoglobals
+var (
+	// completionScripts are the completion scripts by shell.
+	completionScripts = map[string]string{
+		"bash": bashCompletion,
+		"zsh":  zshCompletion,
+		"fish": fishCompletion,
+	}
+
+	// stateFilePatterns match the names of files completed as Terraform state files.
+	stateFilePatterns = []string{"*.tfstate*"}
+
+	// configFilePatterns match the names of files completed as config files.
+	configFilePatterns = []string{"*.yaml", "*.yml"}
+)
+
+// newCompletionFlagSet returns the flag set of the completion command.
+func newCompletionFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+strings.TrimSpace(completionHelp)+"\n\n")
+	}
+
+	return fs
+}
+
+// runCompletion prints the completion script of the given shell and returns the exit code.
+func runCompletion(arguments []string) int {
+	flags := newCompletionFlagSet()
+
+	err := parseFlags(flags, arguments)
+	if err != nil {
+		return usageError("completion", err)
+	}
+
+	if flags.NArg() != 1 {
+		return usageError("completion", fmt.Errorf("name of shell expected (bash, zsh, or fish)"))
+	}
+
+	script, ok := completionScripts[flags.Arg(0)]
+	if !ok {
+		return usageError("completion", fmt.Errorf("unsupported shell: %s (expected bash, zsh, or fish)",
+			flags.Arg(0)))
+	}
+
+	fmt.Print(strings.TrimLeft(script, "\n"))
+
+	return 0
+}
+
+// runComplete prints the candidates to complete the last of the given words (one per line) and returns
+// the exit code. The words are the ones following the name of the binary on the command line; the last one
+// is the (possibly empty) word to complete.
+//
+// Completion must be fast and safe, so no provider is started: resource types are read from the schemas
+// cached by previous runs and resource addresses from the state file given on the command line.
+func runComplete(words []string) int {
+	for _, candidate := range complete(words) {
+		fmt.Println(candidate)
+	}
+
+	return 0
+}
+
+// complete returns the candidates to complete the last of the given words.
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	current := words[len(words)-1]
+
+	pos, candidates, done := completeFlags(newMainFlagSet(&mainFlags{}), words)
+	if done {
+		return candidates
+	}
+
+	if pos == len(words)-1 {
+		var names []string
+
+		for _, cmd := range commands() {
+			if !cmd.hidden {
+				names = append(names, cmd.name)
+			}
+		}
+
+		return matching(names, current)
+	}
+
+	cmd := findCommand(words[pos])
+	if cmd == nil || cmd.flagSet == nil {
+		return nil
+	}
+
+	args := words[pos+1:]
+
+	if cmd.name == "completion" {
+		if len(args) != 1 {
+			return nil
+		}
+
+		var shells []string
+
+		for shell := range completionScripts {
+			shells = append(shells, shell)
+		}
+
+		sort.Strings(shells)
+
+		return matching(shells, current)
+	}
+
+	_, candidates, done = completeFlags(cmd.flagSet(), args)
+	if done {
+		return candidates
+	}
+
+	return completeFiles(current, stateFilePatterns)
+}
+
+// completeFlags completes the flags of the given flag set and their values. Returns whether the last word has
+// been completed (i.e., it is a flag or the value of a flag); otherwise, returns the index of the first
+// positional word.
+func completeFlags(fs *flag.FlagSet, words []string) (int, []string, bool) {
+	current := words[len(words)-1]
+
+	for i := 0; i < len(words)-1; i++ {
+		name := flagName(words[i])
+		if name == "" {
+			return i, nil, false
+		}
+
+		f := fs.Lookup(name)
+		if f == nil || isBoolFlag(f) || strings.Contains(words[i], "=") {
+			continue
+		}
+
+		if i+1 == len(words)-1 {
+			return 0, completeFlagValue(fs, name, words), true
+		}
+
+		i++
+	}
+
+	if strings.HasPrefix(current, "-") {
+		var names []string
+
+		fs.VisitAll(func(f *flag.Flag) {
+			if !hiddenFlags[f.Name] {
+				names = append(names, "-"+f.Name)
+			}
+		})
+
+		return 0, matching(names, current), true
+	}
+
+	return len(words) - 1, nil, false
+}
+
+// completeFlagValue completes the value of the flag with the given name, which is the last but one word.
+func completeFlagValue(fs *flag.FlagSet, name string, words []string) []string {
+	current := words[len(words)-1]
+
+	switch name {
+	case "state":
+		return completeFiles(current, stateFilePatterns)
+	case "config":
+		return completeFiles(current, configFilePatterns)
+	case "chdir":
+		return completeFiles(current, nil)
+	case "socket":
+		return completeFiles(current, []string{"*.sock"})
+	case "output":
+		return matching(outputFormatsOf(fs.Name()), current)
+	case "protected-types":
+		types := provider.CachedResourceTypes(installDir)
+
+		for _, instance := range stateInstances(fs, words) {
+			types = append(types, instance.Type)
+		}
+
+		return matchingListElement(types, current)
+	case "exclude-addresses":
+		var addresses []string
+
+		for _, instance := range stateInstances(fs, words) {
+			addresses = append(addresses, instance.Address)
+		}
+
+		return matchingListElement(addresses, current)
+	case "include", "exclude":
+		var patterns []string
+
+		for _, instance := range stateInstances(fs, words) {
+			patterns = append(patterns, instance.Type, instance.Address)
+		}
+
+		return matchingListElement(patterns, current)
+	}
+
+	return nil
+}
+
+// stateInstances returns the resources of the state file that has already been given on the command line
+// (nil if there is none).
+func stateInstances(fs *flag.FlagSet, words []string) []state.ResourceInstance {
+	if fs.Lookup("state") == nil {
+		return nil
+	}
+
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {}
+
+	_ = fs.Parse(words[:len(words)-1])
+
+	path := fs.Lookup("state").Value.String()
+	if path == "" {
+		path = fs.Arg(0)
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	tfstate, err := state.New(path)
+	if err != nil {
+		return nil
+	}
+
+	instances, err := tfstate.ResourceInstances()
+	if err != nil {
+		return nil
+	}
+
+	return instances
+}
+
+// completeFiles returns the directories and the files matching any of the given patterns
+// whose path starts with the given prefix.
+func completeFiles(prefix string, patterns []string) []string {
+	dir, base := filepath.Split(prefix)
+
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+
+	entries, err := ioutil.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var result []string
+
+	for _, e := range entries {
+		name := e.Name()
+
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		if e.IsDir() {
+			result = append(result, dir+name+"/")
+			continue
+		}
+
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				result = append(result, dir+name)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// matching returns the sorted, unique candidates that start with the given prefix.
+func matching(candidates []string, prefix string) []string {
+	seen := map[string]bool{}
+
+	var result []string
+
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) && !seen[c] {
+			seen[c] = true
+			result = append(result, c)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// matchingListElement completes the last element of a comma-separated list (without repeating elements).
+func matchingListElement(candidates []string, current string) []string {
+	i := strings.LastIndex(current, ",")
+	head, tail := current[:i+1], current[i+1:]
+
+	given := map[string]bool{}
+	for _, element := range strings.Split(head, ",") {
+		given[element] = true
+	}
+
+	var result []string
+
+	for _, c := range matching(candidates, tail) {
+		if !given[c] {
+			result = append(result, head+c)
+		}
+	}
+
+	return result
+}
+
+// flagName returns the name of the flag given by a word (e.g., "state" for "-state" or "--state=foo"),
+// or an empty string if the word isn't a flag.
+func flagName(word string) string {
+	if len(word) < 2 || word[0] != '-' {
+		return ""
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(word, "-"), "-")
+
+	return strings.SplitN(name, "=", 2)[0]
+}
+
+// isBoolFlag returns true if the flag doesn't take a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(boolFlag)
+
+	return ok && b.IsBoolFlag()
+}
+
+const completionHelp = `
+Print the script to complete the commands and flags of terradozer in a shell.
+
+USAGE:
+  $ terradozer completion bash|zsh|fish
+
+For example, to load completion in the current bash session:
+  $ source <(terradozer completion bash)
+`
+
+const bashCompletion = `
+_terradozer() {
+    local IFS=$'\n'
+    COMPREPLY=($(terradozer __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+}
+
+complete -o default -F _terradozer terradozer
+`
+
+const zshCompletion = `
+#compdef terradozer
+
+_terradozer() {
+    local -a candidates
+    local c
+
+    candidates=("${(@f)$(terradozer __complete "${(@)words[2,$CURRENT]}" 2>/dev/null)}")
+
+    for c in "${candidates[@]}"; do
+        [[ -n $c ]] || continue
+
+        if [[ $c == */ ]]; then
+            compadd -S '' -- "$c"
+        else
+            compadd -- "$c"
+        fi
+    done
+}
+
+compdef _terradozer terradozer
+`
+
+const fishCompletion = `
+function __terradozer_complete
+    set -l words (commandline -opc)[2..-1] (commandline -ct)
+    terradozer __complete $words 2>/dev/null
+end
+
+complete -c terradozer -f -a '(__terradozer_complete)'
+`
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	const tfstate = "test/test-fixtures/tfstates/multiple-providers.tfstate"
+
+	tests := []struct {
+		name     string
+		words    []string
+		expected []string
+	}{
+		{
+			name:     "commands",
+			words:    []string{"p"},
+			expected: []string{"plan", "providers"},
+		},
+		{
+			name:     "flags before command",
+			words:    []string{"-v"},
+			expected: []string{"-version"},
+		},
+		{
+			name:     "flags of command",
+			words:    []string{"destroy", "-aws-r"},
+			expected: []string{"-aws-region"},
+		},
+		{
+			name:     "no force flag for plan",
+			words:    []string{"plan", "-fo"},
+			expected: []string{"-force-compat"},
+		},
+		{
+			name:     "state files",
+			words:    []string{"list", "-state", "test/test-fixtures/tfstates/v"},
+			expected: []string{"test/test-fixtures/tfstates/version3.tfstate", "test/test-fixtures/tfstates/version4.tfstate"},
+		},
+		{
+			name:     "state file as argument",
+			words:    []string{"plan", "-debug", "test/test-fixtures/tfstates/mu"},
+			expected: []string{tfstate},
+		},
+		{
+			name:     "output formats",
+			words:    []string{"list", "-output", ""},
+			expected: []string{"csv", "json", "text"},
+		},
+		{
+			name:     "addresses from state",
+			words:    []string{"destroy", "-state", tfstate, "-exclude-addresses", ""},
+			expected: []string{"aws_vpc.test", "random_integer.test"},
+		},
+		{
+			name:     "types from state in list",
+			words:    []string{"plan", "-state", tfstate, "-protected-types", "aws_vpc,r"},
+			expected: []string{"aws_vpc,random_integer"},
+		},
+		{
+			name:     "types and addresses from state as patterns",
+			words:    []string{"plan", "-state", tfstate, "-include", "aws_"},
+			expected: []string{"aws_vpc", "aws_vpc.test"},
+		},
+		{
+			name:     "addresses without state",
+			words:    []string{"destroy", "-exclude-addresses", ""},
+			expected: nil,
+		},
+		{
+			name:     "shells",
+			words:    []string{"completion", ""},
+			expected: []string{"bash", "fish", "zsh"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, complete(tc.words))
+		})
+	}
+}
+
+func TestRunCompletion(t *testing.T) {
+	assert.Equal(t, 0, runCompletion([]string{"bash"}))
+	assert.Equal(t, exitCodeUsage, runCompletion([]string{"powershell"}))
+	assert.Equal(t, exitCodeUsage, runCompletion(nil))
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the configuration file loaded from the current directory (if it exists).
+const defaultConfigFile = ".terradozer.yaml"
+
+//nolint:gochecknoglobals
+var (
+	// nonConfigurableFlags are flags that can't be set in the configuration file: destroying without confirmation
+	// must never be the default of a committed configuration file.
+	nonConfigurableFlags = map[string]bool{
+		"config":      true,
+		"force":       true,
+		"show-config": true,
+		"state":       true,
+	}
+
+	// flagEnvVars lists the environment variables of flags, which are read in addition to
+	// TERRADOZER_<FLAG NAME> (e.g., TERRADOZER_PARALLEL).
+	flagEnvVars = map[string][]string{
+		"aws-region": {"AWS_REGION", "AWS_DEFAULT_REGION"},
+	}
+
+	// secretFlags are flags whose values are masked when the configuration is shown.
+	secretFlags = map[string]bool{
+		"aws-mfa-token": true,
+	}
+)
+
+// configValue is the value of a key in the configuration file.
+type configValue struct {
+	value string
+	line  int
+}
+
+// configSource is where the value of a flag comes from.
+type configSource string
+
+const (
+	sourceFlag    configSource = "flag"
+	sourceEnv     configSource = "env"
+	sourceConfig  configSource = "config"
+	sourceDefault configSource = "default"
+)
+
+// loadConfigFile reads the configuration file at the given path, whose keys are the names of flags
+// (e.g., "parallel: 5"). A list value is the same as a comma-separated value of a flag.
+// Returns an error naming the line of a key that doesn't configure any flag.
+func loadConfigFile(path string) (map[string]configValue, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	result := map[string]configValue{}
+
+	if len(doc.Content) == 0 {
+		return result, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of keys to values", path, root.Line)
+	}
+
+	known := configKeys()
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+
+		if !known[key.Value] {
+			return nil, fmt.Errorf("%s:%d: unknown key: %s", path, key.Line, key.Value)
+		}
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			result[key.Value] = configValue{value: value.Value, line: key.Line}
+		case yaml.SequenceNode:
+			var elements []string
+
+			for _, e := range value.Content {
+				if e.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("%s:%d: elements of %s must be strings", path, e.Line, key.Value)
+				}
+
+				elements = append(elements, e.Value)
+			}
+
+			result[key.Value] = configValue{value: strings.Join(elements, ","), line: key.Line}
+		default:
+			return nil, fmt.Errorf("%s:%d: value of %s must be a string or a list", path, value.Line, key.Value)
+		}
+	}
+
+	return result, nil
+}
+
+// configKeys returns the keys of the configuration file, which are the names of all flags of all commands
+// that can be configured.
+func configKeys() map[string]bool {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+
+	var shared stateFlags
+
+	var f destroyFlags
+
+	var output string
+
+	shared.register(fs)
+	f.register(fs, false)
+	outputFlag(fs, &output, outputFormatsOf("list"))
+
+	result := map[string]bool{}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if !nonConfigurableFlags[f.Name] {
+			result[f.Name] = true
+		}
+	})
+
+	return result
+}
+
+// envVars returns the environment variables of a flag, ordered by precedence.
+func envVars(flagName string) []string {
+	name := "TERRADOZER_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+
+	return append([]string{name}, flagEnvVars[flagName]...)
+}
+
+// boolFlag is implemented by the values of boolean flags.
+type boolFlag interface {
+	IsBoolFlag() bool
+}
+
+// applyEnv sets the flags that haven't been set on the command line from the environment
+// (i.e., flags take precedence). Returns where the value of each flag comes from so far.
+func applyEnv(fs *flag.FlagSet) (map[string]configSource, error) {
+	sources := map[string]configSource{}
+
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceFlag
+	})
+
+	var err error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] != "" {
+			return
+		}
+
+		sources[f.Name] = sourceDefault
+
+		for _, name := range envVars(f.Name) {
+			v, ok := os.LookupEnv(name)
+			if !ok || v == "" {
+				continue
+			}
+
+			if isBoolFlag(f) {
+				v = normalizeBool(v)
+			}
+
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("invalid value of environment variable %s: %s", name, setErr)
+				return
+			}
+
+			sources[f.Name] = sourceEnv
+
+			return
+		}
+	})
+
+	return sources, err
+}
+
+// normalizeBool returns the value of a boolean environment variable, which also accepts yes and no.
+func normalizeBool(v string) string {
+	switch strings.ToLower(v) {
+	case "yes", "y":
+		return "true"
+	case "no", "n":
+		return "false"
+	}
+
+	return v
+}
+
+// applyConfig sets the flags that have neither been set on the command line nor via the environment
+// from the configuration file, and updates where the value of each flag comes from.
+func applyConfig(fs *flag.FlagSet, config map[string]configValue, configPath string,
+	sources map[string]configSource) error {
+	var err error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] != sourceDefault || nonConfigurableFlags[f.Name] {
+			return
+		}
+
+		if v, ok := config[f.Name]; ok {
+			if setErr := fs.Set(f.Name, v.value); setErr != nil {
+				err = fmt.Errorf("%s:%d: invalid value of %s: %s", configPath, v.line, f.Name, setErr)
+				return
+			}
+
+			sources[f.Name] = sourceConfig
+		}
+	})
+
+	return err
+}
+
+// logConfig logs the effective value of each flag and where it comes from (secrets are masked).
+func logConfig(fs *flag.FlagSet, sources map[string]configSource, configPath string) {
+	internal.LogTitle("showing configuration")
+
+	if configPath != "" {
+		log.WithField("file", configPath).Info(internal.Pad("using config file"))
+	}
+
+	var names []string
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "show-config" {
+			names = append(names, f.Name)
+		}
+	})
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := fs.Lookup(name).Value.String()
+		if secretFlags[name] && value != "" {
+			value = "********"
+		}
+
+		log.WithFields(log.Fields{
+			"value": value,
+			"from":  sources[name],
+		}).Info(internal.Pad(name))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), defaultConfigFile)
+
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	require.NoError(t, err)
+
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedValues map[string]string
+		expectedErrMsg string
+	}{
+		{
+			name:           "empty file",
+			expectedValues: map[string]string{},
+		},
+		{
+			name: "scalars and lists",
+			content: `parallel: 5
+aws-region: eu-west-1
+protected-types:
+  - aws_s3_bucket
+  - aws_kms_key
+`,
+			expectedValues: map[string]string{
+				"parallel":        "5",
+				"aws-region":      "eu-west-1",
+				"protected-types": "aws_s3_bucket,aws_kms_key",
+			},
+		},
+		{
+			name: "unknown key",
+			content: `parallel: 5
+report-path: report.json
+`,
+			expectedErrMsg: ":2: unknown key: report-path",
+		},
+		{
+			name:           "flag that can't be configured",
+			content:        "force: true\n",
+			expectedErrMsg: ":1: unknown key: force",
+		},
+		{
+			name:           "no mapping",
+			content:        "- parallel\n",
+			expectedErrMsg: ":1: expected a mapping of keys to values",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualConfig, err := loadConfigFile(writeConfigFile(t, tc.content))
+
+			if tc.expectedErrMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			actualValues := map[string]string{}
+			for k, v := range actualConfig {
+				actualValues[k] = v.value
+			}
+
+			assert.Equal(t, tc.expectedValues, actualValues)
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		args             []string
+		env              map[string]string
+		expectedParallel int
+		expectedSource   configSource
+	}{
+		{
+			name:             "flag",
+			args:             []string{"-parallel", "3"},
+			env:              map[string]string{"TERRADOZER_PARALLEL": "7"},
+			expectedParallel: 3,
+			expectedSource:   sourceFlag,
+		},
+		{
+			name:             "environment",
+			env:              map[string]string{"TERRADOZER_PARALLEL": "7"},
+			expectedParallel: 7,
+			expectedSource:   sourceEnv,
+		},
+		{
+			name:             "config file",
+			expectedParallel: 5,
+			expectedSource:   sourceConfig,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			configPath := writeConfigFile(t, "parallel: 5\n")
+
+			config, err := loadConfigFile(configPath)
+			require.NoError(t, err)
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+			var f destroyFlags
+
+			f.register(fs, false)
+
+			err = fs.Parse(tc.args)
+			require.NoError(t, err)
+
+			actualSources, err := applyEnv(fs)
+			require.NoError(t, err)
+
+			err = applyConfig(fs, config, configPath, actualSources)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedParallel, f.parallel)
+			assert.Equal(t, tc.expectedSource, actualSources["parallel"])
+			assert.Equal(t, sourceDefault, actualSources["timeout"])
+		})
+	}
+}
+
+func TestApplyConfig_InvalidValue(t *testing.T) {
+	configPath := writeConfigFile(t, "timeout: 1m\nparallel: many\n")
+
+	config, err := loadConfigFile(configPath)
+	require.NoError(t, err)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var f destroyFlags
+
+	f.register(fs, false)
+
+	sources, err := applyEnv(fs)
+	require.NoError(t, err)
+
+	err = applyConfig(fs, config, configPath, sources)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ":2: invalid value of parallel")
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name           string
+		env            map[string]string
+		expectedForce  bool
+		expectedState  string
+		expectedErrMsg string
+	}{
+		{
+			name:          "boolean as yes",
+			env:           map[string]string{"TERRADOZER_FORCE": "yes"},
+			expectedForce: true,
+		},
+		{
+			name:          "boolean as 1",
+			env:           map[string]string{"TERRADOZER_FORCE": "1"},
+			expectedForce: true,
+		},
+		{
+			name: "boolean as no",
+			env:  map[string]string{"TERRADOZER_FORCE": "no"},
+		},
+		{
+			name:          "state",
+			env:           map[string]string{"TERRADOZER_STATE": "terraform.tfstate"},
+			expectedState: "terraform.tfstate",
+		},
+		{
+			name:           "malformed number",
+			env:            map[string]string{"TERRADOZER_PARALLEL": "many"},
+			expectedErrMsg: "invalid value of environment variable TERRADOZER_PARALLEL",
+		},
+		{
+			name:           "malformed boolean",
+			env:            map[string]string{"TERRADOZER_FORCE": "maybe"},
+			expectedErrMsg: "invalid value of environment variable TERRADOZER_FORCE",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+			var shared stateFlags
+
+			var f destroyFlags
+
+			shared.register(fs)
+			f.register(fs, false)
+
+			actualSources, err := applyEnv(fs)
+
+			if tc.expectedErrMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedForce, f.force)
+			assert.Equal(t, tc.expectedState, shared.path)
+			assert.Equal(t, sourceEnv, actualSources[envFlagName(tc.env)])
+		})
+	}
+}
+
+// envFlagName returns the name of the flag whose environment variable is set (expects a single one).
+func envFlagName(env map[string]string) string {
+	for k := range env {
+		return strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(k, "TERRADOZER_"), "_", "-"))
+	}
+
+	return ""
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"github.com/fatih/color"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	goHomeDir "github.com/mitchellh/go-homedir"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// defaultSocket is the default path to the unix socket the daemon listens on.
+const defaultSocket = installDir + "/daemon.sock"
+
+// daemonRequest is the first message a client sends to the daemon to run terradozer.
+type daemonRequest struct {
+	// Args are the command line arguments starting with the command (e.g., plan -state terraform.tfstate).
+	Args []string `json:"args"`
+	// Dir is the working directory of the client, which relative paths are resolved against.
+	Dir string `json:"dir"`
+	// Env is the environment of the client (e.g., AWS credentials or TERRADOZER_<FLAG> variables).
+	Env []string `json:"env"`
+	// NoColor is true if the output of the client isn't colored.
+	NoColor bool `json:"no_color"`
+	// Terminal is true if the stdin of the client is a terminal, so that deletions can be confirmed.
+	Terminal bool `json:"terminal"`
+}
+
+// daemonMessage is a message exchanged between a client and the daemon while a request runs.
+type daemonMessage struct {
+	// Stream is the name of the stream of the data (stdin, stdout, or stderr).
+	Stream string `json:"stream,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+	// EOF is sent by the client once its stdin has been closed.
+	EOF bool `json:"eof,omitempty"`
+	// Interrupt is sent by the client once it has been interrupted (e.g., by Ctrl-C).
+	Interrupt bool `json:"interrupt,omitempty"`
+	// ExitCode is sent by the daemon as last message once the request is done.
+	ExitCode *int `json:"exit_code,omitempty"`
+}
+
+// runDaemon runs terradozer as daemon, which runs the commands requested by clients one after another
+// (see connectDaemon) with providers that keep running across requests. Returns the exit code once the context
+// is done, the process has been interrupted, or no request has been received for the given amount of time.
+// All providers are closed (i.e., their plugin processes are killed) before returning.
+func runDaemon(ctx context.Context, socket string, idleTimeout time.Duration, providerFactory provider.Factory) int {
+	path, err := goHomeDir.Expand(socket)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to expand path to socket: %s\n", err))
+
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := listenDaemon(path)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to start daemon: %s\n", err))
+
+		return 1
+	}
+
+	defer listener.Close()
+
+	pool := newProviderPool(providerFactory)
+	defer pool.close()
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	internal.LogTitle("daemon started")
+	log.WithFields(log.Fields{
+		"socket":       path,
+		"idle_timeout": idleTimeout,
+	}).Info(internal.Pad("waiting for requests"))
+
+	for {
+		err := listener.SetDeadline(time.Now().Add(idleTimeout))
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to set idle timeout of daemon: %s\n", err))
+
+			return 1
+		}
+
+		conn, err := listener.Accept()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			internal.LogTitle("stopping daemon (idle timeout)")
+
+			return 0
+		}
+
+		if err != nil && ctx.Err() != nil {
+			internal.LogTitle("stopping daemon")
+
+			return 0
+		}
+
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to accept request: %s\n", err))
+
+			return 1
+		}
+
+		serveDaemonRequest(ctx, conn, pool)
+	}
+}
+
+// listenDaemon listens on the unix socket with the given path. A socket left behind by a daemon that hasn't
+// been stopped cleanly is removed, but it is an error if another daemon is listening on it already.
+func listenDaemon(path string) (*net.UnixListener, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+
+			return nil, fmt.Errorf("daemon is already running (socket: %s)", path)
+		}
+
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %s", err)
+		}
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	// requests run with the credentials of the daemon's providers, so only the same user may connect
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		_ = listener.Close()
+
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// serveDaemonRequest runs the request of the client connected via the given connection and sends the output
+// and the exit code to the client. The request is canceled if the client is interrupted or gone.
+func serveDaemonRequest(ctx context.Context, conn net.Conn, pool *providerPool) {
+	defer conn.Close()
+
+	dec := json.NewDecoder(conn)
+
+	var req daemonRequest
+
+	err := dec.Decode(&req)
+	if err != nil {
+		log.WithError(err).Warn(internal.Pad("failed to read request"))
+
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"args": strings.Join(req.Args, " "),
+		"dir":  req.Dir,
+	}).Info(internal.Pad("running request"))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		log.WithError(err).Error(internal.Pad("failed to create stdin of request"))
+
+		return
+	}
+
+	defer stdinReader.Close()
+
+	go receiveClientMessages(dec, stdinWriter, cancel)
+
+	out := &messageWriter{enc: json.NewEncoder(conn)}
+
+	code := runDaemonRequest(ctx, req, pool, stdinReader, out)
+
+	pool.release()
+
+	err = out.send(daemonMessage{ExitCode: &code})
+	if err != nil {
+		log.WithError(err).Warn(internal.Pad("failed to send exit code to client"))
+	}
+
+	log.WithField("exit_code", code).Info(internal.Pad("request done"))
+}
+
+// receiveClientMessages passes the stdin received from the client to the given writer and cancels the request
+// once the client is interrupted or gone.
+func receiveClientMessages(dec *json.Decoder, stdin io.WriteCloser, cancel context.CancelFunc) {
+	defer stdin.Close()
+
+	for {
+		var m daemonMessage
+
+		err := dec.Decode(&m)
+		if err != nil {
+			cancel()
+
+			return
+		}
+
+		switch {
+		case m.Interrupt:
+			cancel()
+		case m.EOF:
+			_ = stdin.Close()
+		case m.Stream == "stdin":
+			_, _ = stdin.Write(m.Data)
+		}
+	}
+}
+
+// runDaemonRequest runs terradozer for a request in the environment and working directory of the client
+// and with its own standard streams, which are passed to the client. Returns the exit code.
+func runDaemonRequest(ctx context.Context, req daemonRequest, pool *providerPool, stdin *os.File,
+	out *messageWriter) (code int) {
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return 1
+	}
+
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdoutReader.Close()
+		_ = stdoutWriter.Close()
+
+		return 1
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		out.copy("stdout", stdoutReader)
+	}()
+
+	go func() {
+		defer wg.Done()
+		out.copy("stderr", stderrReader)
+	}()
+
+	restore := isolate(req, stdin, stdoutWriter, stderrWriter)
+
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error:️ %v\n", r))
+
+			code = 1
+		}
+
+		restore()
+
+		_ = stdoutWriter.Close()
+		_ = stderrWriter.Close()
+
+		wg.Wait()
+
+		_ = stdoutReader.Close()
+		_ = stderrReader.Close()
+	}()
+
+	err = os.Chdir(req.Dir)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to change working directory: %s\n", err))
+
+		return 1
+	}
+
+	return runMain(ctx, req.Args, pool.factory)
+}
+
+// isolate sets up the process for a request, i.e., the environment, the standard streams, and global output
+// settings. Returns the function that restores the previous setup (incl. the working directory).
+func isolate(req daemonRequest, stdin, stdout, stderr *os.File) func() {
+	env := os.Environ()
+	dir, _ := os.Getwd()
+	previousStdin, previousStdout, previousStderr := os.Stdin, os.Stdout, os.Stderr
+	noColor := color.NoColor
+	isTerminal := stdinIsTerminal
+
+	if req.Env != nil {
+		setEnv(req.Env)
+	}
+
+	os.Stdin, os.Stdout, os.Stderr = stdin, stdout, stderr
+	color.NoColor = req.NoColor
+	stdinIsTerminal = func() bool { return req.Terminal }
+
+	return func() {
+		setEnv(env)
+
+		if dir != "" {
+			_ = os.Chdir(dir)
+		}
+
+		os.Stdin, os.Stdout, os.Stderr = previousStdin, previousStdout, previousStderr
+		color.NoColor = noColor
+		stdinIsTerminal = isTerminal
+
+		log.SetHandler(cli.New(os.Stderr))
+		log.SetLevel(log.InfoLevel)
+	}
+}
+
+// setEnv replaces the environment of the process with the given one (a list of key=value pairs).
+func setEnv(env []string) {
+	os.Clearenv()
+
+	for _, kv := range env {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) == 2 {
+			_ = os.Setenv(pair[0], pair[1])
+		}
+	}
+}
+
+// messageWriter sends messages to the other end of a connection; it is safe for concurrent use.
+type messageWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *messageWriter) send(m interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.enc.Encode(m)
+}
+
+// copy sends everything read from the given reader as data of the stream with the given name.
+func (w *messageWriter) copy(stream string, r io.Reader) {
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if sendErr := w.send(daemonMessage{Stream: stream, Data: buf[:n]}); sendErr != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// connectDaemon runs a command (i.e., the given command line arguments starting with the command) in the daemon
+// listening on the given socket and returns the exit code. The standard streams are passed between the daemon
+// and the given reader and writers; a first interrupt cancels the command in the daemon, a second one returns
+// immediately. Returns false as second value if the daemon isn't running (i.e., the command needs to run without
+// the daemon).
+func connectDaemon(socket string, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, bool) {
+	path, err := goHomeDir.Expand(socket)
+	if err != nil {
+		return 0, false
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		log.WithField("socket", path).Debug(internal.Pad("daemon not running"))
+
+		return 0, false
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		log.WithError(err).WithField("socket", path).
+			Warn(internal.Pad("failed to connect to daemon; running command without daemon"))
+
+		return 0, false
+	}
+
+	defer conn.Close()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprint(stderr, color.RedString("Error:️ failed to get working directory: %s\n", err))
+
+		return 1, true
+	}
+
+	out := &messageWriter{enc: json.NewEncoder(conn)}
+
+	err = out.send(daemonRequest{Args: args, Dir: dir, Env: os.Environ(), NoColor: color.NoColor,
+		Terminal: stdinIsTerminal()})
+	if err != nil {
+		fmt.Fprint(stderr, color.RedString("Error:️ failed to send request to daemon: %s\n", err))
+
+		return 1, true
+	}
+
+	go sendStdin(stdin, out)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	defer signal.Stop(signals)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	messages, errs := receiveDaemonMessages(conn, done)
+
+	interrupted := false
+
+	for {
+		select {
+		case <-signals:
+			if interrupted {
+				return exitCodeInterrupted, true
+			}
+
+			interrupted = true
+
+			_ = out.send(daemonMessage{Interrupt: true})
+
+		case m := <-messages:
+			if m.ExitCode != nil {
+				return *m.ExitCode, true
+			}
+
+			switch m.Stream {
+			case "stdout":
+				_, _ = stdout.Write(m.Data)
+			case "stderr":
+				_, _ = stderr.Write(m.Data)
+			}
+
+		case err := <-errs:
+			fmt.Fprint(stderr, color.RedString("Error:️ lost connection to daemon: %s\n", err))
+
+			return 1, true
+		}
+	}
+}
+
+// sendStdin sends everything read from the given reader to the daemon, followed by an EOF message.
+func sendStdin(stdin io.Reader, out *messageWriter) {
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := stdin.Read(buf)
+		if n > 0 {
+			if sendErr := out.send(daemonMessage{Stream: "stdin", Data: buf[:n]}); sendErr != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			_ = out.send(daemonMessage{EOF: true})
+
+			return
+		}
+	}
+}
+
+// receiveDaemonMessages receives the messages from the daemon until the connection fails or done is closed.
+func receiveDaemonMessages(conn net.Conn, done <-chan struct{}) (<-chan daemonMessage, <-chan error) {
+	messages := make(chan daemonMessage)
+	errs := make(chan error, 1)
+
+	go func() {
+		dec := json.NewDecoder(conn)
+
+		for {
+			var m daemonMessage
+
+			err := dec.Decode(&m)
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			select {
+			case messages <- m:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return messages, errs
+}
+
+// providerPool keeps the providers created by a factory running across the requests to the daemon,
+// so that each provider is installed, launched, and configured only once.
+type providerPool struct {
+	launch    provider.Factory
+	providers map[string]*pooledProvider
+}
+
+// newProviderPool returns a pool of providers created by the given factory (defaults to provider.PluginFactory).
+func newProviderPool(factory provider.Factory) *providerPool {
+	if factory == nil {
+		factory = provider.PluginFactory(installDir)
+	}
+
+	return &providerPool{launch: factory, providers: map[string]*pooledProvider{}}
+}
+
+// factory implements provider.Factory and returns the running provider with the given name and version,
+// which is launched if it isn't running yet.
+func (p *providerPool) factory(name, version string) (provider.Provider, error) {
+	key := name + "@" + version
+
+	if pp, ok := p.providers[key]; ok {
+		return pp, nil
+	}
+
+	launched, err := p.launch(name, version)
+	if err != nil || launched == nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"name":    name,
+		"version": version,
+	}).Debug(internal.Pad("launched provider kept running by daemon"))
+
+	pp := &pooledProvider{Provider: launched}
+	p.providers[key] = pp
+
+	return pp, nil
+}
+
+// release closes the providers that can't be used for further requests, i.e., they have been stopped
+// (e.g., due to an interrupt) or their plugin process has exited.
+func (p *providerPool) release() {
+	for key, pp := range p.providers {
+		if !pp.isStopped() && !provider.Exited(pp.Provider) {
+			continue
+		}
+
+		_ = pp.Provider.Close()
+
+		delete(p.providers, key)
+	}
+}
+
+// close closes all providers.
+func (p *providerPool) close() {
+	for key, pp := range p.providers {
+		_ = pp.Provider.Close()
+
+		delete(p.providers, key)
+	}
+}
+
+// pooledProvider is a provider of a providerPool, which is only closed by the pool and is only configured again
+// if the configuration changes.
+type pooledProvider struct {
+	provider.Provider
+
+	mu sync.Mutex
+	// config is the configuration of the last successful call of Configure (nil if there is none).
+	config *cty.Value
+	// stopped is true once Stop has been called.
+	stopped bool
+}
+
+// Configure configures the provider, unless it has been configured with the same configuration already.
+func (p *pooledProvider) Configure(req providers.ConfigureRequest) providers.ConfigureResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config != nil && p.config.RawEquals(req.Config) {
+		return providers.ConfigureResponse{}
+	}
+
+	p.config = nil
+
+	resp := p.Provider.Configure(req)
+	if !resp.Diagnostics.HasErrors() {
+		config := req.Config
+		p.config = &config
+	}
+
+	return resp
+}
+
+// PlanResourceChange plans a change with the provider, if it plans changes (see provider.Planner).
+func (p *pooledProvider) PlanResourceChange(
+	req providers.PlanResourceChangeRequest) providers.PlanResourceChangeResponse {
+	if planner, ok := p.Provider.(provider.Planner); ok {
+		return planner.PlanResourceChange(req)
+	}
+
+	return providers.PlanResourceChangeResponse{PlannedState: req.ProposedNewState}
+}
+
+// Stop stops all running operations of the provider, which is closed by the pool afterwards.
+func (p *pooledProvider) Stop() error {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+
+	return p.Provider.Stop()
+}
+
+// Close keeps the provider running, as it is closed by the pool.
+func (p *pooledProvider) Close() error {
+	return nil
+}
+
+func (p *pooledProvider) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stopped
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// countingProvider is a fake provider that counts how often it has been configured and closed.
+type countingProvider struct {
+	*fakeProvider
+	configured int
+	closed     int
+}
+
+func (p *countingProvider) Configure(providers.ConfigureRequest) providers.ConfigureResponse {
+	p.configured++
+
+	return providers.ConfigureResponse{}
+}
+
+func (p *countingProvider) Close() error {
+	p.closed++
+
+	return nil
+}
+
+func TestProviderPool(t *testing.T) {
+	var launched []*countingProvider
+
+	pool := newProviderPool(func(name, version string) (provider.Provider, error) {
+		p := &countingProvider{fakeProvider: &fakeProvider{destroyed: map[string]bool{}}}
+		launched = append(launched, p)
+
+		return p, nil
+	})
+
+	first, err := pool.factory("aws", "v3.42.0")
+	require.NoError(t, err)
+
+	second, err := pool.factory("aws", "v3.42.0")
+	require.NoError(t, err)
+
+	require.Len(t, launched, 1)
+	assert.Same(t, first, second)
+
+	config := cty.ObjectVal(map[string]cty.Value{"region": cty.StringVal("us-west-2")})
+
+	first.Configure(providers.ConfigureRequest{Config: config})
+	second.Configure(providers.ConfigureRequest{Config: config})
+	assert.Equal(t, 1, launched[0].configured, "provider must not be configured again with the same config")
+
+	second.Configure(providers.ConfigureRequest{
+		Config: cty.ObjectVal(map[string]cty.Value{"region": cty.StringVal("eu-west-1")}),
+	})
+	assert.Equal(t, 2, launched[0].configured)
+
+	require.NoError(t, first.Close())
+	assert.Equal(t, 0, launched[0].closed, "provider must be kept running")
+
+	pool.release()
+	assert.Equal(t, 0, launched[0].closed)
+
+	require.NoError(t, first.Stop())
+	pool.release()
+	assert.Equal(t, 1, launched[0].closed, "stopped provider must be closed")
+
+	_, err = pool.factory("aws", "v3.42.0")
+	require.NoError(t, err)
+	require.Len(t, launched, 2, "stopped provider must be launched again")
+
+	pool.close()
+	assert.Equal(t, 1, launched[1].closed)
+}
+
+func TestDaemon(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+
+	var launched []*countingProvider
+
+	factory := func(name, version string) (provider.Provider, error) {
+		p := &countingProvider{fakeProvider: &fakeProvider{destroyed: map[string]bool{}}}
+		launched = append(launched, p)
+
+		return p, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exitCode := make(chan int, 1)
+
+	go func() {
+		exitCode <- runDaemon(ctx, socket, time.Minute, factory)
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socket)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		var stdout, stderr bytes.Buffer
+
+		actualExitCode, ok := connectDaemon(socket,
+			[]string{"plan", "test/test-fixtures/tfstates/fake-providers.tfstate"},
+			strings.NewReader(""), &stdout, &stderr)
+		require.True(t, ok)
+
+		assert.Equal(t, 0, actualExitCode)
+		assert.Contains(t, stderr.String(), "TOTAL NUMBER OF RESOURCES THAT WOULD BE DELETED: 2")
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	actualExitCode, ok := connectDaemon(socket, []string{"plan", "-foo"}, strings.NewReader(""), &stdout, &stderr)
+	require.True(t, ok)
+
+	assert.Equal(t, exitCodeUsage, actualExitCode)
+	assert.Contains(t, stderr.String(), "flag provided but not defined: -foo")
+
+	require.Len(t, launched, 2, "providers (aws and random) must be launched only once")
+
+	for _, p := range launched {
+		assert.Equal(t, 1, p.configured)
+		assert.Equal(t, 0, p.closed)
+	}
+
+	cancel()
+
+	select {
+	case code := <-exitCode:
+		assert.Equal(t, 0, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon didn't stop")
+	}
+
+	for _, p := range launched {
+		assert.Equal(t, 1, p.closed, "providers must be closed once the daemon stops")
+	}
+
+	assert.NoFileExists(t, socket)
+}
+
+func TestDaemon_IdleTimeout(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+
+	actualExitCode := runDaemon(context.Background(), socket, 50*time.Millisecond, nil)
+
+	assert.Equal(t, 0, actualExitCode)
+	assert.NoFileExists(t, socket)
+}
+
+func TestConnectDaemon_NotRunning(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+
+	_, ok := connectDaemon(socket, []string{"plan"}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	assert.False(t, ok)
+
+	// socket left behind by a daemon that hasn't been stopped cleanly
+	require.NoError(t, ioutil.WriteFile(socket, nil, 0600))
+
+	_, ok = connectDaemon(socket, []string{"plan"}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	assert.False(t, ok)
+}
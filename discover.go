@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/discover"
+	"github.com/jckuester/terradozer/pkg/state"
+)
+
+// discoverResources discovers the resources with the tags given by -discover-tag, logs the ones that can't be
+// destroyed, writes all of them to the file given by -discover-output (if any), and returns a state of the ones
+// that can be destroyed (see state.FromResourceIDs).
+func discoverResources(ctx context.Context, sess *session.Session, f stateFlags) (*state.State, error) {
+	tags, err := discover.ParseTags(f.discoverTags)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.LogTitle("discovering resources by tags")
+
+	result, err := discover.Discover(ctx, sess, tags, splitList(f.discoverTypes))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []state.ResourceID
+
+	for _, r := range result.Resources {
+		log.WithFields(log.Fields{"type": r.Type, "id": r.ID, "arn": r.ARN}).Debug("discovered resource")
+
+		ids = append(ids, state.ResourceID{Type: r.Type, ID: r.ID})
+	}
+
+	tfstate, adoption, err := state.FromResourceIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"tags":            f.discoverTags,
+		"resources":       adoption.Resources,
+		"not_destroyable": len(result.Undestroyable),
+	}).Info(internal.Pad("adopting resources discovered by tags"))
+
+	if len(result.Undestroyable) > 0 {
+		internal.LogTitle(fmt.Sprintf("discovered but not destroyable resources (ignored): %d",
+			len(result.Undestroyable)))
+
+		for _, u := range result.Undestroyable {
+			log.WithField("resource_type", u.ResourceType).Warn(internal.Pad(u.ARN))
+		}
+	}
+
+	if f.discoverOutput != "" {
+		if err := writeDiscovered(f.discoverOutput, *result); err != nil {
+			return nil, fmt.Errorf("failed to write discovered resources: %s", err)
+		}
+	}
+
+	return tfstate, nil
+}
+
+// writeDiscovered writes the discovered resources as CSV file of resource IDs to the given path.
+func writeDiscovered(path string, result discover.Result) error {
+	var b bytes.Buffer
+
+	if err := result.WriteCSV(&b); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, b.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path":            path,
+		"resources":       len(result.Resources),
+		"not_destroyable": len(result.Undestroyable),
+	}).Info(internal.Pad("wrote discovered resources"))
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// endpointsFakeProvider is a fakeProvider whose configuration has an endpoints block (see -aws-endpoint-url).
+type endpointsFakeProvider struct {
+	*fakeProvider
+}
+
+func (p endpointsFakeProvider) GetSchema() providers.GetSchemaResponse {
+	schema := p.fakeProvider.GetSchema()
+
+	schema.Provider.Block.BlockTypes = map[string]*configschema.NestedBlock{
+		"endpoints": {
+			Nesting: configschema.NestingSet,
+			Block: configschema.Block{Attributes: map[string]*configschema.Attribute{
+				"ec2": {Type: cty.String, Optional: true},
+			}},
+		},
+	}
+
+	return schema
+}
+
+func TestMainExitCode_Discover(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		expectedDeleted []string
+	}{
+		{
+			name:            "destroy",
+			args:            []string{"-force"},
+			expectedDeleted: []string{"aws_vpc.vpc-1", "aws_vpc.vpc-2"},
+		},
+		{
+			name: "dry run",
+			args: []string{"-dry-run", "-force"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "test")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			// a fake tagging API
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"ResourceTagMappingList": []map[string]string{
+						{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:vpc/vpc-1"},
+						{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:vpc/vpc-2"},
+						{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:key-pair/key-1"},
+					},
+				})
+			}))
+			defer server.Close()
+
+			fake := &fakeProvider{destroyed: map[string]bool{}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return endpointsFakeProvider{fake}, nil
+			}
+
+			output := filepath.Join(t.TempDir(), "discovered.csv")
+
+			args := append([]string{discoverCommand, "-parallel", "1", "-aws-endpoint-url", server.URL,
+				"-discover-tag", "ephemeral=true", "-discover-output", output}, tc.args...)
+
+			actualExitCode := mainExitCode(args, factory)
+			require.Equal(t, 0, actualExitCode)
+
+			assert.Equal(t, tc.expectedDeleted, fake.deleted)
+
+			actualOutput, err := ioutil.ReadFile(output)
+			require.NoError(t, err)
+
+			assert.Equal(t, "type,id\naws_vpc,vpc-1\naws_vpc,vpc-2\n"+
+				"# not destroyable (ec2:key-pair): arn:aws:ec2:us-west-2:123456789012:key-pair/key-1\n",
+				string(actualOutput))
+		})
+	}
+}
+
+func TestMainExitCode_DiscoverUsageError(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "missing tag",
+			args: []string{discoverCommand},
+		},
+		{
+			name: "unsupported type",
+			args: []string{discoverCommand, "-discover-tag", "ephemeral=true", "-discover-types", "aws_key_pair"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, 64, mainExitCode(tc.args, nil))
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+)
+
+// logEvents logs the progress of updating and destroying resources on the command line.
+type logEvents struct {
+	// modules counts the deleted resources by module instance to summarize them (can be nil).
+	modules *moduleSummary
+	// auxiliaries collects the deleted resources that aren't part of the state to summarize them (can be nil).
+	auxiliaries *auxiliarySummary
+	// owners counts the deleted resources by owner to summarize them (nil if owners are disabled).
+	owners *ownerSummary
+	// deposed counts the deleted deposed objects of resource instances to summarize them (can be nil).
+	deposed *deposedSummary
+	// report lists the deleted resources to write them to the report of the run (nil if not requested).
+	report *runReport
+}
+
+// ResourceDiscovered implements destroy.Events.
+func (logEvents) ResourceDiscovered(destroy.ResourceEvent) {}
+
+// ResourceImportFailed implements destroy.Events.
+func (logEvents) ResourceImportFailed(e destroy.ResourceEvent) {
+	log.WithError(e.Err).WithFields(log.Fields{
+		"type":        e.Type,
+		"resource_id": e.ID,
+		"skip_reason": e.SkipReason,
+	}).WithFields(ownerFields(e.Owner)).WithFields(deposedFields(e.Deposed)).Info("cannot refresh resource state")
+}
+
+// ResourceDeleted implements destroy.Events.
+func (l logEvents) ResourceDeleted(e destroy.ResourceEvent) {
+	log.WithField("id", e.ID).WithFields(e.Fields).WithFields(ownerFields(e.Owner)).
+		WithFields(deposedFields(e.Deposed)).Error(internal.Pad(e.Type))
+
+	if l.modules != nil {
+		l.modules.deleted(e.Address)
+	}
+
+	if l.owners != nil {
+		l.owners.deleted(e.Owner)
+	}
+
+	if l.deposed != nil && e.Deposed != "" {
+		l.deposed.deleted()
+	}
+
+	if l.report != nil {
+		l.report.deleted(e)
+	}
+}
+
+// ResourceFailed implements destroy.Events.
+func (logEvents) ResourceFailed(e destroy.ResourceEvent) {
+	if e.Retryable {
+		log.WithFields(log.Fields{
+			"type":        e.Type,
+			"resource_id": e.ID,
+		}).WithFields(ownerFields(e.Owner)).WithFields(deposedFields(e.Deposed)).
+			Info(internal.Pad("will retry to delete resource"))
+
+		return
+	}
+
+	log.WithError(e.Err).WithFields(log.Fields{
+		"type":        e.Type,
+		"resource_id": e.ID,
+	}).WithFields(ownerFields(e.Owner)).WithFields(deposedFields(e.Deposed)).
+		Debug(internal.Pad("unable to delete resource"))
+}
+
+// AuxiliaryDeleted implements destroy.Events.
+func (l logEvents) AuxiliaryDeleted(d destroy.AuxiliaryDeletion) {
+	if l.auxiliaries != nil {
+		l.auxiliaries.add(d)
+	}
+}
+
+// RunCompleted implements destroy.Events.
+func (l logEvents) RunCompleted(result destroy.Result) {
+	if result.Interrupted {
+		return
+	}
+
+	if result.Throttling != nil {
+		internal.LogTitle(fmt.Sprintf("requests throttled by the AWS API: %d", result.Throttling.Throttles))
+		log.WithFields(log.Fields{
+			"concurrency":     result.Throttling.Concurrency,
+			"max_concurrency": result.Throttling.MaxConcurrency,
+		}).Info(internal.Pad("effective concurrency at the end of the run"))
+	}
+
+	var retriesExceeded []destroy.RetryDestroyError
+
+	failedByClass := map[destroy.ErrorClass][]destroy.RetryDestroyError{}
+
+	for _, err := range result.Failed {
+		if err.Class.Retryable() {
+			retriesExceeded = append(retriesExceeded, err)
+			continue
+		}
+
+		failedByClass[err.Class] = append(failedByClass[err.Class], err)
+	}
+
+	logFailedResources("retries exceeded", retriesExceeded)
+
+	var classes []destroy.ErrorClass
+
+	for class := range failedByClass {
+		if class != destroy.ErrorClassCredentialsExpired {
+			classes = append(classes, class)
+		}
+	}
+
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+
+	for _, class := range classes {
+		logFailedResources(class.String(), failedByClass[class])
+	}
+
+	logRepeatedDiagnostics(result.Failed)
+
+	credentialsExpiredResources := failedByClass[destroy.ErrorClassCredentialsExpired]
+
+	if len(credentialsExpiredResources) > 0 {
+		internal.LogTitle(fmt.Sprintf("failed to delete the following resources (credentials expired): %d",
+			len(credentialsExpiredResources)))
+
+		for _, err := range credentialsExpiredResources {
+			log.WithField("id", err.Resource.ID()).WithFields(ownerFields(destroy.OwnerOf(err.Resource))).
+				WithFields(deposedFields(destroy.DeposedOf(err.Resource))).Warn(internal.Pad(err.Resource.Type()))
+		}
+
+		log.Warn(internal.Pad("refresh the AWS credentials and run terradozer again to delete the remaining resources"))
+	}
+
+	if l.auxiliaries != nil {
+		l.auxiliaries.log()
+	}
+
+	if l.modules != nil {
+		l.modules.log(result.Failed)
+	}
+
+	if l.owners != nil {
+		l.owners.log(result.Failed)
+	}
+
+	if l.deposed != nil {
+		l.deposed.log(result.Failed)
+	}
+}
+
+// ownerFields returns the field of the owner of a resource to log (none if owners are disabled).
+func ownerFields(owner string) log.Fields {
+	if owner == "" {
+		return nil
+	}
+
+	return log.Fields{"owner": owner}
+}
+
+// deposedFields returns the field of the deposed key of a resource to log (none if it's a current object).
+func deposedFields(deposed string) log.Fields {
+	if deposed == "" {
+		return nil
+	}
+
+	return log.Fields{"deposed": deposed}
+}
+
+// deposedSummary counts the deleted deposed objects of resource instances (see destroy.Resource.Deposed).
+type deposedSummary struct {
+	mu           sync.Mutex
+	numOfDeleted int
+}
+
+// deleted counts a deleted deposed object.
+func (s *deposedSummary) deleted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.numOfDeleted++
+}
+
+// log logs the number of deleted and failed deposed objects (nothing if there were none).
+func (s *deposedSummary) log(failed []destroy.RetryDestroyError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numOfFailed := 0
+
+	for _, err := range failed {
+		if destroy.DeposedOf(err.Resource) != "" {
+			numOfFailed++
+		}
+	}
+
+	if s.numOfDeleted == 0 && numOfFailed == 0 {
+		return
+	}
+
+	internal.LogTitle("number of deposed objects of resource instances")
+	log.WithFields(log.Fields{
+		"deleted": s.numOfDeleted,
+		"failed":  numOfFailed,
+	}).Info(internal.Pad("deposed objects (e.g., left behind by failed create-before-destroy replacements)"))
+}
+
+// ownerSummary counts the deleted resources by owner (see destroy.Resource.Owner).
+type ownerSummary struct {
+	mu           sync.Mutex
+	numOfDeleted map[string]int
+}
+
+func newOwnerSummary() *ownerSummary {
+	return &ownerSummary{numOfDeleted: map[string]int{}}
+}
+
+// deleted counts a deleted resource of the given owner.
+func (s *ownerSummary) deleted(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.numOfDeleted[owner]++
+}
+
+// log logs the number of deleted and failed resources by owner, sorted by owner (unowned resources last).
+func (s *ownerSummary) log(failed []destroy.RetryDestroyError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numOfFailed := map[string]int{}
+
+	for _, err := range failed {
+		numOfFailed[destroy.OwnerOf(err.Resource)]++
+	}
+
+	var owners []string
+
+	for o := range s.numOfDeleted {
+		owners = append(owners, o)
+	}
+
+	for o := range numOfFailed {
+		if _, ok := s.numOfDeleted[o]; !ok {
+			owners = append(owners, o)
+		}
+	}
+
+	if len(owners) == 0 {
+		return
+	}
+
+	sort.Slice(owners, func(i, j int) bool {
+		if (owners[i] == destroy.Unowned) != (owners[j] == destroy.Unowned) {
+			return owners[j] == destroy.Unowned
+		}
+
+		return owners[i] < owners[j]
+	})
+
+	internal.LogTitle("summary by owner")
+
+	for _, o := range owners {
+		log.WithFields(log.Fields{
+			"deleted": s.numOfDeleted[o],
+			"failed":  numOfFailed[o],
+		}).Info(internal.Pad(o))
+	}
+}
+
+// moduleSummary counts the deleted resources by top-level module instance (see destroy.ModuleOf).
+type moduleSummary struct {
+	mu           sync.Mutex
+	numOfDeleted map[string]int
+}
+
+func newModuleSummary() *moduleSummary {
+	return &moduleSummary{numOfDeleted: map[string]int{}}
+}
+
+// deleted counts the deleted resource with the given address.
+func (s *moduleSummary) deleted(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.numOfDeleted[destroy.ModuleOf(address)]++
+}
+
+// log logs the number of deleted and failed resources by module instance, if any resource is part of a module.
+func (s *moduleSummary) log(failed []destroy.RetryDestroyError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numOfFailed := map[string]int{}
+
+	for _, err := range failed {
+		numOfFailed[destroy.ModuleOf(err.Resource.Address())]++
+	}
+
+	var modules []string
+
+	for m := range s.numOfDeleted {
+		modules = append(modules, m)
+	}
+
+	for m := range numOfFailed {
+		if _, ok := s.numOfDeleted[m]; !ok {
+			modules = append(modules, m)
+		}
+	}
+
+	if len(modules) == 0 || (len(modules) == 1 && modules[0] == destroy.RootModule) {
+		return
+	}
+
+	destroy.SortModules(modules)
+
+	internal.LogTitle("summary by module instance")
+
+	for _, m := range modules {
+		log.WithFields(log.Fields{
+			"deleted": s.numOfDeleted[m],
+			"failed":  numOfFailed[m],
+		}).Info(internal.Pad(m))
+	}
+}
+
+// auxiliarySummary collects the deleted resources that aren't part of the state (see destroy.AuxiliaryDeletion).
+type auxiliarySummary struct {
+	mu          sync.Mutex
+	auxiliaries []destroy.AuxiliaryDeletion
+}
+
+// add collects the given auxiliary deletion.
+func (s *auxiliarySummary) add(d destroy.AuxiliaryDeletion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.auxiliaries = append(s.auxiliaries, d)
+}
+
+// log logs the deleted and failed auxiliary resources, separately from the resources of the state.
+func (s *auxiliarySummary) log() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted, failed []destroy.AuxiliaryDeletion
+
+	for _, d := range s.auxiliaries {
+		if d.Outcome == destroy.AuxiliaryFailed {
+			failed = append(failed, d)
+			continue
+		}
+
+		deleted = append(deleted, d)
+	}
+
+	logAuxiliaries("deleted the following resources outside the state", deleted)
+	logAuxiliaries("failed to delete the following resources outside the state", failed)
+}
+
+// logAuxiliaries logs the given auxiliary resources under the given title, sorted by parent resource.
+func logAuxiliaries(title string, auxiliaries []destroy.AuxiliaryDeletion) {
+	if len(auxiliaries) == 0 {
+		return
+	}
+
+	sort.SliceStable(auxiliaries, func(i, j int) bool { return auxiliaries[i].Parent < auxiliaries[j].Parent })
+
+	internal.LogTitle(fmt.Sprintf("%s: %d", title, len(auxiliaries)))
+
+	for _, d := range auxiliaries {
+		entry := log.WithFields(log.Fields{
+			"parent": d.Parent,
+			"id":     d.ID,
+		})
+
+		if d.Err != nil {
+			entry.WithError(d.Err).Warn(internal.Pad(d.Type))
+			continue
+		}
+
+		entry.Info(internal.Pad(d.Type))
+	}
+}
+
+// logProviderUpgrades logs the resources handled by upgraded providers, since their schema versions
+// in the state are newer than the ones of the providers in use.
+func logProviderUpgrades(upgrades []destroy.ProviderUpgrade) {
+	for _, u := range upgrades {
+		internal.LogTitle(fmt.Sprintf("resources handled by upgraded provider %s %s → %s: %d",
+			u.Provider, u.From, u.To, len(u.Addresses)))
+
+		for _, address := range u.Addresses {
+			log.Info(internal.Pad(address))
+		}
+	}
+}
+
+// logConsumerReferences logs the resources of other states that reference resources that would be deleted.
+func logConsumerReferences(references []destroy.ConsumerReference) {
+	if len(references) == 0 {
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("resources of other states referencing resources that would be deleted: %d",
+		referencedCandidates(references)))
+
+	for _, ref := range references {
+		log.WithFields(log.Fields{
+			"state":     ref.State,
+			"consumer":  ref.Consumer,
+			"attribute": ref.Attribute,
+			"value":     ref.Value,
+		}).Warn(internal.Pad(ref.Candidate))
+	}
+}
+
+// referencedCandidates returns the number of resources that would be deleted that are referenced by other states.
+func referencedCandidates(references []destroy.ConsumerReference) int {
+	candidates := map[string]bool{}
+
+	for _, ref := range references {
+		candidates[ref.Candidate] = true
+	}
+
+	return len(candidates)
+}
+
+// logFailedResources logs the resources that failed to be destroyed for the given reason.
+func logFailedResources(reason string, errs []destroy.RetryDestroyError) {
+	if len(errs) == 0 {
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("failed to delete the following resources (%s): %d", reason, len(errs)))
+
+	for _, err := range errs {
+		log.WithError(err).WithField("id", err.Resource.ID()).WithFields(ownerFields(destroy.OwnerOf(err.Resource))).
+			WithFields(deposedFields(destroy.DeposedOf(err.Resource))).Warn(internal.Pad(err.Resource.Type()))
+	}
+}
+
+// logRepeatedDiagnostics logs the error diagnostics of providers that several of the given failed resources
+// have in common, with the number of resources, most frequent first.
+func logRepeatedDiagnostics(errs []destroy.RetryDestroyError) {
+	numOfResources := map[string]int{}
+
+	for _, err := range errs {
+		seen := map[string]bool{}
+
+		for _, d := range provider.DiagnosticsOf(err) {
+			msg := d.String()
+			if d.Severity != provider.SeverityError || seen[msg] {
+				continue
+			}
+
+			seen[msg] = true
+			numOfResources[msg]++
+		}
+	}
+
+	var repeated []string
+
+	for msg, n := range numOfResources {
+		if n > 1 {
+			repeated = append(repeated, msg)
+		}
+	}
+
+	if len(repeated) == 0 {
+		return
+	}
+
+	sort.Slice(repeated, func(i, j int) bool {
+		if numOfResources[repeated[i]] != numOfResources[repeated[j]] {
+			return numOfResources[repeated[i]] > numOfResources[repeated[j]]
+		}
+
+		return repeated[i] < repeated[j]
+	})
+
+	internal.LogTitle(fmt.Sprintf("errors of providers in common: %d", len(repeated)))
+
+	for _, msg := range repeated {
+		log.Warn(internal.Pad(fmt.Sprintf("%d resources failed with: %s", numOfResources[msg], msg)))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+)
+
+const (
+	// graphFormatDOT is the value of the -graph-format flag to write a graph in the Graphviz DOT language.
+	graphFormatDOT = "dot"
+	// graphFormatMermaid is the value of the -graph-format flag to write a Mermaid flowchart (e.g., for wikis).
+	graphFormatMermaid = "mermaid"
+)
+
+//nolint:gochecknoglobals
+var (
+	// graphColors are the fill colors of the nodes of a graph by the planned outcome of their resources.
+	graphColors = map[destroy.GraphOutcome]string{
+		destroy.GraphOutcomeDelete:    "#f4cccc",
+		destroy.GraphOutcomeSkip:      "#eeeeee",
+		destroy.GraphOutcomeProtected: "#d9ead3",
+	}
+)
+
+// writeGraph writes the graph of the given plan (restricted to the given module instance, if not empty)
+// in the given format to the file at the given path.
+func writeGraph(path, format, module string, plan *destroy.DestroyPlan) error {
+	g := plan.Graph()
+
+	if module != "" {
+		g = g.Module(module)
+	}
+
+	var content []byte
+
+	switch format {
+	case graphFormatMermaid:
+		content = renderMermaid(g)
+	default:
+		content = renderDOT(g)
+	}
+
+	err := ioutil.WriteFile(path, content, 0600)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path":   path,
+		"format": format,
+		"nodes":  len(g.Nodes),
+		"edges":  len(g.Edges),
+	}).Info(internal.Pad("wrote graph"))
+
+	return nil
+}
+
+// nodeLabel returns the label of a node of a graph: its name and the group (or the reason why it is skipped).
+func nodeLabel(n destroy.GraphNode) string {
+	if n.Outcome == destroy.GraphOutcomeDelete {
+		return fmt.Sprintf("%s\ngroup %d", n.Name, n.Group)
+	}
+
+	return fmt.Sprintf("%s\n%s", n.Name, n.SkipReason)
+}
+
+// renderDOT renders the given graph in the Graphviz DOT language (e.g., dot -Tsvg out.dot > out.svg).
+func renderDOT(g destroy.Graph) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("digraph destroy {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString("  node [shape=box, style=filled];\n")
+
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&buf, "  %q [label=%q, fillcolor=%q];\n", n.Name, nodeLabel(n), graphColors[n.Outcome])
+	}
+
+	for _, e := range g.Edges {
+		style := ""
+		if e.Implicit {
+			style = " [style=dashed]"
+		}
+
+		fmt.Fprintf(&buf, "  %q -> %q%s;\n", e.From, e.To, style)
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+// renderMermaid renders the given graph as Mermaid flowchart.
+func renderMermaid(g destroy.Graph) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("flowchart LR\n")
+
+	// node names (i.e., addresses) can't be used as IDs of nodes in Mermaid
+	ids := map[string]string{}
+
+	for i, n := range g.Nodes {
+		ids[n.Name] = fmt.Sprintf("n%d", i)
+
+		label := strings.ReplaceAll(strings.ReplaceAll(nodeLabel(n), `"`, "#quot;"), "\n", "<br>")
+
+		fmt.Fprintf(&buf, "  %s[\"%s\"]:::%s\n", ids[n.Name], label, n.Outcome)
+	}
+
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Implicit {
+			arrow = "-.->"
+		}
+
+		fmt.Fprintf(&buf, "  %s %s %s\n", ids[e.From], arrow, ids[e.To])
+	}
+
+	for _, outcome := range []destroy.GraphOutcome{destroy.GraphOutcomeDelete, destroy.GraphOutcomeSkip,
+		destroy.GraphOutcomeProtected} {
+		fmt.Fprintf(&buf, "  classDef %s fill:%s\n", outcome, graphColors[outcome])
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderGraph(t *testing.T) {
+	g := destroy.Graph{
+		Nodes: []destroy.GraphNode{
+			{Name: `module.preview["pr-1"].aws_nat_gateway.test`, Outcome: destroy.GraphOutcomeDelete, Group: 1},
+			{Name: "aws_eip.nat", Outcome: destroy.GraphOutcomeDelete, Group: 2},
+			{Name: "aws_default_vpc.default", Outcome: destroy.GraphOutcomeProtected,
+				SkipReason: destroy.SkipReasonDefaultResource},
+		},
+		Edges: []destroy.GraphEdge{
+			{From: `module.preview["pr-1"].aws_nat_gateway.test`, To: "aws_eip.nat", Implicit: true},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		render   func(destroy.Graph) []byte
+		expected string
+	}{
+		{
+			name:   "dot",
+			render: renderDOT,
+			expected: `digraph destroy {
+  rankdir=LR;
+  node [shape=box, style=filled];
+  "module.preview[\"pr-1\"].aws_nat_gateway.test" [label="module.preview[\"pr-1\"].aws_nat_gateway.test\ngroup 1", fillcolor="#f4cccc"];
+  "aws_eip.nat" [label="aws_eip.nat\ngroup 2", fillcolor="#f4cccc"];
+  "aws_default_vpc.default" [label="aws_default_vpc.default\ndefault_resource", fillcolor="#d9ead3"];
+  "module.preview[\"pr-1\"].aws_nat_gateway.test" -> "aws_eip.nat" [style=dashed];
+}
+`,
+		},
+		{
+			name:   "mermaid",
+			render: renderMermaid,
+			expected: `flowchart LR
+  n0["module.preview[#quot;pr-1#quot;].aws_nat_gateway.test<br>group 1"]:::delete
+  n1["aws_eip.nat<br>group 2"]:::delete
+  n2["aws_default_vpc.default<br>default_resource"]:::protected
+  n0 -.-> n1
+  classDef delete fill:#f4cccc
+  classDef skip fill:#eeeeee
+  classDef protected fill:#d9ead3
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(tc.render(g)))
+		})
+	}
+}
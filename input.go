@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// missingInput is a configuration value that a provider needs, but that is neither given by a flag
+// nor by the environment.
+type missingInput struct {
+	// name is the name of the value (e.g., region).
+	name string
+	// sources lists where the value can be given (e.g., flags or environment variables).
+	sources string
+	// secret is true if the value must not be echoed when entered.
+	secret bool
+}
+
+const (
+	inputRegion    = "region"
+	inputAccessKey = "access key ID"
+	inputSecretKey = "secret access key"
+)
+
+// missingAWSInputs returns the configuration values of the AWS provider that are missing,
+// i.e., the region or the credentials, if none of the sources of the AWS SDK provides them.
+func missingAWSInputs(sess *session.Session) []missingInput {
+	var result []missingInput
+
+	if aws.StringValue(sess.Config.Region) == "" {
+		result = append(result, missingInput{
+			name:    inputRegion,
+			sources: "-aws-region, AWS_REGION, AWS_DEFAULT_REGION, or the region of the profile",
+		})
+	}
+
+	_, err := sess.Config.Credentials.Get()
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoCredentialProviders" {
+		result = append(result,
+			missingInput{
+				name:    inputAccessKey,
+				sources: "AWS_PROFILE, AWS_ACCESS_KEY_ID, or the shared credentials file",
+			},
+			missingInput{
+				name:    inputSecretKey,
+				sources: "AWS_PROFILE, AWS_SECRET_ACCESS_KEY, or the shared credentials file",
+				secret:  true,
+			})
+	}
+
+	return result
+}
+
+// promptInputs asks the user for each of the given missing configuration values of a provider.
+// Secret values are read with readSecret (so that they are not echoed), the others from the given reader.
+func promptInputs(providerName string, inputs []missingInput, r io.Reader, w io.Writer,
+	readSecret func() (string, error)) (map[string]string, error) {
+	result := map[string]string{}
+
+	reader := bufio.NewReader(r)
+
+	for _, input := range inputs {
+		fmt.Fprintf(w, "%23v", fmt.Sprintf("%s %s: ", providerName, input.name))
+
+		var value string
+
+		var err error
+
+		if input.secret {
+			value, err = readSecret()
+			fmt.Fprintln(w)
+		} else {
+			value, err = reader.ReadString('\n')
+		}
+
+		value = strings.TrimSpace(value)
+
+		if err != nil && !(err == io.EOF && value != "") {
+			return nil, fmt.Errorf("failed to read %s: %s", input.name, err)
+		}
+
+		if value == "" {
+			return nil, fmt.Errorf("no %s entered", input.name)
+		}
+
+		result[input.name] = value
+	}
+
+	return result, nil
+}
+
+// promptable returns true if the user can be asked for the given missing configuration values, i.e., if stdin is
+// a terminal. With -connect, stdin is a pipe from the terminal of the client (see daemon.go), from which secret
+// values can't be read without echoing them, so that the user isn't asked for them.
+func promptable(inputs []missingInput) bool {
+	if !stdinIsTerminal() {
+		return false
+	}
+
+	for _, input := range inputs {
+		if input.secret && !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resolveAWSInputs checks if configuration values of the AWS provider are missing and, if possible (see
+// promptable), asks the user for them and sets them in the session and the provider config (but never logs them).
+// Otherwise, the missing values are logged together with where they can be given, and an error is returned,
+// which fails the resources of the provider without initializing it.
+func resolveAWSInputs(sess *session.Session, awsConfig *provider.AWSConfig) error {
+	missing := missingAWSInputs(sess)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var names []string
+
+	for _, input := range missing {
+		names = append(names, input.name)
+	}
+
+	if !promptable(missing) {
+		internal.LogTitle("missing configuration of provider aws")
+
+		for _, input := range missing {
+			log.WithField("set_via", input.sources).Warn(internal.Pad(input.name))
+		}
+
+		return fmt.Errorf("missing configuration: %s", strings.Join(names, ", "))
+	}
+
+	internal.LogTitle("enter missing configuration of provider aws")
+
+	values, err := promptInputs("aws", missing, os.Stdin, os.Stderr, func() (string, error) {
+		value, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+
+		return string(value), err
+	})
+	if err != nil {
+		return err
+	}
+
+	if region, ok := values[inputRegion]; ok {
+		sess.Config.Region = aws.String(region)
+		awsConfig.Region = region
+	}
+
+	if accessKey, ok := values[inputAccessKey]; ok {
+		sess.Config.Credentials = credentials.NewStaticCredentials(accessKey, values[inputSecretKey], "")
+		awsConfig.Credentials = sess.Config.Credentials
+	}
+
+	log.WithField("values", strings.Join(names, ", ")).Info(internal.Pad("using configuration entered"))
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingAWSInputs(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	tests := []struct {
+		name          string
+		config        *aws.Config
+		expectedNames []string
+	}{
+		{
+			name: "all configured",
+			config: &aws.Config{
+				Region:      aws.String("us-west-2"),
+				Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+			},
+		},
+		{
+			name: "region and credentials missing",
+			config: &aws.Config{
+				Credentials: credentials.NewCredentials(&credentials.ChainProvider{}),
+			},
+			expectedNames: []string{"region", "access key ID", "secret access key"},
+		},
+		{
+			name: "only region missing",
+			config: &aws.Config{
+				Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+			},
+			expectedNames: []string{"region"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sess, err := session.NewSession(tc.config)
+			require.NoError(t, err)
+
+			var actualNames []string
+
+			for _, input := range missingAWSInputs(sess) {
+				actualNames = append(actualNames, input.name)
+			}
+
+			assert.Equal(t, tc.expectedNames, actualNames)
+		})
+	}
+}
+
+func TestPromptInputs(t *testing.T) {
+	inputs := []missingInput{
+		{name: inputRegion},
+		{name: inputAccessKey},
+		{name: inputSecretKey, secret: true},
+	}
+
+	tests := []struct {
+		name           string
+		stdin          string
+		secret         string
+		expectedValues map[string]string
+		expectedErrMsg string
+	}{
+		{
+			name:   "all entered",
+			stdin:  "us-west-2\n AKID \n",
+			secret: "SECRET",
+			expectedValues: map[string]string{
+				"region":            "us-west-2",
+				"access key ID":     "AKID",
+				"secret access key": "SECRET",
+			},
+		},
+		{
+			name:           "nothing entered",
+			stdin:          "\n",
+			expectedErrMsg: "no region entered",
+		},
+		{
+			name:           "stdin closed",
+			stdin:          "us-west-2\n",
+			expectedErrMsg: "failed to read access key ID: EOF",
+		},
+		{
+			name:           "secret not entered",
+			stdin:          "us-west-2\nAKID\n",
+			expectedErrMsg: "no secret access key entered",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			actualValues, err := promptInputs("aws", inputs, strings.NewReader(tc.stdin), &out,
+				func() (string, error) { return tc.secret, nil })
+
+			if tc.expectedErrMsg != "" {
+				assert.EqualError(t, err, tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedValues, actualValues)
+			assert.NotContains(t, out.String(), tc.secret)
+		})
+	}
+}
+
+func TestPromptable(t *testing.T) {
+	isTerminal := stdinIsTerminal
+	defer func() { stdinIsTerminal = isTerminal }()
+
+	region := missingInput{name: inputRegion}
+	secretKey := missingInput{name: inputSecretKey, secret: true}
+
+	stdinIsTerminal = func() bool { return false }
+	assert.False(t, promptable([]missingInput{region}))
+
+	// like while the daemon runs a request of a client whose stdin is a terminal (stdin of the test isn't one)
+	stdinIsTerminal = func() bool { return true }
+	assert.True(t, promptable([]missingInput{region}))
+	assert.False(t, promptable([]missingInput{region, secretKey}), "secrets must not be read with echo")
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Compatibility is an entry of the compatibility table compiled into terradozer: a component reading states
+// or resources (e.g., the state parser) and the newest Terraform version whose states it supports.
+type Compatibility struct {
+	Component string `json:"component"`
+	Version   string `json:"version"`
+	// MaxTerraformVersion is the newest minor version of Terraform (e.g., 0.12) whose states the component supports.
+	MaxTerraformVersion string `json:"max_terraform_version"`
+}
+
+func (c Compatibility) String() string {
+	return fmt.Sprintf("%s (%s) supports states of Terraform up to %s.x", c.Component, c.Version,
+		c.MaxTerraformVersion)
+}
+
+// CompatibilityError is returned for a state that has been written by a newer version of Terraform
+// than a component supports.
+type CompatibilityError struct {
+	// TerraformVersion is the version of Terraform that has written the state.
+	TerraformVersion string
+	Compatibility
+}
+
+func (e CompatibilityError) Error() string {
+	return fmt.Sprintf("state has been written by Terraform %s, which is newer than supported: %s",
+		e.TerraformVersion, e.Compatibility)
+}
+
+// CheckCompatibility returns a CompatibilityError for the first component of the given table that doesn't
+// support states written by the given version of Terraform. States of unknown versions (e.g., empty ones) pass.
+func CheckCompatibility(terraformVersion string, table []Compatibility) error {
+	major, minor, ok := minorVersion(terraformVersion)
+	if !ok {
+		return nil
+	}
+
+	for _, c := range table {
+		maxMajor, maxMinor, ok := minorVersion(c.MaxTerraformVersion)
+		if !ok {
+			continue
+		}
+
+		if major > maxMajor || (major == maxMajor && minor > maxMinor) {
+			return &CompatibilityError{TerraformVersion: terraformVersion, Compatibility: c}
+		}
+	}
+
+	return nil
+}
+
+// minorVersion returns the major and minor part of a version (e.g., 1 and 5 of 1.5.7 or v1.5).
+func minorVersion(v string) (int, int, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return major, minor, true
+}
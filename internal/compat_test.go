@@ -0,0 +1,61 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	table := []internal.Compatibility{
+		{Component: "state parser", Version: "terraform v0.12.31", MaxTerraformVersion: "0.12"},
+		{Component: "provider aws", Version: "v3.42.0", MaxTerraformVersion: "1.0"},
+	}
+
+	tests := []struct {
+		name             string
+		terraformVersion string
+		expectedErrMsg   string
+	}{
+		{
+			name:             "supported",
+			terraformVersion: "0.12.31",
+		},
+		{
+			name:             "older",
+			terraformVersion: "0.11.14",
+		},
+		{
+			name:             "unknown",
+			terraformVersion: "",
+		},
+		{
+			name:             "newer minor version",
+			terraformVersion: "0.13.0",
+			expectedErrMsg: "state has been written by Terraform 0.13.0, which is newer than supported: " +
+				"state parser (terraform v0.12.31) supports states of Terraform up to 0.12.x",
+		},
+		{
+			name:             "newer major version",
+			terraformVersion: "1.5.7",
+			expectedErrMsg: "state has been written by Terraform 1.5.7, which is newer than supported: " +
+				"state parser (terraform v0.12.31) supports states of Terraform up to 0.12.x",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := internal.CheckCompatibility(tc.terraformVersion, table)
+
+			if tc.expectedErrMsg != "" {
+				require.EqualError(t, err, tc.expectedErrMsg)
+
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -3,30 +3,40 @@ package internal
 import (
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/apex/log"
 )
 
 // UserConfirmedDeletion asks the user to confirm before destroying any resources.
-func UserConfirmedDeletion(r io.Reader, force bool) bool {
+// Returns an error if the answer can't be read (e.g., the input has been closed).
+func UserConfirmedDeletion(r io.Reader, force bool) (bool, error) {
 	if force {
 		LogTitle("user will not be asked for confirmation (force mode)")
-		return true
+		return true, nil
 	}
 
-	log.Info("Are you sure you want to delete these resources (cannot be undone)? Only YES will be accepted.")
-	fmt.Print(fmt.Sprintf("%23v", "Enter a value: "))
+	return UserConfirmed(r,
+		"Are you sure you want to delete these resources (cannot be undone)? Only YES will be accepted.")
+}
+
+// UserConfirmed asks the user the given question, which is confirmed by answering YES.
+// Returns an error if the answer can't be read (e.g., the input has been closed).
+func UserConfirmed(r io.Reader, question string) (bool, error) {
+	log.Info(question)
+	// the prompt is written to stderr like the logs, so that stdout only contains the output (e.g., -output json)
+	fmt.Fprintf(os.Stderr, "%23v", "Enter a value: ")
 
 	var response string
 
 	_, err := fmt.Fscanln(r, &response)
 	if err != nil {
-		log.Fatal(err.Error())
+		return false, err
 	}
 
 	if response == "YES" {
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
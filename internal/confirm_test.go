@@ -6,6 +6,7 @@ import (
 
 	"github.com/jckuester/terradozer/internal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUserConfirmedDeletion(t *testing.T) {
@@ -32,8 +33,26 @@ func TestUserConfirmedDeletion(t *testing.T) {
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			actualConfirmation := internal.UserConfirmedDeletion(strings.NewReader(tc.userInput), tc.force)
+			actualConfirmation, err := internal.UserConfirmedDeletion(strings.NewReader(tc.userInput), tc.force)
+			require.NoError(t, err)
 			assert.Equal(t, tc.expectedConfirmation, actualConfirmation)
 		})
 	}
 }
+
+func TestUserConfirmedDeletion_InputClosed(t *testing.T) {
+	actualConfirmation, err := internal.UserConfirmedDeletion(strings.NewReader(""), false)
+
+	assert.Error(t, err)
+	assert.False(t, actualConfirmation)
+}
+
+func TestUserConfirmed(t *testing.T) {
+	actualConfirmation, err := internal.UserConfirmed(strings.NewReader("YES"), "Continue?")
+	require.NoError(t, err)
+	assert.True(t, actualConfirmation)
+
+	actualConfirmation, err = internal.UserConfirmed(strings.NewReader("no"), "Continue?")
+	require.NoError(t, err)
+	assert.False(t, actualConfirmation)
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
@@ -15,8 +16,15 @@ const DefaultInitialPadding = 3
 // ExtraPadding is the double of the DefaultInitialPadding.
 const ExtraPadding = DefaultInitialPadding * 2
 
+// titleMu guards the padding of the default handler, as titles may be logged concurrently (e.g., by the runs
+// of several accounts).
+var titleMu sync.Mutex //nolint:gochecknoglobals
+
 // LogTitle pretty prints a given title.
 func LogTitle(title string) {
+	titleMu.Lock()
+	defer titleMu.Unlock()
+
 	cli.Default.Padding = DefaultInitialPadding
 
 	log.Info(color.New(color.Bold).Sprint(strings.ToUpper(title)))
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultMaxValueSize is the default number of bytes after which attribute values are truncated in logs
+// and reports (see ValueRendering).
+const DefaultMaxValueSize = 4096
+
+// ValueRendering configures how attribute values are rendered in logs and reports (see RenderValue), so that large
+// values (e.g., user_data blobs, policies, or base64-encoded Lambda payloads) don't make them unusable.
+type ValueRendering struct {
+	// MaxSize is the number of bytes after which values are truncated (zero disables truncating).
+	MaxSize int
+	// HashSize is the number of bytes above which values are replaced by their SHA-256 checksum instead of being
+	// truncated, so that reports stay diff-able (zero disables hashing).
+	HashSize int
+}
+
+//nolint:gochecknoglobals
+var (
+	renderingMu    sync.RWMutex
+	valueRendering = ValueRendering{MaxSize: DefaultMaxValueSize}
+)
+
+// SetValueRendering sets how attribute values are rendered in logs and reports (see RenderValue).
+func SetValueRendering(r ValueRendering) {
+	renderingMu.Lock()
+	defer renderingMu.Unlock()
+
+	valueRendering = r
+}
+
+// RenderValue returns an attribute value as shown in logs and reports (see SetValueRendering): invalid UTF-8 is
+// replaced by U+FFFD, values larger than HashSize are replaced by their size and SHA-256 checksum (of the original
+// bytes), and values larger than MaxSize are truncated at a character boundary, followed by their original size.
+func RenderValue(value string) string {
+	renderingMu.RLock()
+	r := valueRendering
+	renderingMu.RUnlock()
+
+	return r.Render(value)
+}
+
+// RenderJSON returns an attribute value encoded as JSON as shown in reports (see RenderValue): the value as it is
+// if it is small enough, otherwise a JSON string of the rendered value.
+func RenderJSON(value json.RawMessage) json.RawMessage {
+	rendered := RenderValue(string(value))
+	if rendered == string(value) {
+		return value
+	}
+
+	result, err := json.Marshal(rendered)
+	if err != nil {
+		return json.RawMessage(`"(failed to encode value)"`)
+	}
+
+	return result
+}
+
+// Render returns the given value rendered with this configuration (see RenderValue).
+func (r ValueRendering) Render(value string) string {
+	size := len(value)
+
+	if r.HashSize > 0 && size > r.HashSize {
+		return fmt.Sprintf("(%s, sha256:%x)", formatSize(size), sha256.Sum256([]byte(value)))
+	}
+
+	value = strings.ToValidUTF8(value, string(utf8.RuneError))
+
+	if r.MaxSize <= 0 || len(value) <= r.MaxSize {
+		return value
+	}
+
+	end := r.MaxSize
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+
+	return fmt.Sprintf("%s...(truncated, %s)", value[:end], formatSize(size))
+}
+
+// formatSize returns the given number of bytes in a human-readable form (e.g., 3.2 MiB).
+func formatSize(size int) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d bytes", size)
+	}
+
+	value, exp := float64(size)/unit, 0
+	for ; value >= unit && exp < 2; exp++ {
+		value /= unit
+	}
+
+	return fmt.Sprintf("%.1f %ciB", value, "KMG"[exp])
+}
@@ -0,0 +1,116 @@
+package internal_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jckuester/terradozer/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueRendering_Render(t *testing.T) {
+	largeValue := strings.Repeat("a", 3*1024*1024)
+
+	tests := []struct {
+		name      string
+		rendering internal.ValueRendering
+		value     string
+		expected  string
+	}{
+		{
+			name:      "small value",
+			rendering: internal.ValueRendering{MaxSize: 10},
+			value:     "foo",
+			expected:  "foo",
+		},
+		{
+			name:      "value of maximum size",
+			rendering: internal.ValueRendering{MaxSize: 3},
+			value:     "foo",
+			expected:  "foo",
+		},
+		{
+			name:      "multi-megabyte value",
+			rendering: internal.ValueRendering{MaxSize: internal.DefaultMaxValueSize},
+			value:     largeValue,
+			expected:  largeValue[:internal.DefaultMaxValueSize] + "...(truncated, 3.0 MiB)",
+		},
+		{
+			name:      "truncating disabled",
+			rendering: internal.ValueRendering{},
+			value:     largeValue,
+			expected:  largeValue,
+		},
+		{
+			name:      "truncated at character boundary",
+			rendering: internal.ValueRendering{MaxSize: 4},
+			value:     "fooäbar",
+			expected:  "foo...(truncated, 8 bytes)",
+		},
+		{
+			name:      "invalid UTF-8",
+			rendering: internal.ValueRendering{MaxSize: 10},
+			value:     "foo\xff\xfebar",
+			expected:  "foo�bar",
+		},
+		{
+			name:      "binary value",
+			rendering: internal.ValueRendering{MaxSize: 5},
+			value:     "\x00\x01\xff\xfe\x02\x03\x04",
+			expected:  "\x00\x01�...(truncated, 7 bytes)",
+		},
+		{
+			name:      "hashed value",
+			rendering: internal.ValueRendering{MaxSize: 10, HashSize: 1024},
+			value:     largeValue,
+			expected:  fmt.Sprintf("(3.0 MiB, sha256:%x)", sha256.Sum256([]byte(largeValue))),
+		},
+		{
+			name:      "value below hash size",
+			rendering: internal.ValueRendering{MaxSize: 2, HashSize: 1024},
+			value:     "foo",
+			expected:  "fo...(truncated, 3 bytes)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := tc.rendering.Render(tc.value)
+
+			assert.Equal(t, tc.expected, actual)
+			assert.True(t, utf8.ValidString(actual))
+		})
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    json.RawMessage
+		expected json.RawMessage
+	}{
+		{
+			name:     "small value",
+			value:    json.RawMessage(`{"foo":"bar"}`),
+			expected: json.RawMessage(`{"foo":"bar"}`),
+		},
+		{
+			name:     "large value",
+			value:    json.RawMessage(`"` + strings.Repeat("a", 2*internal.DefaultMaxValueSize) + `"`),
+			expected: json.RawMessage(`"\"` + strings.Repeat("a", internal.DefaultMaxValueSize-1) + `...(truncated, 8.0 KiB)"`),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := internal.RenderJSON(tc.value)
+
+			assert.Equal(t, string(tc.expected), string(actual))
+			assert.True(t, json.Valid(actual))
+		})
+	}
+}
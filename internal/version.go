@@ -1,29 +1,99 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
 	"runtime"
+	"sort"
 )
 
+// version, commit, and date are set at build time via ldflags (see .goreleaser.yml), e.g.,
+//
+//	go build -ldflags "-X github.com/jckuester/terradozer/internal.version=v0.1.2"
+//
 //nolint:gochecknoglobals
 var (
 	version = "dev"
-	commit  = "?"
-	date    = "?"
+	commit  = "dev"
+	date    = "dev"
 )
 
-func BuildVersionString() string {
-	var result = fmt.Sprintf("version: %s", version)
+// VersionInfo is the version information of a terradozer build.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	// Providers are the versions of the Terraform Provider Plugins used by default, by provider name.
+	Providers map[string]string `json:"providers"`
+	// Compatibility is the compatibility table of this build (see CheckCompatibility).
+	Compatibility []Compatibility `json:"compatibility"`
+}
+
+// BuildVersionInfo returns the version information of this build, which uses the given provider versions
+// and has the given compatibility table. Information unknown at build time (e.g., for development builds) is "dev".
+func BuildVersionInfo(providerVersions map[string]string, compatibility []Compatibility) VersionInfo {
+	providers := map[string]string{}
+
+	for name, v := range providerVersions {
+		providers[name] = v
+	}
 
-	if commit != "" {
-		result = fmt.Sprintf("%s\ncommit: %s", result, commit)
+	return VersionInfo{
+		Version:       orDev(version),
+		Commit:        orDev(commit),
+		Date:          orDev(date),
+		GoVersion:     runtime.Version(),
+		Providers:     providers,
+		Compatibility: compatibility,
 	}
+}
+
+// BuildVersionString returns the version information of this build in a human-readable format.
+func BuildVersionString(providerVersions map[string]string, compatibility []Compatibility) string {
+	info := BuildVersionInfo(providerVersions, compatibility)
+
+	result := fmt.Sprintf("version: %s\ncommit: %s\nbuilt at: %s\nusing: %s",
+		info.Version, info.Commit, info.Date, info.GoVersion)
+
+	var names []string
+
+	for name := range info.Providers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
 
-	if date != "" {
-		result = fmt.Sprintf("%s\nbuilt at: %s", result, date)
+	for _, name := range names {
+		result = fmt.Sprintf("%s\nprovider %s: %s", result, name, info.Providers[name])
 	}
 
-	result = fmt.Sprintf("%s\nusing: %s", result, runtime.Version())
+	for _, c := range info.Compatibility {
+		result = fmt.Sprintf("%s\ncompatibility: %s", result, c)
+	}
 
 	return result
 }
+
+// BuildVersionJSON returns the version information of this build as JSON.
+func BuildVersionJSON(providerVersions map[string]string, compatibility []Compatibility) (string, error) {
+	result, err := json.MarshalIndent(BuildVersionInfo(providerVersions, compatibility), "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+// UserAgent returns the product token of terradozer for user agents (e.g., "terradozer/v0.1.2").
+func UserAgent() string {
+	return fmt.Sprintf("terradozer/%s", orDev(version))
+}
+
+func orDev(s string) string {
+	if s == "" {
+		return "dev"
+	}
+
+	return s
+}
@@ -1,15 +1,47 @@
 package internal_test
 
 import (
+	"encoding/json"
 	"runtime"
 	"testing"
 
 	"github.com/jckuester/terradozer/internal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// compatibility is the compatibility table of the tested builds.
+var compatibility = []internal.Compatibility{ //nolint:gochecknoglobals
+	{Component: "state parser", Version: "terraform v0.12.31", MaxTerraformVersion: "0.12"},
+}
+
 func TestBuildVersionString(t *testing.T) {
-	actualVersionString := internal.BuildVersionString()
+	actualVersionString := internal.BuildVersionString(map[string]string{"aws": "v3.42.0"}, compatibility)
+
+	assert.Equal(t, actualVersionString,
+		"version: dev\ncommit: dev\nbuilt at: dev\nusing: "+runtime.Version()+"\nprovider aws: v3.42.0"+
+			"\ncompatibility: state parser (terraform v0.12.31) supports states of Terraform up to 0.12.x")
+}
+
+func TestBuildVersionJSON(t *testing.T) {
+	actualVersionJSON, err := internal.BuildVersionJSON(map[string]string{"aws": "v3.42.0"}, compatibility)
+	require.NoError(t, err)
+
+	var actualVersionInfo internal.VersionInfo
+
+	err = json.Unmarshal([]byte(actualVersionJSON), &actualVersionInfo)
+	require.NoError(t, err)
+
+	assert.Equal(t, internal.VersionInfo{
+		Version:       "dev",
+		Commit:        "dev",
+		Date:          "dev",
+		GoVersion:     runtime.Version(),
+		Providers:     map[string]string{"aws": "v3.42.0"},
+		Compatibility: compatibility,
+	}, actualVersionInfo)
+}
 
-	assert.Equal(t, actualVersionString, "version: dev\ncommit: ?\nbuilt at: ?\nusing: "+runtime.Version())
+func TestUserAgent(t *testing.T) {
+	assert.Equal(t, "terradozer/dev", internal.UserAgent())
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// inventory lists resources of a state, together with their number per type and per provider.
+type inventory struct {
+	Resources []listedResource `json:"resources"`
+	// ByType and ByProvider are the number of resources by resource type and by provider name.
+	ByType     map[string]int `json:"by_type"`
+	ByProvider map[string]int `json:"by_provider"`
+	// WithoutID is the number of resources whose ID couldn't be extracted from the state.
+	WithoutID int `json:"without_id"`
+	// Deposed is the number of resources that are deposed objects of resource instances (e.g., left behind by
+	// failed create-before-destroy replacements).
+	Deposed int `json:"deposed,omitempty"`
+}
+
+// newInventory counts the given resources by type and by provider.
+func newInventory(resources []listedResource) inventory {
+	result := inventory{
+		Resources:  resources,
+		ByType:     map[string]int{},
+		ByProvider: map[string]int{},
+	}
+
+	for _, r := range resources {
+		result.ByType[r.Type]++
+
+		if r.Provider != "" {
+			result.ByProvider[r.Provider]++
+		}
+
+		if r.IDError != "" {
+			result.WithoutID++
+		}
+
+		if r.Deposed != "" {
+			result.Deposed++
+		}
+	}
+
+	return result
+}
+
+// log logs each resource, followed by the number of resources per type and per provider.
+// All resources are logged as warnings if highlight is true (e.g., as they would be deleted);
+// otherwise, only resources whose ID couldn't be extracted are.
+func (inv inventory) log(highlight bool) {
+	for _, r := range inv.Resources {
+		entry := log.WithFields(log.Fields{
+			"address": r.Address,
+			"id":      r.ID,
+		}).WithFields(r.details)
+
+		if r.Deposed != "" {
+			entry = entry.WithField("deposed", r.Deposed)
+		}
+
+		if r.SkipReason != "" {
+			entry = entry.WithField("skip_reason", r.SkipReason)
+		}
+
+		if r.IDError != "" {
+			entry.WithField("id_error", r.IDError).Warn(internal.Pad(r.Type))
+			continue
+		}
+
+		if highlight {
+			entry.Warn(internal.Pad(r.Type))
+			continue
+		}
+
+		entry.Info(internal.Pad(r.Type))
+	}
+
+	if len(inv.Resources) == 0 {
+		return
+	}
+
+	if inv.WithoutID > 0 {
+		log.WithField("count", inv.WithoutID).Warn(internal.Pad("resources whose ID couldn't be extracted"))
+	}
+
+	if inv.Deposed > 0 {
+		log.WithField("count", inv.Deposed).Info(internal.Pad("deposed objects of resource instances"))
+	}
+
+	internal.LogTitle("number of resources by type")
+	logCounts(inv.ByType)
+
+	internal.LogTitle("number of resources by provider")
+	logCounts(inv.ByProvider)
+}
+
+// logCounts logs the given numbers sorted by name.
+func logCounts(counts map[string]int) {
+	var names []string
+
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		log.WithField("count", counts[name]).Info(internal.Pad(name))
+	}
+}
+
+// writeCSV writes one row per resource (with a header row) in CSV format.
+func (inv inventory) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"address", "type", "id", "provider", "skip_reason", "id_error", "deposed"})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range inv.Resources {
+		err = cw.Write([]string{r.Address, r.Type, r.ID, r.Provider, string(r.SkipReason), r.IDError, r.Deposed})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInventory(t *testing.T) {
+	inv := newInventory([]listedResource{
+		{ResourceInstance: state.ResourceInstance{Address: "aws_vpc.a", Type: "aws_vpc", ID: "vpc-1", Provider: "aws"}},
+		{ResourceInstance: state.ResourceInstance{Address: "aws_vpc.b", Type: "aws_vpc", ID: "vpc-2", Provider: "aws"}},
+		{ResourceInstance: state.ResourceInstance{Address: "aws_iam_role.a", Type: "aws_iam_role", Provider: "aws",
+			IDError: "resource instance has no id attribute"}},
+		{ResourceInstance: state.ResourceInstance{Address: "random_integer.a", Type: "random_integer", ID: "1",
+			Provider: "random"}, SkipReason: destroy.SkipReasonProtectedType},
+		{ResourceInstance: state.ResourceInstance{Address: "aws_vpc.a", Type: "aws_vpc", ID: "vpc-0", Provider: "aws",
+			Deposed: "00000001"}},
+	})
+
+	assert.Equal(t, map[string]int{"aws_vpc": 3, "aws_iam_role": 1, "random_integer": 1}, inv.ByType)
+	assert.Equal(t, map[string]int{"aws": 4, "random": 1}, inv.ByProvider)
+	assert.Equal(t, 1, inv.WithoutID)
+	assert.Equal(t, 1, inv.Deposed)
+}
+
+func TestInventory_WriteCSV(t *testing.T) {
+	inv := newInventory([]listedResource{
+		{ResourceInstance: state.ResourceInstance{Address: "aws_vpc.a", Type: "aws_vpc", ID: "vpc-1", Provider: "aws"},
+			SkipReason: destroy.SkipReasonExcludedAddress},
+		{ResourceInstance: state.ResourceInstance{Address: `aws_iam_role.a["x,y"]`, Type: "aws_iam_role", Provider: "aws",
+			IDError: "resource instance has no id attribute"}},
+		{ResourceInstance: state.ResourceInstance{Address: "aws_vpc.a", Type: "aws_vpc", ID: "vpc-0", Provider: "aws",
+			Deposed: "00000001"}},
+	})
+
+	var buf bytes.Buffer
+
+	require.NoError(t, inv.writeCSV(&buf))
+
+	assert.Equal(t, `address,type,id,provider,skip_reason,id_error,deposed
+aws_vpc.a,aws_vpc,vpc-1,aws,excluded_address,,
+"aws_iam_role.a[""x,y""]",aws_iam_role,,aws,,resource instance has no id attribute,
+aws_vpc.a,aws_vpc,vpc-0,aws,,,00000001
+`, buf.String())
+}
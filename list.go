@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/state"
+)
+
+// listedResource is a resource of the state listed by the list command.
+type listedResource struct {
+	state.ResourceInstance
+	// SkipReason is the reason why the resource would not be destroyed (empty if it would be destroyed).
+	SkipReason destroy.SkipReason `json:"skip_reason,omitempty"`
+
+	// details are further fields logged for the resource (e.g., how it would be destroyed).
+	details log.Fields
+}
+
+// runList lists the resources of a Terraform state (without starting any provider) and returns the exit code.
+func runList(arguments []string) int {
+	var shared stateFlags
+	var output string
+
+	flags := newListFlagSet("list", &shared, &output)
+
+	tfstate, code := readState("list", flags, &shared, arguments, &output)
+	if tfstate == nil {
+		return code
+	}
+
+	instances, err := tfstate.ResourceInstances()
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to get resources from Terraform state: %s\n", err))
+
+		return 1
+	}
+
+	filter := shared.filter()
+
+	var resources []listedResource
+
+	for _, instance := range instances {
+		ok, reason := filter.Match(candidateOf(instance))
+		if ok {
+			reason = ""
+		}
+
+		resources = append(resources, listedResource{ResourceInstance: instance, SkipReason: reason})
+	}
+
+	inv := newInventory(resources)
+
+	switch output {
+	case "json":
+		return printJSON(inv)
+	case "csv":
+		err = inv.writeCSV(os.Stdout)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error: failed to write output as CSV: %s\n", err))
+
+			return 1
+		}
+
+		return 0
+	}
+
+	internal.LogTitle("listing resources")
+
+	inv.log(false)
+
+	internal.LogTitle(fmt.Sprintf("total number of resources: %d", len(resources)))
+
+	return 0
+}
+
+// requiredProvider is a provider needed by the state, shown by the providers command.
+type requiredProvider struct {
+	Name string `json:"name"`
+	// Version is the version of the provider used by terradozer (empty if the provider isn't supported).
+	Version   string `json:"version,omitempty"`
+	Supported bool   `json:"supported"`
+	// Binary is the installed plugin binary of the provider's version (nil if it isn't installed yet).
+	Binary *provider.Binary `json:"binary,omitempty"`
+}
+
+// runProviders shows the providers a Terraform state needs, whether terradozer supports them, and their installed
+// binaries, which are checked against the dependency lock file in the working directory (if any); returns
+// the exit code, which is non-zero if a binary doesn't match the lock file.
+func runProviders(arguments []string) int {
+	var shared stateFlags
+	var output string
+
+	flags := newListFlagSet("providers", &shared, &output)
+
+	tfstate, code := readState("providers", flags, &shared, arguments, &output)
+	if tfstate == nil {
+		return code
+	}
+
+	locked, err := readLockFile("")
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read dependency lock file: %s\n", err))
+
+		return 1
+	}
+
+	binaries, err := provider.InstalledBinaries(installDir, locked)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to list installed providers: %s\n", err))
+
+		return 1
+	}
+
+	config := provider.Config{Locked: locked}
+
+	var providers []requiredProvider
+
+	var mismatched []provider.Binary
+
+	for _, name := range tfstate.ProviderNames() {
+		version := config.Version(name)
+		p := requiredProvider{Name: name, Version: version, Supported: version != ""}
+
+		for i, b := range binaries {
+			if b.Name == name && b.Version == version {
+				p.Binary = &binaries[i]
+			}
+		}
+
+		if p.Binary != nil && p.Binary.Lock == provider.LockMismatched {
+			mismatched = append(mismatched, *p.Binary)
+		}
+
+		providers = append(providers, p)
+	}
+
+	if output == "json" {
+		if code := printJSON(providers); code != 0 {
+			return code
+		}
+
+		return lockMismatchError(mismatched)
+	}
+
+	internal.LogTitle("showing providers needed by the state")
+
+	for _, p := range providers {
+		if !p.Supported {
+			log.WithField("supported", false).Warn(internal.Pad(p.Name))
+			continue
+		}
+
+		fields := log.Fields{
+			"version":   p.Version,
+			"supported": true,
+		}
+
+		if p.Binary != nil {
+			fields["path"] = p.Binary.Path
+			fields["sha256"] = p.Binary.SHA256
+		}
+
+		if p.Binary != nil && p.Binary.Lock != "" {
+			fields["lock"] = p.Binary.Lock
+		}
+
+		log.WithFields(fields).Info(internal.Pad(p.Name))
+	}
+
+	return lockMismatchError(mismatched)
+}
+
+// lockMismatchError prints an error for the given installed binaries that don't match the dependency lock file
+// and returns the exit code (zero if there are none).
+func lockMismatchError(mismatched []provider.Binary) int {
+	if len(mismatched) == 0 {
+		return 0
+	}
+
+	for _, b := range mismatched {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ installed provider binary %s doesn't match the lock file: %s\n",
+			b.Path, b.LockError))
+	}
+
+	return 1
+}
+
+// newListFlagSet returns the flag set of the list or providers command.
+func newListFlagSet(name string, shared *stateFlags, output *string) *flag.FlagSet {
+	fs := newCommandFlagSet(name)
+
+	shared.register(fs)
+	outputFlag(fs, output, outputFormatsOf(name))
+
+	return fs
+}
+
+// readState parses the arguments of a command and reads the Terraform state. Returns no state but the exit code
+// if the command is already done (e.g., the config has been shown or reading the state failed).
+func readState(name string, flags *flag.FlagSet, shared *stateFlags, arguments []string,
+	output *string) (*state.State, int) {
+	err := shared.parse(flags, arguments)
+	if err != nil {
+		return nil, usageError(name, err)
+	}
+
+	if shared.showConfig {
+		return nil, 0
+	}
+
+	formats := outputFormatsOf(name)
+	if !contains(formats, *output) {
+		return nil, usageError(name, fmt.Errorf("unsupported -output format: %s (expected %s)",
+			*output, joinFormats(formats)))
+	}
+
+	// S3 objects are read with the default credential chain, as the list commands have no AWS flags
+	tfstate, err := state.Read(context.Background(), shared.path, nil)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read Terraform state file: %s\n", err))
+
+		return nil, 1
+	}
+
+	if !compatible(tfstate, shared.forceCompat) {
+		return nil, 1
+	}
+
+	warnUnmatchedIncludes(tfstate, shared.include)
+
+	shared.diff, err = readStateDiff(tfstate, shared.diffPath)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ %s\n", err))
+
+		return nil, 1
+	}
+
+	return tfstate, 0
+}
+
+// outputFormatsOf returns the output formats supported by the given command.
+func outputFormatsOf(command string) []string {
+	if command == "list" {
+		return []string{"text", "json", "csv"}
+	}
+
+	return []string{"text", "json"}
+}
+
+// joinFormats returns the given formats as text (e.g., "text, json, or csv").
+func joinFormats(formats []string) string {
+	if len(formats) == 2 {
+		return formats[0] + " or " + formats[1]
+	}
+
+	return strings.Join(formats[:len(formats)-1], ", ") + ", or " + formats[len(formats)-1]
+}
+
+func contains(elements []string, e string) bool {
+	for _, element := range elements {
+		if element == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printJSON prints the given value as JSON and returns the exit code.
+func printJSON(v interface{}) int {
+	result, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error: failed to encode output as JSON: %s\n", err))
+
+		return 1
+	}
+
+	fmt.Println(string(result))
+
+	return 0
+}
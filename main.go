@@ -1,183 +1,2464 @@
 package main
 
 //nolint:lll
-//go:generate mockgen -source=pkg/resource/destroy.go -destination=pkg/resource/destroy_mock_test.go -package=resource_test
+//go:generate mockgen -source=pkg/destroy/destroy.go -destination=pkg/destroy/destroy_mock_test.go -package=destroy_test
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	stdlog "log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/fatih/color"
-	"github.com/jckuester/awstools-lib/terraform"
-	"github.com/jckuester/awstools-lib/terraform/provider"
 	"github.com/jckuester/terradozer/internal"
-	"github.com/jckuester/terradozer/pkg/resource"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/discover"
+	"github.com/jckuester/terradozer/pkg/provider"
 	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/jckuester/terradozer/pkg/trace"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
-func main() {
-	os.Exit(mainExitCode())
+const (
+	// exitCodeResourcesFailed is the exit code if some resources failed to be destroyed.
+	exitCodeResourcesFailed = 2
+	// exitCodePermissionDenied is the exit code if some resources failed to be destroyed due to missing permissions.
+	exitCodePermissionDenied = 3
+	// exitCodeCredentialsExpired is the exit code if some resources failed to be destroyed due to expired
+	// credentials (i.e., running terradozer again with refreshed credentials might destroy them).
+	exitCodeCredentialsExpired = 4
+	// exitCodeUnsupported is the exit code of the validate command if terradozer can't destroy some resources.
+	exitCodeUnsupported = 5
+	// exitCodeAllGone is the exit code if all resources of the state didn't exist anymore (see -fail-if-all-gone).
+	exitCodeAllGone = 6
+	// exitCodeInterrupted is the exit code if terradozer has been interrupted by a signal (128 + SIGINT).
+	exitCodeInterrupted = 130
+)
+
+// adoptCommand is the name of the command destroying resources that aren't part of any state (see state.FromIDs).
+const adoptCommand = "adopt-and-destroy"
+
+// discoverCommand is the name of the command destroying resources found by their tags (see discover.Discover).
+const discoverCommand = "discover-and-destroy"
+
+// installDir is the directory the Terraform Provider Plugins are installed into.
+const installDir = "~/.terradozer"
+
+// command is a subcommand of terradozer (e.g., terradozer destroy).
+type command struct {
+	name        string
+	description string
+	// run runs the command with the given command line arguments (following the command name)
+	// and returns the exit code. The command stops gracefully once the context is done.
+	run func(ctx context.Context, args []string, providerFactory provider.Factory) int
+	// flagSet returns the flags of the command (e.g., to complete them).
+	flagSet func() *flag.FlagSet
+	// hidden commands aren't listed in the help.
+	hidden bool
+	// usage is the synopsis of the arguments of the command (defaults to the one of commands reading a state).
+	usage string
+	// raw commands print their output as is (i.e., without surrounding blank lines), e.g., to be read by a shell.
+	raw bool
 }
 
-//nolint:wsl
-func mainExitCode() int {
-	var dryRun bool
-	var force bool
-	var logDebug bool
-	var parallel int
-	var timeout string
-	var version bool
+// commands returns all subcommands of terradozer.
+func commands() []command {
+	return []command{
+		{
+			name:        "plan",
+			description: "Show the resources that would be destroyed (read-only)",
+			run: func(ctx context.Context, args []string, providerFactory provider.Factory) int {
+				return runDestroy(ctx, "plan", args, providerFactory)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newDestroyFlagSet("plan", &stateFlags{}, &destroyFlags{})
+			},
+		},
+		{
+			name:        "destroy",
+			description: "Destroy the resources of a Terraform state (after confirmation)",
+			run: func(ctx context.Context, args []string, providerFactory provider.Factory) int {
+				return runDestroy(ctx, "destroy", args, providerFactory)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newDestroyFlagSet("destroy", &stateFlags{}, &destroyFlags{})
+			},
+		},
+		{
+			name:        adoptCommand,
+			description: "Destroy resources listed by type and ID in a CSV or JSON file (no state needed)",
+			run: func(ctx context.Context, args []string, providerFactory provider.Factory) int {
+				return runDestroy(ctx, adoptCommand, args, providerFactory)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newDestroyFlagSet(adoptCommand, &stateFlags{}, &destroyFlags{})
+			},
+			usage: "[flags] -ids <path/to/ids.csv>",
+		},
+		{
+			name:        discoverCommand,
+			description: "Destroy AWS resources found by their tags via the Resource Groups Tagging API (no state needed)",
+			run: func(ctx context.Context, args []string, providerFactory provider.Factory) int {
+				return runDestroy(ctx, discoverCommand, args, providerFactory)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newDestroyFlagSet(discoverCommand, &stateFlags{}, &destroyFlags{})
+			},
+			usage: "[flags] -discover-tag <key=value>",
+		},
+		{
+			name:        verifyCommand,
+			description: "Check that the resources deleted by a previous run (see -report) are still gone (read-only)",
+			run: func(ctx context.Context, args []string, providerFactory provider.Factory) int {
+				return runDestroy(ctx, verifyCommand, args, providerFactory)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newDestroyFlagSet(verifyCommand, &stateFlags{}, &destroyFlags{})
+			},
+			usage: "[flags] -report <path/to/report.json>",
+		},
+		{
+			name:        selftestCommand,
+			description: "Create, destroy, and check a few cheap resources to test terradozer in a sandbox account",
+			run:         runSelftest,
+			flagSet: func() *flag.FlagSet {
+				return newSelftestFlagSet(&selftestFlags{})
+			},
+			usage: "[flags] -sandbox-account <account ID>",
+		},
+		{
+			name:        "list",
+			description: "List the resources of a Terraform state (without starting any provider)",
+			run: func(_ context.Context, args []string, _ provider.Factory) int {
+				return runList(args)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newListFlagSet("list", &stateFlags{}, new(string))
+			},
+		},
+		{
+			name:        "providers",
+			description: "Show the providers a Terraform state needs and whether terradozer supports them",
+			run: func(_ context.Context, args []string, _ provider.Factory) int {
+				return runProviders(args)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newListFlagSet("providers", &stateFlags{}, new(string))
+			},
+		},
+		{
+			name:        "validate",
+			description: "Check which resources of a Terraform state terradozer can destroy (without touching the cloud)",
+			run: func(_ context.Context, args []string, providerFactory provider.Factory) int {
+				return runValidate(args, providerFactory)
+			},
+			flagSet: func() *flag.FlagSet {
+				return newValidateFlagSet(&stateFlags{}, &destroyFlags{}, new(string))
+			},
+		},
+		{
+			name:        "completion",
+			description: "Print the script to complete commands and flags in bash, zsh, or fish",
+			run: func(_ context.Context, args []string, _ provider.Factory) int {
+				return runCompletion(args)
+			},
+			flagSet: newCompletionFlagSet,
+			usage:   "bash|zsh|fish",
+			raw:     true,
+		},
+		{
+			name: completeCommand,
+			run: func(_ context.Context, args []string, _ provider.Factory) int {
+				return runComplete(args)
+			},
+			hidden: true,
+			raw:    true,
+		},
+	}
+}
 
-	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+// unknownCommandError returns the error for a command that doesn't exist, suggesting the closest command name.
+func unknownCommandError(name string) error {
+	var names []string
 
-	flags.Usage = func() {
-		printHelp(flags)
+	for _, cmd := range commands() {
+		if !cmd.hidden {
+			names = append(names, cmd.name)
+		}
+	}
+
+	if closest := closestMatch(name, names); closest != "" {
+		return fmt.Errorf("unknown command: %s (did you mean %s?)", name, closest)
+	}
+
+	return fmt.Errorf("unknown command: %s", name)
+}
+
+// findCommand returns the command with the given name (nil if there is none).
+func findCommand(name string) *command {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return &cmd
+		}
 	}
 
-	flags.StringVar(&timeout, "timeout", "30s", "Amount of time to wait for a destroy of a resource to finish")
-	flags.BoolVar(&dryRun, "dry-run", false, "Show what would be destroyed")
-	flags.BoolVar(&force, "force", false, "Destroy without asking for confirmation")
-	flags.BoolVar(&logDebug, "debug", false, "Enable debug logging")
-	flags.IntVar(&parallel, "parallel", 10, "Limit the number of concurrent destroy operations")
-	flags.BoolVar(&version, "version", false, "Show application version")
+	return nil
+}
+
+func main() {
+	os.Exit(mainExitCode(os.Args[1:], nil))
+}
+
+// mainExitCode runs terradozer with the given command line arguments and returns the exit code.
+// The providers are created by the given factory (defaults to installing and launching the provider plugins if nil).
+func mainExitCode(arguments []string, providerFactory provider.Factory) int {
+	return runMain(context.Background(), arguments, providerFactory)
+}
+
+// runMain runs terradozer as mainExitCode, but stops gracefully once the given context is done
+// (e.g., once the client of a request to the daemon has gone).
+//
+//nolint:wsl
+func runMain(ctx context.Context, arguments []string, providerFactory provider.Factory) int {
+	var f mainFlags
+
+	flags := newMainFlagSet(&f)
 
-	_ = flags.Parse(os.Args[1:])
+	err := parseFlags(flags, arguments)
 	args := flags.Args()
 
-	log.SetHandler(cli.Default)
+	log.SetHandler(cli.New(os.Stderr))
 
-	fmt.Println()
-	defer fmt.Println()
+	if err == nil {
+		_, err = applyEnv(flags)
+	}
 
-	if logDebug {
-		log.SetLevel(log.DebugLevel)
+	// the working directory is changed before any path (e.g., of the state or the config file) is resolved
+	if err == nil && f.chdir != "" {
+		err = os.Chdir(f.chdir)
+		if err != nil {
+			err = fmt.Errorf("failed to change working directory (-chdir): %s", err)
+		}
+	}
+
+	var idleTimeout time.Duration
+	if err == nil && f.daemon {
+		idleTimeout, err = time.ParseDuration(f.daemonIdleTimeout)
+		if err != nil {
+			err = fmt.Errorf("failed to parse daemon-idle-timeout flag: %s", err)
+		}
+	}
+
+	if err != nil {
+		fmt.Println()
+		defer fmt.Println()
+
+		return usageError("", err)
 	}
 
 	// discard TRACE logs of GRPCProvider
 	stdlog.SetOutput(ioutil.Discard)
 
-	if version {
-		fmt.Println(internal.BuildVersionString())
-		return 0
+	if f.daemon {
+		return runDaemon(ctx, f.socket, idleTimeout, providerFactory)
 	}
 
-	if force && dryRun {
-		fmt.Fprint(os.Stderr, color.RedString("Error:️ -force and -dry-run flag cannot be used together\n"))
-		printHelp(flags)
+	var cmd *command
+	if len(args) > 0 {
+		cmd = findCommand(args[0])
+	}
 
-		return 1
+	if cmd != nil && cmd.raw && !f.version {
+		return cmd.run(ctx, args[1:], providerFactory)
 	}
 
-	timeoutDuration, err := time.ParseDuration(timeout)
-	if err != nil {
-		fmt.Fprint(os.Stderr, color.RedString("Error: failed to parse timeout flag: %s\n", err))
-		printHelp(flags)
+	if cmd != nil && f.connect && !f.version {
+		if code, ok := connectDaemon(f.socket, args, os.Stdin, os.Stdout, os.Stderr); ok {
+			return code
+		}
+	}
 
-		return 1
+	fmt.Println()
+	defer fmt.Println()
+
+	if f.version {
+		return printVersion(f.output)
 	}
 
 	if len(args) == 0 {
-		fmt.Fprint(os.Stderr, color.RedString("Error: path to Terraform state file expected\n"))
 		printHelp(flags)
 
-		return 1
+		return exitCodeUsage
 	}
 
-	pathToState := args[0]
+	if cmd == nil {
+		return usageError("", unknownCommandError(args[0]))
+	}
 
-	tfstate, err := state.New(pathToState)
-	if err != nil {
-		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read Terraform state file: %s\n", err))
+	return cmd.run(ctx, args[1:], providerFactory)
+}
 
-		return 1
+// mainFlagSetName is the name of the flag set of the flags given before the command.
+const mainFlagSetName = "terradozer"
+
+// mainFlags are the flags given before the command.
+type mainFlags struct {
+	output            string
+	version           bool
+	chdir             string
+	daemon            bool
+	daemonIdleTimeout string
+	connect           bool
+	socket            string
+}
+
+// newMainFlagSet returns the flag set of the flags given before the command.
+func newMainFlagSet(f *mainFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(mainFlagSetName, flag.ContinueOnError)
+
+	fs.Usage = func() {
+		printHelp(fs)
+	}
+
+	outputFlag(fs, &f.output, outputFormatsOf(fs.Name()))
+	fs.BoolVar(&f.version, "version", false, "Show application version")
+	fs.StringVar(&f.chdir, "chdir", "",
+		"Switch to a different working directory before resolving any paths (e.g., of the state or the config file)")
+	fs.BoolVar(&f.daemon, "daemon", false,
+		"Run as daemon, which keeps the providers running across runs of clients connecting via -connect")
+	fs.StringVar(&f.daemonIdleTimeout, "daemon-idle-timeout", "10m",
+		"Amount of time without any request after that the daemon exits")
+	fs.BoolVar(&f.connect, "connect", false,
+		"Run the command in the daemon if its socket exists (otherwise, runs the command as usual)")
+	fs.StringVar(&f.socket, "socket", defaultSocket, "Path to the unix socket of the daemon")
+
+	return fs
+}
+
+// stateFlags are the flags shared by all commands, which select the resources of a Terraform state.
+type stateFlags struct {
+	// ids is true if the path is the one of a file of resource IDs (see state.FromIDs) instead of a state.
+	ids bool
+	// discover is true if the resources are discovered by their tags (see discover.Discover) instead of read
+	// from a file.
+	discover                bool
+	discoverTags            string
+	discoverTypes           string
+	discoverOutput          string
+	path                    string
+	configPath              string
+	showConfig              bool
+	includeDefaultResources bool
+	protectedTypes          string
+	// allowOnlyTypes is the path to the allow list of resource types (see -allow-only-types), whose types
+	// are allowedTypes.
+	allowOnlyTypes   string
+	allowedTypes     []string
+	excludeAddresses string
+	excludeGlobal    bool
+	// include and exclude are the patterns of resources to destroy and not to destroy (see destroy.MatchResource).
+	include resourcePatternsFlag
+	exclude resourcePatternsFlag
+	// diffPath is the path to a newer state to compare the state with (see -diff), whose comparison is diff.
+	diffPath    string
+	diff        *destroy.StateDiff
+	forceCompat bool
+	logDebug    bool
+	// maxValueSize and hashValuesOver configure how attribute values are rendered (see internal.ValueRendering).
+	maxValueSize   int
+	hashValuesOver int
+	// accounts is true if the command can be run for several accounts listed in a manifest (see -manifest)
+	// instead of for a single state.
+	accounts           bool
+	manifest           string
+	accountParallelism int
+	// verify is true if the resources are the ones deleted by a previous run, which are listed in its report
+	// (see -report), instead of the ones of a state.
+	verify             bool
+	verificationReport string
+}
+
+// register defines the flags in the given flag set.
+func (f *stateFlags) register(fs *flag.FlagSet) {
+	switch {
+	case f.discover:
+		fs.StringVar(&f.discoverTags, "discover-tag", "",
+			"Comma-separated list of tags (key=value, or key for any value) that all resources to destroy have")
+		fs.StringVar(&f.discoverTypes, "discover-types", "",
+			"Comma-separated list of resource types to discover (defaults to all resources with the tags)")
+		fs.StringVar(&f.discoverOutput, "discover-output", "",
+			"Path to write the discovered resources to as CSV file of resource IDs (e.g., to review them)")
+	case f.ids:
+		fs.StringVar(&f.path, "ids", "", "Path to a CSV (type,id rows) or JSON file listing the resources to destroy")
+	case f.verify:
+		fs.StringVar(&f.path, "report", "", "Path to the report of a previous run listing the deleted resources")
+		fs.StringVar(&f.verificationReport, "verification-report", "",
+			"Path to a file to write a report to (JSON) of which deleted resources are still gone")
+	default:
+		fs.StringVar(&f.path, "state", "",
+			"Path or URL (s3://bucket/key[?versionId=version] or http(s)://) of the Terraform state file")
+		fs.StringVar(&f.diffPath, "diff", "",
+			"Path to a newer state of the same infrastructure; only resources of the state absent from it "+
+				"(matched by type and ID, so that moved resources are kept) are destroyed")
+	}
+	if f.accounts {
+		fs.StringVar(&f.manifest, "manifest", "",
+			"Path to a YAML file listing accounts (name, assume_role_arn, region, state) to run the command for "+
+				"with their own state each, instead of for a single state")
+		fs.IntVar(&f.accountParallelism, "account-parallelism", 1,
+			"Number of accounts of the manifest to run the command for in parallel (requires -force unless a dry run)")
 	}
+	fs.StringVar(&f.configPath, "config", "",
+		"Path to the config file setting defaults of flags (defaults to "+defaultConfigFile+" if it exists)")
+	fs.BoolVar(&f.showConfig, "show-config", false, "Show the effective configuration and exit")
+	fs.BoolVar(&f.logDebug, "debug", false, "Enable debug logging")
+	fs.IntVar(&f.maxValueSize, "max-value-size", internal.DefaultMaxValueSize,
+		"Number of bytes after which attribute values are truncated in logs, the preview, and reports (0 disables it)")
+	fs.IntVar(&f.hashValuesOver, "hash-values-over", 0,
+		"Replace attribute values larger than the given number of bytes by their SHA-256 checksum in logs, "+
+			"the preview, and reports instead of truncating them (e.g., to diff reports; 0 disables it)")
+	fs.BoolVar(&f.includeDefaultResources, "include-default-resources", false,
+		"Destroy resources adopting default infrastructure of the AWS account (aws_default_*), which are skipped otherwise")
+	fs.StringVar(&f.protectedTypes, "protected-types", "",
+		"Comma-separated list of resource types that are never destroyed (e.g., aws_s3_bucket)")
+	fs.StringVar(&f.allowOnlyTypes, "allow-only-types", "",
+		"Path to a file listing the only resource types that may be destroyed (one per line); resources of other "+
+			"types are skipped, regardless of other flags")
+	fs.StringVar(&f.excludeAddresses, "exclude-addresses", "",
+		"Comma-separated list of resource addresses that are not destroyed (e.g., module.vpc.aws_vpc.shared)")
+	fs.Var(&f.include, "include",
+		"Only destroy resources whose type or address matches one of the given patterns, e.g., aws_instance or "+
+			"module.staging (repeatable or comma-separated; * and ? match any characters; covers sub-modules)")
+	fs.Var(&f.exclude, "exclude",
+		"Don't destroy resources whose type or address matches one of the given patterns "+
+			"(same syntax as -include; takes precedence over it)")
+	fs.BoolVar(&f.excludeGlobal, "exclude-global", false,
+		"Don't destroy resources of global services (e.g., IAM, Route53, CloudFront, WAF classic, and ACM certificates "+
+			"in us-east-1), which aren't bound to the region")
+	fs.BoolVar(&f.forceCompat, "force-compat", false,
+		"Read states written by a newer version of Terraform than supported (see -version), which might be misread")
+}
 
-	internal.LogTitle("reading state")
-	log.WithField("file", pathToState).Info(internal.Pad("using state"))
+// parse parses the given command line arguments and applies the environment (TERRADOZER_<FLAG>) and
+// the config file to all flags not given (precedence: flags > environment > config file > defaults).
+// The path to the state can also be given as first argument (instead of via -state or -ids).
+// With -show-config, the effective configuration is logged and no state is expected.
+func (f *stateFlags) parse(fs *flag.FlagSet, args []string) error {
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
 
-	providers, err := provider.InitProviders(tfstate.ProviderNames(), "~/.terradozer", timeoutDuration)
+	sources, err := applyEnv(fs)
 	if err != nil {
-		fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to initialize Terraform providers: %s\n", err))
+		return err
+	}
 
-		return 1
+	configPath := f.configPath
+	if configPath == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			configPath = defaultConfigFile
+		}
 	}
 
-	defer func() {
-		for _, p := range providers {
-			_ = p.Close()
+	if configPath != "" {
+		config, err := loadConfigFile(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config file: %s", err)
 		}
-	}()
 
-	resources, err := tfstate.Resources(providers)
-	if err != nil {
-		fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to get resources from Terraform state: %s\n", err))
+		err = applyConfig(fs, config, configPath, sources)
+		if err != nil {
+			return err
+		}
+	}
 
-		return 1
+	if f.logDebug {
+		log.SetLevel(log.DebugLevel)
 	}
 
-	resourcesWithUpdatedState := terraform.UpdateResources(resources, parallel)
+	if f.maxValueSize < 0 || f.hashValuesOver < 0 {
+		return fmt.Errorf("-max-value-size and -hash-values-over must not be negative")
+	}
 
-	if !force {
-		internal.LogTitle("showing resources that would be deleted (dry run)")
+	internal.SetValueRendering(internal.ValueRendering{MaxSize: f.maxValueSize, HashSize: f.hashValuesOver})
 
-		// always show the resources that would be affected before deleting anything
-		for _, r := range resourcesWithUpdatedState {
-			log.WithField("id", r.ID()).Warn(internal.Pad(r.Type()))
+	if f.path == "" && fs.NArg() > 0 {
+		f.path = fs.Arg(0)
+	}
+
+	if f.showConfig {
+		logConfig(fs, sources, configPath)
+
+		return nil
+	}
+
+	for _, address := range splitAddresses(f.excludeAddresses) {
+		if _, err := destroy.CanonicalAddress(address); err != nil {
+			return fmt.Errorf("failed to parse -exclude-addresses flag: %s", err)
 		}
+	}
 
-		if len(resourcesWithUpdatedState) == 0 {
-			internal.LogTitle("all resources have already been deleted")
-			return 0
+	if f.allowOnlyTypes != "" {
+		f.allowedTypes, err = readAllowList(f.allowOnlyTypes)
+		if err != nil {
+			return fmt.Errorf("failed to read -allow-only-types file: %s", err)
+		}
+	}
+
+	if f.discover {
+		if _, err := discover.ParseTags(f.discoverTags); err != nil {
+			return fmt.Errorf("failed to parse -discover-tag flag: %s", err)
 		}
 
-		internal.LogTitle(fmt.Sprintf("total number of resources that would be deleted: %d",
-			len(resourcesWithUpdatedState)))
+		for _, t := range splitList(f.discoverTypes) {
+			if !contains(discover.Types(), t) {
+				return fmt.Errorf("failed to parse -discover-types flag: resources of type %s can't be discovered "+
+					"(supported types: %s)", t, strings.Join(discover.Types(), ", "))
+			}
+		}
+
+		return nil
 	}
 
-	if !dryRun {
-		if !internal.UserConfirmedDeletion(os.Stdin, force) {
-			return 0
+	if f.manifest != "" {
+		if f.path != "" {
+			return fmt.Errorf("-manifest can't be combined with a state (the states are listed in the manifest)")
 		}
 
-		internal.LogTitle("Starting to delete resources")
+		if f.accountParallelism < 1 {
+			return fmt.Errorf("-account-parallelism must be at least 1")
+		}
 
-		numDeletedResources := resource.DestroyResources(
-			convertToDestroyableResources(resourcesWithUpdatedState), parallel)
+		if _, err := os.Stat(f.manifest); os.IsNotExist(err) {
+			return fmt.Errorf("manifest doesn't exist: %s", f.manifest)
+		}
 
-		internal.LogTitle(fmt.Sprintf("total number of deleted resources: %d", numDeletedResources))
+		return nil
 	}
 
-	return 0
+	if f.path == "" {
+		return fmt.Errorf("path to %s expected", f.file())
+	}
+
+	// whether a remote state exists is only known once it's read
+	if f.remote() {
+		return nil
+	}
+
+	if _, err := os.Stat(f.path); os.IsNotExist(err) {
+		return fmt.Errorf("%s doesn't exist: %s", f.file(), f.path)
+	}
+
+	return nil
+}
+
+// remote returns true if the resources are read from a remote Terraform state (see state.IsRemote).
+func (f stateFlags) remote() bool {
+	return !f.discover && !f.ids && !f.verify && state.IsRemote(f.path)
+}
+
+// file returns what kind of file the resources are read from.
+func (f stateFlags) file() string {
+	switch {
+	case f.discover:
+		return "discovered resources"
+	case f.ids:
+		return "file of resource IDs"
+	case f.verify:
+		return "report of previous run"
+	default:
+		return "Terraform state file"
+	}
+}
+
+// filter returns the filter that selects the resources to destroy.
+func (f stateFlags) filter() destroy.Filter {
+	var filters destroy.Filters
+
+	// the first filter that doesn't match is the reason why a resource is skipped: protected types take precedence
+	// over the allow list, which takes precedence over all other filters
+	if f.protectedTypes != "" {
+		filters = append(filters, destroy.ProtectedTypesFilter(splitList(f.protectedTypes)))
+	}
+
+	if f.allowOnlyTypes != "" {
+		filters = append(filters, destroy.AllowedTypesFilter(f.allowedTypes))
+	}
+
+	if len(f.include) > 0 {
+		filters = append(filters, destroy.IncludedPatternsFilter(f.include))
+	}
+
+	if len(f.exclude) > 0 {
+		filters = append(filters, destroy.ExcludedPatternsFilter(f.exclude))
+	}
+
+	if !f.includeDefaultResources {
+		filters = append(filters, destroy.DefaultResourcesFilter{})
+	}
+
+	if f.excludeAddresses != "" {
+		var addresses []string
+
+		for _, address := range splitAddresses(f.excludeAddresses) {
+			if canonical, err := destroy.CanonicalAddress(address); err == nil {
+				address = canonical
+			}
+
+			addresses = append(addresses, address)
+		}
+
+		filters = append(filters, destroy.ExcludedAddressesFilter(addresses))
+	}
+
+	if f.excludeGlobal {
+		filters = append(filters, destroy.GlobalResourcesFilter{})
+	}
+
+	if f.diff != nil {
+		filters = append(filters, f.diff)
+	}
+
+	return filters
 }
 
-func convertToDestroyableResources(resources []terraform.UpdatableResource) []resource.DestroyableResource {
-	var result []resource.DestroyableResource
+// splitAddresses splits a comma-separated list of addresses like splitList, except for commas within
+// the quoted instance keys of addresses (e.g., aws_s3_object.file["a,b"]).
+func splitAddresses(list string) []string {
+	var result []string
+
+	add := func(e string) {
+		if e = strings.TrimSpace(e); e != "" {
+			result = append(result, e)
+		}
+	}
+
+	start := 0
+	quoted := false
 
-	for _, r := range resources {
-		result = append(result, r.(resource.DestroyableResource))
+	for i := 0; i < len(list); i++ {
+		switch {
+		case quoted && list[i] == '\\':
+			i++
+		case list[i] == '"':
+			quoted = !quoted
+		case !quoted && list[i] == ',':
+			add(list[start:i])
+			start = i + 1
+		}
 	}
 
+	add(list[start:])
+
 	return result
 }
 
-func printHelp(fs *flag.FlagSet) {
-	fmt.Fprintf(os.Stderr, "\n"+strings.TrimSpace(help)+"\n")
-	fs.PrintDefaults()
-	fmt.Println()
+// addressPatternsFlag is the value of a flag that can be repeated, each time with an address of a resource or
+// a comma-separated list of them (see splitAddresses), which can contain wildcards (see destroy.MatchAddresses).
+// Addresses without wildcards are canonical (see destroy.CanonicalAddress).
+type addressPatternsFlag []string
+
+// String implements flag.Value.
+func (f *addressPatternsFlag) String() string {
+	return strings.Join(*f, ",")
 }
 
-const help = `
+// Set implements flag.Value.
+func (f *addressPatternsFlag) Set(value string) error {
+	for _, address := range splitAddresses(value) {
+		if !strings.ContainsAny(address, "*?") {
+			canonical, err := destroy.CanonicalAddress(address)
+			if err != nil {
+				return err
+			}
+
+			address = canonical
+		}
+
+		*f = append(*f, address)
+	}
+
+	return nil
+}
+
+// resourcePatternsFlag is the value of a flag like addressPatternsFlag, whose patterns can also be types
+// of resources and addresses of module instances (see destroy.MatchResource). Patterns without wildcards
+// are canonical (see destroy.CanonicalPattern).
+type resourcePatternsFlag []string
+
+// String implements flag.Value.
+func (f *resourcePatternsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set implements flag.Value.
+func (f *resourcePatternsFlag) Set(value string) error {
+	for _, pattern := range splitAddresses(value) {
+		if !strings.ContainsAny(pattern, "*?") {
+			canonical, err := destroy.CanonicalPattern(pattern)
+			if err != nil {
+				return err
+			}
+
+			pattern = canonical
+		}
+
+		*f = append(*f, pattern)
+	}
+
+	return nil
+}
+
+// overridesFlag is the value of a repeatable flag of attribute overrides (see destroy.ParseAttributeOverride).
+type overridesFlag []destroy.AttributeOverride
+
+// String implements flag.Value.
+func (f *overridesFlag) String() string {
+	var result []string
+
+	for _, o := range *f {
+		result = append(result, o.String())
+	}
+
+	return strings.Join(result, " ")
+}
+
+// Set implements flag.Value.
+func (f *overridesFlag) Set(value string) error {
+	o, err := destroy.ParseAttributeOverride(strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, o)
+
+	return nil
+}
+
+// splitList splits a comma-separated list, ignoring whitespace around elements.
+func splitList(list string) []string {
+	var result []string
+
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// outputFlag defines the flag of the output format in the given flag set.
+func outputFlag(fs *flag.FlagSet, output *string, formats []string) {
+	fs.StringVar(output, "output", "text", "Output format ("+joinFormats(formats)+")")
+}
+
+// newCommandFlagSet returns the flag set of a command, which prints the help of the command if requested.
+func newCommandFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	fs.Usage = func() {
+		printCommandHelp(name, fs)
+	}
+
+	return fs
+}
+
+// destroyFlags are the flags of the plan and destroy command.
+type destroyFlags struct {
+	assertEmpty          bool
+	awsAssumeRoleARN     string
+	awsEndpointURL       string
+	awsMFAToken          string
+	autoUpgradeProvider  bool
+	awsRegion            string
+	batchDeletes         bool
+	beanstalkTimeout     string
+	blockOnConsumers     bool
+	capBehavior          string
+	checkConsumers       string
+	checkpointEvery      int
+	checkpointTimeout    string
+	defaultDeleteTimeout string
+	deleteLogGroups      bool
+	dryRun               bool
+	driftReport          string
+	explainBlockers      bool
+	failIfAllGone        bool
+	force                bool
+	gracePeriod          string
+	graph                string
+	graphFormat          string
+	graphModule          string
+	ignoreRegionMismatch bool
+	inventoryCompare     bool
+	keepLogs             bool
+	keepWorkDir          bool
+	kmsDeletionWindow    int
+	lockFile             string
+	logSensitive         bool
+	maxPerType           string
+	maxRetries           int
+	noCache              bool
+	noRefresh            bool
+	noForce              addressPatternsFlag
+	orderBy              string
+	orderByModule        bool
+	output               string
+	overrides            overridesFlag
+	ownerTag             string
+	parallel             int
+	providerStub         string
+	providerVersion      string
+	rdsTakeFinalSnapshot bool
+	report               string
+	route53EmptyZones    bool
+	secretsForceDelete   bool
+	setLogRetention      int
+	showOrder            bool
+	simulate             bool
+	timeout              string
+	traceFile            string
+	waitForObjectLock    bool
+	window               string
+}
+
+// register defines the flags in the given flag set; flags that only affect deletions (e.g., -force) are only
+// defined if not a dry run.
+//
+//nolint:wsl
+func (f *destroyFlags) register(fs *flag.FlagSet, dryRun bool) {
+	fs.StringVar(&f.awsAssumeRoleARN, "aws-assume-role-arn", "",
+		"ARN of a role to assume (e.g., of another account) with the resolved credentials to destroy resources")
+	fs.StringVar(&f.awsEndpointURL, "aws-endpoint-url", "",
+		"Custom endpoint URL for all AWS services (e.g., http://localhost:4566 for LocalStack) "+
+			"or comma-separated list of service=URL pairs")
+	fs.StringVar(&f.awsMFAToken, "aws-mfa-token", "",
+		"MFA token code to assume a role that requires MFA (prompted for if not set)")
+	fs.StringVar(&f.awsRegion, "aws-region", "",
+		"AWS region to destroy resources in (defaults to AWS_REGION, AWS_DEFAULT_REGION, or the region of the profile)")
+	fs.BoolVar(&f.autoUpgradeProvider, "auto-upgrade-provider", false,
+		"Retry resources whose schema version in the state is newer than the provider's with the latest version "+
+			"of the provider (never downgrades)")
+	fs.BoolVar(&f.batchDeletes, "batch-deletes", false,
+		"Delete Route53 record sets, CloudWatch log groups, and S3 objects in batches directly via the AWS API")
+	fs.StringVar(&f.beanstalkTimeout, "beanstalk-timeout", destroy.DefaultBeanstalkTimeout.String(),
+		"Amount of time to wait for an Elastic Beanstalk environment to terminate")
+	fs.StringVar(&f.checkConsumers, "check-consumers", "",
+		"Comma-separated list of paths to other Terraform states whose resources and data sources are checked "+
+			"for references to the IDs or ARNs of resources that would be deleted")
+	fs.StringVar(&f.defaultDeleteTimeout, "default-delete-timeout", "",
+		"Delete timeout of resources without a customized one in the state (e.g., 60m; defaults to the provider's)")
+	fs.BoolVar(&f.deleteLogGroups, "delete-log-groups", false,
+		"Delete the CloudWatch log groups that Lambda functions, ECS task definitions, and VPC flow logs have created "+
+			"implicitly (e.g., /aws/lambda/<function name>) after deleting the resources")
+	fs.StringVar(&f.driftReport, "drift-report", "",
+		"Path to a file to write a report to (JSON) of how the attributes in the state differ from the current ones")
+	fs.BoolVar(&f.failIfAllGone, "fail-if-all-gone", false,
+		"Exit with code 6 if all resources of the state don't exist anymore (i.e., the state is entirely stale)")
+	fs.StringVar(&f.gracePeriod, "grace-period", "30s",
+		"Amount of time to wait for destroys in flight to finish once interrupted (a second interrupt terminates "+
+			"immediately)")
+	fs.StringVar(&f.graph, "graph", "",
+		"Path to a file to write the graph of the resources in the order they would be deleted to")
+	fs.StringVar(&f.graphFormat, "graph-format", graphFormatDOT,
+		fmt.Sprintf("Format of the graph written to the -graph file (%s or %s)", graphFormatDOT, graphFormatMermaid))
+	fs.StringVar(&f.graphModule, "graph-module", "",
+		"Only write the resources of the given module (and its child modules) to the -graph file (e.g., module.vpc)")
+	fs.BoolVar(&f.inventoryCompare, "inventory-compare", false,
+		"List resources outside the state that share the tags of its resources (via the tagging API, limited to "+
+			"the VPCs, clusters, and name prefixes the state references) to clean them up manually; never deletes them")
+	fs.StringVar(&f.maxPerType, "max-per-type", "",
+		"Comma-separated list of type=N pairs capping the number of resources of a type to delete "+
+			"(e.g., aws_s3_bucket=5,aws_db_instance=2); exceeding a cap aborts the run before anything is deleted")
+	fs.StringVar(&f.capBehavior, "cap-behavior", capBehaviorAbort,
+		fmt.Sprintf("What to do if a cap of -max-per-type is exceeded: %s (exit with code %d) or %s (delete only up to "+
+			"the cap, the oldest first, and defer the rest)", capBehaviorAbort, exitCodeCapExceeded, capBehaviorTrim))
+	fs.BoolVar(&f.noCache, "no-cache", false,
+		"Don't use or update the cache of how resources of each type have been imported during previous runs")
+	fs.BoolVar(&f.noRefresh, "no-refresh", false,
+		"Destroy resources with the attributes recorded in the state, without reading or importing them first")
+	fs.Var(&f.noForce, "no-force",
+		"Don't set force_destroy or force_detach_policies of resources with the given `address`, so that deleting "+
+			"a non-empty bucket fails (repeatable; comma-separated, * and ? match any characters, "+
+			"e.g., aws_s3_bucket.audit_logs)")
+	fs.Var(&f.overrides, "override",
+		"Set attributes of resources of a type in the state before destroying them, given as `type:name=value,...` "+
+			"(repeatable, e.g., aws_lb:enable_deletion_protection=false); attributes enforced by the API, "+
+			"like deletion protection, are updated in the cloud first")
+	fs.BoolVar(&f.route53EmptyZones, "route53-empty-zones", false,
+		"Delete all record sets of a hosted zone (except NS and SOA), also if not in the state, before deleting the zone")
+	fs.BoolVar(&f.secretsForceDelete, "secrets-force-delete", false,
+		"Delete Secrets Manager secrets (and their replicas) immediately without recovery window")
+	fs.IntVar(&f.setLogRetention, "set-log-retention", 0,
+		"Set the retention of the log groups that would be deleted by -delete-log-groups to the given number of days "+
+			"instead of deleting them (e.g., 7)")
+	fs.BoolVar(&f.simulate, "simulate", false,
+		"Only show the resources that would be destroyed and call the delete APIs supporting it with a dry run "+
+			"to check the permissions (e.g., of EC2 resources)")
+	fs.StringVar(&f.timeout, "timeout", "30s", "Amount of time to wait for a destroy of a resource to finish")
+	fs.StringVar(&f.traceFile, "trace-file", "",
+		"Path to a file to write a trace of the run to (Chrome trace event format, e.g., for https://ui.perfetto.dev)")
+	if !dryRun {
+		fs.BoolVar(&f.assertEmpty, "assert-empty", false,
+			"Read all resources of the state again after destroying them and exit with code 9 if any still exists "+
+				"(listed in the -report)")
+		fs.BoolVar(&f.blockOnConsumers, "block-on-consumers", false,
+			"Don't delete anything if resources that would be deleted are referenced by other states "+
+				"(see -check-consumers)")
+		fs.IntVar(&f.checkpointEvery, "checkpoint-every", 0,
+			"Pause after every N deleted resources to show a summary, write the -report, and ask whether to continue "+
+				"(exits with code 11 if not; disabled if stdin isn't a terminal, unless -checkpoint-timeout is set)")
+		fs.StringVar(&f.checkpointTimeout, "checkpoint-timeout", "",
+			"Amount of time to wait for an answer at a checkpoint before continuing automatically "+
+				"(e.g., 5m for unattended runs; waits until answered if not set)")
+		fs.IntVar(&f.maxRetries, "max-retries", 5,
+			"Maximum number of times a resource that failed to be deleted is retried, e.g., due to a dependency "+
+				"violation (0 retries as long as other resources are deleted in between)")
+		fs.BoolVar(&f.explainBlockers, "explain-blockers", false,
+			"Look up resources outside the state (e.g., network interfaces in a subnet) that block the deletion "+
+				"of resources failing due to dependency violations")
+		fs.BoolVar(&f.force, "force", false,
+			"Destroy without asking for confirmation (required if stdin isn't a terminal, e.g., in CI)")
+		fs.BoolVar(&f.ignoreRegionMismatch, "ignore-region-mismatch", false,
+			"Destroy without asking for confirmation if most resources are in other regions than the provider's region")
+		fs.BoolVar(&f.orderByModule, "order-by-module", false,
+			"Destroy the resources of one top-level module instance completely before starting the next")
+		fs.StringVar(&f.report, "report", "",
+			"Path to a file to write a report to (JSON) listing the deleted and failed resources "+
+				"(e.g., to check later with the verify command that they are still gone)")
+		fs.BoolVar(&f.waitForObjectLock, "wait-for-object-lock-expiry", false,
+			"Delete the object versions of S3 buckets whose object lock retention is in governance mode with "+
+				"the bypass header (requires s3:BypassGovernanceRetention) instead of waiting for it to expire")
+		fs.StringVar(&f.window, "window", "",
+			"Daily time window in which resources are deleted, e.g., \"02:00-05:00 Europe/Prague\" (everything else is "+
+				"done right away; exits with code 8 when the window closes before all resources are deleted)")
+	}
+	fs.BoolVar(&f.keepLogs, "keep-logs", false,
+		"Keep the log groups created implicitly by deleted resources (overrides -delete-log-groups and -set-log-retention, "+
+			"e.g., if set via TERRADOZER_DELETE_LOG_GROUPS)")
+	fs.BoolVar(&f.keepWorkDir, "keep-workdir", false,
+		"Keep the workspace of the run in the system's temp directory (e.g., partial downloads) for debugging")
+	fs.IntVar(&f.kmsDeletionWindow, "kms-deletion-window", destroy.DefaultKMSDeletionWindow,
+		"Number of days (between 7 and 30) after that KMS keys scheduled for deletion are deleted")
+	fs.StringVar(&f.lockFile, "lock-file", "",
+		"Path to a dependency lock file (.terraform.lock.hcl) whose provider versions are used and whose hashes "+
+			"the providers must match (defaults to the one in the working directory, if any)")
+	fs.BoolVar(&f.logSensitive, "log-sensitive", false,
+		"Show sensitive values (marked values and values of sensitive attributes) in logs and reports "+
+			"instead of redacting them")
+	fs.StringVar(&f.orderBy, "order-by", "",
+		"Destroy the resources in the given order as far as dependencies allow: cost (the most expensive first, "+
+			"by estimated monthly costs)")
+	fs.StringVar(&f.ownerTag, "owner-tag", "",
+		"Name of the tag (or attribute) whose value is the owner of a resource (e.g., owner), which is logged with "+
+			"each resource and summarized at the end (resources without it are unowned)")
+	fs.IntVar(&f.parallel, "parallel", 10, "Limit the number of concurrent destroy operations")
+	fs.StringVar(&f.providerStub, "provider-stub", "",
+		"Replace all providers with in-process stubs, e.g., latency=200ms,fail-rate=0.02,seed=1 (hidden; for benchmarks)")
+	fs.StringVar(&f.providerVersion, "provider-version", "",
+		"Comma-separated list of name=version pairs of providers to use instead of the default versions (e.g., aws=v3.74.0)")
+	fs.BoolVar(&f.rdsTakeFinalSnapshot, "rds-take-final-snapshot", false,
+		"Take a final snapshot of RDS instances and clusters (and of DocumentDB, Neptune, and Redshift clusters) "+
+			"before deleting them")
+	fs.BoolVar(&f.showOrder, "show-order", false,
+		"Show the order in which the resources would be deleted (with their estimated monthly costs)")
+}
+
+// newDestroyFlagSet returns the flag set of the plan, destroy, adopt-and-destroy, or discover-and-destroy command.
+func newDestroyFlagSet(name string, shared *stateFlags, f *destroyFlags) *flag.FlagSet {
+	fs := newCommandFlagSet(name)
+
+	shared.ids = name == adoptCommand
+	shared.discover = name == discoverCommand
+	shared.accounts = name == "plan" || name == "destroy"
+	shared.verify = name == verifyCommand
+	shared.register(fs)
+	f.register(fs, name == "plan" || name == verifyCommand)
+
+	if name != verifyCommand {
+		outputFlag(fs, &f.output, outputFormatsOf(name))
+	}
+
+	if name == adoptCommand || name == discoverCommand {
+		fs.BoolVar(&f.dryRun, "dry-run", false, "Only show the resources that would be destroyed (as the plan command)")
+	}
+
+	return fs
+}
+
+// runDestroy runs the plan command or (if the command name is destroy, adopt-and-destroy, or discover-and-destroy)
+// destroys the resources after the user's confirmation. The adopt-and-destroy command reads the resources from a file
+// of resource IDs instead of a state, and the discover-and-destroy command discovers them by their tags.
+func runDestroy(ctx context.Context, name string, arguments []string, providerFactory provider.Factory) int {
+	var shared stateFlags
+
+	var f destroyFlags
+
+	flags := newDestroyFlagSet(name, &shared, &f)
+
+	err := shared.parse(flags, arguments)
+	if err != nil {
+		return usageError(name, err)
+	}
+
+	dryRun := name == "plan" || name == verifyCommand || f.dryRun || f.simulate
+
+	if shared.showConfig {
+		return 0
+	}
+
+	if f.kmsDeletionWindow < 7 || f.kmsDeletionWindow > 30 {
+		return usageError(name, fmt.Errorf("-kms-deletion-window must be between 7 and 30 days"))
+	}
+
+	if f.setLogRetention != 0 && !validLogRetention(f.setLogRetention) {
+		return usageError(name, fmt.Errorf("-set-log-retention must be one of %v days, got: %d",
+			destroy.ValidLogRetentionDays, f.setLogRetention))
+	}
+
+	if f.deleteLogGroups && f.setLogRetention != 0 {
+		return usageError(name, fmt.Errorf("-delete-log-groups and -set-log-retention are mutually exclusive"))
+	}
+
+	if f.keepLogs {
+		f.deleteLogGroups = false
+		f.setLogRetention = 0
+	}
+
+	if f.orderBy != "" && f.orderBy != orderByCost {
+		return usageError(name, fmt.Errorf("-order-by must be %s, got: %s", orderByCost, f.orderBy))
+	}
+
+	timeoutDuration, err := time.ParseDuration(f.timeout)
+	if err != nil {
+		return usageError(name, fmt.Errorf("failed to parse timeout flag: %s", err))
+	}
+
+	beanstalkTimeoutDuration, err := time.ParseDuration(f.beanstalkTimeout)
+	if err != nil {
+		return usageError(name, fmt.Errorf("failed to parse beanstalk-timeout flag: %s", err))
+	}
+
+	gracePeriodDuration, err := time.ParseDuration(f.gracePeriod)
+	if err != nil {
+		return usageError(name, fmt.Errorf("failed to parse grace-period flag: %s", err))
+	}
+
+	var defaultDeleteTimeoutDuration time.Duration
+
+	if f.defaultDeleteTimeout != "" {
+		defaultDeleteTimeoutDuration, err = time.ParseDuration(f.defaultDeleteTimeout)
+		if err != nil {
+			return usageError(name, fmt.Errorf("failed to parse default-delete-timeout flag: %s", err))
+		}
+	}
+
+	if f.checkpointEvery < 0 {
+		return usageError(name, fmt.Errorf("-checkpoint-every must not be negative"))
+	}
+
+	if f.maxRetries < 0 {
+		return usageError(name, fmt.Errorf("-max-retries must not be negative"))
+	}
+
+	if formats := outputFormatsOf(name); f.output != "" && !contains(formats, f.output) {
+		return usageError(name, fmt.Errorf("unsupported -output format: %s (expected %s)",
+			f.output, joinFormats(formats)))
+	}
+
+	var checkpointTimeoutDuration time.Duration
+
+	if f.checkpointTimeout != "" {
+		if f.checkpointEvery == 0 {
+			return usageError(name, fmt.Errorf("-checkpoint-timeout requires -checkpoint-every"))
+		}
+
+		checkpointTimeoutDuration, err = time.ParseDuration(f.checkpointTimeout)
+		if err != nil || checkpointTimeoutDuration <= 0 {
+			return usageError(name, fmt.Errorf("failed to parse -checkpoint-timeout flag: must be a positive "+
+				"duration, got: %s", f.checkpointTimeout))
+		}
+	}
+
+	var window *deletionWindow
+
+	if f.window != "" {
+		window, err = parseWindow(f.window)
+		if err != nil {
+			return usageError(name, fmt.Errorf("failed to parse -window flag: %s", err))
+		}
+	}
+
+	awsConfig := provider.AWSConfig{MFAToken: f.awsMFAToken, Region: f.awsRegion, AssumeRoleARN: f.awsAssumeRoleARN}
+
+	if f.awsEndpointURL != "" {
+		err = awsConfig.ParseEndpointURL(f.awsEndpointURL)
+		if err != nil {
+			return usageError(name, fmt.Errorf("failed to parse -aws-endpoint-url flag: %s", err))
+		}
+	}
+
+	var previous *runReport
+
+	if shared.verify {
+		previous, err = readRunReport(shared.path)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read report of previous run: %s\n", err))
+
+			return 1
+		}
+
+		// the resources are read in the region they have been destroyed in
+		if awsConfig.Region == "" {
+			awsConfig.Region = previous.Region
+		}
+	}
+
+	var stubConfig *provider.StubConfig
+
+	if f.providerStub != "" {
+		config, err := provider.ParseStubConfig(f.providerStub)
+		if err != nil {
+			return usageError(name, fmt.Errorf("failed to parse -provider-stub flag: %s", err))
+		}
+
+		stubConfig = &config
+	}
+
+	providerVersions, err := provider.ParseVersions(f.providerVersion)
+	if err != nil {
+		return usageError(name, fmt.Errorf("failed to parse -provider-version flag: %s", err))
+	}
+
+	if f.blockOnConsumers && f.checkConsumers == "" {
+		return usageError(name, fmt.Errorf("-block-on-consumers requires -check-consumers"))
+	}
+
+	if f.graphFormat != graphFormatDOT && f.graphFormat != graphFormatMermaid {
+		return usageError(name, fmt.Errorf("-graph-format must be %s or %s, got: %s", graphFormatDOT,
+			graphFormatMermaid, f.graphFormat))
+	}
+
+	if f.graph == "" && (f.graphModule != "" || f.graphFormat != graphFormatDOT) {
+		return usageError(name, fmt.Errorf("-graph-format and -graph-module require -graph"))
+	}
+
+	caps, err := parseTypeCaps(f.maxPerType)
+	if err != nil {
+		return usageError(name, fmt.Errorf("failed to parse -max-per-type flag: %s", err))
+	}
+
+	if f.capBehavior != capBehaviorAbort && f.capBehavior != capBehaviorTrim {
+		return usageError(name, fmt.Errorf("-cap-behavior must be %s or %s, got: %s", capBehaviorAbort,
+			capBehaviorTrim, f.capBehavior))
+	}
+
+	if shared.manifest != "" && shared.diffPath != "" {
+		return usageError(name, fmt.Errorf("-diff can't be combined with -manifest"))
+	}
+
+	if shared.manifest != "" && f.output == "json" {
+		return usageError(name, fmt.Errorf("-output json can't be combined with -manifest (use -report instead, "+
+			"which is written per account)"))
+	}
+
+	if shared.manifest != "" {
+		if shared.accountParallelism > 1 && !dryRun && !f.force {
+			return usageError(name, fmt.Errorf("-account-parallelism requires -force, since the deletion can't be "+
+				"confirmed for several accounts at once"))
+		}
+
+		return runAccounts(ctx, name, flags, shared, providerFactory)
+	}
+
+	var locked map[string]provider.LockedProvider
+
+	if stubConfig == nil {
+		locked, err = readLockFile(f.lockFile)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read lock file: %s\n", err))
+
+			return 1
+		}
+	}
+
+	pathToState := shared.path
+
+	// the first signal cancels the context to stop gracefully, a second one terminates immediately
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// ctx is replaced below (e.g., by one with a tracer)
+	done := ctx.Done()
+
+	go func() {
+		<-done
+		stop()
+	}()
+
+	if f.traceFile != "" {
+		tracer, err := trace.NewFile(f.traceFile)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to create trace file: %s\n", err))
+
+			return 1
+		}
+
+		defer func() {
+			if err := tracer.Close(); err != nil {
+				fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to write trace file: %s\n", err))
+			}
+		}()
+
+		ctx = trace.NewContext(ctx, tracer)
+	}
+
+	awsSession, err := newSession(awsConfig, stubConfig != nil)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to create AWS session: %s\n", err))
+
+		return 1
+	}
+
+	awsConfig.Credentials = awsSession.Config.Credentials
+	// the session also reads the region from AWS_DEFAULT_REGION or the profile's config
+	awsConfig.Region = aws.StringValue(awsSession.Config.Region)
+
+	var tfstate *state.State
+
+	var adoption *state.Adoption
+
+	// addresses of the resources adopted from the report of a previous run (see verify)
+	var addresses map[string]string
+
+	span := trace.Start(ctx, "run", "read state", nil)
+	switch {
+	case shared.discover:
+		tfstate, err = discoverResources(ctx, awsSession, shared)
+	case shared.verify:
+		tfstate, addresses, err = adoptReportedResources(previous)
+	case shared.ids:
+		tfstate, adoption, err = state.FromIDs(pathToState)
+	default:
+		tfstate, err = state.Read(ctx, pathToState, awsSession)
+	}
+	span.End(err)
+
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read %s: %s\n", shared.file(), err))
+
+		return 1
+	}
+
+	if !compatible(tfstate, shared.forceCompat) {
+		return 1
+	}
+
+	switch {
+	case shared.discover:
+		// already logged while discovering the resources
+	case adoption != nil:
+		internal.LogTitle("reading resource IDs")
+		logAdoption(pathToState, *adoption)
+	case shared.verify:
+		internal.LogTitle("reading report of previous run")
+		log.WithFields(log.Fields{"file": pathToState, "deleted": len(previous.Deleted)}).
+			Info(internal.Pad("verifying that deleted resources are still gone"))
+	default:
+		internal.LogTitle("reading state")
+		logUsingState(pathToState)
+	}
+
+	warnUnmatchedIncludes(tfstate, shared.include)
+
+	consumers, err := readConsumers(splitList(f.checkConsumers))
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ %s\n", err))
+
+		return 1
+	}
+
+	shared.diff, err = readStateDiff(tfstate, shared.diffPath)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ %s\n", err))
+
+		return 1
+	}
+
+	if stubConfig != nil {
+		log.WithFields(log.Fields{
+			"latency":   stubConfig.Latency,
+			"fail_rate": stubConfig.FailRate,
+		}).Warn(internal.Pad("replacing all providers with stubs (no resources are destroyed)"))
+
+		providerFactory = provider.StubFactory(*stubConfig, resourceTypes(tfstate))
+	}
+
+	if stubConfig == nil && !f.ignoreRegionMismatch && contains(tfstate.SelectedProviderNames(shared.filter()), "aws") {
+		code, ok := checkRegions(ctx, tfstate.Regions(shared.filter()), awsConfig.Region, dryRun, f.force)
+		if !ok {
+			return code
+		}
+	}
+
+	// providers can't ask for missing configuration themselves, so it is asked for (or listed) before
+	missingConfigs := map[string]error{}
+
+	if stubConfig == nil && contains(tfstate.SelectedProviderNames(shared.filter()), "aws") {
+		if err := resolveAWSInputs(awsSession, &awsConfig); err != nil {
+			missingConfigs["aws"] = err
+		}
+	}
+
+	concurrency := destroy.NewConcurrency(f.parallel)
+
+	workDir, removeWorkDir, err := newWorkDir(f.keepWorkDir)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to create workspace of run: %s\n", err))
+
+		return 1
+	}
+	defer removeWorkDir()
+
+	var report *runReport
+
+	// the output of -output json lists the deleted resources, too
+	if f.report != "" || f.output == "json" {
+		report = newRunReport(awsConfig.Region)
+
+		if shared.diff != nil {
+			report.Moved = shared.diff.Moved
+		}
+	}
+
+	providerConfig := provider.Config{
+		InstallDir: installDir,
+		WorkDir:    workDir,
+		Timeout:    timeoutDuration,
+		AWS:        awsConfig,
+		Factory:    providerFactory,
+		Versions:   providerVersions,
+		Locked:     locked,
+		Throttled: func() {
+			concurrency.Throttled(time.Now())
+		},
+		Retried: report.retried,
+		// nothing must be changed when verifying that resources are gone, regardless of other flags
+		ReadOnly: shared.verify,
+		// what stubs pretend must not be cached for the real providers
+		NoCache: f.noCache || stubConfig != nil,
+	}
+
+	if report != nil {
+		providerConfig.Installed = report.installed
+	}
+
+	providers, providerErrs := initProviders(ctx, tfstate, shared.filter(), missingConfigs, providerConfig)
+
+	// providers upgraded due to resources with newer schema versions (see -auto-upgrade-provider)
+	var upgradedProviders []*provider.TerraformProvider
+
+	defer func() {
+		for name, p := range providers {
+			span := trace.Start(ctx, "provider", "close provider", map[string]interface{}{"name": name})
+			span.End(p.Close())
+		}
+
+		for _, p := range upgradedProviders {
+			span := trace.Start(ctx, "provider", "close provider",
+				map[string]interface{}{"name": p.Name(), "version": p.Version()})
+			span.End(p.Close())
+		}
+	}()
+
+	if ctx.Err() != nil {
+		return logInterrupted(0, 0)
+	}
+
+	providerFailures := providerFailures(tfstate, shared.filter(), providerErrs)
+	unsupportedProviders := unsupportedProviderResources(tfstate, shared.filter(), providers, providerErrs)
+
+	options := destroy.Options{
+		RDSTakeFinalSnapshot: f.rdsTakeFinalSnapshot,
+		KMSDeletionWindow:    f.kmsDeletionWindow,
+		Route53EmptyZones:    f.route53EmptyZones,
+		SecretsForceDelete:   f.secretsForceDelete,
+		DeleteLogGroups:      f.deleteLogGroups,
+		LogRetentionDays:     f.setLogRetention,
+		BeanstalkTimeout:     beanstalkTimeoutDuration,
+		DefaultDeleteTimeout: defaultDeleteTimeoutDuration,
+		BatchDeletes:         f.batchDeletes,
+		ExplainBlockers:      f.explainBlockers,
+		OwnerTag:             f.ownerTag,
+		LogSensitive:         f.logSensitive,
+		AWSSession:           awsSession,
+
+		S3BypassGovernanceRetention: f.waitForObjectLock,
+		NoForce:                     f.noForce,
+		Overrides:                   f.overrides,
+		NoRefresh:                   f.noRefresh,
+	}
+
+	events := logEvents{modules: newModuleSummary(), auxiliaries: &auxiliarySummary{}, deposed: &deposedSummary{}}
+	if f.ownerTag != "" {
+		events.owners = newOwnerSummary()
+	}
+
+	events.report = report
+
+	checkpoint := newCheckpoint(f.checkpointEvery, checkpointTimeoutDuration, f.report, report)
+
+	config := destroy.Config{
+		Providers:     providers,
+		Options:       options,
+		Parallel:      f.parallel,
+		Concurrency:   concurrency,
+		Events:        events,
+		OrderByModule: f.orderByModule,
+		OrderByCost:   f.orderBy == orderByCost,
+		GracePeriod:   gracePeriodDuration,
+		Skipped:       unsupportedProviders,
+		Checkpoint:    checkpoint.destroyCheckpoint(),
+		MaxRetries:    f.maxRetries,
+	}
+
+	if f.autoUpgradeProvider {
+		config.UpgradeProvider = func(ctx context.Context,
+			p *provider.TerraformProvider) (*provider.TerraformProvider, error) {
+			upgraded, err := provider.Upgrade(ctx, p, providerConfig)
+			if err != nil {
+				return nil, err
+			}
+
+			// called by destroy.Plan and destroy.PlanAndExecute sequentially, so no lock is needed
+			upgradedProviders = append(upgradedProviders, upgraded)
+
+			return upgraded, nil
+		}
+	}
+
+	// references of consumer states and caps per type must be checked (and the order shown or graph written) before
+	// anything is destroyed, nothing must be destroyed outside the deletion window, and reports written at checkpoints
+	// need the plan, so resources are only destroyed after the states of all resources have been updated
+	if f.force && !dryRun && f.checkConsumers == "" && len(caps) == 0 && !f.showOrder && f.graph == "" &&
+		window == nil && checkpoint == nil {
+		return runForcedDestroy(ctx, tfstate, shared.filter(), config, providerFailures, f, events.report)
+	}
+
+	span = trace.Start(ctx, "run", "plan", nil)
+	plan, err := destroy.Plan(ctx, tfstate, shared.filter(), config)
+	span.End(err)
+
+	if checkpoint != nil {
+		checkpoint.plan = plan
+	}
+
+	if err != nil && ctx.Err() != nil {
+		return logInterrupted(0, 0)
+	}
+
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ %s\n", err))
+
+		return 1
+	}
+
+	logSkippedResources(plan.Skipped)
+
+	if code, ok := applyTypeCaps(plan, caps, f.capBehavior); !ok {
+		return code
+	}
+
+	consumerReferences := destroy.FindConsumerReferences(plan, consumers)
+
+	if f.driftReport != "" {
+		err := writeDriftReport(f.driftReport, plan, tfstate)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to write drift report: %s\n", err))
+
+			return 1
+		}
+	}
+
+	if f.graph != "" {
+		err := writeGraph(f.graph, f.graphFormat, f.graphModule, plan)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to write graph: %s\n", err))
+
+			return 1
+		}
+	}
+
+	if shared.verify {
+		return verify(plan, addresses, pathToState, shared.verificationReport, providerFailures)
+	}
+
+	numOfSkippedResources := len(plan.Skipped)
+
+	if !f.force || dryRun {
+		internal.LogTitle("showing resources that would be deleted (dry run)")
+
+		// always show the resources that would be affected before deleting anything
+		var resources []listedResource
+
+		for _, c := range plan.Candidates {
+			resources = append(resources, listedResource{
+				ResourceInstance: state.ResourceInstance{
+					Address:  c.Address,
+					Type:     c.Type,
+					ID:       c.ID,
+					Provider: c.ProviderName,
+					Deposed:  c.Deposed,
+				},
+				details: c.Preview,
+			})
+		}
+
+		newInventory(resources).log(true)
+		logTypePolicy(shared)
+		logGlobalResources(plan.Candidates)
+		logProviderUpgrades(plan.Upgrades)
+
+		var auxiliaries []destroy.AuxiliaryDeletion
+
+		for _, c := range plan.Candidates {
+			auxiliaries = append(auxiliaries, c.Auxiliaries...)
+		}
+
+		logAuxiliaries("resources outside the state that would be deleted alongside", auxiliaries)
+
+		if f.inventoryCompare && dryRun {
+			compareInventory(ctx, tfstate, awsSession)
+		}
+
+		if len(plan.Candidates) == 0 {
+			if len(providerFailures) == 0 && len(plan.Unsupported) == 0 {
+				internal.LogTitle("all resources have already been deleted")
+			}
+
+			logNumOfSkippedResources(numOfSkippedResources)
+			logNumOfAlreadyGoneResources(len(plan.AlreadyGone))
+			logSkipReasons(plan)
+			logDeferredResources(plan)
+
+			if !printRunOutput(f.output, events.report, tfstate, plan, destroy.Result{}, dryRun) {
+				return 1
+			}
+
+			return withAllGone(exitCode(withUnsupportedTypes(withProviderFailures(destroy.Result{}, providerFailures),
+				plan.Unsupported)), plan, f.failIfAllGone)
+		}
+
+		internal.LogTitle(fmt.Sprintf("total number of resources that would be deleted: %d",
+			len(plan.Candidates)))
+		logNumOfSkippedResources(numOfSkippedResources)
+		logNumOfAlreadyGoneResources(len(plan.AlreadyGone))
+		logSkipReasons(plan)
+		logDeferredResources(plan)
+	}
+
+	if f.showOrder {
+		logOrder(plan.Order())
+	}
+
+	logConsumerReferences(consumerReferences)
+
+	if f.blockOnConsumers && len(consumerReferences) > 0 && !dryRun {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ not deleting anything, since %d resources that would be "+
+			"deleted are referenced by other states (see above)\n", referencedCandidates(consumerReferences)))
+
+		return 1
+	}
+
+	var simulated destroy.Result
+
+	if f.simulate {
+		span = trace.Start(ctx, "run", "simulate", nil)
+		simulations := destroy.Simulate(ctx, plan)
+		span.End(nil)
+
+		if ctx.Err() != nil {
+			return logInterrupted(0, numOfSkippedResources)
+		}
+
+		simulated = logSimulations(simulations)
+	}
+
+	if !dryRun {
+		confirmed, err := userConfirmedDeletion(ctx, f.force)
+		if err != nil && ctx.Err() != nil {
+			return logInterrupted(0, numOfSkippedResources)
+		}
+
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to read confirmation: %s\n", err))
+
+			return 1
+		}
+
+		if !confirmed {
+			return 0
+		}
+
+		windowCtx, closeWindow, err := waitForWindow(ctx, window)
+		if err != nil {
+			return logInterrupted(0, numOfSkippedResources)
+		}
+		defer closeWindow()
+
+		internal.LogTitle("Starting to delete resources")
+
+		span = trace.Start(ctx, "run", "destroy", nil)
+		result := destroy.Execute(windowCtx, plan)
+		span.End(nil)
+
+		var assertion *emptyAssertion
+
+		if f.assertEmpty && !result.Interrupted {
+			assertion, err = assertEmpty(ctx, tfstate, shared.filter(), config, providerFailures)
+			if err != nil {
+				fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to assert that all resources are gone: %s\n", err))
+
+				return 1
+			}
+
+			events.report.asserted(assertion)
+		}
+
+		if f.inventoryCompare && !result.Interrupted {
+			events.report.compared(compareInventory(ctx, tfstate, awsSession))
+		}
+
+		reportWritten := writeRunReport(f.report, events.report, plan, result)
+		outputPrinted := printRunOutput(f.output, events.report, tfstate, plan, result, false)
+
+		if result.Stopped {
+			return logStopped(result.Deleted, numOfSkippedResources)
+		}
+
+		if result.Interrupted && ctx.Err() == nil {
+			return logWindowClosed(result.Deleted, numOfSkippedResources)
+		}
+
+		if result.Interrupted {
+			return logInterrupted(result.Deleted, numOfSkippedResources)
+		}
+
+		result = withUnsupportedTypes(withProviderFailures(result, providerFailures), plan.Unsupported)
+
+		internal.LogTitle(fmt.Sprintf("total number of deleted resources: %d", result.Deleted))
+		logNumOfSkippedResources(numOfSkippedResources)
+		logNumOfAlreadyGoneResources(result.AlreadyGone)
+		logSkipReasons(plan)
+		logDeferredResources(plan)
+
+		code := withAllGone(withEmptyAssertion(exitCode(result), assertion), plan, f.failIfAllGone)
+		if code != 0 || (reportWritten && outputPrinted) {
+			return code
+		}
+
+		return 1
+	}
+
+	if !printRunOutput(f.output, events.report, tfstate, plan, destroy.Result{}, true) {
+		return 1
+	}
+
+	return exitCode(withUnsupportedTypes(withProviderFailures(simulated, providerFailures), plan.Unsupported))
+}
+
+// runForcedDestroy destroys the resources without showing them first, so that resources can already be destroyed
+// while the states of others are still being updated (see destroy.PlanAndExecute). Returns the exit code.
+func runForcedDestroy(ctx context.Context, tfstate *state.State, filter destroy.Filter, config destroy.Config,
+	providerFailures []destroy.RetryDestroyError, f destroyFlags, report *runReport) int {
+	internal.LogTitle("user will not be asked for confirmation (force mode)")
+	internal.LogTitle("Starting to delete resources")
+
+	span := trace.Start(ctx, "run", "plan and destroy", nil)
+	plan, result, err := destroy.PlanAndExecute(ctx, tfstate, filter, config)
+	span.End(err)
+
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ %s\n", err))
+
+		return 1
+	}
+
+	logSkippedResources(plan.Skipped)
+	logProviderUpgrades(plan.Upgrades)
+
+	// the report is written after the resources have been destroyed, since their states are updated while
+	// others are destroyed already
+	driftReportFailed := false
+
+	if f.driftReport != "" {
+		err := writeDriftReport(f.driftReport, plan, tfstate)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to write drift report: %s\n", err))
+
+			driftReportFailed = true
+		}
+	}
+
+	var assertion *emptyAssertion
+
+	if f.assertEmpty && !result.Interrupted {
+		assertion, err = assertEmpty(ctx, tfstate, filter, config, providerFailures)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to assert that all resources are gone: %s\n", err))
+
+			return 1
+		}
+
+		report.asserted(assertion)
+	}
+
+	if f.inventoryCompare && !result.Interrupted {
+		report.compared(compareInventory(ctx, tfstate, config.Options.AWSSession))
+	}
+
+	reportWritten := writeRunReport(f.report, report, plan, result)
+	outputPrinted := printRunOutput(f.output, report, tfstate, plan, result, false)
+
+	numOfSkippedResources := len(plan.Skipped)
+
+	if result.Interrupted {
+		return logInterrupted(result.Deleted, numOfSkippedResources)
+	}
+
+	result = withUnsupportedTypes(withProviderFailures(result, providerFailures), plan.Unsupported)
+
+	internal.LogTitle(fmt.Sprintf("total number of deleted resources: %d", result.Deleted))
+	logNumOfSkippedResources(numOfSkippedResources)
+	logNumOfAlreadyGoneResources(result.AlreadyGone)
+	logSkipReasons(plan)
+
+	code := withAllGone(withEmptyAssertion(exitCode(result), assertion), plan, f.failIfAllGone)
+
+	if code != 0 || (!driftReportFailed && reportWritten && outputPrinted) {
+		return code
+	}
+
+	return 1
+}
+
+// writeDriftReport writes a report of how the attributes of the planned resources recorded in the state
+// differ from their current ones to the file at the given path (see destroy.NewDriftReport), together with
+// the version of Terraform that has written the state and the compatibility table of terradozer.
+func writeDriftReport(path string, plan *destroy.DestroyPlan, tfstate *state.State) error {
+	report := destroy.NewDriftReport(plan)
+	report.TerraformVersion = tfstate.TerraformVersion()
+	report.Compatibility = provider.Compatibility()
+
+	result, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path, append(result, '\n'), 0600)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path":     path,
+		"compared": report.Compared,
+		"drifted":  len(report.Drifted),
+	}).Info(internal.Pad("wrote drift report"))
+
+	return nil
+}
+
+// initProviders initializes only the providers of the state that are needed to destroy the resources matching
+// the given filter, one by one, so that a provider that fails to be initialized only fails the resources that need it.
+// Providers with missing configuration, given with their errors, fail without being initialized.
+// Returns the initialized providers and the errors of the ones that failed.
+func initProviders(ctx context.Context, tfstate *state.State, filter destroy.Filter, missingConfigs map[string]error,
+	config provider.Config) (map[string]*provider.TerraformProvider, map[string]error) {
+	providers := map[string]*provider.TerraformProvider{}
+	providerErrs := map[string]error{}
+
+	needed := map[string]bool{}
+
+	var initialized, unsupported, skipped []string
+
+	for _, name := range tfstate.SelectedProviderNames(filter) {
+		needed[name] = true
+
+		if err, ok := missingConfigs[name]; ok {
+			providerErrs[name] = err
+
+			continue
+		}
+
+		p, err := provider.Init(ctx, name, config)
+		if err != nil && ctx.Err() != nil {
+			return providers, providerErrs
+		}
+
+		switch {
+		case err != nil:
+			fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to initialize Terraform provider %s: %s\n",
+				name, err))
+
+			providerErrs[name] = err
+		case p == nil:
+			unsupported = append(unsupported, name)
+		default:
+			providers[name] = p
+			initialized = append(initialized, name)
+		}
+	}
+
+	for _, name := range tfstate.ProviderNames() {
+		if !needed[name] {
+			skipped = append(skipped, name)
+		}
+	}
+
+	fields := log.Fields{"initialized": strings.Join(initialized, ",")}
+
+	if len(providerErrs) > 0 {
+		var failed []string
+
+		for name := range providerErrs {
+			failed = append(failed, name)
+		}
+
+		sort.Strings(failed)
+
+		fields["failed"] = strings.Join(failed, ",")
+	}
+
+	if len(unsupported) > 0 {
+		fields["unsupported"] = strings.Join(unsupported, ",")
+	}
+
+	if len(skipped) > 0 {
+		fields["skipped"] = strings.Join(skipped, ",")
+	}
+
+	log.WithFields(fields).Info(internal.Pad("providers"))
+
+	return providers, providerErrs
+}
+
+// providerFailures returns the errors of the resources matching the given filter whose provider failed
+// to be initialized.
+func providerFailures(tfstate *state.State, filter destroy.Filter,
+	providerErrs map[string]error) []destroy.RetryDestroyError {
+	if len(providerErrs) == 0 {
+		return nil
+	}
+
+	instances, err := tfstate.ResourceInstances()
+	if err != nil {
+		return nil
+	}
+
+	var result []destroy.RetryDestroyError
+
+	for _, instance := range instances {
+		providerErr, ok := providerErrs[instance.Provider]
+		if !ok {
+			continue
+		}
+
+		if filter != nil {
+			if matched, _ := filter.Match(candidateOf(instance)); !matched {
+				continue
+			}
+		}
+
+		r := resourceOf(instance)
+
+		result = append(result, *destroy.NewRetryDestroyError(
+			fmt.Errorf("failed to initialize provider %s: %s", instance.Provider, providerErr), r))
+	}
+
+	return result
+}
+
+// unsupportedProviderResources returns the resources matching the given filter whose provider is neither one of
+// the given initialized providers nor failed to be initialized, i.e., isn't supported by terradozer.
+func unsupportedProviderResources(tfstate *state.State, filter destroy.Filter,
+	providers map[string]*provider.TerraformProvider, providerErrs map[string]error) []destroy.SkippedResource {
+	instances, err := tfstate.ResourceInstances()
+	if err != nil {
+		return nil
+	}
+
+	var result []destroy.SkippedResource
+
+	for _, instance := range instances {
+		if _, ok := providers[instance.Provider]; ok {
+			continue
+		}
+
+		if _, ok := providerErrs[instance.Provider]; ok {
+			continue
+		}
+
+		if filter != nil {
+			if matched, _ := filter.Match(candidateOf(instance)); !matched {
+				continue
+			}
+		}
+
+		result = append(result, destroy.SkippedResource{
+			Resource: resourceOf(instance),
+			Reason:   destroy.SkipReasonUnsupportedProvider,
+		})
+	}
+
+	return result
+}
+
+// withProviderFailures logs the resources that failed as their provider couldn't be initialized
+// and adds them to the given result.
+func withProviderFailures(result destroy.Result, failures []destroy.RetryDestroyError) destroy.Result {
+	logFailedResources("provider failed to initialize", failures)
+
+	result.Failed = append(result.Failed, failures...)
+
+	return result
+}
+
+// logSimulations logs the outcome of the simulated delete of each resource (see destroy.Simulate), followed by
+// the number of resources per outcome. Returns the simulated deletes that failed (to determine the exit code).
+func logSimulations(simulations []destroy.Simulation) destroy.Result {
+	internal.LogTitle("simulating deletions (dry run calls of the delete APIs; nothing is deleted)")
+
+	counts := map[destroy.SimulationOutcome]int{}
+
+	var result destroy.Result
+
+	for _, s := range simulations {
+		counts[s.Outcome]++
+
+		entry := log.WithFields(log.Fields{
+			"id":      s.Resource.ID(),
+			"outcome": s.Outcome,
+		})
+
+		switch s.Outcome {
+		case destroy.SimulationWouldFail:
+			entry.WithError(s.Err).WithField("reason", s.Err.Class).Warn(internal.Pad(s.Resource.Type()))
+
+			result.Failed = append(result.Failed, *s.Err)
+		default:
+			entry.Info(internal.Pad(s.Resource.Type()))
+		}
+	}
+
+	internal.LogTitle("total number of simulated deletions")
+
+	for _, o := range []destroy.SimulationOutcome{destroy.SimulationWouldSucceed, destroy.SimulationWouldFail,
+		destroy.SimulationNotSupported} {
+		log.WithField("count", counts[o]).Info(internal.Pad(string(o)))
+	}
+
+	return result
+}
+
+// withUnsupportedTypes logs the resources that can't be destroyed as their type isn't supported by their provider
+// (see destroy.UnsupportedTypeError) and adds them to the failed resources of the given result.
+func withUnsupportedTypes(result destroy.Result, unsupported []destroy.RetryDestroyError) destroy.Result {
+	logFailedResources(destroy.ErrorClassUnsupportedType.String(), unsupported)
+
+	result.Failed = append(result.Failed, unsupported...)
+
+	return result
+}
+
+// newSession returns the AWS session to destroy resources with; with provider stubs, requests of the session
+// fail without touching any cloud.
+func newSession(awsConfig provider.AWSConfig, stubbed bool) (*session.Session, error) {
+	if !stubbed {
+		return awsConfig.NewSession()
+	}
+
+	region := awsConfig.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return provider.NewStubSession(region)
+}
+
+// resourceTypes returns the types of the managed resources in the given state.
+func resourceTypes(tfstate *state.State) []string {
+	instances, _ := tfstate.ResourceInstances()
+
+	seen := map[string]bool{}
+
+	var result []string
+
+	for _, instance := range instances {
+		if !seen[instance.Type] {
+			seen[instance.Type] = true
+			result = append(result, instance.Type)
+		}
+	}
+
+	return result
+}
+
+// readLockFile reads the dependency lock file at the given path, or the one in the working directory
+// (e.g., the one given via -chdir) if the path is empty. Returns nil if there is no lock file.
+func readLockFile(path string) (map[string]provider.LockedProvider, error) {
+	if path == "" {
+		if _, err := os.Stat(provider.LockFileName); err != nil {
+			return nil, nil
+		}
+
+		path = provider.LockFileName
+	}
+
+	locked, err := provider.ReadLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, p := range locked {
+		log.WithFields(log.Fields{"file": path, "name": name, "version": p.Version, "hashes": len(p.Hashes)}).
+			Info(internal.Pad("using provider of lock file"))
+	}
+
+	return locked, nil
+}
+
+// readConsumers reads the given consumer states (see -check-consumers).
+func readConsumers(paths []string) ([]destroy.Consumer, error) {
+	var result []destroy.Consumer
+
+	if len(paths) > 0 {
+		internal.LogTitle("reading consumer states")
+	}
+
+	for _, path := range paths {
+		consumerState, err := state.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read consumer state %s: %s", path, err)
+		}
+
+		consumers := consumerState.Consumers()
+
+		for i := range consumers {
+			consumers[i].State = path
+		}
+
+		log.WithFields(log.Fields{"file": path, "resources": len(consumers)}).Info(internal.Pad("using consumer state"))
+
+		result = append(result, consumers...)
+	}
+
+	return result, nil
+}
+
+// readStateDiff compares the given state with the new state at the given path (see -diff) and logs the resources
+// that have been moved. Returns nil if no path is given.
+func readStateDiff(tfstate *state.State, path string) (*destroy.StateDiff, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	newState, err := state.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read new state %s: %s", path, err)
+	}
+
+	oldInstances, err := tfstate.ResourceInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	newInstances, err := newState.ResourceInstances()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read new state %s: %s", path, err)
+	}
+
+	diff := destroy.NewStateDiff(candidatesOf(oldInstances), candidatesOf(newInstances))
+
+	logStateDiff(path, diff)
+
+	return diff, nil
+}
+
+// candidatesOf returns the given resource instances as candidates of filters.
+func candidatesOf(instances []state.ResourceInstance) []destroy.ResourceCandidate {
+	var result []destroy.ResourceCandidate
+
+	for _, instance := range instances {
+		result = append(result, candidateOf(instance))
+	}
+
+	return result
+}
+
+// candidateOf returns the given resource instance as a candidate of filters.
+func candidateOf(instance state.ResourceInstance) destroy.ResourceCandidate {
+	return destroy.ResourceCandidate{
+		Address: instance.Address,
+		Type:    instance.Type,
+		ID:      instance.ID,
+		Deposed: instance.Deposed,
+	}
+}
+
+// resourceOf returns the given resource instance as a resource without provider and state
+// (e.g., to report it as failed or skipped).
+func resourceOf(instance state.ResourceInstance) *destroy.Resource {
+	r := destroy.NewWithState(instance.Address, instance.Type, instance.ID, nil, nil, nil)
+	r.Deposed = instance.Deposed
+
+	return r
+}
+
+// logStateDiff logs the number of orphans of the comparison with the new state at the given path, followed by
+// the resources that have been moved (so that the matching by type and ID can be confirmed).
+func logStateDiff(path string, diff *destroy.StateDiff) {
+	internal.LogTitle("comparing with new state")
+	log.WithFields(log.Fields{
+		"file":     path,
+		"orphaned": len(diff.Orphaned),
+		"moved":    len(diff.Moved),
+	}).Info(internal.Pad("only destroying resources absent from the new state"))
+
+	if len(diff.Moved) == 0 {
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("moved, not orphaned (not destroyed): %d", len(diff.Moved)))
+
+	for _, m := range diff.Moved {
+		log.WithFields(log.Fields{
+			"id":   m.ID,
+			"from": m.From,
+			"to":   m.To,
+		}).Info(internal.Pad(m.Type))
+	}
+}
+
+// compatible returns true if the state has been written by a version of Terraform that terradozer supports
+// (see internal.CheckCompatibility); otherwise, the error is printed, or (if force is set) logged as warning
+// and true is returned.
+func compatible(tfstate *state.State, force bool) bool {
+	err := internal.CheckCompatibility(tfstate.TerraformVersion(), provider.Compatibility())
+	if err == nil {
+		return true
+	}
+
+	if force {
+		log.WithError(err).Warn(internal.Pad("reading state anyway (-force-compat)"))
+
+		return true
+	}
+
+	fmt.Fprint(os.Stderr, color.RedString("Error:️ %s (set -force-compat to read the state anyway)\n", err))
+
+	return false
+}
+
+// logUsingState logs the path to the state file (or its URL), which is resolved to an absolute path if it is relative
+// (e.g., to the working directory given via -chdir).
+func logUsingState(path string) {
+	if state.IsRemote(path) {
+		log.WithField("url", state.RedactLocation(path)).Info(internal.Pad("using state"))
+
+		return
+	}
+
+	entry := log.WithField("file", path)
+
+	if absPath, err := filepath.Abs(path); err == nil && absPath != path {
+		entry = entry.WithField("resolved", absPath)
+	}
+
+	entry.Info(internal.Pad("using state"))
+}
+
+// warnUnmatchedIncludes warns about the given patterns of -include that match none of the resources of the state,
+// which are most likely typos (rather than silently destroying nothing).
+func warnUnmatchedIncludes(tfstate *state.State, patterns []string) {
+	if len(patterns) == 0 {
+		return
+	}
+
+	instances, err := tfstate.ResourceInstances()
+	if err != nil {
+		return
+	}
+
+	for _, pattern := range destroy.UnmatchedPatterns(patterns, candidatesOf(instances)) {
+		log.WithField("pattern", pattern).Warn(internal.Pad("pattern of -include matches no resource of the state"))
+	}
+}
+
+// logAdoption logs how many resources have been adopted from a file of resource IDs and the rows
+// that couldn't be read.
+func logAdoption(path string, adoption state.Adoption) {
+	log.WithFields(log.Fields{
+		"file":       path,
+		"resources":  adoption.Resources,
+		"duplicates": adoption.Duplicates,
+		"malformed":  len(adoption.Errors),
+	}).Info(internal.Pad("adopting resources listed by ID"))
+
+	if len(adoption.Errors) == 0 {
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("malformed rows in file of resource IDs (ignored): %d", len(adoption.Errors)))
+
+	for _, rowErr := range adoption.Errors {
+		log.WithError(rowErr.Err).WithFields(log.Fields{
+			"row":     rowErr.Row,
+			"content": rowErr.Content,
+		}).Warn(internal.Pad("malformed row"))
+	}
+}
+
+// versionInfo is the version information of this build shown by -version -output json.
+type versionInfo struct {
+	internal.VersionInfo
+	// Binaries are the plugin binaries of the providers installed by previous runs (see provider.InstalledBinaries).
+	Binaries []provider.Binary `json:"installed_providers,omitempty"`
+}
+
+// printVersion prints the version information in the given output format (text or json); the json output also lists
+// the providers installed by previous runs.
+func printVersion(output string) int {
+	switch output {
+	case "text":
+		fmt.Println(internal.BuildVersionString(provider.DefaultVersions(), provider.Compatibility()))
+	case "json":
+		binaries, err := provider.InstalledBinaries(installDir, nil)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error: failed to list installed providers: %s\n", err))
+
+			return 1
+		}
+
+		return printJSON(versionInfo{
+			VersionInfo: internal.BuildVersionInfo(provider.DefaultVersions(), provider.Compatibility()),
+			Binaries:    binaries,
+		})
+	default:
+		fmt.Fprint(os.Stderr, color.RedString("Error: unsupported -output format: %s (expected text or json)\n", output))
+
+		return 1
+	}
+
+	return 0
+}
+
+// exitCode returns the exit code for the result of destroying resources,
+// which is 0 if no resource failed to be destroyed.
+func exitCode(result destroy.Result) int {
+	if len(result.Failed) == 0 {
+		return 0
+	}
+
+	code := exitCodeResourcesFailed
+
+	for _, err := range result.Failed {
+		switch err.Class {
+		case destroy.ErrorClassCredentialsExpired:
+			return exitCodeCredentialsExpired
+		case destroy.ErrorClassPermissionDenied:
+			code = exitCodePermissionDenied
+		}
+	}
+
+	return code
+}
+
+// logSkippedResources logs the resources that are not destroyed, as they didn't match a filter
+// (or their provider isn't supported).
+func logSkippedResources(skipped []destroy.SkippedResource) {
+	for _, s := range skipped {
+		log.WithFields(log.Fields{
+			"type":        s.Resource.Type(),
+			"id":          s.Resource.ID(),
+			"reason":      s.Reason.Description(),
+			"skip_reason": s.Reason,
+		}).Info(internal.Pad("skipping resource"))
+	}
+}
+
+// userConfirmedDeletion asks the user to confirm the deletion (unless forced).
+// Returns the error of the context if it is done before the user has answered, and an error if stdin isn't
+// a terminal, so that piped input (e.g., in CI) never confirms a deletion by accident.
+func userConfirmedDeletion(ctx context.Context, force bool) (bool, error) {
+	if !force && !stdinIsTerminal() {
+		return false, fmt.Errorf("stdin isn't a terminal (use -force to destroy without confirmation)")
+	}
+
+	return userConfirmed(ctx, func(stdin io.Reader) (bool, error) {
+		return internal.UserConfirmedDeletion(stdin, force)
+	})
+}
+
+// stdinIsTerminal returns true if stdin is a terminal. While the daemon runs a request, it's replaced by whether
+// the stdin of the client is one (see isolate).
+var stdinIsTerminal = func() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// userConfirmed reads the answer to a question (see internal.UserConfirmed) from stdin,
+// but stops waiting for it once the context is done.
+func userConfirmed(ctx context.Context, ask func(stdin io.Reader) (bool, error)) (bool, error) {
+	type answer struct {
+		confirmed bool
+		err       error
+	}
+
+	answers := make(chan answer, 1)
+
+	stdin := os.Stdin
+
+	go func() {
+		confirmed, err := ask(stdin)
+		answers <- answer{confirmed, err}
+	}()
+
+	select {
+	case a := <-answers:
+		return a.confirmed, a.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// logInterrupted logs the summary of an interrupted run and returns the exit code.
+func logInterrupted(numOfDeletedResources int, numOfSkippedResources int) int {
+	internal.LogTitle(fmt.Sprintf("interrupted (total number of deleted resources: %d)", numOfDeletedResources))
+	logNumOfSkippedResources(numOfSkippedResources)
+
+	return exitCodeInterrupted
+}
+
+func logNumOfSkippedResources(numOfSkippedResources int) {
+	if numOfSkippedResources > 0 {
+		internal.LogTitle(fmt.Sprintf("total number of skipped resources: %d", numOfSkippedResources))
+	}
+}
+
+func logNumOfAlreadyGoneResources(numOfAlreadyGoneResources int) {
+	if numOfAlreadyGoneResources > 0 {
+		internal.LogTitle(fmt.Sprintf("total number of resources that were already gone: %d",
+			numOfAlreadyGoneResources))
+	}
+}
+
+// logSkipReasons logs the number of resources of the given plan that are not destroyed by the reason why
+// (see destroy.DestroyPlan.SkipReasons).
+func logSkipReasons(plan *destroy.DestroyPlan) {
+	reasons := plan.SkipReasons()
+	if len(reasons) == 0 {
+		return
+	}
+
+	counts := map[string]int{}
+
+	for reason, n := range reasons {
+		counts[string(reason)] = n
+	}
+
+	internal.LogTitle("number of resources not destroyed by skip reason")
+	logCounts(counts)
+}
+
+// allGone returns true if the state has resources to destroy, but none of them exists anymore
+// (i.e., the state is entirely stale).
+func allGone(plan *destroy.DestroyPlan) bool {
+	return len(plan.AlreadyGone) > 0 && len(plan.Candidates) == 0 && len(plan.Gone) == 0 &&
+		len(plan.Unsupported) == 0
+}
+
+// withAllGone returns exitCodeAllGone instead of the given exit code of a successful run with the given plan,
+// if failIfAllGone is set and all resources of the state didn't exist anymore (see -fail-if-all-gone).
+func withAllGone(code int, plan *destroy.DestroyPlan, failIfAllGone bool) int {
+	if code == 0 && failIfAllGone && allGone(plan) {
+		return exitCodeAllGone
+	}
+
+	return code
+}
+
+// validLogRetention returns true if the retention of CloudWatch log groups can be set to the given number of days.
+func validLogRetention(days int) bool {
+	for _, d := range destroy.ValidLogRetentionDays {
+		if d == days {
+			return true
+		}
+	}
+
+	return false
+}
+
+func printHelp(fs *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "\n"+strings.TrimSpace(help)+"\n")
+
+	width := 0
+
+	for _, cmd := range commands() {
+		if !cmd.hidden && len(cmd.name) > width {
+			width = len(cmd.name)
+		}
+	}
+
+	for _, cmd := range commands() {
+		if cmd.hidden {
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "  %-*s %s\n", width+1, cmd.name, cmd.description)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nFLAGS:\n")
+	printDefaults(fs)
+	fmt.Fprintf(os.Stderr, "\nRun 'terradozer <command> -h' to see the flags of a command.\n")
+	fmt.Println()
+}
+
+func printCommandHelp(name string, fs *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "\n"+strings.TrimSpace(fmt.Sprintf(commandHelp, name, commandUsage(name)))+"\n")
+	printDefaults(fs)
+	fmt.Println()
+}
+
+const help = `
+Terraform destroy using only the state - no *.tf files needed.
+
+USAGE:
+  $ terradozer [flags] <command> [command flags]
+
+COMMANDS:
+`
+
+const commandHelp = `
 Terraform destroy using only the state - no *.tf files needed.
 
 USAGE:
-  $ terradozer [flags] <path/to/terraform.tfstate>
+  $ terradozer %s %s
 
 FLAGS:
 `
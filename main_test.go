@@ -0,0 +1,1143 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	goHomeDir "github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// fakeProvider is an in-memory provider whose resources have only an id and a cidr_block attribute.
+type fakeProvider struct {
+	mu        sync.Mutex
+	deleted   []string
+	destroyed map[string]bool
+}
+
+func (p *fakeProvider) Configure(providers.ConfigureRequest) providers.ConfigureResponse {
+	return providers.ConfigureResponse{}
+}
+
+func (p *fakeProvider) GetSchema() providers.GetSchemaResponse {
+	block := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id":         {Type: cty.String, Computed: true},
+			"cidr_block": {Type: cty.String, Optional: true},
+		},
+	}
+
+	return providers.GetSchemaResponse{
+		Provider: providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{
+			"aws_vpc":        {Block: block},
+			"random_integer": {Block: block},
+		},
+	}
+}
+
+func (p *fakeProvider) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.destroyed[req.PriorState.GetAttr("id").AsString()] {
+		return providers.ReadResourceResponse{NewState: cty.NullVal(req.PriorState.Type())}
+	}
+
+	return providers.ReadResourceResponse{NewState: req.PriorState}
+}
+
+func (p *fakeProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := req.PriorState.GetAttr("id").AsString()
+	p.destroyed[id] = true
+	p.deleted = append(p.deleted, req.TypeName+"."+id)
+
+	return providers.ApplyResourceChangeResponse{NewState: cty.NullVal(cty.DynamicPseudoType)}
+}
+
+func (p *fakeProvider) ImportResourceState(
+	req providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	return providers.ImportResourceStateResponse{}
+}
+
+func (p *fakeProvider) Stop() error {
+	return nil
+}
+
+func (p *fakeProvider) Close() error {
+	return nil
+}
+
+func TestMainExitCode_FakeProviders(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	fakes := map[string]*fakeProvider{}
+
+	factory := func(name, version string) (provider.Provider, error) {
+		p := &fakeProvider{destroyed: map[string]bool{}}
+		fakes[name] = p
+
+		return p, nil
+	}
+
+	actualExitCode := mainExitCode(
+		[]string{"destroy", "-force", "-state", "test/test-fixtures/tfstates/fake-providers.tfstate"}, factory)
+
+	assert.Equal(t, 0, actualExitCode)
+
+	var actualProviderNames []string
+
+	for name := range fakes {
+		actualProviderNames = append(actualProviderNames, name)
+	}
+
+	sort.Strings(actualProviderNames)
+
+	require.Equal(t, []string{"aws", "random"}, actualProviderNames)
+	assert.Equal(t, []string{"aws_vpc.vpc-039b3d3fb4ffcf0ea"}, fakes["aws"].deleted)
+	assert.Equal(t, []string{"random_integer.12375"}, fakes["random"].deleted)
+}
+
+func TestMainExitCode_ConfirmationWithoutTerminal(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	// piped input must not confirm the deletion
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	_, err = w.WriteString("YES\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	stdin := os.Stdin
+	os.Stdin = r
+
+	defer func() {
+		os.Stdin = stdin
+	}()
+
+	var fakes []*fakeProvider
+
+	factory := func(name, version string) (provider.Provider, error) {
+		p := &fakeProvider{destroyed: map[string]bool{}}
+		fakes = append(fakes, p)
+
+		return p, nil
+	}
+
+	actualExitCode := mainExitCode(
+		[]string{"destroy", "-state", "test/test-fixtures/tfstates/fake-providers.tfstate"}, factory)
+
+	assert.Equal(t, 1, actualExitCode)
+
+	for _, p := range fakes {
+		assert.Empty(t, p.deleted)
+	}
+}
+
+// captureStdout returns what the given function prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	output := make(chan string)
+
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		output <- string(b)
+	}()
+
+	f()
+
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+
+	return <-output
+}
+
+func TestMainExitCode_OutputJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected runOutput
+	}{
+		{
+			name: "dry run",
+			args: []string{"plan", "-exclude", "random_integer"},
+			expected: runOutput{
+				DryRun: true,
+				Region: "us-west-2",
+				Resources: []runOutputResource{
+					{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea", Provider: "aws",
+						Action: actionWouldDelete},
+					{Address: "random_integer.test", Type: "random_integer", ID: "12375", Provider: "random",
+						Action: actionSkipped, SkipReason: destroy.SkipReasonExcludedPattern},
+				},
+				Totals: map[resourceAction]int{actionWouldDelete: 1, actionSkipped: 1},
+			},
+		},
+		{
+			name: "destroy",
+			args: []string{"destroy", "-force", "-exclude", "random_integer"},
+			expected: runOutput{
+				Region: "us-west-2",
+				Resources: []runOutputResource{
+					{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea", Provider: "aws",
+						Action: actionDeleted},
+					{Address: "random_integer.test", Type: "random_integer", ID: "12375", Provider: "random",
+						Action: actionSkipped, SkipReason: destroy.SkipReasonExcludedPattern},
+				},
+				Totals: map[resourceAction]int{actionDeleted: 1, actionSkipped: 1},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "test")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return &fakeProvider{destroyed: map[string]bool{}}, nil
+			}
+
+			var actualExitCode int
+
+			stdout := captureStdout(t, func() {
+				actualExitCode = mainExitCode(append(tc.args, "-output", "json",
+					"test/test-fixtures/tfstates/fake-providers.tfstate"), factory)
+			})
+			require.Equal(t, 0, actualExitCode)
+
+			var actual runOutput
+
+			require.NoError(t, json.Unmarshal([]byte(stdout), &actual), stdout)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestMainExitCode_Deposed(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	p := &fakeProvider{destroyed: map[string]bool{}}
+
+	factory := func(name, version string) (provider.Provider, error) {
+		return p, nil
+	}
+
+	var actualExitCode int
+
+	stdout := captureStdout(t, func() {
+		actualExitCode = mainExitCode([]string{"destroy", "-force", "-output", "json",
+			"test/test-fixtures/tfstates/deposed.tfstate"}, factory)
+	})
+	require.Equal(t, 0, actualExitCode)
+
+	// the current and the deposed objects of a resource instance are destroyed independently
+	assert.ElementsMatch(t, []string{"aws_vpc.vpc-current", "aws_vpc.vpc-deposed-1", "aws_vpc.vpc-deposed-2",
+		"aws_vpc.vpc-replaced"}, p.deleted)
+
+	var actual runOutput
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &actual), stdout)
+
+	var actualDeposed []string
+
+	for _, r := range actual.Resources {
+		assert.Equal(t, actionDeleted, r.Action)
+
+		actualDeposed = append(actualDeposed, r.ID+":"+r.Deposed)
+	}
+
+	assert.ElementsMatch(t, []string{"vpc-replaced:00000003", "vpc-current:", "vpc-deposed-1:00000001",
+		"vpc-deposed-2:00000002"}, actualDeposed)
+}
+
+func TestMainExitCode_AdoptAndDestroy(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		expectedDeleted map[string][]string
+	}{
+		{
+			name: "destroy",
+			args: []string{"-force"},
+			expectedDeleted: map[string][]string{
+				"aws":    {"aws_vpc.vpc-1", "aws_vpc.vpc-2"},
+				"random": {"random_integer.12375"},
+			},
+		},
+		{
+			name:            "dry run",
+			args:            []string{"-dry-run", "-force"},
+			expectedDeleted: map[string][]string{"aws": nil, "random": nil},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "test")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			fakes := map[string]*fakeProvider{}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				p := &fakeProvider{destroyed: map[string]bool{}}
+				fakes[name] = p
+
+				return p, nil
+			}
+
+			args := append([]string{adoptCommand, "-parallel", "1"}, tc.args...)
+
+			actualExitCode := mainExitCode(append(args, "-ids", "test/test-fixtures/ids/ids.csv"), factory)
+			require.Equal(t, 0, actualExitCode)
+
+			actualDeleted := map[string][]string{}
+
+			for name, p := range fakes {
+				actualDeleted[name] = p.deleted
+			}
+
+			assert.Equal(t, tc.expectedDeleted, actualDeleted)
+		})
+	}
+}
+
+func TestMainExitCode_DriftReport(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	factory := func(name, version string) (provider.Provider, error) {
+		return &fakeProvider{destroyed: map[string]bool{}}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "drift.json")
+
+	actualExitCode := mainExitCode([]string{"plan", "-drift-report", path,
+		"test/test-fixtures/tfstates/fake-providers.tfstate"}, factory)
+	require.Equal(t, 0, actualExitCode)
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var report destroy.DriftReport
+
+	require.NoError(t, json.Unmarshal(b, &report))
+
+	assert.Equal(t, destroy.DriftReport{
+		Compared: 1,
+		// the schema version of the fake provider's VPCs differs from the one in the state
+		NotCompared:      []string{"aws_vpc.test"},
+		Drifted:          []destroy.ResourceDrift{},
+		TerraformVersion: "0.12.18",
+		Compatibility:    provider.Compatibility(),
+	}, report)
+}
+
+func TestMainExitCode_TraceFile(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	factory := func(name, version string) (provider.Provider, error) {
+		return &fakeProvider{destroyed: map[string]bool{}}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+
+	actualExitCode := mainExitCode([]string{"destroy", "-force", "-trace-file", path,
+		"test/test-fixtures/tfstates/fake-providers.tfstate"}, factory)
+	require.Equal(t, 0, actualExitCode)
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var events []struct {
+		Name string                 `json:"name"`
+		Args map[string]interface{} `json:"args"`
+	}
+
+	require.NoError(t, json.Unmarshal(b, &events))
+
+	var actualSpans []string
+
+	for _, e := range events {
+		switch e.Name {
+		case "thread_name":
+			continue
+		case "start provider", "configure provider", "close provider":
+			actualSpans = append(actualSpans, e.Name+" "+e.Args["name"].(string))
+		default:
+			if address, ok := e.Args["address"]; ok {
+				actualSpans = append(actualSpans, e.Name+" "+address.(string))
+			} else {
+				actualSpans = append(actualSpans, e.Name)
+			}
+		}
+	}
+
+	sort.Strings(actualSpans)
+
+	assert.Equal(t, []string{
+		"apply aws_vpc.test",
+		"apply random_integer.test",
+		"close provider aws",
+		"close provider random",
+		"configure provider aws",
+		"configure provider random",
+		"destroy aws_vpc.test",
+		"destroy random_integer.test",
+		// the fake provider imports nothing, so that the resource is read without import
+		"import aws_vpc.test",
+		"plan and destroy",
+		"read aws_vpc.test",
+		"read random_integer.test",
+		"read state",
+		"start provider aws",
+		"start provider random",
+		"wait for concurrency aws_vpc.test",
+		"wait for concurrency random_integer.test",
+	}, actualSpans)
+}
+
+func TestMainExitCode_ProviderStub(t *testing.T) {
+	tests := []struct {
+		name             string
+		stub             string
+		expectedExitCode int
+	}{
+		{
+			name: "destroy",
+			stub: "latency=1ms",
+		},
+		{
+			name:             "all resources fail",
+			stub:             "fail-rate=1",
+			expectedExitCode: exitCodeResourcesFailed,
+		},
+		{
+			name:             "invalid config",
+			stub:             "fail-rate=high",
+			expectedExitCode: exitCodeUsage,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := func(name, version string) (provider.Provider, error) {
+				t.Fatalf("unexpected start of provider: %s", name)
+
+				return nil, nil
+			}
+
+			actualExitCode := mainExitCode([]string{"destroy", "-force", "-provider-stub", tc.stub,
+				"test/test-fixtures/tfstates/multiple-providers.tfstate"}, factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+		})
+	}
+}
+
+func TestMainExitCode_Simulate(t *testing.T) {
+	factory := func(name, version string) (provider.Provider, error) {
+		t.Fatalf("unexpected start of provider: %s", name)
+
+		return nil, nil
+	}
+
+	// the AWS API isn't available with provider stubs, so the simulated delete of the VPC fails
+	// (and the VPC isn't destroyed, although the run is forced)
+	actualExitCode := mainExitCode([]string{"destroy", "-force", "-simulate", "-provider-stub", "latency=1ms",
+		"test/test-fixtures/tfstates/multiple-providers.tfstate"}, factory)
+
+	assert.Equal(t, exitCodeResourcesFailed, actualExitCode)
+}
+
+func TestMainExitCode_LazyProviders(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	tests := []struct {
+		name                  string
+		args                  []string
+		failingProvider       string
+		expectedExitCode      int
+		expectedProviderNames []string
+		expectedDeleted       []string
+	}{
+		{
+			name:                  "provider of skipped resources not started",
+			args:                  []string{"-protected-types", "random_integer"},
+			expectedProviderNames: []string{"aws"},
+			expectedDeleted:       []string{"aws_vpc.vpc-039b3d3fb4ffcf0ea"},
+		},
+		{
+			name:                  "failing provider fails only its resources",
+			failingProvider:       "random",
+			expectedExitCode:      exitCodeResourcesFailed,
+			expectedProviderNames: []string{"aws"},
+			expectedDeleted:       []string{"aws_vpc.vpc-039b3d3fb4ffcf0ea"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fakes := map[string]*fakeProvider{}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				if name == tc.failingProvider {
+					return nil, fmt.Errorf("failed to start provider")
+				}
+
+				p := &fakeProvider{destroyed: map[string]bool{}}
+				fakes[name] = p
+
+				return p, nil
+			}
+
+			args := append([]string{"destroy", "-force"}, tc.args...)
+
+			actualExitCode := mainExitCode(append(args, "test/test-fixtures/tfstates/fake-providers.tfstate"), factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+
+			var actualProviderNames []string
+
+			for name := range fakes {
+				actualProviderNames = append(actualProviderNames, name)
+			}
+
+			require.Equal(t, tc.expectedProviderNames, actualProviderNames)
+			assert.Equal(t, tc.expectedDeleted, fakes["aws"].deleted)
+		})
+	}
+}
+
+func TestMainExitCode_SkipReasons(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	allowList := filepath.Join(t.TempDir(), "types.txt")
+	require.NoError(t, ioutil.WriteFile(allowList, []byte("aws_vpc\n"), 0600))
+
+	tests := []struct {
+		name                string
+		args                []string
+		unsupportedProvider string
+		expectedSkipped     []reportedResource
+	}{
+		{
+			name:                "unsupported provider",
+			unsupportedProvider: "random",
+			expectedSkipped: []reportedResource{{Address: "random_integer.test", Type: "random_integer", ID: "12375",
+				SkipReason: destroy.SkipReasonUnsupportedProvider}},
+		},
+		{
+			name: "protected type",
+			args: []string{"-protected-types", "aws_vpc"},
+			expectedSkipped: []reportedResource{{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea",
+				SkipReason: destroy.SkipReasonProtectedType}},
+		},
+		{
+			name: "not allow-listed",
+			args: []string{"-allow-only-types", allowList},
+			expectedSkipped: []reportedResource{{Address: "random_integer.test", Type: "random_integer", ID: "12375",
+				SkipReason: destroy.SkipReasonNotAllowListed}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := func(name, version string) (provider.Provider, error) {
+				if name == tc.unsupportedProvider {
+					return nil, nil
+				}
+
+				return &fakeProvider{destroyed: map[string]bool{}}, nil
+			}
+
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+
+			args := append([]string{"destroy", "-force", "-report", reportPath}, tc.args...)
+
+			actualExitCode := mainExitCode(append(args, "test/test-fixtures/tfstates/fake-providers.tfstate"), factory)
+			require.Equal(t, 0, actualExitCode)
+
+			report, err := readRunReport(reportPath)
+			require.NoError(t, err)
+
+			assert.Len(t, report.Deleted, 1)
+			assert.Equal(t, tc.expectedSkipped, report.Skipped)
+		})
+	}
+}
+
+// undeadProvider is a fake provider whose destroys succeed without destroying anything.
+type undeadProvider struct {
+	*fakeProvider
+}
+
+func (p undeadProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	return providers.ApplyResourceChangeResponse{NewState: cty.NullVal(cty.DynamicPseudoType)}
+}
+
+func TestMainExitCode_AssertEmpty(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	tests := []struct {
+		name              string
+		args              []string
+		undead            bool
+		expectedExitCode  int
+		expectedSurvivors []reportedResource
+	}{
+		{
+			name: "forced",
+		},
+		{
+			name: "planned",
+			args: []string{"-show-order"},
+		},
+		{
+			name:             "survivors",
+			undead:           true,
+			expectedExitCode: exitCodeNotEmpty,
+			expectedSurvivors: []reportedResource{
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea"},
+				{Address: "random_integer.test", Type: "random_integer", ID: "12375"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeProvider{destroyed: map[string]bool{}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				if tc.undead {
+					return undeadProvider{fake}, nil
+				}
+
+				return fake, nil
+			}
+
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+
+			args := append([]string{"destroy", "-force", "-assert-empty", "-report", reportPath}, tc.args...)
+
+			actualExitCode := mainExitCode(append(args, "test/test-fixtures/tfstates/fake-providers.tfstate"), factory)
+			require.Equal(t, tc.expectedExitCode, actualExitCode)
+
+			report, err := readRunReport(reportPath)
+			require.NoError(t, err)
+
+			require.NotNil(t, report.Assertion)
+			assert.Equal(t, tc.expectedSurvivors == nil, report.Assertion.Passed)
+			assert.Equal(t, append([]reportedResource{}, tc.expectedSurvivors...), report.Assertion.Survivors)
+		})
+	}
+}
+
+func TestMainExitCode_PlanWithFakeProviders(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	fake := &fakeProvider{destroyed: map[string]bool{}}
+
+	factory := func(name, version string) (provider.Provider, error) {
+		return fake, nil
+	}
+
+	actualExitCode := mainExitCode([]string{"plan", "test/test-fixtures/tfstates/fake-providers.tfstate"}, factory)
+
+	assert.Equal(t, 0, actualExitCode)
+	assert.Empty(t, fake.deleted)
+}
+
+func TestMainExitCode_RemoteState(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	server := httptest.NewServer(http.FileServer(http.Dir("test/test-fixtures/tfstates")))
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		url              string
+		expectedExitCode int
+		expectedDeleted  []string
+	}{
+		{
+			name:            "state",
+			url:             server.URL + "/fake-providers.tfstate",
+			expectedDeleted: []string{"aws_vpc.vpc-039b3d3fb4ffcf0ea", "random_integer.12375"},
+		},
+		{
+			name:             "state doesn't exist",
+			url:              server.URL + "/not-exist.tfstate",
+			expectedExitCode: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeProvider{destroyed: map[string]bool{}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return fake, nil
+			}
+
+			actualExitCode := mainExitCode([]string{"destroy", "-force", "-state", tc.url}, factory)
+			require.Equal(t, tc.expectedExitCode, actualExitCode)
+
+			assert.ElementsMatch(t, tc.expectedDeleted, fake.deleted)
+		})
+	}
+}
+
+func TestMainExitCode_FailIfAllGone(t *testing.T) {
+	graphPath := filepath.Join(t.TempDir(), "graph.dot")
+
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+	}{
+		{
+			name: "plan",
+			args: []string{"plan"},
+		},
+		{
+			name:             "plan with fail-if-all-gone",
+			args:             []string{"plan", "-fail-if-all-gone"},
+			expectedExitCode: exitCodeAllGone,
+		},
+		{
+			name:             "forced destroy with fail-if-all-gone",
+			args:             []string{"destroy", "-force", "-fail-if-all-gone"},
+			expectedExitCode: exitCodeAllGone,
+		},
+		{
+			name:             "forced destroy with fail-if-all-gone and show-order",
+			args:             []string{"destroy", "-force", "-fail-if-all-gone", "-show-order"},
+			expectedExitCode: exitCodeAllGone,
+		},
+		{
+			name:             "forced destroy with fail-if-all-gone and graph",
+			args:             []string{"destroy", "-force", "-fail-if-all-gone", "-graph", graphPath},
+			expectedExitCode: exitCodeAllGone,
+		},
+		{
+			name:             "forced destroy with fail-if-all-gone and window",
+			args:             []string{"destroy", "-force", "-fail-if-all-gone", "-window", "00:00-23:59"},
+			expectedExitCode: exitCodeAllGone,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "test")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			fake := &fakeProvider{destroyed: map[string]bool{"vpc-039b3d3fb4ffcf0ea": true, "12375": true}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return fake, nil
+			}
+
+			actualExitCode := mainExitCode(append(tc.args, "test/test-fixtures/tfstates/fake-providers.tfstate"),
+				factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+			assert.Empty(t, fake.deleted)
+		})
+	}
+}
+
+func TestMainExitCode_WithoutProviders(t *testing.T) {
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+	}{
+		{
+			name:             "no command",
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "unknown command",
+			args:             []string{"foo"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "missing state",
+			args:             []string{"list"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name: "list",
+			args: []string{"list", "-state", "test/test-fixtures/tfstates/multiple-providers.tfstate"},
+		},
+		{
+			name: "list as JSON",
+			args: []string{"list", "-output", "json", "test/test-fixtures/tfstates/multiple-providers.tfstate"},
+		},
+		{
+			name: "list as CSV",
+			args: []string{"list", "-output", "csv", "test/test-fixtures/tfstates/missing-id.tfstate"},
+		},
+		{
+			name:             "providers as CSV",
+			args:             []string{"providers", "-output", "csv", "test/test-fixtures/tfstates/multiple-providers.tfstate"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "list with unsupported output",
+			args:             []string{"list", "-output", "yaml", "test/test-fixtures/tfstates/multiple-providers.tfstate"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "typo in flag",
+			args:             []string{"list", "-stat", "test/test-fixtures/tfstates/multiple-providers.tfstate"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "state file doesn't exist",
+			args:             []string{"plan", "-state", "test/test-fixtures/tfstates/foo.tfstate"},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name: "help",
+			args: []string{"destroy", "-h"},
+		},
+		{
+			name: "providers",
+			args: []string{"providers", "-state", "test/test-fixtures/tfstates/multiple-providers.tfstate"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := func(name, version string) (provider.Provider, error) {
+				t.Fatalf("unexpected start of provider: %s", name)
+
+				return nil, nil
+			}
+
+			actualExitCode := mainExitCode(tc.args, factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+		})
+	}
+}
+
+func TestMainExitCode_Validate(t *testing.T) {
+	tests := []struct {
+		name             string
+		args             []string
+		providers        []string
+		expectedExitCode int
+	}{
+		{
+			name:      "all resources deletable",
+			args:      []string{"validate", "test/test-fixtures/tfstates/fake-providers.tfstate"},
+			providers: []string{"aws", "random"},
+		},
+		{
+			name:             "unsupported provider",
+			args:             []string{"validate", "test/test-fixtures/tfstates/fake-providers.tfstate"},
+			providers:        []string{"aws"},
+			expectedExitCode: exitCodeUnsupported,
+		},
+		{
+			name: "resource of unsupported provider is protected",
+			args: []string{"validate", "-protected-types", "random_integer", "-output", "json",
+				"test/test-fixtures/tfstates/fake-providers.tfstate"},
+			providers: []string{"aws"},
+		},
+		{
+			name:             "unknown resource type",
+			args:             []string{"validate", "test/test-fixtures/tfstates/missing-id.tfstate"},
+			providers:        []string{"aws"},
+			expectedExitCode: exitCodeUnsupported,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := func(name, version string) (provider.Provider, error) {
+				for _, p := range tc.providers {
+					if p == name {
+						return &fakeProvider{destroyed: map[string]bool{}}, nil
+					}
+				}
+
+				return nil, nil
+			}
+
+			actualExitCode := mainExitCode(tc.args, factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+		})
+	}
+}
+
+func TestMainExitCode_Chdir(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, os.Chdir(wd))
+	})
+
+	// the config file in the directory changed to has an unknown key
+	dir := filepath.Dir(writeConfigFile(t, "foo: bar\n"))
+
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+	}{
+		{
+			name: "relative state path",
+			args: []string{"-chdir", "test/test-fixtures/tfstates", "list", "multiple-providers.tfstate"},
+		},
+		{
+			name: "config file of directory changed to",
+			args: []string{"-chdir", dir, "list",
+				filepath.Join(wd, "test/test-fixtures/tfstates/multiple-providers.tfstate")},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "directory doesn't exist",
+			args:             []string{"-chdir", filepath.Join(dir, "foo"), "list", "multiple-providers.tfstate"},
+			expectedExitCode: exitCodeUsage,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, os.Chdir(wd))
+
+			actualExitCode := mainExitCode(tc.args, nil)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+		})
+	}
+}
+
+func TestMainExitCode_ProvidersLockFile(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, os.Chdir(wd))
+		goHomeDir.Reset()
+	})
+
+	// the install directory (~/.terradozer) has a fake binary of the AWS provider
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	goHomeDir.Reset()
+
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".terradozer"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, ".terradozer", "terraform-provider-aws_v3.42.0_x5"),
+		[]byte("fake provider"), 0600))
+
+	tests := []struct {
+		name             string
+		hash             string
+		expectedExitCode int
+	}{
+		{
+			name: "binary matches lock file",
+			hash: "h1:TM3OYsCTHsJXGUHJoQkG0SzBkmkEUx0Ej/g+O7lrYvY=",
+		},
+		{
+			name:             "binary doesn't match lock file",
+			hash:             "h1:rKYu5ZUbXwrLG1w81k7H3nce/Ys6yAxXhWcbtk36HjY=",
+			expectedExitCode: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, provider.LockFileName), []byte(fmt.Sprintf(
+				"provider \"registry.terraform.io/hashicorp/aws\" {\n  version = \"3.42.0\"\n  hashes = [\"%s\"]\n}\n",
+				tc.hash)), 0600))
+
+			for _, output := range []string{"text", "json"} {
+				actualExitCode := mainExitCode([]string{"-chdir", dir, "providers", "-output", output,
+					filepath.Join(wd, "test/test-fixtures/tfstates/fake-providers.tfstate")}, nil)
+
+				assert.Equal(t, tc.expectedExitCode, actualExitCode, output)
+			}
+		})
+	}
+}
+
+func TestSplitAddresses(t *testing.T) {
+	tests := []struct {
+		name              string
+		list              string
+		expectedAddresses []string
+	}{
+		{
+			name:              "plain addresses",
+			list:              "aws_vpc.test, module.vpc.aws_vpc.shared ,",
+			expectedAddresses: []string{"aws_vpc.test", "module.vpc.aws_vpc.shared"},
+		},
+		{
+			name:              "commas within instance keys",
+			list:              `aws_s3_bucket_object.file["a,b"],aws_instance.web[0]`,
+			expectedAddresses: []string{`aws_s3_bucket_object.file["a,b"]`, "aws_instance.web[0]"},
+		},
+		{
+			name:              "escaped quote within instance key",
+			list:              `aws_s3_bucket_object.file["say \"hi,\""],aws_vpc.test`,
+			expectedAddresses: []string{`aws_s3_bucket_object.file["say \"hi,\""]`, "aws_vpc.test"},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedAddresses, splitAddresses(tc.list))
+		})
+	}
+}
+
+func TestAddressPatternsFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	var patterns addressPatternsFlag
+
+	fs.Var(&patterns, "no-force", "")
+
+	err := fs.Parse([]string{"-no-force", `aws_s3_bucket.logs["caf\u00e9"]`,
+		"-no-force", "module.*.aws_s3_bucket.audit[?], aws_iam_role.ci"})
+	require.NoError(t, err)
+
+	assert.Equal(t, addressPatternsFlag{`aws_s3_bucket.logs["café"]`, "module.*.aws_s3_bucket.audit[?]",
+		"aws_iam_role.ci"}, patterns)
+
+	assert.Error(t, fs.Parse([]string{"-no-force", "aws_s3_bucket"}))
+}
+
+func TestResourcePatternsFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	var patterns resourcePatternsFlag
+
+	fs.Var(&patterns, "include", "")
+
+	err := fs.Parse([]string{"-include", "aws_instance,module.staging", "-include", `module.env["d\u0065v"]`,
+		"-include", `aws_s3_bucket.logs["caf\u00e9"], aws_ebs_volume.data*`})
+	require.NoError(t, err)
+
+	assert.Equal(t, resourcePatternsFlag{"aws_instance", "module.staging", `module.env["dev"]`,
+		`aws_s3_bucket.logs["café"]`, "aws_ebs_volume.data*"}, patterns)
+
+	assert.Error(t, fs.Parse([]string{"-include", "module."}))
+}
+
+func TestOverridesFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	var overrides overridesFlag
+
+	fs.Var(&overrides, "override", "")
+
+	err := fs.Parse([]string{"-override", "aws_db_instance:deletion_protection=false,skip_final_snapshot=true",
+		"-override", `aws_lb:subnets=["subnet-1","subnet-2"]`})
+	require.NoError(t, err)
+
+	assert.Equal(t, overridesFlag{
+		{Type: "aws_db_instance", Attrs: map[string]string{"deletion_protection": "false", "skip_final_snapshot": "true"}},
+		{Type: "aws_lb", Attrs: map[string]string{"subnets": `["subnet-1","subnet-2"]`}},
+	}, overrides)
+
+	for _, invalid := range []string{"aws_lb", "aws_lb:", "aws_lb:=false", "aws_lb.test:enabled=false"} {
+		assert.Error(t, fs.Parse([]string{"-override", invalid}), invalid)
+	}
+}
+
+func TestMainExitCode_Compatibility(t *testing.T) {
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+	}{
+		{
+			name:             "plan",
+			args:             []string{"plan"},
+			expectedExitCode: 1,
+		},
+		{
+			name:             "list",
+			args:             []string{"list"},
+			expectedExitCode: 1,
+		},
+		{
+			name: "plan with force-compat",
+			args: []string{"plan", "-force-compat"},
+		},
+		{
+			name: "list with force-compat",
+			args: []string{"list", "-force-compat"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "test")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return &fakeProvider{destroyed: map[string]bool{}}, nil
+			}
+
+			actualExitCode := mainExitCode(append(tc.args, "test/test-fixtures/tfstates/terraform-1.5.tfstate"),
+				factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+)
+
+// orderByCost is the value of the -order-by flag to destroy the most expensive resources first.
+const orderByCost = "cost"
+
+// logOrder logs the resources in the order in which they would be deleted, with their groups of resources
+// that are deleted in parallel and their estimated monthly costs (if known), plus the total of these costs.
+func logOrder(ordered []destroy.OrderedResource) {
+	internal.LogTitle("order in which resources would be deleted")
+
+	total := 0.0
+
+	for _, r := range ordered {
+		fields := log.Fields{
+			"group":        r.Group,
+			"type":         r.Type,
+			"id":           r.ID,
+			"monthly_cost": "unknown",
+		}
+
+		if r.Priced {
+			fields["monthly_cost"] = formatCost(r.MonthlyCost)
+			total += r.MonthlyCost
+		}
+
+		log.WithFields(fields).Info(internal.Pad(r.Address))
+	}
+
+	internal.LogTitle(fmt.Sprintf("estimated monthly cost of resources that would be deleted: %s", formatCost(total)))
+}
+
+// formatCost returns the given cost in USD.
+func formatCost(cost float64) string {
+	return fmt.Sprintf("$%.2f", cost)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainExitCode_OrderByCost(t *testing.T) {
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+		expectedDeleted  int
+	}{
+		{
+			name: "plan showing order",
+			args: []string{"plan", "-order-by", "cost", "-show-order"},
+		},
+		{
+			name:            "forced destroy by cost",
+			args:            []string{"destroy", "-force", "-order-by", "cost"},
+			expectedDeleted: 2,
+		},
+		{
+			name:            "forced destroy showing order",
+			args:            []string{"destroy", "-force", "-show-order"},
+			expectedDeleted: 2,
+		},
+		{
+			name:             "unknown order",
+			args:             []string{"plan", "-order-by", "name"},
+			expectedExitCode: exitCodeUsage,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "test")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			t.Setenv("AWS_REGION", "us-west-2")
+
+			fake := &fakeProvider{destroyed: map[string]bool{}}
+
+			factory := func(name, version string) (provider.Provider, error) {
+				return fake, nil
+			}
+
+			actualExitCode := mainExitCode(append(tc.args, "test/test-fixtures/tfstates/fake-providers.tfstate"),
+				factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+			assert.Len(t, fake.deleted, tc.expectedDeleted)
+		})
+	}
+}
+
+func TestFormatCost(t *testing.T) {
+	assert.Equal(t, "$32.85", formatCost(32.85))
+	assert.Equal(t, "$0.00", formatCost(0))
+}
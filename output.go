@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/state"
+)
+
+// resourceAction is what a run has done (or would do) with a resource listed by -output json.
+type resourceAction string
+
+const (
+	// actionWouldDelete means that the resource would be deleted (dry run).
+	actionWouldDelete resourceAction = "would-delete"
+	actionDeleted     resourceAction = "deleted"
+	// actionFailed means that the resource failed to be deleted (see runOutputResource.Error).
+	actionFailed resourceAction = "failed"
+	// actionSkipped means that the resource has been skipped (see runOutputResource.SkipReason).
+	actionSkipped resourceAction = "skipped"
+	// actionSkippedNotFound means that the resource has been skipped, as it doesn't exist anymore.
+	actionSkippedNotFound resourceAction = "skipped-not-found"
+	// actionDeferred means that the resource hasn't been deleted, as the cap of its type has been exceeded
+	// (see -cap-behavior trim).
+	actionDeferred resourceAction = "deferred"
+	// actionRemaining means that the resource hasn't been processed, as the run has been interrupted.
+	actionRemaining resourceAction = "remaining"
+)
+
+// runOutput is the document that the plan and destroy commands print to stdout with -output json, which lists
+// every resource instance considered by the run together with the action taken.
+type runOutput struct {
+	DryRun bool   `json:"dry_run"`
+	Region string `json:"region,omitempty"`
+	// Interrupted is true if the run has been interrupted before all resources have been processed.
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Resources are ordered by address.
+	Resources []runOutputResource `json:"resources"`
+	// Totals are the numbers of resources by action.
+	Totals map[resourceAction]int `json:"totals"`
+}
+
+// runOutputResource is a resource listed by -output json.
+type runOutputResource struct {
+	Address  string         `json:"address,omitempty"`
+	Type     string         `json:"type"`
+	ID       string         `json:"id"`
+	Provider string         `json:"provider,omitempty"`
+	Action   resourceAction `json:"action"`
+	// Deposed is the key of the deposed object of the resource instance at Address (empty if it's the current
+	// object).
+	Deposed string `json:"deposed,omitempty"`
+	// SkipReason is why the resource has been skipped (empty if it hasn't been).
+	SkipReason destroy.SkipReason `json:"skip_reason,omitempty"`
+	// Error is why the resource failed to be deleted (or its state to be updated; empty otherwise).
+	Error string `json:"error,omitempty"`
+}
+
+// newRunOutput returns the output of a run with the given plan and result, whose deleted resources have been
+// added to the given report. The resources of a dry run are listed as the ones that would be deleted.
+func newRunOutput(report *runReport, tfstate *state.State, plan *destroy.DestroyPlan, result destroy.Result,
+	dryRun bool) runOutput {
+	report.complete(plan, result)
+
+	providers := map[string]string{}
+
+	if instances, err := tfstate.ResourceInstances(); err == nil {
+		for _, instance := range instances {
+			providers[instance.Address] = instance.Provider
+		}
+	}
+
+	output := runOutput{
+		DryRun:      dryRun,
+		Region:      report.Region,
+		Interrupted: result.Interrupted,
+		Resources:   []runOutputResource{},
+		Totals:      map[resourceAction]int{},
+	}
+
+	add := func(action resourceAction, resources []reportedResource) {
+		for _, r := range resources {
+			output.Resources = append(output.Resources, runOutputResource{
+				Address:    r.Address,
+				Type:       r.Type,
+				ID:         r.ID,
+				Deposed:    r.Deposed,
+				Provider:   providers[r.Address],
+				Action:     action,
+				SkipReason: r.SkipReason,
+				Error:      r.Error,
+			})
+			output.Totals[action]++
+		}
+	}
+
+	if dryRun {
+		var candidates []reportedResource
+
+		for _, c := range plan.Candidates {
+			candidates = append(candidates, reportedResource{Address: c.Address, Type: c.Type, ID: c.ID,
+				Deposed: c.Deposed})
+		}
+
+		add(actionWouldDelete, candidates)
+	}
+
+	add(actionDeleted, report.Deleted)
+	add(actionFailed, report.Failed)
+
+	for _, skipped := range report.Skipped {
+		action := actionSkipped
+		if skipped.SkipReason == destroy.SkipReasonAlreadyGone {
+			action = actionSkippedNotFound
+		}
+
+		add(action, []reportedResource{skipped})
+	}
+
+	add(actionDeferred, report.Deferred)
+	add(actionRemaining, report.Remaining)
+
+	sort.SliceStable(output.Resources, func(i, j int) bool {
+		return output.Resources[i].Address < output.Resources[j].Address
+	})
+
+	return output
+}
+
+// printRunOutput prints the output of a run with the given plan and result to stdout, if requested by
+// -output json (see newRunOutput). Returns false if printing the output failed.
+func printRunOutput(format string, report *runReport, tfstate *state.State, plan *destroy.DestroyPlan,
+	result destroy.Result, dryRun bool) bool {
+	if format != "json" {
+		return true
+	}
+
+	return printJSON(newRunOutput(report, tfstate, plan, result, dryRun)) == 0
+}
@@ -0,0 +1,203 @@
+package destroy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// update changes the given attributes of a resource in the cloud (e.g., to disable it before it
+// can be destroyed) and returns the new state of the resource. The update is planned by the provider first
+// (see provider.Planner), with the state with the changed attributes as configuration.
+func (r Resource) update(ctx context.Context, attrs map[string]cty.Value, timeout time.Duration) (cty.Value, error) {
+	if r.State() == nil {
+		return cty.NilVal, fmt.Errorf("resource state is nil; need to call update first")
+	}
+
+	priorState, _ := unmarkDeep(*r.State())
+	config, _ := unmarkDeep(withAttrs(*r.State(), attrs))
+
+	plannedState, plannedPrivate, err := r.provider.PlanUpdate(ctx, r.Type(), priorState, config)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("failed to plan update: %w", err)
+	}
+
+	return r.apply(ctx, providers.ApplyResourceChangeRequest{
+		TypeName:       r.Type(),
+		PriorState:     priorState,
+		PlannedState:   plannedState,
+		Config:         config,
+		PlannedPrivate: plannedPrivate,
+	}, "update", timeout)
+}
+
+// destroyWithTimeout destroys a resource, waiting for the given amount of time (instead of the provider's default
+// timeout) for the destroy to finish. The timeout is also passed to the provider, which otherwise stops waiting
+// for the deletion of the resource in the cloud after its default delete timeout.
+func (r Resource) destroyWithTimeout(ctx context.Context, state cty.Value, timeout time.Duration) error {
+	private, err := deleteTimeoutPrivate(timeout)
+	if err != nil {
+		return err
+	}
+
+	if !r.ForceDestroyDisabled() {
+		state = enableForceDestroyAttributes(state)
+	}
+
+	_, err = r.apply(ctx, providers.ApplyResourceChangeRequest{
+		TypeName:       r.Type(),
+		PriorState:     state,
+		PlannedState:   cty.NullVal(cty.DynamicPseudoType),
+		Config:         cty.NullVal(cty.DynamicPseudoType),
+		PlannedPrivate: private,
+	}, "destroy", timeout)
+
+	return err
+}
+
+// deleteTimeoutPrivate returns the provider's private data of a planned change,
+// which sets the delete timeout of a resource (the same as a "timeouts" block in a configuration).
+func deleteTimeoutPrivate(timeout time.Duration) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		schema.TimeoutKey: map[string]interface{}{
+			schema.TimeoutDelete: timeout.Nanoseconds(),
+		},
+	})
+}
+
+// apply applies a change to a resource and waits for the given amount of time for the change to finish.
+// If the context is done before, the provider is asked to halt the change and the change is abandoned.
+// Marks of the values of the change are removed, as they can't be sent to the provider.
+func (r Resource) apply(ctx context.Context, req providers.ApplyResourceChangeRequest, operation string,
+	timeout time.Duration) (cty.Value, error) {
+	req.PriorState, _ = unmarkDeep(req.PriorState)
+	req.PlannedState, _ = unmarkDeep(req.PlannedState)
+	req.Config, _ = unmarkDeep(req.Config)
+
+	result := make(chan providers.ApplyResourceChangeResponse, 1)
+
+	go func() {
+		result <- r.provider.ApplyResourceChange(req)
+	}()
+
+	start := time.Now()
+	deadline := time.After(timeout)
+
+	progress := time.NewTicker(progressInterval)
+	defer progress.Stop()
+
+	for {
+		select {
+		case response := <-result:
+			if response.Diagnostics.HasErrors() {
+				return cty.NilVal, provider.NewDiagnosticsError(response.Diagnostics)
+			}
+
+			return response.NewState, nil
+		case <-progress.C:
+			log.WithFields(log.Fields{
+				"id": r.ID(), "type": r.Type(), "operation": operation,
+				"elapsed": time.Since(start).Round(time.Second)}).Info(internal.Pad("still in progress"))
+		case <-deadline:
+			return cty.NilVal, fmt.Errorf("%s timed out (%s)", operation, timeout)
+		case <-ctx.Done():
+			if err := r.provider.Stop(); err != nil {
+				log.WithError(err).Debug(internal.Pad("failed to stop in-flight operations of provider"))
+			}
+
+			return cty.NilVal, ctx.Err()
+		}
+	}
+}
+
+// waitFor polls the current state of a resource until the given condition is true
+// or the given timeout is exceeded. The state passed to the condition is null if the resource doesn't exist.
+func (r Resource) waitFor(ctx context.Context, condition func(state cty.Value) (bool, string),
+	timeout time.Duration) (err error) {
+	span := startSpan(ctx, r, "wait")
+	defer func() { span.End(err) }()
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		currentState, err := r.provider.ReadResource(ctx, r.Type(), *r.State())
+		if err != nil {
+			return err
+		}
+
+		done, status := condition(currentState)
+		if done {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("waiting timed out (%s)", timeout)
+		}
+
+		log.WithFields(log.Fields{
+			"id": r.ID(), "type": r.Type(), "status": status}).Info(internal.Pad("waiting for resource"))
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// withAttrs returns a copy of the given state where the given attributes are set to new values
+// (keeping the marks of the other values).
+func withAttrs(state cty.Value, attrs map[string]cty.Value) cty.Value {
+	return withoutMarks(state, func(state cty.Value) cty.Value {
+		if state.IsNull() || !state.CanIterateElements() {
+			return state
+		}
+
+		result := state.AsValueMap()
+
+		for k, v := range attrs {
+			if _, ok := result[k]; ok {
+				result[k], _ = unmarkDeep(v)
+			}
+		}
+
+		return cty.ObjectVal(result)
+	})
+}
+
+// enableForceDestroyAttributes sets force destroy attributes of a resource to true
+// to be able to successfully delete some resources
+// (eg. a non-empty S3 bucket or a AWS IAM role with attached policies).
+//
+// copied from github.com/jckuester/awstools-lib/terraform/provider/provider.go
+func enableForceDestroyAttributes(state cty.Value) cty.Value {
+	return withoutMarks(state, func(state cty.Value) cty.Value {
+		stateWithDestroyAttrs := map[string]cty.Value{}
+
+		if state.IsNull() {
+			return state
+		}
+
+		if state.CanIterateElements() {
+			for k, v := range state.AsValueMap() {
+				if k == "force_detach_policies" || k == "force_destroy" {
+					if v.Type().Equals(cty.Bool) {
+						stateWithDestroyAttrs[k] = cty.True
+					}
+				} else {
+					stateWithDestroyAttrs[k] = v
+				}
+			}
+		}
+
+		return cty.ObjectVal(stateWithDestroyAttrs)
+	})
+}
@@ -0,0 +1,29 @@
+package destroy
+
+import (
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ARN returns the parsed Amazon Resource Name of a resource, which is read from its "arn" attribute
+// in the state or, if not present, from its ID (some resources are identified by their ARN).
+//
+// ARNs of all partitions are supported (e.g., "aws", "aws-us-gov", or "aws-cn"). The region and account ID
+// of an ARN are empty for global resources, such as IAM roles.
+func (r Resource) ARN() (arn.ARN, bool) {
+	if state := r.State(); state != nil && !state.IsNull() && state.Type().IsObjectType() &&
+		state.Type().HasAttribute("arn") {
+		v := state.GetAttr("arn")
+		if v.IsKnown() && !v.IsNull() && v.Type() == cty.String {
+			if parsed, err := arn.Parse(v.AsString()); err == nil {
+				return parsed, true
+			}
+		}
+	}
+
+	if parsed, err := arn.Parse(r.ID()); err == nil {
+		return parsed, true
+	}
+
+	return arn.ARN{}, false
+}
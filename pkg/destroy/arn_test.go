@@ -0,0 +1,90 @@
+package destroy_test
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestResource_ARN(t *testing.T) {
+	tests := []struct {
+		name            string
+		id              string
+		arn             string
+		expectOK        bool
+		expectPartition string
+		expectRegion    string
+		expectAccountID string
+	}{
+		{
+			name:            "standard partition",
+			id:              "vpc-123",
+			arn:             "arn:aws:ec2:us-east-1:123456789012:vpc/vpc-123",
+			expectOK:        true,
+			expectPartition: "aws",
+			expectRegion:    "us-east-1",
+			expectAccountID: "123456789012",
+		},
+		{
+			name:            "GovCloud partition",
+			id:              "vpc-123",
+			arn:             "arn:aws-us-gov:ec2:us-gov-west-1:123456789012:vpc/vpc-123",
+			expectOK:        true,
+			expectPartition: "aws-us-gov",
+			expectRegion:    "us-gov-west-1",
+			expectAccountID: "123456789012",
+		},
+		{
+			name:            "China partition",
+			id:              "vpc-123",
+			arn:             "arn:aws-cn:ec2:cn-north-1:123456789012:vpc/vpc-123",
+			expectOK:        true,
+			expectPartition: "aws-cn",
+			expectRegion:    "cn-north-1",
+			expectAccountID: "123456789012",
+		},
+		{
+			name:            "global resource in GovCloud partition",
+			id:              "my-role",
+			arn:             "arn:aws-us-gov:iam::123456789012:role/my-role",
+			expectOK:        true,
+			expectPartition: "aws-us-gov",
+			expectAccountID: "123456789012",
+		},
+		{
+			name:            "ARN as ID",
+			id:              "arn:aws-cn:secretsmanager:cn-northwest-1:123456789012:secret:my-secret-AbCdEf",
+			expectOK:        true,
+			expectPartition: "aws-cn",
+			expectRegion:    "cn-northwest-1",
+			expectAccountID: "123456789012",
+		},
+		{
+			name: "no ARN",
+			id:   "vpc-123",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs := map[string]cty.Value{"id": cty.StringVal(tc.id)}
+			if tc.arn != "" {
+				attrs["arn"] = cty.StringVal(tc.arn)
+			}
+
+			state := cty.ObjectVal(attrs)
+
+			r := destroy.NewWithState("aws_test.test", "aws_test", tc.id, nil, nil, &state)
+
+			actualARN, ok := r.ARN()
+			require.Equal(t, tc.expectOK, ok)
+
+			assert.Equal(t, tc.expectPartition, actualARN.Partition)
+			assert.Equal(t, tc.expectRegion, actualARN.Region)
+			assert.Equal(t, tc.expectAccountID, actualARN.AccountID)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// AuxiliaryOutcome tells what happened to an auxiliary resource (see AuxiliaryDeletion).
+type AuxiliaryOutcome string
+
+const (
+	// AuxiliaryDeleted means that the auxiliary resource has been deleted.
+	AuxiliaryDeleted AuxiliaryOutcome = "deleted"
+	// AuxiliaryFailed means that the auxiliary resource failed to be deleted.
+	AuxiliaryFailed AuxiliaryOutcome = "failed"
+	// AuxiliaryWouldBeDeleted means that the auxiliary resource would be deleted (dry run).
+	AuxiliaryWouldBeDeleted AuxiliaryOutcome = "would be deleted"
+)
+
+const (
+	// auxiliaryRecordSet is the type of record sets deleted before a hosted zone.
+	auxiliaryRecordSet = "route53 record set"
+	// auxiliarySecretReplica is the type of replicas removed before a secret.
+	auxiliarySecretReplica = "secret replica"
+	// auxiliaryLogGroup is the type of log groups deleted after the resource that created them implicitly.
+	auxiliaryLogGroup = "cloudwatch log group"
+	// auxiliaryLogGroupRetention is the type of log groups whose retention is set (instead of deleting them)
+	// after the resource that created them implicitly.
+	auxiliaryLogGroupRetention = "cloudwatch log group retention"
+)
+
+// AuxiliaryDeletion is the deletion of a resource that isn't part of the state, but is deleted alongside
+// a resource of the state (e.g., a record set created by external-dns, which is deleted before its hosted zone).
+type AuxiliaryDeletion struct {
+	// Parent is the address of the resource the auxiliary resource is deleted alongside.
+	Parent string
+	// Type is the kind of the auxiliary resource (e.g., route53 record set).
+	Type string
+	// ID identifies the auxiliary resource (e.g., the name and type of a record set).
+	ID      string
+	Outcome AuxiliaryOutcome
+	// Err is the reason why the deletion failed.
+	Err error
+}
+
+// auxiliaryEventsKey is the context key of the events receiving auxiliary deletions.
+type auxiliaryEventsKey struct{}
+
+// withAuxiliaryEvents returns a context whose auxiliary deletions are reported to the given events
+// (see ReportAuxiliary).
+func withAuxiliaryEvents(ctx context.Context, events Events) context.Context {
+	return context.WithValue(ctx, auxiliaryEventsKey{}, events)
+}
+
+// ReportAuxiliary reports the deletion of an auxiliary resource to the events of the given context (if any),
+// e.g., by the step of a TypeHandler.
+func ReportAuxiliary(ctx context.Context, d AuxiliaryDeletion) {
+	if events, ok := ctx.Value(auxiliaryEventsKey{}).(Events); ok {
+		events.AuxiliaryDeleted(d)
+	}
+}
+
+// PredictAuxiliaries lists the resources that aren't part of the state, but would be deleted alongside
+// the resource (e.g., the record sets of a hosted zone) by the handlers that apply to it (see AuxiliaryPredictor),
+// including its sub-resources (see SubResource).
+func (r Resource) PredictAuxiliaries(ctx context.Context) ([]AuxiliaryDeletion, error) {
+	result := r.predictSubResources()
+
+	for _, h := range r.handlers() {
+		predictor, ok := h.(AuxiliaryPredictor)
+		if !ok {
+			continue
+		}
+
+		auxiliaries, err := predictor.PredictAuxiliaries(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, auxiliaries...)
+	}
+
+	return result, nil
+}
+
+// newAuxiliaryDeletion returns the deletion of an auxiliary resource of the resource.
+func (r Resource) newAuxiliaryDeletion(auxType, id string, err error) AuxiliaryDeletion {
+	d := AuxiliaryDeletion{Parent: r.Address(), Type: auxType, ID: id, Outcome: AuxiliaryDeleted}
+
+	if err != nil {
+		d.Outcome = AuxiliaryFailed
+		d.Err = err
+	}
+
+	return d
+}
+
+// recordSetID returns how a record set is identified as an auxiliary resource (e.g., www.example.com. CNAME).
+func recordSetID(recordSet *route53.ResourceRecordSet) string {
+	id := fmt.Sprintf("%s %s", aws.StringValue(recordSet.Name), aws.StringValue(recordSet.Type))
+
+	if recordSet.SetIdentifier != nil {
+		id += " " + aws.StringValue(recordSet.SetIdentifier)
+	}
+
+	return id
+}
+
+// predictRoute53RecordSets lists the record sets that would be deleted before a hosted zone.
+func (r Resource) predictRoute53RecordSets(ctx context.Context) ([]AuxiliaryDeletion, error) {
+	recordSets, err := r.route53RecordSetsToDelete(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []AuxiliaryDeletion
+
+	for _, recordSet := range recordSets {
+		result = append(result, AuxiliaryDeletion{Parent: r.Address(), Type: auxiliaryRecordSet,
+			ID: recordSetID(recordSet), Outcome: AuxiliaryWouldBeDeleted})
+	}
+
+	return result, nil
+}
+
+// predictSecretReplicas lists the replicas that would be removed before a secret.
+func (r Resource) predictSecretReplicas(ctx context.Context) ([]AuxiliaryDeletion, error) {
+	if r.Options.AWSSession == nil {
+		return nil, fmt.Errorf("AWS session to list replicas of secret is not configured")
+	}
+
+	secret, err := secretsmanager.New(r.Options.AWSSession).DescribeSecretWithContext(ctx,
+		&secretsmanager.DescribeSecretInput{SecretId: aws.String(r.ID())})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe secret: %s", err)
+	}
+
+	var result []AuxiliaryDeletion
+
+	for _, replica := range secret.ReplicationStatus {
+		result = append(result, AuxiliaryDeletion{Parent: r.Address(), Type: auxiliarySecretReplica,
+			ID: aws.StringValue(replica.Region), Outcome: AuxiliaryWouldBeDeleted})
+	}
+
+	return result, nil
+}
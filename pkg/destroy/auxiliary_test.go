@@ -0,0 +1,158 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// route53RecordSets is a response of the fake Route53 API listing the record sets of the hosted zone Z123.
+const route53RecordSets = `<ListResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+<ResourceRecordSets>
+<ResourceRecordSet><Name>example.com.</Name><Type>NS</Type><TTL>300</TTL></ResourceRecordSet>
+<ResourceRecordSet><Name>example.com.</Name><Type>SOA</Type><TTL>300</TTL></ResourceRecordSet>
+<ResourceRecordSet><Name>www.example.com.</Name><Type>CNAME</Type><TTL>300</TTL></ResourceRecordSet>
+<ResourceRecordSet><Name>api.example.com.</Name><Type>A</Type><SetIdentifier>blue</SetIdentifier>` +
+	`<TTL>300</TTL></ResourceRecordSet>
+</ResourceRecordSets>
+<IsTruncated>false</IsTruncated><MaxItems>100</MaxItems>
+</ListResourceRecordSetsResponse>`
+
+const route53Change = `<ChangeResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+<ChangeInfo><Id>/change/C123</Id><Status>PENDING</Status><SubmittedAt>2020-01-01T00:00:00Z</SubmittedAt></ChangeInfo>
+</ChangeResourceRecordSetsResponse>`
+
+const route53Error = `<ErrorResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+<Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not allowed</Message></Error><RequestId>1</RequestId>
+</ErrorResponse>`
+
+func TestResource_Destroy_AuxiliaryDeletions(t *testing.T) {
+	tests := []struct {
+		name                string
+		changeDenied        bool
+		expectedOutcome     destroy.AuxiliaryOutcome
+		expectedNumOfFailed int
+	}{
+		{
+			name:            "deleted",
+			expectedOutcome: destroy.AuxiliaryDeleted,
+		},
+		{
+			name:                "failed",
+			changeDenied:        true,
+			expectedOutcome:     destroy.AuxiliaryFailed,
+			expectedNumOfFailed: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			zone, stub := route53Zone(t, tc.changeDenied)
+
+			events := &recordedEvents{}
+
+			result := destroy.Run(context.Background(), []destroy.DestroyableResource{zone}, 1, events)
+
+			assert.Len(t, result.Failed, tc.expectedNumOfFailed)
+
+			var actualIDs []string
+
+			for _, d := range events.auxiliaries {
+				assert.Equal(t, "aws_route53_zone.test", d.Parent)
+				assert.Equal(t, "route53 record set", d.Type)
+				assert.Equal(t, tc.expectedOutcome, d.Outcome)
+				assert.Equal(t, tc.changeDenied, d.Err != nil)
+
+				actualIDs = append(actualIDs, d.ID)
+			}
+
+			assert.ElementsMatch(t, []string{"www.example.com. CNAME", "api.example.com. A blue"}, actualIDs)
+			assert.Equal(t, tc.changeDenied, len(stub.Destroyed()) == 0)
+		})
+	}
+}
+
+func TestResource_PredictAuxiliaries(t *testing.T) {
+	zone, _ := route53Zone(t, false)
+
+	actualAuxiliaries, err := zone.PredictAuxiliaries(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []destroy.AuxiliaryDeletion{
+		{
+			Parent:  "aws_route53_zone.test",
+			Type:    "route53 record set",
+			ID:      "www.example.com. CNAME",
+			Outcome: destroy.AuxiliaryWouldBeDeleted,
+		},
+		{
+			Parent:  "aws_route53_zone.test",
+			Type:    "route53 record set",
+			ID:      "api.example.com. A blue",
+			Outcome: destroy.AuxiliaryWouldBeDeleted,
+		},
+	}, actualAuxiliaries)
+
+	zone.Options.Route53EmptyZones = false
+
+	actualAuxiliaries, err = zone.PredictAuxiliaries(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, actualAuxiliaries)
+}
+
+// route53Zone returns the hosted zone Z123 (example.com) served by a fake Route53 API, whose record sets
+// are deleted before the zone; changes of record sets are denied if changeDenied is set.
+func route53Zone(t *testing.T, changeDenied bool) (*destroy.Resource, *provider.Stub) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet:
+			_, _ = fmt.Fprint(w, route53RecordSets)
+		case changeDenied:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = fmt.Fprint(w, route53Error)
+		default:
+			_, _ = fmt.Fprint(w, route53Change)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	stub := provider.NewStub(provider.StubConfig{}, []string{"aws_route53_zone"})
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return stub, nil
+		},
+	})
+	require.NoError(t, err)
+
+	state := cty.ObjectVal(map[string]cty.Value{
+		"id":   cty.StringVal("Z123"),
+		"name": cty.StringVal("example.com"),
+	})
+
+	zone := destroy.NewWithState("aws_route53_zone.test", "aws_route53_zone", "Z123", nil, tp, &state)
+	zone.Options = destroy.Options{Route53EmptyZones: true, AWSSession: sess}
+
+	return zone, stub
+}
@@ -0,0 +1,419 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/trace"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// batchDestroy deletes resources of one type in batches directly via the AWS API (if Options.BatchDeletes is set).
+type batchDestroy struct {
+	// size is the maximum number of resources deleted with one call.
+	size int
+	// key returns the batch a resource belongs to (e.g., the hosted zone of a record set),
+	// or false if the resource needs to be destroyed via the provider.
+	key func(Resource) (string, bool)
+	// run deletes the given resources of the same batch and returns for each resource the error
+	// if the batch rejected it (nil if the resource has been deleted).
+	run func(ctx context.Context, sess *session.Session, key string, resources []*Resource) []error
+}
+
+//nolint:gochecknoglobals
+var (
+	// batchDestroys lists resource types that can be deleted in batches via the AWS API.
+	batchDestroys = map[string]batchDestroy{
+		"aws_route53_record": {
+			size: route53ChangeBatchSize,
+			key:  route53RecordBatchKey,
+			run:  deleteRoute53Records,
+		},
+		"aws_cloudwatch_log_group": {
+			size: cloudWatchLogGroupBatchSize,
+			key:  func(Resource) (string, bool) { return "", true },
+			run:  deleteLogGroups,
+		},
+		"aws_s3_bucket_object": {
+			size: s3DeleteObjectsBatchSize,
+			key:  s3ObjectBatchKey,
+			run:  deleteS3Objects,
+		},
+		"aws_s3_object": {
+			size: s3DeleteObjectsBatchSize,
+			key:  s3ObjectBatchKey,
+			run:  deleteS3Objects,
+		},
+	}
+)
+
+const (
+	// s3DeleteObjectsBatchSize is the maximum number of objects deleted with one DeleteObjects call.
+	s3DeleteObjectsBatchSize = 1000
+
+	// cloudWatchLogGroupBatchSize is the number of log groups deleted in one batch. CloudWatch Logs has
+	// no batch API, so log groups are deleted one after another, but without going through the provider.
+	cloudWatchLogGroupBatchSize = 100
+)
+
+// destroyBatches deletes the resources of types listed in batchDestroys (if Options.BatchDeletes is set)
+// in batches of resources of the same type directly via the AWS API. Afterwards, it is verified via the
+// provider that each deleted resource is gone, so that the result is still reported per resource.
+//
+// Returns the results of the deleted resources and the remaining resources, which need to be destroyed
+// one by one via the provider (e.g., resources rejected by a batch). Resources go through a batch only once.
+func destroyBatches(ctx context.Context, resources []DestroyableResource, parallel int,
+	events Events) ([]workerResult, []DestroyableResource) {
+	var (
+		keys      []string
+		batches   = map[string][]*Resource{}
+		remaining []DestroyableResource
+	)
+
+	for _, dr := range resources {
+		r, ok := dr.(*Resource)
+		if !ok || !r.batchable() {
+			remaining = append(remaining, dr)
+
+			continue
+		}
+
+		key, _ := batchDestroys[r.Type()].key(*r)
+		key = r.Type() + "/" + key
+
+		if _, ok := batches[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		batches[key] = append(batches[key], r)
+	}
+
+	var results []workerResult
+
+	for _, key := range keys {
+		batch := batches[key]
+
+		// a single resource isn't worth a batch
+		if len(batch) < 2 {
+			remaining = append(remaining, batch[0])
+
+			continue
+		}
+
+		for _, r := range batch {
+			r.batched = true
+		}
+
+		b := batchDestroys[batch[0].Type()]
+		batchKey := strings.TrimPrefix(key, batch[0].Type()+"/")
+
+		for start := 0; start < len(batch); start += b.size {
+			end := start + b.size
+			if end > len(batch) {
+				end = len(batch)
+			}
+
+			deleted, rejected := runBatch(ctx, b, batchKey, batch[start:end], parallel, events)
+
+			results = append(results, deleted...)
+			remaining = append(remaining, rejected...)
+		}
+	}
+
+	return results, remaining
+}
+
+// batchable returns true if the resource can be deleted in a batch.
+func (r *Resource) batchable() bool {
+	if !r.Options.BatchDeletes || r.Options.AWSSession == nil || r.batched || r.State() == nil {
+		return false
+	}
+
+	b, ok := batchDestroys[r.Type()]
+	if !ok {
+		return false
+	}
+
+	_, ok = b.key(*r)
+
+	return ok
+}
+
+// runBatch deletes a batch of resources and verifies in parallel that the deleted ones are gone.
+// Returns the results of the deleted resources and the resources that need to be destroyed via the provider.
+func runBatch(ctx context.Context, b batchDestroy, key string, batch []*Resource, parallel int,
+	events Events) ([]workerResult, []DestroyableResource) {
+	if ctx.Err() != nil {
+		return nil, resourcesOf(batch)
+	}
+
+	span := trace.Start(ctx, "batch", "batch", map[string]interface{}{
+		"type": batch[0].Type(), "key": key, "size": len(batch)})
+	errs := b.run(ctx, batch[0].Options.AWSSession, key, batch)
+	span.End(nil)
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		results   []workerResult
+		remaining []DestroyableResource
+	)
+
+	sem := make(chan struct{}, parallel)
+
+	for i, r := range batch {
+		if errs[i] != nil {
+			log.WithError(errs[i]).WithFields(log.Fields{
+				"id": r.ID(), "type": r.Type()}).Debug(internal.Pad("batch rejected resource"))
+
+			remaining = append(remaining, r)
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(r *Resource) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			span := startSpan(ctx, r, "verify")
+			gone, err := r.verifyDeleted(ctx)
+			span.End(err)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !gone {
+				log.WithError(err).WithFields(log.Fields{
+					"id": r.ID(), "type": r.Type()}).Debug(internal.Pad("resource still exists after batch"))
+
+				remaining = append(remaining, r)
+
+				return
+			}
+
+			e := newResourceEvent(r, nil)
+			e.Fields = log.Fields{"batch": len(batch)}
+
+			events.ResourceDeleted(e)
+
+			results = append(results, workerResult{resource: r, resourceHasBeenDeleted: true})
+		}(r)
+	}
+
+	wg.Wait()
+
+	return results, remaining
+}
+
+// verifyDeleted reads the current state of a resource via the provider and returns true if it is gone.
+func (r *Resource) verifyDeleted(ctx context.Context) (bool, error) {
+	currentState, err := r.provider.ReadResource(ctx, r.Type(), *r.State())
+	if err != nil {
+		return false, err
+	}
+
+	return currentState.IsNull(), nil
+}
+
+// resourcesOf returns the given resources as destroyable ones.
+func resourcesOf(resources []*Resource) []DestroyableResource {
+	var result []DestroyableResource
+
+	for _, r := range resources {
+		result = append(result, r)
+	}
+
+	return result
+}
+
+// route53RecordBatchKey returns the hosted zone of a record set.
+func route53RecordBatchKey(r Resource) (string, bool) {
+	zoneID := stateString(r, "zone_id")
+
+	return zoneID, zoneID != "" && stateString(r, "type") != ""
+}
+
+// deleteRoute53Records deletes record sets of a hosted zone with one ChangeResourceRecordSets call.
+// The record sets are looked up in the zone, since a deletion needs to match a record set exactly.
+// A change batch is atomic: if it fails, all record sets are rejected.
+func deleteRoute53Records(ctx context.Context, sess *session.Session, zoneID string, records []*Resource) []error {
+	errs := make([]error, len(records))
+
+	client := route53.New(sess)
+
+	recordSets := map[string]*route53.ResourceRecordSet{}
+
+	err := client.ListResourceRecordSetsPagesWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+	}, func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+		for _, recordSet := range page.ResourceRecordSets {
+			recordSets[route53RecordKey(aws.StringValue(recordSet.Name), aws.StringValue(recordSet.Type),
+				aws.StringValue(recordSet.SetIdentifier))] = recordSet
+		}
+
+		return true
+	})
+	if err != nil {
+		return fillErrors(errs, fmt.Errorf("failed to list record sets of hosted zone: %s", err))
+	}
+
+	var (
+		changes []*route53.Change
+		batched []int
+	)
+
+	for i, r := range records {
+		name := stateString(*r, "fqdn")
+		if name == "" {
+			name = stateString(*r, "name")
+		}
+
+		recordSet, ok := recordSets[route53RecordKey(name, stateString(*r, "type"), stateString(*r, "set_identifier"))]
+		if !ok {
+			errs[i] = fmt.Errorf("record set not found in hosted zone")
+
+			continue
+		}
+
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(route53.ChangeActionDelete),
+			ResourceRecordSet: recordSet,
+		})
+		batched = append(batched, i)
+	}
+
+	if len(changes) == 0 {
+		return errs
+	}
+
+	_, err = client.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch:  &route53.ChangeBatch{Changes: changes},
+	})
+	if err != nil {
+		for _, i := range batched {
+			errs[i] = fmt.Errorf("failed to delete record sets: %s", err)
+		}
+	}
+
+	return errs
+}
+
+// route53RecordKey returns the key identifying a record set in a hosted zone. Names are compared
+// without the trailing dot, case-insensitively, and with the wildcard unescaped (Route53 returns "\052").
+func route53RecordKey(name, recordType, setIdentifier string) string {
+	name = strings.ToLower(strings.TrimSuffix(strings.ReplaceAll(name, `\052`, "*"), "."))
+
+	return strings.Join([]string{name, recordType, setIdentifier}, "|")
+}
+
+// deleteLogGroups deletes CloudWatch log groups one after another (there is no batch API),
+// treating log groups that don't exist anymore as deleted.
+func deleteLogGroups(ctx context.Context, sess *session.Session, _ string, logGroups []*Resource) []error {
+	errs := make([]error, len(logGroups))
+
+	client := cloudwatchlogs.New(sess)
+
+	for i, r := range logGroups {
+		_, err := client.DeleteLogGroupWithContext(ctx, &cloudwatchlogs.DeleteLogGroupInput{
+			LogGroupName: aws.String(r.ID()),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+			continue
+		}
+
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to delete log group: %s", err)
+		}
+	}
+
+	return errs
+}
+
+// s3ObjectBatchKey returns the bucket of an S3 object. Objects in versioned buckets (i.e., with a version ID)
+// are destroyed via the provider, which deletes all versions of an object.
+func s3ObjectBatchKey(r Resource) (string, bool) {
+	bucket := stateString(r, "bucket")
+
+	return bucket, bucket != "" && stateString(r, "key") != "" && stateString(r, "version_id") == ""
+}
+
+// deleteS3Objects deletes objects of a bucket with one DeleteObjects call, which reports errors per object.
+func deleteS3Objects(ctx context.Context, sess *session.Session, bucket string, objects []*Resource) []error {
+	errs := make([]error, len(objects))
+
+	var identifiers []*s3.ObjectIdentifier
+
+	for _, r := range objects {
+		identifiers = append(identifiers, &s3.ObjectIdentifier{Key: aws.String(stateString(*r, "key"))})
+	}
+
+	resp, err := s3.New(sess).DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{Objects: identifiers, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		return fillErrors(errs, fmt.Errorf("failed to delete objects: %s", err))
+	}
+
+	failed := map[string]error{}
+
+	for _, e := range resp.Errors {
+		failed[aws.StringValue(e.Key)] = fmt.Errorf("failed to delete object: %s: %s",
+			aws.StringValue(e.Code), aws.StringValue(e.Message))
+	}
+
+	for i, r := range objects {
+		errs[i] = failed[stateString(*r, "key")]
+	}
+
+	return errs
+}
+
+// fillErrors sets all given errors to err.
+func fillErrors(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// stateString returns the value of a string attribute of a resource's state, or an empty string if
+// the attribute isn't set.
+func stateString(r Resource, name string) string {
+	if r.State() == nil {
+		return ""
+	}
+
+	return stringAttr(*r.State(), name)
+}
+
+// stringAttr returns the value of a string attribute of the given state, or an empty string if the attribute
+// isn't set.
+func stringAttr(state cty.Value, name string) string {
+	if state.IsNull() || !state.IsKnown() || !state.Type().IsObjectType() || !state.Type().HasAttribute(name) {
+		return ""
+	}
+
+	v := state.GetAttr(name)
+	if v.IsNull() || !v.IsKnown() || !v.Type().Equals(cty.String) {
+		return ""
+	}
+
+	return v.AsString()
+}
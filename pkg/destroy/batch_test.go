@@ -0,0 +1,240 @@
+package destroy_test
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// bucket is an in-memory S3 bucket, which serves DeleteObjects requests and is read and written by
+// a provider managing its objects.
+type bucket struct {
+	mu      sync.Mutex
+	objects map[string]bool
+	// rejected are the keys of objects that DeleteObjects fails to delete.
+	rejected map[string]bool
+	// batches are the number of DeleteObjects calls.
+	batches int
+	// destroyed are the keys of the objects destroyed via the provider.
+	destroyed []string
+}
+
+func (b *bucket) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.URL.Path != "/test-bucket" {
+		http.NotFound(w, req)
+		return
+	}
+
+	var body struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+
+	if err := xml.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.batches++
+
+	result := `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`
+
+	for _, o := range body.Objects {
+		if b.rejected[o.Key] {
+			result += fmt.Sprintf("<Error><Key>%s</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>",
+				o.Key)
+
+			continue
+		}
+
+		delete(b.objects, o.Key)
+	}
+
+	_, _ = fmt.Fprint(w, result+"</DeleteResult>")
+}
+
+func (b *bucket) Configure(providers.ConfigureRequest) providers.ConfigureResponse {
+	return providers.ConfigureResponse{}
+}
+
+func (b *bucket) GetSchema() providers.GetSchemaResponse {
+	return providers.GetSchemaResponse{
+		Provider: providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{
+			"aws_s3_bucket_object": {Block: &configschema.Block{
+				Attributes: map[string]*configschema.Attribute{
+					"id":         {Type: cty.String, Computed: true},
+					"bucket":     {Type: cty.String, Required: true},
+					"key":        {Type: cty.String, Required: true},
+					"version_id": {Type: cty.String, Computed: true},
+				},
+			}},
+		},
+	}
+}
+
+func (b *bucket) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.objects[req.PriorState.GetAttr("key").AsString()] {
+		return providers.ReadResourceResponse{NewState: cty.NullVal(req.PriorState.Type())}
+	}
+
+	return providers.ReadResourceResponse{NewState: req.PriorState}
+}
+
+func (b *bucket) ApplyResourceChange(req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := req.PriorState.GetAttr("key").AsString()
+
+	delete(b.objects, key)
+	b.destroyed = append(b.destroyed, key)
+
+	return providers.ApplyResourceChangeResponse{NewState: cty.NullVal(cty.DynamicPseudoType)}
+}
+
+func (b *bucket) ImportResourceState(providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	return providers.ImportResourceStateResponse{}
+}
+
+func (b *bucket) Stop() error {
+	return nil
+}
+
+func (b *bucket) Close() error {
+	return nil
+}
+
+// bucketObjects returns the objects with the given keys as resources and a session to delete them via the bucket's
+// S3 API.
+func bucketObjects(t *testing.T, b *bucket, keys ...string) ([]*destroy.Resource, *session.Session) {
+	server := httptest.NewServer(b)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("test", "test", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	require.NoError(t, err)
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return b, nil
+		},
+	})
+	require.NoError(t, err)
+
+	var resources []*destroy.Resource
+
+	for _, key := range keys {
+		b.objects[key] = true
+
+		state := cty.ObjectVal(map[string]cty.Value{
+			"id":         cty.StringVal(key),
+			"bucket":     cty.StringVal("test-bucket"),
+			"key":        cty.StringVal(key),
+			"version_id": cty.StringVal(""),
+		})
+
+		resources = append(resources, destroy.NewWithState("aws_s3_bucket_object."+key, "aws_s3_bucket_object",
+			key, nil, tp, &state))
+	}
+
+	return resources, sess
+}
+
+func TestRun_BatchDeletes(t *testing.T) {
+	tests := []struct {
+		name                  string
+		batchDeletes          bool
+		rejected              map[string]bool
+		expectedBatches       int
+		expectedDestroyedKeys []string
+	}{
+		{
+			name:            "batch",
+			batchDeletes:    true,
+			expectedBatches: 1,
+		},
+		{
+			name:                  "fall back to provider for rejected objects",
+			batchDeletes:          true,
+			rejected:              map[string]bool{"b": true},
+			expectedBatches:       1,
+			expectedDestroyedKeys: []string{"b"},
+		},
+		{
+			name:                  "not enabled",
+			expectedDestroyedKeys: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &bucket{objects: map[string]bool{}, rejected: tc.rejected}
+
+			resources, sess := bucketObjects(t, b, "a", "b", "c")
+
+			var destroyable []destroy.DestroyableResource
+
+			for _, r := range resources {
+				r.Options = destroy.Options{BatchDeletes: tc.batchDeletes, AWSSession: sess}
+				destroyable = append(destroyable, r)
+			}
+
+			events := &recordedEvents{}
+
+			result := destroy.Run(context.Background(), destroyable, 2, events)
+
+			assert.Equal(t, destroy.Result{Deleted: 3}, result)
+			assert.Empty(t, b.objects)
+			assert.Equal(t, tc.expectedBatches, b.batches)
+
+			sort.Strings(b.destroyed)
+			assert.Equal(t, tc.expectedDestroyedKeys, b.destroyed)
+			assert.Len(t, events.deleted, 3)
+		})
+	}
+}
+
+func TestPlanAndExecute_BatchDeletes(t *testing.T) {
+	b := &bucket{objects: map[string]bool{}, rejected: map[string]bool{"c": true}}
+
+	resources, sess := bucketObjects(t, b, "a", "b", "c")
+
+	_, result, err := destroy.PlanAndExecute(context.Background(), fakeState{resources: resources}, nil,
+		destroy.Config{Parallel: 2, Options: destroy.Options{BatchDeletes: true, AWSSession: sess}})
+	require.NoError(t, err)
+
+	assert.Equal(t, destroy.Result{Deleted: 3}, result)
+	assert.Empty(t, b.objects)
+	assert.Equal(t, 1, b.batches)
+	assert.Equal(t, []string{"c"}, b.destroyed)
+}
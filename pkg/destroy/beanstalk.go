@@ -0,0 +1,88 @@
+package destroy
+
+import (
+	"context"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultBeanstalkTimeout is the default amount of time to wait for an Elastic Beanstalk environment to terminate.
+const DefaultBeanstalkTimeout = 30 * time.Minute
+
+// beanstalkDestroyAttrs returns the attributes of an Elastic Beanstalk environment that need to be changed
+// in the state before calling destroy, so that the provider waits long enough for the environment to terminate.
+func (r Resource) beanstalkDestroyAttrs() map[string]cty.Value {
+	return map[string]cty.Value{
+		"wait_for_ready_timeout": cty.StringVal(r.beanstalkTimeout().String()),
+	}
+}
+
+// destroyBeanstalkEnvironment destroys an Elastic Beanstalk environment and waits until it is terminated.
+// While waiting, the transitions of the environment's status and health are logged.
+func (r Resource) destroyBeanstalkEnvironment(ctx context.Context, state cty.Value) error {
+	timeout := r.beanstalkTimeout()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- r.destroyWithTimeout(ctx, state, timeout)
+	}()
+
+	var lastStatus, lastHealth string
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(pollInterval):
+			status, health, ok := r.beanstalkEnvironmentStatus(ctx)
+			if !ok || (status == lastStatus && health == lastHealth) {
+				continue
+			}
+
+			lastStatus, lastHealth = status, health
+
+			log.WithFields(log.Fields{
+				"id": r.ID(), "type": r.Type(), "status": status, "health": health,
+			}).Info(internal.Pad("waiting for environment to terminate"))
+		}
+	}
+}
+
+// beanstalkEnvironmentStatus returns the current status and health of an Elastic Beanstalk environment.
+func (r Resource) beanstalkEnvironmentStatus(ctx context.Context) (string, string, bool) {
+	if r.Options.AWSSession == nil {
+		return "", "", false
+	}
+
+	resp, err := elasticbeanstalk.New(r.Options.AWSSession).DescribeEnvironmentsWithContext(ctx,
+		&elasticbeanstalk.DescribeEnvironmentsInput{
+			EnvironmentIds: []*string{aws.String(r.ID())},
+		})
+	if err != nil {
+		log.WithError(err).WithField("id", r.ID()).Debug(internal.Pad("failed to get status of environment"))
+
+		return "", "", false
+	}
+
+	if len(resp.Environments) == 0 {
+		return "", "", false
+	}
+
+	env := resp.Environments[0]
+
+	return aws.StringValue(env.Status), aws.StringValue(env.Health), true
+}
+
+func (r Resource) beanstalkTimeout() time.Duration {
+	if r.Options.BeanstalkTimeout == 0 {
+		return DefaultBeanstalkTimeout
+	}
+
+	return r.Options.BeanstalkTimeout
+}
@@ -0,0 +1,233 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// maxBlockers is the maximum number of blockers looked up per resource.
+const maxBlockers = 10
+
+// Blocker is a resource outside the state that blocks the deletion of a resource (e.g., a manually created
+// instance in a subnet).
+type Blocker struct {
+	// ID is the ID of the blocking resource (e.g., of a network interface or an S3 object).
+	ID string
+	// Description tells what the blocking resource is (e.g., the instance a network interface is attached to).
+	Description string
+	// RelatedIDs are further IDs of the blocking resource (e.g., of the instance a network interface
+	// is attached to), which are used to tell whether the blocker is part of the state.
+	RelatedIDs []string
+}
+
+func (b Blocker) String() string {
+	if b.Description == "" {
+		return b.ID
+	}
+
+	return fmt.Sprintf("%s (%s)", b.ID, b.Description)
+}
+
+// BlockedError is returned if a resource failed to be destroyed because of resources depending on it
+// that are not part of the state (see Options.ExplainBlockers).
+type BlockedError struct {
+	Err      error
+	Blockers []Blocker
+}
+
+func (e BlockedError) Error() string {
+	var blockers []string
+
+	for _, b := range e.Blockers {
+		blockers = append(blockers, b.String())
+	}
+
+	return fmt.Sprintf("%s (blocked by resources outside the state: %s)", e.Err, strings.Join(blockers, ", "))
+}
+
+func (e BlockedError) Unwrap() error {
+	return e.Err
+}
+
+// explainBlockers looks up the blockers of the resources that failed to be destroyed due to a dependency
+// violation (if enabled; see Options.ExplainBlockers) and adds them to their errors. Blockers that are
+// part of the given resources (e.g., an instance that failed to be destroyed as well) are ignored.
+func explainBlockers(ctx context.Context, failed []RetryDestroyError, resources []DestroyableResource) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	var inState map[string]bool
+
+	for i, retryErr := range failed {
+		if retryErr.Class != ErrorClassDependencyViolation {
+			continue
+		}
+
+		r, ok := retryErr.Resource.(*Resource)
+		if !ok || !r.Options.ExplainBlockers || r.Options.AWSSession == nil {
+			continue
+		}
+
+		lookup, ok := blockerLookups[r.Type()]
+		if !ok {
+			continue
+		}
+
+		blockers, err := lookup(*r, ctx)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"id": r.ID(), "type": r.Type()}).Info(internal.Pad("failed to look up blocking resources"))
+
+			continue
+		}
+
+		if inState == nil {
+			inState = map[string]bool{}
+
+			for _, r := range resources {
+				inState[r.ID()] = true
+			}
+		}
+
+		blockers = outsideState(blockers, inState)
+		if len(blockers) == 0 {
+			continue
+		}
+
+		failed[i].Err = &BlockedError{Err: retryErr.Err, Blockers: blockers}
+	}
+}
+
+// outsideState returns the blockers that are not part of the state (given by the IDs of its resources).
+func outsideState(blockers []Blocker, inState map[string]bool) []Blocker {
+	var result []Blocker
+
+	for _, b := range blockers {
+		known := inState[b.ID]
+
+		for _, id := range b.RelatedIDs {
+			known = known || inState[id]
+		}
+
+		if !known {
+			result = append(result, b)
+		}
+	}
+
+	return result
+}
+
+// subnetBlockers returns the network interfaces in a subnet (e.g., of instances or load balancers).
+func (r Resource) subnetBlockers(ctx context.Context) ([]Blocker, error) {
+	return r.networkInterfaceBlockers(ctx, "subnet-id")
+}
+
+// securityGroupBlockers returns the network interfaces a security group is attached to and the security groups
+// with rules referencing it.
+func (r Resource) securityGroupBlockers(ctx context.Context) ([]Blocker, error) {
+	blockers, err := r.networkInterfaceBlockers(ctx, "group-id")
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := ec2.New(r.Options.AWSSession).DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("ip-permission.group-id"), Values: aws.StringSlice([]string{r.ID()})}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe security groups: %s", err)
+	}
+
+	for _, sg := range out.SecurityGroups {
+		if aws.StringValue(sg.GroupId) == r.ID() || len(blockers) >= maxBlockers {
+			continue
+		}
+
+		blockers = append(blockers, Blocker{
+			ID:          aws.StringValue(sg.GroupId),
+			Description: fmt.Sprintf("security group %s referencing it in a rule", aws.StringValue(sg.GroupName)),
+		})
+	}
+
+	return blockers, nil
+}
+
+// vpcBlockers returns the network interfaces in a VPC.
+func (r Resource) vpcBlockers(ctx context.Context) ([]Blocker, error) {
+	return r.networkInterfaceBlockers(ctx, "vpc-id")
+}
+
+// networkInterfaceBlockers returns the network interfaces matching the given filter with the resource's ID.
+func (r Resource) networkInterfaceBlockers(ctx context.Context, filter string) ([]Blocker, error) {
+	out, err := ec2.New(r.Options.AWSSession).DescribeNetworkInterfacesWithContext(ctx,
+		&ec2.DescribeNetworkInterfacesInput{
+			Filters: []*ec2.Filter{{Name: aws.String(filter), Values: aws.StringSlice([]string{r.ID()})}},
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe network interfaces: %s", err)
+	}
+
+	var blockers []Blocker
+
+	for _, eni := range out.NetworkInterfaces {
+		if len(blockers) >= maxBlockers {
+			break
+		}
+
+		b := Blocker{ID: aws.StringValue(eni.NetworkInterfaceId), Description: aws.StringValue(eni.Description)}
+
+		if eni.Attachment != nil && eni.Attachment.InstanceId != nil {
+			b.Description = "attached to instance " + aws.StringValue(eni.Attachment.InstanceId)
+			b.RelatedIDs = []string{aws.StringValue(eni.Attachment.InstanceId)}
+		}
+
+		blockers = append(blockers, b)
+	}
+
+	return blockers, nil
+}
+
+// bucketBlockers returns (some of) the objects in an S3 bucket.
+func (r Resource) bucketBlockers(ctx context.Context) ([]Blocker, error) {
+	out, err := s3.New(r.Options.AWSSession).ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(r.ID()),
+		MaxKeys: aws.Int64(maxBlockers),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %s", err)
+	}
+
+	var blockers []Blocker
+
+	for _, v := range out.Versions {
+		blockers = append(blockers, objectBlocker(v.Key, v.VersionId, "object"))
+	}
+
+	for _, m := range out.DeleteMarkers {
+		blockers = append(blockers, objectBlocker(m.Key, m.VersionId, "delete marker"))
+	}
+
+	if len(blockers) > maxBlockers {
+		blockers = blockers[:maxBlockers]
+	}
+
+	return blockers, nil
+}
+
+// objectBlocker returns an object version (or delete marker) blocking the deletion of its bucket.
+func objectBlocker(key, versionID *string, kind string) Blocker {
+	b := Blocker{ID: aws.StringValue(key), Description: kind}
+
+	if v := aws.StringValue(versionID); v != "" && v != "null" {
+		b.Description = fmt.Sprintf("%s, version %s", kind, v)
+	}
+
+	return b
+}
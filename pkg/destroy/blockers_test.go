@@ -0,0 +1,135 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// violatingProvider is a provider whose destroys of subnets fail with a dependency violation.
+type violatingProvider struct {
+	*slowProvider
+}
+
+func (p violatingProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	if req.TypeName != "aws_subnet" {
+		return p.slowProvider.ApplyResourceChange(req)
+	}
+
+	var diags tfdiags.Diagnostics
+
+	return providers.ApplyResourceChangeResponse{
+		Diagnostics: diags.Append(tfdiags.Sourceless(tfdiags.Error, "error deleting subnet (subnet-1): "+
+			"DependencyViolation: The subnet 'subnet-1' has dependencies and cannot be deleted.", "")),
+	}
+}
+
+// networkInterfaces is a fake EC2 API, which describes network interfaces.
+const networkInterfaces = `<DescribeNetworkInterfacesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <networkInterfaceSet>
+    <item>
+      <networkInterfaceId>eni-1</networkInterfaceId>
+      <description>manually created</description>
+      <attachment><instanceId>i-manual</instanceId></attachment>
+    </item>
+    <item>
+      <networkInterfaceId>eni-2</networkInterfaceId>
+      <description>ELB app/test/1234</description>
+    </item>
+    <item>
+      <networkInterfaceId>eni-3</networkInterfaceId>
+      <attachment><instanceId>i-in-state</instanceId></attachment>
+    </item>
+  </networkInterfaceSet>
+</DescribeNetworkInterfacesResponse>`
+
+func TestRun_ExplainBlockers(t *testing.T) {
+	tests := []struct {
+		name            string
+		explainBlockers bool
+		expectedErr     string
+	}{
+		{
+			name:            "explain blockers",
+			explainBlockers: true,
+			expectedErr: "error deleting subnet (subnet-1): DependencyViolation: The subnet 'subnet-1' has " +
+				"dependencies and cannot be deleted. (blocked by resources outside the state: " +
+				"eni-1 (attached to instance i-manual), eni-2 (ELB app/test/1234))",
+		},
+		{
+			name: "not enabled",
+			expectedErr: "error deleting subnet (subnet-1): DependencyViolation: The subnet 'subnet-1' has " +
+				"dependencies and cannot be deleted.",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				require.NoError(t, req.ParseForm())
+				requests = append(requests, req.Form.Get("Action")+" "+req.Form.Get("Filter.1.Name")+"="+
+					req.Form.Get("Filter.1.Value.1"))
+
+				_, _ = fmt.Fprint(w, networkInterfaces)
+			}))
+			defer server.Close()
+
+			sess, err := session.NewSession(&aws.Config{
+				Credentials: credentials.NewStaticCredentials("test", "test", ""),
+				Endpoint:    aws.String(server.URL),
+				Region:      aws.String("us-east-1"),
+			})
+			require.NoError(t, err)
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return violatingProvider{&slowProvider{}}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			options := destroy.Options{ExplainBlockers: tc.explainBlockers, AWSSession: sess}
+
+			var resources []destroy.DestroyableResource
+
+			for _, r := range []struct{ rType, id string }{{"aws_subnet", "subnet-1"}, {"aws_instance", "i-in-state"}} {
+				state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(r.id)})
+
+				resource := destroy.NewWithState(r.rType+".test", r.rType, r.id, nil, tp, &state)
+				resource.Options = options
+
+				resources = append(resources, resource)
+			}
+
+			result := destroy.Run(context.Background(), resources, 2, nil)
+
+			require.Len(t, result.Failed, 1)
+			assert.Equal(t, destroy.ErrorClassDependencyViolation, result.Failed[0].Class)
+			assert.EqualError(t, result.Failed[0], tc.expectedErr)
+
+			if tc.explainBlockers {
+				assert.Equal(t, []string{"DescribeNetworkInterfaces subnet-id=subnet-1"}, requests)
+			} else {
+				assert.Empty(t, requests)
+			}
+		})
+	}
+}
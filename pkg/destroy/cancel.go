@@ -0,0 +1,110 @@
+package destroy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// gracePeriodKey is the context key of the channel that is closed once the grace period of destroys in flight
+// is over (see withGracePeriod).
+type gracePeriodKey struct{}
+
+// withGracePeriod returns a context of a run whose destroys in flight are given the grace period to complete
+// (see inFlight) once the given context is done, while no further resources are destroyed. The returned function
+// ends the grace period right away and must be called once the run has finished. With a zero grace period,
+// destroys in flight are canceled together with the given context.
+func withGracePeriod(ctx context.Context, gracePeriod time.Duration) (context.Context, func()) {
+	if gracePeriod <= 0 {
+		return ctx, func() {}
+	}
+
+	over := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(over)
+
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			return
+		}
+
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-finished:
+		}
+	}()
+
+	var once sync.Once
+
+	return context.WithValue(ctx, gracePeriodKey{}, over), func() {
+		once.Do(func() { close(finished) })
+	}
+}
+
+// inFlightContext is the context of a destroy in flight, which has the values of the run's context, but is only
+// canceled once the grace period is over.
+type inFlightContext struct {
+	context.Context
+
+	over <-chan struct{}
+}
+
+// Deadline implements context.Context.
+func (c inFlightContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done implements context.Context.
+func (c inFlightContext) Done() <-chan struct{} {
+	return c.over
+}
+
+// Err implements context.Context.
+func (c inFlightContext) Err() error {
+	select {
+	case <-c.over:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+// inFlight returns the context to destroy a resource with, given the context of the run, which lasts until
+// the grace period of the run is over (if any; see withGracePeriod).
+func inFlight(ctx context.Context) context.Context {
+	over, ok := ctx.Value(gracePeriodKey{}).(chan struct{})
+	if !ok {
+		return ctx
+	}
+
+	return inFlightContext{Context: ctx, over: over}
+}
+
+// remainingOf returns the given resources that have neither been destroyed nor failed to be destroyed.
+func remainingOf(resources, deleted []DestroyableResource, failed []RetryDestroyError) []DestroyableResource {
+	done := map[DestroyableResource]bool{}
+
+	for _, r := range deleted {
+		done[r] = true
+	}
+
+	for _, retryErr := range failed {
+		done[retryErr.Resource] = true
+	}
+
+	var remaining []DestroyableResource
+
+	for _, r := range resources {
+		if !done[r] {
+			remaining = append(remaining, r)
+		}
+	}
+
+	return remaining
+}
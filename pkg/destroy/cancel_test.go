@@ -0,0 +1,117 @@
+package destroy_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecute_Canceled(t *testing.T) {
+	const latency = 200 * time.Millisecond
+
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		// expectedDeleted is the number of destroys in flight when canceled that complete
+		expectedDeleted int
+	}{
+		{
+			name:            "destroys in flight complete within grace period",
+			gracePeriod:     time.Minute,
+			expectedDeleted: 3,
+		},
+		{
+			name:        "destroys in flight are canceled after grace period",
+			gracePeriod: 10 * time.Millisecond,
+		},
+		{
+			name: "without grace period",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// one VPC with 9 subnets, of which 3 are destroyed concurrently
+			resources, stub := stubResources(t, provider.StubConfig{Latency: latency}, 10)
+
+			plan, err := destroy.Plan(context.Background(), fakeState{resources: resources}, nil,
+				destroy.Config{Parallel: 3, GracePeriod: tc.gracePeriod})
+			require.NoError(t, err)
+			require.Len(t, plan.Candidates, 10)
+
+			// the provider has started its background goroutines by now
+			numOfGoroutines := runtime.NumGoroutine()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			time.AfterFunc(latency/4, cancel)
+
+			start := time.Now()
+			result := destroy.Execute(ctx, plan)
+
+			assert.True(t, result.Interrupted)
+			assert.Equal(t, tc.expectedDeleted, result.Deleted)
+			assert.Len(t, stub.Destroyed(), tc.expectedDeleted)
+			assert.Empty(t, result.Failed)
+			assert.Len(t, result.Remaining, len(resources)-tc.expectedDeleted,
+				"resources that haven't been destroyed must remain")
+
+			if tc.gracePeriod < latency {
+				assert.Less(t, int64(time.Since(start)), int64(latency), "destroys in flight must be abandoned")
+			}
+
+			// abandoned calls to the provider return once their latency is over (the stub runs in-process,
+			// so there is no plugin process to leak)
+			assertNoGoroutinesLeak(t, numOfGoroutines, 5*latency)
+		})
+	}
+}
+
+func TestPlanAndExecute_CanceledWithGracePeriod(t *testing.T) {
+	const latency = 200 * time.Millisecond
+
+	resources, stub := stubResources(t, provider.StubConfig{Latency: latency}, 10)
+
+	// starts the background goroutines of the provider
+	_, err := destroy.Plan(context.Background(), fakeState{resources: resources[:1]}, nil, destroy.Config{})
+	require.NoError(t, err)
+
+	numOfGoroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// canceled while the subnets are destroyed (after their states have been updated), so that the VPC,
+	// which all subnets depend on, is never destroyed
+	time.AfterFunc(latency*3/2, cancel)
+
+	_, result, err := destroy.PlanAndExecute(ctx, fakeState{resources: resources}, nil,
+		destroy.Config{Parallel: 10, GracePeriod: time.Minute})
+	require.NoError(t, err)
+
+	assert.True(t, result.Interrupted)
+	assert.Equal(t, 9, result.Deleted, "destroys of subnets in flight must complete")
+	assert.Len(t, stub.Destroyed(), 9)
+	assert.Equal(t, []destroy.DestroyableResource{resources[0]}, result.Remaining)
+
+	assertNoGoroutinesLeak(t, numOfGoroutines, 5*latency)
+}
+
+// assertNoGoroutinesLeak asserts that the number of goroutines drops to the given one within the given timeout
+// (not via assert.Eventually, which runs the condition in a goroutine of its own).
+func assertNoGoroutinesLeak(t *testing.T, numOfGoroutines int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	for runtime.NumGoroutine() > numOfGoroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.LessOrEqual(t, runtime.NumGoroutine(), numOfGoroutines, "goroutines must not leak after cancellation")
+}
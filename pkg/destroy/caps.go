@@ -0,0 +1,137 @@
+package destroy
+
+import (
+	"sort"
+	"time"
+)
+
+//nolint:gochecknoglobals
+var (
+	// creationTimeAttributes are the names of attributes in which AWS resources record when they have been created.
+	creationTimeAttributes = []string{"create_date", "creation_date", "create_time", "created_time", "creation_time"}
+)
+
+// ExceededCap is a resource type whose number of candidates of a plan exceeds the maximum number of resources
+// of the type to destroy (see DestroyPlan.ExceededCaps).
+type ExceededCap struct {
+	Type string
+	// Cap is the maximum number of resources of the type to destroy.
+	Cap int
+	// Planned is the number of candidates of the type.
+	Planned int
+}
+
+// ExceededCaps returns the types whose number of candidates exceeds the given maximum number of resources
+// per type, ordered by type.
+func (plan *DestroyPlan) ExceededCaps(caps map[string]int) []ExceededCap {
+	planned := map[string]int{}
+
+	for _, c := range plan.Candidates {
+		planned[c.Type]++
+	}
+
+	var result []ExceededCap
+
+	for t, limit := range caps {
+		if planned[t] > limit {
+			result = append(result, ExceededCap{Type: t, Cap: limit, Planned: planned[t]})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+
+	return result
+}
+
+// Trim defers the candidates of each type beyond the given maximum number of resources per type, so that only
+// up to the cap are destroyed (see Deferred). The oldest resources are kept first (if their creation time is
+// known; see CreatedAt), then by address. Returns the caps that have been exceeded.
+func (plan *DestroyPlan) Trim(caps map[string]int) []ExceededCap {
+	exceeded := plan.ExceededCaps(caps)
+	if len(exceeded) == 0 {
+		return nil
+	}
+
+	byType := map[string][]PlannedResource{}
+
+	for _, c := range plan.Candidates {
+		if _, ok := caps[c.Type]; ok {
+			byType[c.Type] = append(byType[c.Type], c)
+		}
+	}
+
+	kept := map[*Resource]bool{}
+
+	for t, candidates := range byType {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return olderThan(candidates[i], candidates[j])
+		})
+
+		n := caps[t]
+		if n > len(candidates) {
+			n = len(candidates)
+		}
+
+		for _, c := range candidates[:n] {
+			kept[c.Resource] = true
+		}
+	}
+
+	var candidates []PlannedResource
+
+	for _, c := range plan.Candidates {
+		if _, capped := caps[c.Type]; capped && !kept[c.Resource] {
+			plan.Deferred = append(plan.Deferred, c)
+
+			continue
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	plan.Candidates = candidates
+
+	return exceeded
+}
+
+// olderThan returns true if the first resource has been created before the second one; resources whose creation
+// time is unknown come after the ones whose is known, keeping their order (i.e., by address).
+func olderThan(a, b PlannedResource) bool {
+	createdA, okA := CreatedAt(a.Resource)
+	createdB, okB := CreatedAt(b.Resource)
+
+	if okA && okB {
+		return createdA.Before(createdB)
+	}
+
+	return okA && !okB
+}
+
+// CreatedAt returns when the given resource has been created, if it is recorded in one of its attributes
+// (e.g., create_date of IAM roles or create_time of EKS clusters).
+func CreatedAt(r *Resource) (time.Time, bool) {
+	for _, name := range creationTimeAttributes {
+		value := stateString(*r, name)
+		if value == "" {
+			continue
+		}
+
+		created, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return created, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// DeferredByType returns the number of candidates that have been deferred (see Trim) by their type.
+func (plan *DestroyPlan) DeferredByType() map[string]int {
+	result := map[string]int{}
+
+	for _, c := range plan.Deferred {
+		result[c.Type]++
+	}
+
+	return result
+}
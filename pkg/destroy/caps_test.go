@@ -0,0 +1,78 @@
+package destroy_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDestroyPlan_Trim(t *testing.T) {
+	stub := provider.NewStub(provider.StubConfig{}, []string{"aws_iam_role", "aws_s3_bucket", "aws_vpc"})
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return stub, nil
+		},
+	})
+	require.NoError(t, err)
+
+	resource := func(address, rType, id, createDate string) *destroy.Resource {
+		attrs := map[string]cty.Value{"id": cty.StringVal(id)}
+		if createDate != "" {
+			attrs["create_date"] = cty.StringVal(createDate)
+		}
+
+		state := cty.ObjectVal(attrs)
+
+		return destroy.NewWithState(address, rType, id, nil, tp, &state)
+	}
+
+	state := fakeState{resources: []*destroy.Resource{
+		resource("aws_iam_role.a", "aws_iam_role", "a", "2023-03-01T10:00:00Z"),
+		resource("aws_iam_role.b", "aws_iam_role", "b", "2021-06-15T10:00:00Z"),
+		resource("aws_iam_role.c", "aws_iam_role", "c", ""),
+		resource("aws_iam_role.d", "aws_iam_role", "d", "2022-01-01T10:00:00Z"),
+		resource("aws_s3_bucket.x", "aws_s3_bucket", "x", ""),
+		resource("aws_s3_bucket.y", "aws_s3_bucket", "y", ""),
+		resource("aws_vpc.test", "aws_vpc", "vpc-1", ""),
+	}}
+
+	caps := map[string]int{"aws_iam_role": 2, "aws_s3_bucket": 1, "aws_vpc": 1}
+
+	plan, err := destroy.Plan(context.Background(), state, nil, destroy.Config{})
+	require.NoError(t, err)
+
+	expectedExceeded := []destroy.ExceededCap{
+		{Type: "aws_iam_role", Cap: 2, Planned: 4},
+		{Type: "aws_s3_bucket", Cap: 1, Planned: 2},
+	}
+
+	assert.Equal(t, expectedExceeded, plan.ExceededCaps(caps))
+	assert.Equal(t, expectedExceeded, plan.Trim(caps))
+
+	addresses := func(resources []destroy.PlannedResource) []string {
+		var result []string
+
+		for _, r := range resources {
+			result = append(result, r.Address)
+		}
+
+		return result
+	}
+
+	// the oldest roles (with known creation time) are destroyed first, buckets without creation time by address
+	assert.Equal(t, []string{"aws_iam_role.b", "aws_iam_role.d", "aws_s3_bucket.x", "aws_vpc.test"},
+		addresses(plan.Candidates))
+	assert.Equal(t, []string{"aws_iam_role.a", "aws_iam_role.c", "aws_s3_bucket.y"}, addresses(plan.Deferred))
+	assert.Equal(t, map[string]int{"aws_iam_role": 2, "aws_s3_bucket": 1}, plan.DeferredByType())
+
+	assert.Empty(t, plan.Trim(caps), "trimmed plan must not exceed caps anymore")
+	assert.Len(t, plan.Deferred, 3)
+}
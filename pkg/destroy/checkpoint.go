@@ -0,0 +1,185 @@
+package destroy
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Checkpoint pauses a run after every Every destroyed resources: no further destroys are started, the ones
+// in flight complete, and Continue is called with the result the run would have if it was stopped there
+// (i.e., interrupted, with the failures and the remaining resources so far). The run only goes on if Continue
+// returns true; otherwise, it's stopped as if its context was done (see Result.Stopped).
+type Checkpoint struct {
+	Every    int
+	Continue func(ctx context.Context, result Result) bool
+}
+
+// resourceKey identifies a resource across events.
+type resourceKey struct {
+	rType, id string
+}
+
+// checkpoints pauses a run at the checkpoints of the given configuration (see Checkpoint), which is disabled
+// if nil or Every isn't positive.
+type checkpoints struct {
+	Events
+
+	checkpoint  *Checkpoint
+	concurrency *Concurrency
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	// paused serializes checkpoints reached by several workers at once.
+	paused sync.Mutex
+
+	resources []DestroyableResource
+
+	mu      sync.Mutex
+	deleted map[resourceKey]bool
+	failed  map[resourceKey]ResourceEvent
+	stopped bool
+	// lastDeleted is the number of destroyed resources at the last checkpoint.
+	lastDeleted int
+}
+
+// withCheckpoints returns the context of a run of the given resources that is canceled once the run is stopped
+// at a checkpoint, and the events that pause the run at the checkpoints.
+func withCheckpoints(ctx context.Context, checkpoint *Checkpoint, resources []DestroyableResource,
+	concurrency *Concurrency, events Events) (context.Context, *checkpoints) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return ctx, &checkpoints{
+		Events:      events,
+		checkpoint:  checkpoint,
+		resources:   resources,
+		concurrency: concurrency,
+		ctx:         ctx,
+		cancel:      cancel,
+		deleted:     map[resourceKey]bool{},
+		failed:      map[resourceKey]ResourceEvent{},
+	}
+}
+
+// isStopped returns true if the run has been stopped at a checkpoint.
+func (c *checkpoints) isStopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stopped
+}
+
+// ResourceDeleted implements Events.
+func (c *checkpoints) ResourceDeleted(event ResourceEvent) {
+	c.Events.ResourceDeleted(event)
+
+	if c.checkpoint == nil || c.checkpoint.Every < 1 {
+		return
+	}
+
+	c.mu.Lock()
+
+	key := resourceKey{event.Type, event.ID}
+	c.deleted[key] = true
+	delete(c.failed, key)
+
+	reached := len(c.deleted)%c.checkpoint.Every == 0
+
+	c.mu.Unlock()
+
+	if reached {
+		c.pause()
+	}
+}
+
+// ResourceFailed implements Events.
+func (c *checkpoints) ResourceFailed(event ResourceEvent) {
+	c.Events.ResourceFailed(event)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failed[resourceKey{event.Type, event.ID}] = event
+}
+
+// RunCompleted implements Events.
+func (c *checkpoints) RunCompleted(result Result) {
+	result.Stopped = c.isStopped()
+	c.Events.RunCompleted(result)
+}
+
+// pause waits until the destroys in flight have completed and asks whether to continue the run;
+// it's stopped otherwise.
+func (c *checkpoints) pause() {
+	c.paused.Lock()
+	defer c.paused.Unlock()
+
+	c.concurrency.pause()
+	defer c.concurrency.resume()
+
+	c.concurrency.idle(c.ctx)
+
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	result := c.result()
+
+	// a checkpoint reached by another worker in the meantime covers this one, too, and there's no need
+	// to pause if all resources have been processed
+	if result.Deleted-c.lastDeleted < c.checkpoint.Every || len(result.Remaining) == 0 {
+		return
+	}
+
+	c.lastDeleted = result.Deleted
+
+	// the run is interrupted anyway if the context is done while waiting for the answer
+	if c.checkpoint.Continue(c.ctx, result) || c.ctx.Err() != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+
+	c.cancel()
+}
+
+// result returns the result of the run if it was stopped now.
+func (c *checkpoints) result() Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := Result{
+		Deleted:     len(c.deleted),
+		Interrupted: true,
+		Throttling:  throttlingOf(c.concurrency),
+	}
+
+	for _, r := range c.resources {
+		key := resourceKey{r.Type(), r.ID()}
+
+		if c.deleted[key] {
+			continue
+		}
+
+		e, ok := c.failed[key]
+		if !ok {
+			result.Remaining = append(result.Remaining, r)
+
+			continue
+		}
+
+		var retryErr *RetryDestroyError
+		if !errors.As(e.Err, &retryErr) {
+			retryErr = NewRetryDestroyError(e.Err, r)
+		}
+
+		result.Failed = append(result.Failed, *retryErr)
+	}
+
+	sortErrorsByAddress(result.Failed)
+	sortDestroyableByAddress(result.Remaining)
+
+	return result
+}
@@ -0,0 +1,111 @@
+package destroy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecute_Checkpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		execute func(ctx context.Context, state fakeState, config destroy.Config) destroy.Result
+	}{
+		{
+			name: "execute",
+			execute: func(ctx context.Context, state fakeState, config destroy.Config) destroy.Result {
+				plan, err := destroy.Plan(ctx, state, nil, config)
+				require.NoError(t, err)
+
+				return destroy.Execute(ctx, plan)
+			},
+		},
+		{
+			name: "forced",
+			execute: func(ctx context.Context, state fakeState, config destroy.Config) destroy.Result {
+				_, result, err := destroy.PlanAndExecute(ctx, state, nil, config)
+				require.NoError(t, err)
+
+				return result
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resources, _ := stubResources(t, provider.StubConfig{}, 20)
+
+			var checkpoints []destroy.Result
+
+			config := destroy.Config{
+				Parallel: 1,
+				Checkpoint: &destroy.Checkpoint{
+					Every: 5,
+					Continue: func(ctx context.Context, result destroy.Result) bool {
+						checkpoints = append(checkpoints, result)
+
+						// stops at the second checkpoint
+						return len(checkpoints) < 2
+					},
+				},
+			}
+
+			result := tc.execute(context.Background(), fakeState{resources: resources}, config)
+
+			require.Len(t, checkpoints, 2)
+
+			for i, checkpoint := range checkpoints {
+				assert.Equal(t, (i+1)*5, checkpoint.Deleted)
+				assert.True(t, checkpoint.Interrupted)
+				assert.Len(t, checkpoint.Remaining, 20-(i+1)*5)
+				assert.Empty(t, checkpoint.Failed)
+			}
+
+			assert.True(t, result.Stopped)
+			assert.True(t, result.Interrupted)
+			assert.Equal(t, 10, result.Deleted)
+			assert.Len(t, result.Remaining, 10)
+		})
+	}
+}
+
+func TestExecute_CheckpointContinued(t *testing.T) {
+	resources, _ := stubResources(t, provider.StubConfig{}, 20)
+
+	var deletedAtCheckpoints []int
+
+	plan, err := destroy.Plan(context.Background(), fakeState{resources: resources}, nil, destroy.Config{
+		Parallel: 4,
+		Checkpoint: &destroy.Checkpoint{
+			Every: 3,
+			Continue: func(ctx context.Context, result destroy.Result) bool {
+				deletedAtCheckpoints = append(deletedAtCheckpoints, result.Deleted)
+
+				return true
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	result := destroy.Execute(context.Background(), plan)
+
+	// destroys in flight complete before a checkpoint, so that its number of destroyed resources can be higher
+	require.NotEmpty(t, deletedAtCheckpoints)
+
+	previous := 0
+
+	for _, deleted := range deletedAtCheckpoints {
+		assert.GreaterOrEqual(t, deleted-previous, 3)
+		assert.Less(t, deleted, 20)
+
+		previous = deleted
+	}
+
+	assert.False(t, result.Stopped)
+	assert.False(t, result.Interrupted)
+	assert.Equal(t, 20, result.Deleted)
+}
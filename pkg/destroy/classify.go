@@ -0,0 +1,176 @@
+package destroy
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+)
+
+// ErrorClass classifies why updating the state of or destroying a resource has failed.
+type ErrorClass int
+
+const (
+	// ErrorClassUnknown is an error that isn't classified (it might be worth retrying).
+	ErrorClassUnknown ErrorClass = iota
+	// ErrorClassDependencyViolation means that the resource is still in use by another resource.
+	ErrorClassDependencyViolation
+	// ErrorClassThrottled means that the AWS API has throttled requests.
+	ErrorClassThrottled
+	// ErrorClassNotImportable means that the resource can't be imported (i.e., its state can't be read).
+	ErrorClassNotImportable
+	// ErrorClassAlreadyGone means that the resource has already been deleted.
+	ErrorClassAlreadyGone
+	// ErrorClassPermissionDenied means that the credentials are not allowed to perform the operation.
+	ErrorClassPermissionDenied
+	// ErrorClassCredentialsExpired means that the AWS credentials have expired.
+	ErrorClassCredentialsExpired
+	// ErrorClassProviderCrashed means that the provider plugin has crashed or the connection to it is lost.
+	ErrorClassProviderCrashed
+	// ErrorClassCanceled means that the operation has been canceled (e.g., by Ctrl-C).
+	ErrorClassCanceled
+	// ErrorClassUnsupportedType means that the type of the resource isn't supported by its provider
+	// (see UnsupportedTypeError).
+	ErrorClassUnsupportedType
+	// ErrorClassSchemaVersionNewer means that the schema version of the resource recorded in the state is newer
+	// than the one of its provider (see SchemaVersionError).
+	ErrorClassSchemaVersionNewer
+	// ErrorClassManualActionRequired means that a setting of the resource needs to be changed by hand before
+	// it can be destroyed, such as MFA delete or object lock of an S3 bucket (see ManualActionError), or that
+	// disabling its protection would replace it (see provider.ErrRequiresReplace).
+	ErrorClassManualActionRequired
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassDependencyViolation:
+		return "dependency violation"
+	case ErrorClassThrottled:
+		return "throttled"
+	case ErrorClassNotImportable:
+		return "not importable"
+	case ErrorClassAlreadyGone:
+		return "already gone"
+	case ErrorClassPermissionDenied:
+		return "permission denied"
+	case ErrorClassCredentialsExpired:
+		return "credentials expired"
+	case ErrorClassProviderCrashed:
+		return "provider crashed"
+	case ErrorClassCanceled:
+		return "canceled"
+	case ErrorClassUnsupportedType:
+		return "type not supported by provider"
+	case ErrorClassSchemaVersionNewer:
+		return "schema version newer than provider"
+	case ErrorClassManualActionRequired:
+		return "requires manual action: MFA delete/object lock"
+	default:
+		return "unknown"
+	}
+}
+
+// Retryable returns true if it is worth retrying to destroy a resource that failed with an error of this class.
+func (c ErrorClass) Retryable() bool {
+	switch c {
+	case ErrorClassUnknown, ErrorClassDependencyViolation, ErrorClassThrottled:
+		return true
+	default:
+		return false
+	}
+}
+
+//nolint:gochecknoglobals
+var (
+	// errorClassMessages lists per class parts of error messages returned by the provider, the AWS API,
+	// or the GRPC transport to the provider plugin. Classes are checked in this order.
+	errorClassMessages = []struct {
+		class    ErrorClass
+		messages []string
+	}{
+		{ErrorClassCredentialsExpired, credentialsExpiredErrors},
+		{ErrorClassProviderCrashed, []string{
+			"code = Unavailable",
+			"transport is closing",
+			"plugin exited",
+			"connection is shut down",
+			"error reading from server: EOF",
+		}},
+		{ErrorClassManualActionRequired, append(s3MFADeleteErrors, s3ObjectLockErrors...)},
+		{ErrorClassPermissionDenied, []string{
+			"AccessDenied",
+			"UnauthorizedOperation",
+			"AuthorizationError",
+			"is not authorized to perform",
+		}},
+		{ErrorClassNotImportable, []string{
+			"doesn't support import",
+			"no resource found to be imported",
+			"Cannot import non-existent remote object",
+		}},
+		{ErrorClassAlreadyGone, []string{
+			"NoSuchEntity",
+			"NoSuchBucket",
+			"ResourceNotFoundException",
+			"NotFoundException",
+			".NotFound",
+		}},
+		{ErrorClassDependencyViolation, []string{
+			"DependencyViolation",
+			"DeleteConflict",
+			"ResourceInUse",
+			"has a dependent object",
+			"BucketNotEmpty",
+		}},
+	}
+)
+
+// Classify returns the class of an error returned by updating the state of or destroying a resource.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassCanceled
+	}
+
+	if errors.Is(err, ErrResourceGone) {
+		return ErrorClassAlreadyGone
+	}
+
+	var credentialsExpiredErr *CredentialsExpiredError
+	if errors.As(err, &credentialsExpiredErr) {
+		return ErrorClassCredentialsExpired
+	}
+
+	var unsupportedTypeErr *UnsupportedTypeError
+	if errors.As(err, &unsupportedTypeErr) {
+		return ErrorClassUnsupportedType
+	}
+
+	var schemaVersionErr *SchemaVersionError
+	if errors.As(err, &schemaVersionErr) {
+		return ErrorClassSchemaVersionNewer
+	}
+
+	var manualActionErr *ManualActionError
+	if errors.As(err, &manualActionErr) || errors.Is(err, provider.ErrRequiresReplace) {
+		return ErrorClassManualActionRequired
+	}
+
+	for _, c := range errorClassMessages {
+		for _, msg := range c.messages {
+			if strings.Contains(err.Error(), msg) {
+				return c.class
+			}
+		}
+	}
+
+	if provider.IsThrottled(err) {
+		return ErrorClassThrottled
+	}
+
+	return ErrorClassUnknown
+}
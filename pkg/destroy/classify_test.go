@@ -0,0 +1,186 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedClass destroy.ErrorClass
+	}{
+		{
+			name: "dependency violation",
+			err: fmt.Errorf("Error deleting VPC: DependencyViolation: The vpc 'vpc-0123456789abcdef0' has " +
+				"dependencies and cannot be deleted.\n\tstatus code: 400, request id: 1234"),
+			expectedClass: destroy.ErrorClassDependencyViolation,
+		},
+		{
+			name: "IAM delete conflict",
+			err: fmt.Errorf("error deleting IAM policy arn:aws:iam::123456789012:policy/test: DeleteConflict: " +
+				"Cannot delete a policy attached to entities.\n\tstatus code: 409, request id: 1234"),
+			expectedClass: destroy.ErrorClassDependencyViolation,
+		},
+		{
+			name: "bucket not empty",
+			err: fmt.Errorf("error deleting S3 Bucket (test): BucketNotEmpty: The bucket you tried to delete " +
+				"is not empty. You must delete all versions in the bucket.\n\tstatus code: 409, request id: 1234"),
+			expectedClass: destroy.ErrorClassDependencyViolation,
+		},
+		{
+			name:          "throttled",
+			err:           fmt.Errorf("Error deleting subnet: RequestLimitExceeded: Request limit exceeded."),
+			expectedClass: destroy.ErrorClassThrottled,
+		},
+		{
+			name:          "throttled (Throttling)",
+			err:           fmt.Errorf("error deleting IAM Role (test): Throttling: Rate exceeded"),
+			expectedClass: destroy.ErrorClassThrottled,
+		},
+		{
+			name:          "not importable",
+			err:           fmt.Errorf("resource aws_iam_role_policy_attachment doesn't support import"),
+			expectedClass: destroy.ErrorClassNotImportable,
+		},
+		{
+			name:          "no resource found to be imported",
+			err:           fmt.Errorf("no resource found to be imported"),
+			expectedClass: destroy.ErrorClassNotImportable,
+		},
+		{
+			name: "already gone",
+			err: fmt.Errorf("Error deleting security group: InvalidGroup.NotFound: The security group " +
+				"'sg-0123456789abcdef0' does not exist\n\tstatus code: 400, request id: 1234"),
+			expectedClass: destroy.ErrorClassAlreadyGone,
+		},
+		{
+			name:          "already gone (IAM)",
+			err:           fmt.Errorf("NoSuchEntity: The role with name test cannot be found."),
+			expectedClass: destroy.ErrorClassAlreadyGone,
+		},
+		{
+			name:          "already gone (API Gateway)",
+			err:           fmt.Errorf("error deleting API Gateway: NotFoundException: Invalid REST API identifier specified"),
+			expectedClass: destroy.ErrorClassAlreadyGone,
+		},
+		{
+			name:          "already gone (state updated)",
+			err:           destroy.ErrResourceGone,
+			expectedClass: destroy.ErrorClassAlreadyGone,
+		},
+		{
+			name: "permission denied (EC2)",
+			err: fmt.Errorf("Error deleting VPC: UnauthorizedOperation: You are not authorized to perform " +
+				"this operation.\n\tstatus code: 403, request id: 1234"),
+			expectedClass: destroy.ErrorClassPermissionDenied,
+		},
+		{
+			name: "permission denied (IAM)",
+			err: fmt.Errorf("AccessDenied: User: arn:aws:iam::123456789012:user/test is not authorized to perform: " +
+				"iam:DeleteRole on resource: role test\n\tstatus code: 403, request id: 1234"),
+			expectedClass: destroy.ErrorClassPermissionDenied,
+		},
+		{
+			name:          "permission denied (JSON API)",
+			err:           fmt.Errorf("AccessDeniedException: User is not authorized to perform: kms:ScheduleKeyDeletion"),
+			expectedClass: destroy.ErrorClassPermissionDenied,
+		},
+		{
+			name:          "credentials expired",
+			err:           fmt.Errorf("ExpiredToken: The security token included in the request is expired"),
+			expectedClass: destroy.ErrorClassCredentialsExpired,
+		},
+		{
+			name:          "credentials expired (wrapped)",
+			err:           &destroy.CredentialsExpiredError{Err: fmt.Errorf("some error")},
+			expectedClass: destroy.ErrorClassCredentialsExpired,
+		},
+		{
+			name:          "provider crashed",
+			err:           fmt.Errorf("rpc error: code = Unavailable desc = transport is closing"),
+			expectedClass: destroy.ErrorClassProviderCrashed,
+		},
+		{
+			name:          "provider plugin exited",
+			err:           fmt.Errorf("plugin exited before we could connect"),
+			expectedClass: destroy.ErrorClassProviderCrashed,
+		},
+		{
+			name:          "canceled",
+			err:           fmt.Errorf("failed to read current state of resource: %w", context.Canceled),
+			expectedClass: destroy.ErrorClassCanceled,
+		},
+		{
+			name:          "step error",
+			err:           &destroy.StepError{Step: "disable", Err: fmt.Errorf("AccessDenied: not allowed")},
+			expectedClass: destroy.ErrorClassPermissionDenied,
+		},
+		{
+			name:          "unsupported type",
+			err:           &destroy.UnsupportedTypeError{Type: "aws_foo", Provider: "aws", Version: "v3.42.0"},
+			expectedClass: destroy.ErrorClassUnsupportedType,
+		},
+		{
+			name: "schema version newer",
+			err: &destroy.SchemaVersionError{Err: fmt.Errorf("failed to read resource"), StateVersion: 2,
+				ProviderSchemaVersion: 1, Provider: "aws", Version: "v3.42.0"},
+			expectedClass: destroy.ErrorClassSchemaVersionNewer,
+		},
+		{
+			name: "MFA delete",
+			err: fmt.Errorf("error deleting S3 Bucket (test): AccessDenied: Mfa Authentication must be used " +
+				"for this request\n\tstatus code: 403, request id: 1234"),
+			expectedClass: destroy.ErrorClassManualActionRequired,
+		},
+		{
+			name: "object lock",
+			err: fmt.Errorf("error deleting S3 Bucket (test): AccessDenied: Access Denied because object " +
+				"protected by object lock.\n\tstatus code: 403, request id: 1234"),
+			expectedClass: destroy.ErrorClassManualActionRequired,
+		},
+		{
+			name: "manual action",
+			err: &destroy.ManualActionError{Err: fmt.Errorf("BucketNotEmpty"), Setting: "MFA delete",
+				Remediation: "disable MFA delete"},
+			expectedClass: destroy.ErrorClassManualActionRequired,
+		},
+		{
+			name:          "update would replace resource",
+			err:           fmt.Errorf("failed to plan update: %w (due to name)", provider.ErrRequiresReplace),
+			expectedClass: destroy.ErrorClassManualActionRequired,
+		},
+		{
+			name:          "unknown",
+			err:           fmt.Errorf("destroy timed out (30s)"),
+			expectedClass: destroy.ErrorClassUnknown,
+		},
+		{
+			name:          "nil",
+			expectedClass: destroy.ErrorClassUnknown,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedClass, destroy.Classify(tc.err))
+		})
+	}
+}
+
+func TestErrorClass_Retryable(t *testing.T) {
+	assert.True(t, destroy.ErrorClassUnknown.Retryable())
+	assert.True(t, destroy.ErrorClassDependencyViolation.Retryable())
+	assert.True(t, destroy.ErrorClassThrottled.Retryable())
+
+	assert.False(t, destroy.ErrorClassPermissionDenied.Retryable())
+	assert.False(t, destroy.ErrorClassCredentialsExpired.Retryable())
+	assert.False(t, destroy.ErrorClassProviderCrashed.Retryable())
+	assert.False(t, destroy.ErrorClassCanceled.Retryable())
+	assert.False(t, destroy.ErrorClassManualActionRequired.Retryable())
+}
@@ -0,0 +1,50 @@
+package destroy
+
+import (
+	"context"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// disableCloudFrontDistribution disables a CloudFront distribution and waits until the change is deployed,
+// as an enabled distribution can't be deleted. Returns the new state of the distribution.
+func (r Resource) disableCloudFrontDistribution(ctx context.Context) (cty.Value, error) {
+	state := *r.State()
+
+	enabled := state.GetAttr("enabled")
+
+	if enabled.IsKnown() && !enabled.IsNull() && enabled.True() {
+		log.WithField("id", r.ID()).Info(internal.Pad("disabling CloudFront distribution"))
+
+		var err error
+
+		state, err = r.update(ctx, map[string]cty.Value{"enabled": cty.False}, cloudFrontTimeout)
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		r.setState(state)
+	}
+
+	log.WithField("id", r.ID()).Info(internal.Pad("waiting for CloudFront distribution to be deployed"))
+
+	err := r.waitFor(ctx, func(state cty.Value) (bool, string) {
+		if state.IsNull() {
+			return true, "deleted"
+		}
+
+		status := state.GetAttr("status")
+		if status.IsNull() || !status.IsKnown() {
+			return false, ""
+		}
+
+		return status.AsString() == "Deployed", status.AsString()
+	}, cloudFrontTimeout)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	return state, nil
+}
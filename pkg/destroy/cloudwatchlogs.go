@@ -0,0 +1,233 @@
+package destroy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ValidLogRetentionDays are the numbers of days the retention of CloudWatch log groups can be set to
+// (see Options.LogRetentionDays).
+//
+//nolint:gochecknoglobals
+var ValidLogRetentionDays = []int{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557,
+	2922, 3288, 3653}
+
+// implicitLogGroups is a TypeHandler that deletes the CloudWatch log groups a resource has created implicitly
+// (e.g., /aws/lambda/<function name> of a Lambda function) after the resource has been destroyed, since they
+// aren't part of the state. If Options.LogRetentionDays is set, their retention is set instead.
+type implicitLogGroups struct {
+	// names returns the names of the log groups the resource has created (by convention).
+	names func(Resource) []string
+}
+
+// Name implements TypeHandler.
+func (h implicitLogGroups) Name() string {
+	return "clean up log groups"
+}
+
+// Applies implements TypeHandler.
+func (h implicitLogGroups) Applies(r Resource) bool {
+	return (r.Options.DeleteLogGroups || r.Options.LogRetentionDays > 0) && len(h.names(r)) > 0
+}
+
+// Describe implements TypeHandler.
+func (h implicitLogGroups) Describe(r Resource) string {
+	if r.Options.LogRetentionDays > 0 {
+		return fmt.Sprintf("delete, set retention of implicit log groups to %d days", r.Options.LogRetentionDays)
+	}
+
+	return "delete, delete implicit log groups"
+}
+
+// PreDelete implements TypeHandler.
+func (h implicitLogGroups) PreDelete(_ context.Context, r Resource) (cty.Value, error) {
+	return *r.State(), nil
+}
+
+// PostDelete implements TypeHandler; log groups that don't exist (e.g., of a function that has never been invoked)
+// are skipped.
+func (h implicitLogGroups) PostDelete(ctx context.Context, r Resource) error {
+	names, err := r.existingLogGroups(ctx, h.names(r))
+	if err != nil {
+		return err
+	}
+
+	client := cloudwatchlogs.New(r.Options.AWSSession)
+
+	for _, name := range names {
+		auxType, id := r.logGroupAuxiliary(name)
+
+		if r.Options.LogRetentionDays > 0 {
+			_, err = client.PutRetentionPolicyWithContext(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+				LogGroupName:    aws.String(name),
+				RetentionInDays: aws.Int64(int64(r.Options.LogRetentionDays)),
+			})
+			if err != nil {
+				err = fmt.Errorf("failed to set retention of log group: %s", err)
+			}
+		} else {
+			_, err = client.DeleteLogGroupWithContext(ctx, &cloudwatchlogs.DeleteLogGroupInput{
+				LogGroupName: aws.String(name),
+			})
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+				continue
+			}
+
+			if err != nil {
+				err = fmt.Errorf("failed to delete log group: %s", err)
+			}
+		}
+
+		ReportAuxiliary(ctx, r.newAuxiliaryDeletion(auxType, id, err))
+
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{"id": r.ID(), "log_group": name}).Debug(internal.Pad("cleaned up implicit log group"))
+	}
+
+	return nil
+}
+
+// PredictAuxiliaries implements AuxiliaryPredictor.
+func (h implicitLogGroups) PredictAuxiliaries(ctx context.Context, r Resource) ([]AuxiliaryDeletion, error) {
+	names, err := r.existingLogGroups(ctx, h.names(r))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []AuxiliaryDeletion
+
+	for _, name := range names {
+		auxType, id := r.logGroupAuxiliary(name)
+
+		result = append(result, AuxiliaryDeletion{Parent: r.Address(), Type: auxType, ID: id,
+			Outcome: AuxiliaryWouldBeDeleted})
+	}
+
+	return result, nil
+}
+
+// logGroupAuxiliary returns how a log group is reported as an auxiliary resource, depending on whether
+// it is deleted or its retention is set.
+func (r Resource) logGroupAuxiliary(name string) (string, string) {
+	if r.Options.LogRetentionDays > 0 {
+		return auxiliaryLogGroupRetention, fmt.Sprintf("%s (%d days)", name, r.Options.LogRetentionDays)
+	}
+
+	return auxiliaryLogGroup, name
+}
+
+// existingLogGroups returns the log groups with the given names that exist.
+func (r Resource) existingLogGroups(ctx context.Context, names []string) ([]string, error) {
+	if r.Options.AWSSession == nil {
+		return nil, fmt.Errorf("AWS session to clean up log groups is not configured")
+	}
+
+	client := cloudwatchlogs.New(r.Options.AWSSession)
+
+	var result []string
+
+	for _, name := range names {
+		found := false
+
+		// log groups can only be looked up by prefix (e.g., /aws/lambda/test also matches /aws/lambda/test-2)
+		err := client.DescribeLogGroupsPagesWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+			LogGroupNamePrefix: aws.String(name),
+		}, func(page *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+			for _, g := range page.LogGroups {
+				if aws.StringValue(g.LogGroupName) == name {
+					found = true
+				}
+			}
+
+			return !found
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe log groups: %s", err)
+		}
+
+		if found {
+			result = append(result, name)
+		}
+	}
+
+	return result, nil
+}
+
+// lambdaLogGroups returns the log group a Lambda function writes to by default.
+func (r Resource) lambdaLogGroups() []string {
+	name := stateString(r, "function_name")
+	if name == "" {
+		name = r.ID()
+	}
+
+	return []string{"/aws/lambda/" + name}
+}
+
+// ecsLogGroups returns the log groups that the containers of an ECS task definition create via the awslogs
+// log driver (i.e., if the awslogs-create-group option is set); other log groups must exist beforehand.
+func (r Resource) ecsLogGroups() []string {
+	var containers []struct {
+		LogConfiguration *struct {
+			LogDriver string            `json:"logDriver"`
+			Options   map[string]string `json:"options"`
+		} `json:"logConfiguration"`
+	}
+
+	if err := json.Unmarshal([]byte(stateString(r, "container_definitions")), &containers); err != nil {
+		return nil
+	}
+
+	var result []string
+
+	seen := map[string]bool{}
+
+	for _, c := range containers {
+		if c.LogConfiguration == nil || c.LogConfiguration.LogDriver != "awslogs" ||
+			c.LogConfiguration.Options["awslogs-create-group"] != "true" {
+			continue
+		}
+
+		name := c.LogConfiguration.Options["awslogs-group"]
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		result = append(result, name)
+	}
+
+	return result
+}
+
+// flowLogGroups returns the log group a VPC flow log publishes to, which is created by the flow log
+// if it doesn't exist.
+func (r Resource) flowLogGroups() []string {
+	if name := stateString(r, "log_group_name"); name != "" {
+		return []string{name}
+	}
+
+	if destinationType := stateString(r, "log_destination_type"); destinationType != "" &&
+		destinationType != "cloud-watch-logs" {
+		return nil
+	}
+
+	// e.g., arn:aws:logs:us-east-1:123456789012:log-group:flow-logs:*
+	parts := strings.SplitN(stateString(r, "log_destination"), ":log-group:", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil
+	}
+
+	return []string{strings.TrimSuffix(parts[1], ":*")}
+}
@@ -0,0 +1,246 @@
+package destroy_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// logGroups is a fake CloudWatch Logs API with the given log groups.
+type logGroups struct {
+	mu        sync.Mutex
+	names     []string
+	deleted   []string
+	retention map[string]int64
+}
+
+func (l *logGroups) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var input struct {
+		LogGroupName       string
+		LogGroupNamePrefix string
+		RetentionInDays    int64
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch strings.TrimPrefix(req.Header.Get("X-Amz-Target"), "Logs_20140328.") {
+	case "DescribeLogGroups":
+		var groups []string
+
+		for _, name := range l.names {
+			if strings.HasPrefix(name, input.LogGroupNamePrefix) {
+				groups = append(groups, fmt.Sprintf(`{"logGroupName":%q}`, name))
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, `{"logGroups":[%s]}`, strings.Join(groups, ","))
+	case "DeleteLogGroup":
+		l.deleted = append(l.deleted, input.LogGroupName)
+		_, _ = fmt.Fprint(w, `{}`)
+	case "PutRetentionPolicy":
+		l.retention[input.LogGroupName] = input.RetentionInDays
+		_, _ = fmt.Fprint(w, `{}`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestResource_Destroy_ImplicitLogGroups(t *testing.T) {
+	tests := []struct {
+		name              string
+		options           destroy.Options
+		expectedDeleted   []string
+		expectedRetention map[string]int64
+		expectedAuxiliary []destroy.AuxiliaryDeletion
+	}{
+		{
+			name:    "disabled",
+			options: destroy.Options{},
+		},
+		{
+			name:            "delete",
+			options:         destroy.Options{DeleteLogGroups: true},
+			expectedDeleted: []string{"/aws/lambda/test"},
+			expectedAuxiliary: []destroy.AuxiliaryDeletion{{Parent: "aws_lambda_function.test",
+				Type: "cloudwatch log group", ID: "/aws/lambda/test", Outcome: destroy.AuxiliaryDeleted}},
+		},
+		{
+			name:              "set retention",
+			options:           destroy.Options{LogRetentionDays: 7},
+			expectedRetention: map[string]int64{"/aws/lambda/test": 7},
+			expectedAuxiliary: []destroy.AuxiliaryDeletion{{Parent: "aws_lambda_function.test",
+				Type: "cloudwatch log group retention", ID: "/aws/lambda/test (7 days)", Outcome: destroy.AuxiliaryDeleted}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// the log group of a function with a similar name must be left alone
+			groups := &logGroups{names: []string{"/aws/lambda/test-2", "/aws/lambda/test"}, retention: map[string]int64{}}
+
+			function, stub := lambdaFunction(t)
+			function.Options = tc.options
+			function.Options.AWSSession = awsSession(t, groups)
+
+			events := &recordedEvents{}
+
+			result := destroy.Run(context.Background(), []destroy.DestroyableResource{function}, 1, events)
+
+			assert.Empty(t, result.Failed)
+			assert.Equal(t, []string{"aws_lambda_function.test"}, stub.Destroyed())
+			assert.Equal(t, tc.expectedDeleted, groups.deleted)
+			assert.Equal(t, len(tc.expectedRetention), len(groups.retention))
+
+			for name, days := range tc.expectedRetention {
+				assert.Equal(t, days, groups.retention[name])
+			}
+
+			assert.Equal(t, tc.expectedAuxiliary, events.auxiliaries)
+		})
+	}
+}
+
+func TestResource_PredictAuxiliaries_ImplicitLogGroups(t *testing.T) {
+	groups := &logGroups{names: []string{"/aws/lambda/test"}, retention: map[string]int64{}}
+
+	function, _ := lambdaFunction(t)
+	function.Options = destroy.Options{DeleteLogGroups: true, AWSSession: awsSession(t, groups)}
+
+	actual, err := function.PredictAuxiliaries(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []destroy.AuxiliaryDeletion{{Parent: "aws_lambda_function.test", Type: "cloudwatch log group",
+		ID: "/aws/lambda/test", Outcome: destroy.AuxiliaryWouldBeDeleted}}, actual)
+	assert.Empty(t, groups.deleted)
+
+	groups.names = nil
+
+	actual, err = function.PredictAuxiliaries(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, actual, "log groups that don't exist must not be predicted")
+}
+
+func TestResource_PredictAuxiliaries_ImplicitLogGroupNames(t *testing.T) {
+	containers := `[
+		{"name":"app","logConfiguration":{"logDriver":"awslogs",
+			"options":{"awslogs-group":"/ecs/app","awslogs-create-group":"true"}}},
+		{"name":"sidecar","logConfiguration":{"logDriver":"awslogs","options":{"awslogs-group":"/ecs/shared"}}}
+	]`
+
+	tests := []struct {
+		name          string
+		terraformType string
+		state         map[string]cty.Value
+		expectedIDs   []string
+	}{
+		{
+			name:          "lambda function",
+			terraformType: "aws_lambda_function",
+			state:         map[string]cty.Value{"function_name": cty.StringVal("test")},
+			expectedIDs:   []string{"/aws/lambda/test"},
+		},
+		{
+			name:          "ecs task definition",
+			terraformType: "aws_ecs_task_definition",
+			state:         map[string]cty.Value{"container_definitions": cty.StringVal(containers)},
+			// log groups that aren't created by the task definition must exist beforehand
+			expectedIDs: []string{"/ecs/app"},
+		},
+		{
+			name:          "flow log to cloudwatch logs",
+			terraformType: "aws_flow_log",
+			state: map[string]cty.Value{
+				"log_destination_type": cty.StringVal("cloud-watch-logs"),
+				"log_destination":      cty.StringVal("arn:aws:logs:us-east-1:123456789012:log-group:flow-logs:*"),
+			},
+			expectedIDs: []string{"flow-logs"},
+		},
+		{
+			name:          "flow log to s3",
+			terraformType: "aws_flow_log",
+			state: map[string]cty.Value{
+				"log_destination_type": cty.StringVal("s3"),
+				"log_destination":      cty.StringVal("arn:aws:s3:::flow-logs"),
+			},
+		},
+	}
+
+	groups := &logGroups{names: []string{"/aws/lambda/test", "/ecs/app", "/ecs/shared", "flow-logs"}}
+	sess := awsSession(t, groups)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state := cty.ObjectVal(tc.state)
+
+			r := destroy.NewWithState(tc.terraformType+".test", tc.terraformType, "test", nil, nil, &state)
+			r.Options = destroy.Options{DeleteLogGroups: true, AWSSession: sess}
+
+			actual, err := r.PredictAuxiliaries(context.Background())
+			require.NoError(t, err)
+
+			var actualIDs []string
+			for _, d := range actual {
+				actualIDs = append(actualIDs, d.ID)
+			}
+
+			assert.Equal(t, tc.expectedIDs, actualIDs)
+		})
+	}
+}
+
+// lambdaFunction returns the Lambda function test, whose log group is /aws/lambda/test.
+func lambdaFunction(t *testing.T) (*destroy.Resource, *provider.Stub) {
+	stub := provider.NewStub(provider.StubConfig{}, []string{"aws_lambda_function"})
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return stub, nil
+		},
+	})
+	require.NoError(t, err)
+
+	state := cty.ObjectVal(map[string]cty.Value{
+		"id":            cty.StringVal("test"),
+		"function_name": cty.StringVal("test"),
+	})
+
+	return destroy.NewWithState("aws_lambda_function.test", "aws_lambda_function", "test", nil, tp, &state), stub
+}
+
+// awsSession returns a session whose calls are served by the given handler.
+func awsSession(t *testing.T, handler http.Handler) *session.Session {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	return sess
+}
@@ -0,0 +1,307 @@
+package destroy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+)
+
+const (
+	// throttleCooldown is the amount of time after the concurrency has been reduced in which further throttles
+	// don't reduce it again, since operations already in flight are throttled by the same burst.
+	throttleCooldown = 5 * time.Second
+
+	// rampUpInterval is the amount of time without throttles after which the concurrency is increased by one.
+	rampUpInterval = 30 * time.Second
+
+	// minBackoff and maxBackoff limit the amount of time no new operation is started after a throttle;
+	// the backoff doubles with every reduction of the concurrency until the concurrency is increased again.
+	minBackoff = 1 * time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Concurrency limits the number of concurrent destroy operations and adapts the limit to throttling of the
+// AWS API: starting at the configured maximum, the limit is halved (and new operations are delayed by a backoff)
+// when requests are throttled, and increased by one after each rampUpInterval without throttles.
+//
+// Throttles are recorded from the errors of destroy operations and can also be reported by the providers
+// (see provider.Config.Throttled), which retry throttled requests themselves. A Concurrency can be shared
+// by the runs of a destroy (see Config.Concurrency).
+type Concurrency struct {
+	mu sync.Mutex
+
+	max      int
+	limit    int
+	inFlight int
+
+	throttles    int
+	lastDecrease time.Time
+	// calmSince is the time of the last throttle or the last increase of the limit.
+	calmSince    time.Time
+	backoff      time.Duration
+	backoffUntil time.Time
+
+	// paused is true while no operation is started (see pause).
+	paused bool
+
+	// changed is closed (and replaced) whenever an operation might be started.
+	changed chan struct{}
+}
+
+// NewConcurrency returns a Concurrency that allows at most max concurrent operations (defaults to 10 if zero).
+func NewConcurrency(max int) *Concurrency {
+	if max < 1 {
+		max = defaultParallel
+	}
+
+	return &Concurrency{max: max, limit: max, changed: make(chan struct{})}
+}
+
+// Max returns the maximum (i.e., configured) number of concurrent operations.
+func (c *Concurrency) Max() int {
+	return c.max
+}
+
+// Limit returns the current (i.e., effective) number of concurrent operations.
+func (c *Concurrency) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.limit
+}
+
+// Throttles returns the number of throttles recorded so far.
+func (c *Concurrency) Throttles() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.throttles
+}
+
+// Backoff returns the amount of time after the given time until new operations are started again.
+func (c *Concurrency) Backoff(at time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if at.After(c.backoffUntil) {
+		return 0
+	}
+
+	return c.backoffUntil.Sub(at)
+}
+
+// Throttled records that a request has been throttled at the given time. The limit is halved,
+// unless it already has been within throttleCooldown.
+func (c *Concurrency) Throttled(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.throttles++
+	c.calmSince = at
+
+	if !c.lastDecrease.IsZero() && at.Sub(c.lastDecrease) < throttleCooldown {
+		return
+	}
+
+	c.lastDecrease = at
+
+	c.limit /= 2
+	if c.limit < 1 {
+		c.limit = 1
+	}
+
+	c.backoff *= 2
+	if c.backoff < minBackoff {
+		c.backoff = minBackoff
+	}
+
+	if c.backoff > maxBackoff {
+		c.backoff = maxBackoff
+	}
+
+	c.backoffUntil = at.Add(c.backoff)
+
+	log.WithFields(log.Fields{
+		"concurrency": c.limit,
+		"backoff":     c.backoff,
+	}).Info(internal.Pad("requests throttled by AWS API; reducing concurrency"))
+
+	c.notify()
+}
+
+// Succeeded records that an operation finished without being throttled at the given time. The limit
+// is increased by one if there hasn't been a throttle (or an increase) for rampUpInterval.
+func (c *Concurrency) Succeeded(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.limit >= c.max || c.calmSince.IsZero() || at.Sub(c.calmSince) < rampUpInterval {
+		return
+	}
+
+	c.limit++
+	c.calmSince = at
+	c.backoff = 0
+
+	log.WithField("concurrency", c.limit).Debug(internal.Pad("increasing concurrency"))
+
+	c.notify()
+}
+
+// acquire waits until another operation can be started (or the context is done).
+func (c *Concurrency) acquire(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+
+		if err := ctx.Err(); err != nil {
+			c.mu.Unlock()
+
+			return err
+		}
+
+		wait := time.Until(c.backoffUntil)
+
+		if c.inFlight < c.limit && wait <= 0 && !c.paused {
+			c.inFlight++
+			c.mu.Unlock()
+
+			return nil
+		}
+
+		changed := c.changed
+		c.mu.Unlock()
+
+		var (
+			timer   *time.Timer
+			backoff <-chan time.Time
+		)
+
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			backoff = timer.C
+		}
+
+		select {
+		case <-changed:
+		case <-backoff:
+		case <-ctx.Done():
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// pause stops starting further operations until resume is called; operations in flight continue.
+func (c *Concurrency) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = true
+}
+
+// resume starts operations again after pause.
+func (c *Concurrency) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = false
+	c.notify()
+}
+
+// idle waits until no operation is in flight anymore (or the context is done).
+func (c *Concurrency) idle(ctx context.Context) {
+	for {
+		c.mu.Lock()
+
+		if c.inFlight == 0 || ctx.Err() != nil {
+			c.mu.Unlock()
+
+			return
+		}
+
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// release finishes an operation that returned the given error.
+func (c *Concurrency) release(err error) {
+	switch {
+	case err != nil && Classify(err) == ErrorClassThrottled:
+		c.Throttled(time.Now())
+	case err == nil:
+		c.Succeeded(time.Now())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	c.notify()
+}
+
+// notify wakes up all operations waiting to be started; must be called with the lock held.
+func (c *Concurrency) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// progressEvents logs the progress of a run (the number of destroyed resources and the effective concurrency)
+// every progressInterval.
+//
+// If the context of the run has a deadline (e.g., the end of a deletion window), the time remaining until then
+// is logged, too.
+type progressEvents struct {
+	Events
+
+	concurrency *Concurrency
+	deleted     int64
+}
+
+// ResourceDeleted implements Events.
+func (e *progressEvents) ResourceDeleted(event ResourceEvent) {
+	atomic.AddInt64(&e.deleted, 1)
+	e.Events.ResourceDeleted(event)
+}
+
+// report logs the progress periodically until the returned function is called.
+func (e *progressEvents) report(ctx context.Context) func() {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fields := log.Fields{
+					"deleted":         atomic.LoadInt64(&e.deleted),
+					"concurrency":     e.concurrency.Limit(),
+					"max_concurrency": e.concurrency.Max(),
+				}
+
+				if deadline, ok := ctx.Deadline(); ok {
+					fields["remaining"] = time.Until(deadline).Round(time.Second).String()
+				}
+
+				log.WithFields(fields).Info(internal.Pad("progress"))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
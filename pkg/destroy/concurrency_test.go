@@ -0,0 +1,167 @@
+package destroy_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestConcurrency(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// at returns the time after the given number of seconds since the start
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	type outcome struct {
+		second    int
+		throttled bool
+	}
+
+	tests := []struct {
+		name              string
+		max               int
+		outcomes          []outcome
+		expectedLimit     int
+		expectedThrottles int
+		// expectedBackoff is the remaining backoff after the last outcome
+		expectedBackoff time.Duration
+	}{
+		{
+			name:          "no throttles",
+			max:           10,
+			outcomes:      []outcome{{0, false}, {1, false}, {60, false}},
+			expectedLimit: 10,
+		},
+		{
+			name:              "single throttle",
+			max:               10,
+			outcomes:          []outcome{{0, true}},
+			expectedLimit:     5,
+			expectedThrottles: 1,
+			expectedBackoff:   time.Second,
+		},
+		{
+			name:              "burst of throttles reduces concurrency once",
+			max:               10,
+			outcomes:          []outcome{{0, true}, {0, true}, {1, true}, {4, true}},
+			expectedLimit:     5,
+			expectedThrottles: 4,
+		},
+		{
+			name:              "sustained throttling reduces concurrency and doubles backoff",
+			max:               10,
+			outcomes:          []outcome{{0, true}, {5, true}, {10, true}},
+			expectedLimit:     1,
+			expectedThrottles: 3,
+			expectedBackoff:   4 * time.Second,
+		},
+		{
+			name:              "concurrency doesn't drop below one",
+			max:               2,
+			outcomes:          []outcome{{0, true}, {5, true}, {10, true}},
+			expectedLimit:     1,
+			expectedThrottles: 3,
+			expectedBackoff:   4 * time.Second,
+		},
+		{
+			name:              "no ramp up too early after throttle",
+			max:               10,
+			outcomes:          []outcome{{0, true}, {29, false}},
+			expectedLimit:     5,
+			expectedThrottles: 1,
+		},
+		{
+			name:              "ramp up after period without throttles",
+			max:               10,
+			outcomes:          []outcome{{0, true}, {30, false}, {31, false}, {60, false}},
+			expectedLimit:     7,
+			expectedThrottles: 1,
+		},
+		{
+			name:              "ramp up is reset by throttle",
+			max:               10,
+			outcomes:          []outcome{{0, true}, {30, false}, {50, true}, {79, false}},
+			expectedLimit:     3,
+			expectedThrottles: 2,
+		},
+		{
+			name: "ramp up until configured concurrency",
+			max:  2,
+			outcomes: []outcome{{0, true}, {30, false}, {60, false}, {90, false},
+				{120, false}},
+			expectedLimit:     2,
+			expectedThrottles: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := destroy.NewConcurrency(tc.max)
+
+			for _, o := range tc.outcomes {
+				if o.throttled {
+					c.Throttled(at(o.second))
+				} else {
+					c.Succeeded(at(o.second))
+				}
+			}
+
+			last := at(tc.outcomes[len(tc.outcomes)-1].second)
+
+			assert.Equal(t, tc.expectedLimit, c.Limit())
+			assert.Equal(t, tc.max, c.Max())
+			assert.Equal(t, tc.expectedThrottles, c.Throttles())
+			assert.Equal(t, tc.expectedBackoff, c.Backoff(last))
+		})
+	}
+}
+
+// throttlingProvider is a provider whose destroys are throttled.
+type throttlingProvider struct {
+	*slowProvider
+}
+
+func (p throttlingProvider) ApplyResourceChange(
+	providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	var diags tfdiags.Diagnostics
+
+	return providers.ApplyResourceChangeResponse{
+		Diagnostics: diags.Append(tfdiags.Sourceless(tfdiags.Error, "ThrottlingException: Rate exceeded", "")),
+	}
+}
+
+func TestRun_Throttling(t *testing.T) {
+	var numOfThrottlesReported int
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Millisecond,
+		Factory: func(string, string) (provider.Provider, error) {
+			return throttlingProvider{&slowProvider{}}, nil
+		},
+		Throttled: func() {
+			numOfThrottlesReported++
+		},
+	})
+	require.NoError(t, err)
+
+	state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")})
+
+	result := destroy.Run(context.Background(), []destroy.DestroyableResource{
+		destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-1", nil, tp, &state),
+	}, 10, nil)
+
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, destroy.ErrorClassThrottled, result.Failed[0].Class)
+	assert.Equal(t, &destroy.Throttling{Throttles: 1, Concurrency: 5, MaxConcurrency: 10}, result.Throttling)
+	assert.Positive(t, numOfThrottlesReported, "throttled calls retried by the provider must be reported")
+}
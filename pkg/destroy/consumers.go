@@ -0,0 +1,109 @@
+package destroy
+
+import (
+	"sort"
+
+	"github.com/apex/log"
+)
+
+// Consumer is a resource or data source of another state (a consumer state), which might reference resources
+// that would be destroyed (e.g., a security group rule of another team referencing our VPC via a data source).
+type Consumer struct {
+	// State is the path of the consumer state.
+	State   string
+	Address string
+	// Values are the string values of the attributes recorded in the consumer state by path
+	// (e.g., vpc_id or subnet_ids[0]).
+	Values map[string]string
+}
+
+// ConsumerReference is an attribute of a consumer whose value is the ID or ARN of a resource that would be destroyed.
+type ConsumerReference struct {
+	// Candidate is the address of the resource that would be destroyed.
+	Candidate string
+	// State and Consumer are the path of the consumer state and the address of the referencing resource in it.
+	State    string
+	Consumer string
+	// Attribute is the path of the referencing attribute, and Value is its value (i.e., the ID or ARN).
+	Attribute string
+	Value     string
+}
+
+// FindConsumerReferences returns the attributes of the given consumers that reference resources of the given plan,
+// sorted by candidate, consumer state, and consumer. Only values that are exactly the ID or ARN of a resource
+// are references (i.e., IDs that are only part of a value, such as of a policy document, are never matched),
+// which avoids false positives. The number of references is added to the preview of each referenced resource.
+func FindConsumerReferences(plan *DestroyPlan, consumers []Consumer) []ConsumerReference {
+	// addresses of the resources that would be destroyed by identifying value (i.e., ID or ARN)
+	candidates := map[string][]int{}
+
+	for i, c := range plan.Candidates {
+		for _, value := range identifyingValues(c) {
+			candidates[value] = append(candidates[value], i)
+		}
+	}
+
+	var result []ConsumerReference
+
+	numOfReferences := map[int]int{}
+
+	for _, consumer := range consumers {
+		for attribute, value := range consumer.Values {
+			for _, i := range candidates[value] {
+				result = append(result, ConsumerReference{
+					Candidate: plan.Candidates[i].Address,
+					State:     consumer.State,
+					Consumer:  consumer.Address,
+					Attribute: attribute,
+					Value:     value,
+				})
+
+				numOfReferences[i]++
+			}
+		}
+	}
+
+	for i, n := range numOfReferences {
+		if plan.Candidates[i].Preview == nil {
+			plan.Candidates[i].Preview = log.Fields{}
+		}
+
+		plan.Candidates[i].Preview["referenced_by_consumers"] = n
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+
+		switch {
+		case a.Candidate != b.Candidate:
+			return a.Candidate < b.Candidate
+		case a.State != b.State:
+			return a.State < b.State
+		case a.Consumer != b.Consumer:
+			return a.Consumer < b.Consumer
+		default:
+			return a.Attribute < b.Attribute
+		}
+	})
+
+	return result
+}
+
+// identifyingValues returns the ID and ARN of a resource that would be destroyed (deduplicated).
+func identifyingValues(c PlannedResource) []string {
+	var result []string
+
+	if c.ID != "" {
+		result = append(result, c.ID)
+	}
+
+	if c.Resource == nil {
+		return result
+	}
+
+	if a, ok := c.Resource.ARN(); ok && a.String() != c.ID {
+		result = append(result, a.String())
+	}
+
+	return result
+}
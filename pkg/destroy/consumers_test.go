@@ -0,0 +1,106 @@
+package destroy_test
+
+import (
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestFindConsumerReferences(t *testing.T) {
+	policyState := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("ANPA1234"),
+		"arn": cty.StringVal("arn:aws:iam::123456789012:policy/shared"),
+	})
+
+	newPlan := func() *destroy.DestroyPlan {
+		return &destroy.DestroyPlan{Candidates: []destroy.PlannedResource{
+			{
+				Resource:          destroy.NewWithState("aws_vpc.shared", "aws_vpc", "vpc-1234", nil, nil, nil),
+				ResourceCandidate: destroy.ResourceCandidate{Address: "aws_vpc.shared", ID: "vpc-1234"},
+				Preview:           log.Fields{},
+			},
+			{
+				Resource: destroy.NewWithState("aws_iam_policy.shared", "aws_iam_policy", "ANPA1234", nil, nil,
+					&policyState),
+				ResourceCandidate: destroy.ResourceCandidate{Address: "aws_iam_policy.shared", ID: "ANPA1234"},
+				Preview:           log.Fields{},
+			},
+			{
+				Resource:          destroy.NewWithState("aws_subnet.unused", "aws_subnet", "subnet-1", nil, nil, nil),
+				ResourceCandidate: destroy.ResourceCandidate{Address: "aws_subnet.unused", ID: "subnet-1"},
+				Preview:           log.Fields{},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name               string
+		consumers          []destroy.Consumer
+		expectedReferences []destroy.ConsumerReference
+		expectedPreview    map[string]interface{}
+	}{
+		{
+			name: "no consumers",
+		},
+		{
+			name: "references by ID and ARN",
+			consumers: []destroy.Consumer{
+				{
+					State:   "other.tfstate",
+					Address: "aws_security_group.app",
+					Values:  map[string]string{"id": "sg-5678", "vpc_id": "vpc-1234"},
+				},
+				{
+					State:   "other.tfstate",
+					Address: "data.aws_vpc.shared",
+					Values:  map[string]string{"id": "vpc-1234"},
+				},
+				{
+					State:   "another.tfstate",
+					Address: "aws_iam_role_policy_attachment.app",
+					Values:  map[string]string{"policy_arn": "arn:aws:iam::123456789012:policy/shared"},
+				},
+			},
+			expectedReferences: []destroy.ConsumerReference{
+				{Candidate: "aws_iam_policy.shared", State: "another.tfstate",
+					Consumer: "aws_iam_role_policy_attachment.app", Attribute: "policy_arn",
+					Value: "arn:aws:iam::123456789012:policy/shared"},
+				{Candidate: "aws_vpc.shared", State: "other.tfstate", Consumer: "aws_security_group.app",
+					Attribute: "vpc_id", Value: "vpc-1234"},
+				{Candidate: "aws_vpc.shared", State: "other.tfstate", Consumer: "data.aws_vpc.shared",
+					Attribute: "id", Value: "vpc-1234"},
+			},
+			expectedPreview: map[string]interface{}{"aws_vpc.shared": 2, "aws_iam_policy.shared": 1},
+		},
+		{
+			name: "only exact values",
+			consumers: []destroy.Consumer{
+				{
+					State:   "other.tfstate",
+					Address: "aws_security_group.app",
+					Values: map[string]string{
+						"description": "vpc-1234 is shared",
+						"name":        "subnet-1-app",
+						"policy":      `{"Resource": "arn:aws:iam::123456789012:policy/shared"}`,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := newPlan()
+
+			actual := destroy.FindConsumerReferences(plan, tc.consumers)
+			assert.Equal(t, tc.expectedReferences, actual)
+
+			for _, c := range plan.Candidates {
+				assert.Equal(t, tc.expectedPreview[c.Address], c.Preview["referenced_by_consumers"], c.Address)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package destroy
+
+import "sort"
+
+// ebsCostPerGB is the estimated monthly cost of a GB of an EBS volume (gp2/gp3, in USD).
+const ebsCostPerGB = 0.10
+
+//nolint:gochecknoglobals
+var (
+	// monthlyCosts lists estimated monthly costs (in USD, on-demand pricing of us-east-1) of a resource of a type
+	// for types that are expensive to keep around or commonly forgotten; see Resource.MonthlyCost.
+	monthlyCosts = map[string]float64{
+		"aws_nat_gateway":           32.85,
+		"aws_eks_cluster":           73.00,
+		"aws_db_instance":           125.00,
+		"aws_rds_cluster":           210.00,
+		"aws_rds_cluster_instance":  105.00,
+		"aws_redshift_cluster":      180.00,
+		"aws_elasticsearch_domain":  100.00,
+		"aws_elasticache_cluster":   50.00,
+		"aws_msk_cluster":           150.00,
+		"aws_instance":              30.00,
+		"aws_eks_node_group":        60.00,
+		"aws_lb":                    16.43,
+		"aws_elb":                   18.25,
+		"aws_vpc_endpoint":          7.30,
+		"aws_eip":                   3.65,
+		"aws_kms_key":               1.00,
+		"aws_route53_zone":          0.50,
+		"aws_secretsmanager_secret": 0.40,
+	}
+
+	// sizedMonthlyCosts lists resource types whose estimated monthly costs depend on their size.
+	sizedMonthlyCosts = map[string]func(Resource) (float64, bool){
+		"aws_ebs_volume": Resource.ebsVolumeCost,
+	}
+)
+
+// MonthlyCost returns the estimated monthly cost of a resource (in USD), or false if no pricing data is known
+// for its type.
+func (r Resource) MonthlyCost() (float64, bool) {
+	if cost, ok := sizedMonthlyCosts[r.Type()]; ok {
+		return cost(r)
+	}
+
+	cost, ok := monthlyCosts[r.Type()]
+
+	return cost, ok
+}
+
+// ebsVolumeCost returns the estimated monthly cost of an EBS volume by its size.
+func (r Resource) ebsVolumeCost() (float64, bool) {
+	if r.State() == nil || !r.State().Type().IsObjectType() || !r.State().Type().HasAttribute("size") {
+		return 0, false
+	}
+
+	size := r.State().GetAttr("size")
+	if !size.IsKnown() || size.IsNull() {
+		return 0, false
+	}
+
+	gb, _ := size.AsBigFloat().Float64()
+
+	return gb * ebsCostPerGB, true
+}
+
+// MonthlyCostOf returns the estimated monthly cost of a resource (see Resource.MonthlyCost).
+func MonthlyCostOf(r DestroyableResource) (float64, bool) {
+	if c, ok := r.(interface{ MonthlyCost() (float64, bool) }); ok {
+		return c.MonthlyCost()
+	}
+
+	return 0, false
+}
+
+// orderByCost sorts the given resources by their estimated monthly costs, the most expensive first.
+// Resources without pricing data come last (in their given order).
+func orderByCost(resources []DestroyableResource) {
+	sort.SliceStable(resources, func(i, j int) bool {
+		a, aPriced := MonthlyCostOf(resources[i])
+		b, bPriced := MonthlyCostOf(resources[j])
+
+		switch {
+		case !aPriced:
+			return false
+		case !bPriced:
+			return true
+		default:
+			return a > b
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package destroy_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestResource_MonthlyCost(t *testing.T) {
+	tests := []struct {
+		name           string
+		rType          string
+		state          cty.Value
+		expectedCost   float64
+		expectedPriced bool
+	}{
+		{
+			name:           "priced type",
+			rType:          "aws_nat_gateway",
+			state:          cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("nat-1234")}),
+			expectedCost:   32.85,
+			expectedPriced: true,
+		},
+		{
+			name:  "unpriced type",
+			rType: "aws_subnet",
+			state: cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("subnet-1234")}),
+		},
+		{
+			name:  "EBS volume by size",
+			rType: "aws_ebs_volume",
+			state: cty.ObjectVal(map[string]cty.Value{
+				"id":   cty.StringVal("vol-1234"),
+				"size": cty.NumberIntVal(500),
+			}),
+			expectedCost:   50,
+			expectedPriced: true,
+		},
+		{
+			name:  "EBS volume of unknown size",
+			rType: "aws_ebs_volume",
+			state: cty.ObjectVal(map[string]cty.Value{
+				"id":   cty.StringVal("vol-1234"),
+				"size": cty.NullVal(cty.Number),
+			}),
+		},
+		{
+			name:  "EBS volume without size",
+			rType: "aws_ebs_volume",
+			state: cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vol-1234")}),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := destroy.NewWithState(tc.rType+".test", tc.rType, "test", nil, nil, &tc.state)
+
+			cost, priced := r.MonthlyCost()
+
+			assert.Equal(t, tc.expectedPriced, priced)
+			assert.InDelta(t, tc.expectedCost, cost, 0.001)
+		})
+	}
+}
+
+func TestPlanAndExecute_OrderByCost(t *testing.T) {
+	tests := []struct {
+		name          string
+		orderByCost   bool
+		expectedOrder []string
+	}{
+		{
+			name:        "by cost",
+			orderByCost: true,
+			expectedOrder: []string{"aws_instance.i-1234", "aws_vpc_endpoint.vpce-1234", "aws_eip.eipalloc-1234",
+				"aws_iam_role.role", "aws_subnet.subnet-1234", "aws_vpc.vpc-1234"},
+		},
+		{
+			// by address within a group
+			name: "not by cost",
+			expectedOrder: []string{"aws_eip.eipalloc-1234", "aws_iam_role.role", "aws_instance.i-1234",
+				"aws_vpc_endpoint.vpce-1234", "aws_subnet.subnet-1234", "aws_vpc.vpc-1234"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_vpc", "aws_subnet", "aws_eip",
+				"aws_iam_role", "aws_vpc_endpoint", "aws_instance"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return stub, nil
+				},
+			})
+			require.NoError(t, err)
+
+			resource := func(address, rType, id string, dependencies ...string) *destroy.Resource {
+				state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(id)})
+
+				return destroy.NewWithState(address, rType, id, dependencies, tp, &state)
+			}
+
+			// the instance costs the most, but can only be destroyed in the first group, as can the others
+			// without dependents; the subnet and VPC aren't priced and come after the resources depending on them
+			resources := []*destroy.Resource{
+				resource("aws_vpc.test", "aws_vpc", "vpc-1234"),
+				resource("aws_subnet.test", "aws_subnet", "subnet-1234", "aws_vpc.test"),
+				resource("aws_eip.test", "aws_eip", "eipalloc-1234"),
+				resource("aws_iam_role.test", "aws_iam_role", "role"),
+				resource("aws_vpc_endpoint.test", "aws_vpc_endpoint", "vpce-1234", "aws_vpc.test"),
+				resource("aws_instance.test", "aws_instance", "i-1234", "aws_subnet.test"),
+			}
+
+			config := destroy.Config{Parallel: 1, OrderByCost: tc.orderByCost}
+
+			plan, err := destroy.Plan(context.Background(), fakeState{resources: resources}, nil, config)
+			require.NoError(t, err)
+
+			var ordered []string
+
+			for _, r := range plan.Order() {
+				ordered = append(ordered, r.Type+"."+r.ID)
+			}
+
+			assert.Equal(t, tc.expectedOrder, ordered)
+
+			_, result, err := destroy.PlanAndExecute(context.Background(), fakeState{resources: resources}, nil, config)
+			require.NoError(t, err)
+
+			assert.Equal(t, destroy.Result{Deleted: 6}, result)
+
+			if tc.orderByCost {
+				assert.Equal(t, tc.expectedOrder, stub.Destroyed())
+			}
+		})
+	}
+}
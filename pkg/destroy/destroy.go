@@ -0,0 +1,449 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/trace"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DestroyableResource implementations can destroy a Terraform resource.
+type DestroyableResource interface {
+	Destroy(ctx context.Context) error
+	Type() string
+	ID() string
+	// Address is the absolute address of the resource instance in the state (can be empty if unknown).
+	Address() string
+	// Dependencies returns the addresses of the resource instances this resource depends on.
+	Dependencies() []string
+}
+
+// Result is the result of destroying a list of resources.
+type Result struct {
+	// Deleted is the number of destroyed resources.
+	Deleted int
+	// Failed are the errors of the resources that failed to be destroyed (retries exceeded).
+	Failed []RetryDestroyError
+	// AlreadyGone is the number of resources of the state that didn't exist anymore, so they haven't been
+	// destroyed (see DestroyPlan.AlreadyGone).
+	AlreadyGone int
+	// Interrupted is true if the context was done before all resources have been destroyed.
+	Interrupted bool
+	// Stopped is true if the run has been stopped at a checkpoint (see Config.Checkpoint); it's interrupted, too.
+	Stopped bool
+	// Remaining are the resources that have neither been destroyed nor failed to be destroyed when the run
+	// has been interrupted (e.g., to destroy them with another run).
+	Remaining []DestroyableResource
+	// Throttling shows how the concurrency has been adapted to throttling (nil if no request has been throttled).
+	Throttling *Throttling
+}
+
+// Throttling shows how the concurrency of a run has been adapted to throttling of the AWS API.
+type Throttling struct {
+	// Throttles is the number of throttled requests.
+	Throttles int
+	// Concurrency is the effective number of concurrent operations at the end of the run.
+	Concurrency int
+	// MaxConcurrency is the configured number of concurrent operations.
+	MaxConcurrency int
+}
+
+// throttlingOf returns how the given concurrency has been adapted (nil if no request has been throttled).
+func throttlingOf(c *Concurrency) *Throttling {
+	if c.Throttles() == 0 {
+		return nil
+	}
+
+	return &Throttling{Throttles: c.Throttles(), Concurrency: c.Limit(), MaxConcurrency: c.Max()}
+}
+
+// Run destroys a given list of resources, which may depend on each other.
+//
+// Resources are destroyed in the order of their dependencies, i.e., a resource is destroyed before
+// any of the resources it depends on (see orderByDependencies()).
+//
+// If at least one resource is successfully destroyed per run (iteration through the list of given resources),
+// the remaining, failed resources will be retried in a next run (until all resources are destroyed or
+// some destroys have permanently failed). Resources that failed permanently are retried once more together
+// with the next group of resources to destroy, unless the class of their error isn't worth retrying
+// (e.g., permission denied).
+//
+// If enabled (see Options.BatchDeletes), resources of some types are deleted in batches before the remaining
+// resources of a group are destroyed one by one (see destroyBatches()).
+//
+// At most parallel resources are destroyed concurrently; fewer while the AWS API throttles requests
+// (see Concurrency).
+//
+// Once the context is done, no further resources are destroyed and the result is marked as interrupted.
+//
+// The progress is reported to the given events (which can be nil).
+func Run(ctx context.Context, resources []DestroyableResource, parallel int, events Events) Result {
+	return runWithConcurrency(withMaxRetries(ctx, 0), resources, NewConcurrency(parallel), events)
+}
+
+// runWithConcurrency destroys the given resources as Run, limited by the given concurrency.
+func runWithConcurrency(ctx context.Context, resources []DestroyableResource, concurrency *Concurrency,
+	events Events) Result {
+	progress := &progressEvents{Events: orNoop(events), concurrency: concurrency}
+
+	stop := progress.report(ctx)
+	result := run(ctx, resources, concurrency, progress)
+	stop()
+
+	explainBlockers(ctx, result.Failed, resources)
+
+	progress.RunCompleted(result)
+
+	return result
+}
+
+// run destroys the given resources as Run, but without reporting the completed run.
+func run(ctx context.Context, resources []DestroyableResource, concurrency *Concurrency, events Events) Result {
+	var deletedResources []DestroyableResource
+
+	var failedResources, permanentlyFailedResources []RetryDestroyError
+
+	for _, group := range orderByDependencies(resources) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var retryableResources []RetryDestroyError
+
+		for _, retryErr := range failedResources {
+			if !retryErr.Class.Retryable() {
+				permanentlyFailedResources = append(permanentlyFailedResources, retryErr)
+
+				continue
+			}
+
+			retryableResources = append(retryableResources, retryErr)
+		}
+
+		resourcesToRetry, retriesExceeded := retryPass(ctx, retryableResources)
+		permanentlyFailedResources = append(permanentlyFailedResources, retriesExceeded...)
+		group = append(group, resourcesToRetry...)
+
+		var batchResults []workerResult
+
+		batchResults, group = destroyBatches(ctx, group, concurrency.Max(), events)
+
+		for _, r := range batchResults {
+			deletedResources = append(deletedResources, r.resource)
+		}
+
+		var deletedResourcesInGroup []DestroyableResource
+
+		deletedResourcesInGroup, failedResources = destroyResources(ctx, group, concurrency, events)
+		deletedResources = append(deletedResources, deletedResourcesInGroup...)
+	}
+
+	result := Result{
+		Deleted:    len(deletedResources),
+		Failed:     append(permanentlyFailedResources, failedResources...),
+		Throttling: throttlingOf(concurrency),
+	}
+
+	sortErrorsByAddress(result.Failed)
+
+	if ctx.Err() != nil {
+		result.Interrupted = true
+		result.Remaining = remainingOf(resources, deletedResources, result.Failed)
+		sortDestroyableByAddress(result.Remaining)
+	}
+
+	return result
+}
+
+// destroyResources destroys a given list of resources in parallel and retries failed ones (if their errors are
+// worth retrying) as long as there is progress, but at most as often as the context allows (see withMaxRetries).
+// Returns the destroyed resources and the errors
+// of the resources that failed permanently.
+func destroyResources(ctx context.Context, resources []DestroyableResource, concurrency *Concurrency,
+	events Events) ([]DestroyableResource, []RetryDestroyError) {
+	numOfResourcesToDelete := len(resources)
+
+	var deletedResources []DestroyableResource
+
+	var retryableResourceErrors, otherResourceErrors []RetryDestroyError
+
+	jobQueue := make(chan DestroyableResource, numOfResourcesToDelete)
+
+	workerResults := make(chan workerResult, numOfResourcesToDelete)
+
+	for i := 1; i <= concurrency.Max(); i++ {
+		go workerDestroy(trace.WithWorker(ctx, "destroy worker", i), jobQueue, workerResults, concurrency, events)
+	}
+
+	log.Debug("start distributing resources to workers for this run")
+
+	for _, r := range resources {
+		jobQueue <- r
+	}
+
+	close(jobQueue)
+
+	for i := 1; i <= numOfResourcesToDelete; i++ {
+		result := <-workerResults
+
+		if result.resourceHasBeenDeleted {
+			deletedResources = append(deletedResources, result.resource)
+
+			continue
+		}
+
+		if result.Err != nil && !result.Err.Class.Retryable() {
+			otherResourceErrors = append(otherResourceErrors, *result.Err)
+
+			continue
+		}
+
+		if result.Err != nil {
+			retryableResourceErrors = append(retryableResourceErrors, *result.Err)
+		}
+	}
+
+	// the results arrive in the order in which the workers complete
+	sortErrorsByAddress(retryableResourceErrors)
+	sortErrorsByAddress(otherResourceErrors)
+
+	if len(retryableResourceErrors) > 0 && len(deletedResources) > 0 && ctx.Err() == nil {
+		resourcesToRetry, retriesExceeded := retryPass(ctx, retryableResourceErrors)
+		otherResourceErrors = append(otherResourceErrors, retriesExceeded...)
+
+		if len(resourcesToRetry) == 0 {
+			return deletedResources, otherResourceErrors
+		}
+
+		deletedResourcesInRetry, failedResources := destroyResources(ctx, resourcesToRetry, concurrency, events)
+
+		return append(deletedResources, deletedResourcesInRetry...), append(otherResourceErrors, failedResources...)
+	}
+
+	return deletedResources, append(otherResourceErrors, retryableResourceErrors...)
+}
+
+type workerResult struct {
+	resource               DestroyableResource
+	resourceHasBeenDeleted bool
+	// if set, it is worth retrying to delete this resource
+	Err *RetryDestroyError
+}
+
+// workerDestroy is a worker that destroys a resource as soon as the concurrency allows it.
+// Once the context is done, the remaining resources are skipped; a destroy in flight is only canceled once
+// the grace period of the run is over (see withGracePeriod).
+func workerDestroy(ctx context.Context, resources <-chan DestroyableResource, result chan<- workerResult,
+	concurrency *Concurrency, events Events) {
+	destroyCtx := inFlight(ctx)
+
+	for r := range resources {
+		span := startSpan(ctx, r, "wait for concurrency")
+		err := concurrency.acquire(ctx)
+		span.End(err)
+
+		if err != nil {
+			result <- workerResult{resource: r}
+
+			continue
+		}
+
+		span = startSpan(ctx, r, "destroy")
+		err = r.Destroy(withAuxiliaryEvents(destroyCtx, events))
+		span.End(err)
+
+		concurrency.release(err)
+		if err != nil && destroyCtx.Err() != nil {
+			events.ResourceFailed(newResourceEvent(r, destroyCtx.Err()))
+
+			result <- workerResult{resource: r}
+
+			continue
+		}
+
+		if err != nil {
+			e := newResourceEvent(r, err)
+
+			switch err := err.(type) {
+			case *RetryDestroyError:
+				e.Class = err.Class
+				e.Retryable = err.Class.Retryable()
+				events.ResourceFailed(e)
+
+				result <- workerResult{
+					resource: r,
+					Err:      err,
+				}
+
+			default:
+				events.ResourceFailed(e)
+
+				result <- workerResult{resource: r}
+			}
+
+			continue
+		}
+
+		e := newResourceEvent(r, nil)
+
+		if fp, ok := r.(fieldsProvider); ok {
+			e.Fields = fp.DeletedFields()
+		}
+
+		events.ResourceDeleted(e)
+
+		result <- workerResult{
+			resource:               r,
+			resourceHasBeenDeleted: true,
+		}
+	}
+}
+
+// Destroy destroys a Terraform resource.
+func (r Resource) Destroy(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.State() == nil {
+		return fmt.Errorf("resource state is nil; need to call update first")
+	}
+
+	refreshed := *r.State()
+
+	handlers := r.handlers()
+
+	for _, h := range handlers {
+		span := startSpan(ctx, r, "prepare: "+h.Name())
+		state, err := h.PreDelete(ctx, r)
+		span.End(err)
+
+		if err != nil {
+			err = asStepError(h, err)
+
+			log.WithError(err).WithFields(log.Fields{
+				"id": r.ID(), "type": r.Type()}).Debug(internal.Pad("failed to prepare resource for deletion"))
+
+			return NewRetryDestroyError(err, &r)
+		}
+
+		r.setState(state)
+	}
+
+	state := r.destroyState(*r.State())
+
+	if o := overrides(*r.State(), state); len(o) > 0 {
+		log.WithFields(log.Fields{"id": r.ID(), "type": r.Type(), "overrides": strings.Join(o, ", ")}).
+			Info(internal.Pad("overriding attributes"))
+	}
+
+	span := startSpan(ctx, r, "apply")
+	err := r.destroy(ctx, state)
+	span.End(err)
+
+	if manualAction, ok := manualActions[r.Type()]; ok && err != nil {
+		err = manualAction(r, ctx, refreshed, state, err)
+	}
+
+	if err != nil && (isAlreadyDeleted(r.Type(), err) || Classify(err) == ErrorClassAlreadyGone) {
+		log.WithError(err).WithFields(log.Fields{
+			"id": r.ID(), "type": r.Type()}).Info(internal.Pad("resource has already been deleted"))
+
+		return r.postDelete(ctx, handlers)
+	}
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"id": r.ID(), "type": r.Type()}).Debug(internal.Pad("failed to delete resource"))
+
+		return NewRetryDestroyError(withCredentialsExpired(err), &r)
+	}
+
+	if timeout, ok := asyncDeletionTypes[r.Type()]; ok {
+		err := r.waitUntilDeleted(ctx, timeout)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"id": r.ID(), "type": r.Type()}).Debug(internal.Pad("failed to wait for deletion of resource"))
+
+			return NewRetryDestroyError(err, &r)
+		}
+	}
+
+	return r.postDelete(ctx, handlers)
+}
+
+// postDelete runs the steps of the given handlers after the resource has been destroyed and reports its
+// sub-resources as deleted along with it.
+func (r Resource) postDelete(ctx context.Context, handlers []TypeHandler) error {
+	for _, h := range handlers {
+		span := startSpan(ctx, r, "finish: "+h.Name())
+		err := h.PostDelete(ctx, r)
+		span.End(err)
+
+		if err != nil {
+			err = &StepError{Step: h.Name(), AfterDestroy: true, Err: err}
+
+			log.WithError(err).WithFields(log.Fields{
+				"id": r.ID(), "type": r.Type()}).Debug(internal.Pad("failed to finish deletion of resource"))
+
+			return NewRetryDestroyError(err, &r)
+		}
+	}
+
+	r.reportSubResources(ctx)
+
+	return nil
+}
+
+// destroy destroys a resource with the given state.
+func (r Resource) destroy(ctx context.Context, state cty.Value) error {
+	if destroy, ok := customDestroys[r.Type()]; ok {
+		return destroy(r, ctx, state)
+	}
+
+	return r.destroyWithProvider(ctx, state)
+}
+
+// destroyWithProvider calls the provider to destroy a resource with the given state,
+// using a customized or type-specific timeout if necessary.
+func (r Resource) destroyWithProvider(ctx context.Context, state cty.Value) error {
+	if timeout, ok := r.deleteTimeout(); ok {
+		return r.destroyWithTimeout(ctx, state, timeout)
+	}
+
+	if r.ForceDestroyDisabled() {
+		return r.provider.DestroyResourceWithoutForce(ctx, r.Type(), state)
+	}
+
+	return r.provider.DestroyResource(ctx, r.Type(), state)
+}
+
+// deleteTimeout returns the delete timeout of a resource: the one customized in the state, the default one
+// (see Options.DefaultDeleteTimeout), or the type-specific one, in this order. Returns false if the provider's
+// default timeout applies.
+func (r Resource) deleteTimeout() (time.Duration, bool) {
+	if r.DeleteTimeout > 0 {
+		return r.DeleteTimeout, true
+	}
+
+	if r.Options.DefaultDeleteTimeout > 0 {
+		return r.Options.DefaultDeleteTimeout, true
+	}
+
+	timeout, ok := destroyTimeouts[r.Type()]
+
+	return timeout, ok
+}
+
+// waitUntilDeleted polls the current state of a resource until it doesn't exist anymore
+// or the given timeout is exceeded.
+func (r Resource) waitUntilDeleted(ctx context.Context, timeout time.Duration) error {
+	return r.waitFor(ctx, func(state cty.Value) (bool, string) {
+		return state.IsNull(), "deleting"
+	}, timeout)
+}
@@ -0,0 +1,721 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/golang/mock/gomock"
+	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/hashicorp/terraform/providers"
+	testUtil "github.com/jckuester/awstools-lib/test"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDestroyResources(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	tests := []struct {
+		name                  string
+		expectedDeletionCount int
+		failedDeletions       map[string]int
+		parallel              int
+	}{
+		{
+			name:                  "no resources to delete",
+			expectedDeletionCount: 0,
+			parallel:              1,
+		},
+		{
+			name: "single resource deleted in first run",
+			failedDeletions: map[string]int{
+				"aws_vpc": 0,
+			},
+			expectedDeletionCount: 1,
+			parallel:              1,
+		},
+		{
+			name: "single resource failed in first run",
+			failedDeletions: map[string]int{
+				"aws_vpc": 1,
+			},
+			expectedDeletionCount: 0,
+			parallel:              1,
+		},
+		{
+			name: "multiple resources deleted with one retry run",
+			failedDeletions: map[string]int{
+				"aws_vpc":    1,
+				"aws_subnet": 0,
+			},
+			expectedDeletionCount: 2,
+			parallel:              1,
+		},
+		{
+			name: "multiple resources deleted with two retry runs; only one worker",
+			failedDeletions: map[string]int{
+				"aws_vpc":      2,
+				"aws_subnet":   1,
+				"aws_instance": 0,
+			},
+			expectedDeletionCount: 3,
+			parallel:              1,
+		},
+		{
+			name: "multiple resources deleted with two retry runs; multiple workers",
+			failedDeletions: map[string]int{
+				"aws_vpc":      2,
+				"aws_subnet":   1,
+				"aws_instance": 0,
+			},
+			expectedDeletionCount: 3,
+			parallel:              10,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			var resources []destroy.DestroyableResource
+			for rType, numOfFailedDeletions := range tc.failedDeletions {
+				m := NewMockDestroyableResource(ctrl)
+
+				resFailedDeletions := m.EXPECT().Destroy(gomock.Any()).
+					Return(destroy.NewRetryDestroyError(fmt.Errorf("some error"), m)).
+					MaxTimes(numOfFailedDeletions)
+
+				m.EXPECT().Destroy(gomock.Any()).Return(nil).After(resFailedDeletions).AnyTimes()
+
+				m.EXPECT().ID().Return("1234").AnyTimes()
+				m.EXPECT().Type().Return(rType).AnyTimes()
+				m.EXPECT().Address().Return(rType + ".test").AnyTimes()
+				m.EXPECT().Dependencies().Return(nil).AnyTimes()
+
+				resources = append(resources, m)
+			}
+
+			actualResult := destroy.Run(context.Background(), resources, tc.parallel, nil)
+			assert.Equal(t, tc.expectedDeletionCount, actualResult.Deleted)
+
+			ctrl.Finish()
+		})
+	}
+}
+
+func TestDestroyResources_DestroyError(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	ctrl := gomock.NewController(t)
+
+	m := NewMockDestroyableResource(ctrl)
+
+	m.EXPECT().Destroy(gomock.Any()).
+		Return(fmt.Errorf("some error")).MaxTimes(1)
+
+	m.EXPECT().ID().Return("1234").AnyTimes()
+	m.EXPECT().Type().Return("aws_vpc").AnyTimes()
+	m.EXPECT().Address().Return("aws_vpc.test").AnyTimes()
+	m.EXPECT().Dependencies().Return(nil).AnyTimes()
+
+	actualResult := destroy.Run(context.Background(), []destroy.DestroyableResource{m}, 3, nil)
+	assert.Equal(t, actualResult.Deleted, 0)
+}
+
+func TestDestroyResources_Interrupted(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	ctrl := gomock.NewController(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var resources []destroy.DestroyableResource
+	for _, address := range []string{"aws_instance.test", "aws_vpc.test"} {
+		m := NewMockDestroyableResource(ctrl)
+
+		m.EXPECT().ID().Return("1234").AnyTimes()
+		m.EXPECT().Type().Return(strings.Split(address, ".")[0]).AnyTimes()
+		m.EXPECT().Address().Return(address).AnyTimes()
+		resources = append(resources, m)
+	}
+
+	resources[0].(*MockDestroyableResource).EXPECT().Dependencies().Return([]string{"aws_vpc.test"}).AnyTimes()
+	resources[1].(*MockDestroyableResource).EXPECT().Dependencies().Return(nil).AnyTimes()
+
+	// the run is interrupted while destroying the first resource, so the second one must not be destroyed
+	resources[0].(*MockDestroyableResource).EXPECT().Destroy(gomock.Any()).DoAndReturn(func(context.Context) error {
+		cancel()
+		return nil
+	}).Times(1)
+
+	actualResult := destroy.Run(ctx, resources, 1, nil)
+	assert.True(t, actualResult.Interrupted)
+	assert.Equal(t, 1, actualResult.Deleted)
+
+	ctrl.Finish()
+}
+
+func TestDestroyResources_NotRetryable(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	ctrl := gomock.NewController(t)
+
+	deleted := NewMockDestroyableResource(ctrl)
+	deleted.EXPECT().Destroy(gomock.Any()).Return(nil).Times(1)
+	deleted.EXPECT().ID().Return("vpc-1234").AnyTimes()
+	deleted.EXPECT().Type().Return("aws_vpc").AnyTimes()
+	deleted.EXPECT().Address().Return("aws_vpc.test").AnyTimes()
+	deleted.EXPECT().Dependencies().Return(nil).AnyTimes()
+
+	// a resource failing with permission denied is not retried, although another resource has been deleted
+	denied := NewMockDestroyableResource(ctrl)
+	denied.EXPECT().Destroy(gomock.Any()).Return(destroy.NewRetryDestroyError(
+		fmt.Errorf("UnauthorizedOperation: You are not authorized to perform this operation."), denied)).Times(1)
+	denied.EXPECT().ID().Return("sg-1234").AnyTimes()
+	denied.EXPECT().Type().Return("aws_security_group").AnyTimes()
+	denied.EXPECT().Address().Return("aws_security_group.test").AnyTimes()
+	denied.EXPECT().Dependencies().Return(nil).AnyTimes()
+
+	actualResult := destroy.Run(context.Background(), []destroy.DestroyableResource{deleted, denied}, 1, nil)
+
+	assert.Equal(t, 1, actualResult.Deleted)
+	require.Len(t, actualResult.Failed, 1)
+	assert.Equal(t, destroy.ErrorClassPermissionDenied, actualResult.Failed[0].Class)
+
+	ctrl.Finish()
+}
+
+// recordedEvents records some events and ignores the others.
+type recordedEvents struct {
+	destroy.NoopEvents
+
+	mu          sync.Mutex
+	deleted     []string
+	failed      []string
+	auxiliaries []destroy.AuxiliaryDeletion
+	results     []destroy.Result
+}
+
+func (e *recordedEvents) ResourceDeleted(event destroy.ResourceEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.deleted = append(e.deleted, event.Address)
+}
+
+func (e *recordedEvents) ResourceFailed(event destroy.ResourceEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.failed = append(e.failed, fmt.Sprintf("%s (retryable=%t): %s", event.Address, event.Retryable, event.Err))
+}
+
+func (e *recordedEvents) AuxiliaryDeleted(d destroy.AuxiliaryDeletion) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.auxiliaries = append(e.auxiliaries, d)
+}
+
+func (e *recordedEvents) RunCompleted(result destroy.Result) {
+	e.results = append(e.results, result)
+}
+
+func TestDestroyResources_Events(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	ctrl := gomock.NewController(t)
+
+	deleted := NewMockDestroyableResource(ctrl)
+	deleted.EXPECT().Destroy(gomock.Any()).Return(nil).Times(1)
+	deleted.EXPECT().ID().Return("vpc-1234").AnyTimes()
+	deleted.EXPECT().Type().Return("aws_vpc").AnyTimes()
+	deleted.EXPECT().Address().Return("aws_vpc.test").AnyTimes()
+	deleted.EXPECT().Dependencies().Return(nil).AnyTimes()
+
+	failed := NewMockDestroyableResource(ctrl)
+	failed.EXPECT().Destroy(gomock.Any()).Return(destroy.NewRetryDestroyError(fmt.Errorf("some error"), failed)).Times(2)
+	failed.EXPECT().ID().Return("sg-1234").AnyTimes()
+	failed.EXPECT().Type().Return("aws_security_group").AnyTimes()
+	failed.EXPECT().Address().Return("aws_security_group.test").AnyTimes()
+	failed.EXPECT().Dependencies().Return(nil).AnyTimes()
+
+	events := &recordedEvents{}
+
+	actualResult := destroy.Run(context.Background(), []destroy.DestroyableResource{deleted, failed}, 1, events)
+
+	assert.Equal(t, []string{"aws_vpc.test"}, events.deleted)
+	assert.Equal(t, []string{
+		"aws_security_group.test (retryable=true): some error",
+		"aws_security_group.test (retryable=true): some error",
+	}, events.failed)
+	assert.Equal(t, []destroy.Result{actualResult}, events.results)
+	assert.Equal(t, 1, actualResult.Deleted)
+	assert.Len(t, actualResult.Failed, 1)
+
+	ctrl.Finish()
+}
+
+func TestDestroyResources_Order(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	tests := []struct {
+		name         string
+		resources    []mockResource
+		expectedDone []string
+	}{
+		{
+			name: "dependencies from state",
+			resources: []mockResource{
+				{address: "aws_vpc.test", rType: "aws_vpc"},
+				{address: "aws_subnet.test", rType: "aws_subnet", dependencies: []string{"aws_vpc.test"}},
+				{address: "aws_instance.test", rType: "aws_instance", dependencies: []string{"aws_subnet.test"}},
+			},
+			expectedDone: []string{"aws_instance.test", "aws_subnet.test", "aws_vpc.test"},
+		},
+		{
+			name: "implicit dependency of NAT gateway on EIP and subnet",
+			resources: []mockResource{
+				{address: "aws_eip.test", rType: "aws_eip"},
+				{address: "aws_subnet.test", rType: "aws_subnet"},
+				{address: "aws_nat_gateway.test", rType: "aws_nat_gateway"},
+			},
+			expectedDone: []string{"aws_nat_gateway.test", "aws_eip.test", "aws_subnet.test"},
+		},
+		{
+			name: "implicit dependencies of EKS node group and Fargate profile on cluster",
+			resources: []mockResource{
+				{address: "aws_eks_cluster.test", rType: "aws_eks_cluster"},
+				{address: "aws_eks_fargate_profile.test", rType: "aws_eks_fargate_profile"},
+				{address: "aws_eks_node_group.test", rType: "aws_eks_node_group"},
+			},
+			expectedDone: []string{"aws_eks_node_group.test", "aws_eks_fargate_profile.test", "aws_eks_cluster.test"},
+		},
+		{
+			name: "implicit dependencies of Elastic Beanstalk environment",
+			resources: []mockResource{
+				{address: "aws_elastic_beanstalk_application.test", rType: "aws_elastic_beanstalk_application"},
+				{address: "aws_security_group.test", rType: "aws_security_group"},
+				{address: "aws_elastic_beanstalk_environment.test", rType: "aws_elastic_beanstalk_environment"},
+			},
+			expectedDone: []string{"aws_elastic_beanstalk_environment.test",
+				"aws_elastic_beanstalk_application.test", "aws_security_group.test"},
+		},
+		{
+			name: "dependency cycle",
+			resources: []mockResource{
+				{address: "aws_a.test", rType: "aws_a", dependencies: []string{"aws_b.test"}},
+				{address: "aws_b.test", rType: "aws_b", dependencies: []string{"aws_a.test"}},
+			},
+			expectedDone: []string{"aws_a.test", "aws_b.test"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			var actualDone []string
+
+			var resources []destroy.DestroyableResource
+			for _, r := range tc.resources {
+				r := r
+				m := NewMockDestroyableResource(ctrl)
+
+				m.EXPECT().Destroy(gomock.Any()).DoAndReturn(func(context.Context) error {
+					actualDone = append(actualDone, r.address)
+					return nil
+				}).Times(1)
+
+				m.EXPECT().ID().Return("1234").AnyTimes()
+				m.EXPECT().Type().Return(r.rType).AnyTimes()
+				m.EXPECT().Address().Return(r.address).AnyTimes()
+				m.EXPECT().Dependencies().Return(r.dependencies).AnyTimes()
+
+				resources = append(resources, m)
+			}
+
+			actualResult := destroy.Run(context.Background(), resources, 1, nil)
+			assert.Equal(t, len(tc.resources), actualResult.Deleted)
+			assert.Equal(t, tc.expectedDone, actualDone)
+
+			ctrl.Finish()
+		})
+	}
+}
+
+type mockResource struct {
+	address      string
+	rType        string
+	dependencies []string
+}
+
+func TestResource_Destroy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test.")
+	}
+
+	env := testUtil.Init(t)
+
+	err := testUtil.SetMultiEnvs(map[string]string{
+		"AWS_PROFILE": env.AWSProfile1,
+		"AWS_REGION":  env.AWSRegion1,
+	})
+	require.NoError(t, err)
+
+	defer testUtil.UnsetAWSEnvs()
+
+	terraformDir := "../../test/test-fixtures/single-resource/aws-vpc"
+
+	terraformOptions := testUtil.GetTerraformOptions(test.TfStateBucket, terraformDir, env)
+
+	defer terraform.Destroy(t, terraformOptions)
+
+	terraform.InitAndApply(t, terraformOptions)
+
+	actualVpcID := terraform.Output(t, terraformOptions, "vpc_id")
+	aws.GetVpcById(t, actualVpcID, env.AWSRegion1)
+
+	awsProvider, err := provider.Init(context.Background(), "aws",
+		provider.Config{InstallDir: ".terradozer", Timeout: 10 * time.Second})
+	require.NoError(t, err)
+
+	r := destroy.New("aws_vpc", actualVpcID, nil, awsProvider)
+
+	err = r.UpdateState(context.Background())
+	require.NoError(t, err)
+
+	err = r.Destroy(context.Background())
+	require.NoError(t, err)
+
+	test.AssertVpcDeleted(t, actualVpcID, env)
+}
+
+// For this resource, Terraform import function uses the name as an identifier,
+// but the id attribute set in the state is the ARN. Therefore, this resource
+// cannot be imported by ID und must try to call read directly.
+func TestResource_Destroy_AwsEcsCluster(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test.")
+	}
+
+	log.SetLevel(log.DebugLevel)
+
+	env := testUtil.Init(t)
+
+	err := testUtil.SetMultiEnvs(map[string]string{
+		"AWS_PROFILE": env.AWSProfile1,
+		"AWS_REGION":  env.AWSRegion1,
+	})
+	require.NoError(t, err)
+
+	defer testUtil.UnsetAWSEnvs()
+
+	terraformDir := "../../test/test-fixtures/single-resource/aws-ecs-cluster"
+
+	terraformOptions := testUtil.GetTerraformOptions(test.TfStateBucket, terraformDir, env)
+
+	defer terraform.Destroy(t, terraformOptions)
+
+	terraform.InitAndApply(t, terraformOptions)
+
+	actualID := terraform.Output(t, terraformOptions, "id")
+
+	test.AssertEcsClusterExists(t, env, actualID)
+
+	awsProvider, err := provider.Init(context.Background(), "aws",
+		provider.Config{InstallDir: ".terradozer", Timeout: 10 * time.Second})
+	require.NoError(t, err)
+
+	r := destroy.New("aws_ecs_cluster", actualID, nil, awsProvider)
+
+	err = r.UpdateState(context.Background())
+	require.NoError(t, err)
+
+	err = r.Destroy(context.Background())
+	require.NoError(t, err)
+
+	test.AssertEcsClusterDeleted(t, env, actualID)
+}
+
+// For this resource under test, the read function cannot be used without
+// an import first to populate all resource attributes.
+//
+// The reason is that the read function uses the function_name attribute
+// and not the ID attribute (although both are equal values).
+func TestResource_Destroy_AwsLambdaFunction(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test.")
+	}
+
+	log.SetLevel(log.DebugLevel)
+
+	env := testUtil.Init(t)
+
+	err := testUtil.SetMultiEnvs(map[string]string{
+		"AWS_PROFILE": env.AWSProfile1,
+		"AWS_REGION":  env.AWSRegion1,
+	})
+	require.NoError(t, err)
+
+	defer testUtil.UnsetAWSEnvs()
+
+	terraformDir := "../../test/test-fixtures/single-resource/aws-lambda-function"
+
+	terraformOptions := testUtil.GetTerraformOptions(test.TfStateBucket, terraformDir, env)
+
+	defer terraform.Destroy(t, terraformOptions)
+
+	terraform.InitAndApply(t, terraformOptions)
+
+	actualID := terraform.Output(t, terraformOptions, "id")
+	test.AssertLambdaFunctionExists(t, env, actualID)
+
+	awsProvider, err := provider.Init(context.Background(), "aws",
+		provider.Config{InstallDir: ".terradozer", Timeout: 10 * time.Second})
+	require.NoError(t, err)
+
+	r := destroy.New("aws_lambda_function", actualID, nil, awsProvider)
+
+	err = r.UpdateState(context.Background())
+	require.NoError(t, err)
+
+	err = r.Destroy(context.Background())
+	require.NoError(t, err)
+
+	test.AssertLambdaFunctionDeleted(t, env, actualID)
+}
+
+func TestResource_Destroy_Timeout(t *testing.T) {
+	env := testUtil.Init(t)
+
+	err := testUtil.SetMultiEnvs(map[string]string{
+		"AWS_PROFILE": env.AWSProfile1,
+		"AWS_REGION":  env.AWSRegion1,
+	})
+	require.NoError(t, err)
+
+	defer testUtil.UnsetAWSEnvs()
+
+	terraformDir := "../../test/test-fixtures/single-resource/aws-vpc"
+
+	terraformOptions := testUtil.GetTerraformOptions(test.TfStateBucket, terraformDir, env)
+
+	defer terraform.Destroy(t, terraformOptions)
+
+	terraform.InitAndApply(t, terraformOptions)
+
+	actualVpcID := terraform.Output(t, terraformOptions, "vpc_id")
+	aws.GetVpcById(t, actualVpcID, env.AWSRegion1)
+
+	// apply dependency
+
+	terraformDirDependency := "../../test/test-fixtures/single-resource/aws-vpc/dependency"
+
+	terraformOptionsDependency := testUtil.GetTerraformOptions(test.TfStateBucket, terraformDirDependency, env,
+		map[string]interface{}{
+			"profile": env.AWSProfile1,
+			"region":  env.AWSRegion1,
+			"name":    fmt.Sprintf("testacc-%s", strings.ToLower(random.UniqueId())),
+			"vpc_id":  actualVpcID,
+		})
+
+	defer terraform.Destroy(t, terraformOptionsDependency)
+
+	terraform.InitAndApply(t, terraformOptionsDependency)
+
+	awsProvider, err := provider.Init(context.Background(), "aws",
+		provider.Config{InstallDir: ".terradozer", Timeout: 5 * time.Second})
+	require.NoError(t, err)
+
+	r := destroy.New("aws_vpc", actualVpcID, nil, awsProvider)
+
+	err = r.UpdateState(context.Background())
+	require.NoError(t, err)
+
+	err = r.Destroy(context.Background())
+	assert.EqualError(t, err, "destroy timed out (5s)")
+}
+
+// privateProvider is a provider that records the private data passed to destroy resources.
+type privateProvider struct {
+	*slowProvider
+
+	private [][]byte
+}
+
+func (p *privateProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	p.private = append(p.private, req.PlannedPrivate)
+
+	return p.slowProvider.ApplyResourceChange(req)
+}
+
+func TestResource_Destroy_DeleteTimeout(t *testing.T) {
+	tests := []struct {
+		name                 string
+		rType                string
+		deleteTimeout        time.Duration
+		defaultDeleteTimeout time.Duration
+		// expectedPrivate is the private data passed to the provider (empty if the provider's timeout applies)
+		expectedPrivate string
+	}{
+		{
+			name:            "customized in state",
+			rType:           "aws_vpc",
+			deleteTimeout:   time.Hour,
+			expectedPrivate: `{"e2bfb730-ecaa-11e6-8f88-34363bc7c4c0":{"delete":3600000000000}}`,
+		},
+		{
+			name:                 "customized in state overrides default",
+			rType:                "aws_vpc",
+			deleteTimeout:        time.Hour,
+			defaultDeleteTimeout: time.Minute,
+			expectedPrivate:      `{"e2bfb730-ecaa-11e6-8f88-34363bc7c4c0":{"delete":3600000000000}}`,
+		},
+		{
+			name:                 "default",
+			rType:                "aws_vpc",
+			defaultDeleteTimeout: time.Minute,
+			expectedPrivate:      `{"e2bfb730-ecaa-11e6-8f88-34363bc7c4c0":{"delete":60000000000}}`,
+		},
+		{
+			name:            "type-specific",
+			rType:           "aws_rds_cluster",
+			expectedPrivate: `{"e2bfb730-ecaa-11e6-8f88-34363bc7c4c0":{"delete":3600000000000}}`,
+		},
+		{
+			name:  "provider's default",
+			rType: "aws_vpc",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &privateProvider{slowProvider: &slowProvider{}}
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return p, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := cty.ObjectVal(map[string]cty.Value{
+				"id":                  cty.StringVal("id-1234"),
+				"deletion_protection": cty.False,
+			})
+
+			r := destroy.NewWithState(tc.rType+".test", tc.rType, "id-1234", nil, tp, &state)
+			r.DeleteTimeout = tc.deleteTimeout
+			r.Options = destroy.Options{DefaultDeleteTimeout: tc.defaultDeleteTimeout}
+
+			require.NoError(t, r.Destroy(context.Background()))
+
+			require.Len(t, p.private, 1)
+			assert.Equal(t, tc.expectedPrivate, string(p.private[0]))
+		})
+	}
+}
+
+func TestResource_Destroy_NilState(t *testing.T) {
+	r := destroy.New("aws_foo", "id-1234", nil, nil)
+
+	err := r.Destroy(context.Background())
+	assert.EqualError(t, err, "resource state is nil; need to call update first")
+}
+
+func TestResource_Preview(t *testing.T) {
+	eksClusterState := cty.ObjectVal(map[string]cty.Value{
+		"id": cty.StringVal("test"),
+		"vpc_config": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"cluster_security_group_id": cty.StringVal("sg-123"),
+			"vpc_id":                    cty.StringVal("vpc-123"),
+		})}),
+	})
+
+	tests := []struct {
+		name           string
+		resource       *destroy.Resource
+		expectedFields log.Fields
+	}{
+		{
+			name:     "two-phase destroy",
+			resource: destroy.New("aws_cloudfront_distribution", "E123", nil, nil),
+			expectedFields: log.Fields{
+				"note": "two-phase destroy: disable, wait until deployed, delete",
+			},
+		},
+		{
+			name:     "deletion protection",
+			resource: destroy.New("aws_db_instance", "db-123", nil, nil),
+			expectedFields: log.Fields{
+				"note": "disable deletion protection (if enabled), delete",
+			},
+		},
+		{
+			name: "step enabled by options",
+			resource: withOptions(destroy.New("aws_secretsmanager_secret", "arn:aws:secretsmanager:secret", nil, nil),
+				destroy.Options{SecretsForceDelete: true}),
+			expectedFields: log.Fields{
+				"note": "remove replicas (if any), delete without recovery window",
+			},
+		},
+		{
+			name:           "step not enabled by options",
+			resource:       destroy.New("aws_route53_zone", "Z123", nil, nil),
+			expectedFields: log.Fields{},
+		},
+		{
+			name: "security group created by EKS",
+			resource: destroy.NewWithState("aws_eks_cluster.test", "aws_eks_cluster", "test", nil, nil,
+				&eksClusterState),
+			expectedFields: log.Fields{
+				"cluster_security_group_id": "sg-123",
+				"vpc_id":                    "vpc-123",
+			},
+		},
+		{
+			name:           "single destroy call",
+			resource:       destroy.New("aws_vpc", "vpc-123", nil, nil),
+			expectedFields: log.Fields{},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedFields, tc.resource.Preview(context.Background()))
+		})
+	}
+}
+
+func withOptions(r *destroy.Resource, options destroy.Options) *destroy.Resource {
+	r.Options = options
+
+	return r
+}
+
+func TestStepError(t *testing.T) {
+	err := &destroy.StepError{Step: "disable", Err: fmt.Errorf("some error")}
+
+	assert.EqualError(t, err, "disable step failed (before destroy): some error")
+
+	err = &destroy.StepError{Step: "clean up", AfterDestroy: true, Err: fmt.Errorf("some error")}
+
+	assert.EqualError(t, err, "clean up step failed (after destroy): some error")
+}
+
+func TestCredentialsExpiredError(t *testing.T) {
+	err := &destroy.CredentialsExpiredError{Err: fmt.Errorf("ExpiredToken: The security token is expired")}
+
+	assert.EqualError(t, err, "credentials expired: ExpiredToken: The security token is expired")
+}
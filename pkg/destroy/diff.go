@@ -0,0 +1,101 @@
+package destroy
+
+import "sort"
+
+// MovedResource is a resource of an old state that is part of a new state at another address (e.g., renamed
+// by terraform state mv or a moved block), i.e., its type and ID are the same.
+type MovedResource struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// From is the address of the resource in the old state and To the one in the new state.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// resourceTypeID identifies a resource regardless of its address.
+type resourceTypeID struct {
+	terraformType, id string
+}
+
+// StateDiff matches the resources of an old state with the ones of a new state (see NewStateDiff). As Filter,
+// it only matches the orphans of the old state, i.e., the resources that are absent from the new state.
+type StateDiff struct {
+	// Orphaned are the resources of the old state whose type and ID are absent from the new state.
+	Orphaned []ResourceCandidate
+	// Moved are the resources of the old state that are part of the new state at another address,
+	// ordered by the address in the old state.
+	Moved []MovedResource
+
+	// addresses are the addresses of the resources of the new state by type and ID
+	addresses map[resourceTypeID][]string
+	// inNewState are the addresses of the resources of the new state
+	inNewState map[string]bool
+}
+
+// NewStateDiff matches the resources of the given old state with the ones of the given new state primarily
+// by type and ID rather than by address, so that resources that have only been moved to another address
+// aren't taken for orphans. Resources without ID (e.g., if it couldn't be extracted) are matched by address.
+func NewStateDiff(oldResources, newResources []ResourceCandidate) *StateDiff {
+	d := &StateDiff{
+		addresses:  map[resourceTypeID][]string{},
+		inNewState: map[string]bool{},
+	}
+
+	for _, r := range newResources {
+		d.inNewState[r.Address] = true
+
+		if r.ID != "" {
+			key := resourceTypeID{r.Type, r.ID}
+			d.addresses[key] = append(d.addresses[key], r.Address)
+		}
+	}
+
+	for _, r := range oldResources {
+		to, reason := d.match(r)
+
+		switch reason {
+		case "":
+			d.Orphaned = append(d.Orphaned, r)
+		case SkipReasonMoved:
+			d.Moved = append(d.Moved, MovedResource{Type: r.Type, ID: r.ID, From: r.Address, To: to})
+		}
+	}
+
+	sort.SliceStable(d.Moved, func(i, j int) bool { return d.Moved[i].From < d.Moved[j].From })
+
+	return d
+}
+
+// match returns the address of the given resource in the new state, together with the reason why it isn't
+// an orphan (empty if it is).
+func (d *StateDiff) match(c ResourceCandidate) (string, SkipReason) {
+	if c.ID == "" {
+		if d.inNewState[c.Address] {
+			return c.Address, SkipReasonInNewState
+		}
+
+		return "", ""
+	}
+
+	addresses := d.addresses[resourceTypeID{c.Type, c.ID}]
+	if len(addresses) == 0 {
+		return "", ""
+	}
+
+	for _, address := range addresses {
+		if address == c.Address {
+			return address, SkipReasonInNewState
+		}
+	}
+
+	return addresses[0], SkipReasonMoved
+}
+
+// Match implements Filter.
+func (d *StateDiff) Match(c ResourceCandidate) (bool, SkipReason) {
+	if _, reason := d.match(c); reason != "" {
+		return false, reason
+	}
+
+	return true, ""
+}
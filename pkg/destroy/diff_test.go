@@ -0,0 +1,83 @@
+package destroy_test
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateDiff(t *testing.T) {
+	oldState := []destroy.ResourceCandidate{
+		{Address: "aws_vpc.main", Type: "aws_vpc", ID: "vpc-1"},
+		{Address: "aws_subnet.public", Type: "aws_subnet", ID: "subnet-1"},
+		{Address: "aws_subnet.private", Type: "aws_subnet", ID: "subnet-2"},
+		{Address: "aws_instance.app", Type: "aws_instance", ID: "i-1"},
+		{Address: "aws_s3_bucket.logs", Type: "aws_s3_bucket"},
+		{Address: "aws_s3_bucket.assets", Type: "aws_s3_bucket"},
+	}
+
+	newState := []destroy.ResourceCandidate{
+		// unchanged
+		{Address: "aws_vpc.main", Type: "aws_vpc", ID: "vpc-1"},
+		// moved by terraform state mv
+		{Address: "module.network.aws_subnet.public", Type: "aws_subnet", ID: "subnet-1"},
+		// renamed by a moved block, while the old address is taken by a new resource
+		{Address: "aws_subnet.internal", Type: "aws_subnet", ID: "subnet-2"},
+		{Address: "aws_instance.app", Type: "aws_instance", ID: "i-2"},
+		{Address: "aws_s3_bucket.logs", Type: "aws_s3_bucket", ID: "logs"},
+	}
+
+	diff := destroy.NewStateDiff(oldState, newState)
+
+	tests := []struct {
+		name           string
+		candidate      destroy.ResourceCandidate
+		expectedReason destroy.SkipReason
+	}{
+		{
+			name:           "unchanged",
+			candidate:      oldState[0],
+			expectedReason: destroy.SkipReasonInNewState,
+		},
+		{
+			name:           "moved into module",
+			candidate:      oldState[1],
+			expectedReason: destroy.SkipReasonMoved,
+		},
+		{
+			name:           "renamed",
+			candidate:      oldState[2],
+			expectedReason: destroy.SkipReasonMoved,
+		},
+		{
+			name:      "replaced at the same address",
+			candidate: oldState[3],
+		},
+		{
+			name:           "without ID matched by address",
+			candidate:      oldState[4],
+			expectedReason: destroy.SkipReasonInNewState,
+		},
+		{
+			name:      "without ID absent from new state",
+			candidate: oldState[5],
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			matched, reason := diff.Match(tc.candidate)
+
+			assert.Equal(t, tc.expectedReason == "", matched)
+			assert.Equal(t, tc.expectedReason, reason)
+		})
+	}
+
+	assert.Equal(t, []destroy.MovedResource{
+		{Type: "aws_subnet", ID: "subnet-2", From: "aws_subnet.private", To: "aws_subnet.internal"},
+		{Type: "aws_subnet", ID: "subnet-1", From: "aws_subnet.public", To: "module.network.aws_subnet.public"},
+	}, diff.Moved)
+
+	assert.Equal(t, []destroy.ResourceCandidate{oldState[3], oldState[5]}, diff.Orphaned)
+}
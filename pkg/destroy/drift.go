@@ -0,0 +1,370 @@
+package destroy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// The kinds of changes of an attribute between the state and the current attributes of a resource.
+const (
+	AttributeAdded   = "added"
+	AttributeChanged = "changed"
+	AttributeRemoved = "removed"
+)
+
+// maskedValue replaces the values of sensitive attributes in a drift report.
+const maskedValue = `"(sensitive)"`
+
+// DriftReport tells how the attributes of resources recorded in the state differ from their current ones
+// (i.e., after the resources have been read, before they are destroyed).
+type DriftReport struct {
+	// Compared is the number of resources whose attributes have been compared.
+	Compared int `json:"compared"`
+	// NotCompared are the addresses of resources whose attributes recorded in the state are unknown
+	// (e.g., resources that have been imported, as their attributes didn't satisfy the provider's schema).
+	NotCompared []string `json:"not_compared,omitempty"`
+	// Drifted are the resources whose attributes differ, ordered by address.
+	Drifted []ResourceDrift `json:"drifted"`
+	// AlreadyGone are the addresses of the resources of the state that don't exist anymore.
+	AlreadyGone []string `json:"already_gone,omitempty"`
+	// Overridden are the resources whose attributes would be overridden right before they are destroyed
+	// (e.g., force_destroy=true), ordered by address.
+	Overridden []ResourceOverrides `json:"overridden,omitempty"`
+	// TerraformVersion is the version of Terraform that has written the state (if known).
+	TerraformVersion string `json:"terraform_version,omitempty"`
+	// Compatibility is the compatibility table of terradozer (see internal.CheckCompatibility).
+	Compatibility []internal.Compatibility `json:"compatibility,omitempty"`
+}
+
+// ResourceDrift lists the attributes of a resource that differ between the state and the resource's current state.
+type ResourceDrift struct {
+	Address string            `json:"address"`
+	Type    string            `json:"type"`
+	ID      string            `json:"id"`
+	Owner   string            `json:"owner,omitempty"`
+	Changes []AttributeChange `json:"changes"`
+}
+
+// ResourceOverrides lists the attributes of a resource that would be overridden (see Resource.Overrides).
+type ResourceOverrides struct {
+	Address   string   `json:"address"`
+	Type      string   `json:"type"`
+	ID        string   `json:"id"`
+	Overrides []string `json:"overrides"`
+}
+
+// AttributeChange is an attribute (or a nested attribute or element) that has been added, changed, or removed.
+type AttributeChange struct {
+	// Path is the path of the attribute (e.g., tags["Name"] or ingress[0].cidr_blocks). Elements added to or
+	// removed from a set have the path of the set.
+	Path string `json:"path"`
+	// Kind is one of AttributeAdded, AttributeChanged, or AttributeRemoved.
+	Kind string `json:"kind"`
+	// Old and New are the values recorded in the state and the current ones (in JSON; masked if sensitive).
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// NewDriftReport compares the attributes of the resources of the given plan as recorded in the state
+// with their current attributes, which have been read while planning (so that no further API calls are made).
+// Sensitive values are masked, unless Options.LogSensitive is set.
+func NewDriftReport(plan *DestroyPlan) DriftReport {
+	report := DriftReport{Drifted: []ResourceDrift{}}
+
+	for _, c := range plan.Candidates {
+		if len(c.Overrides) > 0 {
+			report.Overridden = append(report.Overridden,
+				ResourceOverrides{Address: c.Address, Type: c.Type, ID: c.ID, Overrides: c.Overrides})
+		}
+
+		if c.Attrs == cty.NilVal || c.RefreshedAttrs == cty.NilVal {
+			report.NotCompared = append(report.NotCompared, c.Address)
+
+			continue
+		}
+
+		report.Compared++
+
+		var schema *configschema.Block
+
+		if c.Resource != nil && c.Resource.provider != nil {
+			if s, err := c.Resource.provider.GetSchemaForResource(c.Type); err == nil {
+				schema = s.Block
+			}
+		}
+
+		changes := diffAttrs(c.Attrs, c.RefreshedAttrs, schema, plan.config.Options.LogSensitive)
+		if len(changes) == 0 {
+			continue
+		}
+
+		drifted := ResourceDrift{Address: c.Address, Type: c.Type, ID: c.ID, Changes: changes}
+		if c.Resource != nil {
+			drifted.Owner = c.Resource.Owner()
+		}
+
+		report.Drifted = append(report.Drifted, drifted)
+	}
+
+	for _, e := range plan.AlreadyGone {
+		report.AlreadyGone = append(report.AlreadyGone, e.Address)
+	}
+
+	sort.Strings(report.NotCompared)
+	sort.Strings(report.AlreadyGone)
+	sort.Slice(report.Drifted, func(i, j int) bool {
+		return report.Drifted[i].Address < report.Drifted[j].Address
+	})
+	sort.Slice(report.Overridden, func(i, j int) bool {
+		return report.Overridden[i].Address < report.Overridden[j].Address
+	})
+
+	return report
+}
+
+// DiffAttrs returns the changes between the attributes of a resource recorded in the state and its current ones.
+// Nested objects, lists, and maps are compared element by element, sets regardless of the order of their elements.
+// Values of attributes that are sensitive according to the given schema of the resource and marked values
+// (e.g., as sensitive) are masked; all values are masked if the schema is nil.
+func DiffAttrs(stored, refreshed cty.Value, schema *configschema.Block) []AttributeChange {
+	return diffAttrs(stored, refreshed, schema, false)
+}
+
+// diffAttrs returns the changes between the given attributes, where sensitive values are only masked if not shown.
+func diffAttrs(stored, refreshed cty.Value, schema *configschema.Block, showSensitive bool) []AttributeChange {
+	if stored == cty.NilVal || refreshed == cty.NilVal {
+		return nil
+	}
+
+	d := differ{showSensitive: showSensitive}
+	d.diff(nil, stored, refreshed, schema, schema == nil && !showSensitive)
+
+	return d.changes
+}
+
+// differ collects the changes between two values.
+type differ struct {
+	changes []AttributeChange
+	// showSensitive disables masking sensitive values.
+	showSensitive bool
+}
+
+// diff compares the value recorded in the state with the current one at the given path; block is the schema
+// of the values (if they are objects or collections of objects described by a nested block), sensitive is true
+// if their values must be masked.
+func (d *differ) diff(path cty.Path, stored, current cty.Value, block *configschema.Block, sensitive bool) {
+	// marked values are compared without their marks (values nested in them are unmarked level by level),
+	// but are sensitive
+	stored, storedMarks := stored.Unmark()
+	current, currentMarks := current.Unmark()
+	sensitive = sensitive || len(storedMarks) > 0 || len(currentMarks) > 0
+
+	switch {
+	case stored.IsNull() && current.IsNull():
+		return
+	case !stored.IsKnown() || !current.IsKnown():
+		return
+	case stored.IsNull():
+		d.add(path, AttributeAdded, cty.NilVal, current, block, sensitive)
+
+		return
+	case current.IsNull():
+		d.add(path, AttributeRemoved, stored, cty.NilVal, block, sensitive)
+
+		return
+	}
+
+	storedType, currentType := stored.Type(), current.Type()
+
+	switch {
+	case isMapping(storedType) && isMapping(currentType):
+		d.diffMappings(path, stored, current, block, sensitive)
+	case isSequence(storedType) && isSequence(currentType):
+		d.diffSequences(path, stored, current, block, sensitive)
+	case storedType.IsSetType() && currentType.IsSetType():
+		d.diffSets(path, stored, current, block, sensitive)
+	case !stored.RawEquals(current):
+		d.add(path, AttributeChanged, stored, current, block, sensitive)
+	}
+}
+
+// diffMappings compares two objects or maps by their keys.
+func (d *differ) diffMappings(path cty.Path, stored, current cty.Value, block *configschema.Block, sensitive bool) {
+	storedElems, currentElems := stored.AsValueMap(), current.AsValueMap()
+
+	var keys []string
+
+	for k := range storedElems {
+		keys = append(keys, k)
+	}
+
+	for k := range currentElems {
+		if _, ok := storedElems[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	isObject := stored.Type().IsObjectType()
+
+	for _, k := range keys {
+		storedElem, ok := storedElems[k]
+		if !ok {
+			storedElem = cty.NullVal(cty.DynamicPseudoType)
+		}
+
+		currentElem, ok := currentElems[k]
+		if !ok {
+			currentElem = cty.NullVal(cty.DynamicPseudoType)
+		}
+
+		if !isObject {
+			// the elements of a map (e.g., of a nested block with map nesting) share the schema
+			d.diff(path.Index(cty.StringVal(k)), storedElem, currentElem, block, sensitive)
+
+			continue
+		}
+
+		childBlock, childSensitive := child(block, k, sensitive)
+		d.diff(path.GetAttr(k), storedElem, currentElem, childBlock, childSensitive)
+	}
+}
+
+// diffSequences compares two lists or tuples element by element.
+func (d *differ) diffSequences(path cty.Path, stored, current cty.Value, block *configschema.Block, sensitive bool) {
+	storedElems, currentElems := stored.AsValueSlice(), current.AsValueSlice()
+
+	for i := 0; i < len(storedElems) || i < len(currentElems); i++ {
+		storedElem, currentElem := cty.NullVal(cty.DynamicPseudoType), cty.NullVal(cty.DynamicPseudoType)
+
+		if i < len(storedElems) {
+			storedElem = storedElems[i]
+		}
+
+		if i < len(currentElems) {
+			currentElem = currentElems[i]
+		}
+
+		d.diff(path.Index(cty.NumberIntVal(int64(i))), storedElem, currentElem, block, sensitive)
+	}
+}
+
+// diffSets compares two sets regardless of the order of their elements; elements that are only part of one
+// of the sets are added or removed.
+func (d *differ) diffSets(path cty.Path, stored, current cty.Value, block *configschema.Block, sensitive bool) {
+	// the elements of sets can't be addressed by a path, so a set is sensitive as a whole if any of its values is marked
+	stored, storedMarks := unmarkDeep(stored)
+	current, currentMarks := unmarkDeep(current)
+	sensitive = sensitive || len(storedMarks) > 0 || len(currentMarks) > 0
+
+	for _, elem := range stored.AsValueSlice() {
+		if !current.HasElement(elem).RawEquals(cty.True) {
+			d.add(path, AttributeRemoved, elem, cty.NilVal, block, sensitive)
+		}
+	}
+
+	for _, elem := range current.AsValueSlice() {
+		if !stored.HasElement(elem).RawEquals(cty.True) {
+			d.add(path, AttributeAdded, cty.NilVal, elem, block, sensitive)
+		}
+	}
+}
+
+// add records a change; values are masked if sensitive or if they contain sensitive attributes or marked values
+// (unless sensitive values are shown).
+func (d *differ) add(path cty.Path, kind string, stored, current cty.Value, block *configschema.Block, sensitive bool) {
+	mask := !d.showSensitive && (sensitive || containsSensitive(block) || containsMarked(stored) ||
+		containsMarked(current))
+
+	d.changes = append(d.changes, AttributeChange{
+		Path: provider.FormatPath(path),
+		Kind: kind,
+		Old:  driftValue(stored, mask),
+		New:  driftValue(current, mask),
+	})
+}
+
+// child returns the schema of the attribute or nested block with the given name of an object described
+// by the given schema and whether its value is sensitive.
+func child(block *configschema.Block, name string, sensitive bool) (*configschema.Block, bool) {
+	if sensitive || block == nil {
+		return nil, sensitive
+	}
+
+	if attr, ok := block.Attributes[name]; ok {
+		return nil, attr.Sensitive
+	}
+
+	if nested, ok := block.BlockTypes[name]; ok {
+		return &nested.Block, false
+	}
+
+	return nil, false
+}
+
+// containsSensitive returns true if any attribute described by the given schema (or its nested blocks) is sensitive.
+func containsSensitive(block *configschema.Block) bool {
+	if block == nil {
+		return false
+	}
+
+	for _, attr := range block.Attributes {
+		if attr.Sensitive {
+			return true
+		}
+	}
+
+	for _, nested := range block.BlockTypes {
+		if containsSensitive(&nested.Block) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsMarked returns true if the given value or any value nested in it is marked.
+func containsMarked(v cty.Value) bool {
+	return v != cty.NilVal && v.ContainsMarked()
+}
+
+// driftValue returns the given value in JSON (nil if there is no value), as a string if it is too large
+// (see internal.RenderJSON).
+func driftValue(v cty.Value, mask bool) json.RawMessage {
+	// marks can't be encoded as JSON (marked values are masked unless sensitive values are shown)
+	v, _ = unmarkDeep(v)
+
+	switch {
+	case v == cty.NilVal || v.IsNull():
+		return nil
+	case mask:
+		return json.RawMessage(maskedValue)
+	case !v.IsWhollyKnown():
+		return json.RawMessage(`"(unknown)"`)
+	}
+
+	result, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		result, _ = json.Marshal(fmt.Sprintf("(failed to encode value: %s)", err))
+	}
+
+	return internal.RenderJSON(result)
+}
+
+// isMapping returns true if values of the given type are objects or maps.
+func isMapping(t cty.Type) bool {
+	return t.IsObjectType() || t.IsMapType()
+}
+
+// isSequence returns true if values of the given type are lists or tuples.
+func isSequence(t cty.Type) bool {
+	return t.IsListType() || t.IsTupleType()
+}
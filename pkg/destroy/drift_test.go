@@ -0,0 +1,183 @@
+package destroy_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDiffAttrs(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id":       {Type: cty.String, Computed: true},
+			"password": {Type: cty.String, Optional: true, Sensitive: true},
+			"tags":     {Type: cty.Map(cty.String), Optional: true},
+			"ports":    {Type: cty.Set(cty.Number), Optional: true},
+			"size":     {Type: cty.DynamicPseudoType, Optional: true},
+		},
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"ingress": {
+				Nesting: configschema.NestingList,
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"cidr_blocks": {Type: cty.List(cty.String), Optional: true},
+						"token":       {Type: cty.String, Optional: true, Sensitive: true},
+					},
+				},
+			},
+		},
+	}
+
+	ingress := func(cidr string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"cidr_blocks": cty.ListVal([]cty.Value{cty.StringVal(cidr)}),
+			"token":       cty.StringVal("secret"),
+		})
+	}
+
+	largeValue := strings.Repeat("a", 5*1024*1024)
+
+	change := func(path, kind, old, new string) destroy.AttributeChange {
+		c := destroy.AttributeChange{Path: path, Kind: kind}
+
+		if old != "" {
+			c.Old = json.RawMessage(old)
+		}
+
+		if new != "" {
+			c.New = json.RawMessage(new)
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name            string
+		stored          cty.Value
+		refreshed       cty.Value
+		schema          *configschema.Block
+		expectedChanges []destroy.AttributeChange
+	}{
+		{
+			name:      "no drift",
+			stored:    cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")}),
+			schema:    schema,
+		},
+		{
+			name: "nested objects and maps",
+			stored: cty.ObjectVal(map[string]cty.Value{
+				"tags": cty.MapVal(map[string]cty.Value{
+					"Name": cty.StringVal("old"), "Owner": cty.StringVal("team")}),
+				"ingress": cty.ListVal([]cty.Value{ingress("10.0.0.0/16")}),
+			}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{
+				"tags": cty.MapVal(map[string]cty.Value{
+					"Name": cty.StringVal("new"), "Env": cty.StringVal("test")}),
+				"ingress": cty.ListVal([]cty.Value{ingress("10.1.0.0/16"), ingress("10.2.0.0/16")}),
+			}),
+			schema: schema,
+			expectedChanges: []destroy.AttributeChange{
+				change("ingress[0].cidr_blocks[0]", destroy.AttributeChanged, `"10.0.0.0/16"`, `"10.1.0.0/16"`),
+				// the added block contains a sensitive attribute
+				change("ingress[1]", destroy.AttributeAdded, "", `"(sensitive)"`),
+				change(`tags["Env"]`, destroy.AttributeAdded, "", `"test"`),
+				change(`tags["Name"]`, destroy.AttributeChanged, `"old"`, `"new"`),
+				change(`tags["Owner"]`, destroy.AttributeRemoved, `"team"`, ""),
+			},
+		},
+		{
+			name: "sets are compared regardless of order",
+			stored: cty.ObjectVal(map[string]cty.Value{
+				"ports": cty.SetVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)}),
+			}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{
+				"ports": cty.SetVal([]cty.Value{cty.NumberIntVal(443), cty.NumberIntVal(80)}),
+			}),
+			schema: schema,
+		},
+		{
+			name: "set elements added and removed",
+			stored: cty.ObjectVal(map[string]cty.Value{
+				"ports": cty.SetVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)}),
+			}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{
+				"ports": cty.SetVal([]cty.Value{cty.NumberIntVal(443), cty.NumberIntVal(8080)}),
+			}),
+			schema: schema,
+			expectedChanges: []destroy.AttributeChange{
+				change("ports", destroy.AttributeRemoved, "80", ""),
+				change("ports", destroy.AttributeAdded, "", "8080"),
+			},
+		},
+		{
+			name:      "type changes",
+			stored:    cty.ObjectVal(map[string]cty.Value{"size": cty.StringVal("10")}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{"size": cty.ListVal([]cty.Value{cty.NumberIntVal(10)})}),
+			schema:    schema,
+			expectedChanges: []destroy.AttributeChange{
+				change("size", destroy.AttributeChanged, `"10"`, "[10]"),
+			},
+		},
+		{
+			name:      "attribute removed from schema",
+			stored:    cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1"), "legacy": cty.True}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")}),
+			schema:    schema,
+			expectedChanges: []destroy.AttributeChange{
+				change("legacy", destroy.AttributeRemoved, "true", ""),
+			},
+		},
+		{
+			name:      "sensitive values are masked",
+			stored:    cty.ObjectVal(map[string]cty.Value{"password": cty.StringVal("old")}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{"password": cty.StringVal("new")}),
+			schema:    schema,
+			expectedChanges: []destroy.AttributeChange{
+				change("password", destroy.AttributeChanged, `"(sensitive)"`, `"(sensitive)"`),
+			},
+		},
+		{
+			name:      "all values are masked without schema",
+			stored:    cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-2")}),
+			expectedChanges: []destroy.AttributeChange{
+				change("id", destroy.AttributeChanged, `"(sensitive)"`, `"(sensitive)"`),
+			},
+		},
+		{
+			name:      "unknown values are ignored",
+			stored:    cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{"id": cty.UnknownVal(cty.String)}),
+			schema:    schema,
+		},
+		{
+			name:      "large values are truncated",
+			stored:    cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")}),
+			refreshed: cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(largeValue)}),
+			schema:    schema,
+			expectedChanges: []destroy.AttributeChange{
+				change("id", "changed", `"vpc-1"`,
+					`"\"`+largeValue[:internal.DefaultMaxValueSize-1]+`...(truncated, 5.0 MiB)"`),
+			},
+		},
+		{
+			name:      "state unknown",
+			stored:    cty.NilVal,
+			refreshed: cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")}),
+			schema:    schema,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedChanges, destroy.DiffAttrs(tc.stored, tc.refreshed, tc.schema))
+		})
+	}
+}
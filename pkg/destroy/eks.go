@@ -0,0 +1,48 @@
+package destroy
+
+import (
+	"time"
+
+	"github.com/apex/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// eksTimeout is the amount of time to wait for the deletion of an EKS cluster, node group, or Fargate profile
+// (draining many nodes of a node group can take much longer than the provider's default timeout).
+const eksTimeout = 60 * time.Minute
+
+// eksClusterFields returns the security group that EKS creates for a cluster (which is not part of the state),
+// as it might block the deletion of the cluster's VPC if EKS doesn't delete it alongside the cluster.
+func (r Resource) eksClusterFields() log.Fields {
+	if r.State() == nil || r.State().IsNull() || !r.State().Type().HasAttribute("vpc_config") {
+		return nil
+	}
+
+	vpcConfig := r.State().GetAttr("vpc_config")
+	if !vpcConfig.IsKnown() || vpcConfig.IsNull() || vpcConfig.LengthInt() == 0 {
+		return nil
+	}
+
+	fields := log.Fields{}
+
+	it := vpcConfig.ElementIterator()
+	it.Next()
+	_, config := it.Element()
+
+	for _, attr := range []string{"cluster_security_group_id", "vpc_id"} {
+		if !config.Type().HasAttribute(attr) {
+			continue
+		}
+
+		v := config.GetAttr(attr)
+		if v.IsKnown() && !v.IsNull() && v.Type() == cty.String && v.AsString() != "" {
+			fields[attr] = r.redact(cty.GetAttrPath("vpc_config").IndexInt(0).GetAttr(attr), v.AsString())
+		}
+	}
+
+	if _, ok := fields["cluster_security_group_id"]; !ok {
+		return nil
+	}
+
+	return fields
+}
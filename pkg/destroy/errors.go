@@ -0,0 +1,174 @@
+package destroy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrResourceGone is the error of a resource of the state that doesn't exist anymore, which is found
+// when its state is updated.
+var ErrResourceGone = errors.New("resource doesn't exist anymore")
+
+// NewRetryDestroyError creates a RetryDestroyError.
+func NewRetryDestroyError(err error, r DestroyableResource) *RetryDestroyError {
+	if err == nil {
+		return nil
+	}
+
+	return &RetryDestroyError{Err: err, Resource: r, Class: Classify(err)}
+}
+
+// RetryDestroyError is returned when destroying of a resource has failed, most likely due to being
+// a dependency for another resource. It may be worth retrying once the dependent resource is gone
+// (see ErrorClass.Retryable()).
+type RetryDestroyError struct {
+	Err error
+	// Resource is the resource for which a destroy has failed.
+	Resource DestroyableResource
+	// Class is the class of the error.
+	Class ErrorClass
+}
+
+func (r RetryDestroyError) Error() string {
+	return r.Err.Error()
+}
+
+func (r RetryDestroyError) Unwrap() error {
+	return r.Err
+}
+
+// StepError is returned when a step that needs to happen before a resource can be destroyed has failed
+// (e.g., disabling a CloudFront distribution). It distinguishes such failures from failures of the destroy itself.
+type StepError struct {
+	// Step is the name of the failed step.
+	Step string
+	// SubStep is the name of the failed part of the step, if the step consists of several (see UpdateSteps).
+	SubStep string
+	// AfterDestroy is true if the step failed after the resource has been destroyed (see TypeHandler.PostDelete).
+	AfterDestroy bool
+	Err          error
+}
+
+func (e StepError) Error() string {
+	step := e.Step
+	if e.SubStep != "" {
+		step = fmt.Sprintf("%s step (%s)", e.Step, e.SubStep)
+	} else {
+		step += " step"
+	}
+
+	if e.AfterDestroy {
+		return fmt.Sprintf("%s failed (after destroy): %s", step, e.Err)
+	}
+
+	return fmt.Sprintf("%s failed (before destroy): %s", step, e.Err)
+}
+
+func (e StepError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedTypeError is returned for a resource whose type isn't part of the schema of its provider
+// (e.g., since a newer version of the provider has removed or renamed the type).
+type UnsupportedTypeError struct {
+	Type string
+	// Provider and Version are the name and version of the provider.
+	Provider string
+	Version  string
+}
+
+func (e UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("type not supported by provider %s %s (pin an older version of the provider "+
+		"that supports it via -provider-version %s=<version>)", e.Provider, e.Version, e.Provider)
+}
+
+// SchemaVersionError is returned when the state of a resource couldn't be updated, while the schema version
+// of the resource recorded in the state is newer than the one of its provider (i.e., a newer version
+// of the provider has created the resource).
+type SchemaVersionError struct {
+	Err error
+	// StateVersion is the schema version of the resource recorded in the state.
+	StateVersion uint64
+	// ProviderSchemaVersion is the schema version of the resource's type of the provider.
+	ProviderSchemaVersion int64
+	// Provider and Version are the name and version of the provider.
+	Provider string
+	Version  string
+}
+
+func (e SchemaVersionError) Error() string {
+	return fmt.Sprintf("%s (schema version in state %d is newer than the one of provider %s %s, which is %d; "+
+		"use a newer version of the provider via -auto-upgrade-provider or -provider-version %s=<version>)",
+		e.Err, e.StateVersion, e.Provider, e.Version, e.ProviderSchemaVersion, e.Provider)
+}
+
+func (e SchemaVersionError) Unwrap() error {
+	return e.Err
+}
+
+// CredentialsExpiredError is returned when destroying a resource has failed because the AWS credentials
+// have expired (e.g., the temporary credentials of an assumed role, which last at most one hour).
+type CredentialsExpiredError struct {
+	Err error
+}
+
+func (e CredentialsExpiredError) Error() string {
+	return fmt.Sprintf("credentials expired: %s", e.Err)
+}
+
+func (e CredentialsExpiredError) Unwrap() error {
+	return e.Err
+}
+
+//nolint:gochecknoglobals
+var (
+	// credentialsExpiredErrors are parts of error messages returned by the AWS API for expired credentials.
+	credentialsExpiredErrors = []string{
+		"ExpiredToken",
+		"RequestExpired",
+		"security token included in the request is expired",
+	}
+)
+
+// withCredentialsExpired returns a CredentialsExpiredError if the given error is caused by expired credentials;
+// otherwise, the error is returned unchanged.
+func withCredentialsExpired(err error) error {
+	for _, msg := range credentialsExpiredErrors {
+		if strings.Contains(err.Error(), msg) {
+			return &CredentialsExpiredError{Err: err}
+		}
+	}
+
+	return err
+}
+
+// ManualActionError is returned when a resource can't be destroyed until a setting of it has been changed by hand
+// (e.g., an S3 bucket with MFA delete enabled, which only the root account can disable with its MFA device).
+// Retrying to destroy such a resource is pointless.
+type ManualActionError struct {
+	Err error
+	// Setting is the setting that prevents the destroy (e.g., "MFA delete").
+	Setting string
+	// Remediation describes how to change the setting so that the resource can be destroyed.
+	Remediation string
+}
+
+func (e ManualActionError) Error() string {
+	return fmt.Sprintf("requires manual action (%s): %s: %s", e.Setting, e.Remediation, e.Err)
+}
+
+func (e ManualActionError) Unwrap() error {
+	return e.Err
+}
+
+// RemediationOf returns how to change the setting that prevents the destroy of a resource that failed with
+// the given error, or an empty string if the error isn't a ManualActionError.
+func RemediationOf(err error) string {
+	var manualActionErr *ManualActionError
+	if errors.As(err, &manualActionErr) {
+		return manualActionErr.Remediation
+	}
+
+	return ""
+}
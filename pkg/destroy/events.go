@@ -0,0 +1,113 @@
+package destroy
+
+import (
+	"github.com/apex/log"
+)
+
+// Events receives the progress of updating and destroying resources, e.g., to log it or to show it in a UI.
+//
+// Callbacks might be called concurrently by multiple workers. To implement only some of the callbacks,
+// embed NoopEvents.
+type Events interface {
+	// ResourceDiscovered is called for each resource whose state has been updated and that still exists.
+	ResourceDiscovered(e ResourceEvent)
+	// ResourceImportFailed is called for each resource whose state couldn't be updated
+	// (or that doesn't exist anymore). Such resources are not destroyed.
+	ResourceImportFailed(e ResourceEvent)
+	// ResourceDeleted is called for each destroyed resource.
+	ResourceDeleted(e ResourceEvent)
+	// ResourceFailed is called each time a resource fails to be destroyed.
+	ResourceFailed(e ResourceEvent)
+	// AuxiliaryDeleted is called for each resource that isn't part of the state, but has been deleted
+	// (or failed to be deleted) alongside a resource (e.g., a record set deleted before its hosted zone).
+	AuxiliaryDeleted(d AuxiliaryDeletion)
+	// RunCompleted is called once all resources have been destroyed or the remaining ones failed.
+	RunCompleted(result Result)
+}
+
+// ResourceEvent is the event of a single resource.
+type ResourceEvent struct {
+	// Address is the absolute address of the resource instance in the state (can be empty if unknown).
+	Address string
+	Type    string
+	ID      string
+	// Deposed is the key of the deposed object of the resource instance (empty for its current object;
+	// see Resource.Deposed).
+	Deposed string
+	// Err is the reason why updating the state or destroying the resource failed.
+	Err error
+	// Class is the class of Err.
+	Class ErrorClass
+	// Retryable is true if destroying the resource failed, but is worth being retried (see ErrorClass.Retryable()).
+	Retryable bool
+	// Fields is additional information about the resource (e.g., the date a KMS key will be deleted).
+	Fields log.Fields
+	// Owner is the owner of the resource (empty if owners are disabled; see Resource.Owner).
+	Owner string
+	// SkipReason is why the resource is skipped, if its state couldn't be updated (empty otherwise).
+	SkipReason SkipReason
+	// SubResources are destroyed along with the resource (see SubResource).
+	SubResources []SubResource
+	// ForceDestroyDisabled is true if the force destroy attributes of the resource have been left as they are
+	// (see Resource.ForceDestroyDisabled).
+	ForceDestroyDisabled bool
+}
+
+// NoopEvents ignores all events.
+type NoopEvents struct{}
+
+// ResourceDiscovered implements Events.
+func (NoopEvents) ResourceDiscovered(ResourceEvent) {}
+
+// ResourceImportFailed implements Events.
+func (NoopEvents) ResourceImportFailed(ResourceEvent) {}
+
+// ResourceDeleted implements Events.
+func (NoopEvents) ResourceDeleted(ResourceEvent) {}
+
+// ResourceFailed implements Events.
+func (NoopEvents) ResourceFailed(ResourceEvent) {}
+
+// AuxiliaryDeleted implements Events.
+func (NoopEvents) AuxiliaryDeleted(AuxiliaryDeletion) {}
+
+// RunCompleted implements Events.
+func (NoopEvents) RunCompleted(Result) {}
+
+// orNoop returns the given events or, if nil, events that are ignored.
+func orNoop(events Events) Events {
+	if events == nil {
+		return NoopEvents{}
+	}
+
+	return events
+}
+
+// fieldsProvider is implemented by resources that provide additional information once destroyed.
+type fieldsProvider interface {
+	DeletedFields() log.Fields
+}
+
+// newImportFailedEvent returns the event of a resource whose state couldn't be updated with the given error.
+func newImportFailedEvent(r *Resource, err error) ResourceEvent {
+	e := newResourceEvent(r, err)
+	e.SkipReason = updateSkipReason(r, err)
+
+	return e
+}
+
+// newResourceEvent returns the event of a given resource.
+func newResourceEvent(r DestroyableResource, err error) ResourceEvent {
+	return ResourceEvent{
+		Address:      r.Address(),
+		Type:         r.Type(),
+		ID:           r.ID(),
+		Deposed:      DeposedOf(r),
+		Err:          err,
+		Class:        Classify(err),
+		Owner:        OwnerOf(r),
+		SubResources: SubResourcesOf(r),
+
+		ForceDestroyDisabled: ForceDestroyDisabledOf(r),
+	}
+}
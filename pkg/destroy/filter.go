@@ -0,0 +1,88 @@
+package destroy
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Filter selects the resources to destroy.
+//
+// Filters are applied before and after the states of resources have been updated, so that a filter can decide
+// based on the attributes recorded in the state as well as on the current attributes of a resource.
+// Before the update, ResourceCandidate.RefreshedAttrs is cty.NilVal; a filter that needs the current attributes
+// should match then and decide once they are available. Likewise, ResourceCandidate.Attrs is cty.NilVal while
+// resources are listed (see SelectingResourceLister).
+type Filter interface {
+	// Match returns true if the resource is to be destroyed. Otherwise, it also returns the reason why
+	// the resource is skipped (e.g., to be logged; see SkipReason.Description).
+	Match(c ResourceCandidate) (bool, SkipReason)
+}
+
+// ResourceCandidate is a resource that might be destroyed.
+type ResourceCandidate struct {
+	// Address is the absolute address of the resource instance in the state (can be empty if unknown).
+	Address string
+	Type    string
+	ID      string
+	// Deposed is the key of the deposed object of the resource instance (empty for its current object;
+	// see Resource.Deposed).
+	Deposed string
+	// Attrs are the attributes of the resource as recorded in the state (cty.NilVal if unknown).
+	Attrs cty.Value
+	// RefreshedAttrs are the current attributes of the resource (cty.NilVal if the state hasn't been updated yet),
+	// which can contain marked values (e.g., sensitive ones; see Value.UnmarkDeep).
+	RefreshedAttrs cty.Value
+}
+
+// FilterFunc is a function that implements Filter.
+type FilterFunc func(c ResourceCandidate) (bool, SkipReason)
+
+// Match implements Filter.
+func (f FilterFunc) Match(c ResourceCandidate) (bool, SkipReason) {
+	return f(c)
+}
+
+// Filters is a chain of filters, which matches if all of its filters match.
+type Filters []Filter
+
+// Match returns true if all filters match. Otherwise, it returns the reason of the first filter that doesn't match.
+func (fs Filters) Match(c ResourceCandidate) (bool, SkipReason) {
+	for _, f := range fs {
+		if f == nil {
+			continue
+		}
+
+		if ok, reason := f.Match(c); !ok {
+			return false, reason
+		}
+	}
+
+	return true, ""
+}
+
+// SkippedResource is a resource that is not destroyed, as it didn't match a filter (or its provider isn't supported).
+type SkippedResource struct {
+	Resource *Resource
+	// Reason is why the resource is skipped.
+	Reason SkipReason
+}
+
+// Select returns the resources that match the given filter and the ones that are skipped.
+func Select(resources []*Resource, filter Filter) ([]*Resource, []SkippedResource) {
+	var selected []*Resource
+
+	var skipped []SkippedResource
+
+	for _, r := range resources {
+		if filter != nil {
+			if ok, reason := filter.Match(r.Candidate()); !ok {
+				skipped = append(skipped, SkippedResource{Resource: r, Reason: reason})
+
+				continue
+			}
+		}
+
+		selected = append(selected, r)
+	}
+
+	return selected, skipped
+}
@@ -0,0 +1,96 @@
+package destroy_test
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSelect(t *testing.T) {
+	protected := cty.ObjectVal(map[string]cty.Value{
+		"tags": cty.MapVal(map[string]cty.Value{"protected": cty.StringVal("true")}),
+	})
+	unprotected := cty.ObjectVal(map[string]cty.Value{
+		"tags": cty.MapValEmpty(cty.String),
+	})
+
+	protectedFilter := destroy.FilterFunc(func(c destroy.ResourceCandidate) (bool, destroy.SkipReason) {
+		if c.Attrs == cty.NilVal {
+			return true, ""
+		}
+
+		if _, ok := c.Attrs.GetAttr("tags").AsValueMap()["protected"]; ok {
+			return false, "tagged_protected"
+		}
+
+		return true, ""
+	})
+
+	tests := []struct {
+		name            string
+		filter          destroy.Filter
+		expectSelected  []string
+		expectSkipped   []string
+		expectedReasons []destroy.SkipReason
+	}{
+		{
+			name:           "no filter",
+			expectSelected: []string{"vpc-1", "vpc-2", "vpc-3", "vpc-4"},
+		},
+		{
+			name:            "custom filter",
+			filter:          protectedFilter,
+			expectSelected:  []string{"vpc-1", "vpc-3", "vpc-4"},
+			expectSkipped:   []string{"vpc-2"},
+			expectedReasons: []destroy.SkipReason{"tagged_protected"},
+		},
+		{
+			name:            "chain of filters",
+			filter:          destroy.Filters{destroy.DefaultResourcesFilter{}, nil, protectedFilter},
+			expectSelected:  []string{"vpc-3", "vpc-4"},
+			expectSkipped:   []string{"vpc-1", "vpc-2"},
+			expectedReasons: []destroy.SkipReason{destroy.SkipReasonDefaultResource, "tagged_protected"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resources := []*destroy.Resource{
+				destroy.NewWithState("aws_default_vpc.default", "aws_default_vpc", "vpc-1", nil, nil, &unprotected),
+				destroy.NewWithState("aws_vpc.protected", "aws_vpc", "vpc-2", nil, nil, &protected),
+				destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-3", nil, nil, &unprotected),
+				destroy.New("aws_vpc", "vpc-4", nil, nil),
+			}
+
+			actualSelected, actualSkipped := destroy.Select(resources, tc.filter)
+
+			var actualSelectedIDs []string
+			for _, r := range actualSelected {
+				actualSelectedIDs = append(actualSelectedIDs, r.ID())
+			}
+
+			assert.Equal(t, tc.expectSelected, actualSelectedIDs)
+
+			require.Len(t, actualSkipped, len(tc.expectSkipped))
+
+			for i, s := range actualSkipped {
+				assert.Equal(t, tc.expectSkipped[i], s.Resource.ID())
+				assert.Equal(t, tc.expectedReasons[i], s.Reason)
+			}
+		})
+	}
+}
+
+func TestResource_Candidate(t *testing.T) {
+	state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1234")})
+
+	actualCandidate := destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-1234", nil, nil, &state).Candidate()
+
+	assert.Equal(t, "aws_vpc.test", actualCandidate.Address)
+	assert.Equal(t, "aws_vpc", actualCandidate.Type)
+	assert.Equal(t, "vpc-1234", actualCandidate.ID)
+	assert.Equal(t, state, actualCandidate.Attrs)
+	assert.Equal(t, cty.NilVal, actualCandidate.RefreshedAttrs)
+}
@@ -0,0 +1,72 @@
+package destroy
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+//nolint:gochecknoglobals
+var (
+	// globalTypePrefixes lists the prefixes of the types of resources of global AWS services, which aren't bound to
+	// a region (their ARNs have no region, or they are managed via us-east-1 only).
+	globalTypePrefixes = []string{
+		"aws_cloudfront_",
+		"aws_globalaccelerator_",
+		"aws_iam_",
+		"aws_organizations_",
+		"aws_route53_",
+		"aws_shield_",
+		// WAF classic for CloudFront (the regional one is aws_wafregional_*)
+		"aws_waf_",
+	}
+
+	// regionalTypePrefixes lists exceptions of globalTypePrefixes, whose resources are bound to a region.
+	regionalTypePrefixes = []string{
+		"aws_route53_resolver_",
+	}
+
+	// globalInUSEast1Types lists resource types that are regional, but global if created in us-east-1, where they
+	// are used by global services (e.g., ACM certificates of CloudFront distributions).
+	globalInUSEast1Types = map[string]bool{
+		"aws_acm_certificate": true,
+	}
+)
+
+// IsGlobal returns true if a resource of the given type and ID isn't bound to a region, as it belongs to a global
+// AWS service (e.g., IAM, Route53, CloudFront, or WAF classic) or is a resource in us-east-1 used by one
+// (e.g., an ACM certificate, whose ID is its ARN). Global resources match every region.
+func IsGlobal(terraformType, id string) bool {
+	if globalInUSEast1Types[terraformType] {
+		parsed, err := arn.Parse(id)
+
+		return err == nil && parsed.Region == "us-east-1"
+	}
+
+	for _, prefix := range regionalTypePrefixes {
+		if strings.HasPrefix(terraformType, prefix) {
+			return false
+		}
+	}
+
+	for _, prefix := range globalTypePrefixes {
+		if strings.HasPrefix(terraformType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GlobalResourcesFilter skips global resources (see IsGlobal), e.g., to only destroy the resources of a region
+// in a regional cleanup.
+type GlobalResourcesFilter struct{}
+
+// Match implements Filter.
+func (GlobalResourcesFilter) Match(c ResourceCandidate) (bool, SkipReason) {
+	if IsGlobal(c.Type, c.ID) {
+		return false, SkipReasonGlobal
+	}
+
+	return true, ""
+}
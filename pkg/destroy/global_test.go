@@ -0,0 +1,78 @@
+package destroy_test
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobalResourcesFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		terraformType string
+		id            string
+		expectSkip    bool
+	}{
+		{
+			name:          "IAM role",
+			terraformType: "aws_iam_role",
+			id:            "app",
+			expectSkip:    true,
+		},
+		{
+			name:          "Route53 zone",
+			terraformType: "aws_route53_zone",
+			id:            "Z1234",
+			expectSkip:    true,
+		},
+		{
+			name:          "Route53 resolver endpoint",
+			terraformType: "aws_route53_resolver_endpoint",
+			id:            "rslvr-in-1234",
+		},
+		{
+			name:          "WAF classic",
+			terraformType: "aws_waf_web_acl",
+			id:            "1234",
+			expectSkip:    true,
+		},
+		{
+			name:          "WAF regional",
+			terraformType: "aws_wafregional_web_acl",
+			id:            "1234",
+		},
+		{
+			name:          "ACM certificate in us-east-1",
+			terraformType: "aws_acm_certificate",
+			id:            "arn:aws:acm:us-east-1:123456789012:certificate/1234",
+			expectSkip:    true,
+		},
+		{
+			name:          "ACM certificate in other region",
+			terraformType: "aws_acm_certificate",
+			id:            "arn:aws:acm:eu-west-1:123456789012:certificate/1234",
+		},
+		{
+			name:          "regional resource",
+			terraformType: "aws_vpc",
+			id:            "vpc-1234",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectSkip, destroy.IsGlobal(tc.terraformType, tc.id))
+
+			actualMatch, actualReason := destroy.GlobalResourcesFilter{}.Match(
+				destroy.ResourceCandidate{Type: tc.terraformType, ID: tc.id})
+
+			if tc.expectSkip {
+				assert.False(t, actualMatch)
+				assert.Equal(t, destroy.SkipReasonGlobal, actualReason)
+			} else {
+				assert.True(t, actualMatch)
+				assert.Empty(t, actualReason)
+			}
+		})
+	}
+}
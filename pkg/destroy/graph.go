@@ -0,0 +1,149 @@
+package destroy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GraphOutcome is the planned outcome of a resource in a graph of a plan (see DestroyPlan.Graph).
+type GraphOutcome string
+
+const (
+	// GraphOutcomeDelete means that the resource would be destroyed.
+	GraphOutcomeDelete GraphOutcome = "delete"
+	// GraphOutcomeSkip means that the resource would not be destroyed (e.g., as it doesn't exist anymore).
+	GraphOutcomeSkip GraphOutcome = "skip"
+	// GraphOutcomeProtected means that the resource is protected from being destroyed (e.g., by its type,
+	// its address, or as it adopts default infrastructure).
+	GraphOutcomeProtected GraphOutcome = "protected"
+)
+
+// Graph shows the resources of a plan with the dependencies by which Execute orders their destruction.
+type Graph struct {
+	Nodes []GraphNode
+	// Edges point from a resource to a resource it depends on, which is only destroyed after it.
+	Edges []GraphEdge
+}
+
+// GraphNode is a resource of a graph.
+type GraphNode struct {
+	// Name identifies the node: the address of the resource, or its type and ID if the address is unknown.
+	Name    string
+	Type    string
+	ID      string
+	Outcome GraphOutcome
+	// Group is the group of the resource in the order of the plan (see OrderedResource.Group; zero if the
+	// resource isn't destroyed).
+	Group int
+	// SkipReason is why the resource isn't destroyed (empty if it is).
+	SkipReason SkipReason
+}
+
+// GraphEdge is a dependency between two resources of a graph by the names of their nodes.
+type GraphEdge struct {
+	From string
+	To   string
+	// Implicit is true if the dependency is one between the types of the resources that the state doesn't capture
+	// (e.g., of a NAT gateway on an Elastic IP), rather than one recorded in the state.
+	Implicit bool
+}
+
+// Graph returns the graph of the resources of the plan. The dependencies are the ones by which Execute orders
+// the resources (i.e., only between resources of the same top-level module instance if ordered by module,
+// as module instances are destroyed one after another then).
+func (plan *DestroyPlan) Graph() Graph {
+	var g Graph
+
+	group := 0
+
+	for _, resources := range plan.groups() {
+		names := make([]string, len(resources))
+		groups := map[DestroyableResource]int{}
+
+		for _, dependencyGroup := range orderByDependencies(resources) {
+			group++
+
+			for _, r := range dependencyGroup {
+				groups[r] = group
+			}
+		}
+
+		for i, r := range resources {
+			names[i] = nodeName(r.Address(), r.Type(), r.ID(), DeposedOf(r))
+
+			g.Nodes = append(g.Nodes, GraphNode{
+				Name:    names[i],
+				Type:    r.Type(),
+				ID:      r.ID(),
+				Outcome: GraphOutcomeDelete,
+				Group:   groups[r],
+			})
+		}
+
+		for _, e := range dependencyEdges(resources) {
+			g.Edges = append(g.Edges, GraphEdge{From: names[e.from], To: names[e.to], Implicit: e.implicit})
+		}
+	}
+
+	skipped := func(address, rType, id, deposed string, reason SkipReason) {
+		outcome := GraphOutcomeSkip
+
+		switch reason {
+		case SkipReasonProtectedType, SkipReasonNotAllowListed, SkipReasonExcludedAddress, SkipReasonDefaultResource,
+			SkipReasonInNewState, SkipReasonMoved:
+			outcome = GraphOutcomeProtected
+		}
+
+		g.Nodes = append(g.Nodes, GraphNode{Name: nodeName(address, rType, id, deposed), Type: rType, ID: id,
+			Outcome: outcome, SkipReason: reason})
+	}
+
+	for _, s := range plan.Skipped {
+		skipped(s.Resource.Address(), s.Resource.Type(), s.Resource.ID(), DeposedOf(s.Resource), s.Reason)
+	}
+
+	for _, events := range [][]ResourceEvent{plan.Gone, plan.AlreadyGone} {
+		for _, e := range events {
+			skipped(e.Address, e.Type, e.ID, e.Deposed, e.SkipReason)
+		}
+	}
+
+	return g
+}
+
+// nodeName returns the name of the node of a resource in a graph (deposed objects are named after their resource
+// instance and their key, so that they don't share the node of its current object).
+func nodeName(address, rType, id, deposed string) string {
+	if address != "" && deposed != "" {
+		return fmt.Sprintf("%s (deposed %s)", address, deposed)
+	}
+
+	if address != "" {
+		return address
+	}
+
+	return fmt.Sprintf("%s.%s", rType, id)
+}
+
+// Module returns the subgraph of the resources of the given module instance and its child modules
+// (e.g., module.vpc, or module.preview for all its instances), with the dependencies between them.
+func (g Graph) Module(module string) Graph {
+	var sub Graph
+
+	included := map[string]bool{}
+
+	for _, n := range g.Nodes {
+		if strings.HasPrefix(n.Name, module+".") || strings.HasPrefix(n.Name, module+"[") {
+			included[n.Name] = true
+			sub.Nodes = append(sub.Nodes, n)
+		}
+	}
+
+	for _, e := range g.Edges {
+		if included[e.From] && included[e.To] {
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+
+	return sub
+}
@@ -0,0 +1,89 @@
+package destroy_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDestroyPlan_Graph(t *testing.T) {
+	stub := provider.NewStub(provider.StubConfig{},
+		[]string{"aws_default_vpc", "aws_eip", "aws_nat_gateway", "aws_subnet", "aws_vpc"})
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return stub, nil
+		},
+	})
+	require.NoError(t, err)
+
+	goneState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-gone")})
+
+	stub.ApplyResourceChange(providers.ApplyResourceChangeRequest{TypeName: "aws_vpc", PriorState: goneState,
+		PlannedState: cty.NullVal(goneState.Type())})
+
+	state := fakeState{resources: []*destroy.Resource{
+		destroy.NewWithState("aws_default_vpc.default", "aws_default_vpc", "vpc-default", nil, tp, nil),
+		destroy.NewWithState("aws_vpc.gone", "aws_vpc", "vpc-gone", nil, tp, nil),
+		destroy.NewWithState("module.vpc.aws_vpc.test", "aws_vpc", "vpc-1", nil, tp, nil),
+		destroy.NewWithState("module.vpc.aws_subnet.test", "aws_subnet", "subnet-1",
+			[]string{"module.vpc.aws_vpc.test"}, tp, nil),
+		destroy.NewWithState("aws_eip.nat", "aws_eip", "eipalloc-1", nil, tp, nil),
+		destroy.NewWithState("module.vpc.aws_nat_gateway.test", "aws_nat_gateway", "nat-1",
+			[]string{"module.vpc.aws_subnet.test"}, tp, nil),
+	}}
+
+	plan, err := destroy.Plan(context.Background(), state, destroy.DefaultResourcesFilter{}, destroy.Config{})
+	require.NoError(t, err)
+
+	actual := plan.Graph()
+
+	assert.ElementsMatch(t, []destroy.GraphNode{
+		{Name: "module.vpc.aws_nat_gateway.test", Type: "aws_nat_gateway", ID: "nat-1",
+			Outcome: destroy.GraphOutcomeDelete, Group: 1},
+		{Name: "module.vpc.aws_subnet.test", Type: "aws_subnet", ID: "subnet-1",
+			Outcome: destroy.GraphOutcomeDelete, Group: 2},
+		{Name: "aws_eip.nat", Type: "aws_eip", ID: "eipalloc-1", Outcome: destroy.GraphOutcomeDelete, Group: 2},
+		{Name: "module.vpc.aws_vpc.test", Type: "aws_vpc", ID: "vpc-1", Outcome: destroy.GraphOutcomeDelete, Group: 3},
+		{Name: "aws_default_vpc.default", Type: "aws_default_vpc", ID: "vpc-default",
+			Outcome: destroy.GraphOutcomeProtected, SkipReason: destroy.SkipReasonDefaultResource},
+		{Name: "aws_vpc.gone", Type: "aws_vpc", ID: "vpc-gone", Outcome: destroy.GraphOutcomeSkip,
+			SkipReason: destroy.SkipReasonAlreadyGone},
+	}, actual.Nodes)
+
+	assert.ElementsMatch(t, []destroy.GraphEdge{
+		{From: "module.vpc.aws_subnet.test", To: "module.vpc.aws_vpc.test"},
+		{From: "module.vpc.aws_nat_gateway.test", To: "module.vpc.aws_subnet.test"},
+		{From: "module.vpc.aws_nat_gateway.test", To: "aws_eip.nat", Implicit: true},
+	}, actual.Edges, "dependencies recorded in the state must not be repeated as implicit ones")
+
+	for _, ordered := range plan.Order() {
+		for _, n := range actual.Nodes {
+			if n.Name == ordered.Address {
+				assert.Equal(t, ordered.Group, n.Group, "graph must show the order of the plan: %s", n.Name)
+			}
+		}
+	}
+
+	module := actual.Module("module.vpc")
+
+	var names []string
+	for _, n := range module.Nodes {
+		names = append(names, n.Name)
+	}
+
+	assert.ElementsMatch(t, []string{"module.vpc.aws_nat_gateway.test", "module.vpc.aws_subnet.test",
+		"module.vpc.aws_vpc.test"}, names)
+	assert.ElementsMatch(t, []destroy.GraphEdge{
+		{From: "module.vpc.aws_subnet.test", To: "module.vpc.aws_vpc.test"},
+		{From: "module.vpc.aws_nat_gateway.test", To: "module.vpc.aws_subnet.test"},
+	}, module.Edges, "edges to resources outside the module must be dropped")
+}
@@ -0,0 +1,141 @@
+package destroy
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TypeHandler contributes steps to destroying resources of the types it is registered for (see RegisterTypeHandler),
+// such as disabling a resource before it can be deleted.
+//
+// The steps run as part of destroying a resource, i.e., limited by the concurrency of destroy operations.
+// A failed step fails the resource with a StepError, which is classified by the error of the step
+// (e.g., ErrorClassPermissionDenied). Resources that aren't part of the state, but are deleted by a step,
+// are reported via ReportAuxiliary.
+type TypeHandler interface {
+	// Name is the name of the handler's steps, which failures are reported with (e.g., "disable").
+	Name() string
+	// Applies returns if the handler applies to the given resource (e.g., only if enabled by its options).
+	Applies(r Resource) bool
+	// Describe returns what the handler would do (shown when previewing the resource, e.g., in a dry run).
+	Describe(r Resource) string
+	// PreDelete runs before the resource is destroyed and returns the state to destroy the resource with.
+	PreDelete(ctx context.Context, r Resource) (cty.Value, error)
+	// PostDelete runs after the resource has been destroyed.
+	PostDelete(ctx context.Context, r Resource) error
+}
+
+// AuxiliaryPredictor is implemented by a TypeHandler whose steps delete resources that aren't part of the state,
+// to list them before anything is deleted (see Resource.PredictAuxiliaries).
+type AuxiliaryPredictor interface {
+	PredictAuxiliaries(ctx context.Context, r Resource) ([]AuxiliaryDeletion, error)
+}
+
+// TypeHandlerFuncs is a TypeHandler (and AuxiliaryPredictor) made of functions, each of which can be nil
+// if the handler has no such step.
+type TypeHandlerFuncs struct {
+	Step        string
+	Description string
+	// Enabled returns if the handler is enabled by the given options. If nil, the handler is always enabled.
+	Enabled func(Options) bool
+	// Pre returns the new state of the resource. If nil, the resource is destroyed with its current state.
+	Pre         func(Resource, context.Context) (cty.Value, error)
+	Post        func(Resource, context.Context) error
+	Auxiliaries func(Resource, context.Context) ([]AuxiliaryDeletion, error)
+}
+
+// Name implements TypeHandler.
+func (h TypeHandlerFuncs) Name() string {
+	return h.Step
+}
+
+// Applies implements TypeHandler.
+func (h TypeHandlerFuncs) Applies(r Resource) bool {
+	return h.Enabled == nil || h.Enabled(r.Options)
+}
+
+// Describe implements TypeHandler.
+func (h TypeHandlerFuncs) Describe(Resource) string {
+	return h.Description
+}
+
+// PreDelete implements TypeHandler.
+func (h TypeHandlerFuncs) PreDelete(ctx context.Context, r Resource) (cty.Value, error) {
+	if h.Pre == nil {
+		return *r.State(), nil
+	}
+
+	return h.Pre(r, ctx)
+}
+
+// PostDelete implements TypeHandler.
+func (h TypeHandlerFuncs) PostDelete(ctx context.Context, r Resource) error {
+	if h.Post == nil {
+		return nil
+	}
+
+	return h.Post(r, ctx)
+}
+
+// PredictAuxiliaries implements AuxiliaryPredictor.
+func (h TypeHandlerFuncs) PredictAuxiliaries(ctx context.Context, r Resource) ([]AuxiliaryDeletion, error) {
+	if h.Auxiliaries == nil {
+		return nil, nil
+	}
+
+	return h.Auxiliaries(r, ctx)
+}
+
+//nolint:gochecknoglobals
+var (
+	// registeredHandlers are the handlers registered via RegisterTypeHandler by resource type,
+	// which run after the built-in ones (see typeHandlers).
+	registeredHandlers   = map[string][]TypeHandler{}
+	registeredHandlersMu sync.RWMutex
+)
+
+// RegisterTypeHandler registers a handler whose steps run when resources of the given type are destroyed,
+// after the steps of the built-in handlers and of handlers registered before.
+func RegisterTypeHandler(terraformType string, h TypeHandler) {
+	registeredHandlersMu.Lock()
+	defer registeredHandlersMu.Unlock()
+
+	registeredHandlers[terraformType] = append(registeredHandlers[terraformType], h)
+}
+
+// handlers returns the handlers that apply to the resource, in the order their steps run.
+func (r Resource) handlers() []TypeHandler {
+	registeredHandlersMu.RLock()
+	all := append(append([]TypeHandler{}, typeHandlers[r.Type()]...), registeredHandlers[r.Type()]...)
+	registeredHandlersMu.RUnlock()
+
+	if h, ok := r.overrideHandler(); ok {
+		all = append(all, h)
+	}
+
+	var result []TypeHandler
+
+	for _, h := range all {
+		if h.Applies(r) {
+			result = append(result, h)
+		}
+	}
+
+	return result
+}
+
+// describeHandlers returns what the handlers that apply to the resource would do, if any.
+func (r Resource) describeHandlers() string {
+	var descriptions []string
+
+	for _, h := range r.handlers() {
+		if d := h.Describe(r); d != "" {
+			descriptions = append(descriptions, d)
+		}
+	}
+
+	return strings.Join(descriptions, "; ")
+}
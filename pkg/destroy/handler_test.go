@@ -0,0 +1,131 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// recordingHandler is a handler that records its steps and deletes an auxiliary resource after the destroy.
+type recordingHandler struct {
+	destroy.TypeHandlerFuncs
+
+	steps   *[]string
+	postErr error
+}
+
+func (h recordingHandler) PreDelete(_ context.Context, r destroy.Resource) (cty.Value, error) {
+	*h.steps = append(*h.steps, "pre "+r.ID())
+
+	return *r.State(), nil
+}
+
+func (h recordingHandler) PostDelete(ctx context.Context, r destroy.Resource) error {
+	*h.steps = append(*h.steps, "post "+r.ID())
+
+	destroy.ReportAuxiliary(ctx, destroy.AuxiliaryDeletion{Parent: r.Address(), Type: "log stream", ID: "stream-1",
+		Outcome: destroy.AuxiliaryDeleted})
+
+	return h.postErr
+}
+
+func TestRegisterTypeHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		terraformType   string
+		options         destroy.Options
+		postErr         error
+		expectedSteps   []string
+		expectedDeleted []string
+		expectedFailed  []string
+	}{
+		{
+			name:            "pre and post delete",
+			terraformType:   "aws_handled_pre_and_post",
+			options:         destroy.Options{BatchDeletes: true},
+			expectedSteps:   []string{"pre id-1", "post id-1"},
+			expectedDeleted: []string{"aws_handled_pre_and_post.test"},
+		},
+		{
+			name:          "post delete failed",
+			terraformType: "aws_handled_post_failed",
+			options:       destroy.Options{BatchDeletes: true},
+			postErr:       fmt.Errorf("AccessDenied: not allowed"),
+			expectedSteps: []string{"pre id-1", "post id-1"},
+			expectedFailed: []string{"aws_handled_post_failed.test (retryable=false): " +
+				"clean up step failed (after destroy): AccessDenied: not allowed"},
+		},
+		{
+			name:            "not enabled",
+			terraformType:   "aws_handled_not_enabled",
+			expectedDeleted: []string{"aws_handled_not_enabled.test"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var actualSteps []string
+
+			destroy.RegisterTypeHandler(tc.terraformType, recordingHandler{
+				TypeHandlerFuncs: destroy.TypeHandlerFuncs{
+					Step:        "clean up",
+					Description: "delete log streams after destroy",
+					Enabled:     func(o destroy.Options) bool { return o.BatchDeletes },
+					Auxiliaries: func(r destroy.Resource, _ context.Context) ([]destroy.AuxiliaryDeletion, error) {
+						return []destroy.AuxiliaryDeletion{{Parent: r.Address(), Type: "log stream", ID: "stream-1",
+							Outcome: destroy.AuxiliaryWouldBeDeleted}}, nil
+					},
+				},
+				steps:   &actualSteps,
+				postErr: tc.postErr,
+			})
+
+			stub := provider.NewStub(provider.StubConfig{}, []string{tc.terraformType})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return stub, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("id-1")})
+
+			r := destroy.NewWithState(tc.terraformType+".test", tc.terraformType, "id-1", nil, tp, &state)
+			r.Options = tc.options
+
+			actualAuxiliaries, err := r.PredictAuxiliaries(context.Background())
+			require.NoError(t, err)
+
+			if tc.options.BatchDeletes {
+				assert.Equal(t, "delete log streams after destroy", r.Preview(context.Background())["note"])
+				assert.Len(t, actualAuxiliaries, 1)
+			} else {
+				assert.Empty(t, r.Preview(context.Background()))
+				assert.Empty(t, actualAuxiliaries)
+			}
+
+			events := &recordedEvents{}
+
+			destroy.Run(context.Background(), []destroy.DestroyableResource{r}, 1, events)
+
+			assert.Equal(t, tc.expectedSteps, actualSteps)
+			assert.Equal(t, tc.expectedDeleted, events.deleted)
+			assert.Equal(t, tc.expectedFailed, events.failed)
+			assert.Len(t, stub.Destroyed(), 1)
+
+			if tc.options.BatchDeletes {
+				require.NotEmpty(t, events.auxiliaries)
+				assert.Equal(t, "stream-1", events.auxiliaries[0].ID)
+			}
+		})
+	}
+}
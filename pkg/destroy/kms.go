@@ -0,0 +1,34 @@
+package destroy
+
+import (
+	"time"
+
+	"github.com/apex/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultKMSDeletionWindow is the default number of days after that a KMS key is deleted.
+const DefaultKMSDeletionWindow = 7
+
+// kmsDestroyAttrs returns the attributes of a KMS key that need to be changed in the state before calling
+// destroy, so that the key is scheduled for deletion within the configured window (see Options.KMSDeletionWindow).
+func (r Resource) kmsDestroyAttrs() map[string]cty.Value {
+	return map[string]cty.Value{
+		"deletion_window_in_days": cty.NumberIntVal(int64(r.kmsDeletionWindow())),
+	}
+}
+
+// kmsDeletedFields returns the date when a KMS key scheduled for deletion will be deleted.
+func (r Resource) kmsDeletedFields() log.Fields {
+	deletionDate := time.Now().UTC().AddDate(0, 0, r.kmsDeletionWindow())
+
+	return log.Fields{"scheduled_deletion_date": deletionDate.Format("2006-01-02")}
+}
+
+func (r Resource) kmsDeletionWindow() int {
+	if r.Options.KMSDeletionWindow == 0 {
+		return DefaultKMSDeletionWindow
+	}
+
+	return r.Options.KMSDeletionWindow
+}
@@ -0,0 +1,96 @@
+package destroy
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Values read by a provider can carry marks (e.g., Terraform's sensitivity marks). Many operations on marked values
+// panic (e.g., AsValueMap or AsString), and marked values can neither be sent to a provider nor be encoded as JSON.
+// Therefore, the state of a resource is kept unmarked, together with the paths of the values that have been marked
+// (see Resource.setState). Values with any mark are considered sensitive: they are redacted in logs and reports
+// (unless Options.LogSensitive is set); filters get the current attributes with their marks (see Candidate).
+
+// redactedValue replaces sensitive values in logs.
+const redactedValue = "(sensitive)"
+
+// setState sets the current state of the resource, which is stored without marks; the paths of its marks are kept
+// in addition to the ones of previous states (as providers don't necessarily mark values again that they return).
+func (r *Resource) setState(state cty.Value) {
+	unmarked, marks := unmarkDeep(state)
+	r.state = &unmarked
+
+	for _, m := range r.marks {
+		if !containsPath(marks, m.Path) {
+			marks = append(marks, m)
+		}
+	}
+
+	r.marks = marks
+}
+
+// markedState returns the current state of the resource with its marks.
+func (r Resource) markedState() cty.Value {
+	if r.state == nil {
+		return cty.NilVal
+	}
+
+	return markWithPaths(*r.state, r.marks)
+}
+
+// isMarked returns true if the value at the given path of the current state (or a value containing it) is marked.
+func (r Resource) isMarked(path cty.Path) bool {
+	for _, m := range r.marks {
+		if len(m.Path) <= len(path) && m.Path.Equals(path[:len(m.Path)]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redact returns the given value of the attribute at the given path of the current state, or a placeholder
+// if the attribute is marked (unless Options.LogSensitive is set).
+func (r Resource) redact(path cty.Path, value string) string {
+	if r.Options.LogSensitive || !r.isMarked(path) {
+		return value
+	}
+
+	return redactedValue
+}
+
+// withoutMarks applies the given transformation to the given value without its marks and marks the values
+// of the result again whose paths still exist.
+func withoutMarks(v cty.Value, transform func(cty.Value) cty.Value) cty.Value {
+	unmarked, marks := unmarkDeep(v)
+
+	return markWithPaths(transform(unmarked), marks)
+}
+
+// unmarkDeep returns the given value without any marks and the paths of its marks.
+func unmarkDeep(v cty.Value) (cty.Value, []cty.PathValueMarks) {
+	if v == cty.NilVal || !v.ContainsMarked() {
+		return v, nil
+	}
+
+	return v.UnmarkDeepWithPaths()
+}
+
+// markWithPaths marks the values at the given paths of the given value (paths that don't exist are ignored).
+func markWithPaths(v cty.Value, marks []cty.PathValueMarks) cty.Value {
+	if v == cty.NilVal || len(marks) == 0 {
+		return v
+	}
+
+	return v.MarkWithPaths(marks)
+}
+
+// containsPath returns true if any of the given marks is at the given path.
+func containsPath(marks []cty.PathValueMarks, path cty.Path) bool {
+	for _, m := range marks {
+		if m.Path.Equals(path) {
+			return true
+		}
+	}
+
+	return false
+}
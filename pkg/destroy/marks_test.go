@@ -0,0 +1,189 @@
+package destroy_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// markingProvider is a provider stub whose refreshed states contain values marked as sensitive,
+// and which fails a test if a marked value is sent to it.
+type markingProvider struct {
+	*provider.Stub
+	t *testing.T
+}
+
+func (p markingProvider) GetSchema() providers.GetSchemaResponse {
+	return providers.GetSchemaResponse{
+		Provider: providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{
+			"aws_ssm_parameter": {Block: &configschema.Block{
+				Attributes: map[string]*configschema.Attribute{
+					"id":       {Type: cty.String, Optional: true, Computed: true},
+					"password": {Type: cty.String, Optional: true},
+					"tags":     {Type: cty.Map(cty.String), Optional: true},
+					"ports":    {Type: cty.Set(cty.String), Optional: true},
+				},
+				BlockTypes: map[string]*configschema.NestedBlock{
+					"ingress": {
+						Nesting: configschema.NestingList,
+						Block: configschema.Block{
+							Attributes: map[string]*configschema.Attribute{
+								"cidr_blocks": {Type: cty.List(cty.String), Optional: true},
+							},
+						},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func (p markingProvider) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	assert.False(p.t, req.PriorState.ContainsMarked(), "marked value sent to provider")
+
+	response := p.Stub.ReadResource(req)
+	if response.NewState.IsNull() {
+		return response
+	}
+
+	return providers.ReadResourceResponse{NewState: markedSSMParameter("new-secret", "team-b", "10.1.0.0/16")}
+}
+
+func (p markingProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	assert.False(p.t, req.PriorState.ContainsMarked(), "marked value sent to provider")
+	assert.False(p.t, req.PlannedState.ContainsMarked(), "marked value sent to provider")
+	assert.False(p.t, req.Config.ContainsMarked(), "marked value sent to provider")
+
+	return p.Stub.ApplyResourceChange(req)
+}
+
+// ssmParameter returns the state of an SSM parameter with the given password, owner tag, and CIDR block.
+func ssmParameter(password, owner, cidr string) cty.Value {
+	return cty.ObjectVal(map[string]cty.Value{
+		"id":       cty.StringVal("param-1"),
+		"password": cty.StringVal(password),
+		"tags":     cty.MapVal(map[string]cty.Value{"Name": cty.StringVal("test"), "owner": cty.StringVal(owner)}),
+		"ports":    cty.SetVal([]cty.Value{cty.StringVal("5432"), cty.StringVal(cidr)}),
+		"ingress": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"cidr_blocks": cty.ListVal([]cty.Value{cty.StringVal(cidr)}),
+		})}),
+	})
+}
+
+// markedSSMParameter returns the state of an SSM parameter whose password, owner tag, CIDR block,
+// and ports are marked as sensitive.
+func markedSSMParameter(password, owner, cidr string) cty.Value {
+	return ssmParameter(password, owner, cidr).MarkWithPaths([]cty.PathValueMarks{
+		{Path: cty.GetAttrPath("password"), Marks: cty.NewValueMarks("sensitive")},
+		{Path: cty.GetAttrPath("tags").Index(cty.StringVal("owner")), Marks: cty.NewValueMarks("sensitive")},
+		{Path: cty.GetAttrPath("ingress").IndexInt(0).GetAttr("cidr_blocks").IndexInt(0),
+			Marks: cty.NewValueMarks("sensitive")},
+		{Path: cty.GetAttrPath("ports"), Marks: cty.NewValueMarks("sensitive")},
+	})
+}
+
+func TestPlanAndExecute_MarkedValues(t *testing.T) {
+	tests := []struct {
+		name          string
+		logSensitive  bool
+		expectedOwner string
+	}{
+		{
+			name:          "redacted",
+			expectedOwner: "(sensitive)",
+		},
+		{
+			name:          "log sensitive values",
+			logSensitive:  true,
+			expectedOwner: "team-b",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_ssm_parameter"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return markingProvider{Stub: stub, t: t}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			stored := ssmParameter("old-secret", "team-a", "10.0.0.0/16")
+
+			resources := []*destroy.Resource{
+				destroy.NewWithState("aws_ssm_parameter.test", "aws_ssm_parameter", "param-1", nil, tp, &stored),
+			}
+
+			plan, err := destroy.Plan(context.Background(), fakeState{resources: resources}, nil, destroy.Config{
+				Options: destroy.Options{OwnerTag: "owner", LogSensitive: tc.logSensitive},
+			})
+			require.NoError(t, err)
+			require.Len(t, plan.Candidates, 1)
+
+			assert.True(t, plan.Candidates[0].RefreshedAttrs.ContainsMarked(), "filters get the marked attributes")
+			assert.Equal(t, tc.expectedOwner, resources[0].Owner())
+
+			report := destroy.NewDriftReport(plan)
+			require.Len(t, report.Drifted, 1)
+
+			out, err := json.Marshal(report)
+			require.NoError(t, err)
+
+			for _, secret := range []string{"new-secret", "team-b", "10.1.0.0/16"} {
+				if tc.logSensitive {
+					assert.Contains(t, string(out), secret)
+				} else {
+					assert.NotContains(t, string(out), secret)
+				}
+			}
+
+			result := destroy.Execute(context.Background(), plan)
+
+			assert.Equal(t, 1, result.Deleted)
+			assert.Empty(t, result.Failed)
+			assert.Equal(t, []string{"aws_ssm_parameter.param-1"}, stub.Destroyed())
+		})
+	}
+}
+
+func TestDiffAttrs_MarkedValues(t *testing.T) {
+	stored := ssmParameter("old-secret", "team-a", "10.0.0.0/16")
+	refreshed := markedSSMParameter("new-secret", "team-b", "10.1.0.0/16")
+
+	changes := destroy.DiffAttrs(stored, refreshed, markingProvider{}.GetSchema().ResourceTypes["aws_ssm_parameter"].Block)
+
+	var actualChanges []string
+
+	for _, c := range changes {
+		for _, v := range []json.RawMessage{c.Old, c.New} {
+			if v != nil {
+				assert.Equal(t, json.RawMessage(`"(sensitive)"`), v, c.Path)
+			}
+		}
+
+		actualChanges = append(actualChanges, c.Kind+" "+c.Path)
+	}
+
+	// elements of sets can't be addressed, so a changed element is reported as removed and added
+	assert.ElementsMatch(t, []string{
+		"changed password",
+		`changed tags["owner"]`,
+		"changed ingress[0].cidr_blocks[0]",
+		"removed ports",
+		"added ports",
+	}, actualChanges)
+}
@@ -0,0 +1,171 @@
+package destroy
+
+import (
+	"context"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// RootModule is the name of the group of resources of the root module (see ModuleOf).
+const RootModule = "(root)"
+
+// ModuleOf returns the top-level module instance of the resource instance with the given address
+// (e.g., module.preview["pr-1234"] for module.preview["pr-1234"].module.db.aws_db_instance.this),
+// or RootModule if the resource is part of the root module or its address is unknown.
+func ModuleOf(address string) string {
+	if address == "" {
+		return RootModule
+	}
+
+	addr, diags := addrs.ParseAbsResourceInstanceStr(address)
+	if diags.HasErrors() || addr.Module.IsRoot() {
+		return RootModule
+	}
+
+	step := addr.Module[0]
+
+	return addrs.RootModuleInstance.Child(step.Name, step.InstanceKey).String()
+}
+
+// SortModules sorts the given module instances (see ModuleOf) by name, with the root module last.
+func SortModules(modules []string) {
+	sort.Slice(modules, func(i, j int) bool {
+		if (modules[i] == RootModule) != (modules[j] == RootModule) {
+			return modules[j] == RootModule
+		}
+
+		return modules[i] < modules[j]
+	})
+}
+
+// moduleGroup are the resources of a top-level module instance (see ModuleOf).
+type moduleGroup struct {
+	module    string
+	resources []DestroyableResource
+}
+
+// orderByModule groups the given resources by their top-level module instance, such that every module instance
+// comes before the module instances its resources depend on (based on the dependencies of the resources
+// recorded in the state). Otherwise, module instances are ordered by name, with the root module last,
+// which often contains resources shared by the module instances (e.g., a VPC).
+func orderByModule(resources []DestroyableResource) []moduleGroup {
+	byModule := map[string][]DestroyableResource{}
+	moduleByAddress := map[string]string{}
+
+	for _, r := range resources {
+		m := ModuleOf(r.Address())
+
+		byModule[m] = append(byModule[m], r)
+
+		if r.Address() != "" {
+			moduleByAddress[r.Address()] = m
+		}
+	}
+
+	// module instances that the resources of a module instance depend on
+	dependencies := map[string]map[string]bool{}
+	numOfDependents := map[string]int{}
+
+	for m, rs := range byModule {
+		dependencies[m] = map[string]bool{}
+
+		for _, r := range rs {
+			for _, depAddr := range r.Dependencies() {
+				dep, ok := moduleByAddress[depAddr]
+				if !ok || dep == m || dependencies[m][dep] {
+					continue
+				}
+
+				dependencies[m][dep] = true
+				numOfDependents[dep]++
+			}
+		}
+	}
+
+	var remaining []string
+
+	for m := range byModule {
+		remaining = append(remaining, m)
+	}
+
+	SortModules(remaining)
+
+	var result []moduleGroup
+
+	for len(remaining) > 0 {
+		next := -1
+
+		for i, m := range remaining {
+			if numOfDependents[m] == 0 {
+				next = i
+
+				break
+			}
+		}
+
+		if next == -1 {
+			log.Debug(internal.Pad("failed to order module instances by dependencies (cycle?)"))
+
+			next = 0
+		}
+
+		m := remaining[next]
+		remaining = append(remaining[:next], remaining[next+1:]...)
+
+		for dep := range dependencies[m] {
+			numOfDependents[dep]--
+		}
+
+		result = append(result, moduleGroup{module: m, resources: byModule[m]})
+	}
+
+	return result
+}
+
+// runByModule destroys the given resources as Run, but one top-level module instance after another
+// (see orderByModule), so that a module instance is destroyed completely before the next one is started.
+func runByModule(ctx context.Context, resources []DestroyableResource, concurrency *Concurrency,
+	events Events) Result {
+	progress := &progressEvents{Events: orNoop(events), concurrency: concurrency}
+
+	stop := progress.report(ctx)
+
+	var result Result
+
+	for _, group := range orderByModule(resources) {
+		// module instances that haven't been started remain entirely
+		if ctx.Err() != nil {
+			result.Remaining = append(result.Remaining, group.resources...)
+
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"module":    group.module,
+			"resources": len(group.resources),
+		}).Info(internal.Pad("destroying module instance"))
+
+		groupResult := run(ctx, group.resources, concurrency, progress)
+
+		result.Deleted += groupResult.Deleted
+		result.Failed = append(result.Failed, groupResult.Failed...)
+		result.Remaining = append(result.Remaining, groupResult.Remaining...)
+	}
+
+	stop()
+
+	result.Throttling = throttlingOf(concurrency)
+	result.Interrupted = ctx.Err() != nil
+
+	sortErrorsByAddress(result.Failed)
+	sortDestroyableByAddress(result.Remaining)
+
+	explainBlockers(ctx, result.Failed, resources)
+
+	progress.RunCompleted(result)
+
+	return result
+}
@@ -0,0 +1,104 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestModuleOf(t *testing.T) {
+	tests := []struct {
+		address        string
+		expectedModule string
+	}{
+		{address: "aws_vpc.test", expectedModule: destroy.RootModule},
+		{address: "aws_vpc.test[0]", expectedModule: destroy.RootModule},
+		{address: "module.vpc.aws_vpc.test", expectedModule: "module.vpc"},
+		{address: `module.preview["pr-1234"].aws_vpc.test`, expectedModule: `module.preview["pr-1234"]`},
+		{address: `module.preview["pr-1234"].module.db.aws_db_instance.this`, expectedModule: `module.preview["pr-1234"]`},
+		{address: "module.preview[2].aws_vpc.test", expectedModule: "module.preview[2]"},
+		{address: "", expectedModule: destroy.RootModule},
+		{address: "not an address", expectedModule: destroy.RootModule},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.address, func(t *testing.T) {
+			assert.Equal(t, tc.expectedModule, destroy.ModuleOf(tc.address))
+		})
+	}
+}
+
+func TestSortModules(t *testing.T) {
+	modules := []string{`module.preview["pr-2"]`, destroy.RootModule, "module.a", `module.preview["pr-1"]`}
+
+	destroy.SortModules(modules)
+
+	assert.Equal(t, []string{"module.a", `module.preview["pr-1"]`, `module.preview["pr-2"]`, destroy.RootModule},
+		modules)
+}
+
+func TestPlanAndExecute_OrderByModule(t *testing.T) {
+	tests := []struct {
+		name          string
+		orderByModule bool
+	}{
+		{name: "by module", orderByModule: true},
+		{name: "not by module"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &slowProvider{destroyLatency: 10 * time.Millisecond}
+
+			tp, err := provider.Init(context.Background(), "slow", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return p, nil
+				},
+			})
+			require.NoError(t, err)
+
+			// a VPC of the root module shared by the subnets of the preview environments
+			vpcState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-shared")})
+			resources := []*destroy.Resource{
+				destroy.NewWithState("aws_vpc.shared", "aws_vpc", "vpc-shared", nil, tp, &vpcState),
+			}
+
+			for _, pr := range []string{"pr-2", "pr-1"} {
+				module := fmt.Sprintf("module.preview[%q]", pr)
+
+				for i := 0; i < 3; i++ {
+					id := fmt.Sprintf("subnet-%s-%d", pr, i)
+					state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(id)})
+
+					resources = append(resources, destroy.NewWithState(fmt.Sprintf("%s.aws_subnet.test[%d]", module, i),
+						"aws_subnet", id, []string{"aws_vpc.shared"}, tp, &state))
+				}
+			}
+
+			_, result, err := destroy.PlanAndExecute(context.Background(), fakeState{resources: resources}, nil,
+				destroy.Config{Parallel: 10, OrderByModule: tc.orderByModule})
+			require.NoError(t, err)
+
+			assert.Equal(t, destroy.Result{Deleted: 7}, result)
+			require.Len(t, p.deleted, 7)
+			assert.Equal(t, "aws_vpc.vpc-shared", p.deleted[6])
+
+			if !tc.orderByModule {
+				return
+			}
+
+			assert.ElementsMatch(t, []string{"aws_subnet.subnet-pr-1-0", "aws_subnet.subnet-pr-1-1",
+				"aws_subnet.subnet-pr-1-2"}, p.deleted[:3], "module instances must be destroyed by name")
+			assert.ElementsMatch(t, []string{"aws_subnet.subnet-pr-2-0", "aws_subnet.subnet-pr-2-1",
+				"aws_subnet.subnet-pr-2-2"}, p.deleted[3:6])
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package destroy
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Options configures how resources are destroyed.
+type Options struct {
+	// RDSTakeFinalSnapshot takes a final snapshot of RDS instances and clusters (as well as of DocumentDB, Neptune,
+	// and Redshift clusters) before they are deleted (instead of skipping it).
+	RDSTakeFinalSnapshot bool
+	// KMSDeletionWindow is the number of days (between 7 and 30) after that KMS keys are deleted,
+	// which can't be deleted immediately. Defaults to DefaultKMSDeletionWindow if zero.
+	KMSDeletionWindow int
+	// Route53EmptyZones deletes all record sets of a hosted zone (except the zone's NS and SOA records)
+	// before the zone is destroyed, also the ones that aren't part of the state.
+	Route53EmptyZones bool
+	// SecretsForceDelete deletes Secrets Manager secrets (and their replicas) immediately,
+	// instead of scheduling their deletion with a recovery window.
+	SecretsForceDelete bool
+	// DeleteLogGroups deletes the CloudWatch log groups that resources have created implicitly (e.g.,
+	// /aws/lambda/<function name> of a Lambda function) after the resources have been destroyed.
+	DeleteLogGroups bool
+	// LogRetentionDays sets the retention of the log groups that resources have created implicitly to the given
+	// number of days (see ValidLogRetentionDays), instead of deleting them. Zero disables it.
+	LogRetentionDays int
+	// BeanstalkTimeout is the amount of time to wait for an Elastic Beanstalk environment to terminate.
+	// Defaults to DefaultBeanstalkTimeout if zero.
+	BeanstalkTimeout time.Duration
+	// DefaultDeleteTimeout is the delete timeout of resources whose state doesn't customize it
+	// (see Resource.DeleteTimeout). If non-zero, it overrides the type-specific timeouts and the provider's default.
+	DefaultDeleteTimeout time.Duration
+	// BatchDeletes deletes resources of some types (e.g., Route53 record sets or S3 objects) in batches
+	// directly via the AWS API, instead of one by one via the provider (see batchDestroys).
+	BatchDeletes bool
+	// ExplainBlockers looks up the resources outside the state that block the deletion of resources that failed
+	// due to a dependency violation (e.g., the network interfaces in a subnet) and adds them to the errors
+	// (see BlockedError).
+	ExplainBlockers bool
+	// OwnerTag is the name of the tag (or attribute) whose value is the owner of a resource (e.g., "owner"),
+	// which is added to the events and the preview of resources (see Resource.Owner). Empty disables owners.
+	OwnerTag string
+	// LogSensitive shows sensitive values (i.e., marked values and values of attributes that are sensitive according
+	// to the provider's schema) in logs and reports, which are redacted otherwise.
+	LogSensitive bool
+	// S3BypassGovernanceRetention deletes the object versions of S3 buckets whose object lock retention is
+	// in governance mode with the bypass header if the bucket can't be destroyed otherwise, instead of failing
+	// with a ManualActionError (requires the s3:BypassGovernanceRetention permission).
+	S3BypassGovernanceRetention bool
+	// NoForce are the addresses of resources (can contain wildcards, see MatchAddresses) whose force destroy
+	// attributes are left as they are in the state (see Resource.ForceDestroyDisabled).
+	NoForce []string
+	// NoRefresh destroys resources with the attributes recorded in the state, without reading (or importing)
+	// them first (see Resource.UpdateState). Resources that don't exist anymore are then destroyed nevertheless,
+	// which succeeds (see ErrorClassAlreadyGone).
+	NoRefresh bool
+	// Overrides are attributes of resources set in the state right before the resources are destroyed, in addition
+	// to the built-in ones (see Resource.Overrides). Overrides of attributes enforced by the API (e.g.,
+	// enable_deletion_protection of a load balancer) are applied by an update of the resource first.
+	Overrides []AttributeOverride
+	// AWSSession is used for calls to the AWS API that terradozer makes directly (i.e., not via the provider).
+	AWSSession *session.Session
+}
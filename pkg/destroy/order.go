@@ -0,0 +1,258 @@
+package destroy
+
+import (
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// orderByDependencies splits a given list of resources into consecutive groups, such that every resource
+// is in a group before all groups of the resources it depends on. The resources of one group can be
+// destroyed in parallel.
+//
+// Dependencies are taken from the state (see Dependencies()) plus the implicit dependencies between resource types
+// that the state doesn't capture. If the resources can't be ordered (e.g., due to a dependency cycle),
+// all remaining resources are put into the last group.
+func orderByDependencies(resources []DestroyableResource) [][]DestroyableResource {
+	dependencies, numOfDependents := dependencyGraph(resources)
+
+	var result [][]DestroyableResource
+
+	ordered := make([]bool, len(resources))
+	numOfOrdered := 0
+
+	for numOfOrdered < len(resources) {
+		var group []int
+
+		for i := range resources {
+			if !ordered[i] && numOfDependents[i] == 0 {
+				group = append(group, i)
+			}
+		}
+
+		if len(group) == 0 {
+			log.Debug(internal.Pad("failed to order resources by dependencies (cycle?)"))
+
+			for i := range resources {
+				if !ordered[i] {
+					group = append(group, i)
+				}
+			}
+		}
+
+		var groupResources []DestroyableResource
+
+		for _, i := range group {
+			ordered[i] = true
+			numOfOrdered++
+
+			for _, j := range dependencies[i] {
+				numOfDependents[j]--
+			}
+
+			groupResources = append(groupResources, resources[i])
+		}
+
+		result = append(result, groupResources)
+	}
+
+	return result
+}
+
+// dependencyGraph returns the indices of the resources that each of the given resources depends on,
+// and the number of resources that depend on each resource (see orderByDependencies()).
+func dependencyGraph(resources []DestroyableResource) ([][]int, []int) {
+	// number of (not yet destroyed) resources that depend on a resource
+	numOfDependents := make([]int, len(resources))
+
+	// indices of the resources that a resource depends on
+	dependencies := make([][]int, len(resources))
+
+	for _, e := range dependencyEdges(resources) {
+		dependencies[e.from] = append(dependencies[e.from], e.to)
+		numOfDependents[e.to]++
+	}
+
+	return dependencies, numOfDependents
+}
+
+// dependencyEdge is a dependency of the resource with index from on the one with index to (see dependencyEdges).
+type dependencyEdge struct {
+	from, to int
+	// implicit is true if the dependency is between the types of the resources (see implicitDependencies)
+	// rather than recorded in the state.
+	implicit bool
+}
+
+// dependencyEdges returns the dependencies between the given resources, each at most once, in the order
+// of the resources that depend on others.
+func dependencyEdges(resources []DestroyableResource) []dependencyEdge {
+	var edges []dependencyEdge
+
+	indicesByAddress := map[string][]int{}
+	indicesByType := map[string][]int{}
+
+	for i, r := range resources {
+		if r.Address() != "" {
+			indicesByAddress[r.Address()] = append(indicesByAddress[r.Address()], i)
+		}
+
+		indicesByType[r.Type()] = append(indicesByType[r.Type()], i)
+	}
+
+	for i, r := range resources {
+		seen := map[int]bool{i: true}
+
+		addDependency := func(j int, implicit bool) {
+			if seen[j] {
+				return
+			}
+
+			seen[j] = true
+			edges = append(edges, dependencyEdge{from: i, to: j, implicit: implicit})
+		}
+
+		for _, depAddr := range r.Dependencies() {
+			for _, j := range indicesByAddress[depAddr] {
+				addDependency(j, false)
+			}
+		}
+
+		for _, depType := range implicitDependencies[r.Type()] {
+			for _, j := range indicesByType[depType] {
+				addDependency(j, true)
+			}
+		}
+	}
+
+	return edges
+}
+
+// OrderedResource is a resource of a plan in the order in which it would be destroyed (see DestroyPlan.Order).
+type OrderedResource struct {
+	Address string
+	Type    string
+	ID      string
+	// Group is the number of the group of resources (starting at 1) that are destroyed in parallel;
+	// a group is only destroyed after all groups before it.
+	Group int
+	// MonthlyCost is the estimated monthly cost of the resource (see Resource.MonthlyCost), if Priced.
+	MonthlyCost float64
+	Priced      bool
+}
+
+// Order returns the resources of the plan in the order in which Execute would destroy them
+// (without the retries of failed resources).
+func (plan *DestroyPlan) Order() []OrderedResource {
+	var ordered []OrderedResource
+
+	group := 0
+
+	for _, resources := range plan.groups() {
+		for _, dependencyGroup := range orderByDependencies(resources) {
+			group++
+
+			for _, r := range dependencyGroup {
+				cost, priced := MonthlyCostOf(r)
+
+				ordered = append(ordered, OrderedResource{
+					Address:     r.Address(),
+					Type:        r.Type(),
+					ID:          r.ID(),
+					Group:       group,
+					MonthlyCost: cost,
+					Priced:      priced,
+				})
+			}
+		}
+	}
+
+	return ordered
+}
+
+// groups returns the resources of the plan in the order in which they are passed to run, one list per
+// top-level module instance if ordered by module (otherwise, a single list).
+func (plan *DestroyPlan) groups() [][]DestroyableResource {
+	resources := plan.resources()
+
+	if !plan.config.OrderByModule {
+		return [][]DestroyableResource{resources}
+	}
+
+	var groups [][]DestroyableResource
+
+	for _, g := range orderByModule(resources) {
+		groups = append(groups, g.resources)
+	}
+
+	return groups
+}
+
+// addressKey orders resources by address, then by type and ID (e.g., for resources without address), so that
+// runs over the same state process and report resources in the same order, regardless of the order in which
+// they are listed or in which parallel workers complete.
+type addressKey struct {
+	address, terraformType, id string
+}
+
+func keyOf(r DestroyableResource) addressKey {
+	return addressKey{address: r.Address(), terraformType: r.Type(), id: r.ID()}
+}
+
+func (k addressKey) less(other addressKey) bool {
+	if k.address != other.address {
+		return k.address < other.address
+	}
+
+	if k.terraformType != other.terraformType {
+		return k.terraformType < other.terraformType
+	}
+
+	return k.id < other.id
+}
+
+// sortByAddress sorts the given resources by address (see addressKey).
+func sortByAddress(resources []*Resource) {
+	sort.SliceStable(resources, func(i, j int) bool {
+		return keyOf(resources[i]).less(keyOf(resources[j]))
+	})
+}
+
+// sortDestroyableByAddress sorts the given resources by address (see addressKey).
+func sortDestroyableByAddress(resources []DestroyableResource) {
+	sort.SliceStable(resources, func(i, j int) bool {
+		return keyOf(resources[i]).less(keyOf(resources[j]))
+	})
+}
+
+// sortErrorsByAddress sorts the given errors by the addresses of their resources (see addressKey).
+func sortErrorsByAddress(errs []RetryDestroyError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		return keyOf(errs[i].Resource).less(keyOf(errs[j].Resource))
+	})
+}
+
+// sortEventsByAddress sorts the given events by the addresses of their resources (see addressKey).
+func sortEventsByAddress(events []ResourceEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return addressKey{events[i].Address, events[i].Type, events[i].ID}.
+			less(addressKey{events[j].Address, events[j].Type, events[j].ID})
+	})
+}
+
+// sortByAddress sorts the resources of the plan by address (see addressKey), as the order in which their states
+// have been updated depends on the scheduling of the parallel workers.
+func (plan *DestroyPlan) sortByAddress() {
+	sort.SliceStable(plan.Candidates, func(i, j int) bool {
+		return keyOf(plan.Candidates[i].Resource).less(keyOf(plan.Candidates[j].Resource))
+	})
+
+	sort.SliceStable(plan.Skipped, func(i, j int) bool {
+		return keyOf(plan.Skipped[i].Resource).less(keyOf(plan.Skipped[j].Resource))
+	})
+
+	sortEventsByAddress(plan.Gone)
+	sortEventsByAddress(plan.AlreadyGone)
+	sortErrorsByAddress(plan.Unsupported)
+}
@@ -0,0 +1,310 @@
+package destroy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// AttributeOverride sets attributes of the resources of a type in the state right before they are destroyed
+// (see Options.Overrides).
+type AttributeOverride struct {
+	Type string
+	// Attrs are the values by attribute name as given by the user (e.g., "false"), which are converted to the types
+	// of the attributes (values of lists, sets, maps, and objects are JSON); "null" is a null value.
+	Attrs map[string]string
+}
+
+// ParseAttributeOverride parses an override of attributes of the form type:name=value[,name=value...]
+// (e.g., aws_db_instance:deletion_protection=false,skip_final_snapshot=true). A comma that isn't followed by
+// name= is part of the value (e.g., of a JSON list).
+func ParseAttributeOverride(s string) (AttributeOverride, error) {
+	invalid := fmt.Errorf("invalid override (expected type:name=value[,name=value...]): %s", s)
+
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || !hclsyntax.ValidIdentifier(parts[0]) {
+		return AttributeOverride{}, invalid
+	}
+
+	result := AttributeOverride{Type: parts[0], Attrs: map[string]string{}}
+
+	var name string
+
+	for _, attr := range strings.Split(parts[1], ",") {
+		nameAndValue := strings.SplitN(attr, "=", 2)
+		if len(nameAndValue) != 2 || !hclsyntax.ValidIdentifier(nameAndValue[0]) {
+			if name == "" {
+				return AttributeOverride{}, invalid
+			}
+
+			result.Attrs[name] += "," + attr
+
+			continue
+		}
+
+		name = nameAndValue[0]
+		result.Attrs[name] = nameAndValue[1]
+	}
+
+	return result, nil
+}
+
+// String returns the override in the form parsed by ParseAttributeOverride (with attributes sorted by name).
+func (o AttributeOverride) String() string {
+	var attrs []string
+
+	for name, value := range o.Attrs {
+		attrs = append(attrs, name+"="+value)
+	}
+
+	sort.Strings(attrs)
+
+	return o.Type + ":" + strings.Join(attrs, ",")
+}
+
+// Overrides returns the attributes whose values in the state are overridden right before the resource is destroyed,
+// so that it can be deleted (e.g., force_destroy=true of a non-empty S3 bucket or skip_final_snapshot=true of an
+// RDS instance), as name=value pairs sorted by name. Attributes that already have the value are left out.
+func (r Resource) Overrides() []string {
+	if r.State() == nil {
+		return nil
+	}
+
+	return overrides(*r.State(), r.destroyState(*r.State()))
+}
+
+// destroyState returns the given state of the resource with the attributes overridden that are needed
+// to destroy it: the ones of destroyAttrs, the ones of Options.Overrides, and the force destroy attributes
+// (unless disabled, see ForceDestroyDisabled).
+func (r Resource) destroyState(state cty.Value) cty.Value {
+	if attrs, ok := destroyAttrs[r.Type()]; ok {
+		state = withAttrs(state, attrs(r))
+	}
+
+	state = withAttrs(state, r.userOverrideAttrs(state))
+
+	if r.ForceDestroyDisabled() {
+		return state
+	}
+
+	return enableForceDestroyAttributes(state)
+}
+
+// userOverrideAttrs returns the attributes of the given state overridden by Options.Overrides, converted to
+// the types of the attributes. Attributes that the state doesn't have, or whose values can't be converted,
+// are left out.
+func (r Resource) userOverrideAttrs(state cty.Value) map[string]cty.Value {
+	if state.IsNull() || !state.Type().IsObjectType() {
+		return nil
+	}
+
+	result := map[string]cty.Value{}
+
+	for _, o := range r.Options.Overrides {
+		if o.Type != r.Type() {
+			continue
+		}
+
+		for name, value := range o.Attrs {
+			v, err := overrideAttr(state.Type(), name, value)
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).
+					Debug(internal.Pad("cannot override attribute"))
+
+				continue
+			}
+
+			result[name] = v
+		}
+	}
+
+	return result
+}
+
+// enforcedOverrideAttrs returns the attributes overridden by Options.Overrides that are enforced by the API
+// (see enforcedAttrs) and differ from the state of the resource, or nil if there are none.
+func (r Resource) enforcedOverrideAttrs() map[string]cty.Value {
+	if r.State() == nil {
+		return nil
+	}
+
+	var result map[string]cty.Value
+
+	for name, v := range r.userOverrideAttrs(*r.State()) {
+		if !enforcedAttrs[name] || r.State().GetAttr(name).RawEquals(v) {
+			continue
+		}
+
+		if result == nil {
+			result = map[string]cty.Value{}
+		}
+
+		result[name] = v
+	}
+
+	return result
+}
+
+// overrideHandler returns the handler that applies the overrides of Options.Overrides enforced by the API
+// by an update before the resource is destroyed (see enforcedOverrideAttrs), if there are overrides of its type.
+func (r Resource) overrideHandler() (TypeHandler, bool) {
+	for _, o := range r.Options.Overrides {
+		if o.Type == r.Type() {
+			return UpdateSteps{
+				Step: "override attributes",
+				Steps: []UpdateStep{{
+					Name:    "update overridden attributes enforced by the API",
+					Attrs:   Resource.enforcedOverrideAttrs,
+					Retries: 2,
+				}},
+			}, true
+		}
+	}
+
+	return nil, false
+}
+
+// overrideAttr returns the given value of the attribute of an override (see AttributeOverride.Attrs) converted
+// to the type of the attribute in an object of the given type.
+func overrideAttr(objType cty.Type, name, value string) (cty.Value, error) {
+	if !objType.HasAttribute(name) {
+		return cty.NilVal, fmt.Errorf("resource has no attribute %s", name)
+	}
+
+	attrType := objType.AttributeType(name)
+
+	if value == "null" {
+		return cty.NullVal(attrType), nil
+	}
+
+	if !attrType.IsPrimitiveType() {
+		v, err := ctyjson.Unmarshal([]byte(value), attrType)
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("invalid value of attribute %s (expected JSON): %s", name, err)
+		}
+
+		return v, nil
+	}
+
+	v, err := convert.Convert(cty.StringVal(value), attrType)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("invalid value of attribute %s: %s", name, err)
+	}
+
+	return v, nil
+}
+
+// HasForceDestroy returns true if the state of the resource has force destroy attributes (e.g., force_destroy
+// of an S3 bucket or force_detach_policies of an IAM role), which are set to true right before the resource
+// is destroyed (unless disabled, see ForceDestroyDisabled).
+func (r Resource) HasForceDestroy() bool {
+	if r.State() == nil || r.State().IsNull() || !r.State().Type().IsObjectType() {
+		return false
+	}
+
+	for _, name := range []string{"force_destroy", "force_detach_policies"} {
+		if r.State().Type().HasAttribute(name) && r.State().Type().AttributeType(name).Equals(cty.Bool) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ForceDestroyDisabled returns true if the resource has force destroy attributes (see HasForceDestroy), which are
+// left as they are in the state, since its address matches one of Options.NoForce. Destroying a resource
+// that can only be deleted by force (e.g., a non-empty S3 bucket) then fails.
+func (r Resource) ForceDestroyDisabled() bool {
+	return r.HasForceDestroy() && MatchAddresses(r.Options.NoForce, r.Address())
+}
+
+// ForceDestroyDisabledOf returns true if the force destroy attributes of a resource are disabled
+// (see Resource.ForceDestroyDisabled).
+func ForceDestroyDisabledOf(r DestroyableResource) bool {
+	if f, ok := r.(interface{ ForceDestroyDisabled() bool }); ok {
+		return f.ForceDestroyDisabled()
+	}
+
+	return false
+}
+
+// MatchAddresses returns true if the given address of a resource matches one of the given patterns, which are
+// addresses that can contain wildcards: * matches any sequence of characters (including dots) and ? a single one
+// (e.g., module.logs.aws_s3_bucket.* matches all buckets of the module).
+func MatchAddresses(patterns []string, address string) bool {
+	for _, pattern := range patterns {
+		if addressPattern(pattern).MatchString(address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addressPattern returns the regular expression matching the addresses of the given pattern (see MatchAddresses).
+func addressPattern(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+// overrides returns the attributes of the given state to destroy a resource with whose values differ
+// from the ones of the given current state (see Resource.Overrides).
+func overrides(state, destroyState cty.Value) []string {
+	if state.IsNull() || destroyState.IsNull() || !destroyState.Type().IsObjectType() {
+		return nil
+	}
+
+	var result []string
+
+	for name := range destroyState.Type().AttributeTypes() {
+		v := destroyState.GetAttr(name)
+
+		if state.Type().IsObjectType() && state.Type().HasAttribute(name) && state.GetAttr(name).RawEquals(v) {
+			continue
+		}
+
+		result = append(result, name+"="+overrideValue(v))
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// overrideValue returns the given value of an overridden attribute as shown in logs.
+func overrideValue(v cty.Value) string {
+	switch {
+	case v.IsNull():
+		return "null"
+	case !v.IsKnown():
+		return "(unknown)"
+	case v.Type() == cty.String:
+		return internal.RenderValue(v.AsString())
+	case v.Type() == cty.Bool:
+		if v.True() {
+			return "true"
+		}
+
+		return "false"
+	case v.Type() == cty.Number:
+		return v.AsBigFloat().Text('f', -1)
+	default:
+		result, err := ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return v.Type().FriendlyName()
+		}
+
+		return internal.RenderValue(string(result))
+	}
+}
@@ -0,0 +1,437 @@
+package destroy_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestResource_Overrides(t *testing.T) {
+	timestamp := regexp.MustCompile(`\d{14}$`)
+
+	dbInstance := func(deletionProtection bool, snapshotID cty.Value) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"id":                        cty.StringVal("db-1"),
+			"identifier":                cty.StringVal("test"),
+			"deletion_protection":       cty.BoolVal(deletionProtection),
+			"skip_final_snapshot":       cty.False,
+			"final_snapshot_identifier": snapshotID,
+		})
+	}
+
+	cluster := func(snapshotID cty.Value) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"id":                        cty.StringVal("cluster-1"),
+			"cluster_identifier":        cty.StringVal("test"),
+			"skip_final_snapshot":       cty.False,
+			"final_snapshot_identifier": snapshotID,
+		})
+	}
+
+	tests := []struct {
+		name              string
+		rType             string
+		state             *cty.Value
+		options           destroy.Options
+		expectedOverrides []string
+	}{
+		{
+			name:  "force destroy",
+			rType: "aws_s3_bucket",
+			state: ptr(cty.ObjectVal(map[string]cty.Value{
+				"id":            cty.StringVal("bucket"),
+				"force_destroy": cty.False,
+			})),
+			expectedOverrides: []string{"force_destroy=true"},
+		},
+		{
+			name:  "force destroy disabled",
+			rType: "aws_s3_bucket",
+			state: ptr(cty.ObjectVal(map[string]cty.Value{
+				"id":            cty.StringVal("bucket"),
+				"force_destroy": cty.False,
+			})),
+			options: destroy.Options{NoForce: []string{"te?t"}},
+		},
+		{
+			name:  "force destroy already set",
+			rType: "aws_s3_bucket",
+			state: ptr(cty.ObjectVal(map[string]cty.Value{
+				"id":            cty.StringVal("bucket"),
+				"force_destroy": cty.True,
+			})),
+		},
+		{
+			name:  "skip final snapshot",
+			rType: "aws_db_instance",
+			state: ptr(dbInstance(true, cty.StringVal("final"))),
+			expectedOverrides: []string{
+				"deletion_protection=false", "final_snapshot_identifier=null", "skip_final_snapshot=true"},
+		},
+		{
+			name:              "take final snapshot",
+			rType:             "aws_db_instance",
+			state:             ptr(dbInstance(false, cty.NullVal(cty.String))),
+			options:           destroy.Options{RDSTakeFinalSnapshot: true},
+			expectedOverrides: []string{"final_snapshot_identifier=terradozer-test-<timestamp>"},
+		},
+		{
+			name:              "skip final snapshot of DocumentDB cluster",
+			rType:             "aws_docdb_cluster",
+			state:             ptr(cluster(cty.StringVal("final"))),
+			expectedOverrides: []string{"final_snapshot_identifier=null", "skip_final_snapshot=true"},
+		},
+		{
+			name:              "take final snapshot of DocumentDB cluster",
+			rType:             "aws_docdb_cluster",
+			state:             ptr(cluster(cty.NullVal(cty.String))),
+			options:           destroy.Options{RDSTakeFinalSnapshot: true},
+			expectedOverrides: []string{"final_snapshot_identifier=terradozer-test-<timestamp>"},
+		},
+		{
+			name:              "take final snapshot of Neptune cluster",
+			rType:             "aws_neptune_cluster",
+			state:             ptr(cluster(cty.NullVal(cty.String))),
+			options:           destroy.Options{RDSTakeFinalSnapshot: true},
+			expectedOverrides: []string{"final_snapshot_identifier=terradozer-test-<timestamp>"},
+		},
+		{
+			name:              "take final snapshot of Redshift cluster",
+			rType:             "aws_redshift_cluster",
+			state:             ptr(cluster(cty.NullVal(cty.String))),
+			options:           destroy.Options{RDSTakeFinalSnapshot: true},
+			expectedOverrides: []string{"final_snapshot_identifier=terradozer-test-<timestamp>"},
+		},
+		{
+			name:  "number",
+			rType: "aws_kms_key",
+			state: ptr(cty.ObjectVal(map[string]cty.Value{
+				"id":                      cty.StringVal("key"),
+				"deletion_window_in_days": cty.NumberIntVal(30),
+			})),
+			options:           destroy.Options{KMSDeletionWindow: 7},
+			expectedOverrides: []string{"deletion_window_in_days=7"},
+		},
+		{
+			name:  "user overrides",
+			rType: "aws_elasticsearch_domain",
+			state: ptr(cty.ObjectVal(map[string]cty.Value{
+				"id":             cty.StringVal("domain"),
+				"enabled":        cty.True,
+				"retention_days": cty.NumberIntVal(30),
+				"tags":           cty.MapVal(map[string]cty.Value{"team": cty.StringVal("a")}),
+				"description":    cty.StringVal("test"),
+			})),
+			options: destroy.Options{Overrides: []destroy.AttributeOverride{
+				{Type: "aws_elasticsearch_domain", Attrs: map[string]string{
+					"enabled":        "false",
+					"retention_days": "1",
+					"tags":           `{"team":"b"}`,
+					"description":    "null",
+					"missing":        "true",
+				}},
+				{Type: "aws_s3_bucket", Attrs: map[string]string{"enabled": "true"}},
+			}},
+			expectedOverrides: []string{"description=null", "enabled=false", "retention_days=1", `tags={"team":"b"}`},
+		},
+		{
+			name:  "user override with invalid value",
+			rType: "aws_elasticsearch_domain",
+			state: ptr(cty.ObjectVal(map[string]cty.Value{
+				"id":      cty.StringVal("domain"),
+				"enabled": cty.True,
+			})),
+			options: destroy.Options{Overrides: []destroy.AttributeOverride{
+				{Type: "aws_elasticsearch_domain", Attrs: map[string]string{"enabled": "maybe"}},
+			}},
+		},
+		{
+			name:  "user override of built-in override",
+			rType: "aws_db_instance",
+			state: ptr(dbInstance(false, cty.NullVal(cty.String))),
+			options: destroy.Options{Overrides: []destroy.AttributeOverride{
+				{Type: "aws_db_instance", Attrs: map[string]string{"skip_final_snapshot": "false"}},
+			}},
+		},
+		{
+			name:  "attribute not in state",
+			rType: "aws_db_instance",
+			state: ptr(cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("db-1")})),
+		},
+		{
+			name:  "no state",
+			rType: "aws_s3_bucket",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := destroy.NewWithState("test", tc.rType, "id", nil, nil, tc.state)
+			r.Options = tc.options
+
+			actualOverrides := r.Overrides()
+
+			// the name of a final snapshot ends with a timestamp
+			for i, o := range actualOverrides {
+				actualOverrides[i] = timestamp.ReplaceAllString(o, "<timestamp>")
+			}
+
+			assert.Equal(t, tc.expectedOverrides, actualOverrides)
+		})
+	}
+}
+
+func TestResource_Preview_Overrides(t *testing.T) {
+	state := cty.ObjectVal(map[string]cty.Value{
+		"id":                    cty.StringVal("role"),
+		"force_detach_policies": cty.False,
+	})
+
+	r := destroy.NewWithState("aws_iam_role.test", "aws_iam_role", "role", nil, nil, &state)
+
+	preview := r.Preview(context.Background())
+	assert.Equal(t, "force_detach_policies=true", preview["will_set"])
+	assert.Equal(t, "applied", preview["force_destroy"])
+
+	r.Options.NoForce = []string{"aws_iam_role.*"}
+
+	preview = r.Preview(context.Background())
+	assert.NotContains(t, preview, "will_set")
+	assert.Equal(t, "disabled by flag", preview["force_destroy"])
+}
+
+func TestResource_Destroy_DeletionProtection(t *testing.T) {
+	loadBalancer := func(deletionProtection bool) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"id":                         cty.StringVal("lb-1"),
+			"enable_deletion_protection": cty.BoolVal(deletionProtection),
+			"idle_timeout":               cty.NumberIntVal(60),
+		})
+	}
+
+	tests := []struct {
+		name                string
+		rType               string
+		state               cty.Value
+		overrides           []destroy.AttributeOverride
+		expectedDescription string
+		expectedUpdates     []cty.Value
+	}{
+		{
+			name:                "built-in",
+			rType:               "aws_lb",
+			state:               loadBalancer(true),
+			expectedDescription: "set enable_deletion_protection=false, delete",
+			expectedUpdates:     []cty.Value{loadBalancer(false)},
+		},
+		{
+			name:  "built-in not needed",
+			rType: "aws_lb",
+			state: loadBalancer(false),
+		},
+		{
+			name:  "user override enforced by the API",
+			rType: "aws_elb",
+			state: loadBalancer(true),
+			overrides: []destroy.AttributeOverride{
+				{Type: "aws_elb", Attrs: map[string]string{"enable_deletion_protection": "false", "idle_timeout": "1"}},
+			},
+			expectedDescription: "update overridden attributes enforced by the API, delete",
+			// only the attributes enforced by the API are updated, the others are overridden in the state only
+			expectedUpdates: []cty.Value{loadBalancer(false)},
+		},
+		{
+			name:  "user override not enforced by the API",
+			rType: "aws_elb",
+			state: loadBalancer(false),
+			overrides: []destroy.AttributeOverride{
+				{Type: "aws_elb", Attrs: map[string]string{"idle_timeout": "1"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var updates []cty.Value
+
+			stub := provider.NewStub(provider.StubConfig{}, []string{tc.rType})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return updatingStub{Stub: stub, updates: &updates}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			r := destroy.NewWithState(tc.rType+".test", tc.rType, "lb-1", nil, tp, &tc.state)
+			r.Options.Overrides = tc.overrides
+
+			if tc.expectedDescription == "" {
+				assert.NotContains(t, r.Preview(context.Background()), "note")
+			} else {
+				assert.Equal(t, tc.expectedDescription, r.Preview(context.Background())["note"])
+			}
+
+			require.NoError(t, r.Destroy(context.Background()))
+
+			require.Len(t, updates, len(tc.expectedUpdates))
+
+			for i, u := range updates {
+				assert.True(t, tc.expectedUpdates[i].RawEquals(u), u.GoString())
+			}
+
+			assert.Equal(t, []string{tc.rType + ".lb-1"}, stub.Destroyed())
+		})
+	}
+}
+
+func TestMatchAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		address  string
+		expected bool
+	}{
+		{
+			name:     "exact address",
+			patterns: []string{"aws_s3_bucket.audit_logs"},
+			address:  "aws_s3_bucket.audit_logs",
+			expected: true,
+		},
+		{
+			name:     "other address",
+			patterns: []string{"aws_s3_bucket.audit_logs"},
+			address:  "aws_s3_bucket.audit_logs_replica",
+		},
+		{
+			name:     "wildcard across modules",
+			patterns: []string{"aws_s3_bucket.other", "*aws_s3_bucket.audit*"},
+			address:  "module.logs.aws_s3_bucket.audit[\"eu\"]",
+			expected: true,
+		},
+		{
+			name:     "brackets are no character classes",
+			patterns: []string{"aws_s3_bucket.audit[0]"},
+			address:  "aws_s3_bucket.audit0",
+		},
+		{
+			name:    "no patterns",
+			address: "aws_s3_bucket.audit_logs",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, destroy.MatchAddresses(tc.patterns, tc.address))
+		})
+	}
+}
+
+// nonEmptyBucket is a provider of an S3 bucket that can only be destroyed with force_destroy.
+type nonEmptyBucket struct {
+	*slowProvider
+}
+
+func (b *nonEmptyBucket) GetSchema() providers.GetSchemaResponse {
+	return providers.GetSchemaResponse{
+		Provider: providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{
+			"aws_s3_bucket": {Block: &configschema.Block{
+				Attributes: map[string]*configschema.Attribute{
+					"id":            {Type: cty.String, Computed: true},
+					"force_destroy": {Type: cty.Bool, Optional: true},
+				},
+			}},
+		},
+	}
+}
+
+func (b *nonEmptyBucket) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	if req.PriorState.GetAttr("force_destroy").True() {
+		return b.slowProvider.ApplyResourceChange(req)
+	}
+
+	var diags tfdiags.Diagnostics
+
+	return providers.ApplyResourceChangeResponse{
+		Diagnostics: diags.Append(tfdiags.Sourceless(tfdiags.Error, "error deleting S3 Bucket (bucket): "+
+			"BucketNotEmpty: The bucket you tried to delete is not empty", "")),
+	}
+}
+
+func TestResource_Destroy_NoForce(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         destroy.Options
+		expectedDeleted bool
+	}{
+		{
+			name:            "forced",
+			expectedDeleted: true,
+		},
+		{
+			name:    "force disabled",
+			options: destroy.Options{NoForce: []string{"aws_s3_bucket.audit_logs"}},
+		},
+		{
+			name:    "force disabled with delete timeout",
+			options: destroy.Options{NoForce: []string{"aws_s3_bucket.*"}, DefaultDeleteTimeout: time.Minute},
+		},
+		{
+			name:            "other address",
+			options:         destroy.Options{NoForce: []string{"aws_s3_bucket.other"}},
+			expectedDeleted: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &nonEmptyBucket{slowProvider: &slowProvider{}}
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return b, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := cty.ObjectVal(map[string]cty.Value{
+				"id":            cty.StringVal("bucket"),
+				"force_destroy": cty.False,
+			})
+
+			r := destroy.NewWithState("aws_s3_bucket.audit_logs", "aws_s3_bucket", "bucket", nil, tp, &state)
+			r.Options = tc.options
+
+			err = r.Destroy(context.Background())
+
+			if tc.expectedDeleted {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"aws_s3_bucket.bucket"}, b.deleted)
+
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "BucketNotEmpty")
+			assert.Empty(t, b.deleted)
+		})
+	}
+}
+
+func ptr(v cty.Value) *cty.Value {
+	return &v
+}
@@ -0,0 +1,65 @@
+package destroy
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Unowned is the owner of resources without an owner tag (see Options.OwnerTag).
+const Unowned = "unowned"
+
+// Owner returns the owner of a resource, which is read from its current state: the value of the tag given
+// by Options.OwnerTag (or, if the resource has no such tag, of the attribute with that name).
+// Returns Unowned if the resource has neither, and an empty string if owners are disabled.
+// A marked owner is redacted (see Resource.redact).
+func (r Resource) Owner() string {
+	name := r.Options.OwnerTag
+	if name == "" {
+		return ""
+	}
+
+	state := r.State()
+	if state == nil || state.IsNull() || !state.IsKnown() || !state.Type().IsObjectType() {
+		return Unowned
+	}
+
+	for _, tags := range []string{"tags", "tags_all"} {
+		if !state.Type().HasAttribute(tags) {
+			continue
+		}
+
+		v := state.GetAttr(tags)
+		if v.IsNull() || !v.IsKnown() || !(v.Type().IsMapType() || v.Type().IsObjectType()) {
+			continue
+		}
+
+		if owner, ok := stringValue(v.AsValueMap()[name]); ok {
+			return r.redact(cty.GetAttrPath(tags).Index(cty.StringVal(name)), owner)
+		}
+	}
+
+	if state.Type().HasAttribute(name) {
+		if owner, ok := stringValue(state.GetAttr(name)); ok {
+			return r.redact(cty.GetAttrPath(name), owner)
+		}
+	}
+
+	return Unowned
+}
+
+// stringValue returns the value of a known, non-empty string.
+func stringValue(v cty.Value) (string, bool) {
+	if v == cty.NilVal || v.IsNull() || !v.IsKnown() || v.Type() != cty.String || v.AsString() == "" {
+		return "", false
+	}
+
+	return v.AsString(), true
+}
+
+// OwnerOf returns the owner of a resource (see Resource.Owner), or an empty string if the resource has no owner.
+func OwnerOf(r DestroyableResource) string {
+	if o, ok := r.(interface{ Owner() string }); ok {
+		return o.Owner()
+	}
+
+	return ""
+}
@@ -0,0 +1,87 @@
+package destroy_test
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestResource_Owner(t *testing.T) {
+	tests := []struct {
+		name          string
+		ownerTag      string
+		state         *cty.Value
+		expectedOwner string
+	}{
+		{
+			name: "owners disabled",
+			state: ownerState(map[string]cty.Value{
+				"tags": cty.MapVal(map[string]cty.Value{"owner": cty.StringVal("team-a")}),
+			}),
+		},
+		{
+			name:     "tag",
+			ownerTag: "owner",
+			state: ownerState(map[string]cty.Value{
+				"tags": cty.MapVal(map[string]cty.Value{"owner": cty.StringVal("team-a")}),
+			}),
+			expectedOwner: "team-a",
+		},
+		{
+			name:     "tag inherited from the provider's default tags",
+			ownerTag: "owner",
+			state: ownerState(map[string]cty.Value{
+				"tags":     cty.NullVal(cty.Map(cty.String)),
+				"tags_all": cty.MapVal(map[string]cty.Value{"owner": cty.StringVal("team-b")}),
+			}),
+			expectedOwner: "team-b",
+		},
+		{
+			name:     "attribute",
+			ownerTag: "owner",
+			state: ownerState(map[string]cty.Value{
+				"owner": cty.StringVal("team-c"),
+			}),
+			expectedOwner: "team-c",
+		},
+		{
+			name:     "without tag",
+			ownerTag: "owner",
+			state: ownerState(map[string]cty.Value{
+				"tags": cty.MapVal(map[string]cty.Value{"Name": cty.StringVal("test")}),
+			}),
+			expectedOwner: destroy.Unowned,
+		},
+		{
+			name:     "empty tag",
+			ownerTag: "owner",
+			state: ownerState(map[string]cty.Value{
+				"tags": cty.MapVal(map[string]cty.Value{"owner": cty.StringVal("")}),
+			}),
+			expectedOwner: destroy.Unowned,
+		},
+		{
+			name:          "unknown state",
+			ownerTag:      "owner",
+			expectedOwner: destroy.Unowned,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-1", nil, nil, tc.state)
+			r.Options = destroy.Options{OwnerTag: tc.ownerTag}
+
+			assert.Equal(t, tc.expectedOwner, r.Owner())
+			assert.Equal(t, tc.expectedOwner, destroy.OwnerOf(r))
+		})
+	}
+}
+
+func ownerState(attrs map[string]cty.Value) *cty.Value {
+	attrs["id"] = cty.StringVal("vpc-1")
+	state := cty.ObjectVal(attrs)
+
+	return &state
+}
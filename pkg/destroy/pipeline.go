@@ -0,0 +1,371 @@
+package destroy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/trace"
+)
+
+// PlanAndExecute destroys the resources of the given state that match the filter, same as Plan followed by
+// Execute, but without waiting for the states of all resources to be updated before the first resource is
+// destroyed. This is meant for runs whose plan doesn't need to be confirmed by the user (e.g., forced ones);
+// the returned plan has no previews.
+//
+// Updating the states (import and read) and destroying resources are separate stages with their own workers
+// (config.Parallel each), so that slow deletions don't leave the provider idle: updated resources are queued
+// and destroyed as soon as all resources that depend on them have been destroyed, are gone, or have been skipped.
+// Resources that failed to be destroyed are retried by Run afterwards, as long as there has been progress
+// (at most config.MaxRetries times).
+// Resources that can be deleted in batches (see Options.BatchDeletes) are held back until the states of all
+// resources have been updated.
+//
+// Once the context is done, no further resources are destroyed and the result is marked as interrupted
+// (see Execute). With config.OrderByModule, config.OrderByCost, or checkpoints (see config.Checkpoint), this is
+// the same as Plan followed by Execute.
+func PlanAndExecute(ctx context.Context, state ResourceLister, filter Filter, config Config) (*DestroyPlan,
+	Result, error) {
+	if config.Parallel == 0 {
+		config.Parallel = defaultParallel
+	}
+
+	if config.OrderByModule || config.OrderByCost || config.Checkpoint != nil {
+		plan, err := Plan(ctx, state, filter, config)
+		if err != nil && ctx.Err() != nil {
+			return &DestroyPlan{config: config}, Result{Interrupted: true}, nil
+		}
+
+		if err != nil {
+			return nil, Result{}, err
+		}
+
+		return plan, Execute(ctx, plan), nil
+	}
+
+	ctx, finish := withGracePeriod(ctx, config.GracePeriod)
+	defer finish()
+
+	ctx = withMaxRetries(ctx, config.MaxRetries)
+
+	events := orNoop(config.Events)
+
+	resources, skipped, err := selectResources(state, filter, config)
+	if err != nil {
+		return nil, Result{}, err
+	}
+
+	plan := &DestroyPlan{config: config, Skipped: skipped}
+
+	resources, plan.Unsupported = checkTypes(resources)
+
+	for _, r := range resources {
+		r.Options = config.Options
+	}
+
+	concurrency := config.concurrency()
+	progress := &progressEvents{Events: events, concurrency: concurrency}
+
+	stop := progress.report(ctx)
+	defer stop()
+
+	p := newPipeline(resources)
+
+	deletedResources, failedResources, permanentlyFailedResources := p.run(ctx, plan, filter, concurrency,
+		&goneEvents{Events: progress, plan: plan})
+
+	numOfDeletedResources := len(deletedResources)
+
+	var remaining []DestroyableResource
+
+	if ctx.Err() != nil {
+		remaining = append(remainingOf(plan.resources(), deletedResources,
+			append(permanentlyFailedResources, failedResources...)), p.interrupted...)
+	}
+
+	// resources handled by upgraded providers are destroyed together with the ones to retry
+	var resourcesToRun []DestroyableResource
+
+	if ctx.Err() == nil {
+		upgraded, skipped := Select(upgradeProviders(ctx, plan, p.resources, config), filter)
+		plan.Skipped = append(plan.Skipped, skipped...)
+
+		for _, r := range upgraded {
+			plan.Candidates = append(plan.Candidates, newPlannedResource(r))
+			resourcesToRun = append(resourcesToRun, r)
+		}
+	}
+
+	if len(failedResources) > 0 && numOfDeletedResources > 0 && ctx.Err() == nil {
+		var resourcesToRetry []DestroyableResource
+
+		resourcesToRetry, failedResources = retryPass(ctx, failedResources)
+		resourcesToRun = append(resourcesToRun, resourcesToRetry...)
+	}
+
+	if len(resourcesToRun) > 0 && ctx.Err() == nil {
+		sortDestroyableByAddress(resourcesToRun)
+
+		retryResult := run(ctx, resourcesToRun, concurrency, progress)
+
+		numOfDeletedResources += retryResult.Deleted
+		failedResources = append(failedResources, retryResult.Failed...)
+		remaining = append(remaining, retryResult.Remaining...)
+	}
+
+	result := Result{
+		Deleted:     numOfDeletedResources,
+		Failed:      append(permanentlyFailedResources, failedResources...),
+		AlreadyGone: len(plan.AlreadyGone),
+		Throttling:  throttlingOf(concurrency),
+		Remaining:   remaining,
+	}
+
+	if ctx.Err() != nil {
+		result.Interrupted = true
+	}
+
+	// resources are planned and destroyed in the order in which the workers complete
+	plan.sortByAddress()
+	sortErrorsByAddress(result.Failed)
+	sortDestroyableByAddress(result.Remaining)
+
+	explainBlockers(ctx, result.Failed, resourcesOf(p.resources))
+
+	events.RunCompleted(result)
+
+	return plan, result, nil
+}
+
+// pipeline schedules the resources to destroy in the order of their dependencies (see orderByDependencies()),
+// while their states are still being updated.
+type pipeline struct {
+	resources []*Resource
+	// indices of the resources by resource
+	indices map[DestroyableResource]int
+	// dependencies are the indices of the resources that a resource depends on.
+	dependencies [][]int
+	// numOfDependents is the number of not yet resolved resources that depend on a resource.
+	numOfDependents []int
+	// updated is true for resources whose state has been updated, but that haven't been queued to be destroyed.
+	updated []bool
+	// ready are the resources that can be destroyed next.
+	ready []DestroyableResource
+	// batchable are the resources that can be destroyed next, but are held back to be deleted in batches
+	// once the states of all resources have been updated (see destroyBatches()).
+	batchable []DestroyableResource
+	// numOfResolved is the number of resources that have been destroyed, failed, skipped, or are gone.
+	numOfResolved int
+	// known are the resources and the recorded sub-resources of the run (see Resource.recordSubResources).
+	known subResourceSet
+	// interrupted are the resources whose state hasn't been updated, as the context was done.
+	interrupted []DestroyableResource
+}
+
+func newPipeline(resources []*Resource) *pipeline {
+	var destroyable []DestroyableResource
+
+	indices := map[DestroyableResource]int{}
+
+	for i, r := range resources {
+		destroyable = append(destroyable, r)
+		indices[r] = i
+	}
+
+	dependencies, numOfDependents := dependencyGraph(destroyable)
+
+	return &pipeline{
+		resources:       resources,
+		indices:         indices,
+		dependencies:    dependencies,
+		numOfDependents: numOfDependents,
+		updated:         make([]bool, len(resources)),
+		known:           newSubResourceSet(resources),
+	}
+}
+
+// run updates the states of the resources and destroys them. Updated resources that match the filter are added
+// to the plan. Returns the destroyed resources and the errors of the resources that failed
+// to be destroyed, split into the ones worth retrying and the other ones.
+func (p *pipeline) run(ctx context.Context, plan *DestroyPlan, filter Filter, concurrency *Concurrency,
+	events Events) ([]DestroyableResource, []RetryDestroyError, []RetryDestroyError) {
+	parallel := plan.config.Parallel
+	numOfResources := len(p.resources)
+
+	updateQueue := make(chan *Resource, numOfResources)
+	updateResults := make(chan updateWorkerResult, numOfResources)
+
+	for i := 1; i <= parallel; i++ {
+		go updateWorker(trace.WithWorker(ctx, "update worker", i), updateQueue, updateResults)
+	}
+
+	for _, r := range p.resources {
+		updateQueue <- r
+	}
+
+	close(updateQueue)
+
+	// the queue of resources ready to be destroyed is bounded, so that resources are only dequeued
+	// once their dependents have been destroyed
+	destroyQueue := make(chan DestroyableResource, concurrency.Max())
+	destroyResults := make(chan workerResult, numOfResources)
+
+	for i := 1; i <= concurrency.Max(); i++ {
+		go workerDestroy(trace.WithWorker(ctx, "destroy worker", i), destroyQueue, destroyResults, concurrency, events)
+	}
+
+	defer close(destroyQueue)
+
+	// resources that have been rejected by a batch and need to be destroyed one by one
+	batchRemaining := make(chan []DestroyableResource, numOfResources)
+
+	var deletedResources []DestroyableResource
+
+	numOfUpdatesPending := numOfResources
+	numOfDestroysPending := 0
+
+	var retryableResourceErrors, otherResourceErrors []RetryDestroyError
+
+	for p.numOfResolved < numOfResources {
+		if len(p.batchable) > 0 && numOfUpdatesPending == 0 {
+			batch := p.batchable
+			p.batchable = nil
+			numOfDestroysPending += len(batch)
+
+			go func() {
+				results, remaining := destroyBatches(ctx, batch, parallel, events)
+
+				for _, result := range results {
+					destroyResults <- result
+				}
+
+				batchRemaining <- remaining
+			}()
+		}
+
+		if len(p.ready) == 0 && numOfUpdatesPending == 0 && numOfDestroysPending == 0 {
+			p.releaseAll()
+		}
+
+		var queue chan DestroyableResource
+
+		var next DestroyableResource
+
+		if len(p.ready) > 0 {
+			queue, next = destroyQueue, p.ready[0]
+		}
+
+		select {
+		case queue <- next:
+			p.ready = p.ready[1:]
+			numOfDestroysPending++
+
+		case result := <-updateResults:
+			numOfUpdatesPending--
+
+			i := p.indices[result.resource]
+
+			if p.handleUpdate(ctx, plan, filter, events, result) {
+				p.updated[i] = true
+				p.releaseIfReady(i)
+
+				continue
+			}
+
+			p.resolve(i)
+
+		case result := <-destroyResults:
+			numOfDestroysPending--
+
+			switch {
+			case result.resourceHasBeenDeleted:
+				deletedResources = append(deletedResources, result.resource)
+			case result.Err != nil && !result.Err.Class.Retryable():
+				otherResourceErrors = append(otherResourceErrors, *result.Err)
+			case result.Err != nil:
+				retryableResourceErrors = append(retryableResourceErrors, *result.Err)
+			}
+
+			p.resolve(p.indices[result.resource])
+
+		case remaining := <-batchRemaining:
+			numOfDestroysPending -= len(remaining)
+			p.ready = append(p.ready, remaining...)
+		}
+	}
+
+	return deletedResources, retryableResourceErrors, otherResourceErrors
+}
+
+// handleUpdate reports the result of updating the state of a resource and adds the resource to the plan
+// if it still exists and matches the filter. Returns true if the resource needs to be destroyed.
+func (p *pipeline) handleUpdate(ctx context.Context, plan *DestroyPlan, filter Filter, events Events,
+	result updateWorkerResult) bool {
+	if result.err != nil {
+		if ctx.Err() == nil {
+			events.ResourceImportFailed(newImportFailedEvent(result.resource, result.err))
+		} else if !errors.Is(result.err, ErrResourceGone) {
+			p.interrupted = append(p.interrupted, result.resource)
+		}
+
+		return false
+	}
+
+	result.resource.recordSubResources(p.known)
+	events.ResourceDiscovered(newResourceEvent(result.resource, nil))
+
+	// filters might also decide based on the current attributes of resources
+	selected, skipped := Select([]*Resource{result.resource}, filter)
+	plan.Skipped = append(plan.Skipped, skipped...)
+
+	if len(selected) == 0 {
+		return false
+	}
+
+	plan.Candidates = append(plan.Candidates, newPlannedResource(result.resource))
+
+	return true
+}
+
+// releaseIfReady marks the resource with the given index as ready to be destroyed if its state has been updated
+// and no resource that depends on it is left.
+func (p *pipeline) releaseIfReady(i int) {
+	if !p.updated[i] || p.numOfDependents[i] > 0 {
+		return
+	}
+
+	p.updated[i] = false
+
+	if p.resources[i].batchable() {
+		p.batchable = append(p.batchable, p.resources[i])
+
+		return
+	}
+
+	p.ready = append(p.ready, p.resources[i])
+}
+
+// releaseAll marks all updated resources as ready to be destroyed, which is needed if the remaining
+// resources can't be ordered by their dependencies (e.g., due to a dependency cycle).
+func (p *pipeline) releaseAll() {
+	log.Debug(internal.Pad("failed to order resources by dependencies (cycle?)"))
+
+	for i := range p.resources {
+		if p.updated[i] {
+			p.updated[i] = false
+			p.ready = append(p.ready, p.resources[i])
+		}
+	}
+}
+
+// resolve marks the resource with the given index as done, so that the resources it depends on
+// can be destroyed.
+func (p *pipeline) resolve(i int) {
+	p.numOfResolved++
+
+	for _, j := range p.dependencies[i] {
+		p.numOfDependents[j]--
+		p.releaseIfReady(j)
+	}
+}
@@ -0,0 +1,202 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// slowProvider is an in-memory provider, which takes the given amount of time to read and to destroy a resource.
+type slowProvider struct {
+	readLatency    time.Duration
+	destroyLatency time.Duration
+
+	mu      sync.Mutex
+	deleted []string
+}
+
+func (p *slowProvider) Configure(providers.ConfigureRequest) providers.ConfigureResponse {
+	return providers.ConfigureResponse{}
+}
+
+func (p *slowProvider) GetSchema() providers.GetSchemaResponse {
+	block := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id": {Type: cty.String, Computed: true},
+		},
+	}
+
+	return providers.GetSchemaResponse{
+		Provider: providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{
+			"aws_vpc":    {Block: block},
+			"aws_subnet": {Block: block},
+		},
+	}
+}
+
+func (p *slowProvider) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	time.Sleep(p.readLatency)
+
+	return providers.ReadResourceResponse{NewState: req.PriorState}
+}
+
+func (p *slowProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	time.Sleep(p.destroyLatency)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deleted = append(p.deleted, req.TypeName+"."+req.PriorState.GetAttr("id").AsString())
+
+	return providers.ApplyResourceChangeResponse{NewState: cty.NullVal(cty.DynamicPseudoType)}
+}
+
+func (p *slowProvider) ImportResourceState(providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	return providers.ImportResourceStateResponse{}
+}
+
+func (p *slowProvider) Stop() error {
+	return nil
+}
+
+func (p *slowProvider) Close() error {
+	return nil
+}
+
+// slowState returns a state with the given number of VPCs, each with a subnet that depends on it.
+func slowState(t testing.TB, p *slowProvider, numOfVPCs int) fakeState {
+	tp, err := provider.Init(context.Background(), "slow", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return p, nil
+		},
+	})
+	require.NoError(t, err)
+
+	var resources []*destroy.Resource
+
+	for i := 0; i < numOfVPCs; i++ {
+		vpcID, subnetID := fmt.Sprintf("vpc-%d", i), fmt.Sprintf("subnet-%d", i)
+		vpcAddress := fmt.Sprintf("aws_vpc.test[%d]", i)
+		vpcState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(vpcID)})
+		subnetState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(subnetID)})
+
+		resources = append(resources,
+			destroy.NewWithState(vpcAddress, "aws_vpc", vpcID, nil, tp, &vpcState),
+			destroy.NewWithState(fmt.Sprintf("aws_subnet.test[%d]", i), "aws_subnet", subnetID,
+				[]string{vpcAddress}, tp, &subnetState))
+	}
+
+	return fakeState{resources: resources}
+}
+
+func TestPlanAndExecute(t *testing.T) {
+	p := &slowProvider{}
+
+	plan, result, err := destroy.PlanAndExecute(context.Background(), slowState(t, p, 3),
+		destroy.ProtectedTypesFilter{"aws_vpc"}, destroy.Config{Parallel: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, destroy.Result{Deleted: 3}, result)
+	assert.Len(t, plan.Candidates, 3)
+	assert.Len(t, plan.Skipped, 3)
+	assert.ElementsMatch(t, []string{"aws_subnet.subnet-0", "aws_subnet.subnet-1", "aws_subnet.subnet-2"}, p.deleted)
+}
+
+func TestPlanAndExecute_Order(t *testing.T) {
+	p := &slowProvider{destroyLatency: 10 * time.Millisecond}
+
+	_, result, err := destroy.PlanAndExecute(context.Background(), slowState(t, p, 5), nil,
+		destroy.Config{Parallel: 4})
+	require.NoError(t, err)
+
+	assert.Equal(t, destroy.Result{Deleted: 10}, result)
+
+	position := map[string]int{}
+	for i, deleted := range p.deleted {
+		position[deleted] = i
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Less(t, position[fmt.Sprintf("aws_subnet.subnet-%d", i)], position[fmt.Sprintf("aws_vpc.vpc-%d", i)],
+			"subnet must be destroyed before the VPC it depends on")
+	}
+}
+
+func TestPlanAndExecute_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := &slowProvider{}
+
+	state := slowState(t, p, 2)
+
+	_, result, err := destroy.PlanAndExecute(ctx, state, nil, destroy.Config{})
+	require.NoError(t, err)
+
+	assert.True(t, result.Interrupted)
+	assert.Equal(t, 0, result.Deleted)
+	assert.ElementsMatch(t, state.resources, result.Remaining, "resources that haven't been updated must remain")
+	assert.Empty(t, p.deleted)
+}
+
+// TestPlanAndExecute_Overlap shows that updating the states and destroying resources overlap,
+// so that destroying resources takes less time than planning followed by executing the plan.
+func TestPlanAndExecute_Overlap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	const numOfVPCs = 10
+
+	latency := 50 * time.Millisecond
+	config := destroy.Config{Parallel: 5}
+
+	start := time.Now()
+
+	p := &slowProvider{readLatency: latency, destroyLatency: latency}
+
+	plan, err := destroy.Plan(context.Background(), slowState(t, p, numOfVPCs), nil, config)
+	require.NoError(t, err)
+
+	result := destroy.Execute(context.Background(), plan)
+	require.Equal(t, 2*numOfVPCs, result.Deleted)
+
+	sequential := time.Since(start)
+
+	start = time.Now()
+
+	p = &slowProvider{readLatency: latency, destroyLatency: latency}
+
+	_, result, err = destroy.PlanAndExecute(context.Background(), slowState(t, p, numOfVPCs), nil, config)
+	require.NoError(t, err)
+	require.Equal(t, 2*numOfVPCs, result.Deleted)
+
+	pipelined := time.Since(start)
+
+	t.Logf("plan and execute: %s, pipelined: %s", sequential, pipelined)
+
+	assert.Less(t, int64(pipelined), int64(sequential)*9/10)
+}
+
+func BenchmarkPlanAndExecute(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		p := &slowProvider{readLatency: 10 * time.Millisecond, destroyLatency: 10 * time.Millisecond}
+
+		_, _, err := destroy.PlanAndExecute(context.Background(), slowState(b, p, 10), nil,
+			destroy.Config{Parallel: 5})
+		require.NoError(b, err)
+	}
+}
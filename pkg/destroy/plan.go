@@ -0,0 +1,361 @@
+package destroy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ResourceLister lists the resources of a Terraform state that are managed by one of the given providers
+// (e.g., *state.State).
+type ResourceLister interface {
+	Resources(providers map[string]*provider.TerraformProvider) ([]*Resource, error)
+}
+
+// SelectingResourceLister is implemented by a ResourceLister that applies a filter already while listing
+// resources (with ResourceCandidate.Attrs being cty.NilVal), so that the attributes of resources skipped based on
+// their address, type, or ID are never decoded (e.g., *state.State).
+type SelectingResourceLister interface {
+	SelectResources(providers map[string]*provider.TerraformProvider, filter Filter) ([]*Resource,
+		[]SkippedResource, error)
+}
+
+// Config configures planning and executing the destroy of resources.
+type Config struct {
+	// Providers are the providers by name (e.g., "aws") to update the state of and to destroy resources.
+	// Resources of other providers are ignored.
+	Providers map[string]*provider.TerraformProvider
+	// Options configures how resources are destroyed.
+	Options Options
+	// Parallel limits the number of concurrent operations (defaults to 10 if zero).
+	Parallel int
+	// Concurrency adapts the number of concurrent destroy operations to throttling (defaults to a new one
+	// limited by Parallel if nil). Share it with the providers to record the throttles they retry
+	// (see provider.Config.Throttled).
+	Concurrency *Concurrency
+	// Events receives the progress (can be nil).
+	Events Events
+	// OrderByModule destroys the resources one top-level module instance after another (e.g., one preview
+	// environment after another), so that failures are contained in a module instance. Resources are then
+	// only destroyed after the states of all resources have been updated (see PlanAndExecute).
+	OrderByModule bool
+	// OrderByCost destroys the most expensive resources first (by their estimated monthly costs, see
+	// Resource.MonthlyCost), as far as dependencies allow; resources without pricing data come last.
+	// Resources are then only destroyed after the states of all resources have been updated (see PlanAndExecute).
+	OrderByCost bool
+	// UpgradeProvider returns a newer version of the given provider (never an older one), with which the states
+	// of the resources are updated again whose schema versions recorded in the state are newer than the one
+	// of the given provider (see SchemaVersionError). Nil disables upgrading providers.
+	UpgradeProvider func(ctx context.Context, p *provider.TerraformProvider) (*provider.TerraformProvider, error)
+	// GracePeriod is how long destroys in flight are given to complete once the context is done (see Execute);
+	// if zero, they are canceled right away.
+	GracePeriod time.Duration
+	// Skipped are resources of the state that are skipped before any of them is listed (e.g., the ones whose
+	// provider is unsupported), which are added to the skipped resources of the plan.
+	Skipped []SkippedResource
+	// MaxRetries is the number of times a resource that failed to be destroyed is retried at most, if its error
+	// is worth retrying (see ErrorClass.Retryable); if zero, failed resources are retried as long as other
+	// resources have been destroyed since their last attempt (see Run).
+	MaxRetries int
+	// Checkpoint pauses the run after every number of destroyed resources to ask whether to continue
+	// (nil disables checkpoints).
+	Checkpoint *Checkpoint
+}
+
+// DestroyPlan lists the resources that would be destroyed, which can be destroyed with Execute.
+type DestroyPlan struct {
+	// Candidates are the resources to destroy.
+	Candidates []PlannedResource
+	// Skipped are the resources that are not destroyed, as they didn't match the filter
+	// (or are of Config.Skipped).
+	Skipped []SkippedResource
+	// Gone are the resources of the state whose state couldn't be updated.
+	Gone []ResourceEvent
+	// AlreadyGone are the resources of the state that don't exist anymore (see ErrResourceGone).
+	AlreadyGone []ResourceEvent
+	// Unsupported are the errors of the resources whose type isn't supported by their provider, which can't
+	// be destroyed (see UnsupportedTypeError).
+	Unsupported []RetryDestroyError
+	// Upgrades list the resources handled by upgraded providers (see Config.UpgradeProvider).
+	Upgrades []ProviderUpgrade
+	// Deferred are the candidates that aren't destroyed, as their number exceeds the cap of their type (see Trim).
+	Deferred []PlannedResource
+
+	config Config
+}
+
+// PlannedResource is a resource that would be destroyed.
+type PlannedResource struct {
+	// Resource is the resource to destroy, with its state updated.
+	Resource *Resource
+	// ResourceCandidate contains the attributes of the resource as recorded in the state and its current attributes.
+	ResourceCandidate
+	// Drift lists the names of the attributes whose current values differ from the ones recorded in the state.
+	Drift []string
+	// ProviderName and ProviderVersion are the name and version of the provider that would destroy the resource.
+	ProviderName    string
+	ProviderVersion string
+	// Preview is information how the resource would be destroyed, if this differs from a single destroy call.
+	Preview log.Fields
+	// Auxiliaries are the resources that aren't part of the state, but would be deleted alongside the resource.
+	Auxiliaries []AuxiliaryDeletion
+	// Overrides are the attributes overridden right before the resource would be destroyed (see Resource.Overrides).
+	Overrides []string
+}
+
+// defaultParallel is the default number of concurrent operations.
+const defaultParallel = 10
+
+// Plan lists the resources of the given state that would be destroyed, without destroying anything.
+//
+// The resources are filtered (before and after their state has been updated), and their state is updated
+// (i.e., resources are imported and read), so that the plan only contains resources that still exist.
+func Plan(ctx context.Context, state ResourceLister, filter Filter, config Config) (*DestroyPlan, error) {
+	if config.Parallel == 0 {
+		config.Parallel = defaultParallel
+	}
+
+	resources, skipped, err := selectResources(state, filter, config)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DestroyPlan{config: config, Skipped: skipped}
+
+	resources, plan.Unsupported = checkTypes(resources)
+
+	for _, r := range resources {
+		r.Options = config.Options
+	}
+
+	events := goneEvents{Events: orNoop(config.Events), plan: plan}
+
+	updated := UpdateResources(ctx, resources, config.Parallel, &events)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resources = append(updated, upgradeProviders(ctx, plan, resources, config)...)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sortByAddress(resources)
+
+	// filters might also decide based on the current attributes of resources
+	resources, skipped = Select(resources, filter)
+	plan.Skipped = append(plan.Skipped, skipped...)
+
+	for _, r := range resources {
+		planned := newPlannedResource(r)
+		planned.Preview = r.Preview(ctx)
+
+		if p, ok := config.Providers[planned.ProviderName]; ok && p.Version() != planned.ProviderVersion {
+			planned.Preview["provider_version"] = planned.ProviderVersion
+		}
+
+		auxiliaries, err := r.PredictAuxiliaries(ctx)
+		if err != nil {
+			planned.Preview["auxiliaries_to_delete"] = err.Error()
+		} else if len(auxiliaries) > 0 {
+			planned.Preview["auxiliaries_to_delete"] = len(auxiliaries)
+			planned.Auxiliaries = auxiliaries
+		}
+
+		plan.Candidates = append(plan.Candidates, planned)
+	}
+
+	plan.sortByAddress()
+
+	return plan, nil
+}
+
+// selectResources lists the resources of the given state, split into the ones that match the filter
+// (based on the attributes recorded in the state) and the skipped ones.
+func selectResources(state ResourceLister, filter Filter, config Config) ([]*Resource, []SkippedResource, error) {
+	var resources []*Resource
+
+	var skipped []SkippedResource
+
+	var err error
+
+	if s, ok := state.(SelectingResourceLister); ok && filter != nil {
+		resources, skipped, err = s.SelectResources(config.Providers, filter)
+	} else {
+		resources, err = state.Resources(config.Providers)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get resources from Terraform state: %s", err)
+	}
+
+	// the order of the listed resources determines the order in which they are processed and logged
+	// (sorted as a copy, as the slice belongs to the state)
+	resources = append([]*Resource{}, resources...)
+	sortByAddress(resources)
+
+	// filters might also decide based on the decoded attributes of resources
+	resources, skippedByAttrs := Select(resources, filter)
+
+	skipped = append(append(append([]SkippedResource{}, config.Skipped...), skipped...), skippedByAttrs...)
+
+	return resources, skipped, nil
+}
+
+// SkipReasons returns the number of resources of the plan that are not destroyed by the reason why, i.e.,
+// of the skipped ones and of the ones whose state couldn't be updated or that don't exist anymore.
+func (plan *DestroyPlan) SkipReasons() map[SkipReason]int {
+	result := map[SkipReason]int{}
+
+	for _, s := range plan.Skipped {
+		result[s.Reason]++
+	}
+
+	for _, events := range [][]ResourceEvent{plan.Gone, plan.AlreadyGone} {
+		for _, e := range events {
+			result[e.SkipReason]++
+		}
+	}
+
+	return result
+}
+
+// newPlannedResource returns a resource (whose state has been updated) as planned to be destroyed.
+func newPlannedResource(r *Resource) PlannedResource {
+	c := r.Candidate()
+
+	planned := PlannedResource{
+		Resource:          r,
+		ResourceCandidate: c,
+		Drift:             drift(c.Attrs, c.RefreshedAttrs),
+		Overrides:         r.Overrides(),
+	}
+
+	if r.provider != nil {
+		planned.ProviderName = r.provider.Name()
+		planned.ProviderVersion = r.provider.Version()
+	}
+
+	return planned
+}
+
+// Execute destroys exactly the resources of the given plan (see Run).
+//
+// Once the context is done, no further resources are destroyed, while the destroys in flight are given
+// config.GracePeriod to complete. The result is then marked as interrupted and has the resources destroyed
+// so far as well as the ones that haven't been processed (see Result.Remaining). The same applies if the run is
+// stopped at a checkpoint (see Config.Checkpoint).
+func Execute(ctx context.Context, plan *DestroyPlan) Result {
+	resources := plan.resources()
+	concurrency := plan.config.concurrency()
+
+	ctx, events := withCheckpoints(ctx, plan.config.Checkpoint, resources, concurrency,
+		alreadyGoneEvents{Events: orNoop(plan.config.Events), alreadyGone: len(plan.AlreadyGone)})
+	defer events.cancel()
+
+	ctx, finish := withGracePeriod(ctx, plan.config.GracePeriod)
+	defer finish()
+
+	ctx = withMaxRetries(ctx, plan.config.MaxRetries)
+
+	var result Result
+
+	if plan.config.OrderByModule {
+		result = runByModule(ctx, resources, concurrency, events)
+	} else {
+		result = runWithConcurrency(ctx, resources, concurrency, events)
+	}
+
+	result.AlreadyGone = len(plan.AlreadyGone)
+	result.Stopped = events.isStopped()
+
+	return result
+}
+
+// resources returns the resources to destroy, the most expensive first if ordered by cost.
+func (plan *DestroyPlan) resources() []DestroyableResource {
+	var resources []DestroyableResource
+
+	for _, c := range plan.Candidates {
+		resources = append(resources, c.Resource)
+	}
+
+	if plan.config.OrderByCost {
+		orderByCost(resources)
+	}
+
+	return resources
+}
+
+// concurrency returns the concurrency of destroy operations.
+func (c Config) concurrency() *Concurrency {
+	if c.Concurrency != nil {
+		return c.Concurrency
+	}
+
+	return NewConcurrency(c.Parallel)
+}
+
+// goneEvents records the resources whose state couldn't be updated and that don't exist anymore in the plan.
+type goneEvents struct {
+	Events
+
+	plan *DestroyPlan
+}
+
+func (e *goneEvents) ResourceImportFailed(event ResourceEvent) {
+	// called by UpdateResources sequentially, so no lock is needed
+	if errors.Is(event.Err, ErrResourceGone) {
+		e.plan.AlreadyGone = append(e.plan.AlreadyGone, event)
+	} else {
+		e.plan.Gone = append(e.plan.Gone, event)
+	}
+
+	e.Events.ResourceImportFailed(event)
+}
+
+// alreadyGoneEvents adds the number of resources of the plan that don't exist anymore to the result of a run.
+type alreadyGoneEvents struct {
+	Events
+
+	alreadyGone int
+}
+
+func (e alreadyGoneEvents) RunCompleted(result Result) {
+	result.AlreadyGone = e.alreadyGone
+	e.Events.RunCompleted(result)
+}
+
+// drift returns the names of the attributes whose values differ between the two given states
+// (nil if any of the states is unknown), regardless of their marks.
+func drift(stateAttrs, refreshedAttrs cty.Value) []string {
+	stateAttrs, _ = unmarkDeep(stateAttrs)
+	refreshedAttrs, _ = unmarkDeep(refreshedAttrs)
+
+	if stateAttrs == cty.NilVal || refreshedAttrs == cty.NilVal ||
+		stateAttrs.IsNull() || refreshedAttrs.IsNull() ||
+		!stateAttrs.CanIterateElements() || !refreshedAttrs.CanIterateElements() {
+		return nil
+	}
+
+	refreshed := refreshedAttrs.AsValueMap()
+
+	var result []string
+
+	for name, v := range stateAttrs.AsValueMap() {
+		rv, ok := refreshed[name]
+		if !ok || !v.RawEquals(rv) {
+			result = append(result, name)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
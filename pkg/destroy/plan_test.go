@@ -0,0 +1,223 @@
+package destroy_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// fakeState lists a fixed list of resources.
+type fakeState struct {
+	resources []*destroy.Resource
+	err       error
+}
+
+func (s fakeState) Resources(map[string]*provider.TerraformProvider) ([]*destroy.Resource, error) {
+	return s.resources, s.err
+}
+
+func TestPlan_AllSkipped(t *testing.T) {
+	state := fakeState{resources: []*destroy.Resource{
+		destroy.NewWithState("aws_default_vpc.default", "aws_default_vpc", "vpc-1234", nil, nil, nil),
+	}}
+
+	actualPlan, err := destroy.Plan(context.Background(), state, destroy.DefaultResourcesFilter{}, destroy.Config{})
+	require.NoError(t, err)
+
+	assert.Empty(t, actualPlan.Candidates)
+	require.Len(t, actualPlan.Skipped, 1)
+	assert.Equal(t, "vpc-1234", actualPlan.Skipped[0].Resource.ID())
+
+	actualResult := destroy.Execute(context.Background(), actualPlan)
+	assert.Equal(t, destroy.Result{}, actualResult)
+}
+
+func TestPlan_StateError(t *testing.T) {
+	state := fakeState{err: fmt.Errorf("some error")}
+
+	_, err := destroy.Plan(context.Background(), state, nil, destroy.Config{})
+	assert.EqualError(t, err, "failed to get resources from Terraform state: some error")
+}
+
+func TestPlan_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	state := fakeState{resources: []*destroy.Resource{
+		destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-1234", nil, nil, nil),
+	}}
+
+	_, err := destroy.Plan(ctx, state, nil, destroy.Config{})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestPlanAndExecute_UnsupportedTypes(t *testing.T) {
+	stub := provider.NewStub(provider.StubConfig{}, []string{"aws_s3_object", "aws_vpc"})
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return stub, nil
+		},
+	})
+	require.NoError(t, err)
+
+	objectState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("key"), "bucket": cty.StringVal("b")})
+
+	state := fakeState{resources: []*destroy.Resource{
+		destroy.NewWithState("aws_s3_bucket_object.test", "aws_s3_bucket_object", "key", nil, tp, &objectState),
+		destroy.NewWithState("aws_foo.test", "aws_foo", "foo-1", nil, tp, nil),
+		destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-1", nil, tp, nil),
+	}}
+
+	actualPlan, actualResult, err := destroy.PlanAndExecute(context.Background(), state, nil, destroy.Config{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, actualResult.Deleted)
+	assert.Empty(t, actualResult.Failed)
+	assert.ElementsMatch(t, []string{"aws_s3_object.key", "aws_vpc.vpc-1"}, stub.Destroyed())
+
+	require.Len(t, actualPlan.Unsupported, 1)
+	assert.Equal(t, "aws_foo.test", actualPlan.Unsupported[0].Resource.Address())
+	assert.Equal(t, destroy.ErrorClassUnsupportedType, actualPlan.Unsupported[0].Class)
+	assert.EqualError(t, actualPlan.Unsupported[0], "type not supported by provider aws v3.42.0 "+
+		"(pin an older version of the provider that supports it via -provider-version aws=<version>)")
+}
+
+func TestPlan_Deterministic(t *testing.T) {
+	// two VPCs with 9 subnets each, whose states are updated concurrently
+	resources, stub := stubResources(t, provider.StubConfig{Latency: time.Millisecond}, 20)
+
+	for _, id := range []string{"subnet-3", "subnet-12"} {
+		goneState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(id)})
+
+		stub.ApplyResourceChange(providers.ApplyResourceChangeRequest{TypeName: "aws_subnet", PriorState: goneState,
+			PlannedState: cty.NullVal(goneState.Type())})
+	}
+
+	filter := destroy.FilterFunc(func(c destroy.ResourceCandidate) (bool, destroy.SkipReason) {
+		if strings.HasSuffix(c.ID, "5") {
+			return false, destroy.SkipReasonExcludedAddress
+		}
+
+		return true, ""
+	})
+
+	serializedPlan := func(resources []*destroy.Resource) string {
+		plan, err := destroy.Plan(context.Background(), fakeState{resources: resources}, filter,
+			destroy.Config{Parallel: 10})
+		require.NoError(t, err)
+
+		var serialized struct {
+			Candidates, Skipped, AlreadyGone []string
+			Order                            []destroy.OrderedResource
+		}
+
+		for _, c := range plan.Candidates {
+			serialized.Candidates = append(serialized.Candidates, c.Address)
+		}
+
+		for _, s := range plan.Skipped {
+			serialized.Skipped = append(serialized.Skipped, s.Resource.Address())
+		}
+
+		for _, e := range plan.AlreadyGone {
+			serialized.AlreadyGone = append(serialized.AlreadyGone, e.Address)
+		}
+
+		serialized.Order = plan.Order()
+
+		result, err := json.Marshal(serialized)
+		require.NoError(t, err)
+
+		return string(result)
+	}
+
+	// the same state, listed in a different order
+	reversed := make([]*destroy.Resource, len(resources))
+	for i, r := range resources {
+		reversed[len(resources)-1-i] = r
+	}
+
+	expected := serializedPlan(resources)
+
+	assert.Contains(t, expected, `"AlreadyGone":["aws_subnet.test[12]","aws_subnet.test[3]"]`)
+	assert.Contains(t, expected, `"Skipped":["aws_subnet.test[15]","aws_subnet.test[5]"]`)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, expected, serializedPlan(resources))
+		assert.Equal(t, expected, serializedPlan(reversed))
+	}
+}
+
+func TestPlan_AlreadyGone(t *testing.T) {
+	tests := []struct {
+		name    string
+		execute func(state destroy.ResourceLister) (*destroy.DestroyPlan, destroy.Result)
+	}{
+		{
+			name: "plan and execute",
+			execute: func(state destroy.ResourceLister) (*destroy.DestroyPlan, destroy.Result) {
+				plan, err := destroy.Plan(context.Background(), state, nil, destroy.Config{})
+				require.NoError(t, err)
+
+				return plan, destroy.Execute(context.Background(), plan)
+			},
+		},
+		{
+			name: "forced",
+			execute: func(state destroy.ResourceLister) (*destroy.DestroyPlan, destroy.Result) {
+				plan, result, err := destroy.PlanAndExecute(context.Background(), state, nil, destroy.Config{})
+				require.NoError(t, err)
+
+				return plan, result
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_vpc"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return stub, nil
+				},
+			})
+			require.NoError(t, err)
+
+			goneState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")})
+
+			stub.ApplyResourceChange(providers.ApplyResourceChangeRequest{TypeName: "aws_vpc", PriorState: goneState,
+				PlannedState: cty.NullVal(goneState.Type())})
+
+			state := fakeState{resources: []*destroy.Resource{
+				destroy.NewWithState("aws_vpc.gone", "aws_vpc", "vpc-1", nil, tp, nil),
+				destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-2", nil, tp, nil),
+			}}
+
+			actualPlan, actualResult := tc.execute(state)
+
+			require.Len(t, actualPlan.AlreadyGone, 1)
+			assert.Equal(t, "aws_vpc.gone", actualPlan.AlreadyGone[0].Address)
+			assert.Equal(t, destroy.ErrorClassAlreadyGone, actualPlan.AlreadyGone[0].Class)
+			assert.Empty(t, actualPlan.Gone)
+
+			assert.Equal(t, 1, actualResult.Deleted)
+			assert.Equal(t, 1, actualResult.AlreadyGone)
+			assert.Empty(t, actualResult.Failed)
+
+			assert.Equal(t, []string{"aws_vpc.gone"}, destroy.NewDriftReport(actualPlan).AlreadyGone)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package destroy
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+//nolint:gochecknoglobals
+var (
+	// enforcedAttrs lists attributes that the API of the cloud enforces (rather than the provider), so that
+	// changing them only in the state before a resource is destroyed isn't enough (e.g., the deletion protection
+	// of a load balancer). Overrides of these attributes are applied by an update of the resource first
+	// (see Options.Overrides).
+	enforcedAttrs = map[string]bool{
+		"deletion_protection": true,
+		// of DynamoDB tables, only known to newer versions of the AWS provider than the default one
+		// (see -provider-version)
+		"deletion_protection_enabled": true,
+		"enable_deletion_protection":  true,
+		"disable_api_termination":     true,
+	}
+)
+
+// disableProtection returns a handler that sets the given attribute of a resource to false by an update
+// before the resource is destroyed, if the attribute is true (e.g., enable_deletion_protection of
+// a load balancer).
+func disableProtection(attr string) TypeHandler {
+	return UpdateSteps{
+		Step: "disable deletion protection",
+		Steps: []UpdateStep{{
+			Name: "set " + attr + "=false",
+			Attrs: func(r Resource) map[string]cty.Value {
+				if !isTrue(r.State(), attr) {
+					return nil
+				}
+
+				return map[string]cty.Value{attr: cty.False}
+			},
+			Retries: 2,
+		}},
+	}
+}
+
+// isTrue returns true if the given state has a bool attribute of the given name that is true.
+func isTrue(state *cty.Value, attr string) bool {
+	if state == nil || state.IsNull() || !state.Type().IsObjectType() || !state.Type().HasAttribute(attr) {
+		return false
+	}
+
+	v := state.GetAttr(attr)
+
+	return v.IsKnown() && !v.IsNull() && v.Type() == cty.Bool && v.True()
+}
@@ -0,0 +1,81 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+//nolint:gochecknoglobals
+var (
+	// rdsIdentifierAttrs maps RDS resource types (and the ones of similar database services) to the attribute
+	// holding their name.
+	rdsIdentifierAttrs = map[string]string{
+		"aws_db_instance":      "identifier",
+		"aws_rds_cluster":      "cluster_identifier",
+		"aws_docdb_cluster":    "cluster_identifier",
+		"aws_neptune_cluster":  "cluster_identifier",
+		"aws_redshift_cluster": "cluster_identifier",
+	}
+)
+
+// disableDeletionProtection turns off the deletion protection of an RDS instance or cluster in the cloud
+// (changing the attribute only in the state isn't enough). Returns the new state of the resource.
+func (r Resource) disableDeletionProtection(ctx context.Context) (cty.Value, error) {
+	state := *r.State()
+
+	deletionProtection := state.GetAttr("deletion_protection")
+	if !deletionProtection.IsKnown() || deletionProtection.IsNull() || deletionProtection.False() {
+		return state, nil
+	}
+
+	log.WithField("id", r.ID()).Info(internal.Pad("disabling deletion protection"))
+
+	return r.update(ctx, map[string]cty.Value{
+		"deletion_protection": cty.False,
+		"apply_immediately":   cty.True,
+	}, rdsTimeout)
+}
+
+// rdsDestroyAttrs returns the attributes of an RDS instance or cluster that need to be changed
+// in the state before calling destroy, so that its deletion protection is off and the provider skips the final
+// snapshot (or takes one, see finalSnapshotDestroyAttrs).
+func (r Resource) rdsDestroyAttrs() map[string]cty.Value {
+	attrs := r.finalSnapshotDestroyAttrs()
+	attrs["deletion_protection"] = cty.False
+
+	return attrs
+}
+
+// finalSnapshotDestroyAttrs returns the attributes of a database instance or cluster (e.g., of RDS, DocumentDB,
+// Neptune, or Redshift) that need to be changed in the state before calling destroy, so that the provider skips
+// the final snapshot; or, if Options.RDSTakeFinalSnapshot is set, takes a snapshot named
+// terradozer-<name>-<timestamp> (the attributes are logged before the destroy, see Resource.Overrides).
+func (r Resource) finalSnapshotDestroyAttrs() map[string]cty.Value {
+	if !r.Options.RDSTakeFinalSnapshot {
+		return map[string]cty.Value{
+			"skip_final_snapshot":       cty.True,
+			"final_snapshot_identifier": cty.NullVal(cty.String),
+		}
+	}
+
+	name := r.ID()
+
+	if r.State() != nil && r.State().Type().HasAttribute(rdsIdentifierAttrs[r.Type()]) {
+		nameAttr := r.State().GetAttr(rdsIdentifierAttrs[r.Type()])
+		if nameAttr.IsKnown() && !nameAttr.IsNull() {
+			name = nameAttr.AsString()
+		}
+	}
+
+	snapshotID := fmt.Sprintf("terradozer-%s-%s", name, time.Now().UTC().Format("20060102150405"))
+
+	return map[string]cty.Value{
+		"skip_final_snapshot":       cty.False,
+		"final_snapshot_identifier": cty.StringVal(snapshotID),
+	}
+}
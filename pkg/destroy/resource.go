@@ -0,0 +1,213 @@
+// Package destroy updates the state of Terraform resources (import and read) and destroys them.
+package destroy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Resource represents a Terraform resource that can be destroyed.
+type Resource struct {
+	// Options configures how the resource is destroyed.
+	Options Options
+	// DeleteTimeout is the delete timeout of the resource as customized by a "timeouts" block in its configuration,
+	// which is recorded in the state (zero if not customized).
+	DeleteTimeout time.Duration
+	// SchemaVersion is the schema version of the resource's attributes recorded in the state.
+	SchemaVersion uint64
+	// Deposed is the key of the deposed object of its resource instance that the resource is (e.g., left behind
+	// by a failed create-before-destroy), which is empty for the current object. Both are destroyed independently.
+	Deposed string
+	// StoredState are the attributes recorded in the state decoded leniently with the provider's schema,
+	// if they don't satisfy it (otherwise, they are the resource's state; see NewWithState). They are used
+	// to destroy the resource if it can neither be imported nor read, or with Options.NoRefresh (nil if unknown).
+	StoredState *cty.Value
+	// terraformType is the resource's type as defined by the Terraform Provider (e.g., aws_instance).
+	terraformType string
+	// id is a resource's ID as defined by the Terraform Provider.
+	id string
+	// provider is the Terraform Provider to update the state of and to destroy a resource.
+	provider *provider.TerraformProvider
+	// state is the Terraform state of the resource (without marks, see setState).
+	state *cty.Value
+	// marks are the paths of the values of the state that have been marked (e.g., as sensitive).
+	marks []cty.PathValueMarks
+	// stateAttrs are the attributes of the resource as recorded in the state file (nil if unknown).
+	stateAttrs *cty.Value
+	// refreshed is true once the state has been updated.
+	refreshed bool
+	// attrs are attributes that are needed additionally to the ID to read the state of a resource.
+	attrs map[string]cty.Value
+	// address is the absolute address of the resource instance in the state.
+	address string
+	// dependencies are the addresses of resource instances this resource depends on.
+	dependencies []string
+	// batched is true once the resource has been part of a batch deletion (see destroyBatches()).
+	batched bool
+	// subResources are the resources imported alongside the resource (see SubResource).
+	subResources []SubResource
+	// omittedSubResources is the number of sub-resources beyond maxSubResources, which aren't recorded.
+	omittedSubResources int
+}
+
+// New creates a destroyable Terraform resource.
+//
+// To destroy a resource, its Terraform Type and ID (both together uniquely identify a resource),
+// plus a provider that will handle the destroy is needed. Note: if a resource's internal state
+// representation is known, use NewWithState() instead.
+//
+// For some resources, additionally to the ID a list of attributes needs to be populated to destroy it.
+func New(terraformType, id string, attrs map[string]cty.Value, provider *provider.TerraformProvider) *Resource {
+	return &Resource{
+		terraformType: terraformType,
+		id:            id,
+		provider:      provider,
+		attrs:         attrs,
+	}
+}
+
+// NewWithState creates a destroyable Terraform resource.
+//
+// This constructor is used if a resource's internal state representation is known
+// based on a present Terraform state file. A resource created with this constructor can be destroyed more reliable
+// than with New(), which is used when the state is not known.
+//
+// The address of the resource instance in the state and the addresses of the resource instances it depends on
+// are used to destroy resources in the right order. The state can be nil if it couldn't be decoded,
+// then the resource is imported by its ID when its state is updated.
+func NewWithState(address, terraformType, id string, dependencies []string,
+	provider *provider.TerraformProvider, state *cty.Value) *Resource {
+	r := &Resource{
+		terraformType: terraformType,
+		id:            id,
+		provider:      provider,
+		stateAttrs:    state,
+		address:       address,
+		dependencies:  dependencies,
+	}
+
+	if state != nil {
+		r.setState(*state)
+		r.stateAttrs = r.state
+	}
+
+	return r
+}
+
+// Type returns the Terraform type of a resource.
+func (r Resource) Type() string {
+	return r.terraformType
+}
+
+// ID returns the Terraform ID of a resource.
+func (r Resource) ID() string {
+	return r.id
+}
+
+// State returns the internal Terraform state representation of a resource.
+func (r Resource) State() *cty.Value {
+	return r.state
+}
+
+// Address returns the absolute address of a resource instance in the state.
+// The address is empty if the resource hasn't been created from a state.
+func (r Resource) Address() string {
+	return r.address
+}
+
+// DeposedOf returns the key of the deposed object a resource is (see Resource.Deposed), or an empty string
+// if the resource is a current object (or not created from a state).
+func DeposedOf(r DestroyableResource) string {
+	if res, ok := r.(*Resource); ok {
+		return res.Deposed
+	}
+
+	return ""
+}
+
+// Dependencies returns the addresses of the resource instances that a resource depends on.
+func (r Resource) Dependencies() []string {
+	return r.dependencies
+}
+
+// Candidate returns the resource as candidate to be selected by a Filter.
+func (r Resource) Candidate() ResourceCandidate {
+	c := ResourceCandidate{
+		Address:        r.Address(),
+		Type:           r.Type(),
+		ID:             r.ID(),
+		Deposed:        r.Deposed,
+		Attrs:          cty.NilVal,
+		RefreshedAttrs: cty.NilVal,
+	}
+
+	if r.stateAttrs != nil {
+		c.Attrs = *r.stateAttrs
+	}
+
+	if r.refreshed && r.state != nil {
+		c.RefreshedAttrs = r.markedState()
+	}
+
+	return c
+}
+
+// Preview returns information how a resource will be destroyed, if this differs from a single destroy call
+// (e.g., a note about preceding steps to disable the resource or the number of items deleted alongside).
+func (r Resource) Preview(ctx context.Context) log.Fields {
+	fields := log.Fields{}
+
+	if owner := r.Owner(); owner != "" {
+		fields["owner"] = owner
+	}
+
+	if note := r.describeHandlers(); note != "" {
+		fields["note"] = note
+	}
+
+	if o := r.Overrides(); len(o) > 0 {
+		fields["will_set"] = strings.Join(o, ", ")
+	}
+
+	// reviewers can tell which resources will be deleted by force (e.g., emptied S3 buckets)
+	switch {
+	case r.ForceDestroyDisabled():
+		fields["force_destroy"] = "disabled by flag"
+	case r.HasForceDestroy():
+		fields["force_destroy"] = "applied"
+	}
+
+	if r.omittedSubResources > 0 {
+		fields["sub_resources_omitted"] = r.omittedSubResources
+	}
+
+	if previewFields, ok := previewFields[r.Type()]; ok {
+		for k, v := range previewFields(r, ctx) {
+			fields[k] = v
+		}
+	}
+
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			fields[k] = internal.RenderValue(s)
+		}
+	}
+
+	return fields
+}
+
+// DeletedFields returns additional information about a destroyed resource, if any
+// (e.g., the date when a KMS key scheduled for deletion will be gone).
+func (r Resource) DeletedFields() log.Fields {
+	if fields, ok := deletedFields[r.Type()]; ok {
+		return fields(r)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package destroy
+
+import (
+	"context"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// retriesKey is the key of the retries of a run in a context.
+type retriesKey struct{}
+
+// retries counts how often the resources of a run that failed to be destroyed have been retried,
+// to retry each at most max times (see Config.MaxRetries).
+type retries struct {
+	// max is the number of times a resource is retried at most (unlimited if zero).
+	max int
+
+	mu sync.Mutex
+	// pass is the number of retry passes so far.
+	pass int
+	// counts are the numbers of retries by resource (by type and ID, as the errors of a resource don't necessarily
+	// refer to the same instance of it, e.g., once its state has been updated).
+	counts map[resourceKey]int
+}
+
+// withMaxRetries returns a context in which resources that failed to be destroyed are retried at most
+// the given number of times (unlimited if zero, i.e., as long as there is progress).
+func withMaxRetries(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, retriesKey{}, &retries{max: max, counts: map[resourceKey]int{}})
+}
+
+// retriesOf returns the retries of the run of the given context (unlimited ones if there are none).
+func retriesOf(ctx context.Context) *retries {
+	if r, ok := ctx.Value(retriesKey{}).(*retries); ok {
+		return r
+	}
+
+	return &retries{counts: map[resourceKey]int{}}
+}
+
+// retryPass returns the resources of the given errors to retry in a next pass and the errors of the ones
+// that have been retried max times already (i.e., retries exceeded). The resources to retry are logged together
+// with why they failed.
+func retryPass(ctx context.Context, errs []RetryDestroyError) ([]DestroyableResource, []RetryDestroyError) {
+	r := retriesOf(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var retried, exceeded []RetryDestroyError
+
+	for _, retryErr := range errs {
+		key := resourceKey{retryErr.Resource.Type(), retryErr.Resource.ID()}
+
+		if r.max > 0 && r.counts[key] >= r.max {
+			exceeded = append(exceeded, retryErr)
+
+			continue
+		}
+
+		r.counts[key]++
+		retried = append(retried, retryErr)
+	}
+
+	if len(retried) == 0 {
+		return nil, exceeded
+	}
+
+	r.pass++
+
+	log.WithFields(log.Fields{
+		"pass":      r.pass,
+		"resources": len(retried),
+		"exceeded":  len(exceeded),
+	}).Info(internal.Pad("retrying to destroy resources that failed"))
+
+	var toRetry []DestroyableResource
+
+	for _, retryErr := range retried {
+		log.WithError(retryErr.Err).WithFields(log.Fields{
+			"type":   retryErr.Resource.Type(),
+			"id":     retryErr.Resource.ID(),
+			"reason": retryErr.Class.String(),
+			"retry":  r.counts[resourceKey{retryErr.Resource.Type(), retryErr.Resource.ID()}],
+		}).Info(internal.Pad("retrying to destroy resource"))
+
+		toRetry = append(toRetry, retryErr.Resource)
+	}
+
+	return toRetry, exceeded
+}
@@ -0,0 +1,148 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// stubbornProvider fails to destroy the VPC vpc-<i> with a dependency violation until it's been retried i times,
+// so that each retry pass destroys one more VPC.
+type stubbornProvider struct {
+	*slowProvider
+
+	attemptsMu sync.Mutex
+	attempts   map[string]int
+}
+
+func (p *stubbornProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	id := req.PriorState.GetAttr("id").AsString()
+
+	p.attemptsMu.Lock()
+	p.attempts[id]++
+	attempts := p.attempts[id]
+	p.attemptsMu.Unlock()
+
+	var i int
+
+	_, _ = fmt.Sscanf(id, "vpc-%d", &i)
+
+	if attempts <= i {
+		var diags tfdiags.Diagnostics
+
+		return providers.ApplyResourceChangeResponse{
+			Diagnostics: diags.Append(tfdiags.Sourceless(tfdiags.Error,
+				"DependencyViolation: resource has a dependent object", id)),
+		}
+	}
+
+	return p.slowProvider.ApplyResourceChange(req)
+}
+
+// stubbornState returns a state with the given number of VPCs destroyed by the given provider.
+func stubbornState(t *testing.T, p *stubbornProvider, numOfVPCs int) fakeState {
+	tp, err := provider.Init(context.Background(), "stubborn", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return p, nil
+		},
+	})
+	require.NoError(t, err)
+
+	var resources []*destroy.Resource
+
+	for i := 0; i < numOfVPCs; i++ {
+		id := fmt.Sprintf("vpc-%d", i)
+		state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(id)})
+
+		resources = append(resources, destroy.NewWithState(fmt.Sprintf("aws_vpc.test[%d]", i), "aws_vpc", id,
+			nil, tp, &state))
+	}
+
+	return fakeState{resources: resources}
+}
+
+func TestExecute_MaxRetries(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxRetries       int
+		forced           bool
+		expectedDeleted  int
+		expectedFailed   []string
+		expectedAttempts map[string]int
+	}{
+		{
+			name:             "unlimited",
+			expectedDeleted:  4,
+			expectedAttempts: map[string]int{"vpc-0": 1, "vpc-1": 2, "vpc-2": 3, "vpc-3": 4},
+		},
+		{
+			name:             "retries exceeded",
+			maxRetries:       2,
+			expectedDeleted:  3,
+			expectedFailed:   []string{"vpc-3"},
+			expectedAttempts: map[string]int{"vpc-0": 1, "vpc-1": 2, "vpc-2": 3, "vpc-3": 3},
+		},
+		{
+			name:             "retries exceeded while updating states",
+			maxRetries:       2,
+			forced:           true,
+			expectedDeleted:  3,
+			expectedFailed:   []string{"vpc-3"},
+			expectedAttempts: map[string]int{"vpc-0": 1, "vpc-1": 2, "vpc-2": 3, "vpc-3": 3},
+		},
+		{
+			name:             "enough retries",
+			maxRetries:       3,
+			forced:           true,
+			expectedDeleted:  4,
+			expectedAttempts: map[string]int{"vpc-0": 1, "vpc-1": 2, "vpc-2": 3, "vpc-3": 4},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &stubbornProvider{slowProvider: &slowProvider{}, attempts: map[string]int{}}
+			state := stubbornState(t, p, 4)
+			config := destroy.Config{Parallel: 2, MaxRetries: tc.maxRetries}
+
+			var result destroy.Result
+
+			if tc.forced {
+				var err error
+
+				_, result, err = destroy.PlanAndExecute(context.Background(), state, nil, config)
+				require.NoError(t, err)
+			} else {
+				plan, err := destroy.Plan(context.Background(), state, nil, config)
+				require.NoError(t, err)
+
+				result = destroy.Execute(context.Background(), plan)
+			}
+
+			assert.Equal(t, tc.expectedDeleted, result.Deleted)
+			assert.Equal(t, tc.expectedAttempts, p.attempts)
+
+			var actualFailed []string
+
+			for _, err := range result.Failed {
+				assert.Equal(t, destroy.ErrorClassDependencyViolation, err.Class)
+
+				actualFailed = append(actualFailed, err.Resource.ID())
+			}
+
+			assert.Equal(t, tc.expectedFailed, actualFailed)
+		})
+	}
+}
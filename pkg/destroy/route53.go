@@ -0,0 +1,110 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// route53ChangeBatchSize is the maximum number of record sets deleted with one ChangeResourceRecordSets call.
+const route53ChangeBatchSize = 100
+
+// emptyRoute53Zone deletes all record sets of a hosted zone, except the zone's own NS and SOA records,
+// since a zone can't be deleted while it has other record sets. Often such record sets aren't
+// part of the state (e.g. created by external-dns).
+func (r Resource) emptyRoute53Zone(ctx context.Context) (cty.Value, error) {
+	recordSets, err := r.route53RecordSetsToDelete(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	client := route53.New(r.Options.AWSSession)
+
+	for start := 0; start < len(recordSets); start += route53ChangeBatchSize {
+		end := start + route53ChangeBatchSize
+		if end > len(recordSets) {
+			end = len(recordSets)
+		}
+
+		var changes []*route53.Change
+
+		for _, recordSet := range recordSets[start:end] {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String(route53.ChangeActionDelete),
+				ResourceRecordSet: recordSet,
+			})
+		}
+
+		_, err := client.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(r.ID()),
+			ChangeBatch:  &route53.ChangeBatch{Changes: changes},
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to delete record sets of hosted zone: %s", err)
+
+			// the changes of a batch are applied all or none
+			for _, recordSet := range recordSets[start:end] {
+				ReportAuxiliary(ctx, r.newAuxiliaryDeletion(auxiliaryRecordSet, recordSetID(recordSet), err))
+			}
+
+			return cty.NilVal, err
+		}
+
+		for _, recordSet := range recordSets[start:end] {
+			ReportAuxiliary(ctx, r.newAuxiliaryDeletion(auxiliaryRecordSet, recordSetID(recordSet), nil))
+
+			log.WithFields(log.Fields{
+				"zone_id": r.ID(),
+				"name":    aws.StringValue(recordSet.Name),
+				"type":    aws.StringValue(recordSet.Type),
+			}).Info(internal.Pad("deleted record set"))
+		}
+	}
+
+	return *r.State(), nil
+}
+
+// route53RecordSetsToDelete lists all record sets of a hosted zone, except the zone's own NS and SOA records.
+func (r Resource) route53RecordSetsToDelete(ctx context.Context) ([]*route53.ResourceRecordSet, error) {
+	if r.Options.AWSSession == nil {
+		return nil, fmt.Errorf("AWS session to delete record sets is not configured")
+	}
+
+	zoneName := ""
+
+	nameAttr := r.State().GetAttr("name")
+	if nameAttr.IsKnown() && !nameAttr.IsNull() {
+		zoneName = strings.TrimSuffix(nameAttr.AsString(), ".") + "."
+	}
+
+	var result []*route53.ResourceRecordSet
+
+	err := route53.New(r.Options.AWSSession).ListResourceRecordSetsPagesWithContext(ctx,
+		&route53.ListResourceRecordSetsInput{
+			HostedZoneId: aws.String(r.ID()),
+		}, func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+			for _, recordSet := range page.ResourceRecordSets {
+				recordType := aws.StringValue(recordSet.Type)
+
+				if aws.StringValue(recordSet.Name) == zoneName &&
+					(recordType == route53.RRTypeNs || recordType == route53.RRTypeSoa) {
+					continue
+				}
+
+				result = append(result, recordSet)
+			}
+
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list record sets of hosted zone: %s", err)
+	}
+
+	return result, nil
+}
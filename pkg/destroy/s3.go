@@ -0,0 +1,290 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+//nolint:gochecknoglobals
+var (
+	// s3MFADeleteErrors are parts of error messages returned by the S3 API for deleting object versions
+	// of a bucket with MFA delete enabled without the MFA device.
+	s3MFADeleteErrors = []string{
+		"Mfa Authentication must be used",
+		"MFA Delete is enabled",
+	}
+
+	// s3ObjectLockErrors are parts of error messages returned by the S3 API for deleting object versions
+	// that are protected by object lock (i.e., a retention period or legal hold).
+	s3ObjectLockErrors = []string{
+		"protected by object lock",
+		"ObjectLocked",
+	}
+)
+
+const (
+	// s3SettingMFADelete is the setting of a bucket which requires the MFA device of the root account
+	// to delete object versions.
+	s3SettingMFADelete = "MFA delete"
+	// s3SettingObjectLock is the setting of a bucket which prevents object versions from being deleted
+	// until their retention has expired.
+	s3SettingObjectLock = "object lock"
+	// s3SettingComplianceLock is object lock whose default retention is in compliance mode,
+	// which no one can bypass (not even the root account).
+	s3SettingComplianceLock = "object lock (compliance mode)"
+	// s3SettingGovernanceLock is object lock whose default retention is in governance mode, which can be bypassed
+	// with the s3:BypassGovernanceRetention permission.
+	s3SettingGovernanceLock = "object lock (governance mode)"
+)
+
+// s3ObjectLockRuleAttrs returns the object lock configuration of an S3 bucket without its rule (i.e., the default
+// retention of new objects), or nil if the bucket has no such rule.
+func (r Resource) s3ObjectLockRuleAttrs() map[string]cty.Value {
+	state := *r.State()
+	if !state.Type().IsObjectType() || !state.Type().HasAttribute("object_lock_configuration") {
+		return nil
+	}
+
+	config := state.GetAttr("object_lock_configuration")
+	if !config.IsWhollyKnown() || config.IsNull() || !config.Type().IsListType() || config.LengthInt() == 0 {
+		return nil
+	}
+
+	var changed bool
+
+	var configs []cty.Value
+
+	for it := config.ElementIterator(); it.Next(); {
+		_, c := it.Element()
+
+		rule := c.GetAttr("rule")
+		if rule.IsNull() || rule.LengthInt() == 0 {
+			configs = append(configs, c)
+
+			continue
+		}
+
+		attrs := c.AsValueMap()
+		attrs["rule"] = cty.ListValEmpty(rule.Type().ElementType())
+		configs = append(configs, cty.ObjectVal(attrs))
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return map[string]cty.Value{
+		"object_lock_configuration": cty.ListVal(configs),
+	}
+}
+
+// bucketManualAction returns a ManualActionError if destroying an S3 bucket has failed (with the given error)
+// because of MFA delete or object lock, which force_destroy can't get around (retrying is pointless). The given
+// state is the one refreshed before the bucket has been prepared for deletion, which still has the default
+// retention of the object lock configuration.
+//
+// If enabled (see Options.S3BypassGovernanceRetention), the object versions of a bucket whose default retention
+// is in governance mode are deleted once with the bypass header, and the bucket is destroyed again.
+func (r Resource) bucketManualAction(ctx context.Context, refreshed, state cty.Value, err error) error {
+	manualActionErr := r.bucketManualActionError(refreshed, err)
+	if manualActionErr == nil {
+		return err
+	}
+
+	if manualActionErr.Setting != s3SettingGovernanceLock || !r.Options.S3BypassGovernanceRetention {
+		return manualActionErr
+	}
+
+	log.WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).
+		Info(internal.Pad("deleting object versions locked in governance mode (bypassing retention)"))
+
+	if bypassErr := r.deleteLockedObjectVersions(ctx); bypassErr != nil {
+		manualActionErr.Remediation += fmt.Sprintf(" (bypassing governance retention failed: %s)", bypassErr)
+
+		return manualActionErr
+	}
+
+	err = r.destroy(ctx, state)
+	if err == nil {
+		return nil
+	}
+
+	if manualActionErr := r.bucketManualActionError(refreshed, err); manualActionErr != nil {
+		return manualActionErr
+	}
+
+	return err
+}
+
+// bucketManualActionError returns a ManualActionError with the setting of an S3 bucket that is the reason
+// for the given error of its destroy, found either in the error itself or in the given state (if the bucket
+// couldn't be emptied). Returns nil if the error has a different cause.
+func (r Resource) bucketManualActionError(state cty.Value, err error) *ManualActionError {
+	class := Classify(err)
+	notEmptied := class == ErrorClassDependencyViolation || class == ErrorClassPermissionDenied
+
+	bucket := r.ID()
+
+	switch {
+	case containsAny(err.Error(), s3MFADeleteErrors) || (notEmptied && s3MFADeleteEnabled(state)):
+		return &ManualActionError{
+			Err:     err,
+			Setting: s3SettingMFADelete,
+			Remediation: fmt.Sprintf("disable MFA delete of bucket %s with the MFA device of the root account "+
+				"(aws s3api put-bucket-versioning --bucket %s --versioning-configuration "+
+				"Status=Suspended,MFADelete=Disabled --mfa '<serial number> <code>'), then run terradozer again",
+				bucket, bucket),
+		}
+
+	case containsAny(err.Error(), s3ObjectLockErrors) || (notEmptied && s3ObjectLockEnabled(state)):
+		e := &ManualActionError{Err: err, Setting: s3SettingObjectLock}
+
+		switch s3ObjectLockMode(state) {
+		case s3.ObjectLockRetentionModeCompliance:
+			e.Setting = s3SettingComplianceLock
+			e.Remediation = fmt.Sprintf("object versions in bucket %s are locked in compliance mode, which can't "+
+				"be bypassed; wait until their retention has expired, then run terradozer again", bucket)
+		case s3.ObjectLockRetentionModeGovernance:
+			e.Setting = s3SettingGovernanceLock
+			e.Remediation = fmt.Sprintf("object versions in bucket %s are locked in governance mode; delete them "+
+				"with the s3:BypassGovernanceRetention permission (see -wait-for-object-lock-expiry) or wait until "+
+				"their retention has expired, then run terradozer again", bucket)
+		default:
+			e.Remediation = fmt.Sprintf("object versions in bucket %s are locked; remove their legal holds "+
+				"and wait until their retention has expired (or bypass governance mode retention with "+
+				"-wait-for-object-lock-expiry), then run terradozer again", bucket)
+		}
+
+		return e
+	}
+
+	return nil
+}
+
+// s3MFADeleteEnabled returns true if MFA delete is enabled in the versioning configuration of an S3 bucket.
+func s3MFADeleteEnabled(state cty.Value) bool {
+	for _, versioning := range listAttr(state, "versioning") {
+		mfaDelete := objectAttr(versioning, "mfa_delete")
+		if mfaDelete.IsKnown() && !mfaDelete.IsNull() && mfaDelete.Type() == cty.Bool && mfaDelete.True() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// s3ObjectLockEnabled returns true if object lock is enabled for an S3 bucket.
+func s3ObjectLockEnabled(state cty.Value) bool {
+	for _, config := range listAttr(state, "object_lock_configuration") {
+		if stringAttr(config, "object_lock_enabled") == s3.ObjectLockEnabledEnabled {
+			return true
+		}
+	}
+
+	return false
+}
+
+// s3ObjectLockMode returns the mode (GOVERNANCE or COMPLIANCE) of the default retention of an S3 bucket's object
+// lock configuration, or an empty string if the bucket has no default retention.
+func s3ObjectLockMode(state cty.Value) string {
+	for _, config := range listAttr(state, "object_lock_configuration") {
+		for _, rule := range listAttr(config, "rule") {
+			for _, retention := range listAttr(rule, "default_retention") {
+				if mode := stringAttr(retention, "mode"); mode != "" {
+					return mode
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// deleteLockedObjectVersions deletes all object versions (and delete markers) of an S3 bucket, bypassing
+// the retention of versions locked in governance mode (which requires the s3:BypassGovernanceRetention permission).
+func (r Resource) deleteLockedObjectVersions(ctx context.Context) error {
+	client := s3.New(r.Options.AWSSession)
+
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(r.ID())}
+
+	for {
+		out, err := client.ListObjectVersionsWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to list object versions: %s", err)
+		}
+
+		var identifiers []*s3.ObjectIdentifier
+
+		for _, v := range out.Versions {
+			identifiers = append(identifiers, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+
+		for _, m := range out.DeleteMarkers {
+			identifiers = append(identifiers, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+
+		if len(identifiers) > 0 {
+			resp, err := client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+				Bucket:                    aws.String(r.ID()),
+				BypassGovernanceRetention: aws.Bool(true),
+				Delete:                    &s3.Delete{Objects: identifiers, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete object versions: %s", err)
+			}
+
+			if len(resp.Errors) > 0 {
+				e := resp.Errors[0]
+
+				return fmt.Errorf("failed to delete %d object version(s) (e.g., %s: %s: %s)", len(resp.Errors),
+					aws.StringValue(e.Key), aws.StringValue(e.Code), aws.StringValue(e.Message))
+			}
+		}
+
+		if !aws.BoolValue(out.IsTruncated) {
+			return nil
+		}
+
+		input.KeyMarker = out.NextKeyMarker
+		input.VersionIdMarker = out.NextVersionIdMarker
+	}
+}
+
+// listAttr returns the elements of a list (or set) attribute of the given object, or nil if the attribute isn't set.
+func listAttr(value cty.Value, name string) []cty.Value {
+	v := objectAttr(value, name)
+	if v.IsNull() || !v.IsWhollyKnown() || !(v.Type().IsListType() || v.Type().IsSetType()) {
+		return nil
+	}
+
+	return v.AsValueSlice()
+}
+
+// objectAttr returns an attribute of the given object, or a null value if the value isn't an object with
+// the attribute.
+func objectAttr(value cty.Value, name string) cty.Value {
+	if value.IsNull() || !value.IsKnown() || !value.Type().IsObjectType() || !value.Type().HasAttribute(name) {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+
+	return value.GetAttr(name)
+}
+
+// containsAny returns true if the given string contains any of the given parts.
+func containsAny(s string, parts []string) bool {
+	for _, part := range parts {
+		if strings.Contains(s, part) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,255 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+//nolint:gochecknoglobals
+var (
+	retentionType  = cty.Object(map[string]cty.Type{"mode": cty.String, "days": cty.Number})
+	ruleType       = cty.Object(map[string]cty.Type{"default_retention": cty.List(retentionType)})
+	lockType       = cty.Object(map[string]cty.Type{"object_lock_enabled": cty.String, "rule": cty.List(ruleType)})
+	versioningType = cty.Object(map[string]cty.Type{"enabled": cty.Bool, "mfa_delete": cty.Bool})
+)
+
+// lockedBucket is a provider of an S3 bucket that can't be destroyed as long as it has object versions, and
+// an S3 API, which lists and deletes the versions only if governance retention is bypassed.
+type lockedBucket struct {
+	*slowProvider
+
+	mu       sync.Mutex
+	versions int
+	// destroys is the number of attempts to destroy the bucket.
+	destroys int
+	// bypassed is the number of DeleteObjects calls with the bypass header.
+	bypassed int
+}
+
+func (b *lockedBucket) GetSchema() providers.GetSchemaResponse {
+	return providers.GetSchemaResponse{
+		Provider: providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{
+			"aws_s3_bucket": {Block: &configschema.Block{
+				Attributes: map[string]*configschema.Attribute{
+					"id":                        {Type: cty.String, Computed: true},
+					"versioning":                {Type: cty.List(versioningType), Optional: true},
+					"object_lock_configuration": {Type: cty.List(lockType), Optional: true},
+				},
+			}},
+		},
+	}
+}
+
+func (b *lockedBucket) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	if !req.PlannedState.IsNull() {
+		return providers.ApplyResourceChangeResponse{NewState: req.PlannedState}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.destroys++
+
+	if b.versions == 0 {
+		return providers.ApplyResourceChangeResponse{NewState: cty.NullVal(cty.DynamicPseudoType)}
+	}
+
+	var diags tfdiags.Diagnostics
+
+	return providers.ApplyResourceChangeResponse{
+		Diagnostics: diags.Append(tfdiags.Sourceless(tfdiags.Error, "error deleting S3 Bucket (test-bucket): "+
+			"BucketNotEmpty: The bucket you tried to delete is not empty. You must delete all versions "+
+			"in the bucket.", "")),
+	}
+}
+
+func (b *lockedBucket) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := req.URL.Query()["versions"]; ok {
+		result := `<ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`
+		for i := 0; i < b.versions; i++ {
+			result += fmt.Sprintf("<Version><Key>object-%d</Key><VersionId>v1</VersionId></Version>", i)
+		}
+
+		_, _ = fmt.Fprint(w, result+"<IsTruncated>false</IsTruncated></ListVersionsResult>")
+
+		return
+	}
+
+	if req.Header.Get("X-Amz-Bypass-Governance-Retention") == "true" {
+		b.bypassed++
+		b.versions = 0
+	}
+
+	_, _ = fmt.Fprint(w, `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></DeleteResult>`)
+}
+
+func TestRun_S3BucketManualAction(t *testing.T) {
+	lockConfig := func(mode string) cty.Value {
+		return cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"object_lock_enabled": cty.StringVal("Enabled"),
+			"rule": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+				"default_retention": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+					"mode": cty.StringVal(mode),
+					"days": cty.NumberIntVal(30),
+				})}),
+			})}),
+		})})
+	}
+
+	versioning := func(mfaDelete bool) cty.Value {
+		return cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"enabled":    cty.True,
+			"mfa_delete": cty.BoolVal(mfaDelete),
+		})})
+	}
+
+	tests := []struct {
+		name                string
+		versioning          cty.Value
+		objectLock          cty.Value
+		bypass              bool
+		expectedDeleted     bool
+		expectedSetting     string
+		expectedRemediation string
+		expectedClass       destroy.ErrorClass
+		expectedDestroys    int
+		expectedBypassed    int
+	}{
+		{
+			name:            "MFA delete",
+			versioning:      versioning(true),
+			objectLock:      cty.ListValEmpty(lockType),
+			expectedSetting: "MFA delete",
+			expectedRemediation: "disable MFA delete of bucket test-bucket with the MFA device of the root account " +
+				"(aws s3api put-bucket-versioning --bucket test-bucket --versioning-configuration " +
+				"Status=Suspended,MFADelete=Disabled --mfa '<serial number> <code>'), then run terradozer again",
+			expectedClass:    destroy.ErrorClassManualActionRequired,
+			expectedDestroys: 1,
+		},
+		{
+			name:            "compliance mode",
+			versioning:      versioning(false),
+			objectLock:      lockConfig("COMPLIANCE"),
+			bypass:          true,
+			expectedSetting: "object lock (compliance mode)",
+			expectedRemediation: "object versions in bucket test-bucket are locked in compliance mode, which can't " +
+				"be bypassed; wait until their retention has expired, then run terradozer again",
+			expectedClass:    destroy.ErrorClassManualActionRequired,
+			expectedDestroys: 1,
+		},
+		{
+			name:            "governance mode",
+			versioning:      versioning(false),
+			objectLock:      lockConfig("GOVERNANCE"),
+			expectedSetting: "object lock (governance mode)",
+			expectedRemediation: "object versions in bucket test-bucket are locked in governance mode; delete them " +
+				"with the s3:BypassGovernanceRetention permission (see -wait-for-object-lock-expiry) or wait until " +
+				"their retention has expired, then run terradozer again",
+			expectedClass:    destroy.ErrorClassManualActionRequired,
+			expectedDestroys: 1,
+		},
+		{
+			name:             "governance mode bypassed",
+			versioning:       versioning(false),
+			objectLock:       lockConfig("GOVERNANCE"),
+			bypass:           true,
+			expectedDeleted:  true,
+			expectedDestroys: 2,
+			expectedBypassed: 1,
+		},
+		{
+			name:             "no protection",
+			versioning:       versioning(false),
+			objectLock:       cty.ListValEmpty(lockType),
+			expectedClass:    destroy.ErrorClassDependencyViolation,
+			expectedDestroys: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &lockedBucket{slowProvider: &slowProvider{}, versions: 2}
+
+			server := httptest.NewServer(b)
+			defer server.Close()
+
+			sess, err := session.NewSession(&aws.Config{
+				Credentials:      credentials.NewStaticCredentials("test", "test", ""),
+				Endpoint:         aws.String(server.URL),
+				Region:           aws.String("us-east-1"),
+				S3ForcePathStyle: aws.Bool(true),
+			})
+			require.NoError(t, err)
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return b, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := cty.ObjectVal(map[string]cty.Value{
+				"id":                        cty.StringVal("test-bucket"),
+				"versioning":                tc.versioning,
+				"object_lock_configuration": tc.objectLock,
+			})
+
+			bucket := destroy.NewWithState("aws_s3_bucket.test", "aws_s3_bucket", "test-bucket", nil, tp, &state)
+			bucket.Options = destroy.Options{S3BypassGovernanceRetention: tc.bypass, AWSSession: sess}
+
+			// other resources are destroyed alongside, so that the bucket is retried if it's worth it
+			vpcs, _ := stubResources(t, provider.StubConfig{}, 21)
+
+			resources := []destroy.DestroyableResource{bucket}
+			for _, vpc := range vpcs {
+				if vpc.Type() == "aws_vpc" {
+					resources = append(resources, vpc)
+				}
+			}
+
+			result := destroy.Run(context.Background(), resources, 1, nil)
+
+			assert.Equal(t, tc.expectedDestroys, b.destroys)
+			assert.Equal(t, tc.expectedBypassed, b.bypassed)
+
+			if tc.expectedDeleted {
+				assert.Empty(t, result.Failed)
+
+				return
+			}
+
+			require.Len(t, result.Failed, 1)
+			assert.Equal(t, tc.expectedClass, result.Failed[0].Class)
+			assert.Equal(t, tc.expectedRemediation, destroy.RemediationOf(result.Failed[0]))
+
+			if tc.expectedSetting != "" {
+				var manualActionErr *destroy.ManualActionError
+				require.ErrorAs(t, result.Failed[0], &manualActionErr)
+				assert.Equal(t, tc.expectedSetting, manualActionErr.Setting)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// removeSecretReplicas removes all replicas of a secret in other regions, which need to be removed
+// before the secret can be deleted without recovery window.
+func (r Resource) removeSecretReplicas(ctx context.Context) (cty.Value, error) {
+	if r.Options.AWSSession == nil {
+		return cty.NilVal, fmt.Errorf("AWS session to remove replicas of secret is not configured")
+	}
+
+	client := secretsmanager.New(r.Options.AWSSession)
+
+	secret, err := client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(r.ID()),
+	})
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("failed to describe secret: %s", err)
+	}
+
+	if len(secret.ReplicationStatus) == 0 {
+		return *r.State(), nil
+	}
+
+	var regions []*string
+
+	for _, replica := range secret.ReplicationStatus {
+		regions = append(regions, replica.Region)
+	}
+
+	_, err = client.RemoveRegionsFromReplicationWithContext(ctx, &secretsmanager.RemoveRegionsFromReplicationInput{
+		SecretId:             aws.String(r.ID()),
+		RemoveReplicaRegions: regions,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to remove replicas of secret: %s", err)
+
+		for _, region := range regions {
+			ReportAuxiliary(ctx, r.newAuxiliaryDeletion(auxiliarySecretReplica, aws.StringValue(region), err))
+		}
+
+		return cty.NilVal, err
+	}
+
+	for _, region := range regions {
+		ReportAuxiliary(ctx, r.newAuxiliaryDeletion(auxiliarySecretReplica, aws.StringValue(region), nil))
+
+		log.WithFields(log.Fields{
+			"id":     r.ID(),
+			"region": aws.StringValue(region),
+		}).Info(internal.Pad("removed replica of secret"))
+	}
+
+	return *r.State(), nil
+}
+
+// secretDestroyAttrs returns the attributes of a secret that need to be changed in the state before calling
+// destroy, so that the secret is deleted without recovery window (if Options.SecretsForceDelete is set).
+func (r Resource) secretDestroyAttrs() map[string]cty.Value {
+	if !r.Options.SecretsForceDelete {
+		return nil
+	}
+
+	return map[string]cty.Value{
+		"recovery_window_in_days":        cty.NumberIntVal(0),
+		"force_overwrite_replica_secret": cty.True,
+	}
+}
+
+// destroySecret destroys a secret. If the secret must be deleted without recovery window, but the provider
+// version doesn't support the recovery_window_in_days attribute, the secret is deleted via the AWS API instead.
+func (r Resource) destroySecret(ctx context.Context, state cty.Value) error {
+	if !r.Options.SecretsForceDelete || state.Type().HasAttribute("recovery_window_in_days") {
+		return r.destroyWithProvider(ctx, state)
+	}
+
+	if r.Options.AWSSession == nil {
+		return fmt.Errorf("AWS session to delete secret is not configured")
+	}
+
+	log.WithField("id", r.ID()).Debug(internal.Pad("deleting secret without recovery via AWS API"))
+
+	_, err := secretsmanager.New(r.Options.AWSSession).DeleteSecretWithContext(ctx, &secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(r.ID()),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	})
+
+	return err
+}
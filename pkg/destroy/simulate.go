@@ -0,0 +1,208 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// SimulationOutcome tells what a simulated delete of a resource has shown (see Simulate).
+type SimulationOutcome string
+
+const (
+	// SimulationWouldSucceed means that the credentials are allowed to delete the resource.
+	SimulationWouldSucceed SimulationOutcome = "would succeed"
+	// SimulationWouldFail means that the simulated delete failed (e.g., due to missing permissions).
+	SimulationWouldFail SimulationOutcome = "would fail"
+	// SimulationNotSupported means that the API to delete resources of the type has no dry run.
+	SimulationNotSupported SimulationOutcome = "not simulated"
+)
+
+// dryRunErrorCode is the error code the EC2 API returns for a dry run of an action that would have succeeded.
+const dryRunErrorCode = "DryRunOperation"
+
+//nolint:gochecknoglobals
+var (
+	// dryRunDeletes lists resource types whose delete API call supports a dry run, which validates
+	// the permissions without deleting anything. The calls must always set DryRun.
+	dryRunDeletes = map[string]func(Resource, context.Context, *ec2.EC2) error{
+		"aws_ami": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeregisterImageWithContext(ctx, &ec2.DeregisterImageInput{
+				DryRun: aws.Bool(true), ImageId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_ebs_snapshot": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteSnapshotWithContext(ctx, &ec2.DeleteSnapshotInput{
+				DryRun: aws.Bool(true), SnapshotId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_ebs_volume": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteVolumeWithContext(ctx, &ec2.DeleteVolumeInput{
+				DryRun: aws.Bool(true), VolumeId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_eip": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{
+				DryRun: aws.Bool(true), AllocationId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_instance": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.TerminateInstancesWithContext(ctx, &ec2.TerminateInstancesInput{
+				DryRun: aws.Bool(true), InstanceIds: aws.StringSlice([]string{r.ID()})})
+
+			return err
+		},
+		"aws_internet_gateway": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteInternetGatewayWithContext(ctx, &ec2.DeleteInternetGatewayInput{
+				DryRun: aws.Bool(true), InternetGatewayId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_key_pair": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteKeyPairWithContext(ctx, &ec2.DeleteKeyPairInput{
+				DryRun: aws.Bool(true), KeyName: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_launch_template": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteLaunchTemplateWithContext(ctx, &ec2.DeleteLaunchTemplateInput{
+				DryRun: aws.Bool(true), LaunchTemplateId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_nat_gateway": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteNatGatewayWithContext(ctx, &ec2.DeleteNatGatewayInput{
+				DryRun: aws.Bool(true), NatGatewayId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_network_acl": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteNetworkAclWithContext(ctx, &ec2.DeleteNetworkAclInput{
+				DryRun: aws.Bool(true), NetworkAclId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_network_interface": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteNetworkInterfaceWithContext(ctx, &ec2.DeleteNetworkInterfaceInput{
+				DryRun: aws.Bool(true), NetworkInterfaceId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_route_table": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteRouteTableWithContext(ctx, &ec2.DeleteRouteTableInput{
+				DryRun: aws.Bool(true), RouteTableId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_security_group": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteSecurityGroupWithContext(ctx, &ec2.DeleteSecurityGroupInput{
+				DryRun: aws.Bool(true), GroupId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_subnet": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteSubnetWithContext(ctx, &ec2.DeleteSubnetInput{
+				DryRun: aws.Bool(true), SubnetId: aws.String(r.ID())})
+
+			return err
+		},
+		// the ID of a volume attachment is made up by the provider, so the attachment is given by its attributes
+		"aws_volume_attachment": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DetachVolumeWithContext(ctx, &ec2.DetachVolumeInput{
+				DryRun:     aws.Bool(true),
+				Device:     aws.String(stateString(r, "device_name")),
+				InstanceId: aws.String(stateString(r, "instance_id")),
+				VolumeId:   aws.String(stateString(r, "volume_id")),
+			})
+
+			return err
+		},
+		"aws_vpc": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteVpcWithContext(ctx, &ec2.DeleteVpcInput{
+				DryRun: aws.Bool(true), VpcId: aws.String(r.ID())})
+
+			return err
+		},
+		"aws_vpc_endpoint": func(r Resource, ctx context.Context, client *ec2.EC2) error {
+			_, err := client.DeleteVpcEndpointsWithContext(ctx, &ec2.DeleteVpcEndpointsInput{
+				DryRun: aws.Bool(true), VpcEndpointIds: aws.StringSlice([]string{r.ID()})})
+
+			return err
+		},
+	}
+)
+
+// Simulation is the result of a simulated delete of a planned resource (see Simulate).
+type Simulation struct {
+	Resource *Resource
+	Outcome  SimulationOutcome
+	// Err is the error of the simulated delete if it would fail.
+	Err *RetryDestroyError
+}
+
+// Simulate calls the delete API of each resource of the given plan with a dry run (if the API supports it;
+// see dryRunDeletes), which validates the permissions of the credentials without deleting anything.
+// The resources are simulated concurrently (limited by the Parallel config of the plan); the simulations are
+// returned in the order of the plan's candidates.
+func Simulate(ctx context.Context, plan *DestroyPlan) []Simulation {
+	simulations := make([]Simulation, len(plan.Candidates))
+
+	parallel := plan.config.Parallel
+	if parallel == 0 {
+		parallel = defaultParallel
+	}
+
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+
+	for i, c := range plan.Candidates {
+		wg.Add(1)
+
+		go func(i int, r *Resource) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			simulations[i] = r.simulateDelete(ctx)
+		}(i, c.Resource)
+	}
+
+	wg.Wait()
+
+	return simulations
+}
+
+// simulateDelete calls the delete API of the resource with a dry run.
+func (r *Resource) simulateDelete(ctx context.Context) Simulation {
+	dryRun, ok := dryRunDeletes[r.Type()]
+	if !ok || r.Options.AWSSession == nil {
+		return Simulation{Resource: r, Outcome: SimulationNotSupported}
+	}
+
+	err := dryRun(*r, ctx, ec2.New(r.Options.AWSSession))
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dryRunErrorCode {
+		return Simulation{Resource: r, Outcome: SimulationWouldSucceed}
+	}
+
+	if err == nil {
+		// can't happen, since every call is a dry run
+		return Simulation{Resource: r, Outcome: SimulationWouldSucceed}
+	}
+
+	return Simulation{
+		Resource: r,
+		Outcome:  SimulationWouldFail,
+		Err:      NewRetryDestroyError(fmt.Errorf("simulated delete failed: %s", err), r),
+	}
+}
@@ -0,0 +1,101 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ec2Error is an error response of the fake EC2 API.
+const ec2Error = `<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors>` +
+	`<RequestID>1234</RequestID></Response>`
+
+func TestSimulate(t *testing.T) {
+	var mu sync.Mutex
+
+	var requests []string
+
+	// deletes of VPCs would succeed, the ones of subnets aren't allowed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+
+		mu.Lock()
+		requests = append(requests, req.Form.Get("Action")+" DryRun="+req.Form.Get("DryRun"))
+		mu.Unlock()
+
+		if req.Form.Get("Action") == "DeleteVpc" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = fmt.Fprintf(w, ec2Error, "DryRunOperation", "Request would have succeeded, but DryRun flag is set.")
+
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, ec2Error, "UnauthorizedOperation", "You are not authorized to perform this operation.")
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	stub := provider.NewStub(provider.StubConfig{}, []string{"aws_vpc", "aws_subnet", "aws_s3_bucket"})
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return stub, nil
+		},
+	})
+	require.NoError(t, err)
+
+	state := fakeState{resources: []*destroy.Resource{
+		destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-1", nil, tp, nil),
+		destroy.NewWithState("aws_subnet.test", "aws_subnet", "subnet-1", nil, tp, nil),
+		destroy.NewWithState("aws_s3_bucket.test", "aws_s3_bucket", "bucket", nil, tp, nil),
+	}}
+
+	plan, err := destroy.Plan(context.Background(), state, nil, destroy.Config{
+		Options: destroy.Options{AWSSession: sess},
+	})
+	require.NoError(t, err)
+
+	actualOutcomes := map[string]destroy.SimulationOutcome{}
+
+	for _, s := range destroy.Simulate(context.Background(), plan) {
+		actualOutcomes[s.Resource.ID()] = s.Outcome
+
+		if s.Outcome != destroy.SimulationWouldFail {
+			assert.Nil(t, s.Err)
+
+			continue
+		}
+
+		require.NotNil(t, s.Err)
+		assert.Equal(t, destroy.ErrorClassPermissionDenied, s.Err.Class)
+	}
+
+	assert.Equal(t, map[string]destroy.SimulationOutcome{
+		"vpc-1":    destroy.SimulationWouldSucceed,
+		"subnet-1": destroy.SimulationWouldFail,
+		"bucket":   destroy.SimulationNotSupported,
+	}, actualOutcomes)
+	assert.ElementsMatch(t, []string{"DeleteVpc DryRun=true", "DeleteSubnet DryRun=true"}, requests)
+	assert.Empty(t, stub.Destroyed())
+}
@@ -0,0 +1,273 @@
+package destroy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// SkipReason is why a resource of a state is not destroyed. Each skipped resource has exactly one reason,
+// which is reported as is (e.g., in the skip_reason field of logs and outputs) and described by Description.
+type SkipReason string
+
+const (
+	// SkipReasonDataSource means that the resource is a data source, which isn't managed by the state.
+	SkipReasonDataSource SkipReason = "data_source"
+	// SkipReasonUnsupportedProvider means that the provider of the resource isn't supported by terradozer.
+	SkipReasonUnsupportedProvider SkipReason = "unsupported_provider"
+	// SkipReasonImportFailed means that the resource couldn't be imported by its ID.
+	SkipReasonImportFailed SkipReason = "import_failed"
+	// SkipReasonReadFailed means that the current state of the resource couldn't be read with the state
+	// recorded in the state file.
+	SkipReasonReadFailed SkipReason = "read_failed"
+	// SkipReasonAlreadyGone means that the resource doesn't exist anymore (see ErrResourceGone).
+	SkipReasonAlreadyGone SkipReason = "already_gone"
+	// SkipReasonDefaultResource means that the resource adopts default infrastructure of the AWS account
+	// (see DefaultResourcesFilter).
+	SkipReasonDefaultResource SkipReason = "default_resource"
+	// SkipReasonProtectedType means that the type of the resource is protected (see ProtectedTypesFilter).
+	SkipReasonProtectedType SkipReason = "protected_type"
+	// SkipReasonNotAllowListed means that only resources of allow-listed types are destroyed, which the type of
+	// the resource isn't (see AllowedTypesFilter).
+	SkipReasonNotAllowListed SkipReason = "not_allow_listed"
+	// SkipReasonExcludedAddress means that the address of the resource is excluded (see ExcludedAddressesFilter).
+	SkipReasonExcludedAddress SkipReason = "excluded_address"
+	// SkipReasonNotIncluded means that patterns of resources to include are given, none of which the resource
+	// matches (see IncludedPatternsFilter).
+	SkipReasonNotIncluded SkipReason = "not_included"
+	// SkipReasonExcludedPattern means that the resource matches a pattern of resources to exclude
+	// (see ExcludedPatternsFilter).
+	SkipReasonExcludedPattern SkipReason = "excluded_pattern"
+	// SkipReasonGlobal means that the resource isn't bound to a region and global resources are excluded
+	// (see GlobalResourcesFilter).
+	SkipReasonGlobal SkipReason = "global"
+	// SkipReasonInNewState means that the resource is still part of the new state it is compared with
+	// (see StateDiff).
+	SkipReasonInNewState SkipReason = "in_new_state"
+	// SkipReasonMoved means that the resource is part of the new state it is compared with at another address,
+	// i.e., it has been moved rather than orphaned (see StateDiff).
+	SkipReasonMoved SkipReason = "moved"
+)
+
+//nolint:gochecknoglobals
+var (
+	// skipReasonDescriptions are the human-readable descriptions of the skip reasons (e.g., to be logged).
+	skipReasonDescriptions = map[SkipReason]string{
+		SkipReasonDataSource:          "data source (not managed by the state)",
+		SkipReasonUnsupportedProvider: "provider is not (yet) supported by terradozer",
+		SkipReasonImportFailed:        "failed to import resource",
+		SkipReasonReadFailed:          "failed to read current state of resource",
+		SkipReasonAlreadyGone:         "resource doesn't exist anymore",
+		SkipReasonDefaultResource: "default infrastructure of the AWS account " +
+			"(destroy with -include-default-resources)",
+		SkipReasonProtectedType:   "protected resource type",
+		SkipReasonNotAllowListed:  "resource type is not allow-listed (see -allow-only-types)",
+		SkipReasonExcludedAddress: "excluded address",
+		SkipReasonNotIncluded:     "doesn't match any pattern of -include",
+		SkipReasonExcludedPattern: "matches a pattern of -exclude",
+		SkipReasonGlobal:          "global resource, not bound to a region (destroy without -exclude-global)",
+		SkipReasonInNewState:      "still part of the new state (see -diff)",
+		SkipReasonMoved:           "moved to another address of the new state, not orphaned (see -diff)",
+	}
+)
+
+// Description returns a human-readable description of the reason. Reasons of custom filters are described
+// by themselves.
+func (r SkipReason) Description() string {
+	if d, ok := skipReasonDescriptions[r]; ok {
+		return d
+	}
+
+	return string(r)
+}
+
+// updateSkipReason returns why a resource is skipped whose state couldn't be updated with the given error.
+func updateSkipReason(r *Resource, err error) SkipReason {
+	switch {
+	case errors.Is(err, ErrResourceGone):
+		return SkipReasonAlreadyGone
+	case r.state != nil:
+		// the state recorded in the state file is read without import (see UpdateState)
+		return SkipReasonReadFailed
+	default:
+		return SkipReasonImportFailed
+	}
+}
+
+//nolint:gochecknoglobals
+var (
+	// defaultResourceTypes lists resource types with which Terraform only adopts the default infrastructure
+	// of an AWS account. Destroying them would delete or reset real default infrastructure, which hasn't been
+	// created by Terraform.
+	defaultResourceTypes = map[string]bool{
+		"aws_default_network_acl":      true,
+		"aws_default_route_table":      true,
+		"aws_default_security_group":   true,
+		"aws_default_subnet":           true,
+		"aws_default_vpc":              true,
+		"aws_default_vpc_dhcp_options": true,
+	}
+)
+
+// DefaultResourcesFilter skips resources with which Terraform only adopts the default infrastructure of
+// an AWS account (aws_default_*, e.g., aws_default_vpc).
+type DefaultResourcesFilter struct{}
+
+// Match implements Filter.
+func (DefaultResourcesFilter) Match(c ResourceCandidate) (bool, SkipReason) {
+	if defaultResourceTypes[c.Type] {
+		return false, SkipReasonDefaultResource
+	}
+
+	return true, ""
+}
+
+// ProtectedTypesFilter skips resources of the given types (e.g., aws_s3_bucket), which are never destroyed.
+type ProtectedTypesFilter []string
+
+// Match implements Filter.
+func (f ProtectedTypesFilter) Match(c ResourceCandidate) (bool, SkipReason) {
+	for _, t := range f {
+		if c.Type == t {
+			return false, SkipReasonProtectedType
+		}
+	}
+
+	return true, ""
+}
+
+// AllowedTypesFilter skips resources of all types except the given ones (e.g., in an account so sensitive
+// that only the types that have been explicitly listed may be destroyed).
+type AllowedTypesFilter []string
+
+// Match implements Filter.
+func (f AllowedTypesFilter) Match(c ResourceCandidate) (bool, SkipReason) {
+	for _, t := range f {
+		if c.Type == t {
+			return true, ""
+		}
+	}
+
+	return false, SkipReasonNotAllowListed
+}
+
+// ExcludedAddressesFilter skips resources with the given absolute addresses (e.g., module.vpc.aws_vpc.shared),
+// which must be canonical (see CanonicalAddress) to match the addresses of the state.
+type ExcludedAddressesFilter []string
+
+// Match implements Filter.
+func (f ExcludedAddressesFilter) Match(c ResourceCandidate) (bool, SkipReason) {
+	for _, address := range f {
+		if c.Address == address {
+			return false, SkipReasonExcludedAddress
+		}
+	}
+
+	return true, ""
+}
+
+// IncludedPatternsFilter skips all resources except the ones matching one of the given patterns (see MatchResource),
+// e.g., to only destroy the resources of some types or of a module.
+type IncludedPatternsFilter []string
+
+// Match implements Filter.
+func (f IncludedPatternsFilter) Match(c ResourceCandidate) (bool, SkipReason) {
+	if MatchResource(f, c) {
+		return true, ""
+	}
+
+	return false, SkipReasonNotIncluded
+}
+
+// ExcludedPatternsFilter skips resources matching one of the given patterns (see MatchResource).
+type ExcludedPatternsFilter []string
+
+// Match implements Filter.
+func (f ExcludedPatternsFilter) Match(c ResourceCandidate) (bool, SkipReason) {
+	if MatchResource(f, c) {
+		return false, SkipReasonExcludedPattern
+	}
+
+	return true, ""
+}
+
+// MatchResource returns true if the type, the absolute address, or one of the module instances of the address of
+// the given resource matches one of the given patterns, which can contain wildcards (see MatchAddresses).
+// For example, aws_instance matches all instances, aws_ebs_volume.data* all volumes named data..., and
+// module.staging all resources of this module instance (including the ones of its sub-modules).
+func MatchResource(patterns []string, c ResourceCandidate) bool {
+	if MatchAddresses(patterns, c.Type) || MatchAddresses(patterns, c.Address) {
+		return true
+	}
+
+	addr, diags := addrs.ParseAbsResourceInstanceStr(c.Address)
+	if diags.HasErrors() {
+		return false
+	}
+
+	for i := range addr.Module {
+		if MatchAddresses(patterns, addr.Module[:i+1].String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnmatchedPatterns returns the given patterns that match none of the given resources (see MatchResource).
+func UnmatchedPatterns(patterns []string, candidates []ResourceCandidate) []string {
+	var result []string
+
+	for _, pattern := range patterns {
+		matched := false
+
+		for _, c := range candidates {
+			if MatchResource([]string{pattern}, c) {
+				matched = true
+
+				break
+			}
+		}
+
+		if !matched {
+			result = append(result, pattern)
+		}
+	}
+
+	return result
+}
+
+// CanonicalAddress returns the absolute address of a resource instance as it is rendered for the resources
+// of a state, so that addresses can be compared regardless of how their instance keys are escaped
+// (e.g., aws_s3_object.file["caf\u00e9"] is aws_s3_object.file["café"]). An address without an instance key
+// is the address of a resource without count or for_each (i.e., it doesn't match keyed instances).
+func CanonicalAddress(address string) (string, error) {
+	addr, diags := addrs.ParseAbsResourceInstanceStr(address)
+	if diags.HasErrors() {
+		return "", fmt.Errorf("invalid address of resource instance: %s", address)
+	}
+
+	return addr.String(), nil
+}
+
+// CanonicalPattern returns the given pattern of MatchResource without wildcards as it is rendered for
+// the resources of a state: a type of resources as is, and the address of a resource instance or of a module
+// instance canonical (see CanonicalAddress).
+func CanonicalPattern(pattern string) (string, error) {
+	if hclsyntax.ValidIdentifier(pattern) {
+		return pattern, nil
+	}
+
+	if addr, diags := addrs.ParseAbsResourceInstanceStr(pattern); !diags.HasErrors() {
+		return addr.String(), nil
+	}
+
+	if addr, diags := addrs.ParseModuleInstanceStr(pattern); !diags.HasErrors() {
+		return addr.String(), nil
+	}
+
+	return "", fmt.Errorf("invalid pattern (expected a resource type or the address of a resource or "+
+		"module instance): %s", pattern)
+}
@@ -0,0 +1,390 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDefaultResourcesFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		terraformType string
+		expectSkip    bool
+	}{
+		{
+			name:          "default resource",
+			terraformType: "aws_default_vpc",
+			expectSkip:    true,
+		},
+		{
+			name:          "non-default resource",
+			terraformType: "aws_vpc",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualMatch, actualReason := destroy.DefaultResourcesFilter{}.Match(
+				destroy.ResourceCandidate{Type: tc.terraformType})
+
+			if tc.expectSkip {
+				assert.False(t, actualMatch)
+				assert.Equal(t, destroy.SkipReasonDefaultResource, actualReason)
+			} else {
+				assert.True(t, actualMatch)
+				assert.Empty(t, actualReason)
+			}
+		})
+	}
+}
+
+func TestProtectedTypesAndExcludedAddressesFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		filter         destroy.Filter
+		candidate      destroy.ResourceCandidate
+		expectedReason destroy.SkipReason
+	}{
+		{
+			name:           "protected type",
+			filter:         destroy.ProtectedTypesFilter{"aws_s3_bucket", "aws_kms_key"},
+			candidate:      destroy.ResourceCandidate{Address: "aws_kms_key.test", Type: "aws_kms_key"},
+			expectedReason: destroy.SkipReasonProtectedType,
+		},
+		{
+			name:      "unprotected type",
+			filter:    destroy.ProtectedTypesFilter{"aws_s3_bucket"},
+			candidate: destroy.ResourceCandidate{Address: "aws_vpc.test", Type: "aws_vpc"},
+		},
+		{
+			name:           "excluded address",
+			filter:         destroy.ExcludedAddressesFilter{"module.vpc.aws_vpc.shared"},
+			candidate:      destroy.ResourceCandidate{Address: "module.vpc.aws_vpc.shared", Type: "aws_vpc"},
+			expectedReason: destroy.SkipReasonExcludedAddress,
+		},
+		{
+			name:      "address without instance key doesn't exclude keyed instances",
+			filter:    destroy.ExcludedAddressesFilter{"aws_instance.web"},
+			candidate: destroy.ResourceCandidate{Address: "aws_instance.web[0]", Type: "aws_instance"},
+		},
+		{
+			name:           "excluded address with unusual string key",
+			filter:         destroy.ExcludedAddressesFilter{`aws_s3_bucket_object.file["a/b:c, d"]`},
+			candidate:      destroy.ResourceCandidate{Address: `aws_s3_bucket_object.file["a/b:c, d"]`},
+			expectedReason: destroy.SkipReasonExcludedAddress,
+		},
+		{
+			name:      "not excluded address",
+			filter:    destroy.ExcludedAddressesFilter{"module.vpc.aws_vpc.shared"},
+			candidate: destroy.ResourceCandidate{Address: "aws_vpc.shared", Type: "aws_vpc"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualMatch, actualReason := tc.filter.Match(tc.candidate)
+
+			assert.Equal(t, tc.expectedReason == "", actualMatch)
+			assert.Equal(t, tc.expectedReason, actualReason)
+		})
+	}
+}
+
+func TestIncludedAndExcludedPatternsFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		filter         destroy.Filter
+		candidate      destroy.ResourceCandidate
+		expectedReason destroy.SkipReason
+	}{
+		{
+			name:      "included type",
+			filter:    destroy.IncludedPatternsFilter{"aws_instance"},
+			candidate: destroy.ResourceCandidate{Address: "module.app.aws_instance.web[0]", Type: "aws_instance"},
+		},
+		{
+			name:      "included address with wildcard",
+			filter:    destroy.IncludedPatternsFilter{"aws_ebs_volume.data*"},
+			candidate: destroy.ResourceCandidate{Address: "aws_ebs_volume.data_logs", Type: "aws_ebs_volume"},
+		},
+		{
+			name:      "included module",
+			filter:    destroy.IncludedPatternsFilter{"module.staging"},
+			candidate: destroy.ResourceCandidate{Address: "module.staging.module.vpc.aws_vpc.main", Type: "aws_vpc"},
+		},
+		{
+			name:      "included module instance",
+			filter:    destroy.IncludedPatternsFilter{`module.env["dev"]`},
+			candidate: destroy.ResourceCandidate{Address: `module.env["dev"].aws_vpc.main`, Type: "aws_vpc"},
+		},
+		{
+			name:           "module name isn't a prefix of other modules",
+			filter:         destroy.IncludedPatternsFilter{"module.staging"},
+			candidate:      destroy.ResourceCandidate{Address: "module.staging2.aws_vpc.main", Type: "aws_vpc"},
+			expectedReason: destroy.SkipReasonNotIncluded,
+		},
+		{
+			name:           "not included",
+			filter:         destroy.IncludedPatternsFilter{"aws_instance", "module.staging"},
+			candidate:      destroy.ResourceCandidate{Address: "aws_vpc.main", Type: "aws_vpc"},
+			expectedReason: destroy.SkipReasonNotIncluded,
+		},
+		{
+			name:           "excluded type with wildcard",
+			filter:         destroy.ExcludedPatternsFilter{"aws_iam_*"},
+			candidate:      destroy.ResourceCandidate{Address: "aws_iam_role.test", Type: "aws_iam_role"},
+			expectedReason: destroy.SkipReasonExcludedPattern,
+		},
+		{
+			name:      "not excluded",
+			filter:    destroy.ExcludedPatternsFilter{"aws_iam_*"},
+			candidate: destroy.ResourceCandidate{Address: "aws_vpc.main", Type: "aws_vpc"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualMatch, actualReason := tc.filter.Match(tc.candidate)
+
+			assert.Equal(t, tc.expectedReason == "", actualMatch)
+			assert.Equal(t, tc.expectedReason, actualReason)
+		})
+	}
+}
+
+func TestFilters_IncludeMinusExclude(t *testing.T) {
+	candidates := []destroy.ResourceCandidate{
+		{Address: "module.staging.aws_instance.web", Type: "aws_instance"},
+		{Address: "module.staging.aws_iam_role.web", Type: "aws_iam_role"},
+		{Address: "aws_instance.prod", Type: "aws_instance"},
+	}
+
+	filter := destroy.Filters{
+		destroy.IncludedPatternsFilter{"module.staging"},
+		destroy.ExcludedPatternsFilter{"aws_iam_*"},
+	}
+
+	var actual []string
+
+	for _, c := range candidates {
+		if match, _ := filter.Match(c); match {
+			actual = append(actual, c.Address)
+		}
+	}
+
+	assert.Equal(t, []string{"module.staging.aws_instance.web"}, actual)
+}
+
+func TestUnmatchedPatterns(t *testing.T) {
+	candidates := []destroy.ResourceCandidate{
+		{Address: "module.staging.aws_instance.web", Type: "aws_instance"},
+		{Address: "aws_vpc.main", Type: "aws_vpc"},
+	}
+
+	assert.Equal(t, []string{"aws_instnace", "module.prod"},
+		destroy.UnmatchedPatterns([]string{"aws_instnace", "module.staging", "module.prod", "aws_vpc.*"}, candidates))
+	assert.Empty(t, destroy.UnmatchedPatterns([]string{"aws_instance"}, candidates))
+}
+
+func TestCanonicalAddress(t *testing.T) {
+	tests := []struct {
+		name              string
+		address           string
+		expectedCanonical string
+		expectedErrMsg    string
+	}{
+		{
+			name:              "without instance key",
+			address:           "aws_instance.web",
+			expectedCanonical: "aws_instance.web",
+		},
+		{
+			name:              "count index",
+			address:           "aws_instance.web[10]",
+			expectedCanonical: "aws_instance.web[10]",
+		},
+		{
+			name:              "string key with slashes and colons",
+			address:           `aws_s3_bucket_object.file["arn:aws:s3:::bucket/a/b"]`,
+			expectedCanonical: `aws_s3_bucket_object.file["arn:aws:s3:::bucket/a/b"]`,
+		},
+		{
+			name:              "unicode escapes",
+			address:           `aws_s3_bucket_object.file["caf\u00e9 \u2615"]`,
+			expectedCanonical: `aws_s3_bucket_object.file["café ☕"]`,
+		},
+		{
+			name:              "escaped quotes and backslash",
+			address:           `aws_s3_bucket_object.file["say \"hi\"\\"]`,
+			expectedCanonical: `aws_s3_bucket_object.file["say \"hi\"\\"]`,
+		},
+		{
+			name:              "keyed module instance",
+			address:           `module.site["eu/west:1"].aws_vpc.this`,
+			expectedCanonical: `module.site["eu/west:1"].aws_vpc.this`,
+		},
+		{
+			name:           "unterminated key",
+			address:        `aws_s3_bucket_object.file["a`,
+			expectedErrMsg: `invalid address of resource instance: aws_s3_bucket_object.file["a`,
+		},
+		{
+			name:           "not an address",
+			address:        "vpc-1234",
+			expectedErrMsg: "invalid address of resource instance: vpc-1234",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualCanonical, err := destroy.CanonicalAddress(tc.address)
+
+			if tc.expectedErrMsg != "" {
+				assert.EqualError(t, err, tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCanonical, actualCanonical)
+		})
+	}
+}
+
+func TestRequiredFlag(t *testing.T) {
+	assert.NotEmpty(t, destroy.RequiredFlag("aws_route53_zone", destroy.Options{}))
+	assert.Empty(t, destroy.RequiredFlag("aws_route53_zone", destroy.Options{Route53EmptyZones: true}))
+	assert.Empty(t, destroy.RequiredFlag("aws_vpc", destroy.Options{}))
+}
+
+// brokenStub is a provider stub that fails to import and read the resources whose IDs start with "broken-".
+type brokenStub struct {
+	*provider.Stub
+}
+
+func (s brokenStub) ImportResourceState(
+	req providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	if strings.HasPrefix(req.ID, "broken-") {
+		return providers.ImportResourceStateResponse{Diagnostics: s.broken()}
+	}
+
+	return s.Stub.ImportResourceState(req)
+}
+
+func (s brokenStub) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	if strings.HasPrefix(req.PriorState.GetAttr("id").AsString(), "broken-") {
+		return providers.ReadResourceResponse{Diagnostics: s.broken()}
+	}
+
+	return s.Stub.ReadResource(req)
+}
+
+func (s brokenStub) broken() tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	return diags.Append(fmt.Errorf("AccessDenied: not authorized"))
+}
+
+func TestPlan_SkipReasons(t *testing.T) {
+	tests := []struct {
+		name    string
+		execute func(state destroy.ResourceLister, config destroy.Config) *destroy.DestroyPlan
+	}{
+		{
+			name: "plan",
+			execute: func(state destroy.ResourceLister, config destroy.Config) *destroy.DestroyPlan {
+				plan, err := destroy.Plan(context.Background(), state, destroy.DefaultResourcesFilter{}, config)
+				require.NoError(t, err)
+
+				return plan
+			},
+		},
+		{
+			name: "forced",
+			execute: func(state destroy.ResourceLister, config destroy.Config) *destroy.DestroyPlan {
+				plan, _, err := destroy.PlanAndExecute(context.Background(), state, destroy.DefaultResourcesFilter{},
+					config)
+				require.NoError(t, err)
+
+				return plan
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_default_vpc", "aws_vpc"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return brokenStub{stub}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			goneState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-gone")})
+			brokenState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("broken-2")})
+
+			stub.ApplyResourceChange(providers.ApplyResourceChangeRequest{TypeName: "aws_vpc", PriorState: goneState,
+				PlannedState: cty.NullVal(goneState.Type())})
+
+			state := fakeState{resources: []*destroy.Resource{
+				destroy.NewWithState("aws_default_vpc.default", "aws_default_vpc", "vpc-default", nil, tp, nil),
+				destroy.NewWithState("aws_vpc.gone", "aws_vpc", "vpc-gone", nil, tp, nil),
+				destroy.NewWithState("aws_vpc.not_imported", "aws_vpc", "broken-1", nil, tp, nil),
+				destroy.NewWithState("aws_vpc.not_read", "aws_vpc", "broken-2", nil, tp, &brokenState),
+				destroy.NewWithState("aws_vpc.test", "aws_vpc", "vpc-1", nil, tp, nil),
+			}}
+
+			config := destroy.Config{Skipped: []destroy.SkippedResource{{
+				Resource: destroy.NewWithState("random_integer.test", "random_integer", "1", nil, nil, nil),
+				Reason:   destroy.SkipReasonUnsupportedProvider,
+			}}}
+
+			actualPlan := tc.execute(state, config)
+
+			require.Len(t, actualPlan.Candidates, 1)
+			assert.Equal(t, "aws_vpc.test", actualPlan.Candidates[0].Address)
+
+			// each resource that is not destroyed has exactly one reason
+			actualReasons := map[string]destroy.SkipReason{}
+
+			for _, s := range actualPlan.Skipped {
+				actualReasons[s.Resource.Address()] = s.Reason
+			}
+
+			for _, e := range append(actualPlan.Gone, actualPlan.AlreadyGone...) {
+				actualReasons[e.Address] = e.SkipReason
+			}
+
+			assert.Equal(t, map[string]destroy.SkipReason{
+				"random_integer.test":     destroy.SkipReasonUnsupportedProvider,
+				"aws_default_vpc.default": destroy.SkipReasonDefaultResource,
+				"aws_vpc.gone":            destroy.SkipReasonAlreadyGone,
+				"aws_vpc.not_imported":    destroy.SkipReasonImportFailed,
+				"aws_vpc.not_read":        destroy.SkipReasonReadFailed,
+			}, actualReasons)
+
+			assert.Equal(t, map[destroy.SkipReason]int{
+				destroy.SkipReasonUnsupportedProvider: 1,
+				destroy.SkipReasonDefaultResource:     1,
+				destroy.SkipReasonAlreadyGone:         1,
+				destroy.SkipReasonImportFailed:        1,
+				destroy.SkipReasonReadFailed:          1,
+			}, actualPlan.SkipReasons())
+		})
+	}
+}
+
+func TestSkipReason_Description(t *testing.T) {
+	assert.Equal(t, "protected resource type", destroy.SkipReasonProtectedType.Description())
+	assert.Equal(t, "tagged_protected", destroy.SkipReason("tagged_protected").Description(),
+		"reasons of custom filters must be described by themselves")
+}
@@ -0,0 +1,143 @@
+package destroy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// defaultUpdateStepTimeout is the amount of time an attempt of an update step may take by default.
+	defaultUpdateStepTimeout = 10 * time.Minute
+
+	// defaultUpdateStepRetryDelay is the amount of time to wait before a failed update step is retried by default.
+	defaultUpdateStepRetryDelay = 10 * time.Second
+)
+
+// UpdateStep is an intermediate update of a resource before it can be destroyed, i.e., a change of some of its
+// attributes applied via the provider (e.g., removing the default retention of an S3 bucket with object lock).
+type UpdateStep struct {
+	Name string
+	// Attrs returns the attributes to change, or nil if the step isn't needed (e.g., since it has been done before).
+	Attrs func(r Resource) map[string]cty.Value
+	// Timeout is the amount of time each attempt of the update may take (defaults to 10 minutes if zero).
+	Timeout time.Duration
+	// Retries is the number of times a failed update is retried, if it is worth retrying (see ErrorClass.Retryable).
+	Retries int
+	// RetryDelay is the amount of time to wait before an update is retried (defaults to 10 seconds if zero).
+	RetryDelay time.Duration
+}
+
+// UpdateSteps is a TypeHandler that applies the given updates to a resource one after another before
+// the resource is destroyed. Steps whose attributes are nil are skipped. A failed update fails the resource
+// with a StepError naming the update (see StepError.SubStep).
+type UpdateSteps struct {
+	Step  string
+	Steps []UpdateStep
+	// Enabled returns if the handler is enabled by the given options. If nil, the handler is always enabled.
+	Enabled func(Options) bool
+}
+
+// Name implements TypeHandler.
+func (h UpdateSteps) Name() string {
+	return h.Step
+}
+
+// Applies implements TypeHandler.
+func (h UpdateSteps) Applies(r Resource) bool {
+	return h.Enabled == nil || h.Enabled(r.Options)
+}
+
+// Describe implements TypeHandler; lists the updates that are needed for the resource in the order they are applied.
+func (h UpdateSteps) Describe(r Resource) string {
+	var names []string
+
+	for _, s := range h.Steps {
+		if s.Attrs(r) != nil {
+			names = append(names, s.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	return strings.Join(append(names, "delete"), ", ")
+}
+
+// PreDelete implements TypeHandler.
+func (h UpdateSteps) PreDelete(ctx context.Context, r Resource) (cty.Value, error) {
+	for _, s := range h.Steps {
+		attrs := s.Attrs(r)
+		if attrs == nil {
+			continue
+		}
+
+		log.WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).Info(internal.Pad(s.Name))
+
+		span := startSpan(ctx, r, "prepare: "+h.Step+": "+s.Name)
+		state, err := s.apply(ctx, r, attrs)
+		span.End(err)
+
+		if err != nil {
+			return cty.NilVal, &StepError{Step: h.Step, SubStep: s.Name, Err: err}
+		}
+
+		r.setState(state)
+	}
+
+	return *r.State(), nil
+}
+
+// PostDelete implements TypeHandler.
+func (h UpdateSteps) PostDelete(context.Context, Resource) error {
+	return nil
+}
+
+// apply applies the update to the resource, retrying it if it fails and is worth retrying.
+func (s UpdateStep) apply(ctx context.Context, r Resource, attrs map[string]cty.Value) (cty.Value, error) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultUpdateStepTimeout
+	}
+
+	retryDelay := s.RetryDelay
+	if retryDelay == 0 {
+		retryDelay = defaultUpdateStepRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		state, err := r.update(ctx, attrs, timeout)
+		if err == nil {
+			return state, nil
+		}
+
+		if attempt >= s.Retries || !Classify(err).Retryable() || ctx.Err() != nil {
+			return cty.NilVal, err
+		}
+
+		log.WithError(err).WithFields(log.Fields{"id": r.ID(), "type": r.Type(), "step": s.Name}).
+			Info(internal.Pad("will retry step"))
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return cty.NilVal, ctx.Err()
+		}
+	}
+}
+
+// asStepError returns the given error of a step of the given handler as StepError (unless it is one already).
+func asStepError(h TypeHandler, err error) error {
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return err
+	}
+
+	return &StepError{Step: h.Name(), Err: err}
+}
@@ -0,0 +1,366 @@
+package destroy_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// updatingStub is a provider stub that records the planned states of updates and fails the first updates
+// with the given error.
+type updatingStub struct {
+	*provider.Stub
+
+	updates   *[]cty.Value
+	failures  int
+	failedErr string
+}
+
+func (s updatingStub) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	if req.PlannedState.IsNull() {
+		return s.Stub.ApplyResourceChange(req)
+	}
+
+	*s.updates = append(*s.updates, req.PlannedState)
+
+	if len(*s.updates) <= s.failures {
+		var diags tfdiags.Diagnostics
+
+		return providers.ApplyResourceChangeResponse{
+			Diagnostics: diags.Append(tfdiags.Sourceless(tfdiags.Error, s.failedErr, "")),
+		}
+	}
+
+	return s.Stub.ApplyResourceChange(req)
+}
+
+// attrStep returns an update step that sets an attribute to the given value, unless it is set already.
+func attrStep(name, attr, value string) destroy.UpdateStep {
+	return destroy.UpdateStep{
+		Name: name,
+		Attrs: func(r destroy.Resource) map[string]cty.Value {
+			if r.State().GetAttr(attr).AsString() == value {
+				return nil
+			}
+
+			return map[string]cty.Value{attr: cty.StringVal(value)}
+		},
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	}
+}
+
+func TestUpdateSteps(t *testing.T) {
+	tests := []struct {
+		name                string
+		terraformType       string
+		retention           string
+		lock                string
+		failures            int
+		failedErr           string
+		expectedDescription string
+		expectedUpdates     []string
+		expectedDeleted     []string
+		expectedFailed      []string
+	}{
+		{
+			name:                "all steps",
+			terraformType:       "aws_stepped_all",
+			retention:           "governance",
+			lock:                "locked",
+			expectedDescription: "remove retention, unlock, delete",
+			expectedUpdates:     []string{"none/locked", "none/unlocked"},
+			expectedDeleted:     []string{"aws_stepped_all.test"},
+		},
+		{
+			name:                "step not needed",
+			terraformType:       "aws_stepped_skipped",
+			retention:           "none",
+			lock:                "locked",
+			expectedDescription: "unlock, delete",
+			expectedUpdates:     []string{"none/unlocked"},
+			expectedDeleted:     []string{"aws_stepped_skipped.test"},
+		},
+		{
+			name:                "no step needed",
+			terraformType:       "aws_stepped_none",
+			retention:           "none",
+			lock:                "unlocked",
+			expectedDescription: "",
+			expectedDeleted:     []string{"aws_stepped_none.test"},
+		},
+		{
+			name:                "step retried",
+			terraformType:       "aws_stepped_retried",
+			retention:           "governance",
+			lock:                "locked",
+			failures:            1,
+			failedErr:           "OperationAborted: conflicting operation",
+			expectedDescription: "remove retention, unlock, delete",
+			expectedUpdates:     []string{"none/locked", "none/locked", "none/unlocked"},
+			expectedDeleted:     []string{"aws_stepped_retried.test"},
+		},
+		{
+			name:                "step failed",
+			terraformType:       "aws_stepped_failed",
+			retention:           "governance",
+			lock:                "locked",
+			failures:            1,
+			failedErr:           "AccessDenied: not allowed",
+			expectedDescription: "remove retention, unlock, delete",
+			expectedUpdates:     []string{"none/locked"},
+			expectedFailed: []string{"aws_stepped_failed.test (retryable=false): " +
+				"prepare step (remove retention) failed (before destroy): AccessDenied: not allowed"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			destroy.RegisterTypeHandler(tc.terraformType, destroy.UpdateSteps{
+				Step: "prepare",
+				Steps: []destroy.UpdateStep{attrStep("remove retention", "retention", "none"),
+					attrStep("unlock", "lock", "unlocked")},
+			})
+
+			var updates []cty.Value
+
+			stub := provider.NewStub(provider.StubConfig{}, []string{tc.terraformType})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return updatingStub{Stub: stub, updates: &updates, failures: tc.failures,
+						failedErr: tc.failedErr}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := cty.ObjectVal(map[string]cty.Value{
+				"id":        cty.StringVal("id-1"),
+				"retention": cty.StringVal(tc.retention),
+				"lock":      cty.StringVal(tc.lock),
+			})
+
+			r := destroy.NewWithState(tc.terraformType+".test", tc.terraformType, "id-1", nil, tp, &state)
+
+			if tc.expectedDescription == "" {
+				assert.NotContains(t, r.Preview(context.Background()), "note")
+			} else {
+				assert.Equal(t, tc.expectedDescription, r.Preview(context.Background())["note"])
+			}
+
+			events := &recordedEvents{}
+
+			destroy.Run(context.Background(), []destroy.DestroyableResource{r}, 1, events)
+
+			var actualUpdates []string
+
+			for _, u := range updates {
+				actualUpdates = append(actualUpdates, u.GetAttr("retention").AsString()+"/"+u.GetAttr("lock").AsString())
+			}
+
+			assert.Equal(t, tc.expectedUpdates, actualUpdates)
+			assert.Equal(t, tc.expectedDeleted, events.deleted)
+			assert.Equal(t, tc.expectedFailed, events.failed)
+		})
+	}
+}
+
+func TestUpdateSteps_S3ObjectLockRule(t *testing.T) {
+	retention := cty.ObjectVal(map[string]cty.Value{
+		"mode": cty.StringVal("COMPLIANCE"),
+		"days": cty.NumberIntVal(1),
+	})
+
+	lockConfig := func(rules ...cty.Value) cty.Value {
+		rule := cty.ListValEmpty(cty.Object(map[string]cty.Type{"default_retention": cty.List(retention.Type())}))
+		if len(rules) > 0 {
+			rule = cty.ListVal(rules)
+		}
+
+		return cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"object_lock_enabled": cty.StringVal("Enabled"),
+			"rule":                rule,
+		})})
+	}
+
+	tests := []struct {
+		name                string
+		objectLock          cty.Value
+		expectedDescription string
+		expectedUpdates     []cty.Value
+	}{
+		{
+			name: "default retention",
+			objectLock: lockConfig(cty.ObjectVal(map[string]cty.Value{
+				"default_retention": cty.ListVal([]cty.Value{retention}),
+			})),
+			expectedDescription: "remove object lock rule, delete",
+			expectedUpdates:     []cty.Value{lockConfig()},
+		},
+		{
+			name:       "no rule",
+			objectLock: lockConfig(),
+		},
+		{
+			name:       "no object lock",
+			objectLock: cty.ListValEmpty(lockConfig().Type().ElementType()),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var updates []cty.Value
+
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_s3_bucket"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return updatingStub{Stub: stub, updates: &updates}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := cty.ObjectVal(map[string]cty.Value{
+				"id":                        cty.StringVal("bucket-1"),
+				"object_lock_configuration": tc.objectLock,
+			})
+
+			r := destroy.NewWithState("aws_s3_bucket.test", "aws_s3_bucket", "bucket-1", nil, tp, &state)
+
+			if tc.expectedDescription == "" {
+				assert.NotContains(t, r.Preview(context.Background()), "note")
+			} else {
+				assert.Equal(t, tc.expectedDescription, r.Preview(context.Background())["note"])
+			}
+
+			events := &recordedEvents{}
+
+			destroy.Run(context.Background(), []destroy.DestroyableResource{r}, 1, events)
+
+			require.Len(t, updates, len(tc.expectedUpdates))
+
+			for i, u := range updates {
+				assert.True(t, tc.expectedUpdates[i].RawEquals(u.GetAttr("object_lock_configuration")),
+					u.GetAttr("object_lock_configuration").GoString())
+			}
+
+			assert.Equal(t, []string{"aws_s3_bucket.test"}, events.deleted)
+		})
+	}
+}
+
+// planningStub is a provider stub that plans updates like a provider plugin, i.e., the etag of a resource changes
+// with an update and timeouts are passed as private data, and records the requests to apply them.
+type planningStub struct {
+	*provider.Stub
+
+	replace bool
+	applied *[]providers.ApplyResourceChangeRequest
+}
+
+func (s planningStub) PlanResourceChange(req providers.PlanResourceChangeRequest) providers.PlanResourceChangeResponse {
+	planned := req.ProposedNewState.AsValueMap()
+	planned["etag"] = cty.UnknownVal(cty.String)
+
+	response := providers.PlanResourceChangeResponse{
+		PlannedState:   cty.ObjectVal(planned),
+		PlannedPrivate: []byte(`{"e2bfb730-ecaa-11e6-8f88-34363bc7c4c0":{"update":600000000000}}`),
+	}
+
+	if s.replace {
+		response.RequiresReplace = []cty.Path{cty.GetAttrPath("name")}
+	}
+
+	return response
+}
+
+func (s planningStub) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	if req.PlannedState.IsNull() {
+		return s.Stub.ApplyResourceChange(req)
+	}
+
+	*s.applied = append(*s.applied, req)
+
+	newState := req.PlannedState.AsValueMap()
+	newState["etag"] = cty.StringVal("etag-2")
+
+	return providers.ApplyResourceChangeResponse{NewState: cty.ObjectVal(newState)}
+}
+
+func TestResource_Update_Planned(t *testing.T) {
+	loadBalancer := func(deletionProtection bool, etag cty.Value) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"id":                         cty.StringVal("lb-1"),
+			"enable_deletion_protection": cty.BoolVal(deletionProtection),
+			"etag":                       etag,
+		})
+	}
+
+	tests := []struct {
+		name           string
+		replace        bool
+		expectedErrMsg string
+	}{
+		{
+			name: "planned",
+		},
+		{
+			name:           "update would replace resource",
+			replace:        true,
+			expectedErrMsg: "update would replace the resource (due to name)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var applied []providers.ApplyResourceChangeRequest
+
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_lb"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return planningStub{Stub: stub, replace: tc.replace, applied: &applied}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := loadBalancer(true, cty.StringVal("etag-1"))
+
+			r := destroy.NewWithState("aws_lb.test", "aws_lb", "lb-1", nil, tp, &state)
+
+			result := destroy.Run(context.Background(), []destroy.DestroyableResource{r}, 1, nil)
+
+			if tc.expectedErrMsg != "" {
+				require.Len(t, result.Failed, 1)
+				assert.Contains(t, result.Failed[0].Err.Error(), tc.expectedErrMsg)
+				assert.Empty(t, applied)
+				assert.Empty(t, stub.Destroyed())
+
+				return
+			}
+
+			require.Empty(t, result.Failed)
+			require.Len(t, applied, 1)
+
+			// the configuration is the state with the changed attributes, of which the provider has planned
+			// the attributes changing with the update
+			assert.Equal(t, loadBalancer(false, cty.StringVal("etag-1")), applied[0].Config)
+			assert.Equal(t, loadBalancer(false, cty.UnknownVal(cty.String)), applied[0].PlannedState)
+			assert.Contains(t, string(applied[0].PlannedPrivate), "update")
+			assert.Equal(t, []string{"aws_lb.lb-1"}, stub.Destroyed())
+		})
+	}
+}
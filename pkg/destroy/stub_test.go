@@ -0,0 +1,125 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// stubResources returns a synthetic state of the given number of resources managed by a provider stub:
+// one VPC per ten resources and subnets that depend on their VPC.
+func stubResources(t testing.TB, config provider.StubConfig, n int) ([]*destroy.Resource, *provider.Stub) {
+	stub := provider.NewStub(config, []string{"aws_vpc", "aws_subnet"})
+
+	tp, err := provider.Init(context.Background(), "aws", provider.Config{
+		Timeout: time.Minute,
+		Factory: func(string, string) (provider.Provider, error) {
+			return stub, nil
+		},
+	})
+	require.NoError(t, err)
+
+	var resources []*destroy.Resource
+
+	for i := 0; i < n; i++ {
+		vpc := fmt.Sprintf("aws_vpc.test[%d]", i/10)
+
+		rType, address, id, dependencies := "aws_subnet", fmt.Sprintf("aws_subnet.test[%d]", i),
+			fmt.Sprintf("subnet-%d", i), []string{vpc}
+
+		if i%10 == 0 {
+			rType, address, id, dependencies = "aws_vpc", vpc, fmt.Sprintf("vpc-%d", i/10), nil
+		}
+
+		state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(id)})
+
+		resources = append(resources, destroy.NewWithState(address, rType, id, dependencies, tp, &state))
+	}
+
+	return resources, stub
+}
+
+func TestPlanAndExecute_ProviderStub(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   provider.StubConfig
+		parallel int
+		// checkOrder is false if resources fail, as the dependencies of a failed resource are released
+		// (the stub doesn't reject destroying a VPC that still has subnets)
+		checkOrder bool
+	}{
+		{
+			name:       "without failures",
+			config:     provider.StubConfig{Latency: time.Millisecond},
+			parallel:   4,
+			checkOrder: true,
+		},
+		{
+			name:     "retry injected failures",
+			config:   provider.StubConfig{Latency: time.Millisecond, FailRate: 0.3, Seed: 1},
+			parallel: 8,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resources, stub := stubResources(t, tc.config, 100)
+
+			_, result, err := destroy.PlanAndExecute(context.Background(), fakeState{resources: resources}, nil,
+				destroy.Config{Parallel: tc.parallel})
+			require.NoError(t, err)
+
+			assert.Equal(t, destroy.Result{Deleted: 100}, result)
+
+			destroyed := stub.Destroyed()
+			require.Len(t, destroyed, 100)
+
+			position := map[string]int{}
+			for i, key := range destroyed {
+				position[key] = i
+			}
+
+			for i := 0; i < 100 && tc.checkOrder; i++ {
+				if i%10 == 0 {
+					continue
+				}
+
+				assert.Less(t, position[fmt.Sprintf("aws_subnet.subnet-%d", i)],
+					position[fmt.Sprintf("aws_vpc.vpc-%d", i/10)], "subnet must be destroyed before its VPC")
+			}
+
+			// states are updated and resources destroyed by separate pools of workers
+			assert.LessOrEqual(t, stub.MaxConcurrentCalls(), 2*tc.parallel)
+		})
+	}
+}
+
+// BenchmarkPlanAndExecute_ProviderStub measures the overhead of the destroy pipeline (e.g., ordering and accounting)
+// for a large synthetic state without any cloud:
+//
+//	go test -run '^$' -bench PlanAndExecute_ProviderStub -benchmem ./pkg/destroy
+func BenchmarkPlanAndExecute_ProviderStub(b *testing.B) {
+	for _, n := range []int{1000, 50000} {
+		b.Run(fmt.Sprintf("%d resources", n), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				resources, _ := stubResources(b, provider.StubConfig{}, n)
+				b.StartTimer()
+
+				_, result, err := destroy.PlanAndExecute(context.Background(), fakeState{resources: resources}, nil,
+					destroy.Config{Parallel: 10})
+				require.NoError(b, err)
+				require.Equal(b, n, result.Deleted)
+			}
+		})
+	}
+}
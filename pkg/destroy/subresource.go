@@ -0,0 +1,138 @@
+package destroy
+
+import (
+	"context"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// maxSubResources is the maximum number of sub-resources recorded per resource (see SubResource). Imports expanding
+// into more sub-resources are unusual, so the remaining ones are only counted.
+const maxSubResources = 20
+
+// SubResource is a resource that has been imported alongside a resource of the state, but isn't destroyed
+// separately, as it is destroyed along with that resource (e.g., a rule of a security group, which older versions
+// of the AWS provider import with the group).
+type SubResource struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// subResourceSet is a set of resources by type and ID, to find sub-resources that are part of a run anyway.
+type subResourceSet map[SubResource]bool
+
+// newSubResourceSet returns the set of the given resources.
+func newSubResourceSet(resources []*Resource) subResourceSet {
+	result := subResourceSet{}
+
+	for _, r := range resources {
+		result[SubResource{Type: r.Type(), ID: r.ID()}] = true
+	}
+
+	return result
+}
+
+// splitImportedResources returns the imported resource of the given type and ID (or the first one of the type, if
+// none has the ID), and the other imported resources as sub-resources. The returned resource is nil if none
+// of the given type has been imported.
+func splitImportedResources(terraformType, id string,
+	importedResources []providers.ImportedResource) (*providers.ImportedResource, []SubResource) {
+	var imported *providers.ImportedResource
+
+	for i, rImported := range importedResources {
+		if rImported.TypeName != terraformType {
+			continue
+		}
+
+		if imported == nil || stringAttr(rImported.State, "id") == id {
+			imported = &importedResources[i]
+		}
+	}
+
+	var subResources []SubResource
+
+	for i, rImported := range importedResources {
+		if imported == &importedResources[i] {
+			continue
+		}
+
+		subResources = append(subResources, SubResource{Type: rImported.TypeName, ID: stringAttr(rImported.State, "id")})
+	}
+
+	return imported, subResources
+}
+
+// recordSubResources removes the sub-resources of the resource that are part of the given set (i.e., resources
+// of the run, or sub-resources of another resource), so that each is only reported once, and caps the remaining ones
+// at maxSubResources. The remaining sub-resources are added to the set.
+//
+// Must be called sequentially for the resources of a run (e.g., while collecting the results of updating them).
+func (r *Resource) recordSubResources(known subResourceSet) {
+	if len(r.subResources) == 0 {
+		return
+	}
+
+	var subResources []SubResource
+
+	for _, s := range r.subResources {
+		if known[s] {
+			log.WithFields(log.Fields{"id": r.ID(), "type": r.Type(), "sub_resource_type": s.Type,
+				"sub_resource_id": s.ID}).Debug(internal.Pad("sub-resource is already part of the run"))
+
+			continue
+		}
+
+		known[s] = true
+		subResources = append(subResources, s)
+	}
+
+	if len(subResources) > maxSubResources {
+		r.omittedSubResources = len(subResources) - maxSubResources
+		subResources = subResources[:maxSubResources]
+
+		log.WithFields(log.Fields{
+			"id":            r.ID(),
+			"type":          r.Type(),
+			"sub_resources": len(subResources) + r.omittedSubResources,
+			"omitted":       r.omittedSubResources,
+		}).Warn(internal.Pad("import found unusually many sub-resources"))
+	}
+
+	r.subResources = subResources
+}
+
+// SubResources returns the sub-resources that are destroyed along with the resource (see SubResource).
+func (r Resource) SubResources() []SubResource {
+	return r.subResources
+}
+
+// SubResourcesOf returns the sub-resources of a resource (see Resource.SubResources), or nil if the resource
+// has none.
+func SubResourcesOf(r DestroyableResource) []SubResource {
+	if s, ok := r.(interface{ SubResources() []SubResource }); ok {
+		return s.SubResources()
+	}
+
+	return nil
+}
+
+// predictSubResources lists the sub-resources that would be destroyed along with the resource.
+func (r Resource) predictSubResources() []AuxiliaryDeletion {
+	var result []AuxiliaryDeletion
+
+	for _, s := range r.subResources {
+		result = append(result, AuxiliaryDeletion{Parent: r.Address(), Type: s.Type, ID: s.ID,
+			Outcome: AuxiliaryWouldBeDeleted})
+	}
+
+	return result
+}
+
+// reportSubResources reports the sub-resources of the resource as deleted along with it.
+func (r Resource) reportSubResources(ctx context.Context) {
+	for _, s := range r.subResources {
+		ReportAuxiliary(ctx, r.newAuxiliaryDeletion(s.Type, s.ID, nil))
+	}
+}
@@ -0,0 +1,129 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// expandingStub is a provider stub that imports security groups with the given number of rules
+// (as older versions of the AWS provider do).
+type expandingStub struct {
+	*provider.Stub
+
+	numOfRules int
+}
+
+func (s expandingStub) ImportResourceState(
+	req providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	response := s.Stub.ImportResourceState(req)
+
+	if req.TypeName != "aws_security_group" {
+		return response
+	}
+
+	for i := 0; i < s.numOfRules; i++ {
+		response.ImportedResources = append(response.ImportedResources, providers.ImportedResource{
+			TypeName: "aws_security_group_rule",
+			State:    cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(fmt.Sprintf("sgrule-%d", i))}),
+		})
+	}
+
+	// the group itself isn't necessarily imported first
+	response.ImportedResources[0], response.ImportedResources[1] =
+		response.ImportedResources[1], response.ImportedResources[0]
+
+	return response
+}
+
+func TestPlanAndExecute_SubResources(t *testing.T) {
+	tests := []struct {
+		name    string
+		planned bool
+	}{
+		{name: "plan", planned: true},
+		{name: "forced"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_security_group", "aws_security_group_rule"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return expandingStub{Stub: stub, numOfRules: 50}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			ruleState := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("sgrule-1")})
+
+			state := fakeState{resources: []*destroy.Resource{
+				destroy.NewWithState("aws_security_group.test", "aws_security_group", "sg-1", nil, tp, nil),
+				// a rule that is part of the state is destroyed by itself, rather than as sub-resource
+				destroy.NewWithState("aws_security_group_rule.test", "aws_security_group_rule", "sgrule-1",
+					[]string{"aws_security_group.test"}, tp, &ruleState),
+			}}
+
+			events := &recordedEvents{}
+			config := destroy.Config{Events: events}
+
+			var plan *destroy.DestroyPlan
+
+			var result destroy.Result
+
+			if tc.planned {
+				plan, err = destroy.Plan(context.Background(), state, nil, config)
+				require.NoError(t, err)
+
+				result = destroy.Execute(context.Background(), plan)
+			} else {
+				plan, result, err = destroy.PlanAndExecute(context.Background(), state, nil, config)
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, 2, result.Deleted, "sub-resources must not be counted as resources")
+			assert.ElementsMatch(t, []string{"aws_security_group.test", "aws_security_group_rule.test"},
+				events.deleted)
+			assert.ElementsMatch(t, []string{"aws_security_group.sg-1", "aws_security_group_rule.sgrule-1"},
+				stub.Destroyed())
+
+			var group destroy.PlannedResource
+
+			for _, c := range plan.Candidates {
+				if c.Address == "aws_security_group.test" {
+					group = c
+				}
+			}
+
+			require.NotNil(t, group.Resource)
+
+			subResources := group.Resource.SubResources()
+			require.Len(t, subResources, 20, "sub-resources must be capped")
+			assert.Equal(t, destroy.SubResource{Type: "aws_security_group_rule", ID: "sgrule-0"}, subResources[0])
+			assert.NotContains(t, subResources, destroy.SubResource{Type: "aws_security_group_rule", ID: "sgrule-1"},
+				"sub-resources that are part of the run must not be duplicated")
+
+			if tc.planned {
+				assert.Equal(t, 29, group.Preview["sub_resources_omitted"])
+				assert.Len(t, group.Auxiliaries, 20)
+			}
+
+			require.Len(t, events.auxiliaries, 20)
+
+			for _, d := range events.auxiliaries {
+				assert.Equal(t, "aws_security_group.test", d.Parent, "sub-resources must be attributed to their group")
+				assert.Equal(t, destroy.AuxiliaryDeleted, d.Outcome)
+			}
+		})
+	}
+}
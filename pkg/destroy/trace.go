@@ -0,0 +1,20 @@
+package destroy
+
+import (
+	"context"
+
+	"github.com/jckuester/terradozer/pkg/trace"
+)
+
+// startSpan starts a span of an operation on the given resource (nil if the run isn't traced).
+func startSpan(ctx context.Context, r DestroyableResource, name string) *trace.Span {
+	if trace.FromContext(ctx) == nil {
+		return nil
+	}
+
+	return trace.Start(ctx, "resource", name, map[string]interface{}{
+		"address": r.Address(),
+		"type":    r.Type(),
+		"id":      r.ID(),
+	})
+}
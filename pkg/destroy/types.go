@@ -0,0 +1,297 @@
+package destroy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/zclconf/go-cty/cty"
+)
+
+//nolint:gochecknoglobals
+var (
+	// implicitDependencies lists for a resource type the types of resources it depends on, although
+	// the state's dependency information often doesn't capture it (e.g., for resources created with older
+	// Terraform versions). Resources of the key type are destroyed before resources of the listed types.
+	implicitDependencies = map[string][]string{
+		// an Elastic IP cannot be released and a subnet cannot be deleted
+		// while a NAT gateway still references it
+		"aws_nat_gateway": {"aws_eip", "aws_subnet"},
+		// instances of an Aurora cluster need to be deleted before the cluster
+		"aws_rds_cluster_instance": {"aws_rds_cluster"},
+		// an EKS cluster is torn down in tiers: node groups, then Fargate profiles, then the cluster
+		"aws_eks_node_group":      {"aws_eks_fargate_profile", "aws_eks_cluster"},
+		"aws_eks_fargate_profile": {"aws_eks_cluster"},
+		// the application and the network resources of an Elastic Beanstalk environment
+		// can't be deleted until the environment has terminated
+		"aws_elastic_beanstalk_environment": {"aws_elastic_beanstalk_application",
+			"aws_elastic_beanstalk_application_version", "aws_elastic_beanstalk_configuration_template",
+			"aws_security_group", "aws_subnet", "aws_vpc"},
+	}
+
+	// asyncDeletionTypes lists resource types for which deletion completes asynchronously in the cloud,
+	// even if the provider's destroy call has already returned. For these types, terradozer polls until
+	// the resource is gone, which is the maximum amount of time specified here.
+	asyncDeletionTypes = map[string]time.Duration{
+		"aws_nat_gateway":         10 * time.Minute,
+		"aws_eks_node_group":      eksTimeout,
+		"aws_eks_fargate_profile": eksTimeout,
+		"aws_eks_cluster":         eksTimeout,
+	}
+
+	// renamedTypes lists resource types that newer versions of a provider have renamed (by old type), so that
+	// resources of the old type are destroyed as resources of the new type if the provider doesn't know the old one.
+	renamedTypes = map[string]string{
+		"aws_s3_bucket_object":            "aws_s3_object",
+		"aws_alb":                         "aws_lb",
+		"aws_alb_listener":                "aws_lb_listener",
+		"aws_alb_listener_certificate":    "aws_lb_listener_certificate",
+		"aws_alb_listener_rule":           "aws_lb_listener_rule",
+		"aws_alb_target_group":            "aws_lb_target_group",
+		"aws_alb_target_group_attachment": "aws_lb_target_group_attachment",
+	}
+
+	// destroyTimeouts lists resource types that regularly take longer to be destroyed than the default timeout.
+	destroyTimeouts = map[string]time.Duration{
+		"aws_cloudfront_distribution": cloudFrontTimeout,
+		"aws_db_instance":             rdsTimeout,
+		"aws_rds_cluster":             rdsTimeout,
+		"aws_rds_cluster_instance":    rdsTimeout,
+		"aws_eks_node_group":          eksTimeout,
+		"aws_eks_fargate_profile":     eksTimeout,
+		"aws_eks_cluster":             eksTimeout,
+	}
+
+	// typeHandlers lists the built-in handlers of resource types that can only be destroyed after a preceding step
+	// (e.g., disabling the resource); see RegisterTypeHandler to add further ones.
+	typeHandlers = map[string][]TypeHandler{
+		"aws_cloudfront_distribution": {TypeHandlerFuncs{
+			Step:        "disable",
+			Description: "two-phase destroy: disable, wait until deployed, delete",
+			Pre:         Resource.disableCloudFrontDistribution,
+		}},
+		"aws_route53_zone": {TypeHandlerFuncs{
+			Step:        "delete record sets",
+			Description: "delete all record sets (except NS and SOA), delete",
+			Pre:         Resource.emptyRoute53Zone,
+			Enabled:     func(o Options) bool { return o.Route53EmptyZones },
+			Auxiliaries: Resource.predictRoute53RecordSets,
+		}},
+		"aws_secretsmanager_secret": {TypeHandlerFuncs{
+			Step:        "remove replicas",
+			Description: "remove replicas (if any), delete without recovery window",
+			Pre:         Resource.removeSecretReplicas,
+			Enabled:     func(o Options) bool { return o.SecretsForceDelete },
+			Auxiliaries: Resource.predictSecretReplicas,
+		}},
+		"aws_db_instance": {TypeHandlerFuncs{
+			Step:        "disable deletion protection",
+			Description: "disable deletion protection (if enabled), delete",
+			Pre:         Resource.disableDeletionProtection,
+		}},
+		"aws_rds_cluster": {TypeHandlerFuncs{
+			Step:        "disable deletion protection",
+			Description: "disable deletion protection (if enabled), delete",
+			Pre:         Resource.disableDeletionProtection,
+		}},
+
+		// the APIs refuse to delete these resources while their deletion protection is enabled
+		"aws_lb":              {disableProtection("enable_deletion_protection")},
+		"aws_alb":             {disableProtection("enable_deletion_protection")},
+		"aws_instance":        {disableProtection("disable_api_termination")},
+		"aws_docdb_cluster":   {disableProtection("deletion_protection")},
+		"aws_neptune_cluster": {disableProtection("deletion_protection")},
+		"aws_qldb_ledger":     {disableProtection("deletion_protection")},
+
+		"aws_lambda_function":     {implicitLogGroups{names: Resource.lambdaLogGroups}},
+		"aws_ecs_task_definition": {implicitLogGroups{names: Resource.ecsLogGroups}},
+		"aws_flow_log":            {implicitLogGroups{names: Resource.flowLogGroups}},
+		"aws_s3_bucket": {UpdateSteps{
+			Step: "prepare bucket",
+			Steps: []UpdateStep{{
+				Name:    "remove object lock rule",
+				Attrs:   Resource.s3ObjectLockRuleAttrs,
+				Retries: 2,
+			}},
+		}},
+	}
+
+	// destroyAttrs lists resource types for which some attributes in the state need to be changed
+	// to be able to destroy them (in addition to the force destroy attributes).
+	destroyAttrs = map[string]func(Resource) map[string]cty.Value{
+		"aws_db_instance":                   Resource.rdsDestroyAttrs,
+		"aws_rds_cluster":                   Resource.rdsDestroyAttrs,
+		"aws_kms_key":                       Resource.kmsDestroyAttrs,
+		"aws_secretsmanager_secret":         Resource.secretDestroyAttrs,
+		"aws_elastic_beanstalk_environment": Resource.beanstalkDestroyAttrs,
+		"aws_docdb_cluster":                 Resource.finalSnapshotDestroyAttrs,
+		"aws_neptune_cluster":               Resource.finalSnapshotDestroyAttrs,
+		"aws_redshift_cluster":              Resource.finalSnapshotDestroyAttrs,
+	}
+
+	// customDestroys lists resource types that might need to be destroyed differently than via the provider.
+	customDestroys = map[string]func(Resource, context.Context, cty.Value) error{
+		"aws_secretsmanager_secret":         Resource.destroySecret,
+		"aws_elastic_beanstalk_environment": Resource.destroyBeanstalkEnvironment,
+	}
+
+	// manualActions lists resource types whose destroy might fail until a setting has been changed by hand,
+	// which retrying doesn't change (see ManualActionError). Given are the state refreshed before the resource
+	// has been prepared for deletion, the state to destroy, and the error of the destroy.
+	manualActions = map[string]func(Resource, context.Context, cty.Value, cty.Value, error) error{
+		"aws_s3_bucket": Resource.bucketManualAction,
+	}
+
+	// previewFields lists resource types for which additional information is shown
+	// before resources are destroyed (e.g., the number of items that would be deleted alongside).
+	previewFields = map[string]func(Resource, context.Context) log.Fields{
+		"aws_eks_cluster": func(r Resource, _ context.Context) log.Fields {
+			return r.eksClusterFields()
+		},
+	}
+
+	// deletedFields lists resource types for which additional information is logged
+	// once a resource has been destroyed (e.g., the date when a resource scheduled for deletion will be gone).
+	deletedFields = map[string]func(Resource) log.Fields{
+		"aws_kms_key":     Resource.kmsDeletedFields,
+		"aws_eks_cluster": Resource.eksClusterFields,
+	}
+
+	// blockerLookups lists resource types for which the resources blocking their deletion can be looked up
+	// (see Options.ExplainBlockers).
+	blockerLookups = map[string]func(Resource, context.Context) ([]Blocker, error){
+		"aws_subnet":         Resource.subnetBlockers,
+		"aws_security_group": Resource.securityGroupBlockers,
+		"aws_vpc":            Resource.vpcBlockers,
+		"aws_s3_bucket":      Resource.bucketBlockers,
+	}
+
+	// requiredFlags lists resource types which might fail to be destroyed unless the flag enabling
+	// the given option is set.
+	requiredFlags = map[string]requiredFlag{
+		"aws_route53_zone": {
+			reason:  "zones with record sets that aren't part of the state are only destroyed with -route53-empty-zones",
+			enabled: func(o Options) bool { return o.Route53EmptyZones },
+		},
+	}
+
+	// alreadyDeletedErrors lists per resource type parts of error messages returned by a destroy,
+	// which mean that the resource has already been deleted (or scheduled for deletion).
+	alreadyDeletedErrors = map[string][]string{
+		"aws_kms_key": {"is pending deletion"},
+	}
+)
+
+const (
+	// cloudFrontTimeout is the amount of time to wait for changes of a CloudFront distribution to be deployed.
+	cloudFrontTimeout = 45 * time.Minute
+
+	// rdsTimeout is the amount of time to wait for changes to or the deletion of an RDS instance or cluster.
+	rdsTimeout = 60 * time.Minute
+)
+
+type requiredFlag struct {
+	reason string
+	// enabled returns if the flag is set in the given options.
+	enabled func(Options) bool
+}
+
+// RequiredFlag returns why resources of the given type might fail to be destroyed with the given options
+// (i.e., unless a flag is set), or an empty string if they don't.
+func RequiredFlag(terraformType string, options Options) string {
+	f, ok := requiredFlags[terraformType]
+	if !ok || f.enabled(options) {
+		return ""
+	}
+
+	return f.reason
+}
+
+// RenamedType returns the type that resources of the given type have been renamed to by the provider
+// (i.e., if the provider's schema contains the new type, but not the given one).
+func RenamedType(terraformType string, hasType func(string) bool) (string, bool) {
+	renamed, ok := renamedTypes[terraformType]
+	if !ok || hasType(terraformType) || !hasType(renamed) {
+		return "", false
+	}
+
+	return renamed, true
+}
+
+// checkTypes returns the given resources whose type is part of the schema of their provider; resources of types
+// that the provider has renamed are destroyed as resources of the new type (see RenamedType). The resources
+// of other types can't be destroyed, for which the errors are returned.
+func checkTypes(resources []*Resource) ([]*Resource, []RetryDestroyError) {
+	var supported []*Resource
+
+	var unsupported []RetryDestroyError
+
+	for _, r := range resources {
+		if r.provider == nil {
+			supported = append(supported, r)
+
+			continue
+		}
+
+		hasType := func(terraformType string) bool {
+			_, err := r.provider.GetSchemaForResource(terraformType)
+
+			return err == nil
+		}
+
+		if hasType(r.Type()) {
+			supported = append(supported, r)
+
+			continue
+		}
+
+		renamed, ok := RenamedType(r.Type(), hasType)
+		if !ok {
+			unsupported = append(unsupported, *NewRetryDestroyError(&UnsupportedTypeError{
+				Type:     r.Type(),
+				Provider: r.provider.Name(),
+				Version:  r.provider.Version(),
+			}, r))
+
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"id":       r.ID(),
+			"type":     r.Type(),
+			"new_type": renamed,
+		}).Info(internal.Pad("destroying resource as renamed type"))
+
+		// the attributes in the state (if any) are the ones of the old type, so the resource is imported
+		r.terraformType = renamed
+		r.state = nil
+		r.marks = nil
+		r.stateAttrs = nil
+
+		supported = append(supported, r)
+	}
+
+	return supported, unsupported
+}
+
+const (
+	// pollInterval is the amount of time to wait between checks whether a resource is gone.
+	pollInterval = 10 * time.Second
+
+	// progressInterval is the amount of time after which the progress of a long-running change is logged.
+	progressInterval = 1 * time.Minute
+)
+
+// isAlreadyDeleted returns true if the given error returned by a destroy means that
+// the resource has already been deleted (or scheduled for deletion).
+func isAlreadyDeleted(terraformType string, err error) bool {
+	for _, msg := range alreadyDeletedErrors[terraformType] {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,323 @@
+package destroy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/trace"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// UpdateResources updates the state of a given list of resources in parallel.
+// Only updated resources are returned which still exist in the cloud.
+// Once the context is done, the states of the remaining resources aren't updated anymore.
+//
+// The progress is reported to the given events (which can be nil).
+//
+// copied (and modified) from github.com/jckuester/awstools-lib/terraform/update.go
+func UpdateResources(ctx context.Context, resources []*Resource, parallel int, events Events) []*Resource {
+	events = orNoop(events)
+
+	numOfResourcesToUpdate := len(resources)
+
+	var updatedResources []*Resource
+
+	known := newSubResourceSet(resources)
+
+	jobQueue := make(chan *Resource, numOfResourcesToUpdate)
+
+	workerResults := make(chan updateWorkerResult, numOfResourcesToUpdate)
+
+	for workerID := 1; workerID <= parallel; workerID++ {
+		go updateWorker(trace.WithWorker(ctx, "update worker", workerID), jobQueue, workerResults)
+	}
+
+	for _, r := range resources {
+		jobQueue <- r
+	}
+
+	close(jobQueue)
+
+	for i := 1; i <= numOfResourcesToUpdate; i++ {
+		r := <-workerResults
+
+		if r.err != nil && ctx.Err() != nil {
+			continue
+		}
+
+		if r.err != nil {
+			events.ResourceImportFailed(newImportFailedEvent(r.resource, r.err))
+
+			continue
+		}
+
+		r.resource.recordSubResources(known)
+		events.ResourceDiscovered(newResourceEvent(r.resource, nil))
+
+		updatedResources = append(updatedResources, r.resource)
+	}
+
+	// the results arrive in the order in which the workers complete
+	sortByAddress(updatedResources)
+
+	return updatedResources
+}
+
+type updateWorkerResult struct {
+	resource *Resource
+	// err is set if update failed.
+	err error
+}
+
+// updateWorker is a worker that updates the state of a resource.
+func updateWorker(ctx context.Context, resources <-chan *Resource, result chan<- updateWorkerResult) {
+	for r := range resources {
+		if err := ctx.Err(); err != nil {
+			result <- updateWorkerResult{resource: r, err: err}
+
+			continue
+		}
+
+		err := r.UpdateState(ctx)
+		if err != nil {
+			result <- updateWorkerResult{resource: r, err: err}
+
+			continue
+		}
+
+		resourceNotFound := r.State().IsNull()
+		if resourceNotFound {
+			result <- updateWorkerResult{resource: r, err: ErrResourceGone}
+
+			continue
+		}
+
+		result <- updateWorkerResult{resource: r, err: nil}
+	}
+}
+
+// UpdateState updates the state of the resource (i.e., refreshes all its attributes).
+// If the resource is already gone, the updated state will be nil (more precisely, of type cty.NilVal).
+//
+// If the resource can neither be imported nor read (e.g., as its type doesn't support import) or with
+// Options.NoRefresh, the attributes recorded in the state are used instead, which aren't refreshed.
+func (r *Resource) UpdateState(ctx context.Context) error {
+	if r.Options.NoRefresh {
+		if stored := r.recordedState(); stored != nil {
+			log.WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).
+				Debug("using the state stored in the state file (without refresh)")
+
+			r.setState(*stored)
+
+			return nil
+		}
+	}
+
+	if r.state != nil {
+		// if the resource stores already a state representation, refresh that state
+		log.WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).
+			Debug("reading resource with the state stored in the state file (without import)")
+
+		span := startSpan(ctx, r, "read")
+		result, err := r.provider.ReadResource(ctx, r.Type(), *r.state)
+		span.End(err)
+
+		if err != nil {
+			return fmt.Errorf("failed to read current state of resource: %s", err)
+		}
+
+		r.setState(result)
+		r.refreshed = true
+
+		return nil
+	}
+
+	if strategy, ok := r.provider.ImportStrategy(r.Type()); ok && strategy == provider.ImportStrategyRead {
+		// importing resources of this type has failed before (e.g., during previous runs), while reading them
+		// without import has worked; if the resource seems gone, it is imported nevertheless, as reading might
+		// lack attributes
+		log.WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).
+			Debug("reading resource without import (as import has failed for its type before)")
+
+		span := startSpan(ctx, r, "read")
+		result, err := r.readResource(ctx)
+		span.End(err)
+
+		if err == nil && !result.IsNull() {
+			r.setState(result)
+			r.refreshed = true
+
+			return nil
+		}
+	}
+
+	log.WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).Debug("importing resource by its ID")
+
+	span := startSpan(ctx, r, "import")
+	result, subResources, err := r.importAndReadResource(ctx)
+	span.End(err)
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	strategy := provider.ImportStrategyImport
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).
+			Debug("failed to import resource; trying to read resource without import")
+
+		span := startSpan(ctx, r, "read")
+		result, err = r.readResource(ctx)
+		span.End(err)
+
+		if err != nil {
+			err = r.withSchemaVersion(err)
+
+			if ctx.Err() == nil && r.StoredState != nil && unreadable(err) {
+				log.WithError(err).WithFields(log.Fields{"id": r.ID(), "type": r.Type()}).
+					Info(internal.Pad("cannot import or read resource; using the state stored in the state file"))
+
+				r.setState(*r.StoredState)
+
+				return nil
+			}
+
+			return err
+		}
+
+		strategy = provider.ImportStrategyRead
+	}
+
+	// a resource that seems gone doesn't tell which strategy works
+	if !result.IsNull() {
+		r.provider.RecordImportStrategy(r.Type(), strategy)
+	}
+
+	r.setState(result)
+	r.refreshed = true
+	r.subResources = subResources
+
+	return nil
+}
+
+// recordedState returns the attributes of the resource recorded in the state (nil if unknown), i.e., its state
+// before it has been updated or, if they don't satisfy the provider's schema, the StoredState.
+func (r *Resource) recordedState() *cty.Value {
+	if r.state != nil {
+		return r.state
+	}
+
+	return r.StoredState
+}
+
+// unreadable returns true if the given error of reading a resource means that it can't be read at all (e.g., as its
+// type needs more than the ID to be read), so that the attributes recorded in the state are used instead. Errors that
+// might be temporary (e.g., throttling or expired credentials) don't, nor does a newer schema version in the state,
+// as a newer version of the provider might be able to read the resource (see SchemaVersionError).
+func unreadable(err error) bool {
+	switch Classify(err) {
+	case ErrorClassThrottled, ErrorClassPermissionDenied, ErrorClassCredentialsExpired, ErrorClassProviderCrashed,
+		ErrorClassCanceled, ErrorClassSchemaVersionNewer:
+		return false
+	default:
+		return true
+	}
+}
+
+// withSchemaVersion returns a SchemaVersionError wrapping the given error of updating the state, if the schema
+// version of the resource recorded in the state is newer than the one of its provider (then, the recorded state
+// can't be decoded and a newer version of the provider might be able to read the resource).
+func (r Resource) withSchemaVersion(err error) error {
+	if r.provider == nil || r.SchemaVersion == 0 {
+		return err
+	}
+
+	schema, schemaErr := r.provider.GetSchemaForResource(r.Type())
+	if schemaErr != nil || schema.Version < 0 || uint64(schema.Version) >= r.SchemaVersion {
+		return err
+	}
+
+	return &SchemaVersionError{
+		Err:                   err,
+		StateVersion:          r.SchemaVersion,
+		ProviderSchemaVersion: schema.Version,
+		Provider:              r.provider.Name(),
+		Version:               r.provider.Version(),
+	}
+}
+
+// importAndReadResource imports the resource by its ID and reads its current state. Other resources imported
+// alongside (e.g., the rules of a security group) aren't read, but returned as sub-resources.
+func (r Resource) importAndReadResource(ctx context.Context) (cty.Value, []SubResource, error) {
+	importedResources, err := r.provider.ImportResource(ctx, r.Type(), r.ID())
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+
+	imported, subResources := splitImportedResources(r.Type(), r.ID(), importedResources)
+	if imported == nil {
+		return cty.NilVal, nil, fmt.Errorf("no resource found to be imported")
+	}
+
+	if len(subResources) > 0 {
+		log.WithFields(log.Fields{"id": r.ID(), "type": r.Type(), "sub_resources": len(subResources)}).
+			Debug("found multiple resources during import")
+	}
+
+	currentResourceState, err := r.provider.ReadResource(ctx, imported.TypeName, imported.State)
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+
+	return currentResourceState, subResources, nil
+}
+
+// readResource fetches the current state of a resource based on its ID attribute.
+func (r Resource) readResource(ctx context.Context) (cty.Value, error) {
+	schema, err := r.provider.GetSchemaForResource(r.Type())
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	attrs := map[string]cty.Value{}
+	for k, v := range r.attrs {
+		attrs[k] = v
+	}
+
+	attrs["id"] = cty.StringVal(r.ID())
+
+	currentResourceState, err := r.provider.ReadResource(ctx, r.Type(), emptyValueWithAttrs(attrs, schema.Block))
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("failed to read current state of resource: %s", err)
+	}
+
+	return currentResourceState, nil
+}
+
+// emptyValueWithAttrs returns a non-null object for the configuration block
+// where all attribute values are set to empty values except the given ones.
+//
+// see also github.com/hashicorp/terraform/configs/configschema/empty_value.go
+func emptyValueWithAttrs(attrs map[string]cty.Value, block *configschema.Block) cty.Value {
+	vals := make(map[string]cty.Value)
+
+	for name, attrS := range block.Attributes {
+		attr, ok := attrs[name]
+		if ok {
+			vals[name] = attr
+		} else {
+			vals[name] = attrS.EmptyValue()
+		}
+	}
+
+	for name, blockS := range block.BlockTypes {
+		vals[name] = blockS.EmptyValue()
+	}
+
+	return cty.ObjectVal(vals)
+}
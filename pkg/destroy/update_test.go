@@ -0,0 +1,208 @@
+package destroy_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// notImportableStub is a provider stub that fails to import any resource, which can only be read.
+type notImportableStub struct {
+	*provider.Stub
+
+	imports *int32
+}
+
+func (s notImportableStub) ImportResourceState(
+	providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	atomic.AddInt32(s.imports, 1)
+
+	var diags tfdiags.Diagnostics
+
+	return providers.ImportResourceStateResponse{Diagnostics: diags.Append(
+		tfdiags.Sourceless(tfdiags.Error, "resource doesn't support import", ""))}
+}
+
+func TestUpdateResources_CachedImportStrategy(t *testing.T) {
+	installDir := t.TempDir()
+
+	var imports int32
+
+	run := func() {
+		tp, err := provider.Init(context.Background(), "aws", provider.Config{
+			InstallDir: installDir,
+			Timeout:    time.Minute,
+			Factory: func(string, string) (provider.Provider, error) {
+				return notImportableStub{Stub: provider.NewStub(provider.StubConfig{}, []string{"aws_vpc"}),
+					imports: &imports}, nil
+			},
+		})
+		require.NoError(t, err)
+
+		defer tp.Close()
+
+		updated := destroy.UpdateResources(context.Background(), []*destroy.Resource{
+			destroy.NewWithState("aws_vpc.a", "aws_vpc", "vpc-1", nil, tp, nil),
+			destroy.NewWithState("aws_vpc.b", "aws_vpc", "vpc-2", nil, tp, nil),
+		}, 1, nil)
+
+		assert.Len(t, updated, 2)
+	}
+
+	run()
+	assert.Equal(t, int32(1), imports, "import must be skipped once it has failed for the type")
+
+	run()
+	assert.Equal(t, int32(1), imports, "import must be skipped if it has failed for the type during previous runs")
+}
+
+// unreadableStub is a provider stub that fails to import and to read any resource (e.g., of a type that can't be
+// imported and needs more than its ID to be read) with the given error and fails to delete the resources of
+// the given IDs, as they don't exist anymore.
+type unreadableStub struct {
+	notImportableStub
+
+	reads   *int32
+	readErr string
+	gone    map[string]bool
+}
+
+func (s unreadableStub) ReadResource(providers.ReadResourceRequest) providers.ReadResourceResponse {
+	atomic.AddInt32(s.reads, 1)
+
+	var diags tfdiags.Diagnostics
+
+	return providers.ReadResourceResponse{Diagnostics: diags.Append(
+		tfdiags.Sourceless(tfdiags.Error, s.readErr, ""))}
+}
+
+func (s unreadableStub) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	if s.gone[req.PriorState.GetAttr("id").AsString()] {
+		var diags tfdiags.Diagnostics
+
+		return providers.ApplyResourceChangeResponse{Diagnostics: diags.Append(
+			tfdiags.Sourceless(tfdiags.Error, "NotFoundException: policy attachment not found", ""))}
+	}
+
+	return s.Stub.ApplyResourceChange(req)
+}
+
+func TestResource_UpdateState_StoredState(t *testing.T) {
+	stored := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("attachment-1")})
+
+	tests := []struct {
+		name              string
+		state             *cty.Value
+		storedState       *cty.Value
+		noRefresh         bool
+		gone              bool
+		readErr           string
+		expectedErr       bool
+		expectedReads     int32
+		expectedImports   int32
+		expectedDestroyed []string
+	}{
+		{
+			name:            "neither imported nor read",
+			expectedErr:     true,
+			expectedReads:   1,
+			expectedImports: 1,
+		},
+		{
+			name:              "stored state",
+			storedState:       &stored,
+			expectedReads:     1,
+			expectedImports:   1,
+			expectedDestroyed: []string{"aws_iam_role_policy_attachment.attachment-1"},
+		},
+		{
+			name:            "stored state, but read throttled",
+			storedState:     &stored,
+			readErr:         "Throttling: Rate exceeded",
+			expectedErr:     true,
+			expectedReads:   1,
+			expectedImports: 1,
+		},
+		{
+			name:            "stored state of resource that is already gone",
+			storedState:     &stored,
+			gone:            true,
+			expectedReads:   1,
+			expectedImports: 1,
+		},
+		{
+			name:              "no refresh",
+			state:             &stored,
+			noRefresh:         true,
+			expectedDestroyed: []string{"aws_iam_role_policy_attachment.attachment-1"},
+		},
+		{
+			name:              "no refresh with stored state",
+			storedState:       &stored,
+			noRefresh:         true,
+			expectedDestroyed: []string{"aws_iam_role_policy_attachment.attachment-1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var imports, reads int32
+
+			readErr := tc.readErr
+			if readErr == "" {
+				readErr = "ValidationError: role must be set"
+			}
+
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_iam_role_policy_attachment"})
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				InstallDir: t.TempDir(),
+				// throttled reads aren't retried for long
+				Timeout: time.Millisecond,
+				Factory: func(string, string) (provider.Provider, error) {
+					return unreadableStub{
+						notImportableStub: notImportableStub{Stub: stub, imports: &imports},
+						reads:             &reads,
+						readErr:           readErr,
+						gone:              map[string]bool{"attachment-1": tc.gone},
+					}, nil
+				},
+			})
+			require.NoError(t, err)
+
+			defer tp.Close()
+
+			r := destroy.NewWithState("aws_iam_role_policy_attachment.test", "aws_iam_role_policy_attachment",
+				"attachment-1", nil, tp, tc.state)
+			r.StoredState = tc.storedState
+			r.Options.NoRefresh = tc.noRefresh
+
+			err = r.UpdateState(context.Background())
+			assert.Equal(t, tc.expectedReads, reads)
+			assert.Equal(t, tc.expectedImports, imports)
+
+			if tc.expectedErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, r.State())
+			assert.Equal(t, "attachment-1", r.State().GetAttr("id").AsString())
+
+			require.NoError(t, r.Destroy(context.Background()))
+			assert.Equal(t, tc.expectedDestroyed, stub.Destroyed())
+		})
+	}
+}
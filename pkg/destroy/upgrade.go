@@ -0,0 +1,115 @@
+package destroy
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+)
+
+// ProviderUpgrade lists the resources that have been handled by a newer version of their provider,
+// since their schema versions recorded in the state are newer than the one of the provider (see SchemaVersionError).
+type ProviderUpgrade struct {
+	Provider string
+	// From and To are the versions of the provider before and after the upgrade.
+	From string
+	To   string
+	// Addresses are the addresses of the upgraded resources whose states have been updated with the newer provider.
+	Addresses []string
+}
+
+// upgradeProviders updates the states of the given resources, whose states couldn't be updated and that are listed
+// as gone in the plan due to a SchemaVersionError, again with upgraded providers (see Config.UpgradeProvider).
+// Returns the resources whose states have been updated, which are removed from plan.Gone.
+func upgradeProviders(ctx context.Context, plan *DestroyPlan, resources []*Resource, config Config) []*Resource {
+	if config.UpgradeProvider == nil {
+		return nil
+	}
+
+	// by type and ID, as deposed objects have the addresses of their resource instances
+	byKey := map[resourceKey]*Resource{}
+
+	for _, r := range resources {
+		byKey[resourceKey{r.Type(), r.ID()}] = r
+	}
+
+	var gone []ResourceEvent
+
+	outdated := map[*provider.TerraformProvider][]*Resource{}
+	outdatedEvents := map[*Resource]ResourceEvent{}
+
+	for _, e := range plan.Gone {
+		var schemaVersionErr *SchemaVersionError
+
+		r, ok := byKey[resourceKey{e.Type, e.ID}]
+		if !ok || r.provider == nil || !errors.As(e.Err, &schemaVersionErr) {
+			gone = append(gone, e)
+
+			continue
+		}
+
+		outdated[r.provider] = append(outdated[r.provider], r)
+		outdatedEvents[r] = e
+	}
+
+	if len(outdated) == 0 {
+		return nil
+	}
+
+	plan.Gone = gone
+
+	var providers []*provider.TerraformProvider
+
+	for p := range outdated {
+		providers = append(providers, p)
+	}
+
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name() < providers[j].Name() })
+
+	var result []*Resource
+
+	for _, p := range providers {
+		fields := log.Fields{"name": p.Name(), "version": p.Version(), "resources": len(outdated[p])}
+
+		upgraded, err := config.UpgradeProvider(ctx, p)
+		if err != nil {
+			log.WithError(err).WithFields(fields).Warn(internal.Pad("failed to upgrade provider"))
+
+			for _, r := range outdated[p] {
+				plan.Gone = append(plan.Gone, outdatedEvents[r])
+			}
+
+			continue
+		}
+
+		log.WithFields(fields).WithField("upgraded_version", upgraded.Version()).
+			Info(internal.Pad("updating resources with newer schema version with upgraded provider"))
+
+		for _, r := range outdated[p] {
+			r.provider = upgraded
+		}
+
+		events := goneEvents{Events: orNoop(config.Events), plan: plan}
+
+		updated := UpdateResources(ctx, outdated[p], config.Parallel, &events)
+
+		upgrade := ProviderUpgrade{Provider: p.Name(), From: p.Version(), To: upgraded.Version()}
+
+		for _, r := range updated {
+			upgrade.Addresses = append(upgrade.Addresses, r.Address())
+		}
+
+		sort.Strings(upgrade.Addresses)
+
+		if len(updated) > 0 {
+			plan.Upgrades = append(plan.Upgrades, upgrade)
+		}
+
+		result = append(result, updated...)
+	}
+
+	return result
+}
@@ -0,0 +1,190 @@
+package destroy_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionedStub is a provider stub whose resource types have the given schema version. Importing and reading
+// the resource with the ID newerID fails unless the schema version is at least 1 (i.e., the one of the resource
+// in the state).
+type versionedStub struct {
+	*provider.Stub
+	schemaVersion int64
+	newerID       string
+}
+
+func (s versionedStub) GetSchema() providers.GetSchemaResponse {
+	schema := s.Stub.GetSchema()
+
+	resourceTypes := map[string]providers.Schema{}
+
+	for name, t := range schema.ResourceTypes {
+		t.Version = s.schemaVersion
+		resourceTypes[name] = t
+	}
+
+	schema.ResourceTypes = resourceTypes
+
+	return schema
+}
+
+func (s versionedStub) ImportResourceState(
+	req providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	if s.schemaVersion < 1 && req.ID == s.newerID {
+		return providers.ImportResourceStateResponse{Diagnostics: s.unsupported()}
+	}
+
+	return s.Stub.ImportResourceState(req)
+}
+
+func (s versionedStub) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	if s.schemaVersion < 1 && req.PriorState.GetAttr("id").AsString() == s.newerID {
+		return providers.ReadResourceResponse{Diagnostics: s.unsupported()}
+	}
+
+	return s.Stub.ReadResource(req)
+}
+
+func (s versionedStub) unsupported() tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	return diags.Append(fmt.Errorf("unsupported attribute in schema version %d", s.schemaVersion))
+}
+
+// newVersionedProvider returns a provider of version v3.42.0 with schema version 0, which upgrades to v3.74.0
+// with schema version 1 (failing to read resource vpc-2 recorded with schema version 1).
+func newVersionedProvider(t *testing.T) (*provider.TerraformProvider, provider.Config) {
+	config := provider.Config{
+		Timeout:  time.Minute,
+		Versions: map[string]string{"aws": "v3.42.0"},
+		Factory: func(_, version string) (provider.Provider, error) {
+			s := versionedStub{Stub: provider.NewStub(provider.StubConfig{}, []string{"aws_vpc"}), newerID: "vpc-2"}
+			if version == "v3.74.0" {
+				s.schemaVersion = 1
+			}
+
+			return s, nil
+		},
+		LatestVersion: func(string, string) (string, error) {
+			return "v3.74.0", nil
+		},
+	}
+
+	tp, err := provider.Init(context.Background(), "aws", config)
+	require.NoError(t, err)
+
+	return tp, config
+}
+
+func TestPlan_UpgradeProvider(t *testing.T) {
+	tests := []struct {
+		name              string
+		upgrade           bool
+		expectedAddresses []string
+		expectedUpgrades  []destroy.ProviderUpgrade
+		expectedGoneClass destroy.ErrorClass
+	}{
+		{
+			name:              "without upgrade",
+			expectedGoneClass: destroy.ErrorClassSchemaVersionNewer,
+		},
+		{
+			name:              "with upgrade",
+			upgrade:           true,
+			expectedAddresses: []string{"aws_vpc.newer"},
+			expectedUpgrades: []destroy.ProviderUpgrade{
+				{Provider: "aws", From: "v3.42.0", To: "v3.74.0", Addresses: []string{"aws_vpc.newer"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tp, providerConfig := newVersionedProvider(t)
+
+			newer := destroy.NewWithState("aws_vpc.newer", "aws_vpc", "vpc-2", nil, tp, nil)
+			newer.SchemaVersion = 1
+
+			state := fakeState{resources: []*destroy.Resource{
+				destroy.NewWithState("aws_vpc.older", "aws_vpc", "vpc-1", nil, tp, nil),
+				newer,
+			}}
+
+			config := destroy.Config{Providers: map[string]*provider.TerraformProvider{"aws": tp}}
+
+			if tc.upgrade {
+				config.UpgradeProvider = func(ctx context.Context,
+					p *provider.TerraformProvider) (*provider.TerraformProvider, error) {
+					return provider.Upgrade(ctx, p, providerConfig)
+				}
+			}
+
+			actualPlan, err := destroy.Plan(context.Background(), state, nil, config)
+			require.NoError(t, err)
+
+			// the older resource is read by the provider in use, since its schema version isn't newer
+			var actualAddresses []string
+
+			for _, c := range actualPlan.Candidates {
+				if c.Address != "aws_vpc.older" {
+					actualAddresses = append(actualAddresses, c.Address)
+					assert.Equal(t, "v3.74.0", c.ProviderVersion)
+					assert.Equal(t, "v3.74.0", c.Preview["provider_version"])
+				}
+			}
+
+			assert.Equal(t, tc.expectedAddresses, actualAddresses)
+			assert.Equal(t, tc.expectedUpgrades, actualPlan.Upgrades)
+
+			if tc.expectedGoneClass == destroy.ErrorClassUnknown {
+				assert.Empty(t, actualPlan.Gone)
+
+				return
+			}
+
+			require.Len(t, actualPlan.Gone, 1)
+			assert.Equal(t, "aws_vpc.newer", actualPlan.Gone[0].Address)
+			assert.Equal(t, tc.expectedGoneClass, destroy.Classify(actualPlan.Gone[0].Err))
+		})
+	}
+}
+
+func TestPlanAndExecute_UpgradeProvider(t *testing.T) {
+	tp, providerConfig := newVersionedProvider(t)
+
+	newer := destroy.NewWithState("aws_vpc.newer", "aws_vpc", "vpc-2", nil, tp, nil)
+	newer.SchemaVersion = 1
+
+	state := fakeState{resources: []*destroy.Resource{
+		destroy.NewWithState("aws_vpc.older", "aws_vpc", "vpc-1", nil, tp, nil),
+		newer,
+	}}
+
+	config := destroy.Config{
+		Providers: map[string]*provider.TerraformProvider{"aws": tp},
+		UpgradeProvider: func(ctx context.Context, p *provider.TerraformProvider) (*provider.TerraformProvider, error) {
+			return provider.Upgrade(ctx, p, providerConfig)
+		},
+	}
+
+	actualPlan, actualResult, err := destroy.PlanAndExecute(context.Background(), state, nil, config)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, actualResult.Deleted)
+	assert.Empty(t, actualResult.Failed)
+	assert.Empty(t, actualPlan.Gone)
+	assert.Len(t, actualPlan.Candidates, 2)
+	assert.Equal(t, []destroy.ProviderUpgrade{
+		{Provider: "aws", From: "v3.42.0", To: "v3.74.0", Addresses: []string{"aws_vpc.newer"}},
+	}, actualPlan.Upgrades)
+}
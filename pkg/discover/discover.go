@@ -0,0 +1,327 @@
+// Package discover finds AWS resources by their tags via the Resource Groups Tagging API,
+// to destroy resources that aren't part of any state (e.g., orphans of deleted states).
+package discover
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+)
+
+// Resource is a discovered resource whose Terraform type and import ID are known by its ARN.
+type Resource struct {
+	ARN  string
+	Type string
+	// ID is the ID the resource is imported with by the Terraform AWS Provider (e.g., the name of an S3 bucket).
+	ID string
+}
+
+// Undestroyable is a discovered resource that can't be destroyed, since its ARN can't be mapped to a Terraform
+// type and import ID (see Types).
+type Undestroyable struct {
+	ARN string
+	// ResourceType is the service and resource type of the ARN (e.g., ec2:key-pair).
+	ResourceType string
+}
+
+// Result are the discovered resources, sorted by ARN.
+type Result struct {
+	Resources     []Resource
+	Undestroyable []Undestroyable
+}
+
+// arnType maps the ARNs of resources of a service and resource type to a Terraform type.
+type arnType struct {
+	terraformType string
+	service       string
+	// resourceType is the part of the resource of an ARN that precedes the ID (e.g., instance for instance/i-1234),
+	// which is empty for services whose ARNs only have an ID (e.g., S3 buckets).
+	resourceType string
+	// importID returns the import ID of a resource by its ARN and the part of its resource following the resource type.
+	// Returns false if the ARN isn't the one of a resource of this Terraform type. If nil, the ID is the import ID.
+	importID func(a arn.ARN, id string) (string, bool)
+}
+
+//nolint:gochecknoglobals
+var (
+	// arnTypes lists the Terraform types whose resources can be discovered. If several types map
+	// ARNs of the same resource type, the first one whose importID accepts an ARN is used.
+	arnTypes = []arnType{
+		{terraformType: "aws_instance", service: "ec2", resourceType: "instance"},
+		{terraformType: "aws_nat_gateway", service: "ec2", resourceType: "natgateway"},
+		{terraformType: "aws_vpc", service: "ec2", resourceType: "vpc"},
+		{terraformType: "aws_subnet", service: "ec2", resourceType: "subnet"},
+		{terraformType: "aws_security_group", service: "ec2", resourceType: "security-group"},
+		{terraformType: "aws_internet_gateway", service: "ec2", resourceType: "internet-gateway"},
+		{terraformType: "aws_route_table", service: "ec2", resourceType: "route-table"},
+		{terraformType: "aws_eip", service: "ec2", resourceType: "elastic-ip"},
+		{terraformType: "aws_ebs_volume", service: "ec2", resourceType: "volume"},
+		{terraformType: "aws_launch_template", service: "ec2", resourceType: "launch-template"},
+		{terraformType: "aws_s3_bucket", service: "s3"},
+		{terraformType: "aws_lambda_function", service: "lambda", resourceType: "function", importID: withoutQualifier},
+		{terraformType: "aws_dynamodb_table", service: "dynamodb", resourceType: "table"},
+		{terraformType: "aws_sqs_queue", service: "sqs", importID: queueURL},
+		{terraformType: "aws_sns_topic", service: "sns", importID: fullARN},
+		{terraformType: "aws_cloudwatch_log_group", service: "logs", resourceType: "log-group",
+			importID: withoutQualifier},
+		{terraformType: "aws_kms_key", service: "kms", resourceType: "key"},
+		{terraformType: "aws_secretsmanager_secret", service: "secretsmanager", resourceType: "secret",
+			importID: fullARN},
+		{terraformType: "aws_ecr_repository", service: "ecr", resourceType: "repository"},
+		{terraformType: "aws_db_instance", service: "rds", resourceType: "db"},
+		{terraformType: "aws_rds_cluster", service: "rds", resourceType: "cluster"},
+		{terraformType: "aws_lb", service: "elasticloadbalancing", resourceType: "loadbalancer", importID: lbARN},
+		{terraformType: "aws_elb", service: "elasticloadbalancing", resourceType: "loadbalancer", importID: elbName},
+		{terraformType: "aws_lb_target_group", service: "elasticloadbalancing", resourceType: "targetgroup",
+			importID: fullARN},
+		{terraformType: "aws_eks_cluster", service: "eks", resourceType: "cluster"},
+		{terraformType: "aws_ecs_cluster", service: "ecs", resourceType: "cluster"},
+		{terraformType: "aws_efs_file_system", service: "elasticfilesystem", resourceType: "file-system"},
+		{terraformType: "aws_cloudfront_distribution", service: "cloudfront", resourceType: "distribution"},
+		{terraformType: "aws_sfn_state_machine", service: "states", resourceType: "stateMachine", importID: fullARN},
+	}
+)
+
+// fullARN returns the ARN as import ID.
+func fullARN(a arn.ARN, _ string) (string, bool) {
+	return a.String(), true
+}
+
+// withoutQualifier returns the ID without a qualifier (e.g., the version of a Lambda function or the trailing :*
+// of a log group).
+func withoutQualifier(_ arn.ARN, id string) (string, bool) {
+	return strings.SplitN(id, ":", 2)[0], true
+}
+
+// queueURL returns the URL of an SQS queue as import ID.
+func queueURL(a arn.ARN, id string) (string, bool) {
+	return fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", a.Region, a.AccountID, id), true
+}
+
+// lbARN returns the ARN of an application, network, or gateway load balancer as import ID.
+func lbARN(a arn.ARN, id string) (string, bool) {
+	for _, prefix := range []string{"app/", "net/", "gwy/"} {
+		if strings.HasPrefix(id, prefix) {
+			return a.String(), true
+		}
+	}
+
+	return "", false
+}
+
+// elbName returns the name of a classic load balancer as import ID.
+func elbName(_ arn.ARN, id string) (string, bool) {
+	if strings.Contains(id, "/") {
+		return "", false
+	}
+
+	return id, true
+}
+
+// Types returns the Terraform types whose resources can be discovered (sorted).
+func Types() []string {
+	var result []string
+
+	for _, t := range arnTypes {
+		result = append(result, t.terraformType)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// ParseTags parses a comma-separated list of tags (e.g., ephemeral=true,team=platform) as tag filters.
+// A tag without value (e.g., ephemeral) matches resources with any value of the tag.
+func ParseTags(list string) (map[string][]string, error) {
+	result := map[string][]string{}
+
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("expected key=value, got: %s", pair)
+		}
+
+		if _, ok := result[kv[0]]; !ok {
+			result[kv[0]] = nil
+		}
+
+		if len(kv) == 2 {
+			result[kv[0]] = append(result[kv[0]], kv[1])
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no tags given")
+	}
+
+	return result, nil
+}
+
+// Discover returns the resources with all the given tags (see ParseTags) in the region of the session.
+// If types are given, only resources of these Terraform types are discovered (see Types);
+// otherwise, all tagged resources are, including the ones that can't be destroyed.
+func Discover(ctx context.Context, sess *session.Session, tags map[string][]string,
+	types []string) (*Result, error) {
+	selected := map[string]bool{}
+
+	var resourceTypeFilters []string
+
+	for _, terraformType := range types {
+		t, ok := lookupType(terraformType)
+		if !ok {
+			return nil, fmt.Errorf("resources of type %s can't be discovered (supported types: %s)",
+				terraformType, strings.Join(Types(), ", "))
+		}
+
+		selected[terraformType] = true
+
+		filter := t.service
+		if t.resourceType != "" {
+			filter += ":" + t.resourceType
+		}
+
+		if !contains(resourceTypeFilters, filter) {
+			resourceTypeFilters = append(resourceTypeFilters, filter)
+		}
+	}
+
+	input := &resourcegroupstaggingapi.GetResourcesInput{TagFilters: tagFilters(tags)}
+
+	if len(resourceTypeFilters) > 0 {
+		input.ResourceTypeFilters = aws.StringSlice(resourceTypeFilters)
+	}
+
+	result := &Result{}
+
+	err := resourcegroupstaggingapi.New(sess).GetResourcesPagesWithContext(ctx, input,
+		func(page *resourcegroupstaggingapi.GetResourcesOutput, _ bool) bool {
+			for _, mapping := range page.ResourceTagMappingList {
+				r, u := fromARN(aws.StringValue(mapping.ResourceARN))
+
+				switch {
+				case u != nil:
+					result.Undestroyable = append(result.Undestroyable, *u)
+				case len(selected) == 0 || selected[r.Type]:
+					result.Resources = append(result.Resources, *r)
+				}
+			}
+
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result.Resources, func(i, j int) bool {
+		return result.Resources[i].ARN < result.Resources[j].ARN
+	})
+
+	sort.Slice(result.Undestroyable, func(i, j int) bool {
+		return result.Undestroyable[i].ARN < result.Undestroyable[j].ARN
+	})
+
+	return result, nil
+}
+
+// tagFilters returns the filters of resources with all of the given tags, sorted by key.
+func tagFilters(tags map[string][]string) []*resourcegroupstaggingapi.TagFilter {
+	var keys []string
+
+	for key := range tags {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var result []*resourcegroupstaggingapi.TagFilter
+
+	for _, key := range keys {
+		result = append(result, &resourcegroupstaggingapi.TagFilter{
+			Key:    aws.String(key),
+			Values: aws.StringSlice(tags[key]),
+		})
+	}
+
+	return result
+}
+
+// fromARN returns the resource of the given ARN, or (if its Terraform type or import ID isn't known)
+// the undestroyable resource.
+func fromARN(value string) (*Resource, *Undestroyable) {
+	a, err := arn.Parse(value)
+	if err != nil {
+		return nil, &Undestroyable{ARN: value, ResourceType: "unknown"}
+	}
+
+	resourceType, id := splitResource(a.Resource)
+
+	for _, t := range arnTypes {
+		if t.service != a.Service || t.resourceType != resourceType {
+			continue
+		}
+
+		importID := id
+
+		if t.importID != nil {
+			var ok bool
+
+			importID, ok = t.importID(a, id)
+			if !ok {
+				continue
+			}
+		}
+
+		return &Resource{ARN: value, Type: t.terraformType, ID: importID}, nil
+	}
+
+	if resourceType == "" {
+		return nil, &Undestroyable{ARN: value, ResourceType: a.Service}
+	}
+
+	return nil, &Undestroyable{ARN: value, ResourceType: a.Service + ":" + resourceType}
+}
+
+// splitResource splits the resource of an ARN into the resource type and ID, which are separated
+// by the first slash or colon (e.g., instance/i-1234 or function:my-function). Resources without separator
+// (e.g., of S3 buckets) only have an ID.
+func splitResource(resource string) (string, string) {
+	i := strings.IndexAny(resource, "/:")
+	if i < 0 {
+		return "", resource
+	}
+
+	return resource[:i], resource[i+1:]
+}
+
+// lookupType returns the mapping of the given Terraform type.
+func lookupType(terraformType string) (arnType, bool) {
+	for _, t := range arnTypes {
+		if t.terraformType == terraformType {
+			return t, true
+		}
+	}
+
+	return arnType{}, false
+}
+
+func contains(elements []string, e string) bool {
+	for _, element := range elements {
+		if element == e {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,231 @@
+package discover_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/pkg/discover"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// taggedARNs are the ARNs of the resources with the tags ephemeral=true served by a fake tagging API,
+// in two pages.
+var taggedARNs = [][]string{ //nolint:gochecknoglobals
+	{
+		"arn:aws:ec2:us-west-2:123456789012:instance/i-1234",
+		"arn:aws:s3:::my-bucket",
+		"arn:aws:ec2:us-west-2:123456789012:key-pair/key-1234",
+		"arn:aws:lambda:us-west-2:123456789012:function:my-function",
+	},
+	{
+		"arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/my-lb/50dc6c495c0c9188",
+		"arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/my-classic-lb",
+		"arn:aws:sqs:us-west-2:123456789012:my-queue",
+		"arn:aws:ec2:us-west-2:123456789012:natgateway/nat-1234",
+	},
+}
+
+// getResourcesRequest is the part of a request of the fake tagging API that is checked.
+type getResourcesRequest struct {
+	PaginationToken     string
+	ResourceTypeFilters []string
+	TagFilters          []struct {
+		Key    string
+		Values []string
+	}
+}
+
+// taggingAPI returns a session of a fake tagging API serving the taggedARNs, which records the requests.
+func taggingAPI(t *testing.T, requests *[]getResourcesRequest) *session.Session {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var r getResourcesRequest
+
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&r))
+
+		*requests = append(*requests, r)
+
+		page, next := 0, "page-2"
+		if r.PaginationToken == next {
+			page, next = 1, ""
+		}
+
+		var mappings []map[string]string
+
+		for _, a := range taggedARNs[page] {
+			mappings = append(mappings, map[string]string{"ResourceARN": a})
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"PaginationToken":        next,
+			"ResourceTagMappingList": mappings,
+		}))
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-west-2"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	return sess
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name                        string
+		types                       []string
+		expectedResourceTypeFilters []string
+		expectedResources           []discover.Resource
+		expectedUndestroyable       []discover.Undestroyable
+		expectedErrMsg              string
+	}{
+		{
+			name: "all types",
+			expectedResources: []discover.Resource{
+				{ARN: "arn:aws:ec2:us-west-2:123456789012:instance/i-1234", Type: "aws_instance", ID: "i-1234"},
+				{ARN: "arn:aws:ec2:us-west-2:123456789012:natgateway/nat-1234", Type: "aws_nat_gateway",
+					ID: "nat-1234"},
+				{ARN: "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/my-lb/50dc6c495c0c9188",
+					Type: "aws_lb",
+					ID:   "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/my-lb/50dc6c495c0c9188"},
+				{ARN: "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/my-classic-lb",
+					Type: "aws_elb", ID: "my-classic-lb"},
+				{ARN: "arn:aws:lambda:us-west-2:123456789012:function:my-function", Type: "aws_lambda_function",
+					ID: "my-function"},
+				{ARN: "arn:aws:s3:::my-bucket", Type: "aws_s3_bucket", ID: "my-bucket"},
+				{ARN: "arn:aws:sqs:us-west-2:123456789012:my-queue", Type: "aws_sqs_queue",
+					ID: "https://sqs.us-west-2.amazonaws.com/123456789012/my-queue"},
+			},
+			expectedUndestroyable: []discover.Undestroyable{
+				{ARN: "arn:aws:ec2:us-west-2:123456789012:key-pair/key-1234", ResourceType: "ec2:key-pair"},
+			},
+		},
+		{
+			name:                        "selected types",
+			types:                       []string{"aws_instance", "aws_s3_bucket", "aws_lb", "aws_nat_gateway"},
+			expectedResourceTypeFilters: []string{"ec2:instance", "s3", "elasticloadbalancing:loadbalancer", "ec2:natgateway"},
+			expectedResources: []discover.Resource{
+				{ARN: "arn:aws:ec2:us-west-2:123456789012:instance/i-1234", Type: "aws_instance", ID: "i-1234"},
+				{ARN: "arn:aws:ec2:us-west-2:123456789012:natgateway/nat-1234", Type: "aws_nat_gateway",
+					ID: "nat-1234"},
+				{ARN: "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/my-lb/50dc6c495c0c9188",
+					Type: "aws_lb",
+					ID:   "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/my-lb/50dc6c495c0c9188"},
+				{ARN: "arn:aws:s3:::my-bucket", Type: "aws_s3_bucket", ID: "my-bucket"},
+			},
+			// the fake API doesn't filter by type, so the key pair is still returned
+			expectedUndestroyable: []discover.Undestroyable{
+				{ARN: "arn:aws:ec2:us-west-2:123456789012:key-pair/key-1234", ResourceType: "ec2:key-pair"},
+			},
+		},
+		{
+			name:           "unsupported type",
+			types:          []string{"aws_key_pair"},
+			expectedErrMsg: "resources of type aws_key_pair can't be discovered",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []getResourcesRequest
+
+			sess := taggingAPI(t, &requests)
+
+			actual, err := discover.Discover(context.Background(), sess,
+				map[string][]string{"ephemeral": {"true"}}, tc.types)
+
+			if tc.expectedErrMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrMsg)
+				assert.Empty(t, requests)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedResources, actual.Resources)
+			assert.Equal(t, tc.expectedUndestroyable, actual.Undestroyable)
+
+			require.Len(t, requests, 2)
+			assert.Equal(t, tc.expectedResourceTypeFilters, requests[0].ResourceTypeFilters)
+			require.Len(t, requests[0].TagFilters, 1)
+			assert.Equal(t, "ephemeral", requests[0].TagFilters[0].Key)
+			assert.Equal(t, []string{"true"}, requests[0].TagFilters[0].Values)
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		list           string
+		expected       map[string][]string
+		expectedErrMsg string
+	}{
+		{
+			list:     "ephemeral=true",
+			expected: map[string][]string{"ephemeral": {"true"}},
+		},
+		{
+			list:     "ephemeral=true, team=a,team=b,owner",
+			expected: map[string][]string{"ephemeral": {"true"}, "team": {"a", "b"}, "owner": nil},
+		},
+		{
+			list:           "=true",
+			expectedErrMsg: "expected key=value, got: =true",
+		},
+		{
+			list:           "",
+			expectedErrMsg: "no tags given",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.list, func(t *testing.T) {
+			actual, err := discover.ParseTags(tc.list)
+
+			if tc.expectedErrMsg != "" {
+				require.EqualError(t, err, tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestResult_WriteCSV(t *testing.T) {
+	result := discover.Result{
+		Resources: []discover.Resource{
+			{ARN: "arn:aws:ec2:us-west-2:123456789012:instance/i-1234", Type: "aws_instance", ID: "i-1234"},
+			{ARN: "arn:aws:s3:::my-bucket", Type: "aws_s3_bucket", ID: "my-bucket"},
+		},
+		Undestroyable: []discover.Undestroyable{
+			{ARN: "arn:aws:ec2:us-west-2:123456789012:key-pair/key-1234", ResourceType: "ec2:key-pair"},
+		},
+	}
+
+	var b bytes.Buffer
+
+	require.NoError(t, result.WriteCSV(&b))
+
+	assert.Equal(t, fmt.Sprintf("%s\n%s\n%s\n%s\n",
+		"type,id",
+		"aws_instance,i-1234",
+		"aws_s3_bucket,my-bucket",
+		"# not destroyable (ec2:key-pair): arn:aws:ec2:us-west-2:123456789012:key-pair/key-1234"), b.String())
+}
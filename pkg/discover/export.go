@@ -0,0 +1,38 @@
+package discover
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// WriteCSV writes the discovered resources as file of resource IDs (type,id rows), which can be reviewed
+// and then destroyed with the adopt-and-destroy command (see state.FromIDs). The resources that can't be destroyed
+// are listed as comments.
+func (r Result) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"type", "id"}); err != nil {
+		return err
+	}
+
+	for _, resource := range r.Resources {
+		if err := writer.Write([]string{resource.Type, resource.ID}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	for _, u := range r.Undestroyable {
+		if _, err := fmt.Fprintf(w, "# not destroyable (%s): %s\n", u.ResourceType, u.ARN); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package discover
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+)
+
+// TaggedResource is a resource found by its tags (see Tagged), together with all its tags.
+type TaggedResource struct {
+	ARN  string            `json:"arn"`
+	Tags map[string]string `json:"tags"`
+	// Type is the Terraform type guessed from the ARN, which is empty if the ARN can't be mapped (see Types).
+	Type string `json:"type,omitempty"`
+	// ID is the ID the resource would be imported with (empty if the type is unknown).
+	ID string `json:"id,omitempty"`
+	// ResourceType is the service and resource type of the ARN (e.g., ec2:key-pair) if the type is unknown.
+	ResourceType string `json:"resource_type,omitempty"`
+}
+
+// Tagged returns all resources with all the given tags (see ParseTags) in the region of the session,
+// sorted by ARN. In contrast to Discover, the resources are only listed (e.g., to be reviewed), so that
+// the ones that can't be destroyed are returned alike.
+func Tagged(ctx context.Context, sess *session.Session, tags map[string][]string) ([]TaggedResource, error) {
+	var result []TaggedResource
+
+	err := resourcegroupstaggingapi.New(sess).GetResourcesPagesWithContext(ctx,
+		&resourcegroupstaggingapi.GetResourcesInput{TagFilters: tagFilters(tags)},
+		func(page *resourcegroupstaggingapi.GetResourcesOutput, _ bool) bool {
+			for _, mapping := range page.ResourceTagMappingList {
+				tagged := TaggedResource{ARN: aws.StringValue(mapping.ResourceARN), Tags: map[string]string{}}
+
+				for _, tag := range mapping.Tags {
+					tagged.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+				}
+
+				r, u := fromARN(tagged.ARN)
+				if u != nil {
+					tagged.ResourceType = u.ResourceType
+				} else {
+					tagged.Type, tagged.ID = r.Type, r.ID
+				}
+
+				result = append(result, tagged)
+			}
+
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ARN < result[j].ARN
+	})
+
+	return result, nil
+}
@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// AWSConfig configures the Terraform AWS Provider.
+type AWSConfig struct {
+	// Region is the AWS region to destroy resources in (defaults to the AWS_REGION environment variable).
+	Region string
+	// EndpointURL is a custom endpoint URL used for all services (e.g., "http://localhost:4566" for LocalStack).
+	EndpointURL string
+	// Endpoints maps service names (e.g., "sts") to custom endpoint URLs, which take precedence over EndpointURL.
+	// Endpoints of services not set here are resolved by the partition of the region.
+	Endpoints map[string]string
+	// MFAToken is the MFA token code used to assume a role that requires MFA.
+	// If not set, the token code is prompted for on the terminal when needed.
+	MFAToken string
+	// AssumeRoleARN is the ARN of a role (e.g., of another account) that is assumed with the credentials resolved
+	// from the environment (see NewSession).
+	AssumeRoleARN string
+	// Credentials are passed to the provider as static credentials, if set (see NewSession).
+	// Otherwise, the provider resolves credentials itself from the environment.
+	Credentials *credentials.Credentials
+}
+
+// ParseEndpointURL parses the value of the -aws-endpoint-url flag, which is either a single URL used for all services
+// or a comma-separated list of service=URL pairs (e.g., "sts=http://localhost:4566,ec2=http://localhost:4566").
+func (c *AWSConfig) ParseEndpointURL(value string) error {
+	if !strings.Contains(value, "=") {
+		c.EndpointURL = value
+
+		return nil
+	}
+
+	endpointURLs := map[string]string{}
+
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("expected service=URL, got: %s", pair)
+		}
+
+		endpointURLs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	c.Endpoints = endpointURLs
+
+	return nil
+}
+
+// hasCustomEndpoints returns true if any custom endpoint is configured.
+func (c AWSConfig) hasCustomEndpoints() bool {
+	return c.EndpointURL != "" || len(c.Endpoints) > 0
+}
+
+// EndpointResolver returns a resolver for the AWS SDK that uses the configured custom endpoints,
+// so that API calls made by terradozer itself go to the same endpoints as the provider's.
+func (c AWSConfig) EndpointResolver() endpoints.Resolver {
+	return endpoints.ResolverFunc(func(service, region string,
+		opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if url, ok := c.Endpoints[service]; ok {
+			return endpoints.ResolvedEndpoint{URL: url, SigningRegion: region}, nil
+		}
+
+		if c.EndpointURL != "" {
+			return endpoints.ResolvedEndpoint{URL: c.EndpointURL, SigningRegion: region}, nil
+		}
+
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	})
+}
+
+// ProviderConfig returns the configuration for the Terraform AWS Provider,
+// which conforms to the given (provider) schema.
+//
+// For regions outside of the standard AWS partition (e.g., GovCloud or China),
+// region validation is skipped and the STS endpoint of the region's partition is used.
+//
+// If credentials are set, they are passed as static credentials to the provider.
+// If custom endpoints are configured, credential validation and the account ID lookup are skipped,
+// so that the provider also configures cleanly against an emulator, such as LocalStack.
+func (c AWSConfig) ProviderConfig(schema *configschema.Block) (cty.Value, error) {
+	region := c.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+
+	config := map[string]cty.Value{
+		"access_key":                  cty.StringVal(os.Getenv("AWS_ACCESS_KEY_ID")),
+		"allowed_account_ids":         cty.UnknownVal(cty.DynamicPseudoType),
+		"assume_role":                 cty.UnknownVal(cty.DynamicPseudoType),
+		"default_tags":                cty.UnknownVal(cty.DynamicPseudoType),
+		"endpoints":                   cty.UnknownVal(cty.DynamicPseudoType),
+		"forbidden_account_ids":       cty.UnknownVal(cty.DynamicPseudoType),
+		"ignore_tag_prefixes":         cty.UnknownVal(cty.DynamicPseudoType),
+		"ignore_tags":                 cty.UnknownVal(cty.DynamicPseudoType),
+		"insecure":                    cty.UnknownVal(cty.DynamicPseudoType),
+		"max_retries":                 cty.UnknownVal(cty.DynamicPseudoType),
+		"profile":                     cty.StringVal(os.Getenv("AWS_PROFILE")),
+		"region":                      cty.StringVal(region),
+		"s3_force_path_style":         cty.UnknownVal(cty.DynamicPseudoType),
+		"secret_key":                  cty.StringVal(os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		"shared_credentials_file":     cty.StringVal(os.Getenv("AWS_SHARED_CREDENTIALS_FILE")),
+		"skip_credentials_validation": cty.UnknownVal(cty.DynamicPseudoType),
+		"skip_get_ec2_platforms":      cty.UnknownVal(cty.DynamicPseudoType),
+		"skip_metadata_api_check":     cty.UnknownVal(cty.DynamicPseudoType),
+		"skip_region_validation":      cty.UnknownVal(cty.DynamicPseudoType),
+		"skip_requesting_account_id":  cty.UnknownVal(cty.DynamicPseudoType),
+		"token":                       cty.StringVal(os.Getenv("AWS_SESSION_TOKEN")),
+	}
+
+	if c.Credentials != nil {
+		credentialsConfig, err := c.credentialsConfig()
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		for k, v := range credentialsConfig {
+			config[k] = v
+		}
+	}
+
+	endpointURLs := map[string]string{}
+
+	partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+	if ok && partition.ID() != endpoints.AwsPartitionID {
+		config["skip_region_validation"] = cty.True
+	}
+
+	if ok && partition.ID() != endpoints.AwsPartitionID && c.EndpointURL == "" {
+		stsEndpoint, err := partition.EndpointFor("sts", region)
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("failed to resolve STS endpoint (partition=%s, region=%s): %s",
+				partition.ID(), region, err)
+		}
+
+		endpointURLs["sts"] = stsEndpoint.URL
+	}
+
+	for service, url := range c.Endpoints {
+		endpointURLs[service] = url
+	}
+
+	if c.hasCustomEndpoints() {
+		config["skip_credentials_validation"] = cty.True
+		config["skip_requesting_account_id"] = cty.True
+		config["skip_metadata_api_check"] = cty.True
+		config["s3_force_path_style"] = cty.True
+	}
+
+	if len(endpointURLs) > 0 || c.EndpointURL != "" {
+		endpointsConfig, err := endpointsBlock(schema, endpointURLs, c.EndpointURL)
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		config["endpoints"] = endpointsConfig
+	}
+
+	return cty.ObjectVal(config), nil
+}
+
+// endpointsBlock returns the value of the "endpoints" block of the provider configuration,
+// where all services not given in endpointURLs are set to defaultURL (or null, if defaultURL is empty).
+func endpointsBlock(schema *configschema.Block, endpointURLs map[string]string,
+	defaultURL string) (cty.Value, error) {
+	if schema == nil {
+		return cty.NilVal, fmt.Errorf("provider schema is missing")
+	}
+
+	blockSchema, ok := schema.BlockTypes["endpoints"]
+	if !ok {
+		return cty.NilVal, fmt.Errorf("provider schema has no endpoints block")
+	}
+
+	for service := range endpointURLs {
+		if _, ok := blockSchema.Attributes[service]; !ok {
+			return cty.NilVal, fmt.Errorf("endpoint of unsupported service: %s", service)
+		}
+	}
+
+	attrs := map[string]cty.Value{}
+
+	for name, attrSchema := range blockSchema.Attributes {
+		url, ok := endpointURLs[name]
+		if !ok {
+			url = defaultURL
+		}
+
+		if url == "" {
+			attrs[name] = cty.NullVal(attrSchema.Type)
+			continue
+		}
+
+		attrs[name] = cty.StringVal(url)
+	}
+
+	return cty.SetVal([]cty.Value{cty.ObjectVal(attrs)}), nil
+}
@@ -0,0 +1,277 @@
+package provider_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestAWSConfig_ProviderConfig(t *testing.T) {
+	schema := &configschema.Block{
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"endpoints": {
+				Nesting: configschema.NestingSet,
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"ec2": {Type: cty.String, Optional: true},
+						"sts": {Type: cty.String, Optional: true},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name                       string
+		config                     provider.AWSConfig
+		expectedEndpoints          map[string]cty.Value
+		expectSkipRegionValidation bool
+		expectSkipCredentials      bool
+		expectedErr                string
+	}{
+		{
+			name:   "standard partition",
+			config: provider.AWSConfig{Region: "us-east-1"},
+		},
+		{
+			name:   "GovCloud partition",
+			config: provider.AWSConfig{Region: "us-gov-west-1"},
+			expectedEndpoints: map[string]cty.Value{
+				"ec2": cty.NullVal(cty.String),
+				"sts": cty.StringVal("https://sts.us-gov-west-1.amazonaws.com"),
+			},
+			expectSkipRegionValidation: true,
+		},
+		{
+			name:   "China partition",
+			config: provider.AWSConfig{Region: "cn-north-1"},
+			expectedEndpoints: map[string]cty.Value{
+				"ec2": cty.NullVal(cty.String),
+				"sts": cty.StringVal("https://sts.cn-north-1.amazonaws.com.cn"),
+			},
+			expectSkipRegionValidation: true,
+		},
+		{
+			name: "custom endpoint overrides partition endpoint",
+			config: provider.AWSConfig{
+				Region:    "us-gov-east-1",
+				Endpoints: map[string]string{"sts": "https://sts.example.com"},
+			},
+			expectedEndpoints: map[string]cty.Value{
+				"ec2": cty.NullVal(cty.String),
+				"sts": cty.StringVal("https://sts.example.com"),
+			},
+			expectSkipRegionValidation: true,
+			expectSkipCredentials:      true,
+		},
+		{
+			name: "endpoint URL for all services",
+			config: provider.AWSConfig{
+				Region:      "us-east-1",
+				EndpointURL: "http://localhost:4566",
+			},
+			expectedEndpoints: map[string]cty.Value{
+				"ec2": cty.StringVal("http://localhost:4566"),
+				"sts": cty.StringVal("http://localhost:4566"),
+			},
+			expectSkipCredentials: true,
+		},
+		{
+			name: "endpoint URL for all services overrides partition endpoint",
+			config: provider.AWSConfig{
+				Region:      "cn-north-1",
+				EndpointURL: "http://localhost:4566",
+				Endpoints:   map[string]string{"ec2": "http://localhost:4567"},
+			},
+			expectedEndpoints: map[string]cty.Value{
+				"ec2": cty.StringVal("http://localhost:4567"),
+				"sts": cty.StringVal("http://localhost:4566"),
+			},
+			expectSkipRegionValidation: true,
+			expectSkipCredentials:      true,
+		},
+		{
+			name: "unsupported service",
+			config: provider.AWSConfig{
+				Region:    "us-east-1",
+				Endpoints: map[string]string{"foo": "https://foo.example.com"},
+			},
+			expectedErr: "endpoint of unsupported service: foo",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := tc.config.ProviderConfig(schema)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, cty.StringVal(tc.config.Region), actual.GetAttr("region"))
+
+			if tc.expectSkipRegionValidation {
+				assert.Equal(t, cty.True, actual.GetAttr("skip_region_validation"))
+			} else {
+				assert.False(t, actual.GetAttr("skip_region_validation").IsKnown())
+			}
+
+			for _, attr := range []string{"skip_credentials_validation", "skip_requesting_account_id"} {
+				if tc.expectSkipCredentials {
+					assert.Equal(t, cty.True, actual.GetAttr(attr))
+				} else {
+					assert.False(t, actual.GetAttr(attr).IsKnown())
+				}
+			}
+
+			if tc.expectedEndpoints == nil {
+				assert.False(t, actual.GetAttr("endpoints").IsKnown())
+				return
+			}
+
+			assert.Equal(t, cty.SetVal([]cty.Value{cty.ObjectVal(tc.expectedEndpoints)}), actual.GetAttr("endpoints"))
+		})
+	}
+}
+
+func TestAWSConfig_ParseEndpointURL(t *testing.T) {
+	tests := []struct {
+		name                string
+		value               string
+		expectedEndpointURL string
+		expectedEndpoints   map[string]string
+		expectedErr         string
+	}{
+		{
+			name:                "single URL",
+			value:               "http://localhost:4566",
+			expectedEndpointURL: "http://localhost:4566",
+		},
+		{
+			name:  "per-service URLs",
+			value: "sts=http://localhost:4566, ec2=http://localhost:4567",
+			expectedEndpoints: map[string]string{
+				"sts": "http://localhost:4566",
+				"ec2": "http://localhost:4567",
+			},
+		},
+		{
+			name:        "missing URL",
+			value:       "sts=http://localhost:4566,ec2=",
+			expectedErr: "expected service=URL, got: ec2=",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual provider.AWSConfig
+
+			err := actual.ParseEndpointURL(tc.value)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedEndpointURL, actual.EndpointURL)
+			assert.Equal(t, tc.expectedEndpoints, actual.Endpoints)
+		})
+	}
+}
+
+func TestAWSConfig_ProviderConfig_Credentials(t *testing.T) {
+	config := provider.AWSConfig{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", "session-token"),
+	}
+
+	actual, err := config.ProviderConfig(&configschema.Block{})
+	require.NoError(t, err)
+
+	assert.Equal(t, cty.StringVal("AKIDEXAMPLE"), actual.GetAttr("access_key"))
+	assert.Equal(t, cty.StringVal("secret"), actual.GetAttr("secret_key"))
+	assert.Equal(t, cty.StringVal("session-token"), actual.GetAttr("token"))
+}
+
+type expiredSSOProvider struct{}
+
+func (expiredSSOProvider) Retrieve() (credentials.Value, error) {
+	return credentials.Value{}, awserr.New(ssocreds.ErrCodeSSOProviderInvalidToken,
+		"the SSO session has expired or is invalid", nil)
+}
+
+func (expiredSSOProvider) IsExpired() bool {
+	return true
+}
+
+func TestAWSConfig_ProviderConfig_ExpiredSSOSession(t *testing.T) {
+	config := provider.AWSConfig{
+		Region:      "us-east-1",
+		Credentials: credentials.NewCredentials(expiredSSOProvider{}),
+	}
+
+	_, err := config.ProviderConfig(&configschema.Block{})
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "run `aws sso login` to start a new session")
+}
+
+func TestAWSConfig_ProviderConfig_WebIdentity(t *testing.T) {
+	config := provider.AWSConfig{
+		Region: "us-east-1",
+		Credentials: stscreds.NewWebIdentityCredentials(session.Must(session.NewSession()),
+			"arn:aws:iam::123456789012:role/terradozer", "terradozer", "does-not-exist"),
+	}
+
+	_, err := config.ProviderConfig(&configschema.Block{})
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "check AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+}
+
+func TestAWSConfig_NewSession_AssumeRole(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	var roleARN string
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		roleARN = r.Form.Get("RoleArn")
+
+		fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>ASSUMED</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`)
+	}))
+	defer sts.Close()
+
+	config := provider.AWSConfig{
+		Region:        "us-east-1",
+		Endpoints:     map[string]string{"sts": sts.URL},
+		AssumeRoleARN: "arn:aws:iam::111111111111:role/terradozer",
+	}
+
+	sess, err := config.NewSession()
+	require.NoError(t, err)
+
+	creds, err := sess.Config.Credentials.Get()
+	require.NoError(t, err)
+
+	assert.Equal(t, "ASSUMED", creds.AccessKeyID)
+	assert.Equal(t, "arn:aws:iam::111111111111:role/terradozer", roleARN)
+}
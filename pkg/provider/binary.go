@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/plugin/discovery"
+	goHomeDir "github.com/mitchellh/go-homedir"
+)
+
+// Source is where the plugin binary of a provider comes from (see Binary).
+type Source string
+
+const (
+	// SourceDownloaded is a binary that has been downloaded from the registry by the run.
+	SourceDownloaded Source = "downloaded"
+	// SourceCache is a binary that has already been installed into the install directory (e.g., by a previous run).
+	SourceCache Source = "cache"
+)
+
+// LockStatus is whether the plugin binary of a provider matches the hashes of a dependency lock file.
+type LockStatus string
+
+const (
+	// LockMatched means that the binary matches one of the hashes of the lock file.
+	LockMatched LockStatus = "matched"
+	// LockMismatched means that the binary doesn't match any of the hashes of the lock file.
+	LockMismatched LockStatus = "mismatched"
+)
+
+// Binary is the plugin binary of a provider, e.g., the one that has performed the deletions of a run
+// (see Config.Installed).
+type Binary struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Path    string `json:"path"`
+	// SHA256 is the checksum of the binary (in hex).
+	SHA256 string `json:"sha256"`
+	Source Source `json:"source"`
+	// Lock is whether the binary matches the hashes of the provider in the dependency lock file (empty if there is
+	// no lock file, or it locks another version of the provider or no hashes).
+	Lock LockStatus `json:"lock,omitempty"`
+	// LockError is why the binary doesn't match the lock file (empty unless mismatched).
+	LockError string `json:"lock_error,omitempty"`
+}
+
+// newBinary returns the binary of the given installed provider.
+func newBinary(meta discovery.PluginMeta, source Source) (Binary, error) {
+	sum, err := fileSHA256(meta.Path)
+	if err != nil {
+		return Binary{}, fmt.Errorf("failed to hash provider %s: %s", meta.Name, err)
+	}
+
+	return Binary{
+		Name:    meta.Name,
+		Version: "v" + strings.TrimPrefix(string(meta.Version), "v"),
+		Path:    meta.Path,
+		SHA256:  sum,
+		Source:  source,
+	}, nil
+}
+
+// InstalledBinaries returns the binaries of the providers installed in the given directory (e.g., by previous
+// runs), ordered by name and version. Each binary is checked against the given locked providers (can be nil;
+// see VerifyLocked).
+func InstalledBinaries(installDir string, locked map[string]LockedProvider) ([]Binary, error) {
+	expandedInstallDir, err := goHomeDir.Expand(installDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var binaries []Binary
+
+	for meta := range discovery.FindPlugins("provider", []string{expandedInstallDir}) {
+		b, err := newBinary(meta, SourceCache)
+		if err != nil {
+			return nil, err
+		}
+
+		b.checkLock(locked, archiveShasum)
+		binaries = append(binaries, b)
+	}
+
+	sort.Slice(binaries, func(i, j int) bool {
+		if binaries[i].Name != binaries[j].Name {
+			return binaries[i].Name < binaries[j].Name
+		}
+
+		vi, errI := discovery.VersionStr(binaries[i].Version).Parse()
+		vj, errJ := discovery.VersionStr(binaries[j].Version).Parse()
+
+		if errI != nil || errJ != nil {
+			return binaries[i].Version < binaries[j].Version
+		}
+
+		return vj.NewerThan(vi)
+	})
+
+	return binaries, nil
+}
+
+// checkLock sets whether the binary matches the hashes of its provider in the given locked providers, if they lock
+// the version of the binary (see verifyHashes).
+func (b *Binary) checkLock(locked map[string]LockedProvider,
+	shasum func(providerName, version string) (string, error)) {
+	l, ok := locked[b.Name]
+	if !ok || l.Version != b.Version || len(l.Hashes) == 0 {
+		return
+	}
+
+	if err := verifyHashes(b.Name, l, b.Path, shasum); err != nil {
+		b.Lock = LockMismatched
+		b.LockError = err.Error()
+
+		return
+	}
+
+	b.Lock = LockMatched
+}
+
+// fileSHA256 returns the SHA-256 checksum (in hex) of the file at the given path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
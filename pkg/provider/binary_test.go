@@ -0,0 +1,60 @@
+package provider_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstalledBinaries(t *testing.T) {
+	installDir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"terraform-provider-aws_v3.42.0_x5":   "fake provider",
+		"terraform-provider-aws_v3.9.0_x5":    "fake provider",
+		"terraform-provider-random_v3.1.0_x5": "fake random provider",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(installDir, name), []byte(content), 0600))
+	}
+
+	locked := map[string]provider.LockedProvider{
+		// the hash of the fake aws binary
+		"aws":    {Version: "v3.42.0", Hashes: []string{"h1:TM3OYsCTHsJXGUHJoQkG0SzBkmkEUx0Ej/g+O7lrYvY="}},
+		"random": {Version: "v3.1.0", Hashes: []string{"h1:TM3OYsCTHsJXGUHJoQkG0SzBkmkEUx0Ej/g+O7lrYvY="}},
+	}
+
+	actual, err := provider.InstalledBinaries(installDir, locked)
+	require.NoError(t, err)
+
+	assert.Equal(t, []provider.Binary{
+		{
+			Name:    "aws",
+			Version: "v3.9.0",
+			Path:    filepath.Join(installDir, "terraform-provider-aws_v3.9.0_x5"),
+			SHA256:  "8824f5181ae64ad14e4fb155a79c2ab48ba54667725fa574b995638256e956a5",
+			Source:  provider.SourceCache,
+		},
+		{
+			Name:    "aws",
+			Version: "v3.42.0",
+			Path:    filepath.Join(installDir, "terraform-provider-aws_v3.42.0_x5"),
+			SHA256:  "8824f5181ae64ad14e4fb155a79c2ab48ba54667725fa574b995638256e956a5",
+			Source:  provider.SourceCache,
+			Lock:    provider.LockMatched,
+		},
+		{
+			Name:    "random",
+			Version: "v3.1.0",
+			Path:    filepath.Join(installDir, "terraform-provider-random_v3.1.0_x5"),
+			SHA256:  "be4dde49a6df143fde9ec64260159b46dd6b1f8d92e876b3de68b06208e98675",
+			Source:  provider.SourceCache,
+			Lock:    provider.LockMismatched,
+			LockError: "hash mismatch: provider random v3.1.0 (h1:A3EI1FAj1jCE2GP/AMLk3PsZHSf1lFAFQchwkgJh4LE=) " +
+				"doesn't match any of the hashes in the lock file",
+		},
+	}, actual)
+}
@@ -0,0 +1,268 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/providers"
+	goHomeDir "github.com/mitchellh/go-homedir"
+)
+
+// resourceTypesCacheFile returns the path of the file caching the resource types of a provider
+// (e.g., ~/.terradozer/resource-types-aws-v3.42.0.json).
+func resourceTypesCacheFile(installDir, providerName, providerVersion string) (string, error) {
+	expandedInstallDir, err := goHomeDir.Expand(installDir)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(expandedInstallDir,
+		fmt.Sprintf("resource-types-%s-%s.json", providerName, providerVersion)), nil
+}
+
+// cacheResourceTypes writes the names of the resource types of a launched provider into the install directory,
+// so that they can be read without launching the provider again (e.g., to complete flags in a shell).
+func cacheResourceTypes(installDir, providerName, providerVersion string, p Provider) {
+	path, err := resourceTypesCacheFile(installDir, providerName, providerVersion)
+	if err != nil {
+		return
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+
+	schema := p.GetSchema()
+	if schema.Diagnostics.HasErrors() {
+		return
+	}
+
+	var types []string
+
+	for t := range schema.ResourceTypes {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	data, err := json.Marshal(types)
+	if err != nil {
+		return
+	}
+
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		log.WithError(err).Debug("failed to cache resource types of provider")
+	}
+}
+
+// writeFileAtomic writes a file via a temporary file in the same directory, so that concurrent runs
+// never read a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// CachedResourceTypes returns the resource types of the supported providers, as cached in the install directory
+// when the providers have been launched before. No provider is launched; types of providers that have never
+// been launched are missing.
+func CachedResourceTypes(installDir string) []string {
+	var result []string
+
+	for name, version := range DefaultVersions() {
+		path, err := resourceTypesCacheFile(installDir, name, version)
+		if err != nil {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var types []string
+
+		if err := json.Unmarshal(data, &types); err != nil {
+			continue
+		}
+
+		result = append(result, types...)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// ImportStrategy is how the states of resources of a type whose state can't be decoded have been updated
+// successfully (see TerraformProvider.ImportStrategy).
+type ImportStrategy string
+
+const (
+	// ImportStrategyImport imports a resource by its ID before reading its current state.
+	ImportStrategyImport ImportStrategy = "import"
+	// ImportStrategyRead reads the current state of a resource by its ID (and other attributes recorded in the state)
+	// without import, e.g., as resources of its type can't be imported.
+	ImportStrategyRead ImportStrategy = "read"
+)
+
+// runCache is what is learned about a provider during a run and cached for the next runs with the same provider
+// name and version (see Config.NoCache).
+type runCache struct {
+	// SchemaFingerprint identifies the schema of the provider the import strategies have been learned with;
+	// the cache is discarded if it differs (e.g., from a rebuilt provider binary of the same version).
+	SchemaFingerprint string `json:"schema_fingerprint"`
+	// ImportStrategies are the strategies that have worked by resource type.
+	ImportStrategies map[string]ImportStrategy `json:"import_strategies"`
+
+	path string
+	// changed is true if a strategy has been learned that isn't cached yet.
+	changed bool
+	mu      sync.Mutex
+}
+
+// runCacheFile returns the path of the file caching what has been learned about a provider during previous runs
+// (e.g., ~/.terradozer/run-cache-aws-v3.42.0.json).
+func runCacheFile(installDir, providerName, providerVersion string) (string, error) {
+	expandedInstallDir, err := goHomeDir.Expand(installDir)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(expandedInstallDir,
+		fmt.Sprintf("run-cache-%s-%s.json", providerName, providerVersion)), nil
+}
+
+// schemaFingerprint returns a fingerprint of the resource types of a schema and their versions.
+func schemaFingerprint(schema providers.GetSchemaResponse) string {
+	var types []string
+
+	for t, s := range schema.ResourceTypes {
+		types = append(types, fmt.Sprintf("%s:%d", t, s.Version))
+	}
+
+	sort.Strings(types)
+
+	h := sha256.New()
+
+	for _, t := range types {
+		_, _ = fmt.Fprintln(h, t)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadRunCache reads the cache of previous runs with the given provider, or returns an empty cache if there is none,
+// it can't be read, or it has been learned with another schema.
+func loadRunCache(installDir, providerName, providerVersion string, schema providers.GetSchemaResponse) *runCache {
+	path, err := runCacheFile(installDir, providerName, providerVersion)
+	if err != nil {
+		return nil
+	}
+
+	fingerprint := schemaFingerprint(schema)
+	empty := &runCache{SchemaFingerprint: fingerprint, ImportStrategies: map[string]ImportStrategy{}, path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return empty
+	}
+
+	var cached runCache
+
+	if err := json.Unmarshal(data, &cached); err != nil || cached.ImportStrategies == nil {
+		log.WithError(err).WithField("path", path).Debug("ignoring unreadable cache of previous runs")
+
+		return empty
+	}
+
+	if cached.SchemaFingerprint != fingerprint {
+		log.WithField("path", path).Debug("ignoring cache of previous runs with another schema of provider")
+
+		return empty
+	}
+
+	cached.path = path
+
+	return &cached
+}
+
+// importStrategy returns the cached import strategy of a resource type.
+func (c *runCache) importStrategy(terraformType string) (ImportStrategy, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.ImportStrategies[terraformType]
+
+	return s, ok
+}
+
+// recordImportStrategy caches the import strategy that has worked for a resource type.
+func (c *runCache) recordImportStrategy(terraformType string, s ImportStrategy) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ImportStrategies[terraformType] != s {
+		c.ImportStrategies[terraformType] = s
+		c.changed = true
+	}
+}
+
+// write writes the cache, if anything has been learned during the run.
+func (c *runCache) write() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.changed {
+		return
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+
+	err = writeFileAtomic(c.path, data)
+	if err != nil {
+		log.WithError(err).Debug("failed to write cache of run")
+
+		return
+	}
+
+	c.changed = false
+}
@@ -0,0 +1,87 @@
+package provider_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedResourceTypes(t *testing.T) {
+	installDir := t.TempDir()
+
+	assert.Empty(t, provider.CachedResourceTypes(installDir))
+
+	err := ioutil.WriteFile(filepath.Join(installDir, "resource-types-aws-"+provider.DefaultVersions()["aws"]+".json"),
+		[]byte(`["aws_vpc","aws_instance"]`), 0600)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(installDir, "resource-types-aws-v2.0.0.json"),
+		[]byte(`["aws_outdated"]`), 0600)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"aws_instance", "aws_vpc"}, provider.CachedResourceTypes(installDir))
+}
+
+func TestImportStrategyCache(t *testing.T) {
+	installDir := t.TempDir()
+
+	initProvider := func(config provider.Config, resourceTypes ...string) *provider.TerraformProvider {
+		config.InstallDir = installDir
+		config.Factory = func(string, string) (provider.Provider, error) {
+			return provider.NewStub(provider.StubConfig{}, resourceTypes), nil
+		}
+
+		p, err := provider.Init(context.Background(), "aws", config)
+		require.NoError(t, err)
+
+		return p
+	}
+
+	p := initProvider(provider.Config{}, "aws_vpc", "aws_instance")
+
+	_, ok := p.ImportStrategy("aws_vpc")
+	assert.False(t, ok)
+
+	p.RecordImportStrategy("aws_vpc", provider.ImportStrategyRead)
+	p.RecordImportStrategy("aws_instance", provider.ImportStrategyImport)
+	require.NoError(t, p.Close())
+
+	p = initProvider(provider.Config{}, "aws_vpc", "aws_instance")
+
+	actual, ok := p.ImportStrategy("aws_vpc")
+	assert.True(t, ok)
+	assert.Equal(t, provider.ImportStrategyRead, actual)
+
+	actual, ok = p.ImportStrategy("aws_instance")
+	assert.True(t, ok)
+	assert.Equal(t, provider.ImportStrategyImport, actual)
+	require.NoError(t, p.Close())
+
+	p = initProvider(provider.Config{NoCache: true}, "aws_vpc", "aws_instance")
+
+	_, ok = p.ImportStrategy("aws_vpc")
+	assert.False(t, ok, "cache must not be used if disabled")
+
+	_, ok = initProvider(provider.Config{}, "aws_vpc").ImportStrategy("aws_vpc")
+	assert.False(t, ok, "cache of another schema must be ignored")
+
+	path := filepath.Join(installDir, "run-cache-aws-"+provider.DefaultVersions()["aws"]+".json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"schema_fingerprint": `), 0600))
+
+	p = initProvider(provider.Config{}, "aws_vpc", "aws_instance")
+
+	_, ok = p.ImportStrategy("aws_vpc")
+	assert.False(t, ok, "corrupt cache must be ignored")
+
+	p.RecordImportStrategy("aws_vpc", provider.ImportStrategyImport)
+	require.NoError(t, p.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"aws_vpc":"import"`, "corrupt cache must be replaced")
+}
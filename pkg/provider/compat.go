@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+
+	tfversion "github.com/hashicorp/terraform/version"
+	"github.com/jckuester/terradozer/internal"
+)
+
+//nolint:gochecknoglobals
+var (
+	// maxTerraformVersions lists by provider name the newest Terraform version whose states work
+	// with the provider version used by default (i.e., the newest Terraform release when the provider was released).
+	maxTerraformVersions = map[string]string{
+		"aws": "1.0",
+	}
+)
+
+// Compatibility returns the compatibility table of terradozer: the newest Terraform versions whose states
+// the state parser (i.e., the Terraform library compiled into terradozer) and the providers used by default support.
+func Compatibility() []internal.Compatibility {
+	segments := tfversion.SemVer.Segments()
+
+	result := []internal.Compatibility{{
+		Component: "state parser",
+		Version:   "terraform v" + tfversion.String(),
+		// states of newer Terraform versions record providers by source address (e.g., registry.terraform.io/...),
+		// which the parser doesn't know
+		MaxTerraformVersion: fmt.Sprintf("%d.%d", segments[0], segments[1]),
+	}}
+
+	var names []string
+
+	for name := range DefaultVersions() {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		result = append(result, internal.Compatibility{
+			Component:           "provider " + name,
+			Version:             DefaultVersions()[name],
+			MaxTerraformVersion: maxTerraformVersions[name],
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// NewSession creates an AWS session that uses the configured region and custom endpoints.
+//
+// The session's credentials are resolved from all sources supported by the AWS SDK, including the ones
+// that the Terraform AWS Provider can't read itself (e.g., AWS SSO profiles, credential_process, or a web identity
+// token given by AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, as used by IAM roles for Kubernetes service accounts).
+// Set the session's credentials as AWSConfig.Credentials to pass them on to the provider.
+//
+// For profiles assuming a role that requires MFA (i.e., mfa_serial is set), the role is assumed by terradozer
+// with the configured MFA token (or a token prompted for), as the provider can't prompt for it.
+// If AssumeRoleARN is set, the session's credentials are the ones of that role, assumed with the resolved credentials.
+func (c AWSConfig) NewSession() (*session.Session, error) {
+	config := aws.Config{
+		EndpointResolver: c.EndpointResolver(),
+		S3ForcePathStyle: aws.Bool(c.hasCustomEndpoints()),
+		// a client of its own, as loading a custom CA bundle (AWS_CA_BUNDLE) otherwise modifies
+		// the default client shared by all sessions (e.g., of several accounts created concurrently)
+		HTTPClient: &http.Client{},
+	}
+
+	if c.Region != "" {
+		config.Region = aws.String(c.Region)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:                  config,
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: c.mfaTokenProvider,
+		AssumeRoleDuration:      assumeRoleDuration,
+	})
+	if err != nil || c.AssumeRoleARN == "" {
+		return sess, err
+	}
+
+	creds := stscreds.NewCredentials(sess, c.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.Duration = assumeRoleDuration
+		p.RoleSessionName = assumeRoleSessionName
+	})
+
+	return sess.Copy(&aws.Config{Credentials: creds}), nil
+}
+
+// assumeRoleSessionName is the session name of the role given by AWSConfig.AssumeRoleARN,
+// which is shown in CloudTrail.
+const assumeRoleSessionName = "terradozer"
+
+// assumeRoleDuration is the duration of the credentials of an assumed role,
+// which is the maximum for credentials of roles assumed via role chaining.
+const assumeRoleDuration = 1 * time.Hour
+
+func (c AWSConfig) mfaTokenProvider() (string, error) {
+	if c.MFAToken != "" {
+		return c.MFAToken, nil
+	}
+
+	return stscreds.StdinTokenProvider()
+}
+
+// credentialsConfig returns the static credentials resolved by the AWS SDK as provider configuration.
+func (c AWSConfig) credentialsConfig() (map[string]cty.Value, error) {
+	creds, err := c.Credentials.Get()
+	if err != nil {
+		return nil, credentialsError(err)
+	}
+
+	logEntry := log.WithField("source", creds.ProviderName)
+
+	// temporary credentials (e.g., of an assumed role or web identity) can't be refreshed by the provider
+	if expiresAt, err := c.Credentials.ExpiresAt(); err == nil {
+		logEntry = logEntry.WithField("expires_at", expiresAt.Local().Format(time.RFC3339))
+	}
+
+	logEntry.Debug("resolved AWS credentials")
+
+	return map[string]cty.Value{
+		"access_key": cty.StringVal(creds.AccessKeyID),
+		"secret_key": cty.StringVal(creds.SecretAccessKey),
+		"token":      cty.StringVal(creds.SessionToken),
+	}, nil
+}
+
+// credentialsError adds a hint how to fix the error to known errors that occur when resolving credentials.
+func credentialsError(err error) error {
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ssocreds.ErrCodeSSOProviderInvalidToken {
+		return fmt.Errorf("failed to resolve AWS credentials: AWS SSO session has expired or is invalid "+
+			"(run `aws sso login` to start a new session): %s", err)
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == stscreds.ErrCodeWebIdentity {
+		return fmt.Errorf("failed to resolve AWS credentials: failed to assume role with web identity "+
+			"(check AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE): %s", err)
+	}
+
+	return fmt.Errorf("failed to resolve AWS credentials: %s", err)
+}
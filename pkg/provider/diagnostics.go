@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Diagnostic is a diagnostic returned by a provider (e.g., for an invalid value of an attribute).
+type Diagnostic struct {
+	// Severity is either "error" or "warning".
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail,omitempty"`
+	// Path is the path of the attribute the diagnostic is about (e.g., ingress[2].cidr_blocks[0]; empty if none).
+	Path string `json:"path,omitempty"`
+}
+
+// String returns the diagnostic with its attribute path (if any), e.g., "Invalid value at force_destroy: ...".
+func (d Diagnostic) String() string {
+	var b strings.Builder
+
+	if d.Severity == SeverityWarning {
+		b.WriteString("Warning: ")
+	}
+
+	b.WriteString(d.Summary)
+
+	if d.Path != "" {
+		fmt.Fprintf(&b, " at %s", d.Path)
+	}
+
+	if d.Detail != "" {
+		fmt.Fprintf(&b, ": %s", d.Detail)
+	}
+
+	return b.String()
+}
+
+// The severities of diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// DiagnosticsError is returned when a call to a provider has returned error diagnostics.
+type DiagnosticsError struct {
+	Diagnostics []Diagnostic
+}
+
+// Error renders the diagnostics like tfdiags.Diagnostics.Err(), but with the attribute paths of the diagnostics.
+func (e DiagnosticsError) Error() string {
+	switch len(e.Diagnostics) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e.Diagnostics[0].String()
+	default:
+		var b strings.Builder
+
+		fmt.Fprintf(&b, "%d problems:\n", len(e.Diagnostics))
+
+		for _, d := range e.Diagnostics {
+			fmt.Fprintf(&b, "\n- %s", d)
+		}
+
+		return b.String()
+	}
+}
+
+// NewDiagnosticsError returns the given diagnostics as DiagnosticsError, or nil if they don't contain any errors.
+func NewDiagnosticsError(diags tfdiags.Diagnostics) error {
+	if !diags.HasErrors() {
+		return nil
+	}
+
+	return DiagnosticsError{Diagnostics: NewDiagnostics(diags)}
+}
+
+// NewDiagnostics converts the given Terraform diagnostics.
+func NewDiagnostics(diags tfdiags.Diagnostics) []Diagnostic {
+	var result []Diagnostic
+
+	for _, diag := range diags {
+		desc := diag.Description()
+
+		severity := SeverityError
+		if diag.Severity() == tfdiags.Warning {
+			severity = SeverityWarning
+		}
+
+		result = append(result, Diagnostic{
+			Severity: severity,
+			Summary:  desc.Summary,
+			Detail:   desc.Detail,
+			Path:     FormatPath(tfdiags.GetAttribute(diag)),
+		})
+	}
+
+	return result
+}
+
+// DiagnosticsOf returns the diagnostics of the provider that have caused the given error (nil if none).
+func DiagnosticsOf(err error) []Diagnostic {
+	var diagsErr DiagnosticsError
+	if errors.As(err, &diagsErr) {
+		return diagsErr.Diagnostics
+	}
+
+	return nil
+}
+
+// FormatPath returns the given path as in Terraform's configuration language (e.g., ingress[0].cidr_blocks).
+func FormatPath(path cty.Path) string {
+	var b strings.Builder
+
+	for _, step := range path {
+		switch s := step.(type) {
+		case cty.GetAttrStep:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+
+			b.WriteString(s.Name)
+		case cty.IndexStep:
+			if !s.Key.IsKnown() || s.Key.IsNull() {
+				b.WriteString("[?]")
+
+				continue
+			}
+
+			if s.Key.Type() == cty.String {
+				fmt.Fprintf(&b, "[%q]", s.Key.AsString())
+
+				continue
+			}
+
+			i, _ := s.Key.AsBigFloat().Int64()
+			fmt.Fprintf(&b, "[%d]", i)
+		}
+	}
+
+	return b.String()
+}
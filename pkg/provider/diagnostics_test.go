@@ -0,0 +1,105 @@
+package provider_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewDiagnosticsError(t *testing.T) {
+	var diags tfdiags.Diagnostics
+
+	tests := []struct {
+		name                string
+		diags               tfdiags.Diagnostics
+		expectedErr         string
+		expectedDiagnostics []provider.Diagnostic
+	}{
+		{
+			name:  "no diagnostics",
+			diags: nil,
+		},
+		{
+			name:  "warnings only",
+			diags: diags.Append(tfdiags.SimpleWarning("deprecated")),
+		},
+		{
+			name: "attribute path",
+			diags: diags.Append(tfdiags.AttributeValue(tfdiags.Error, "Invalid value", "must be a boolean",
+				cty.GetAttrPath("force_destroy"))),
+			expectedErr: "Invalid value at force_destroy: must be a boolean",
+			expectedDiagnostics: []provider.Diagnostic{
+				{Severity: "error", Summary: "Invalid value", Detail: "must be a boolean", Path: "force_destroy"},
+			},
+		},
+		{
+			name: "nested attribute path",
+			diags: diags.Append(tfdiags.AttributeValue(tfdiags.Error, "Invalid CIDR block", "",
+				cty.GetAttrPath("ingress").IndexInt(2).GetAttr("cidr_blocks").IndexInt(0))),
+			expectedErr: "Invalid CIDR block at ingress[2].cidr_blocks[0]",
+			expectedDiagnostics: []provider.Diagnostic{
+				{Severity: "error", Summary: "Invalid CIDR block", Path: "ingress[2].cidr_blocks[0]"},
+			},
+		},
+		{
+			name: "map key",
+			diags: diags.Append(tfdiags.AttributeValue(tfdiags.Error, "Invalid tag", "too long",
+				cty.GetAttrPath("tags").Index(cty.StringVal("Name")))),
+			expectedErr: `Invalid tag at tags["Name"]: too long`,
+			expectedDiagnostics: []provider.Diagnostic{
+				{Severity: "error", Summary: "Invalid tag", Detail: "too long", Path: `tags["Name"]`},
+			},
+		},
+		{
+			name:        "without attribute path",
+			diags:       diags.Append(tfdiags.WholeContainingBody(tfdiags.Error, "DependencyViolation", "in use")),
+			expectedErr: "DependencyViolation: in use",
+			expectedDiagnostics: []provider.Diagnostic{
+				{Severity: "error", Summary: "DependencyViolation", Detail: "in use"},
+			},
+		},
+		{
+			name: "several diagnostics",
+			diags: diags.Append(
+				tfdiags.AttributeValue(tfdiags.Warning, "Deprecated", "", cty.GetAttrPath("acl")),
+				fmt.Errorf("AccessDenied: not authorized")),
+			expectedErr: "2 problems:\n\n- Warning: Deprecated at acl\n- AccessDenied: not authorized",
+			expectedDiagnostics: []provider.Diagnostic{
+				{Severity: "warning", Summary: "Deprecated", Path: "acl"},
+				{Severity: "error", Summary: "AccessDenied: not authorized"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := provider.NewDiagnosticsError(tc.diags)
+
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.EqualError(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expectedDiagnostics, provider.DiagnosticsOf(err))
+		})
+	}
+}
+
+func TestDiagnosticsOf(t *testing.T) {
+	var diags tfdiags.Diagnostics
+
+	err := provider.NewDiagnosticsError(diags.Append(tfdiags.AttributeValue(tfdiags.Error, "Invalid value", "",
+		cty.GetAttrPath("name"))))
+
+	assert.Equal(t, []provider.Diagnostic{{Severity: "error", Summary: "Invalid value", Path: "name"}},
+		provider.DiagnosticsOf(fmt.Errorf("failed to destroy: %w", err)))
+	assert.Nil(t, provider.DiagnosticsOf(errors.New("timed out")))
+	assert.Nil(t, provider.DiagnosticsOf(nil))
+}
@@ -0,0 +1,255 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plugin/discovery"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/mitchellh/cli"
+	goHomeDir "github.com/mitchellh/go-homedir"
+)
+
+// Install installs a Terraform Provider Plugin binary with a given name and version.
+// If the binary has already been installed previously, it isn't redownloaded.
+// For example, call:
+//
+//	Install("aws", "2.43.0", "~/.my-aws-tool")
+//
+// copied from github.com/jckuester/awstools-lib/terraform/provider/provider.go
+func Install(providerName, providerVersion, installDir string) (discovery.PluginMeta, error) {
+	meta, _, err := install(providerName, providerVersion, installDir, "", nil)
+
+	return meta, err
+}
+
+// install installs a provider as Install, but downloads it into a temporary directory inside workDir
+// (or inside the install directory if empty) first, from where it's moved into the install directory
+// once complete, so that concurrent runs never use (or purge) partial downloads of each other.
+// Failed downloads are retried (see retryStart), each with the given function (can be nil).
+// Returns where the binary comes from (i.e., downloaded or already installed).
+func install(providerName, providerVersion, installDir, workDir string,
+	retried func(Stage)) (discovery.PluginMeta, Source, error) {
+	expandedInstallDir, err := goHomeDir.Expand(installDir)
+	if err != nil {
+		return discovery.PluginMeta{}, "", err
+	}
+
+	plugins := discovery.FindPlugins("provider", []string{expandedInstallDir})
+
+	version, err := discovery.VersionStr(providerVersion).Parse()
+	if err != nil {
+		return discovery.PluginMeta{}, "", fmt.Errorf("failed to parse provider version: %s", err)
+	}
+
+	for p := range plugins.WithName(providerName) {
+		pVersion, err := p.Version.Parse()
+		if err != nil {
+			return discovery.PluginMeta{}, "", err
+		}
+
+		if version.Equal(pVersion) {
+			log.WithFields(log.Fields{
+				"name":    p.Name,
+				"version": p.Version,
+				"path":    p.Path,
+			}).Debugf("found already installed Terraform provider")
+			return p, SourceCache, nil
+		}
+	}
+
+	providerConstraint, err := discovery.ConstraintStr(providerVersion).Parse()
+	if err != nil {
+		return discovery.PluginMeta{}, "", fmt.Errorf("failed to parse provider version constraint: %s", err)
+	}
+
+	pty := addrs.NewLegacyProvider(providerName)
+
+	appendUserAgent()
+
+	log.WithFields(log.Fields{
+		"name":               providerName,
+		"version_constraint": providerConstraint.String(),
+		"install_dir":        expandedInstallDir,
+	}).Debugf("download and install Terraform provider")
+
+	var meta discovery.PluginMeta
+
+	err = retryStart(providerName, retried, func() error {
+		meta, err = download(pty, providerConstraint, expandedInstallDir, workDir)
+
+		return err
+	})
+	if err != nil {
+		return discovery.PluginMeta{}, "", err
+	}
+
+	// clean up old, unused versions of provider plugins
+	_, err = newProviderInstaller(expandedInstallDir).PurgeUnused(map[string]discovery.PluginMeta{
+		providerName: meta,
+	})
+	if err != nil {
+		return discovery.PluginMeta{}, "", err
+	}
+
+	return meta, SourceDownloaded, nil
+}
+
+// InstallLatest installs the latest Terraform Provider Plugin binary with a given name whose version is
+// at least minVersion (if not installed yet) and returns its version. Unlike Install, other installed versions
+// of the provider are kept.
+func InstallLatest(providerName, minVersion, installDir string) (string, error) {
+	return installLatest(providerName, minVersion, installDir, "", nil)
+}
+
+// installLatest installs the latest version of a provider as InstallLatest, downloading it into workDir first
+// (see install).
+func installLatest(providerName, minVersion, installDir, workDir string, retried func(Stage)) (string, error) {
+	expandedInstallDir, err := goHomeDir.Expand(installDir)
+	if err != nil {
+		return "", err
+	}
+
+	providerConstraint, err := discovery.ConstraintStr(">=" + minVersion).Parse()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse provider version constraint: %s", err)
+	}
+
+	appendUserAgent()
+
+	log.WithFields(log.Fields{
+		"name":               providerName,
+		"version_constraint": providerConstraint.String(),
+		"install_dir":        expandedInstallDir,
+	}).Debugf("download and install latest Terraform provider")
+
+	var meta discovery.PluginMeta
+
+	err = retryStart(providerName, retried, func() error {
+		meta, err = download(addrs.NewLegacyProvider(providerName), providerConstraint, expandedInstallDir, workDir)
+
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(meta.Version), nil
+}
+
+// download downloads the newest version of a provider that satisfies the given constraint into a temporary
+// directory inside workDir (or inside the install directory if empty) and moves it into the install directory.
+// Each download starts from scratch in a new temporary directory and verifies the checksum of the provider.
+func download(pty addrs.Provider, constraint discovery.Constraints, installDir,
+	workDir string) (discovery.PluginMeta, error) {
+	if workDir == "" {
+		workDir = installDir
+	}
+
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		return discovery.PluginMeta{}, err
+	}
+
+	downloadDir, err := ioutil.TempDir(workDir, ".download-")
+	if err != nil {
+		return discovery.PluginMeta{}, err
+	}
+	defer os.RemoveAll(downloadDir)
+
+	meta, tfDiagnostics, err := newProviderInstaller(downloadDir).Get(pty, constraint)
+	if err != nil {
+		tfDiagnostics = tfDiagnostics.Append(err)
+		return discovery.PluginMeta{}, downloadError(tfDiagnostics.Err())
+	}
+
+	if err := os.MkdirAll(installDir, 0700); err != nil {
+		return discovery.PluginMeta{}, err
+	}
+
+	path := filepath.Join(installDir, filepath.Base(meta.Path))
+
+	if err := moveFile(meta.Path, path); err != nil {
+		return discovery.PluginMeta{}, fmt.Errorf("failed to move downloaded provider into install directory: %s", err)
+	}
+
+	meta.Path = path
+
+	return meta, nil
+}
+
+// moveFile moves a file, replacing the destination atomically, also if both paths are on different file systems
+// (e.g., the system's temp directory and the home directory).
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(out.Name(), info.Mode()); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), dst)
+}
+
+// newProviderInstaller returns an installer of Terraform Provider Plugins into the given directory.
+func newProviderInstaller(installDir string) *discovery.ProviderInstaller {
+	return &discovery.ProviderInstaller{
+		Dir:                   filepath.FromSlash(installDir),
+		PluginProtocolVersion: discovery.PluginInstallProtocolVersion,
+		SkipVerify:            false,
+		Ui: &cli.BasicUi{
+			Reader:      os.Stdin,
+			Writer:      &bytes.Buffer{},
+			ErrorWriter: os.Stderr,
+		},
+	}
+}
+
+// userAgentEnvVar is the environment variable whose value Terraform appends to the user agent of requests
+// to the provider registry.
+const userAgentEnvVar = "TF_APPEND_USER_AGENT"
+
+// appendUserAgent appends the user agent of terradozer (e.g., terradozer/v0.1.2) to the one of requests
+// to the provider registry, so that the registry sees which version of terradozer installs a provider.
+func appendUserAgent() {
+	ua := os.Getenv(userAgentEnvVar)
+	if strings.Contains(ua, internal.UserAgent()) {
+		return
+	}
+
+	_ = os.Setenv(userAgentEnvVar, strings.TrimSpace(ua+" "+internal.UserAgent()))
+}
@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/registry"
+	"github.com/hashicorp/terraform/registry/regsrc"
+)
+
+// LockFileName is the name of the dependency lock file that `terraform init` writes into the working directory.
+const LockFileName = ".terraform.lock.hcl"
+
+// LockedProvider is a provider as selected by `terraform init` in a dependency lock file.
+type LockedProvider struct {
+	Version string
+	// Hashes are the checksums of the provider's packages (h1:) and archives (zh:) for the platforms
+	// `terraform init` has been run on.
+	Hashes []string
+}
+
+// lockFile is the content of a dependency lock file (only the parts used by terradozer).
+type lockFile struct {
+	Providers []struct {
+		Source  string   `hcl:"source,label"`
+		Version string   `hcl:"version"`
+		Hashes  []string `hcl:"hashes,optional"`
+		Remain  hcl.Body `hcl:",remain"`
+	} `hcl:"provider,block"`
+	Remain hcl.Body `hcl:",remain"`
+}
+
+// ReadLockFile reads the providers of a dependency lock file (e.g., .terraform.lock.hcl) by name (e.g., "aws").
+// Providers that are (yet) unsupported by terradozer are ignored.
+func ReadLockFile(path string) (map[string]LockedProvider, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := hclsyntax.ParseConfig(content, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var decoded lockFile
+
+	if diags := gohcl.DecodeBody(file.Body, nil, &decoded); diags.HasErrors() {
+		return nil, diags
+	}
+
+	result := map[string]LockedProvider{}
+
+	for _, p := range decoded.Providers {
+		name, ok := lockedProviderName(p.Source)
+		if !ok {
+			log.WithField("source", p.Source).Debug("ignoring (yet) unsupported provider of lock file")
+
+			continue
+		}
+
+		if _, err := ParseVersions(name + "=" + p.Version); err != nil {
+			return nil, fmt.Errorf("invalid version of provider %s: %s", p.Source, p.Version)
+		}
+
+		result[name] = LockedProvider{Version: "v" + strings.TrimPrefix(p.Version, "v"), Hashes: p.Hashes}
+	}
+
+	return result, nil
+}
+
+// lockedProviderName returns the name of a provider supported by terradozer
+// by its source address in a lock file (e.g., registry.terraform.io/hashicorp/aws).
+func lockedProviderName(source string) (string, bool) {
+	parts := strings.Split(source, "/")
+	if len(parts) != 3 || parts[0] != "registry.terraform.io" || parts[1] != "hashicorp" {
+		return "", false
+	}
+
+	if _, ok := DefaultVersions()[parts[2]]; !ok {
+		return "", false
+	}
+
+	return parts[2], true
+}
+
+// VerifyLocked checks that the installed binary of a provider matches one of the hashes of the given
+// locked provider (installing the provider first if it isn't installed yet): either the h1: hash
+// of the binary, or the zh: hash (SHA-256) of the archive for the current platform,
+// which the binary has been downloaded with.
+func VerifyLocked(providerName string, locked LockedProvider, installDir string) error {
+	_, err := verifyInstalled(providerName, locked, installDir, "", nil)
+
+	return err
+}
+
+// verifyInstalled verifies a locked provider as VerifyLocked, downloading it into workDir first if it isn't
+// installed yet (see install). Returns where the binary comes from (empty if the provider has no hashes).
+func verifyInstalled(providerName string, locked LockedProvider, installDir, workDir string,
+	retried func(Stage)) (Source, error) {
+	if len(locked.Hashes) == 0 {
+		return "", nil
+	}
+
+	meta, source, err := install(providerName, locked.Version, installDir, workDir, retried)
+	if err != nil {
+		return "", err
+	}
+
+	return source, verifyHashes(providerName, locked, meta.Path, archiveShasum)
+}
+
+// verifyHashes checks that the binary at the given path or the archive it has been downloaded with
+// (whose checksum is returned by shasum) matches one of the hashes of the given locked provider.
+func verifyHashes(providerName string, locked LockedProvider, path string,
+	shasum func(providerName, version string) (string, error)) error {
+	hashes := map[string]bool{}
+
+	archiveHashes := false
+
+	for _, h := range locked.Hashes {
+		hashes[h] = true
+		archiveHashes = archiveHashes || strings.HasPrefix(h, "zh:")
+	}
+
+	packageHash, err := PackageHash(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash provider %s %s: %s", providerName, locked.Version, err)
+	}
+
+	if hashes[packageHash] {
+		return nil
+	}
+
+	actual := []string{packageHash}
+
+	if archiveHashes {
+		sum, err := shasum(providerName, locked.Version)
+		if err != nil {
+			return fmt.Errorf("failed to get checksum of archive of provider %s %s: %s",
+				providerName, locked.Version, err)
+		}
+
+		if hashes["zh:"+sum] {
+			return nil
+		}
+
+		actual = append(actual, "zh:"+sum)
+	}
+
+	return fmt.Errorf("hash mismatch: provider %s %s (%s) doesn't match any of the hashes in the lock file",
+		providerName, locked.Version, strings.Join(actual, ", "))
+}
+
+// PackageHash returns the h1: hash of a provider's binary as Terraform computes it for a package
+// that only contains the binary (i.e., the hash of a directory in the format of go.sum).
+func PackageHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fileHash := sha256.New()
+
+	if _, err := io.Copy(fileHash, f); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%x  %s\n", fileHash.Sum(nil), filepath.Base(path))
+
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// archiveShasum returns the SHA-256 checksum (in hex) of the archive of a provider for the current platform
+// as published by the registry, which the installer verifies downloads against.
+func archiveShasum(providerName, version string) (string, error) {
+	location, err := registry.NewClient(nil, nil).TerraformProviderLocation(
+		regsrc.NewTerraformProvider(providerName, runtime.GOOS, runtime.GOARCH), strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return "", err
+	}
+
+	return location.Shasum, nil
+}
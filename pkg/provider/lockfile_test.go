@@ -0,0 +1,122 @@
+package provider_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lockFile = `# This file is maintained automatically by "terraform init".
+# Manual edits may be lost in future updates.
+
+provider "registry.terraform.io/hashicorp/aws" {
+  version     = "3.42.0"
+  constraints = "~> 3.0"
+  hashes = [
+    "h1:TM3OYsCTHsJXGUHJoQkG0SzBkmkEUx0Ej/g+O7lrYvY=",
+    "zh:0a7aa5b2bde8a5e2a6b3a5fabd2ecfdfd5af32e3f5bb7ea87d9c6ae6d3e4b3f7",
+  ]
+}
+
+provider "registry.terraform.io/hashicorp/random" {
+  version = "3.1.0"
+  hashes = [
+    "h1:rKYu5ZUbXwrLG1w81k7H3nce/Ys6yAxXhWcbtk36HjY=",
+  ]
+}
+`
+
+func TestReadLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), provider.LockFileName)
+	require.NoError(t, ioutil.WriteFile(path, []byte(lockFile), 0600))
+
+	actual, err := provider.ReadLockFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]provider.LockedProvider{
+		"aws": {
+			Version: "v3.42.0",
+			Hashes: []string{
+				"h1:TM3OYsCTHsJXGUHJoQkG0SzBkmkEUx0Ej/g+O7lrYvY=",
+				"zh:0a7aa5b2bde8a5e2a6b3a5fabd2ecfdfd5af32e3f5bb7ea87d9c6ae6d3e4b3f7",
+			},
+		},
+	}, actual)
+}
+
+func TestReadLockFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), provider.LockFileName)
+	require.NoError(t, ioutil.WriteFile(path, []byte(`provider "registry.terraform.io/hashicorp/aws" {`), 0600))
+
+	_, err := provider.ReadLockFile(path)
+	assert.Error(t, err)
+}
+
+func TestInit_Locked(t *testing.T) {
+	// the hash of the installed fake binary and the one of another binary
+	matchingHash := "h1:TM3OYsCTHsJXGUHJoQkG0SzBkmkEUx0Ej/g+O7lrYvY="
+	otherHash := "h1:rKYu5ZUbXwrLG1w81k7H3nce/Ys6yAxXhWcbtk36HjY="
+
+	tests := []struct {
+		name        string
+		locked      provider.LockedProvider
+		versions    map[string]string
+		expectedErr string
+	}{
+		{
+			name:   "matching hash",
+			locked: provider.LockedProvider{Version: "v3.42.0", Hashes: []string{matchingHash}},
+		},
+		{
+			name:   "hash mismatch",
+			locked: provider.LockedProvider{Version: "v3.42.0", Hashes: []string{otherHash}},
+			expectedErr: "hash mismatch: provider aws v3.42.0 (h1:TM3OYsCTHsJXGUHJoQkG0SzBkmkEUx0Ej/g+O7lrYvY=) " +
+				"doesn't match any of the hashes in the lock file",
+		},
+		{
+			name:     "version overridden",
+			locked:   provider.LockedProvider{Version: "v3.42.0", Hashes: []string{otherHash}},
+			versions: map[string]string{"aws": "v3.74.0"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			installDir := t.TempDir()
+
+			// an already installed binary isn't downloaded again
+			require.NoError(t, ioutil.WriteFile(filepath.Join(installDir, "terraform-provider-aws_v3.42.0_x5"),
+				[]byte("fake provider"), 0600))
+
+			var startedVersion string
+
+			_, err := provider.Init(context.Background(), "aws", provider.Config{
+				InstallDir: installDir,
+				Timeout:    time.Minute,
+				Versions:   tc.versions,
+				Locked:     map[string]provider.LockedProvider{"aws": tc.locked},
+				Factory: func(_, version string) (provider.Provider, error) {
+					startedVersion = version
+
+					return provider.NewStub(provider.StubConfig{}, []string{"aws_vpc"}), nil
+				},
+			})
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				assert.Empty(t, startedVersion)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, provider.Config{Versions: tc.versions, Locked: map[string]provider.LockedProvider{
+				"aws": tc.locked}}.Version("aws"), startedVersion)
+		})
+	}
+}
@@ -0,0 +1,401 @@
+// Package provider installs, launches, and configures the Terraform Provider Plugins
+// needed to destroy the resources of a Terraform state.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/plugin/discovery"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/jckuester/terradozer/pkg/trace"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// awsProviderVersion is the version of the Terraform AWS Provider used to destroy resources.
+const awsProviderVersion = "v3.42.0"
+
+// Factory creates a (not yet configured) provider with the given name and version.
+// The version is empty if the provider is (yet) unsupported by terradozer.
+// Returns nil if the factory can't provide the provider (then, resources of the provider are ignored).
+//
+// The default factory is PluginFactory; other factories allow to provide in-memory providers
+// (e.g., fakes in tests, which run without any plugin binaries or network).
+type Factory func(name, version string) (Provider, error)
+
+// Config configures how providers are initialized.
+type Config struct {
+	// InstallDir is the directory to install the Terraform Provider Plugins into (e.g., "~/.terradozer").
+	InstallDir string
+	// WorkDir is the directory providers are downloaded into before they are moved into InstallDir
+	// (e.g., the workspace of a run); defaults to InstallDir if empty.
+	WorkDir string
+	// Timeout is the amount of time to wait for a destroy operation of a provider to finish.
+	Timeout time.Duration
+	// AWS configures the Terraform AWS Provider.
+	AWS AWSConfig
+	// Factory creates the providers (defaults to PluginFactory(InstallDir) if nil).
+	Factory Factory
+	// Versions override the versions of the providers supported by terradozer by provider name
+	// (e.g., to pin an older version that still supports a resource type; see DefaultVersions).
+	Versions map[string]string
+	// Locked are the providers of a dependency lock file by name (see ReadLockFile), whose versions override
+	// the default ones (but not Versions). A provider of the locked version must match one of its hashes.
+	Locked map[string]LockedProvider
+	// LatestVersion returns the latest version of a provider that is at least minVersion, e.g., to upgrade
+	// a provider (see Upgrade); defaults to installing it from the registry via InstallLatest(InstallDir) if nil.
+	LatestVersion func(name, minVersion string) (string, error)
+	// Throttled is called each time a call to a provider is retried because the AWS API throttled requests
+	// (can be nil), e.g., to reduce the number of concurrent calls.
+	Throttled func()
+	// ReadOnly rejects all changes of resources (i.e., updates and destroys fail with ErrReadOnly),
+	// so that resources can only be imported and read.
+	ReadOnly bool
+	// Retried is called with the stage each time starting a provider is retried after a failure (can be nil),
+	// e.g., to record how flaky the network is (see StartError).
+	Retried func(stage Stage)
+	// Installed is called with the plugin binary of each provider once it has been installed and launched
+	// (can be nil), e.g., to record which binaries have performed the deletions of a run. Only called
+	// for providers created by the default factory.
+	Installed func(Binary)
+	// NoCache disables caching the import strategies that have worked for resource types in InstallDir
+	// between runs (see ImportStrategy). Nothing is cached without InstallDir.
+	NoCache bool
+}
+
+// InitProviders installs, launches, and configures the Terraform Providers given by name.
+// Resources of (yet) unsupported providers are ignored, i.e., no provider is returned for them.
+func InitProviders(ctx context.Context, providerNames []string, config Config) (map[string]*TerraformProvider, error) {
+	providers := map[string]*TerraformProvider{}
+
+	for _, pName := range providerNames {
+		p, err := Init(ctx, pName, config)
+		if err != nil {
+			for _, p := range providers {
+				_ = p.Close()
+			}
+
+			return nil, err
+		}
+
+		if p != nil {
+			providers[pName] = p
+		}
+	}
+
+	return providers, nil
+}
+
+// Init installs, launches (i.e., starts the plugin binary process), and configures a Terraform Provider by name.
+// Returns nil if the provider is (yet) unsupported.
+func Init(ctx context.Context, providerName string, config Config) (*TerraformProvider, error) {
+	version := config.Version(providerName)
+
+	// where the binary comes from if verifying it against the lock file has installed it
+	var verified Source
+
+	if _, ok := config.Locked[providerName]; ok {
+		span := trace.Start(ctx, "provider", "verify provider", map[string]interface{}{
+			"name": providerName, "version": version})
+
+		var err error
+		verified, err = config.verifyLocked(providerName, version)
+		span.End(err)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	factory := config.Factory
+	if factory == nil {
+		factory = pluginFactory(config.InstallDir, config.WorkDir, config.Retried, config.installed(verified))
+	}
+
+	// installing and launching (or, e.g., taking a provider from a pool) is up to the factory
+	span := trace.Start(ctx, "provider", "start provider", map[string]interface{}{
+		"name": providerName, "version": version})
+	p, err := factory(providerName, version)
+	span.End(err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		log.WithField("name", providerName).Debug("ignoring resources of (yet) unsupported provider")
+
+		return nil, nil
+	}
+
+	tp := &TerraformProvider{Provider: p, timeout: config.Timeout, name: providerName, version: version,
+		throttled: config.Throttled, readOnly: config.ReadOnly}
+
+	span = trace.Start(ctx, "provider", "configure provider", map[string]interface{}{
+		"name": providerName, "version": version})
+	err = tp.configure(ctx, config.AWS)
+	span.End(err)
+
+	if err != nil {
+		_ = tp.Close()
+
+		return nil, err
+	}
+
+	if !config.NoCache && config.InstallDir != "" {
+		tp.cache = loadRunCache(config.InstallDir, providerName, version, tp.GetSchema())
+	}
+
+	log.WithFields(log.Fields{
+		"name":    providerName,
+		"version": version,
+	}).Debug("configured provider")
+
+	return tp, nil
+}
+
+// Upgrade installs, launches, and configures the latest version of the given provider, which is used in addition
+// to the given one (e.g., for resources whose schema version is newer than the one of the given provider).
+// Fails if there is no newer version, i.e., a provider is never downgraded.
+func Upgrade(ctx context.Context, p *TerraformProvider, config Config) (*TerraformProvider, error) {
+	latestVersion := config.LatestVersion
+	if latestVersion == nil {
+		latestVersion = func(name, minVersion string) (string, error) {
+			return installLatest(name, minVersion, config.InstallDir, config.WorkDir, config.Retried)
+		}
+	}
+
+	current, err := discovery.VersionStr(p.Version()).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version of provider %s: %s", p.Name(), err)
+	}
+
+	version, err := latestVersion(p.Name(), p.Version())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find latest version of provider %s: %s", p.Name(), err)
+	}
+
+	latest, err := discovery.VersionStr(version).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse latest version of provider %s: %s", p.Name(), err)
+	}
+
+	if !latest.NewerThan(current) {
+		return nil, fmt.Errorf("no version of provider %s newer than %s available", p.Name(), p.Version())
+	}
+
+	versions := map[string]string{}
+
+	for name, v := range config.Versions {
+		versions[name] = v
+	}
+
+	versions[p.Name()] = version
+	config.Versions = versions
+
+	return Init(ctx, p.Name(), config)
+}
+
+// ResourceTypes launches a provider (without configuring it) and returns the names of its resource types,
+// e.g., to check in advance which resources of a state can be destroyed. Returns nil if the provider
+// is (yet) unsupported.
+func ResourceTypes(providerName string, config Config) (map[string]bool, error) {
+	factory := config.Factory
+	if factory == nil {
+		factory = pluginFactory(config.InstallDir, config.WorkDir, config.Retried, nil)
+	}
+
+	version := config.Version(providerName)
+
+	if _, err := config.verifyLocked(providerName, version); err != nil {
+		return nil, err
+	}
+
+	p, err := factory(providerName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		return nil, nil
+	}
+
+	defer p.Close()
+
+	schema := p.GetSchema()
+	if schema.Diagnostics.HasErrors() {
+		return nil, fmt.Errorf("failed to get schema of provider (name=%s, version=%s): %s",
+			providerName, version, schema.Diagnostics.Err())
+	}
+
+	result := map[string]bool{}
+
+	for t := range schema.ResourceTypes {
+		result[t] = true
+	}
+
+	return result, nil
+}
+
+// verifyLocked checks the installed binary of a provider against the hashes of the lock file
+// if the provider has the locked version (see VerifyLocked).
+func (c Config) verifyLocked(providerName, version string) (Source, error) {
+	locked, ok := c.Locked[providerName]
+	if !ok || locked.Version != version {
+		return "", nil
+	}
+
+	return verifyInstalled(providerName, locked, c.InstallDir, c.WorkDir, c.Retried)
+}
+
+// installed returns the function that is called with the binary of an installed provider (see Installed),
+// or nil if none is set. A binary that has been verified against the lock file (see verifyLocked) before
+// has the source of the verification (i.e., downloaded, unless it was installed already).
+func (c Config) installed(verified Source) func(Binary) {
+	if c.Installed == nil {
+		return nil
+	}
+
+	return func(b Binary) {
+		if verified != "" {
+			b.Source = verified
+			b.Lock = LockMatched
+		}
+
+		c.Installed(b)
+	}
+}
+
+// Version returns the version of a provider supported by terradozer (unless overridden by Versions or Locked),
+// or an empty string otherwise.
+func (c Config) Version(providerName string) string {
+	if version, ok := c.Versions[providerName]; ok {
+		return version
+	}
+
+	if locked, ok := c.Locked[providerName]; ok {
+		return locked.Version
+	}
+
+	return DefaultVersions()[providerName]
+}
+
+// ParseVersions parses a comma-separated list of name=version pairs of providers (e.g., "aws=v3.74.0").
+func ParseVersions(value string) (map[string]string, error) {
+	versions := map[string]string{}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("expected name=version, got: %s", pair)
+		}
+
+		if _, ok := DefaultVersions()[kv[0]]; !ok {
+			return nil, fmt.Errorf("provider is not (yet) supported by terradozer: %s", kv[0])
+		}
+
+		if _, err := discovery.VersionStr(kv[1]).Parse(); err != nil {
+			return nil, fmt.Errorf("invalid version of provider %s: %s", kv[0], err)
+		}
+
+		versions[kv[0]] = kv[1]
+	}
+
+	return versions, nil
+}
+
+// PluginFactory returns a factory that installs (if not installed yet) and launches Terraform Provider Plugins.
+// Only providers supported by terradozer are provided.
+//
+// copied (and modified) from github.com/jckuester/awstools-lib/terraform/provider/provider.go
+func PluginFactory(installDir string) Factory {
+	return pluginFactory(installDir, "", nil, nil)
+}
+
+// pluginFactory returns a factory as PluginFactory, which downloads providers into workDir first (see install).
+// Failed downloads and handshakes are retried, each with the given function (can be nil). The binary of each
+// launched provider is passed to installed (can be nil).
+func pluginFactory(installDir, workDir string, retried func(Stage), installed func(Binary)) Factory {
+	return func(name, version string) (Provider, error) {
+		if version == "" {
+			return nil, nil
+		}
+
+		metaPlugin, source, err := install(name, version, installDir, workDir, retried)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := launch(name, metaPlugin, retried)
+		if err != nil {
+			return nil, err
+		}
+
+		if installed != nil {
+			b, err := newBinary(metaPlugin, source)
+			if err != nil {
+				_ = p.Close()
+
+				return nil, err
+			}
+
+			installed(b)
+		}
+
+		cacheResourceTypes(installDir, name, version, p)
+
+		return p, nil
+	}
+}
+
+// configure configures the provider; only the AWS provider is configured with a non-empty configuration.
+func (p TerraformProvider) configure(ctx context.Context, awsConfig AWSConfig) error {
+	schema := p.GetSchema()
+	if schema.Diagnostics.HasErrors() {
+		return fmt.Errorf("failed to get schema of provider (name=%s, version=%s): %s",
+			p.name, p.version, schema.Diagnostics.Err())
+	}
+
+	pConfig, err := p.providerConfig(schema, awsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to build config of provider (name=%s, version=%s): %s",
+			p.name, p.version, err)
+	}
+
+	err = p.Configure(ctx, pConfig)
+	if err != nil {
+		return fmt.Errorf("failed to configure provider (name=%s, version=%s): %s",
+			p.name, p.version, err)
+	}
+
+	return nil
+}
+
+// providerConfig returns the configuration of the provider, which conforms to the given schema.
+func (p TerraformProvider) providerConfig(schema providers.GetSchemaResponse,
+	awsConfig AWSConfig) (cty.Value, error) {
+	if p.name == "aws" {
+		return awsConfig.ProviderConfig(schema.Provider.Block)
+	}
+
+	if schema.Provider.Block == nil {
+		return cty.EmptyObjectVal, nil
+	}
+
+	return schema.Provider.Block.EmptyValue(), nil
+}
+
+// DefaultVersions returns the versions of the Terraform Provider Plugins supported by terradozer, by provider name.
+func DefaultVersions() map[string]string {
+	return map[string]string{
+		"aws": awsProviderVersion,
+	}
+}
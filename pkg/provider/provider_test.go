@@ -0,0 +1,168 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParseVersions(t *testing.T) {
+	tests := []struct {
+		name             string
+		value            string
+		expectedVersions map[string]string
+		expectedErr      string
+	}{
+		{
+			name:             "version",
+			value:            "aws=v3.74.0",
+			expectedVersions: map[string]string{"aws": "v3.74.0"},
+		},
+		{
+			name:             "empty",
+			value:            "",
+			expectedVersions: map[string]string{},
+		},
+		{
+			name:        "unsupported provider",
+			value:       "random=v3.1.0",
+			expectedErr: "provider is not (yet) supported by terradozer: random",
+		},
+		{
+			name:        "missing version",
+			value:       "aws",
+			expectedErr: "expected name=version, got: aws",
+		},
+		{
+			name:        "invalid version",
+			value:       "aws=latest",
+			expectedErr: "invalid version of provider aws: Malformed version: latest",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := provider.ParseVersions(tc.value)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedVersions, actual)
+		})
+	}
+}
+
+func TestConfig_Version(t *testing.T) {
+	assert.Equal(t, provider.DefaultVersions()["aws"], provider.Config{}.Version("aws"))
+	assert.Equal(t, "v3.74.0", provider.Config{Versions: map[string]string{"aws": "v3.74.0"}}.Version("aws"))
+	assert.Empty(t, provider.Config{}.Version("random"))
+
+	locked := map[string]provider.LockedProvider{"aws": {Version: "v3.50.0"}}
+	assert.Equal(t, "v3.50.0", provider.Config{Locked: locked}.Version("aws"))
+	assert.Equal(t, "v3.74.0", provider.Config{Versions: map[string]string{"aws": "v3.74.0"},
+		Locked: locked}.Version("aws"))
+}
+
+func TestUpgrade(t *testing.T) {
+	tests := []struct {
+		name            string
+		latestVersion   string
+		expectedVersion string
+		expectedErr     string
+	}{
+		{
+			name:            "newer version",
+			latestVersion:   "v3.74.0",
+			expectedVersion: "v3.74.0",
+		},
+		{
+			name:          "same version",
+			latestVersion: "v3.42.0",
+			expectedErr:   "no version of provider aws newer than v3.42.0 available",
+		},
+		{
+			name:          "older version",
+			latestVersion: "v3.1.0",
+			expectedErr:   "no version of provider aws newer than v3.42.0 available",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var startedVersions []string
+
+			config := provider.Config{
+				Versions: map[string]string{"aws": "v3.42.0"},
+				Factory: func(_, version string) (provider.Provider, error) {
+					startedVersions = append(startedVersions, version)
+
+					return provider.NewStub(provider.StubConfig{}, []string{"aws_vpc"}), nil
+				},
+				LatestVersion: func(name, minVersion string) (string, error) {
+					assert.Equal(t, "aws", name)
+					assert.Equal(t, "v3.42.0", minVersion)
+
+					return tc.latestVersion, nil
+				},
+			}
+
+			p, err := provider.Init(context.Background(), "aws", config)
+			require.NoError(t, err)
+
+			actual, err := provider.Upgrade(context.Background(), p, config)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				assert.Equal(t, []string{"v3.42.0"}, startedVersions)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedVersion, actual.Version())
+			assert.Equal(t, "v3.42.0", p.Version())
+			assert.Equal(t, []string{"v3.42.0", tc.expectedVersion}, startedVersions)
+			assert.Equal(t, "v3.42.0", config.Versions["aws"], "versions of the config must not be modified")
+		})
+	}
+}
+
+func TestInit_ReadOnly(t *testing.T) {
+	for _, readOnly := range []bool{false, true} {
+		t.Run(fmt.Sprintf("read-only %t", readOnly), func(t *testing.T) {
+			stub := provider.NewStub(provider.StubConfig{}, []string{"aws_vpc"})
+
+			p, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout:  time.Minute,
+				ReadOnly: readOnly,
+				Factory: func(string, string) (provider.Provider, error) {
+					return stub, nil
+				},
+			})
+			require.NoError(t, err)
+
+			state := cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("vpc-1")})
+
+			_, err = p.ReadResource(context.Background(), "aws_vpc", state)
+			require.NoError(t, err)
+
+			err = p.DestroyResource(context.Background(), "aws_vpc", state)
+			if readOnly {
+				require.EqualError(t, err, provider.ErrReadOnly.Error())
+				assert.Empty(t, stub.Destroyed())
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, []string{"aws_vpc.vpc-1"}, stub.Destroyed())
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/terraform/plugin/discovery"
+)
+
+// Stage is a stage of starting a provider, which is named by the error of a failed start (see StartError).
+type Stage string
+
+const (
+	// StageDownload is downloading the provider from the registry.
+	StageDownload Stage = "download"
+	// StageChecksum is verifying the checksum (and signature) of a downloaded provider.
+	StageChecksum Stage = "checksum"
+	// StageExec is executing the plugin binary of the provider.
+	StageExec Stage = "exec"
+	// StageHandshake is the handshake with the plugin process of the provider.
+	StageHandshake Stage = "handshake"
+	// StageDispense is dispensing the provider from the plugin client.
+	StageDispense Stage = "dispense"
+)
+
+//nolint:gochecknoglobals
+var (
+	// maxStartAttempts limits the number of attempts of a stage that is retried (e.g., flaky downloads).
+	maxStartAttempts = 3
+	// startBackoff is the amount of time before a stage is retried, which doubles with each attempt.
+	startBackoff = 500 * time.Millisecond
+
+	// permanentDownloadErrors are the errors of the registry that aren't worth retrying.
+	permanentDownloadErrors = []discovery.Error{
+		discovery.ErrorNoSuitableVersion,
+		discovery.ErrorNoVersionCompatible,
+		discovery.ErrorVersionIncompatible,
+		discovery.ErrorNoSuchProvider,
+		discovery.ErrorNoVersionCompatibleWithPlatform,
+	}
+)
+
+// StartError is the error of a provider that failed to be started (i.e., installed or launched).
+type StartError struct {
+	// Name of the provider.
+	Name string
+	// Stage is the stage that failed.
+	Stage Stage
+	// Attempts is the number of attempts of the stage.
+	Attempts int
+	Err      error
+}
+
+func (e *StartError) Error() string {
+	return fmt.Sprintf("failed to start provider (%s) at stage %s after %d attempt(s): %s",
+		e.Name, e.Stage, e.Attempts, e.Err)
+}
+
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// stageError is the error of a stage of starting a provider, which is retried if retryable.
+type stageError struct {
+	stage     Stage
+	retryable bool
+	err       error
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+// downloadError returns the stage error of a failed download of a provider; only errors of versions that aren't
+// available are permanent.
+func downloadError(err error) error {
+	msg := err.Error()
+
+	for _, permanent := range permanentDownloadErrors {
+		if strings.Contains(msg, string(permanent)) {
+			return &stageError{stage: StageDownload, err: err}
+		}
+	}
+
+	if strings.Contains(strings.ToLower(msg), "checksum") ||
+		strings.Contains(msg, string(discovery.ErrorSignatureVerification)) {
+		return &stageError{stage: StageChecksum, retryable: true, err: err}
+	}
+
+	return &stageError{stage: StageDownload, retryable: true, err: err}
+}
+
+// launchError returns the stage error of a plugin client that failed to start a plugin process; a plugin binary
+// that can't be executed is permanent, while handshakes (e.g., timed out on a busy CI runner) are retried.
+func launchError(err error) error {
+	var execErr *exec.Error
+
+	var pathErr *os.PathError
+
+	if errors.As(err, &execErr) || errors.As(err, &pathErr) {
+		return &stageError{stage: StageExec, err: err}
+	}
+
+	return &stageError{stage: StageHandshake, retryable: true, err: err}
+}
+
+// retryStart runs a start of the provider with the given name until it succeeds, fails with an error that isn't
+// a retryable stage error, or the attempts are exhausted. The given function (can be nil) is called
+// with the stage of each retry. Failed stages are returned as StartError.
+func retryStart(name string, retried func(Stage), start func() error) error {
+	backoff := startBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := start()
+		if err == nil {
+			return nil
+		}
+
+		var se *stageError
+		if !errors.As(err, &se) {
+			return err
+		}
+
+		if !se.retryable || attempt >= maxStartAttempts {
+			return &StartError{Name: name, Stage: se.stage, Attempts: attempt, Err: se.err}
+		}
+
+		log.WithError(se.err).WithFields(log.Fields{
+			"name":    name,
+			"stage":   se.stage,
+			"attempt": attempt,
+		}).Warn("retrying to start provider")
+
+		if retried != nil {
+			retried(se.stage)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,49 @@
+package provider_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaunch_StartError(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		expectedStage    provider.Stage
+		expectedAttempts int
+	}{
+		{
+			name:             "missing binary",
+			path:             filepath.Join(t.TempDir(), "terraform-provider-missing"),
+			expectedStage:    provider.StageExec,
+			expectedAttempts: 1,
+		},
+		{
+			// exits before the handshake, as a plugin that times out would
+			name:             "failed handshake",
+			path:             "/bin/true",
+			expectedStage:    provider.StageHandshake,
+			expectedAttempts: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := provider.Launch(tc.path, time.Minute)
+			require.Error(t, err)
+
+			var startErr *provider.StartError
+			require.True(t, errors.As(err, &startErr))
+
+			assert.Equal(t, tc.expectedStage, startErr.Stage)
+			assert.Equal(t, tc.expectedAttempts, startErr.Attempts)
+			assert.Contains(t, err.Error(), "at stage "+string(tc.expectedStage))
+		})
+	}
+}
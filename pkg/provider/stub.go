@@ -0,0 +1,285 @@
+package provider
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// StubConfig configures stubs, which replace the providers to run the destroy pipeline without any cloud
+// (e.g., to benchmark it; see Stub).
+type StubConfig struct {
+	// Latency is the amount of time each call to import, read, or destroy a resource takes.
+	Latency time.Duration
+	// FailRate is the fraction (between 0 and 1) of resources whose first destroy fails with a dependency
+	// violation, which is worth retrying. Which resources fail only depends on their type, ID, and Seed,
+	// so that runs are reproducible.
+	FailRate float64
+	// Seed selects the resources that fail.
+	Seed int64
+}
+
+// ParseStubConfig parses a comma-separated list of key=value pairs (e.g., "latency=200ms,fail-rate=0.02,seed=1").
+func ParseStubConfig(value string) (StubConfig, error) {
+	var config StubConfig
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return StubConfig{}, fmt.Errorf("expected key=value, got: %s", pair)
+		}
+
+		var err error
+
+		switch kv[0] {
+		case "latency":
+			config.Latency, err = time.ParseDuration(kv[1])
+		case "fail-rate":
+			config.FailRate, err = strconv.ParseFloat(kv[1], 64)
+			if err == nil && (config.FailRate < 0 || config.FailRate > 1) {
+				err = fmt.Errorf("must be between 0 and 1")
+			}
+		case "seed":
+			config.Seed, err = strconv.ParseInt(kv[1], 10, 64)
+		default:
+			return StubConfig{}, fmt.Errorf("unknown key: %s (expected latency, fail-rate, or seed)", kv[0])
+		}
+
+		if err != nil {
+			return StubConfig{}, fmt.Errorf("invalid value of %s: %s", kv[0], err)
+		}
+	}
+
+	return config, nil
+}
+
+// StubFactory returns a factory that provides a stub for every provider, which pretends to manage resources
+// of the given types (e.g., all resource types of a state).
+func StubFactory(config StubConfig, resourceTypes []string) Factory {
+	return func(name, version string) (Provider, error) {
+		return NewStub(config, resourceTypes), nil
+	}
+}
+
+// NewStubSession returns an AWS session whose requests fail without leaving the process, so that
+// resources destroyed (partly) via the AWS API (e.g., with batch deletes) fail instead of touching any cloud.
+func NewStubSession(region string) (*session.Session, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials("stub", "stub", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// set after creating the session, which fails to load a custom CA bundle (AWS_CA_BUNDLE) into a custom transport
+	sess.Config.HTTPClient = &http.Client{Transport: stubTransport{}}
+
+	return sess, nil
+}
+
+// stubTransport rejects every request.
+type stubTransport struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("AWS API is not available with provider stubs: %s %s", req.Method, req.URL.Host)
+}
+
+// Stub is an in-memory provider that imports, reads, and destroys resources of any of its types
+// without any cloud, taking a configurable amount of time per call and injecting failures.
+// Imported resources have only their ID set. A stub records the order in which resources are destroyed
+// and the maximum number of concurrent calls (e.g., to test ordering and parallelism).
+type Stub struct {
+	config StubConfig
+	schema providers.GetSchemaResponse
+
+	mu        sync.Mutex
+	attempts  map[string]int
+	destroyed map[string]bool
+	order     []string
+	calls     int
+	maxCalls  int
+}
+
+// NewStub returns a stub managing resources of the given types.
+func NewStub(config StubConfig, resourceTypes []string) *Stub {
+	schema := providers.GetSchemaResponse{
+		Provider:      providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{},
+	}
+
+	for _, t := range resourceTypes {
+		schema.ResourceTypes[t] = providers.Schema{Block: &configschema.Block{
+			Attributes: map[string]*configschema.Attribute{
+				"id": {Type: cty.String, Optional: true, Computed: true},
+			},
+		}}
+	}
+
+	return &Stub{
+		config:    config,
+		schema:    schema,
+		attempts:  map[string]int{},
+		destroyed: map[string]bool{},
+	}
+}
+
+// Destroyed returns the resources destroyed so far ("<type>.<id>") in the order they have been destroyed.
+func (s *Stub) Destroyed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.order...)
+}
+
+// MaxConcurrentCalls returns the maximum number of calls to import, read, or destroy that ran concurrently.
+func (s *Stub) MaxConcurrentCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maxCalls
+}
+
+// call simulates the latency of a call.
+func (s *Stub) call() {
+	s.mu.Lock()
+	s.calls++
+
+	if s.calls > s.maxCalls {
+		s.maxCalls = s.calls
+	}
+	s.mu.Unlock()
+
+	time.Sleep(s.config.Latency)
+
+	s.mu.Lock()
+	s.calls--
+	s.mu.Unlock()
+}
+
+// Configure implements Provider.
+func (s *Stub) Configure(providers.ConfigureRequest) providers.ConfigureResponse {
+	return providers.ConfigureResponse{}
+}
+
+// GetSchema implements Provider.
+func (s *Stub) GetSchema() providers.GetSchemaResponse {
+	return s.schema
+}
+
+// ImportResourceState implements Provider.
+func (s *Stub) ImportResourceState(req providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	s.call()
+
+	return providers.ImportResourceStateResponse{
+		ImportedResources: []providers.ImportedResource{{
+			TypeName: req.TypeName,
+			State:    cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal(req.ID)}),
+		}},
+	}
+}
+
+// ReadResource implements Provider.
+func (s *Stub) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	s.call()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.destroyed[stubKey(req.TypeName, req.PriorState)] {
+		return providers.ReadResourceResponse{NewState: cty.NullVal(req.PriorState.Type())}
+	}
+
+	return providers.ReadResourceResponse{NewState: req.PriorState}
+}
+
+// PlanResourceChange implements Planner; changes are planned as proposed.
+func (s *Stub) PlanResourceChange(req providers.PlanResourceChangeRequest) providers.PlanResourceChangeResponse {
+	return providers.PlanResourceChangeResponse{PlannedState: req.ProposedNewState}
+}
+
+// ApplyResourceChange implements Provider; only destroys are supported.
+func (s *Stub) ApplyResourceChange(req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	s.call()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !req.PlannedState.IsNull() {
+		return providers.ApplyResourceChangeResponse{NewState: req.PlannedState}
+	}
+
+	key := stubKey(req.TypeName, req.PriorState)
+
+	s.attempts[key]++
+
+	if s.attempts[key] == 1 && s.fails(key) {
+		var diags tfdiags.Diagnostics
+
+		return providers.ApplyResourceChangeResponse{
+			Diagnostics: diags.Append(tfdiags.Sourceless(tfdiags.Error,
+				"DependencyViolation: failure injected by provider stub", key)),
+		}
+	}
+
+	if !s.destroyed[key] {
+		s.destroyed[key] = true
+		s.order = append(s.order, key)
+	}
+
+	return providers.ApplyResourceChangeResponse{NewState: cty.NullVal(cty.DynamicPseudoType)}
+}
+
+// fails returns true if the first destroy of the resource with the given key fails.
+func (s *Stub) fails(key string) bool {
+	if s.config.FailRate == 0 {
+		return false
+	}
+
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%d/%s", s.config.Seed, key)
+
+	return float64(h.Sum64()%1000000)/1000000 < s.config.FailRate
+}
+
+// Stop implements Provider.
+func (s *Stub) Stop() error {
+	return nil
+}
+
+// Close implements Provider.
+func (s *Stub) Close() error {
+	return nil
+}
+
+// stubKey returns the key of a resource with the given type and state.
+func stubKey(terraformType string, state cty.Value) string {
+	id := ""
+
+	if !state.IsNull() && state.Type().IsObjectType() && state.Type().HasAttribute("id") {
+		if v := state.GetAttr("id"); v.IsKnown() && !v.IsNull() {
+			id = v.AsString()
+		}
+	}
+
+	return terraformType + "." + id
+}
@@ -0,0 +1,69 @@
+package provider_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStubConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedConfig provider.StubConfig
+		expectedErr    string
+	}{
+		{
+			name:           "all keys",
+			value:          "latency=200ms, fail-rate=0.02,seed=7",
+			expectedConfig: provider.StubConfig{Latency: 200 * time.Millisecond, FailRate: 0.02, Seed: 7},
+		},
+		{
+			name:           "defaults",
+			value:          "",
+			expectedConfig: provider.StubConfig{},
+		},
+		{
+			name:        "fail rate out of range",
+			value:       "fail-rate=2",
+			expectedErr: "invalid value of fail-rate: must be between 0 and 1",
+		},
+		{
+			name:        "unknown key",
+			value:       "latenzy=1s",
+			expectedErr: "unknown key: latenzy (expected latency, fail-rate, or seed)",
+		},
+		{
+			name:        "missing value",
+			value:       "latency",
+			expectedErr: "expected key=value, got: latency",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := provider.ParseStubConfig(tc.value)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, actual)
+		})
+	}
+}
+
+func TestNewStubSession(t *testing.T) {
+	sess, err := provider.NewStubSession("us-west-2")
+	require.NoError(t, err)
+
+	_, err = ec2.New(sess).DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String("vpc-1")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AWS API is not available with provider stubs")
+}
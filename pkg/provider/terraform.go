@@ -0,0 +1,527 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/go-hclog"
+	goPlugin "github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/plugin"
+	"github.com/hashicorp/terraform/plugin/discovery"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/jckuester/terradozer/pkg/trace"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Provider is the interface that every Terraform Provider Plugin implements.
+// Implement it to use an in-memory provider instead of a plugin (e.g., a fake in tests; see Factory).
+type Provider interface {
+	Configure(providers.ConfigureRequest) providers.ConfigureResponse
+	GetSchema() providers.GetSchemaResponse
+	ReadResource(providers.ReadResourceRequest) providers.ReadResourceResponse
+	ApplyResourceChange(providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse
+	ImportResourceState(providers.ImportResourceStateRequest) providers.ImportResourceStateResponse
+	Stop() error
+	Close() error
+}
+
+// Planner is implemented by providers that plan changes of resources before they are applied (e.g., the provider
+// plugins), so that the provider computes the attributes that change with an update (e.g., an etag) and the private
+// data to apply it with (e.g., timeouts). Changes of providers that don't plan them are applied as proposed.
+type Planner interface {
+	PlanResourceChange(providers.PlanResourceChangeRequest) providers.PlanResourceChangeResponse
+}
+
+// TerraformProvider is a client to call import, read, and destroy on a Terraform Provider Plugin via GRPC.
+//
+// copied (and modified) from github.com/jckuester/awstools-lib/terraform/provider/provider.go
+type TerraformProvider struct {
+	Provider
+	// timeout is the amount of time to wait for a destroy operation of the provider to finish
+	timeout time.Duration
+	// name and version of the provider (empty if unknown)
+	name    string
+	version string
+	// throttled is called each time a call is retried because the AWS API throttled requests (can be nil).
+	throttled func()
+	// readOnly rejects all changes of resources (see Config.ReadOnly).
+	readOnly bool
+	// cache is what is learned during the run for the next runs (nil if disabled; see Config.NoCache).
+	cache *runCache
+}
+
+// ErrReadOnly is the error of changing a resource with a read-only provider (see Config.ReadOnly).
+var ErrReadOnly = errors.New("provider is read-only (resources can't be changed)")
+
+// ErrRequiresReplace is the error of planning an update of a resource that would replace it (see PlanUpdate).
+var ErrRequiresReplace = errors.New("update would replace the resource")
+
+// ApplyResourceChange changes a resource via the provider, unless the provider is read-only.
+func (p TerraformProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	if p.readOnly {
+		var diags tfdiags.Diagnostics
+
+		return providers.ApplyResourceChangeResponse{Diagnostics: diags.Append(ErrReadOnly)}
+	}
+
+	return p.Provider.ApplyResourceChange(req)
+}
+
+// Exited returns true if the given provider is a plugin whose process has exited (e.g., it crashed),
+// so that it can't be used anymore.
+func Exited(p Provider) bool {
+	grpcProvider, ok := p.(*plugin.GRPCProvider)
+	if !ok || grpcProvider.PluginClient == nil {
+		return false
+	}
+
+	return grpcProvider.PluginClient.Exited()
+}
+
+// Launch launches a Provider Plugin executable to provide the RPC server for this plugin.
+// Timeout is the amount of time to wait for a destroy operation of the provider to finish.
+func Launch(pathToPluginExecutable string, timeout time.Duration) (*TerraformProvider, error) {
+	m := discovery.PluginMeta{
+		Path: pathToPluginExecutable,
+	}
+
+	p, err := launch(filepath.Base(pathToPluginExecutable), m, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TerraformProvider{Provider: p, timeout: timeout}, nil
+}
+
+// launch launches the plugin of the provider with the given name, retrying failed handshakes (see retryStart),
+// each with the given function (can be nil).
+func launch(name string, meta discovery.PluginMeta, retried func(Stage)) (providers.Interface, error) {
+	var p providers.Interface
+
+	err := retryStart(name, retried, func() error {
+		var err error
+
+		p, err = providerFactory(meta, hclog.Error)()
+
+		return err
+	})
+
+	return p, err
+}
+
+// copied (and modified) from github.com/hashicorp/terraform/command/plugins.go
+func providerFactory(meta discovery.PluginMeta, loglevel hclog.Level) providers.Factory {
+	return func() (providers.Interface, error) {
+		client := goPlugin.NewClient(clientConfig(meta, loglevel))
+		// Request the RPC client so we can get the provider
+		// so we can build the actual RPC-implemented provider.
+		rpcClient, err := client.Client()
+		if err != nil {
+			// a plugin process that has been started, but failed the handshake, must not be left behind
+			client.Kill()
+
+			return nil, launchError(err)
+		}
+
+		raw, err := rpcClient.Dispense(plugin.ProviderPluginName)
+		if err != nil {
+			client.Kill()
+
+			return nil, &stageError{stage: StageDispense, err: err}
+		}
+
+		// store the client so that the plugin can kill the child process
+		p := raw.(*plugin.GRPCProvider)
+		p.PluginClient = client
+		return p, nil
+	}
+}
+
+// copied (and modified) from terraform/plugin/client.go
+func clientConfig(m discovery.PluginMeta, loglevel hclog.Level) *goPlugin.ClientConfig {
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "plugin",
+		Level:  loglevel,
+		Output: os.Stderr,
+	})
+
+	return &goPlugin.ClientConfig{
+		Cmd:              exec.Command(m.Path), //nolint:gosec
+		HandshakeConfig:  plugin.Handshake,
+		VersionedPlugins: plugin.VersionedPlugins,
+		Managed:          true,
+		Logger:           logger,
+		AllowedProtocols: []goPlugin.Protocol{goPlugin.ProtocolGRPC},
+		AutoMTLS:         true,
+	}
+}
+
+// Name returns the name of the provider (e.g., "aws"), or an empty string if unknown.
+func (p TerraformProvider) Name() string {
+	return p.name
+}
+
+// Version returns the version of the provider, or an empty string if unknown.
+func (p TerraformProvider) Version() string {
+	return p.version
+}
+
+// Configure configures a provider.
+func (p TerraformProvider) Configure(ctx context.Context, config cty.Value) error {
+	var respConf providers.ConfigureResponse
+
+	err := p.Call(ctx, func() {
+		respConf = p.Provider.Configure(providers.ConfigureRequest{
+			Config: config,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return NewDiagnosticsError(respConf.Diagnostics)
+}
+
+// Call runs a (blocking) call to the provider and waits for it to return.
+//
+// If the context is done before, the provider is asked to halt its in-flight operations
+// and the call is abandoned, i.e., Call returns the context's error without waiting any longer.
+// The GRPC calls to the plugin can't be canceled directly, as they don't accept a context.
+func (p TerraformProvider) Call(ctx context.Context, call func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		call()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if err := p.Provider.Stop(); err != nil {
+			log.WithError(err).Debug("failed to stop in-flight operations of provider")
+		}
+
+		return ctx.Err()
+	}
+}
+
+// GetSchemaForResource returns the schema for a specific resource type.
+func (p TerraformProvider) GetSchemaForResource(terraformType string) (providers.Schema, error) {
+	schemas := p.Provider.GetSchema()
+
+	resourceSchema, ok := schemas.ResourceTypes[terraformType]
+	if !ok {
+		return providers.Schema{}, fmt.Errorf("failed to get schema for resource")
+	}
+
+	return resourceSchema, nil
+}
+
+// readTimeout returns the amount of time to retry an import or read of the provider whose requests are throttled
+// by the AWS API (30 seconds, or the timeout of a destroy if that is shorter).
+func (p TerraformProvider) readTimeout() time.Duration {
+	if p.timeout > 0 && p.timeout < 30*time.Second {
+		return p.timeout
+	}
+
+	return 30 * time.Second
+}
+
+// ImportResource imports a Terraform resource by type and ID.
+// Terraform Type and ID is the minimal information needed to uniquely identify a resource.
+// For example, call:
+//
+//	ImportResource(ctx, "aws_instance", "i-1234567890abcdef0")
+//
+// The result is a resource which has only its ID set (all other attributes are empty).
+func (p TerraformProvider) ImportResource(ctx context.Context, terraformType string,
+	id string) ([]providers.ImportedResource, error) {
+	var response providers.ImportResourceStateResponse
+
+	err := resource.Retry(p.readTimeout(), func() *resource.RetryError {
+		err := p.Call(ctx, func() {
+			response = p.ImportResourceState(providers.ImportResourceStateRequest{
+				TypeName: terraformType,
+				ID:       id,
+			})
+		})
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+
+		if response.Diagnostics.HasErrors() {
+			if shouldRetry(response.Diagnostics.Err()) {
+				log.WithError(response.Diagnostics.Err()).Debug("retrying to import resource")
+				p.recordThrottle(response.Diagnostics.Err())
+				traceRetry(ctx, "import", terraformType, response.Diagnostics.Err())
+
+				return resource.RetryableError(response.Diagnostics.Err())
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if response.Diagnostics.HasErrors() {
+		return nil, NewDiagnosticsError(response.Diagnostics)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("import timed out (%s)", p.readTimeout())
+	}
+
+	return response.ImportedResources, nil
+}
+
+// ReadResource refreshes all attributes of a given resource state.
+// For example, this function can be used to populate all attributes of a resource after import.
+// Marks of the given state (e.g., sensitivity marks) are removed before it is sent to the provider
+// and applied again to the refreshed state.
+func (p TerraformProvider) ReadResource(ctx context.Context, terraformType string,
+	state cty.Value) (cty.Value, error) {
+	var response providers.ReadResourceResponse
+
+	state, marks := unmarkDeep(state)
+
+	err := resource.Retry(p.readTimeout(), func() *resource.RetryError {
+		err := p.Call(ctx, func() {
+			response = p.Provider.ReadResource(providers.ReadResourceRequest{
+				TypeName:   terraformType,
+				PriorState: state,
+			})
+		})
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+
+		if response.Diagnostics.HasErrors() {
+			if shouldRetry(response.Diagnostics.Err()) {
+				log.WithError(response.Diagnostics.Err()).Debug("retrying to read current state of resource")
+				p.recordThrottle(response.Diagnostics.Err())
+				traceRetry(ctx, "read", terraformType, response.Diagnostics.Err())
+
+				return resource.RetryableError(response.Diagnostics.Err())
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && ctx.Err() != nil {
+		return cty.NilVal, ctx.Err()
+	}
+
+	if response.Diagnostics.HasErrors() {
+		return cty.NilVal, NewDiagnosticsError(response.Diagnostics)
+	}
+
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("read timed out (%s)", p.readTimeout())
+	}
+
+	if len(marks) > 0 && response.NewState != cty.NilVal {
+		return response.NewState.MarkWithPaths(marks), nil
+	}
+
+	return response.NewState, nil
+}
+
+// PlanUpdate plans an update of a resource from its prior state to the given configuration and returns
+// the planned state and private data to apply the update with (see Planner). Fails if the update would
+// replace the resource.
+func (p TerraformProvider) PlanUpdate(ctx context.Context, terraformType string, priorState,
+	config cty.Value) (cty.Value, []byte, error) {
+	planner, ok := p.Provider.(Planner)
+	if !ok {
+		return config, nil, nil
+	}
+
+	var response providers.PlanResourceChangeResponse
+
+	err := p.Call(ctx, func() {
+		response = planner.PlanResourceChange(providers.PlanResourceChangeRequest{
+			TypeName:         terraformType,
+			PriorState:       priorState,
+			ProposedNewState: config,
+			Config:           config,
+		})
+	})
+	if err != nil {
+		return cty.NilVal, nil, err
+	}
+
+	if response.Diagnostics.HasErrors() {
+		return cty.NilVal, nil, NewDiagnosticsError(response.Diagnostics)
+	}
+
+	if len(response.RequiresReplace) > 0 {
+		var attrs []string
+
+		for _, path := range response.RequiresReplace {
+			attrs = append(attrs, strings.TrimPrefix(tfdiags.FormatCtyPath(path), "."))
+		}
+
+		return cty.NilVal, nil, fmt.Errorf("%w (due to %s)", ErrRequiresReplace, strings.Join(attrs, ", "))
+	}
+
+	return response.PlannedState, response.PlannedPrivate, nil
+}
+
+// DestroyResource destroys a resource.
+// This function requires the current state of a resource as input.
+func (p TerraformProvider) DestroyResource(ctx context.Context, terraformType string, currentState cty.Value) error {
+	currentState, _ = unmarkDeep(currentState)
+
+	return p.destroyResource(ctx, terraformType, enableForceDestroyAttributes(currentState))
+}
+
+// DestroyResourceWithoutForce destroys a resource as DestroyResource, but with its force destroy attributes
+// (e.g., force_destroy of an S3 bucket) as they are in the given state, so that destroying fails if the resource
+// can only be deleted by force (e.g., a non-empty bucket).
+func (p TerraformProvider) DestroyResourceWithoutForce(ctx context.Context, terraformType string,
+	currentState cty.Value) error {
+	currentState, _ = unmarkDeep(currentState)
+
+	return p.destroyResource(ctx, terraformType, currentState)
+}
+
+// destroyResource destroys a resource with the given (unmarked) prior state.
+func (p TerraformProvider) destroyResource(ctx context.Context, terraformType string, priorState cty.Value) error {
+	var response providers.ApplyResourceChangeResponse
+
+	err := resource.Retry(p.timeout, func() *resource.RetryError {
+		err := p.Call(ctx, func() {
+			response = p.ApplyResourceChange(providers.ApplyResourceChangeRequest{
+				TypeName:     terraformType,
+				PriorState:   priorState,
+				PlannedState: cty.NullVal(cty.DynamicPseudoType),
+				Config:       cty.NullVal(cty.DynamicPseudoType),
+			})
+		})
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+
+		if response.Diagnostics.HasErrors() {
+			if shouldRetry(response.Diagnostics.Err()) {
+				log.WithError(response.Diagnostics.Err()).Debug("retrying to destroy resource")
+				p.recordThrottle(response.Diagnostics.Err())
+				traceRetry(ctx, "destroy", terraformType, response.Diagnostics.Err())
+
+				return resource.RetryableError(response.Diagnostics.Err())
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if response.Diagnostics.HasErrors() {
+		return NewDiagnosticsError(response.Diagnostics)
+	}
+
+	if err != nil {
+		return fmt.Errorf("destroy timed out (%s)", p.timeout)
+	}
+
+	return nil
+}
+
+// unmarkDeep returns the given value without any marks, which can't be sent to a provider, and the paths of its marks.
+func unmarkDeep(v cty.Value) (cty.Value, []cty.PathValueMarks) {
+	if v == cty.NilVal || !v.ContainsMarked() {
+		return v, nil
+	}
+
+	return v.UnmarkDeepWithPaths()
+}
+
+// recordThrottle reports the given error of a call to be retried if it is caused by throttling.
+func (p TerraformProvider) recordThrottle(err error) {
+	if p.throttled != nil && IsThrottled(err) {
+		p.throttled()
+	}
+}
+
+// traceRetry records a retried call to a provider in the trace of the run (if traced).
+func traceRetry(ctx context.Context, operation, terraformType string, err error) {
+	if trace.FromContext(ctx) == nil {
+		return
+	}
+
+	trace.Instant(ctx, "provider", "retry", map[string]interface{}{
+		"operation": operation,
+		"type":      terraformType,
+		"throttled": IsThrottled(err),
+		"error":     err.Error(),
+	})
+}
+
+// ImportStrategy returns the import strategy that has worked for resources of the given type during previous runs
+// with this provider, if known.
+func (p TerraformProvider) ImportStrategy(terraformType string) (ImportStrategy, bool) {
+	return p.cache.importStrategy(terraformType)
+}
+
+// RecordImportStrategy records the import strategy that has worked for a resource of the given type, which is cached
+// for the next runs once the provider is closed.
+func (p TerraformProvider) RecordImportStrategy(terraformType string, s ImportStrategy) {
+	p.cache.recordImportStrategy(terraformType, s)
+}
+
+// Close writes the cache of the run (if enabled) and shuts down the plugin process if applicable.
+func (p TerraformProvider) Close() error {
+	p.cache.write()
+
+	return p.Provider.Close()
+}
+
+// enableForceDestroyAttributes sets force destroy attributes of a resource to true
+// to be able to successfully delete some resources
+// (eg. a non-empty S3 bucket or a AWS IAM role with attached policies).
+//
+// Note: this function is currently AWS specific.
+func enableForceDestroyAttributes(state cty.Value) cty.Value {
+	stateWithDestroyAttrs := map[string]cty.Value{}
+
+	if state.IsNull() {
+		return state
+	}
+
+	if state.CanIterateElements() {
+		for k, v := range state.AsValueMap() {
+			if k == "force_detach_policies" || k == "force_destroy" {
+				if v.Type().Equals(cty.Bool) {
+					stateWithDestroyAttrs[k] = cty.True
+				}
+			} else {
+				stateWithDestroyAttrs[k] = v
+			}
+		}
+	}
+
+	return cty.ObjectVal(stateWithDestroyAttrs)
+}
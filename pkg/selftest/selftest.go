@@ -0,0 +1,304 @@
+// Package selftest creates a disposable set of cheap AWS resources directly via the AWS API and checks whether
+// they are gone, to test terradozer end to end in a sandbox account (see the selftest command).
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// TagKey is the key of the tag of the sandbox resources, whose value is the ID of the self-test run.
+const TagKey = "terradozer-selftest"
+
+// Resource is a resource of a sandbox by its Terraform type and import ID.
+type Resource struct {
+	Type string
+	ID   string
+}
+
+func (r Resource) String() string {
+	return fmt.Sprintf("%s (%s)", r.Type, r.ID)
+}
+
+// Sandbox are the resources created for a self-test run.
+type Sandbox struct {
+	// RunID is the value of the tag TagKey of the resources (and part of their names).
+	RunID string
+	// Bucket is an S3 bucket with one object, which can only be destroyed with force_destroy.
+	Bucket *Resource
+	// SecurityGroup is a security group referenced by ReferencingSecurityGroup, so that deleting it fails
+	// with a dependency violation until ReferencingSecurityGroup is gone (i.e., it needs to be retried).
+	SecurityGroup *Resource
+	// ReferencingSecurityGroup is a security group with an ingress rule referencing SecurityGroup.
+	ReferencingSecurityGroup *Resource
+	// Parameter is an SSM parameter.
+	Parameter *Resource
+
+	sess *session.Session
+}
+
+// Resources returns the created resources of the sandbox in the order they have been created.
+func (s *Sandbox) Resources() []Resource {
+	var result []Resource
+
+	for _, r := range []*Resource{s.Bucket, s.SecurityGroup, s.ReferencingSecurityGroup, s.Parameter} {
+		if r != nil {
+			result = append(result, *r)
+		}
+	}
+
+	return result
+}
+
+// Region returns the region the resources of the sandbox are created in.
+func (s *Sandbox) Region() string {
+	return aws.StringValue(s.sess.Config.Region)
+}
+
+// AccountID returns the ID of the AWS account of the credentials of the given session.
+func AccountID(ctx context.Context, sess *session.Session) (string, error) {
+	out, err := sts.New(sess).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.Account), nil
+}
+
+// Create creates the resources of a sandbox tagged with the given run ID (lower case letters and digits).
+// If creating a resource fails, the sandbox with the resources that have been created so far
+// is returned with the error (e.g., to clean them up).
+func Create(ctx context.Context, sess *session.Session, runID string) (*Sandbox, error) {
+	s := &Sandbox{RunID: runID, sess: sess}
+	name := "terradozer-selftest-" + runID
+
+	var err error
+
+	// a resource is returned with an error if it has been created, but setting it up has failed
+
+	s.Bucket, err = s.createBucket(ctx, name)
+	if err != nil {
+		return s, fmt.Errorf("failed to create S3 bucket: %s", err)
+	}
+
+	s.SecurityGroup, err = s.createSecurityGroup(ctx, name, "")
+	if err != nil {
+		return s, fmt.Errorf("failed to create security group: %s", err)
+	}
+
+	s.ReferencingSecurityGroup, err = s.createSecurityGroup(ctx, name+"-referencing", s.SecurityGroup.ID)
+	if err != nil {
+		return s, fmt.Errorf("failed to create referencing security group: %s", err)
+	}
+
+	s.Parameter, err = s.createParameter(ctx, "/"+TagKey+"/"+runID)
+	if err != nil {
+		return s, fmt.Errorf("failed to create SSM parameter: %s", err)
+	}
+
+	return s, nil
+}
+
+func (s *Sandbox) createBucket(ctx context.Context, name string) (*Resource, error) {
+	client := s3.New(s.sess)
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(name)}
+
+	// buckets in us-east-1 are created without location constraint
+	if region := s.Region(); region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+	}
+
+	_, err := client.CreateBucketWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := &Resource{Type: "aws_s3_bucket", ID: name}
+
+	_, err = client.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(name),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{{Key: aws.String(TagKey), Value: aws.String(s.RunID)}}},
+	})
+	if err != nil {
+		return bucket, err
+	}
+
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(name),
+		Key:    aws.String("selftest.txt"),
+		Body:   strings.NewReader("created by terradozer selftest"),
+	})
+
+	return bucket, err
+}
+
+// createSecurityGroup creates a security group in the default VPC; if the given ID of another security group
+// isn't empty, the security group gets an ingress rule referencing it.
+func (s *Sandbox) createSecurityGroup(ctx context.Context, name, referencedID string) (*Resource, error) {
+	client := ec2.New(s.sess)
+
+	out, err := client.CreateSecurityGroupWithContext(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(name),
+		Description: aws.String("created by terradozer selftest"),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String(ec2.ResourceTypeSecurityGroup),
+			Tags:         []*ec2.Tag{{Key: aws.String(TagKey), Value: aws.String(s.RunID)}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sg := &Resource{Type: "aws_security_group", ID: aws.StringValue(out.GroupId)}
+
+	if referencedID == "" {
+		return sg, nil
+	}
+
+	_, err = client.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId: aws.String(sg.ID),
+		IpPermissions: []*ec2.IpPermission{{
+			IpProtocol:       aws.String("tcp"),
+			FromPort:         aws.Int64(443),
+			ToPort:           aws.Int64(443),
+			UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String(referencedID)}},
+		}},
+	})
+
+	return sg, err
+}
+
+func (s *Sandbox) createParameter(ctx context.Context, name string) (*Resource, error) {
+	_, err := ssm.New(s.sess).PutParameterWithContext(ctx, &ssm.PutParameterInput{
+		Name:  aws.String(name),
+		Type:  aws.String(ssm.ParameterTypeString),
+		Value: aws.String("created by terradozer selftest"),
+		Tags:  []*ssm.Tag{{Key: aws.String(TagKey), Value: aws.String(s.RunID)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resource{Type: "aws_ssm_parameter", ID: name}, nil
+}
+
+// Remaining returns the resources of the sandbox that still exist, in the order they have been created.
+func (s *Sandbox) Remaining(ctx context.Context) ([]Resource, error) {
+	var result []Resource
+
+	for _, r := range s.Resources() {
+		exists, err := s.exists(ctx, r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if %s exists: %s", r, err)
+		}
+
+		if exists {
+			result = append(result, r)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Sandbox) exists(ctx context.Context, r Resource) (bool, error) {
+	var err error
+
+	switch r.Type {
+	case "aws_s3_bucket":
+		_, err = s3.New(s.sess).HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(r.ID)})
+	case "aws_security_group":
+		_, err = ec2.New(s.sess).DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{
+			GroupIds: []*string{aws.String(r.ID)},
+		})
+	case "aws_ssm_parameter":
+		_, err = ssm.New(s.sess).GetParameterWithContext(ctx, &ssm.GetParameterInput{Name: aws.String(r.ID)})
+	default:
+		return false, fmt.Errorf("unknown type: %s", r.Type)
+	}
+
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Cleanup deletes the resources of the sandbox that still exist in the reverse order of their creation,
+// and returns the errors of the ones that couldn't be deleted.
+func (s *Sandbox) Cleanup(ctx context.Context) []error {
+	remaining, err := s.Remaining(ctx)
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+
+	for i := len(remaining) - 1; i >= 0; i-- {
+		if err := s.delete(ctx, remaining[i]); err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %s", remaining[i], err))
+		}
+	}
+
+	return errs
+}
+
+func (s *Sandbox) delete(ctx context.Context, r Resource) error {
+	switch r.Type {
+	case "aws_s3_bucket":
+		client := s3.New(s.sess)
+
+		_, err := client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(r.ID),
+			Key:    aws.String("selftest.txt"),
+		})
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+
+		_, err = client.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(r.ID)})
+
+		return err
+	case "aws_security_group":
+		_, err := ec2.New(s.sess).DeleteSecurityGroupWithContext(ctx, &ec2.DeleteSecurityGroupInput{
+			GroupId: aws.String(r.ID),
+		})
+
+		return err
+	case "aws_ssm_parameter":
+		_, err := ssm.New(s.sess).DeleteParameterWithContext(ctx, &ssm.DeleteParameterInput{Name: aws.String(r.ID)})
+
+		return err
+	default:
+		return fmt.Errorf("unknown type: %s", r.Type)
+	}
+}
+
+//nolint:gochecknoglobals
+var (
+	// notFoundCodes are the error codes of the AWS API for resources that don't exist.
+	notFoundCodes = map[string]bool{
+		"NotFound":                   true, // S3 HeadBucket (no body, only the status code)
+		s3.ErrCodeNoSuchBucket:       true,
+		s3.ErrCodeNoSuchKey:          true,
+		"InvalidGroup.NotFound":      true,
+		ssm.ErrCodeParameterNotFound: true,
+	}
+)
+
+// isNotFound returns true if the given error is returned by the AWS API for a resource that doesn't exist.
+func isNotFound(err error) bool {
+	var awsErr awserr.Error
+
+	return errors.As(err, &awsErr) && notFoundCodes[awsErr.Code()]
+}
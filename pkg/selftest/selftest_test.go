@@ -0,0 +1,315 @@
+package selftest_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/pkg/selftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAWS is a fake of the AWS APIs used by a sandbox (S3, EC2, SSM, and STS),
+// which keeps the created resources in memory.
+type fakeAWS struct {
+	mu sync.Mutex
+	// buckets are the numbers of objects by bucket name.
+	buckets map[string]int
+	// securityGroups are the IDs of the referenced security groups by security group ID (empty if none).
+	securityGroups map[string]string
+	parameters     map[string]bool
+	// failCreate is the name of an action whose requests fail (e.g., PutParameter).
+	failCreate string
+}
+
+func newFakeAWS(t *testing.T) (*fakeAWS, *session.Session) {
+	f := &fakeAWS{buckets: map[string]int{}, securityGroups: map[string]string{}, parameters: map[string]bool{}}
+
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("test", "test", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	return f, sess
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if target := req.Header.Get("X-Amz-Target"); target != "" {
+		f.ssm(w, req, strings.TrimPrefix(target, "AmazonSSM."))
+
+		return
+	}
+
+	if req.Method == http.MethodPost && req.URL.Path == "/" {
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		f.query(w, req.Form)
+
+		return
+	}
+
+	f.s3(w, req)
+}
+
+// query serves the EC2 and STS APIs.
+func (f *fakeAWS) query(w http.ResponseWriter, form url.Values) {
+	action := form.Get("Action")
+	if action == f.failCreate {
+		ec2Error(w, "UnauthorizedOperation")
+
+		return
+	}
+
+	switch action {
+	case "GetCallerIdentity":
+		fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult><Account>123456789012</Account>`+
+			`</GetCallerIdentityResult></GetCallerIdentityResponse>`)
+	case "CreateSecurityGroup":
+		id := fmt.Sprintf("sg-%d", len(f.securityGroups)+1)
+		f.securityGroups[id] = ""
+
+		fmt.Fprintf(w, `<CreateSecurityGroupResponse><groupId>%s</groupId></CreateSecurityGroupResponse>`, id)
+	case "AuthorizeSecurityGroupIngress":
+		f.securityGroups[form.Get("GroupId")] = form.Get("IpPermissions.1.Groups.1.GroupId")
+
+		fmt.Fprint(w, `<AuthorizeSecurityGroupIngressResponse><return>true</return>`+
+			`</AuthorizeSecurityGroupIngressResponse>`)
+	case "DescribeSecurityGroups":
+		id := form.Get("GroupId.1")
+		if _, ok := f.securityGroups[id]; !ok {
+			ec2Error(w, "InvalidGroup.NotFound")
+
+			return
+		}
+
+		fmt.Fprintf(w, `<DescribeSecurityGroupsResponse><securityGroupInfo><item><groupId>%s</groupId></item>`+
+			`</securityGroupInfo></DescribeSecurityGroupsResponse>`, id)
+	case "DeleteSecurityGroup":
+		id := form.Get("GroupId")
+
+		for _, referenced := range f.securityGroups {
+			if referenced == id {
+				ec2Error(w, "DependencyViolation")
+
+				return
+			}
+		}
+
+		delete(f.securityGroups, id)
+
+		fmt.Fprint(w, `<DeleteSecurityGroupResponse><return>true</return></DeleteSecurityGroupResponse>`)
+	default:
+		ec2Error(w, "InvalidAction")
+	}
+}
+
+func ec2Error(w http.ResponseWriter, code string) {
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprintf(w, `<Response><Errors><Error><Code>%s</Code><Message>fake</Message></Error></Errors>`+
+		`<RequestID>1</RequestID></Response>`, code)
+}
+
+func (f *fakeAWS) ssm(w http.ResponseWriter, req *http.Request, action string) {
+	var input struct{ Name string }
+
+	if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	ssmError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"__type":%q,"message":"fake"}`, code)
+	}
+
+	if action == f.failCreate {
+		ssmError("AccessDeniedException")
+
+		return
+	}
+
+	switch action {
+	case "PutParameter":
+		f.parameters[input.Name] = true
+
+		fmt.Fprint(w, `{"Version":1}`)
+	case "GetParameter":
+		if !f.parameters[input.Name] {
+			ssmError("ParameterNotFound")
+
+			return
+		}
+
+		fmt.Fprintf(w, `{"Parameter":{"Name":%q}}`, input.Name)
+	case "DeleteParameter":
+		if !f.parameters[input.Name] {
+			ssmError("ParameterNotFound")
+
+			return
+		}
+
+		delete(f.parameters, input.Name)
+
+		fmt.Fprint(w, `{}`)
+	default:
+		ssmError("InvalidAction")
+	}
+}
+
+func (f *fakeAWS) s3(w http.ResponseWriter, req *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	_, exists := f.buckets[bucket]
+
+	s3Error := func(status int, code string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `<Error><Code>%s</Code><Message>fake</Message></Error>`, code)
+	}
+
+	switch {
+	case req.Method == http.MethodPut && len(parts) == 1 && req.URL.Query().Has("tagging"):
+		w.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodPut && len(parts) == 1:
+		if f.failCreate == "CreateBucket" {
+			s3Error(http.StatusForbidden, "AccessDenied")
+
+			return
+		}
+
+		f.buckets[bucket] = 0
+	case !exists && req.Method == http.MethodHead:
+		w.WriteHeader(http.StatusNotFound)
+	case !exists:
+		s3Error(http.StatusNotFound, "NoSuchBucket")
+	case req.Method == http.MethodPut:
+		f.buckets[bucket]++
+	case req.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodDelete && len(parts) == 2:
+		if f.buckets[bucket] > 0 {
+			f.buckets[bucket]--
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodDelete:
+		if f.buckets[bucket] > 0 {
+			s3Error(http.StatusConflict, "BucketNotEmpty")
+
+			return
+		}
+
+		delete(f.buckets, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(http.StatusBadRequest, "InvalidRequest")
+	}
+}
+
+func TestCreate(t *testing.T) {
+	fake, sess := newFakeAWS(t)
+
+	sandbox, err := selftest.Create(context.Background(), sess, "1234abcd")
+	require.NoError(t, err)
+
+	expected := []selftest.Resource{
+		{Type: "aws_s3_bucket", ID: "terradozer-selftest-1234abcd"},
+		{Type: "aws_security_group", ID: "sg-1"},
+		{Type: "aws_security_group", ID: "sg-2"},
+		{Type: "aws_ssm_parameter", ID: "/terradozer-selftest/1234abcd"},
+	}
+
+	assert.Equal(t, expected, sandbox.Resources())
+	assert.Equal(t, "us-west-2", sandbox.Region())
+
+	assert.Equal(t, 1, fake.buckets["terradozer-selftest-1234abcd"], "bucket must not be empty")
+	assert.Equal(t, "sg-1", fake.securityGroups["sg-2"], "security group must be referenced")
+
+	remaining, err := sandbox.Remaining(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, expected, remaining)
+
+	assert.Empty(t, sandbox.Cleanup(context.Background()))
+
+	remaining, err = sandbox.Remaining(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+}
+
+func TestCreate_Failed(t *testing.T) {
+	tests := []struct {
+		name              string
+		failCreate        string
+		expectedErr       string
+		expectedResources int
+	}{
+		{
+			name:        "bucket",
+			failCreate:  "CreateBucket",
+			expectedErr: "failed to create S3 bucket",
+		},
+		{
+			name:              "ingress rule of referencing security group",
+			failCreate:        "AuthorizeSecurityGroupIngress",
+			expectedErr:       "failed to create referencing security group",
+			expectedResources: 3,
+		},
+		{
+			name:              "parameter",
+			failCreate:        "PutParameter",
+			expectedErr:       "failed to create SSM parameter",
+			expectedResources: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, sess := newFakeAWS(t)
+			fake.failCreate = tc.failCreate
+
+			sandbox, err := selftest.Create(context.Background(), sess, "1234abcd")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErr)
+
+			// the resources created so far can be cleaned up
+			assert.Len(t, sandbox.Resources(), tc.expectedResources)
+			assert.Empty(t, sandbox.Cleanup(context.Background()))
+
+			assert.Empty(t, fake.buckets)
+			assert.Empty(t, fake.securityGroups)
+			assert.Empty(t, fake.parameters)
+		})
+	}
+}
+
+func TestAccountID(t *testing.T) {
+	_, sess := newFakeAWS(t)
+
+	actual, err := selftest.AccountID(context.Background(), sess)
+	require.NoError(t, err)
+	assert.Equal(t, "123456789012", actual)
+}
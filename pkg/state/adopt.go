@@ -0,0 +1,262 @@
+package state
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/states"
+)
+
+// adoptedName is the name of the resources adopted from a file of resource IDs (see FromIDs),
+// whose instances are keyed by ID (e.g., aws_vpc.adopted["vpc-1234"]).
+const adoptedName = "adopted"
+
+// resourceTypePattern matches resource types, which are prefixed by the name of their provider
+// (e.g., aws_instance).
+var resourceTypePattern = regexp.MustCompile(`^[a-z0-9]+_[a-z0-9_]+$`) //nolint:gochecknoglobals
+
+// Adoption is the result of reading a file of resource IDs (see FromIDs).
+type Adoption struct {
+	// Resources is the number of resources adopted.
+	Resources int
+	// Duplicates is the number of rows that listed a resource already listed before (which are ignored).
+	Duplicates int
+	// Errors are the rows that couldn't be read (which are ignored).
+	Errors []RowError
+}
+
+// RowError is a row of a file of resource IDs that couldn't be read.
+type RowError struct {
+	// Row is the number of the row (starting at 1), which is the line number for CSV files
+	// and the position in the list for JSON files.
+	Row int
+	// Content is the row as it has been read.
+	Content string
+	Err     error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+}
+
+// adoptedResource is a resource listed in a file of resource IDs.
+type adoptedResource struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// FromIDs creates a state of the resources listed by type and ID in the file at the given path,
+// which aren't part of any state (e.g., resources found by a tagging report). Only the IDs of the resources
+// are known, so their states are read (or imported) by ID when they are updated.
+//
+// The file is either a JSON list of objects with "type" and "id" (if its name ends with .json or its content
+// starts with "["), or a CSV file of type,id rows (with an optional header row; lines starting with # are ignored).
+// Malformed rows and duplicates are ignored and returned instead of failing the whole file.
+//
+// The adopted resources are part of the root module and named "adopted" with their IDs as instance keys
+// (e.g., aws_vpc.adopted["vpc-1234"]).
+func FromIDs(path string) (*State, *Adoption, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resources []adoptedResource
+
+	var rowErrs []RowError
+
+	trimmed := bytes.TrimSpace(content)
+
+	if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(trimmed, []byte("[")) {
+		resources, rowErrs, err = readJSONIDs(trimmed)
+	} else {
+		resources, rowErrs, err = readCSVIDs(content)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading %s as a file of resource IDs: %s", path, err)
+	}
+
+	return adopt(resources, rowErrs)
+}
+
+// ResourceID is a resource identified by its type and ID.
+type ResourceID struct {
+	Type string
+	ID   string
+}
+
+// FromResourceIDs creates a state of the given resources, which aren't part of any state (e.g., resources
+// discovered by their tags), as FromIDs does for the resources listed in a file.
+func FromResourceIDs(ids []ResourceID) (*State, *Adoption, error) {
+	var resources []adoptedResource
+
+	var rowErrs []RowError
+
+	for i, id := range ids {
+		r := adoptedResource{Type: id.Type, ID: id.ID}
+
+		if err := r.validate(); err != nil {
+			rowErrs = append(rowErrs, RowError{Row: i + 1, Content: id.Type + "," + id.ID, Err: err})
+
+			continue
+		}
+
+		resources = append(resources, r)
+	}
+
+	return adopt(resources, rowErrs)
+}
+
+// AdoptedAddress returns the address of the resource of the given type and ID in a state created by FromIDs
+// or FromResourceIDs (e.g., aws_vpc.adopted["vpc-1234"]).
+func AdoptedAddress(rType, id string) string {
+	return addrs.Resource{Mode: addrs.ManagedResourceMode, Type: rType, Name: adoptedName}.
+		Instance(addrs.StringKey(id)).Absolute(addrs.RootModuleInstance).String()
+}
+
+// adopt creates a state of the given resources, ignoring duplicates.
+func adopt(resources []adoptedResource, rowErrs []RowError) (*State, *Adoption, error) {
+	adoption := &Adoption{Errors: rowErrs}
+
+	s := states.NewState()
+	seen := map[adoptedResource]bool{}
+
+	for _, r := range resources {
+		if seen[r] {
+			adoption.Duplicates++
+
+			continue
+		}
+
+		seen[r] = true
+		adoption.Resources++
+
+		attrs, err := json.Marshal(map[string]string{"id": r.ID})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resAddr := addrs.Resource{Mode: addrs.ManagedResourceMode, Type: r.Type, Name: adoptedName}
+
+		s.RootModule().SetResourceInstanceCurrent(resAddr.Instance(addrs.StringKey(r.ID)),
+			&states.ResourceInstanceObjectSrc{Status: states.ObjectReady, AttrsJSON: attrs},
+			resAddr.DefaultProviderConfig().Absolute(addrs.RootModuleInstance))
+	}
+
+	return &State{state: s}, adoption, nil
+}
+
+// readJSONIDs reads a JSON list of resources; malformed elements are returned as row errors.
+func readJSONIDs(content []byte) ([]adoptedResource, []RowError, error) {
+	var elements []json.RawMessage
+
+	err := json.Unmarshal(content, &elements)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resources []adoptedResource
+
+	var rowErrs []RowError
+
+	for i, e := range elements {
+		var r adoptedResource
+
+		err := json.Unmarshal(e, &r)
+		if err == nil {
+			err = r.validate()
+		}
+
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Row: i + 1, Content: string(e), Err: err})
+
+			continue
+		}
+
+		resources = append(resources, r)
+	}
+
+	return resources, rowErrs, nil
+}
+
+// readCSVIDs reads rows of type,id; malformed rows are returned as row errors.
+func readCSVIDs(content []byte) ([]adoptedResource, []RowError, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	var resources []adoptedResource
+
+	var rowErrs []RowError
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, nil, err
+			}
+
+			rowErrs = append(rowErrs, RowError{Row: line, Err: err})
+
+			continue
+		}
+
+		if first && len(record) == 2 && strings.EqualFold(record[0], "type") && strings.EqualFold(record[1], "id") {
+			continue
+		}
+
+		content := strings.Join(record, ",")
+
+		if len(record) != 2 {
+			rowErrs = append(rowErrs, RowError{Row: line, Content: content,
+				Err: fmt.Errorf("expected 2 fields (type,id), got %d", len(record))})
+
+			continue
+		}
+
+		r := adoptedResource{Type: strings.TrimSpace(record[0]), ID: strings.TrimSpace(record[1])}
+
+		if err := r.validate(); err != nil {
+			rowErrs = append(rowErrs, RowError{Row: line, Content: content, Err: err})
+
+			continue
+		}
+
+		resources = append(resources, r)
+	}
+
+	return resources, rowErrs, nil
+}
+
+// validate returns an error if the type or ID of a resource is missing or malformed.
+func (r adoptedResource) validate() error {
+	if r.Type == "" {
+		return fmt.Errorf("resource type is missing")
+	}
+
+	if !resourceTypePattern.MatchString(r.Type) {
+		return fmt.Errorf("invalid resource type: %s", r.Type)
+	}
+
+	if r.ID == "" {
+		return fmt.Errorf("resource ID is missing")
+	}
+
+	return nil
+}
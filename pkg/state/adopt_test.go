@@ -0,0 +1,82 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromIDs(t *testing.T) {
+	expectedResourceInstances := []state.ResourceInstance{
+		{Address: `aws_vpc.adopted["vpc-1"]`, Type: "aws_vpc", ID: "vpc-1", Provider: "aws"},
+		{Address: `aws_vpc.adopted["vpc-2"]`, Type: "aws_vpc", ID: "vpc-2", Provider: "aws"},
+		{Address: `random_integer.adopted["12375"]`, Type: "random_integer", ID: "12375", Provider: "random"},
+	}
+
+	tests := []struct {
+		name              string
+		path              string
+		expectedRowErrors []string
+		expectedErrMsg    string
+	}{
+		{
+			name: "CSV",
+			path: "../../test/test-fixtures/ids/ids.csv",
+			expectedRowErrors: []string{
+				"row 7: expected 2 fields (type,id), got 1",
+				"row 8: invalid resource type: AWS VPC",
+				"row 9: resource ID is missing",
+			},
+		},
+		{
+			name: "JSON",
+			path: "../../test/test-fixtures/ids/ids.json",
+			expectedRowErrors: []string{
+				"row 5: resource ID is missing",
+				"row 6: json: cannot unmarshal string into Go value of type state.adoptedResource",
+			},
+		},
+		{
+			name:           "malformed JSON",
+			path:           "../../test/test-fixtures/ids/malformed.json",
+			expectedErrMsg: "failed reading ../../test/test-fixtures/ids/malformed.json as a file of resource IDs",
+		},
+		{
+			name:           "wrong path",
+			path:           "not/exist/ids.csv",
+			expectedErrMsg: "open not/exist/ids.csv: no such file or directory",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualState, adoption, err := state.FromIDs(tc.path)
+
+			if tc.expectedErrMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			var actualRowErrors []string
+
+			for _, rowErr := range adoption.Errors {
+				actualRowErrors = append(actualRowErrors, rowErr.Error())
+			}
+
+			assert.Equal(t, tc.expectedRowErrors, actualRowErrors)
+			assert.Equal(t, 3, adoption.Resources)
+			assert.Equal(t, 1, adoption.Duplicates)
+
+			actualResourceInstances, err := actualState.ResourceInstances()
+			require.NoError(t, err)
+
+			assert.Equal(t, expectedResourceInstances, actualResourceInstances)
+			assert.Equal(t, []string{"aws", "random"}, actualState.ProviderNames())
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/terraform/states/statefile"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// IsRemote returns true if the given location of a state is a URL of an S3 object (e.g.,
+// s3://my-bucket/path/terraform.tfstate) or an HTTP(S) URL rather than a local path.
+func IsRemote(location string) bool {
+	for _, scheme := range []string{"s3://", "http://", "https://"} {
+		if strings.HasPrefix(location, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Read creates a state from the Terraform state file at a given location, which is either a local path or a URL
+// (see IsRemote). S3 objects are read with the given AWS session (the default credential chain is used if nil);
+// a version of an object is read if the URL has a versionId parameter (e.g.,
+// s3://my-bucket/terraform.tfstate?versionId=abc). HTTP(S) URLs are read with a GET request, with basic
+// authentication if the URL has user info (e.g., as used by the http backend of Terraform).
+func Read(ctx context.Context, location string, sess *session.Session) (*State, error) {
+	if !IsRemote(location) {
+		return New(location)
+	}
+
+	content, err := fetch(ctx, location, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	stateFile, err := statefile.Read(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s as a statefile: %s", RedactLocation(location), err)
+	}
+
+	return fromFile(stateFile), nil
+}
+
+// fetch returns the content of the remote state at the given URL.
+func fetch(ctx context.Context, location string, sess *session.Session) ([]byte, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL of state: %s", err)
+	}
+
+	if u.Scheme == "s3" {
+		return fetchS3(ctx, u, sess)
+	}
+
+	return fetchHTTP(ctx, u)
+}
+
+// fetchS3 returns the content of the S3 object at the given URL (s3://bucket/key[?versionId=version]).
+func fetchS3(ctx context.Context, u *url.URL, sess *session.Session) ([]byte, error) {
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("URL of state must be s3://bucket/key, got: %s", u)
+	}
+
+	if sess == nil {
+		var err error
+
+		sess, err = session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS session: %s", err)
+		}
+	}
+
+	// buckets of states are often in another region than the resources
+	config := aws.NewConfig()
+
+	region, err := s3manager.GetBucketRegion(ctx, sess, bucket, aws.StringValue(sess.Config.Region))
+	if err != nil {
+		log.WithError(err).WithField("bucket", bucket).
+			Debug(internal.Pad("failed to get region of bucket; using region of session"))
+	} else {
+		config = config.WithRegion(region)
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+
+	if version := u.Query().Get("versionId"); version != "" {
+		input.VersionId = aws.String(version)
+	}
+
+	output, err := s3.New(sess, config).GetObjectWithContext(ctx, input)
+	if err != nil {
+		if aErr, ok := err.(awserr.Error); ok {
+			switch aErr.Code() {
+			case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, "NoSuchVersion":
+				return nil, fmt.Errorf("state doesn't exist: %s (%s)", u, aErr.Message())
+			}
+		}
+
+		return nil, fmt.Errorf("failed to get state %s: %s", u, err)
+	}
+	defer output.Body.Close()
+
+	return ioutil.ReadAll(output.Body)
+}
+
+// fetchHTTP returns the body of a GET request of the given URL.
+func fetchHTTP(ctx context.Context, u *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the client removes the password from the URL in its errors
+		return nil, fmt.Errorf("failed to get state: %s", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("state doesn't exist: %s", u.Redacted())
+	// the http backend of Terraform returns no content for a state that hasn't been written yet
+	case resp.StatusCode == http.StatusNoContent:
+		return nil, fmt.Errorf("state is empty: %s", u.Redacted())
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("failed to get state %s: %s", u.Redacted(), resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// RedactLocation returns the given location of a state with the password of a URL replaced (see url.URL.Redacted).
+func RedactLocation(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,213 @@
+package state_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRemote(t *testing.T) {
+	tests := []struct {
+		location string
+		expected bool
+	}{
+		{location: "terraform.tfstate"},
+		{location: "/tmp/s3/terraform.tfstate"},
+		{location: "s3://bucket/terraform.tfstate", expected: true},
+		{location: "http://localhost/terraform.tfstate", expected: true},
+		{location: "https://example.com/state", expected: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.location, func(t *testing.T) {
+			assert.Equal(t, tc.expected, state.IsRemote(tc.location))
+		})
+	}
+}
+
+// fakeS3 returns a server serving the given state file as the object s3://states/<key> in versions
+// "old" and "new" (an empty version is the latest one).
+func fakeS3(t *testing.T, key, stateFile string) *httptest.Server {
+	content, err := ioutil.ReadFile(stateFile)
+	require.NoError(t, err)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("X-Amz-Bucket-Region", "eu-west-1")
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/states/" + key:
+			switch r.URL.Query().Get("versionId") {
+			case "", "new", "old":
+				_, _ = w.Write(content)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`<Error><Code>NoSuchVersion</Code>` +
+					`<Message>The specified version does not exist.</Message></Error>`))
+			}
+		case "/states/broken.tfstate":
+			_, _ = w.Write([]byte(`<html>Not a state</html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code>` +
+				`<Message>The specified key does not exist.</Message></Error>`))
+		}
+	}))
+}
+
+func TestRead_S3(t *testing.T) {
+	server := fakeS3(t, "env/terraform.tfstate", "../../test/test-fixtures/tfstates/version4.tfstate")
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("test", "test", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		location       string
+		expectedErrMsg string
+	}{
+		{
+			name:     "latest version",
+			location: "s3://states/env/terraform.tfstate",
+		},
+		{
+			name:     "version",
+			location: "s3://states/env/terraform.tfstate?versionId=old",
+		},
+		{
+			name:           "key doesn't exist",
+			location:       "s3://states/env/other.tfstate",
+			expectedErrMsg: "state doesn't exist: s3://states/env/other.tfstate (The specified key does not exist.)",
+		},
+		{
+			name:     "version doesn't exist",
+			location: "s3://states/env/terraform.tfstate?versionId=unknown",
+			expectedErrMsg: "state doesn't exist: s3://states/env/terraform.tfstate?versionId=unknown " +
+				"(The specified version does not exist.)",
+		},
+		{
+			name:           "object isn't a state",
+			location:       "s3://states/broken.tfstate",
+			expectedErrMsg: "failed reading s3://states/broken.tfstate as a statefile",
+		},
+		{
+			name:           "missing key",
+			location:       "s3://states",
+			expectedErrMsg: "URL of state must be s3://bucket/key, got: s3://states",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualState, err := state.Read(context.Background(), tc.location, sess)
+			if tc.expectedErrMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "0.12.9", actualState.TerraformVersion())
+		})
+	}
+}
+
+func TestRead_HTTP(t *testing.T) {
+	content, err := ioutil.ReadFile("../../test/test-fixtures/tfstates/version4.tfstate")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/state":
+			_, _ = w.Write(content)
+		case "/private":
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	withUser := func(userInfo, path string) string {
+		return strings.Replace(server.URL, "http://", "http://"+userInfo+"@", 1) + path
+	}
+
+	tests := []struct {
+		name           string
+		location       string
+		expectedErrMsg string
+	}{
+		{
+			name:     "state",
+			location: server.URL + "/state",
+		},
+		{
+			name:     "basic authentication",
+			location: withUser("user:secret", "/private"),
+		},
+		{
+			name:           "wrong password",
+			location:       withUser("user:wrong", "/private"),
+			expectedErrMsg: "failed to get state " + withUser("user:xxxxx", "/private") + ": 401 Unauthorized",
+		},
+		{
+			name:           "state doesn't exist",
+			location:       server.URL + "/other",
+			expectedErrMsg: "state doesn't exist: " + server.URL + "/other",
+		},
+		{
+			name:           "empty state",
+			location:       server.URL + "/empty",
+			expectedErrMsg: "state is empty: " + server.URL + "/empty",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualState, err := state.Read(context.Background(), tc.location, nil)
+			if tc.expectedErrMsg != "" {
+				require.EqualError(t, err, tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "0.12.9", actualState.TerraformVersion())
+		})
+	}
+}
+
+func TestRead_Local(t *testing.T) {
+	actualState, err := state.Read(context.Background(), "../../test/test-fixtures/tfstates/version4.tfstate", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "0.12.9", actualState.TerraformVersion())
+}
@@ -6,21 +6,26 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"time"
 
 	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/states"
 	"github.com/hashicorp/terraform/states/statefile"
-	"github.com/jckuester/awstools-lib/terraform"
-	"github.com/jckuester/awstools-lib/terraform/provider"
 	"github.com/jckuester/terradozer/internal"
-	"github.com/jckuester/terradozer/pkg/resource"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
 	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 // State represents a Terraform state.
 type State struct {
 	state *states.State
+	// terraformVersion is the version of Terraform that has written the state (empty if unknown).
+	terraformVersion string
 }
 
 // New creates a state from a given path to a Terraform state file.
@@ -30,7 +35,24 @@ func New(path string) (*State, error) {
 		return nil, err
 	}
 
-	return &State{stateFile.State}, nil
+	return fromFile(stateFile), nil
+}
+
+// fromFile creates a state from a given Terraform state file.
+func fromFile(stateFile *statefile.File) *State {
+	result := &State{state: stateFile.State}
+
+	if stateFile.TerraformVersion != nil {
+		result.terraformVersion = stateFile.TerraformVersion.String()
+	}
+
+	return result
+}
+
+// TerraformVersion returns the version of Terraform that has written the state (i.e., its terraform_version),
+// which is empty if unknown (e.g., for states of resources adopted by ID).
+func (s *State) TerraformVersion() string {
+	return s.terraformVersion
 }
 
 // copied from github.com/hashicorp/terraform/command/show.go
@@ -87,48 +109,199 @@ func removeDuplicates(elements []string) []string {
 //
 // Data sources are not returned as these are managed outside the scope of the state and
 // therefore shouldn't be destroyed.
-func (s *State) Resources(providers map[string]*provider.TerraformProvider) ([]terraform.UpdatableResource, error) {
-	var resources []terraform.UpdatableResource
+func (s *State) Resources(providers map[string]*provider.TerraformProvider) ([]*destroy.Resource, error) {
+	resources, _, err := s.SelectResources(providers, nil)
 
-	for _, resAddr := range lookupAllResourceInstanceAddrs(s.state) {
-		log.WithField("absolute_address", resAddr.String()).
-			Debug(internal.Pad("looked up resource instance address"))
+	return resources, err
+}
 
-		resInstance := s.state.ResourceInstance(resAddr)
+// SelectResources returns the resources in the state that are managed by one of the given providers, split into
+// the ones that match the given filter (can be nil) and the skipped ones. The filter is applied before
+// the attributes of a resource are decoded (i.e., ResourceCandidate.Attrs is cty.NilVal), so that no
+// attributes of skipped resources are decoded (see also Resources). Resources are skipped even if their provider
+// isn't one of the given ones, as only the providers of matching resources are initialized (see SelectedProviderNames).
+//
+// The state is walked resource instance by resource instance, so that even for large states no list of
+// all addresses is built.
+func (s *State) SelectResources(providers map[string]*provider.TerraformProvider,
+	filter destroy.Filter) ([]*destroy.Resource, []destroy.SkippedResource, error) {
+	var resources []*destroy.Resource
 
-		resID, err := getResourceID(resInstance)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get id for resource (addr=%s): %s", resAddr.String(), err)
-		}
+	var skipped []destroy.SkippedResource
 
-		if resAddr.ContainingResource().Resource.Mode != addrs.ManagedResourceMode {
-			log.WithFields(log.Fields{
-				"mode": resAddr.Resource.Resource.Mode,
-				"type": resAddr.Resource.Resource.Type,
-				"id":   resID}).Debug(internal.Pad("ignoring non-managed resource"))
+	err := s.eachResourceObject(addrs.ManagedResourceMode, func(resAddr addrs.AbsResourceInstance,
+		deposed states.DeposedKey, obj *states.ResourceInstanceObjectSrc) error {
+		log.WithFields(log.Fields{"absolute_address": resAddr.String(), "deposed": string(deposed)}).
+			Debug(internal.Pad("looked up resource instance address"))
 
-			continue
+		resID, err := getResourceID(obj)
+		if err != nil {
+			return fmt.Errorf("failed to get id for resource (addr=%s%s): %s", resAddr.String(),
+				deposedSuffix(deposed), err)
 		}
 
 		providerName := resAddr.Resource.Resource.DefaultProviderConfig().StringCompact()
 
 		p, ok := providers[providerName]
+
+		if matched, reason := matchWithoutAttrs(filter, resAddr, deposed, resID); !matched {
+			r := destroy.NewWithState(resAddr.String(), resAddr.Resource.Resource.Type, resID, nil, p, nil)
+			r.Deposed = string(deposed)
+			skipped = append(skipped, destroy.SkippedResource{Resource: r, Reason: reason})
+
+			return nil
+		}
+
 		if !ok {
 			log.WithField("name", providerName).Debug(internal.Pad("Terraform provider not found in providers list"))
 
-			continue
+			return nil
 		}
 
-		resObject, err := getResourceState(resInstance, resAddr.Resource.Resource.Type, p)
+		var dependencies []string
+
+		for _, depAddr := range obj.Dependencies {
+			dependencies = append(dependencies, s.instanceAddrs(depAddr)...)
+		}
+
+		// the attributes stored in the state are used to read the resource if they satisfy the provider's schema,
+		// which saves importing it; otherwise, the resource is imported by its ID
+		var resState, storedState *cty.Value
+
+		resObject, err := getResourceState(obj, resAddr.Resource.Resource.Type, p)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode resource into object (addr=%s): %s", resAddr.String(), err)
+			log.WithError(err).WithField("address", resAddr.String()).
+				Debug(internal.Pad("failed to decode resource attributes stored in state; resource will be imported"))
+
+			// used if the resource can neither be imported nor read (see destroy.Resource.StoredState)
+			if stored, err := decodeLeniently(obj, resAddr.Resource.Resource.Type, p); err == nil {
+				storedState = &stored
+			}
+		} else {
+			resState = &resObject
+		}
+
+		r := destroy.NewWithState(resAddr.String(), resAddr.Resource.Resource.Type, resID, dependencies,
+			p, resState)
+		r.SchemaVersion = obj.SchemaVersion
+		r.Deposed = string(deposed)
+		r.StoredState = storedState
+
+		r.DeleteTimeout, err = getDeleteTimeout(obj)
+		if err != nil {
+			log.WithError(err).WithField("address", resAddr.String()).
+				Debug(internal.Pad("failed to get delete timeout stored in state; default timeout will be used"))
 		}
 
-		r := resource.NewWithState(resAddr.Resource.Resource.Type, resID, p, &resObject)
 		resources = append(resources, r)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resources, skipped, nil
+}
+
+// SelectedProviderNames returns the names of the providers (e.g., "aws") of the resources in the state that match
+// the given filter (can be nil), which is applied as by SelectResources. Only these providers are needed to
+// destroy the selected resources.
+func (s *State) SelectedProviderNames(filter destroy.Filter) []string {
+	var providers []string
+
+	_ = s.eachResourceObject(addrs.ManagedResourceMode, func(resAddr addrs.AbsResourceInstance,
+		deposed states.DeposedKey, obj *states.ResourceInstanceObjectSrc) error {
+		// resources whose ID can't be extracted fail later on (see SelectResources)
+		resID, _ := getResourceID(obj)
+
+		if matched, _ := matchWithoutAttrs(filter, resAddr, deposed, resID); matched {
+			providers = append(providers, resAddr.Resource.Resource.DefaultProviderConfig().StringCompact())
+		}
+
+		return nil
+	})
+
+	return removeDuplicates(providers)
+}
+
+// Regions counts the resources of the AWS provider in the state that match the given filter (can be nil)
+// by the region of their ARNs as recorded in the state (i.e., without asking a provider), e.g., to check that
+// the provider is configured for the region the resources live in. Resources of global services, which match
+// every region (see destroy.IsGlobal; e.g., IAM roles, Route53 zones, or ACM certificates in us-east-1),
+// and resources without ARN are not counted.
+func (s *State) Regions(filter destroy.Filter) map[string]int {
+	result := map[string]int{}
+
+	_ = s.eachResourceObject(addrs.ManagedResourceMode, func(resAddr addrs.AbsResourceInstance,
+		deposed states.DeposedKey, obj *states.ResourceInstanceObjectSrc) error {
+		if resAddr.Resource.Resource.DefaultProviderConfig().StringCompact() != "aws" {
+			return nil
+		}
+
+		resID, _ := getResourceID(obj)
+
+		if matched, _ := matchWithoutAttrs(filter, resAddr, deposed, resID); !matched ||
+			destroy.IsGlobal(resAddr.Resource.Resource.Type, resID) {
+			return nil
+		}
+
+		if region := recordedRegion(obj, resID); region != "" {
+			result[region]++
+		}
+
+		return nil
+	})
+
+	return result
+}
+
+// recordedRegion returns the region of the ARN of an object of a resource instance as recorded in the state
+// (read from its arn attribute or, if not present, from its ID), or an empty string if unknown.
+func recordedRegion(obj *states.ResourceInstanceObjectSrc, resID string) string {
+	var value string
+
+	switch {
+	case obj.AttrsJSON != nil:
+		var attrs struct {
+			ARN string `json:"arn"`
+		}
+
+		if err := json.Unmarshal(obj.AttrsJSON, &attrs); err == nil {
+			value = attrs.ARN
+		}
+	default:
+		value = obj.AttrsFlat["arn"]
 	}
 
-	return resources, nil
+	if value == "" {
+		value = resID
+	}
+
+	parsed, err := arn.Parse(value)
+	if err != nil {
+		return ""
+	}
+
+	return parsed.Region
+}
+
+// matchWithoutAttrs applies the given filter (can be nil) to an object of a resource instance before its attributes
+// are decoded.
+func matchWithoutAttrs(filter destroy.Filter, resAddr addrs.AbsResourceInstance, deposed states.DeposedKey,
+	resID string) (bool, destroy.SkipReason) {
+	if filter == nil {
+		return true, ""
+	}
+
+	return filter.Match(destroy.ResourceCandidate{
+		Address:        resAddr.String(),
+		Type:           resAddr.Resource.Resource.Type,
+		ID:             resID,
+		Deposed:        string(deposed),
+		Attrs:          cty.NilVal,
+		RefreshedAttrs: cty.NilVal,
+	})
 }
 
 // resourceID represents the ID attribute of a Terraform resource.
@@ -136,18 +309,14 @@ type resourceID struct {
 	ID string `json:"id"`
 }
 
-// getResourceID looks up the resource ID amongst all resource attributes.
-func getResourceID(resInstance *states.ResourceInstance) (string, error) {
+// getResourceID looks up the resource ID amongst all attributes of an object of a resource instance.
+func getResourceID(obj *states.ResourceInstanceObjectSrc) (string, error) {
 	var result resourceID
 
-	if !resInstance.HasCurrent() {
-		return "", fmt.Errorf("resource instance has no current object")
-	}
-
-	if resInstance.Current.AttrsJSON != nil {
-		err := json.Unmarshal(resInstance.Current.AttrsJSON, &result)
+	if obj.AttrsJSON != nil {
+		err := json.Unmarshal(obj.AttrsJSON, &result)
 		if err != nil {
-			log.WithField("attributes", resInstance.Current.AttrsJSON).
+			log.WithField("attributes", internal.RenderValue(string(obj.AttrsJSON))).
 				Debug(internal.Pad("JSON-encoded attributes of resource instance"))
 
 			return "", fmt.Errorf("failed to unmarshal JSON-encoded resource instance attributes: %s", err)
@@ -156,70 +325,384 @@ func getResourceID(resInstance *states.ResourceInstance) (string, error) {
 		return result.ID, nil
 	}
 
-	if resInstance.Current.AttrsFlat == nil {
-		log.WithField("attributes", resInstance.Current.AttrsFlat).
+	if obj.AttrsFlat == nil {
+		log.WithField("attributes", obj.AttrsFlat).
 			Debug(internal.Pad("legacy attributes of resource instance"))
 
 		return "", fmt.Errorf("flat attribute map of resource instance is nil")
 	}
 
-	return resInstance.Current.AttrsFlat["id"], nil
+	return obj.AttrsFlat["id"], nil
 }
 
-// getResourceState unmarshals the JSON representation of a resource found in the state file into
-// an internal Terraform state object representation.
-func getResourceState(resInstance *states.ResourceInstance, rType string,
+// getResourceState unmarshals the JSON representation of an object of a resource found in the state file into
+// an internal Terraform state object representation. Returns an error if the representation doesn't satisfy
+// the provider's schema of the resource (i.e., the schema versions differ or required attributes are missing).
+func getResourceState(obj *states.ResourceInstanceObjectSrc, rType string,
 	provider *provider.TerraformProvider) (cty.Value, error) {
-	if !resInstance.HasCurrent() {
-		return cty.NilVal, fmt.Errorf("resource instance has no current object")
-	}
-
 	resourceSchema, err := provider.GetSchemaForResource(rType)
 	if err != nil {
 		return cty.NilVal, err
 	}
 
-	resInstanceObj, err := resInstance.Current.Decode(resourceSchema.Block.ImpliedType())
+	if obj.SchemaVersion != uint64(resourceSchema.Version) {
+		return cty.NilVal, fmt.Errorf("schema version of resource in state (%d) differs from the provider's (%d)",
+			obj.SchemaVersion, resourceSchema.Version)
+	}
+
+	resInstanceObj, err := obj.Decode(resourceSchema.Block.ImpliedType())
 	if err != nil {
 		return cty.NilVal, err
 	}
 
+	for name, attr := range resourceSchema.Block.Attributes {
+		if attr.Required && resInstanceObj.Value.GetAttr(name).IsNull() {
+			return cty.NilVal, fmt.Errorf("required attribute is missing: %s", name)
+		}
+	}
+
 	return resInstanceObj.Value, nil
 }
 
-// copied (and modified) from github.com/hashicorp/terraform/command/state_meta.go
-func lookupAllResourceInstanceAddrs(state *states.State) []addrs.AbsResourceInstance {
-	var ret []addrs.AbsResourceInstance
+// decodeLeniently decodes the JSON-encoded attributes of an object of a resource found in the state file
+// with the provider's schema of the resource, even if they don't satisfy it (e.g., as the schema versions differ):
+// attributes unknown to the schema are dropped, and attributes (or nested blocks) that are missing or can't be
+// decoded are null (or empty).
+func decodeLeniently(obj *states.ResourceInstanceObjectSrc, rType string,
+	provider *provider.TerraformProvider) (cty.Value, error) {
+	if obj.AttrsJSON == nil {
+		return cty.NilVal, fmt.Errorf("resource instance has no JSON-encoded attributes")
+	}
+
+	resourceSchema, err := provider.GetSchemaForResource(rType)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	var attrs map[string]json.RawMessage
+
+	if err := json.Unmarshal(obj.AttrsJSON, &attrs); err != nil {
+		return cty.NilVal, fmt.Errorf("failed to unmarshal JSON-encoded resource instance attributes: %s", err)
+	}
+
+	vals := map[string]cty.Value{}
+
+	for name, attrS := range resourceSchema.Block.Attributes {
+		vals[name] = attrS.EmptyValue()
+
+		if raw, ok := attrs[name]; ok {
+			if v, err := ctyjson.Unmarshal(raw, attrS.Type); err == nil {
+				vals[name] = v
+			}
+		}
+	}
+
+	for name, blockS := range resourceSchema.Block.BlockTypes {
+		vals[name] = blockS.EmptyValue()
+
+		if raw, ok := attrs[name]; ok {
+			if v, err := ctyjson.Unmarshal(raw, blockS.ImpliedType()); err == nil {
+				vals[name] = v
+			}
+		}
+	}
+
+	return cty.ObjectVal(vals), nil
+}
+
+// getDeleteTimeout returns the delete timeout of an object of a resource instance as customized by a "timeouts"
+// block in its configuration (zero if not customized). The provider records the timeouts in the private data
+// of the object (in nanoseconds) and, since the block is part of the resource's schema, in its attributes
+// (e.g., "60m"), which are used if the private data doesn't contain the timeouts.
+func getDeleteTimeout(obj *states.ResourceInstanceObjectSrc) (time.Duration, error) {
+	if len(obj.Private) > 0 {
+		var private map[string]json.RawMessage
+
+		err := json.Unmarshal(obj.Private, &private)
+		if err != nil {
+			return 0, fmt.Errorf("failed to unmarshal private data: %s", err)
+		}
+
+		if raw, ok := private[schema.TimeoutKey]; ok {
+			var timeouts map[string]interface{}
+
+			err := json.Unmarshal(raw, &timeouts)
+			if err != nil {
+				return 0, fmt.Errorf("failed to unmarshal timeouts in private data: %s", err)
+			}
+
+			if nanos, ok := timeouts[schema.TimeoutDelete].(float64); ok && nanos > 0 {
+				return time.Duration(nanos), nil
+			}
+		}
+	}
+
+	if obj.AttrsJSON == nil {
+		return 0, nil
+	}
+
+	var attrs struct {
+		Timeouts *struct {
+			Delete *string `json:"delete"`
+		} `json:"timeouts"`
+	}
+
+	err := json.Unmarshal(obj.AttrsJSON, &attrs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal attributes: %s", err)
+	}
+
+	if attrs.Timeouts == nil || attrs.Timeouts.Delete == nil || *attrs.Timeouts.Delete == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(*attrs.Timeouts.Delete)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse delete timeout: %s", err)
+	}
+
+	return timeout, nil
+}
+
+// ResourceInstance is a managed resource instance of the state, which is known without asking its provider
+// (i.e., its attributes are not decoded).
+type ResourceInstance struct {
+	Address  string `json:"address"`
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	// Deposed is the key of the deposed object of the resource instance (e.g., left behind by a failed
+	// create-before-destroy), which is empty for its current object.
+	Deposed string `json:"deposed,omitempty"`
+	// IDError is the reason why the ID of the resource couldn't be extracted (empty if it could).
+	IDError string `json:"id_error,omitempty"`
+}
+
+// ResourceInstances returns a list of all managed resource instances in the state (data sources are not returned),
+// with an element for each of their objects (i.e., the current one and the deposed ones; see eachResourceObject).
+// In contrast to Resources, no provider is needed. Resources whose ID can't be extracted are returned
+// with an IDError.
+func (s *State) ResourceInstances() ([]ResourceInstance, error) {
+	return s.instances(addrs.ManagedResourceMode), nil
+}
+
+// DataSources returns a list of all data source instances in the state, which are never destroyed.
+func (s *State) DataSources() []ResourceInstance {
+	return s.instances(addrs.DataResourceMode)
+}
+
+// Consumers returns all resource and data source instances in the state with the string values of their attributes
+// (without asking a provider), e.g., to check if they reference resources of another state that would be destroyed
+// (see destroy.FindConsumerReferences). The State of the consumers is left empty.
+func (s *State) Consumers() []destroy.Consumer {
+	var result []destroy.Consumer
+
+	for _, mode := range []addrs.ResourceMode{addrs.ManagedResourceMode, addrs.DataResourceMode} {
+		_ = s.eachResourceInstance(mode, func(resAddr addrs.AbsResourceInstance,
+			resInstance *states.ResourceInstance) error {
+			if resInstance.Current == nil {
+				return nil
+			}
+
+			consumer := destroy.Consumer{Address: resAddr.String(), Values: map[string]string{}}
+
+			switch {
+			case resInstance.Current.AttrsJSON != nil:
+				var attrs map[string]interface{}
+
+				if err := json.Unmarshal(resInstance.Current.AttrsJSON, &attrs); err != nil {
+					log.WithError(err).WithField("address", consumer.Address).
+						Debug("failed to unmarshal attributes of consumer")
+
+					return nil
+				}
+
+				for name, v := range attrs {
+					stringValues(name, v, consumer.Values)
+				}
+			default:
+				// attributes of states written by Terraform before 0.12 are flat already (e.g., subnet_ids.0)
+				for path, v := range resInstance.Current.AttrsFlat {
+					consumer.Values[path] = v
+				}
+			}
+
+			result = append(result, consumer)
+
+			return nil
+		})
+	}
+
+	return result
+}
+
+// stringValues adds the string values of the given (JSON decoded) value at the given path to the result,
+// with the paths of nested attributes and elements (e.g., tags["Name"] or ingress[0]["security_groups"][1]).
+func stringValues(path string, v interface{}, result map[string]string) {
+	switch v := v.(type) {
+	case string:
+		result[path] = v
+	case []interface{}:
+		for i, element := range v {
+			stringValues(fmt.Sprintf("%s[%d]", path, i), element, result)
+		}
+	case map[string]interface{}:
+		for key, element := range v {
+			stringValues(fmt.Sprintf("%s[%q]", path, key), element, result)
+		}
+	}
+}
+
+// instances returns the resource instances in the state with the given mode.
+func (s *State) instances(mode addrs.ResourceMode) []ResourceInstance {
+	var result []ResourceInstance
+
+	_ = s.eachResourceObject(mode, func(resAddr addrs.AbsResourceInstance, deposed states.DeposedKey,
+		obj *states.ResourceInstanceObjectSrc) error {
+		instance := ResourceInstance{
+			Address:  resAddr.String(),
+			Type:     resAddr.Resource.Resource.Type,
+			Provider: resAddr.Resource.Resource.DefaultProviderConfig().StringCompact(),
+			Deposed:  string(deposed),
+		}
+
+		resID, err := getResourceID(obj)
+
+		switch {
+		case err != nil:
+			instance.IDError = err.Error()
+		case resID == "":
+			instance.IDError = "resource instance has no id attribute"
+		default:
+			instance.ID = resID
+		}
+
+		result = append(result, instance)
 
-	for _, ms := range state.Modules {
-		ret = append(ret, collectModuleResourceInstances(ms)...)
+		return nil
+	})
+
+	return result
+}
+
+// eachResourceInstance calls fn for each resource instance in the state with the given mode, sorted by address
+// (same order as `terraform state list`). Stops at the first error returned by fn.
+//
+// Modules, resources, and instances are sorted level by level, so that no list of the addresses of all
+// resource instances needs to be built.
+func (s *State) eachResourceInstance(mode addrs.ResourceMode,
+	fn func(addrs.AbsResourceInstance, *states.ResourceInstance) error) error {
+	var modules []*states.Module
+
+	for _, ms := range s.state.Modules {
+		modules = append(modules, ms)
 	}
 
-	sort.Slice(ret, func(i, j int) bool {
-		return ret[i].Less(ret[j])
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Addr.Less(modules[j].Addr)
 	})
 
-	return ret
+	for _, ms := range modules {
+		var resources []*states.Resource
+
+		for _, rs := range ms.Resources {
+			if rs.Addr.Mode == mode {
+				resources = append(resources, rs)
+			}
+		}
+
+		sort.Slice(resources, func(i, j int) bool {
+			if resources[i].Addr.Type != resources[j].Addr.Type {
+				return resources[i].Addr.Type < resources[j].Addr.Type
+			}
+
+			return resources[i].Addr.Name < resources[j].Addr.Name
+		})
+
+		for _, rs := range resources {
+			for _, key := range sortedInstanceKeys(rs) {
+				err := fn(rs.Addr.Instance(key).Absolute(ms.Addr), rs.Instances[key])
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// eachResourceObject calls fn for each object of the resource instances in the state with the given mode, in the
+// order of eachResourceInstance: first the current object of an instance (if any), then its deposed objects sorted
+// by key (e.g., left behind by a failed create-before-destroy), which are real resources that are destroyed, too.
+// The deposed key of a current object is states.NotDeposed. Stops at the first error returned by fn.
+func (s *State) eachResourceObject(mode addrs.ResourceMode, fn func(addrs.AbsResourceInstance, states.DeposedKey,
+	*states.ResourceInstanceObjectSrc) error) error {
+	return s.eachResourceInstance(mode, func(resAddr addrs.AbsResourceInstance,
+		resInstance *states.ResourceInstance) error {
+		if resInstance.HasCurrent() {
+			if err := fn(resAddr, states.NotDeposed, resInstance.Current); err != nil {
+				return err
+			}
+		}
+
+		var keys []states.DeposedKey
+
+		for key := range resInstance.Deposed {
+			keys = append(keys, key)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i] < keys[j]
+		})
+
+		for _, key := range keys {
+			if err := fn(resAddr, key, resInstance.Deposed[key]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
-// copied from github.com/hashicorp/terraform/command/state_meta.go
-func collectModuleResourceInstances(ms *states.Module) []addrs.AbsResourceInstance {
-	var ret []addrs.AbsResourceInstance
+// deposedSuffix returns how the given deposed key is appended to the address of a resource instance
+// (e.g., " (deposed object 00000001)", as by Terraform), or an empty string for a current object.
+func deposedSuffix(deposed states.DeposedKey) string {
+	if deposed == states.NotDeposed {
+		return ""
+	}
+
+	return fmt.Sprintf(" (deposed object %s)", deposed)
+}
 
-	for _, rs := range ms.Resources {
-		ret = append(ret, collectResourceInstances(ms.Addr, rs)...)
+// instanceAddrs returns the addresses of all instances of the given resource in the state.
+func (s *State) instanceAddrs(resAddr addrs.AbsResource) []string {
+	rs := s.state.Resource(resAddr)
+	if rs == nil {
+		return nil
 	}
 
-	return ret
+	var result []string
+
+	for _, key := range sortedInstanceKeys(rs) {
+		result = append(result, rs.Addr.Instance(key).Absolute(resAddr.Module).String())
+	}
+
+	return result
 }
 
-// copied from github.com/hashicorp/terraform/command/state_meta.go
-func collectResourceInstances(moduleAddr addrs.ModuleInstance, rs *states.Resource) []addrs.AbsResourceInstance {
-	var ret []addrs.AbsResourceInstance
+// sortedInstanceKeys returns the keys of the instances of a resource (e.g., the indices of count), sorted.
+func sortedInstanceKeys(rs *states.Resource) []addrs.InstanceKey {
+	var keys []addrs.InstanceKey
 
 	for key := range rs.Instances {
-		ret = append(ret, rs.Addr.Instance(key).Absolute(moduleAddr))
+		keys = append(keys, key)
 	}
 
-	return ret
+	sort.Slice(keys, func(i, j int) bool {
+		return addrs.InstanceKeyLess(keys[i], keys[j])
+	})
+
+	return keys
 }
@@ -1,14 +1,21 @@
 package state_test
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/jckuester/awstools-lib/terraform"
-	"github.com/jckuester/awstools-lib/terraform/provider"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
 	"github.com/jckuester/awstools-lib/test"
 	testUtil "github.com/jckuester/awstools-lib/test"
-	"github.com/jckuester/terradozer/pkg/resource"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
 	"github.com/jckuester/terradozer/pkg/state"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -17,17 +24,25 @@ import (
 
 func TestNewState(t *testing.T) {
 	tests := []struct {
-		name           string
-		pathToState    string
-		expectedErrMsg string
+		name                     string
+		pathToState              string
+		expectedTerraformVersion string
+		expectedErrMsg           string
 	}{
 		{
-			name:        "state version 3",
-			pathToState: "../../test/test-fixtures/tfstates/version3.tfstate",
+			name:                     "state version 3",
+			pathToState:              "../../test/test-fixtures/tfstates/version3.tfstate",
+			expectedTerraformVersion: "0.11.14",
+		},
+		{
+			name:                     "state version 4",
+			pathToState:              "../../test/test-fixtures/tfstates/version4.tfstate",
+			expectedTerraformVersion: "0.12.9",
 		},
 		{
-			name:        "state version 4",
-			pathToState: "../../test/test-fixtures/tfstates/version4.tfstate",
+			name:                     "state of newer Terraform version",
+			pathToState:              "../../test/test-fixtures/tfstates/terraform-1.5.tfstate",
+			expectedTerraformVersion: "1.5.7",
 		},
 		{
 			name:           "broken state file with malformed JSON",
@@ -49,7 +64,8 @@ func TestNewState(t *testing.T) {
 				assert.Contains(t, err.Error(), tc.expectedErrMsg)
 			} else {
 				require.NoError(t, err)
-				assert.NotNil(t, actualState)
+				require.NotNil(t, actualState)
+				assert.Equal(t, tc.expectedTerraformVersion, actualState.TerraformVersion())
 			}
 		})
 	}
@@ -98,6 +114,394 @@ func TestState_ProviderNames(t *testing.T) {
 	}
 }
 
+func TestState_SelectedProviderNames(t *testing.T) {
+	tests := []struct {
+		name                  string
+		filter                destroy.Filter
+		expectedProviderNames []string
+	}{
+		{
+			name:                  "no filter",
+			expectedProviderNames: []string{"aws", "random"},
+		},
+		{
+			name:                  "all resources of a provider skipped",
+			filter:                destroy.ProtectedTypesFilter{"random_integer"},
+			expectedProviderNames: []string{"aws"},
+		},
+		{
+			name:   "all resources skipped",
+			filter: destroy.ProtectedTypesFilter{"aws_vpc", "random_integer"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := state.New("../../test/test-fixtures/tfstates/multiple-providers.tfstate")
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedProviderNames, s.SelectedProviderNames(tc.filter))
+		})
+	}
+}
+
+func TestState_ResourceInstances(t *testing.T) {
+	tests := []struct {
+		name                      string
+		pathToState               string
+		expectedResourceInstances []state.ResourceInstance
+	}{
+		{
+			name:        "multiple providers",
+			pathToState: "../../test/test-fixtures/tfstates/multiple-providers.tfstate",
+			expectedResourceInstances: []state.ResourceInstance{
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea", Provider: "aws"},
+				{Address: "random_integer.test", Type: "random_integer", ID: "12375", Provider: "random"},
+			},
+		},
+		{
+			name:        "resource without id",
+			pathToState: "../../test/test-fixtures/tfstates/missing-id.tfstate",
+			expectedResourceInstances: []state.ResourceInstance{
+				{Address: "aws_iam_role.test", Type: "aws_iam_role", Provider: "aws",
+					IDError: "resource instance has no id attribute"},
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea", Provider: "aws"},
+			},
+		},
+		{
+			name:        "unusual instance keys",
+			pathToState: "../../test/test-fixtures/tfstates/instance-keys.tfstate",
+			expectedResourceInstances: []state.ResourceInstance{
+				{Address: "aws_instance.web", Type: "aws_instance", ID: "i-nokey", Provider: "aws"},
+				{Address: "aws_instance.web[0]", Type: "aws_instance", ID: "i-0", Provider: "aws"},
+				{Address: "aws_instance.web[2]", Type: "aws_instance", ID: "i-2", Provider: "aws"},
+				{Address: "aws_instance.web[10]", Type: "aws_instance", ID: "i-10", Provider: "aws"},
+				{Address: `aws_s3_bucket_object.file["arn:aws:s3:::bucket"]`, Type: "aws_s3_bucket_object",
+					ID: "arn-key", Provider: "aws"},
+				{Address: `aws_s3_bucket_object.file["assets/css/main.css"]`, Type: "aws_s3_bucket_object",
+					ID: "assets/css/main.css", Provider: "aws"},
+				{Address: `aws_s3_bucket_object.file["café ☕"]`, Type: "aws_s3_bucket_object",
+					ID: "unicode-key", Provider: "aws"},
+				{Address: `aws_s3_bucket_object.file["say \"hi\"\\"]`, Type: "aws_s3_bucket_object",
+					ID: "quoted-key", Provider: "aws"},
+				{Address: `module.site["eu/west:1"].aws_vpc.this`, Type: "aws_vpc", ID: "vpc-module", Provider: "aws"},
+			},
+		},
+		{
+			name:        "deposed objects",
+			pathToState: "../../test/test-fixtures/tfstates/deposed.tfstate",
+			expectedResourceInstances: []state.ResourceInstance{
+				{Address: "aws_vpc.replaced", Type: "aws_vpc", ID: "vpc-replaced", Provider: "aws", Deposed: "00000003"},
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-current", Provider: "aws"},
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-deposed-1", Provider: "aws", Deposed: "00000001"},
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-deposed-2", Provider: "aws", Deposed: "00000002"},
+			},
+		},
+		{
+			name:        "empty state",
+			pathToState: "../../test/test-fixtures/tfstates/empty.tfstate",
+		},
+		{
+			name:        "data source is ignored",
+			pathToState: "../../test/test-fixtures/tfstates/datasource.tfstate",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := state.New(tc.pathToState)
+			require.NoError(t, err)
+
+			actualResourceInstances, err := state.ResourceInstances()
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedResourceInstances, actualResourceInstances)
+		})
+	}
+}
+
+func TestState_ResourceInstances_InstanceKeysRoundTrip(t *testing.T) {
+	s, err := state.New("../../test/test-fixtures/tfstates/instance-keys.tfstate")
+	require.NoError(t, err)
+
+	instances, err := s.ResourceInstances()
+	require.NoError(t, err)
+	require.Len(t, instances, 9)
+
+	for _, instance := range instances {
+		t.Run(instance.Address, func(t *testing.T) {
+			canonical, err := destroy.CanonicalAddress(instance.Address)
+			require.NoError(t, err)
+			assert.Equal(t, instance.Address, canonical)
+
+			matched, _ := destroy.ExcludedAddressesFilter{canonical}.Match(destroy.ResourceCandidate{
+				Address: instance.Address, Type: instance.Type, ID: instance.ID})
+			assert.False(t, matched)
+
+			assert.Contains(t, []string{destroy.RootModule, `module.site["eu/west:1"]`},
+				destroy.ModuleOf(instance.Address))
+		})
+	}
+}
+
+func TestState_DataSources(t *testing.T) {
+	state, err := state.New("../../test/test-fixtures/tfstates/datasource.tfstate")
+	require.NoError(t, err)
+
+	actualDataSources := state.DataSources()
+
+	require.Len(t, actualDataSources, 1)
+	assert.Equal(t, "data.aws_ami.amazon-linux-2", actualDataSources[0].Address)
+	assert.Equal(t, "aws_ami", actualDataSources[0].Type)
+}
+
+// fakeProvider is an in-memory provider, whose only resource type is aws_vpc with the given schema version.
+type fakeProvider struct {
+	schemaVersion int64
+	// cloud are the current attributes of the resources by ID.
+	cloud   map[string]cty.Value
+	imports int
+	reads   int
+}
+
+func (p *fakeProvider) Configure(providers.ConfigureRequest) providers.ConfigureResponse {
+	return providers.ConfigureResponse{}
+}
+
+func (p *fakeProvider) GetSchema() providers.GetSchemaResponse {
+	return providers.GetSchemaResponse{
+		ResourceTypes: map[string]providers.Schema{
+			"aws_vpc": {
+				Version: p.schemaVersion,
+				Block: &configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"id":         {Type: cty.String, Computed: true},
+						"cidr_block": {Type: cty.String, Required: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (p *fakeProvider) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	p.reads++
+
+	return providers.ReadResourceResponse{NewState: p.cloud[req.PriorState.GetAttr("id").AsString()]}
+}
+
+func (p *fakeProvider) ApplyResourceChange(
+	providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	return providers.ApplyResourceChangeResponse{}
+}
+
+func (p *fakeProvider) ImportResourceState(
+	req providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	p.imports++
+
+	return providers.ImportResourceStateResponse{
+		ImportedResources: []providers.ImportedResource{
+			{
+				TypeName: req.TypeName,
+				State: cty.ObjectVal(map[string]cty.Value{
+					"id":         cty.StringVal(req.ID),
+					"cidr_block": cty.NullVal(cty.String),
+				}),
+			},
+		},
+	}
+}
+
+func (p *fakeProvider) Stop() error {
+	return nil
+}
+
+func (p *fakeProvider) Close() error {
+	return nil
+}
+
+func TestState_Resources_ReadWithoutImport(t *testing.T) {
+	cloud := map[string]cty.Value{
+		"vpc-039b3d3fb4ffcf0ea": cty.ObjectVal(map[string]cty.Value{
+			"id":         cty.StringVal("vpc-039b3d3fb4ffcf0ea"),
+			"cidr_block": cty.StringVal("10.1.0.0/16"),
+		}),
+	}
+
+	// the attributes recorded in the state
+	stored := cty.ObjectVal(map[string]cty.Value{
+		"id":         cty.StringVal("vpc-039b3d3fb4ffcf0ea"),
+		"cidr_block": cty.StringVal("10.0.0.0/16"),
+	})
+
+	tests := []struct {
+		name            string
+		schemaVersion   int64
+		expectedImports int
+		// expectedStoredState are the attributes decoded leniently from the state (nil if decoded strictly)
+		expectedStoredState *cty.Value
+	}{
+		{
+			name:          "schema satisfied by stored attributes",
+			schemaVersion: 1,
+		},
+		{
+			name:                "schema version differs",
+			schemaVersion:       2,
+			expectedImports:     1,
+			expectedStoredState: &stored,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeProvider{schemaVersion: tc.schemaVersion, cloud: cloud}
+
+			s, err := state.New("../../test/test-fixtures/tfstates/fake-providers.tfstate")
+			require.NoError(t, err)
+
+			resources, err := s.Resources(map[string]*provider.TerraformProvider{
+				"aws": {Provider: fake},
+			})
+			require.NoError(t, err)
+			require.Len(t, resources, 1)
+			assert.Equal(t, tc.expectedStoredState, resources[0].StoredState)
+
+			err = resources[0].UpdateState(context.Background())
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedImports, fake.imports)
+			assert.Equal(t, 1, fake.reads)
+			// both paths result in the same (current) state of the resource
+			assert.Equal(t, cloud["vpc-039b3d3fb4ffcf0ea"], *resources[0].State())
+		})
+	}
+}
+
+// timeoutsProvider is a provider of VPCs with customizable timeouts, which records the requests to destroy them.
+type timeoutsProvider struct {
+	fakeProvider
+
+	applied []providers.ApplyResourceChangeRequest
+}
+
+func (p *timeoutsProvider) GetSchema() providers.GetSchemaResponse {
+	return providers.GetSchemaResponse{
+		ResourceTypes: map[string]providers.Schema{
+			"aws_vpc": {
+				Version: 1,
+				Block: &configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"id":         {Type: cty.String, Computed: true},
+						"cidr_block": {Type: cty.String, Required: true},
+					},
+					BlockTypes: map[string]*configschema.NestedBlock{
+						"timeouts": {
+							Nesting: configschema.NestingSingle,
+							Block: configschema.Block{
+								Attributes: map[string]*configschema.Attribute{
+									"delete": {Type: cty.String, Optional: true},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (p *timeoutsProvider) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	return providers.ReadResourceResponse{NewState: req.PriorState}
+}
+
+func (p *timeoutsProvider) ApplyResourceChange(
+	req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	p.applied = append(p.applied, req)
+
+	return providers.ApplyResourceChangeResponse{NewState: cty.NullVal(cty.DynamicPseudoType)}
+}
+
+func TestState_Resources_DeleteTimeout(t *testing.T) {
+	tests := []struct {
+		name                  string
+		address               string
+		expectedDeleteTimeout time.Duration
+		// expectedPrivate is the private data passed to the provider to destroy the resource (nil if none)
+		expectedPrivate  map[string]interface{}
+		expectedTimeouts cty.Value
+	}{
+		{
+			name:                  "timeouts in private data",
+			address:               "aws_vpc.private",
+			expectedDeleteTimeout: time.Hour,
+			expectedPrivate: map[string]interface{}{
+				"e2bfb730-ecaa-11e6-8f88-34363bc7c4c0": map[string]interface{}{"delete": float64(time.Hour)},
+			},
+			expectedTimeouts: cty.ObjectVal(map[string]cty.Value{"delete": cty.StringVal("60m")}),
+		},
+		{
+			name:                  "timeouts in attributes only",
+			address:               "aws_vpc.attributes",
+			expectedDeleteTimeout: 45 * time.Minute,
+			expectedPrivate: map[string]interface{}{
+				"e2bfb730-ecaa-11e6-8f88-34363bc7c4c0": map[string]interface{}{"delete": float64(45 * time.Minute)},
+			},
+			expectedTimeouts: cty.ObjectVal(map[string]cty.Value{"delete": cty.StringVal("45m")}),
+		},
+		{
+			name:             "no timeouts",
+			address:          "aws_vpc.default",
+			expectedTimeouts: cty.NullVal(cty.Object(map[string]cty.Type{"delete": cty.String})),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &timeoutsProvider{}
+
+			tp, err := provider.Init(context.Background(), "aws", provider.Config{
+				Timeout: time.Minute,
+				Factory: func(string, string) (provider.Provider, error) {
+					return fake, nil
+				},
+			})
+			require.NoError(t, err)
+
+			s, err := state.New("../../test/test-fixtures/tfstates/timeouts.tfstate")
+			require.NoError(t, err)
+
+			resources, err := s.Resources(map[string]*provider.TerraformProvider{"aws": tp})
+			require.NoError(t, err)
+
+			var r *destroy.Resource
+
+			for _, resource := range resources {
+				if resource.Address() == tc.address {
+					r = resource
+				}
+			}
+			require.NotNil(t, r)
+
+			assert.Equal(t, tc.expectedDeleteTimeout, r.DeleteTimeout)
+
+			require.NoError(t, r.UpdateState(context.Background()))
+			require.NoError(t, r.Destroy(context.Background()))
+
+			require.Len(t, fake.applied, 1)
+			assert.Equal(t, tc.expectedTimeouts, fake.applied[0].PriorState.GetAttr("timeouts"))
+
+			if tc.expectedPrivate == nil {
+				assert.Nil(t, fake.applied[0].PlannedPrivate)
+
+				return
+			}
+
+			var private map[string]interface{}
+
+			require.NoError(t, json.Unmarshal(fake.applied[0].PlannedPrivate, &private))
+			assert.Equal(t, tc.expectedPrivate, private)
+		})
+	}
+}
+
 func TestState_Resources(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test.")
@@ -112,13 +516,14 @@ func TestState_Resources(t *testing.T) {
 	require.NoError(t, err)
 
 	defer testUtil.UnsetAWSEnvs()
-	awsProvider, err := provider.Init("aws", ".terradozer", 10*time.Second)
+	awsProvider, err := provider.Init(context.Background(), "aws",
+		provider.Config{InstallDir: ".terradozer", Timeout: 10 * time.Second})
 	require.NoError(t, err)
 
 	tests := []struct {
 		name              string
 		pathToState       string
-		expectedResources []terraform.UpdatableResource
+		expectedResources []*destroy.Resource
 		expectedErrMsg    string
 		providers         map[string]*provider.TerraformProvider
 	}{
@@ -132,9 +537,9 @@ func TestState_Resources(t *testing.T) {
 			providers: map[string]*provider.TerraformProvider{
 				"aws": awsProvider,
 			},
-			expectedResources: []terraform.UpdatableResource{
-				resource.NewWithState("aws_vpc",
-					"vpc-003104c0d87e7a9f4",
+			expectedResources: []*destroy.Resource{
+				destroy.NewWithState("aws_vpc.test", "aws_vpc",
+					"vpc-003104c0d87e7a9f4", nil,
 					awsProvider, nil),
 			},
 		},
@@ -176,3 +581,245 @@ func TestState_Resources(t *testing.T) {
 		})
 	}
 }
+
+// writeLargeState writes a state with an aws_vpc and an aws_iam_role resource, which have the given number
+// of instances each, and returns the path to it.
+func writeLargeState(t testing.TB, numOfInstances int) string {
+	var vpcs, roles []map[string]interface{}
+
+	for i := 0; i < numOfInstances; i++ {
+		vpcs = append(vpcs, map[string]interface{}{
+			"index_key":      i,
+			"schema_version": 1,
+			"attributes": map[string]interface{}{
+				"id":         fmt.Sprintf("vpc-%d", i),
+				"cidr_block": "10.0.0.0/16",
+			},
+		})
+
+		roles = append(roles, map[string]interface{}{
+			"index_key":      i,
+			"schema_version": 0,
+			"attributes": map[string]interface{}{
+				"id":                 fmt.Sprintf("role-%d", i),
+				"assume_role_policy": strings.Repeat("x", 4096),
+			},
+		})
+	}
+
+	content, err := json.Marshal(map[string]interface{}{
+		"version":           4,
+		"terraform_version": "0.12.18",
+		"serial":            1,
+		"lineage":           "0c2c5d0e-5b0a-2f4e-3b1e-8a3c1e2d4f5a",
+		"outputs":           map[string]interface{}{},
+		"resources": []map[string]interface{}{
+			{
+				"mode":      "managed",
+				"type":      "aws_vpc",
+				"name":      "test",
+				"each":      "list",
+				"provider":  "provider.aws",
+				"instances": vpcs,
+			},
+			{
+				"mode":      "managed",
+				"type":      "aws_iam_role",
+				"name":      "test",
+				"each":      "list",
+				"provider":  "provider.aws",
+				"instances": roles,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "large.tfstate")
+
+	err = ioutil.WriteFile(path, content, 0600)
+	require.NoError(t, err)
+
+	return path
+}
+
+func TestState_SelectResources(t *testing.T) {
+	s, err := state.New(writeLargeState(t, 12))
+	require.NoError(t, err)
+
+	resources, skipped, err := s.SelectResources(map[string]*provider.TerraformProvider{
+		"aws": {Provider: &fakeProvider{schemaVersion: 1}},
+	}, destroy.ProtectedTypesFilter{"aws_iam_role"})
+	require.NoError(t, err)
+
+	var actualAddresses []string
+
+	for _, r := range resources {
+		actualAddresses = append(actualAddresses, r.Address())
+
+		assert.NotNil(t, r.State(), "state of selected resource must be decoded")
+	}
+
+	var expectedAddresses []string
+
+	for i := 0; i < 12; i++ {
+		expectedAddresses = append(expectedAddresses, fmt.Sprintf("aws_vpc.test[%d]", i))
+	}
+
+	assert.Equal(t, expectedAddresses, actualAddresses)
+
+	require.Len(t, skipped, 12)
+
+	for _, s := range skipped {
+		assert.Equal(t, "aws_iam_role", s.Resource.Type())
+		assert.Equal(t, destroy.SkipReasonProtectedType, s.Reason)
+		assert.Nil(t, s.Resource.State(), "state of skipped resource must not be decoded")
+	}
+}
+
+func TestState_SelectResources_SkippedWithoutProvider(t *testing.T) {
+	s, err := state.New("../../test/test-fixtures/tfstates/multiple-providers.tfstate")
+	require.NoError(t, err)
+
+	// the random provider isn't initialized, as all of its resources are skipped
+	resources, skipped, err := s.SelectResources(map[string]*provider.TerraformProvider{
+		"aws": {Provider: &fakeProvider{schemaVersion: 1}},
+	}, destroy.ProtectedTypesFilter{"random_integer"})
+	require.NoError(t, err)
+
+	require.Len(t, resources, 1)
+	assert.Equal(t, "aws_vpc.test", resources[0].Address())
+
+	require.Len(t, skipped, 1)
+	assert.Equal(t, "random_integer.test", skipped[0].Resource.Address())
+}
+
+func TestState_SelectResources_Deposed(t *testing.T) {
+	s, err := state.New("../../test/test-fixtures/tfstates/deposed.tfstate")
+	require.NoError(t, err)
+
+	resources, skipped, err := s.SelectResources(map[string]*provider.TerraformProvider{
+		"aws": {Provider: &fakeProvider{schemaVersion: 1}},
+	}, destroy.ExcludedAddressesFilter{"aws_vpc.replaced"})
+	require.NoError(t, err)
+
+	var actual [][]string
+
+	for _, r := range resources {
+		actual = append(actual, []string{r.Address(), r.ID(), r.Deposed})
+
+		assert.NotNil(t, r.State(), "state of deposed object must be decoded")
+	}
+
+	assert.Equal(t, [][]string{
+		{"aws_vpc.test", "vpc-current", ""},
+		{"aws_vpc.test", "vpc-deposed-1", "00000001"},
+		{"aws_vpc.test", "vpc-deposed-2", "00000002"},
+	}, actual)
+
+	// the deposed object of an excluded resource instance is excluded too
+	require.Len(t, skipped, 1)
+	assert.Equal(t, "vpc-replaced", skipped[0].Resource.ID())
+	assert.Equal(t, "00000003", destroy.DeposedOf(skipped[0].Resource))
+}
+
+// BenchmarkState_SelectResources compares filtering resources while listing them from a large state with
+// filtering them after all resources have been listed (and decoded).
+func BenchmarkState_SelectResources(b *testing.B) {
+	path := writeLargeState(b, 10000)
+
+	providers := map[string]*provider.TerraformProvider{
+		"aws": {Provider: &fakeProvider{schemaVersion: 1}},
+	}
+
+	filter := destroy.ProtectedTypesFilter{"aws_iam_role"}
+
+	b.Run("filter while listing", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			s, err := state.New(path)
+			require.NoError(b, err)
+
+			resources, _, err := s.SelectResources(providers, filter)
+			require.NoError(b, err)
+			require.Len(b, resources, 10000)
+		}
+	})
+
+	b.Run("filter after listing", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			s, err := state.New(path)
+			require.NoError(b, err)
+
+			resources, err := s.Resources(providers)
+			require.NoError(b, err)
+
+			resources, _ = destroy.Select(resources, filter)
+			require.Len(b, resources, 10000)
+		}
+	})
+}
+
+func TestState_Consumers(t *testing.T) {
+	s, err := state.New("../../test/test-fixtures/tfstates/consumer.tfstate")
+	require.NoError(t, err)
+
+	assert.Equal(t, []destroy.Consumer{
+		{
+			Address: "aws_iam_role_policy_attachment.app",
+			Values: map[string]string{
+				"id":         "app-20210601",
+				"policy_arn": "arn:aws:iam::123456789012:policy/shared",
+				"role":       "app",
+			},
+		},
+		{
+			Address: "aws_security_group.app",
+			Values: map[string]string{
+				"description":                      "vpc-1234 is shared",
+				"id":                               "sg-5678",
+				`ingress[0]["security_groups"][0]`: "sg-1111",
+				"name":                             "app",
+				`tags["Name"]`:                     "app",
+				"vpc_id":                           "vpc-1234",
+			},
+		},
+		{
+			Address: "data.aws_vpc.shared",
+			Values: map[string]string{
+				"cidr_block":   "10.0.0.0/16",
+				"id":           "vpc-1234",
+				`tags["Name"]`: "shared",
+			},
+		},
+	}, s.Consumers())
+}
+
+func TestState_Regions(t *testing.T) {
+	s, err := state.New("../../test/test-fixtures/tfstates/regions.tfstate")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		filter          destroy.Filter
+		expectedRegions map[string]int
+	}{
+		{
+			// the ACM certificate in us-east-1 is global, as it is used by CloudFront
+			name:            "all resources",
+			expectedRegions: map[string]int{"us-east-1": 2, "eu-west-1": 1},
+		},
+		{
+			name:            "filtered",
+			filter:          destroy.ProtectedTypesFilter{"aws_vpc"},
+			expectedRegions: map[string]int{"us-east-1": 1, "eu-west-1": 1},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRegions, s.Regions(tc.filter))
+		})
+	}
+}
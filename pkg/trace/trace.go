@@ -0,0 +1,255 @@
+// Package trace records where the time of a run goes (e.g., starting providers, and importing, reading,
+// and destroying each resource) as spans in the Chrome trace event format, so that a run can be opened
+// in a trace viewer, such as chrome://tracing or https://ui.perfetto.dev.
+//
+// The tracer is passed via the context (see NewContext). Without a tracer, starting and ending spans
+// does nothing but looking up the context.
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pid is the process ID of all events (a trace contains the events of a single run).
+const pid = 1
+
+// Tracer writes the events of a run to a file.
+type Tracer struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	start time.Time
+	// threads are the IDs of the workers by name, which are shown as threads in a trace viewer.
+	threads map[string]int
+	// written is the number of events written so far.
+	written int
+	err     error
+}
+
+// event is an event of the Chrome trace event format; Timestamp and Duration are in microseconds.
+type event struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Scope     string                 `json:"s,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// NewFile returns a tracer writing to the file at the given path (which is truncated).
+func NewFile(path string) (*Tracer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tracer{file: f, w: bufio.NewWriter(f), start: time.Now(), threads: map[string]int{}}
+
+	_, t.err = t.w.WriteString("[")
+
+	t.mu.Lock()
+	t.writeThreadName(0, "main")
+	t.mu.Unlock()
+
+	return t, nil
+}
+
+// Close writes the remaining events and closes the file.
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err == nil {
+		_, t.err = t.w.WriteString("\n]\n")
+	}
+
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+
+	if err := t.file.Close(); t.err == nil {
+		t.err = err
+	}
+
+	return t.err
+}
+
+// write writes an event; must be called with the lock held.
+func (t *Tracer) write(e event) {
+	if t.err != nil {
+		return
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.err = err
+
+		return
+	}
+
+	if t.written > 0 {
+		_, _ = t.w.WriteString(",")
+	}
+
+	t.written++
+
+	_, _ = t.w.WriteString("\n")
+	_, t.err = t.w.Write(b)
+}
+
+// writeThreadName names the thread with the given ID; must be called with the lock held.
+func (t *Tracer) writeThreadName(tid int, name string) {
+	t.write(event{Name: "thread_name", Phase: "M", PID: pid, TID: tid, Args: map[string]interface{}{"name": name}})
+}
+
+// thread returns the ID of the thread with the given name, which is named in the trace when first used.
+func (t *Tracer) thread(name string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tid, ok := t.threads[name]
+	if !ok {
+		tid = len(t.threads) + 1
+		t.threads[name] = tid
+		t.writeThreadName(tid, name)
+	}
+
+	return tid
+}
+
+// since returns the microseconds since the start of the trace.
+func (t *Tracer) since(at time.Time) int64 {
+	return at.Sub(t.start).Microseconds()
+}
+
+type tracerKey struct{}
+
+type workerKey struct{}
+
+// NewContext returns a copy of the given context that carries the given tracer.
+func NewContext(ctx context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// FromContext returns the tracer of the given context (nil if none).
+func FromContext(ctx context.Context) *Tracer {
+	t, _ := ctx.Value(tracerKey{}).(*Tracer)
+
+	return t
+}
+
+// WithWorker returns a copy of the given context whose spans are shown as the thread of the given worker
+// (e.g., the third worker destroying resources), so that it is visible what runs in parallel.
+func WithWorker(ctx context.Context, pool string, worker int) context.Context {
+	t := FromContext(ctx)
+	if t == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, workerKey{}, t.thread(pool+" "+strconv.Itoa(worker)))
+}
+
+// Span is an operation that started and is ended by End.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	category string
+	tid      int
+	start    time.Time
+	args     map[string]interface{}
+}
+
+// Start starts a span of the given category (e.g., "resource") and name (e.g., "destroy") with the given
+// arguments shown in a trace viewer (can be nil). Returns nil if the context carries no tracer.
+func Start(ctx context.Context, category, name string, args map[string]interface{}) *Span {
+	t := FromContext(ctx)
+	if t == nil {
+		return nil
+	}
+
+	tid, _ := ctx.Value(workerKey{}).(int)
+
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+
+	args["goroutine"] = goroutineID()
+
+	return &Span{tracer: t, name: name, category: category, tid: tid, start: time.Now(), args: args}
+}
+
+// End ends the span; a non-nil error is added to the arguments of the span.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	if err != nil {
+		s.args["error"] = err.Error()
+	}
+
+	duration := time.Since(s.start)
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	s.tracer.write(event{
+		Name:      s.name,
+		Category:  s.category,
+		Phase:     "X",
+		Timestamp: s.tracer.since(s.start),
+		Duration:  duration.Microseconds(),
+		PID:       pid,
+		TID:       s.tid,
+		Args:      s.args,
+	})
+}
+
+// Instant records an event without duration (e.g., a throttled request or a closed provider).
+func Instant(ctx context.Context, category, name string, args map[string]interface{}) {
+	t := FromContext(ctx)
+	if t == nil {
+		return
+	}
+
+	tid, _ := ctx.Value(workerKey{}).(int)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.write(event{Name: name, Category: category, Phase: "i", Scope: "t", Timestamp: t.since(time.Now()),
+		PID: pid, TID: tid, Args: args})
+}
+
+// goroutineID returns the ID of the current goroutine, which is only meant to find out which spans
+// ran in the same goroutine.
+func goroutineID() int {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	// the stack starts with "goroutine <id> [running]:"
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		id, _ := strconv.Atoi(string(buf[:i]))
+
+		return id
+	}
+
+	return 0
+}
@@ -0,0 +1,82 @@
+package trace_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// event is the part of an event of the Chrome trace event format checked by the tests.
+type event struct {
+	Name  string                 `json:"name"`
+	Phase string                 `json:"ph"`
+	TID   int                    `json:"tid"`
+	Args  map[string]interface{} `json:"args"`
+}
+
+func TestTracer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+
+	tracer, err := trace.NewFile(path)
+	require.NoError(t, err)
+
+	ctx := trace.NewContext(context.Background(), tracer)
+
+	span := trace.Start(ctx, "run", "plan", nil)
+	span.End(nil)
+
+	workerCtx := trace.WithWorker(ctx, "destroy worker", 2)
+
+	span = trace.Start(workerCtx, "resource", "destroy", map[string]interface{}{"id": "vpc-1"})
+	span.End(fmt.Errorf("DependencyViolation"))
+
+	trace.Instant(workerCtx, "provider", "retry", nil)
+
+	require.NoError(t, tracer.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var events []event
+
+	require.NoError(t, json.Unmarshal(b, &events))
+	require.Len(t, events, 5)
+
+	assert.Equal(t, event{Name: "thread_name", Phase: "M", Args: map[string]interface{}{"name": "main"}}, events[0])
+
+	assert.Equal(t, "plan", events[1].Name)
+	assert.Equal(t, "X", events[1].Phase)
+	assert.Equal(t, 0, events[1].TID)
+
+	assert.Equal(t, event{Name: "thread_name", Phase: "M", TID: 1,
+		Args: map[string]interface{}{"name": "destroy worker 2"}}, events[2])
+
+	assert.Equal(t, "destroy", events[3].Name)
+	assert.Equal(t, 1, events[3].TID)
+	assert.Equal(t, "vpc-1", events[3].Args["id"])
+	assert.Equal(t, "DependencyViolation", events[3].Args["error"])
+	assert.NotZero(t, events[3].Args["goroutine"])
+
+	assert.Equal(t, "retry", events[4].Name)
+	assert.Equal(t, "i", events[4].Phase)
+	assert.Equal(t, 1, events[4].TID)
+}
+
+func TestStart_WithoutTracer(t *testing.T) {
+	ctx := trace.WithWorker(context.Background(), "destroy worker", 1)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		span := trace.Start(ctx, "resource", "destroy", nil)
+		span.End(nil)
+	})
+
+	assert.Zero(t, allocs)
+	assert.Nil(t, trace.Start(ctx, "resource", "destroy", nil))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+)
+
+// mismatchedRegions returns the number of resources (whose ARNs have a region) that are in other regions
+// than the given one and the number of all such resources.
+func mismatchedRegions(regions map[string]int, region string) (int, int) {
+	mismatched, total := 0, 0
+
+	for r, n := range regions {
+		total += n
+
+		if r != region {
+			mismatched += n
+		}
+	}
+
+	return mismatched, total
+}
+
+// checkRegions guards against destroying resources with a provider configured for another region than the one
+// most resources live in, which would fail to find the regional resources, but would still delete the ones
+// of global services (e.g., IAM). If most resources with a region (see state.Regions) are in other regions,
+// the resources are listed by region and the user needs to confirm to continue (in force mode, the run stops).
+// Returns false and the exit code if the run must stop.
+func checkRegions(ctx context.Context, regions map[string]int, region string, dryRun, force bool) (int, bool) {
+	mismatched, total := mismatchedRegions(regions, region)
+	if region == "" || mismatched*2 <= total {
+		return 0, true
+	}
+
+	internal.LogTitle(fmt.Sprintf("most resources are in other regions than the provider's region %s: %d of %d",
+		region, mismatched, total))
+
+	var names []string
+
+	for r := range regions {
+		names = append(names, r)
+	}
+
+	sort.Strings(names)
+
+	for _, r := range names {
+		log.WithField("resources", regions[r]).Warn(internal.Pad(r))
+	}
+
+	if dryRun {
+		return 0, true
+	}
+
+	if force {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ not deleting anything, since most resources are in other "+
+			"regions than the provider's region %s (see above); set the region via -aws-region, or delete the "+
+			"resources anyway with -ignore-region-mismatch\n", region))
+
+		return 1, false
+	}
+
+	confirmed, err := userConfirmed(ctx, func(stdin io.Reader) (bool, error) {
+		return internal.UserConfirmed(stdin, fmt.Sprintf("Are you sure you want to continue with region %s? "+
+			"Only YES will be accepted.", region))
+	})
+	if err != nil && ctx.Err() != nil {
+		return logInterrupted(0, 0), false
+	}
+
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to read confirmation: %s\n", err))
+
+		return 1, false
+	}
+
+	if !confirmed {
+		return 0, false
+	}
+
+	return 0, true
+}
+
+// logGlobalResources logs the number of the given resources that aren't bound to a region (see destroy.IsGlobal),
+// so that reviewers of a regional cleanup understand why they are part of it.
+func logGlobalResources(candidates []destroy.PlannedResource) {
+	global := 0
+
+	for _, c := range candidates {
+		if destroy.IsGlobal(c.Type, c.ID) {
+			global++
+		}
+	}
+
+	if global == 0 {
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("global resources, not bound to a region (not deleted with -exclude-global): %d",
+		global))
+}
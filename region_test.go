@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRegions(t *testing.T) {
+	tests := []struct {
+		name             string
+		regions          map[string]int
+		region           string
+		dryRun           bool
+		force            bool
+		expectedExitCode int
+		expectedOK       bool
+	}{
+		{
+			name:       "same region",
+			regions:    map[string]int{"us-east-1": 3},
+			region:     "us-east-1",
+			force:      true,
+			expectedOK: true,
+		},
+		{
+			name:       "minority in other regions",
+			regions:    map[string]int{"us-east-1": 2, "eu-west-1": 1},
+			region:     "us-east-1",
+			force:      true,
+			expectedOK: true,
+		},
+		{
+			name:       "only global resources",
+			regions:    map[string]int{},
+			region:     "eu-west-1",
+			force:      true,
+			expectedOK: true,
+		},
+		{
+			name:       "unknown region",
+			regions:    map[string]int{"us-east-1": 2},
+			force:      true,
+			expectedOK: true,
+		},
+		{
+			name:       "mismatch in dry run",
+			regions:    map[string]int{"us-east-1": 2, "eu-west-1": 1},
+			region:     "eu-west-1",
+			dryRun:     true,
+			expectedOK: true,
+		},
+		{
+			name:             "mismatch in force mode",
+			regions:          map[string]int{"us-east-1": 2, "eu-west-1": 1},
+			region:           "eu-west-1",
+			force:            true,
+			expectedExitCode: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualExitCode, actualOK := checkRegions(context.Background(), tc.regions, tc.region, tc.dryRun, tc.force)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+			assert.Equal(t, tc.expectedOK, actualOK)
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+)
+
+// runReport is the report of a destroy run written to the file given by -report, which lists the resources
+// that have been deleted (e.g., to check with the verify command that they are still gone).
+type runReport struct {
+	// Region is the AWS region the resources have been destroyed in.
+	Region string `json:"region,omitempty"`
+	// Deleted are the destroyed resources, ordered by address.
+	Deleted []reportedResource `json:"deleted"`
+	// Failed are the resources that failed to be destroyed, ordered by address.
+	Failed []reportedResource `json:"failed,omitempty"`
+	// Skipped are the resources that have not been destroyed, each with the reason why, ordered by address.
+	Skipped []reportedResource `json:"skipped,omitempty"`
+	// Interrupted is true if the run has been interrupted before all resources have been destroyed.
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Remaining are the resources that haven't been processed when the run has been interrupted, ordered by address.
+	Remaining []reportedResource `json:"remaining,omitempty"`
+	// Deferred are the resources that haven't been destroyed, as the caps of their types have been exceeded
+	// (see -cap-behavior trim), ordered by address.
+	Deferred []reportedResource `json:"deferred,omitempty"`
+	// Moved are the resources of the state that have been moved to another address of the new state they are
+	// compared with, which haven't been destroyed (see -diff).
+	Moved []destroy.MovedResource `json:"moved,omitempty"`
+	// Assertion is the result of asserting that all resources are gone after the run (see -assert-empty).
+	Assertion *emptyAssertion `json:"assertion,omitempty"`
+	// InventoryComparison lists the resources outside the state that share its tags (see -inventory-compare).
+	InventoryComparison *inventoryComparison `json:"inventory_comparison,omitempty"`
+	// ProviderRetries are the numbers of retries needed to start the providers by stage (e.g., download),
+	// which show how flaky the network of the run has been.
+	ProviderRetries map[provider.Stage]int `json:"provider_retries,omitempty"`
+	// Providers are the plugin binaries of the providers that have been used by the run, ordered by name and
+	// version (see provider.Config.Installed).
+	Providers []provider.Binary `json:"providers,omitempty"`
+
+	mu sync.Mutex
+}
+
+// reportedResource is a resource listed in a report of a run.
+type reportedResource struct {
+	Address string `json:"address,omitempty"`
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	// Deposed is the key of the deposed object of the resource instance at Address (empty if it's the current
+	// object).
+	Deposed string `json:"deposed,omitempty"`
+	// Error is why the resource failed to be destroyed (or to be verified; empty otherwise).
+	Error string `json:"error,omitempty"`
+	// Diagnostics are the diagnostics of the provider that have caused the error (if any).
+	Diagnostics []provider.Diagnostic `json:"diagnostics,omitempty"`
+	// Remediation is how to change the setting by hand that prevents the resource from being destroyed
+	// (see destroy.ManualActionError; empty otherwise).
+	Remediation string `json:"remediation,omitempty"`
+	// SkipReason is why the resource has been skipped (empty if it hasn't been).
+	SkipReason destroy.SkipReason `json:"skip_reason,omitempty"`
+	// SubResources are the resources imported alongside the resource, which are destroyed along with it
+	// (see destroy.SubResource); they aren't counted separately.
+	SubResources []destroy.SubResource `json:"sub_resources,omitempty"`
+	// Global is true if the resource isn't bound to a region (see destroy.IsGlobal), which explains why it is part
+	// of a regional cleanup.
+	Global bool `json:"global,omitempty"`
+	// ForceDestroy is forceDestroyDisabledByFlag if the force destroy attributes of the resource have been left
+	// as they are (see -no-force; empty otherwise).
+	ForceDestroy string `json:"force_destroy,omitempty"`
+}
+
+// forceDestroyDisabledByFlag marks the resources in a report whose force destroy attributes have been left
+// as they are (see -no-force).
+const forceDestroyDisabledByFlag = "disabled by flag"
+
+// forceDestroyOf returns how a resource is marked in a report whose force destroy attributes have been disabled
+// or not.
+func forceDestroyOf(disabled bool) string {
+	if disabled {
+		return forceDestroyDisabledByFlag
+	}
+
+	return ""
+}
+
+// newRunReport returns a report of a run in the given region.
+func newRunReport(region string) *runReport {
+	return &runReport{Region: region, Deleted: []reportedResource{}}
+}
+
+// deleted adds the destroyed resource of the given event.
+func (r *runReport) deleted(e destroy.ResourceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Deleted = append(r.Deleted, reportedResource{Address: e.Address, Type: e.Type, ID: e.ID, Deposed: e.Deposed,
+		SubResources: e.SubResources, Global: destroy.IsGlobal(e.Type, e.ID),
+		ForceDestroy: forceDestroyOf(e.ForceDestroyDisabled)})
+}
+
+// asserted adds the result of asserting that all resources are gone after the run (see -assert-empty).
+func (r *runReport) asserted(assertion *emptyAssertion) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Assertion = assertion
+}
+
+// compared adds the result of comparing the state with the inventory of tagged resources after the run
+// (see -inventory-compare).
+func (r *runReport) compared(comparison *inventoryComparison) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.InventoryComparison = comparison
+}
+
+// retried records a retry of the given stage of starting a provider (see provider.Config.Retried).
+func (r *runReport) retried(stage provider.Stage) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ProviderRetries == nil {
+		r.ProviderRetries = map[provider.Stage]int{}
+	}
+
+	r.ProviderRetries[stage]++
+}
+
+// installed records the binary of a provider used by the run (see provider.Config.Installed); a binary used several
+// times (e.g., in several regions) is recorded once.
+func (r *runReport) installed(b provider.Binary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.Providers {
+		if p.Path == b.Path && p.SHA256 == b.SHA256 {
+			return
+		}
+	}
+
+	r.Providers = append(r.Providers, b)
+
+	sort.SliceStable(r.Providers, func(i, j int) bool {
+		if r.Providers[i].Name != r.Providers[j].Name {
+			return r.Providers[i].Name < r.Providers[j].Name
+		}
+
+		return r.Providers[i].Version < r.Providers[j].Version
+	})
+}
+
+// complete adds the skipped resources of the given plan and the failed and remaining resources of the given result
+// to the report (replacing the ones added before).
+func (r *runReport) complete(plan *destroy.DestroyPlan, result destroy.Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Failed = nil
+
+	for _, err := range result.Failed {
+		r.Failed = append(r.Failed, reportedResource{
+			Address:      err.Resource.Address(),
+			Type:         err.Resource.Type(),
+			ID:           err.Resource.ID(),
+			Deposed:      destroy.DeposedOf(err.Resource),
+			Error:        err.Error(),
+			Diagnostics:  provider.DiagnosticsOf(err),
+			Remediation:  destroy.RemediationOf(err),
+			SubResources: destroy.SubResourcesOf(err.Resource),
+			Global:       destroy.IsGlobal(err.Resource.Type(), err.Resource.ID()),
+			ForceDestroy: forceDestroyOf(destroy.ForceDestroyDisabledOf(err.Resource)),
+		})
+	}
+
+	r.Skipped = nil
+
+	for _, s := range plan.Skipped {
+		r.Skipped = append(r.Skipped, reportedResource{
+			Address:    s.Resource.Address(),
+			Type:       s.Resource.Type(),
+			ID:         s.Resource.ID(),
+			Deposed:    destroy.DeposedOf(s.Resource),
+			SkipReason: s.Reason,
+			Global:     destroy.IsGlobal(s.Resource.Type(), s.Resource.ID()),
+		})
+	}
+
+	for _, events := range [][]destroy.ResourceEvent{plan.Gone, plan.AlreadyGone} {
+		for _, e := range events {
+			skipped := reportedResource{Address: e.Address, Type: e.Type, ID: e.ID, Deposed: e.Deposed,
+				SkipReason: e.SkipReason, Global: destroy.IsGlobal(e.Type, e.ID)}
+			if e.Err != nil && e.SkipReason != destroy.SkipReasonAlreadyGone {
+				skipped.Error = e.Err.Error()
+				skipped.Diagnostics = provider.DiagnosticsOf(e.Err)
+			}
+
+			r.Skipped = append(r.Skipped, skipped)
+		}
+	}
+
+	r.Deferred = nil
+
+	for _, c := range plan.Deferred {
+		r.Deferred = append(r.Deferred, reportedResource{
+			Address: c.Address,
+			Type:    c.Type,
+			ID:      c.ID,
+			Deposed: c.Deposed,
+			Global:  destroy.IsGlobal(c.Type, c.ID),
+		})
+	}
+
+	r.Interrupted = result.Interrupted
+	r.Remaining = nil
+
+	for _, remaining := range result.Remaining {
+		r.Remaining = append(r.Remaining, reportedResource{
+			Address: remaining.Address(),
+			Type:    remaining.Type(),
+			ID:      remaining.ID(),
+			Deposed: destroy.DeposedOf(remaining),
+			Global:  destroy.IsGlobal(remaining.Type(), remaining.ID()),
+		})
+	}
+
+	sortReportedResources(r.Deleted)
+	sortReportedResources(r.Failed)
+	sortReportedResources(r.Skipped)
+	sortReportedResources(r.Deferred)
+	sortReportedResources(r.Remaining)
+}
+
+// write writes the report with the skipped resources of the given plan and the failed resources of the given result
+// to the file at the given path.
+func (r *runReport) write(path string, plan *destroy.DestroyPlan, result destroy.Result) error {
+	r.complete(plan, result)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path, append(content, '\n'), 0600)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path":    path,
+		"deleted": len(r.Deleted),
+		"failed":  len(r.Failed),
+		"skipped": len(r.Skipped),
+	}).Info(internal.Pad("wrote report of run"))
+
+	return nil
+}
+
+// writeRunReport writes the given report of a run with the given plan and result to the given path, if a report is
+// requested (see -report). Returns false if writing the report failed.
+func writeRunReport(path string, report *runReport, plan *destroy.DestroyPlan, result destroy.Result) bool {
+	if report == nil || path == "" {
+		return true
+	}
+
+	err := report.write(path, plan, result)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to write report of run: %s\n", err))
+
+		return false
+	}
+
+	return true
+}
+
+// readRunReport reads the report of a run from the file at the given path (see -report).
+func readRunReport(path string) (*runReport, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var report runReport
+
+	err = json.Unmarshal(content, &report)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return &report, nil
+}
+
+// sortReportedResources sorts the given resources by address, then by type and ID.
+func sortReportedResources(resources []reportedResource) {
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Address != resources[j].Address {
+			return resources[i].Address < resources[j].Address
+		}
+
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+
+		return resources[i].ID < resources[j].ID
+	})
+}
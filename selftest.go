@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/selftest"
+)
+
+// selftestCommand is the name of the command that destroys a disposable set of resources it has created itself
+// to check that terradozer works in an account (see selftest.Sandbox).
+const selftestCommand = "selftest"
+
+// selftestFlags are the flags of the selftest command.
+type selftestFlags struct {
+	awsAssumeRoleARN string
+	awsEndpointURL   string
+	awsRegion        string
+	providerVersion  string
+	sandboxAccount   string
+	timeout          string
+}
+
+// newSelftestFlagSet returns the flag set of the selftest command.
+func newSelftestFlagSet(f *selftestFlags) *flag.FlagSet {
+	fs := newCommandFlagSet(selftestCommand)
+
+	fs.StringVar(&f.awsAssumeRoleARN, "aws-assume-role-arn", "",
+		"ARN of a role to assume (e.g., of the sandbox account) with the resolved credentials")
+	fs.StringVar(&f.awsEndpointURL, "aws-endpoint-url", "",
+		"Custom endpoint URL for all AWS services (e.g., http://localhost:4566 for LocalStack) "+
+			"or comma-separated list of service=URL pairs")
+	fs.StringVar(&f.awsRegion, "aws-region", "",
+		"AWS region to create and destroy the resources in (defaults to AWS_REGION, AWS_DEFAULT_REGION, "+
+			"or the region of the profile)")
+	fs.StringVar(&f.providerVersion, "provider-version", "",
+		"Comma-separated list of name=version pairs of providers to use instead of the default versions (e.g., aws=v3.74.0)")
+	fs.StringVar(&f.sandboxAccount, "sandbox-account", "",
+		"ID of the AWS account marked as sandbox; the self-test refuses to run in any other account (required)")
+	fs.StringVar(&f.timeout, "timeout", "30s", "Amount of time to wait for a destroy of a resource to finish")
+
+	return fs
+}
+
+// selftestCheck is the outcome of checking a capability of terradozer in a self-test.
+type selftestCheck struct {
+	capability string
+	passed     bool
+	// detail is why the check has failed (if failed).
+	detail string
+}
+
+// runSelftest creates a sandbox of resources via the AWS API, destroys them with the adopt-and-destroy command,
+// and checks that they are gone. Resources that are left over are deleted via the AWS API afterwards.
+// Returns 1 if any check has failed.
+func runSelftest(ctx context.Context, arguments []string, providerFactory provider.Factory) int {
+	var f selftestFlags
+
+	flags := newSelftestFlagSet(&f)
+
+	err := parseFlags(flags, arguments)
+	if err != nil {
+		return usageError(selftestCommand, err)
+	}
+
+	if f.sandboxAccount == "" {
+		return usageError(selftestCommand, fmt.Errorf("-sandbox-account is required, as the self-test creates "+
+			"and destroys resources (only run it in an account meant for that)"))
+	}
+
+	awsConfig := provider.AWSConfig{Region: f.awsRegion, AssumeRoleARN: f.awsAssumeRoleARN}
+
+	if f.awsEndpointURL != "" {
+		err = awsConfig.ParseEndpointURL(f.awsEndpointURL)
+		if err != nil {
+			return usageError(selftestCommand, fmt.Errorf("failed to parse -aws-endpoint-url flag: %s", err))
+		}
+	}
+
+	sess, err := awsConfig.NewSession()
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to create AWS session: %s\n", err))
+
+		return 1
+	}
+
+	internal.LogTitle("checking sandbox account")
+
+	account, err := selftest.AccountID(ctx, sess)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to get ID of AWS account: %s\n", err))
+
+		return 1
+	}
+
+	if account != f.sandboxAccount {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ refusing to run self-test in account %s, which isn't the "+
+			"sandbox account given via -sandbox-account (%s)\n", account, f.sandboxAccount))
+
+		return 1
+	}
+
+	log.WithFields(log.Fields{"account": account, "region": aws.StringValue(sess.Config.Region)}).
+		Info(internal.Pad("running self-test in sandbox account"))
+
+	runID, err := newRunID()
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ %s\n", err))
+
+		return 1
+	}
+
+	internal.LogTitle("creating sandbox resources")
+
+	sandbox, err := selftest.Create(ctx, sess, runID)
+
+	for _, r := range sandbox.Resources() {
+		log.WithFields(log.Fields{"id": r.ID, "tag": selftest.TagKey + "=" + runID}).Info(internal.Pad(r.Type))
+	}
+
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ %s\n", err))
+		cleanupSandbox(ctx, sandbox)
+
+		return 1
+	}
+
+	checks, err := destroySandbox(ctx, sandbox, f, providerFactory)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("\nError:️ %s\n", err))
+		cleanupSandbox(ctx, sandbox)
+
+		return 1
+	}
+
+	logSelftest(checks)
+
+	cleanupSandbox(ctx, sandbox)
+
+	for _, c := range checks {
+		if !c.passed {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// destroySandbox destroys the resources of the given sandbox with the adopt-and-destroy command, i.e.,
+// the full pipeline of importing, reading, and destroying them (with retries), and checks which capabilities
+// of terradozer work.
+func destroySandbox(ctx context.Context, sandbox *selftest.Sandbox, f selftestFlags,
+	providerFactory provider.Factory) ([]selftestCheck, error) {
+	dir, err := ioutil.TempDir("", "terradozer-selftest-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// the synthesized state: the resources are adopted by their IDs (see state.FromIDs)
+	ids := "type,id\n"
+	for _, r := range sandbox.Resources() {
+		ids += r.Type + "," + r.ID + "\n"
+	}
+
+	idsPath := filepath.Join(dir, "ids.csv")
+
+	err = ioutil.WriteFile(idsPath, []byte(ids), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	reportPath := filepath.Join(dir, "report.json")
+
+	args := []string{"-force", "-ids", idsPath, "-report", reportPath, "-timeout", f.timeout}
+
+	for _, pair := range [][2]string{
+		{"aws-assume-role-arn", f.awsAssumeRoleARN},
+		{"aws-endpoint-url", f.awsEndpointURL},
+		{"aws-region", sandbox.Region()},
+		{"provider-version", f.providerVersion},
+	} {
+		if pair[1] != "" {
+			args = append(args, "-"+pair[0], pair[1])
+		}
+	}
+
+	code := runDestroy(ctx, adoptCommand, args, providerFactory)
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	report, err := readRunReport(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to destroy sandbox resources (exit code %d)", code)
+	}
+
+	remaining, err := sandbox.Remaining(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return selftestChecks(sandbox, report, remaining), nil
+}
+
+// selftestChecks returns the outcome of each checked capability by the report of the run that has destroyed
+// the resources of the given sandbox and the resources that are remaining afterwards.
+func selftestChecks(sandbox *selftest.Sandbox, report *runReport, remaining []selftest.Resource) []selftestCheck {
+	attempted := map[selftest.Resource]bool{}
+
+	for _, rs := range [][]reportedResource{report.Deleted, report.Failed} {
+		for _, r := range rs {
+			attempted[selftest.Resource{Type: r.Type, ID: r.ID}] = true
+		}
+	}
+
+	var notImported []string
+
+	for _, r := range sandbox.Resources() {
+		if !attempted[r] {
+			notImported = append(notImported, r.String())
+		}
+	}
+
+	isRemaining := map[selftest.Resource]bool{}
+
+	var remainingNames []string
+
+	for _, r := range remaining {
+		isRemaining[r] = true
+		remainingNames = append(remainingNames, r.String())
+	}
+
+	check := func(capability string, failed []string) selftestCheck {
+		return selftestCheck{capability: capability, passed: len(failed) == 0, detail: strings.Join(failed, ", ")}
+	}
+
+	failedIfRemaining := func(r *selftest.Resource) []string {
+		if isRemaining[*r] {
+			return []string{r.String() + " still exists"}
+		}
+
+		return nil
+	}
+
+	return []selftestCheck{
+		check("import (resources adopted by ID)", withSuffix(notImported, " not imported")),
+		check("force_destroy (non-empty S3 bucket)", failedIfRemaining(sandbox.Bucket)),
+		check("retries (security group referenced by another one)", failedIfRemaining(sandbox.SecurityGroup)),
+		check("destroy (all resources gone)", withSuffix(remainingNames, " still exists")),
+	}
+}
+
+// withSuffix returns the given strings with the given suffix appended.
+func withSuffix(values []string, suffix string) []string {
+	var result []string
+
+	for _, v := range values {
+		result = append(result, v+suffix)
+	}
+
+	return result
+}
+
+// logSelftest logs the outcome of each check of a self-test and the number of passed and failed checks.
+func logSelftest(checks []selftestCheck) {
+	internal.LogTitle("self-test results")
+
+	numOfFailed := 0
+
+	for _, c := range checks {
+		if c.passed {
+			log.Info(internal.Pad("passed: " + c.capability))
+
+			continue
+		}
+
+		numOfFailed++
+
+		log.WithField("reason", c.detail).Error(internal.Pad("failed: " + c.capability))
+	}
+
+	internal.LogTitle(fmt.Sprintf("self-test passed: %d, failed: %d", len(checks)-numOfFailed, numOfFailed))
+}
+
+// cleanupSandbox deletes the resources of the given sandbox that are left over via the AWS API.
+func cleanupSandbox(ctx context.Context, sandbox *selftest.Sandbox) {
+	remaining, err := sandbox.Remaining(ctx)
+	if err == nil && len(remaining) == 0 {
+		return
+	}
+
+	internal.LogTitle("cleaning up left over sandbox resources")
+
+	for _, err := range sandbox.Cleanup(ctx) {
+		log.WithError(err).Error(internal.Pad("failed to clean up sandbox resource"))
+	}
+}
+
+// newRunID returns a random ID of a self-test run, which is part of the names of the sandbox resources.
+func newRunID() (string, error) {
+	b := make([]byte, 4)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ID of self-test run: %s", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
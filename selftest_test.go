@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/selftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMainExitCode_SelftestSandboxAccount(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	var actions []string
+
+	// a fake STS API, which fails all other requests (e.g., to create resources)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+
+		actions = append(actions, req.Form.Get("Action"))
+
+		if req.Form.Get("Action") != "GetCallerIdentity" {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult><Account>123456789012</Account>`+
+			`</GetCallerIdentityResult></GetCallerIdentityResponse>`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+		expectedActions  []string
+	}{
+		{
+			name:             "missing sandbox account",
+			args:             []string{selftestCommand, "-aws-endpoint-url", server.URL},
+			expectedExitCode: exitCodeUsage,
+		},
+		{
+			name:             "other account",
+			args:             []string{selftestCommand, "-aws-endpoint-url", server.URL, "-sandbox-account", "999999999999"},
+			expectedExitCode: 1,
+			expectedActions:  []string{"GetCallerIdentity"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actions = nil
+
+			assert.Equal(t, tc.expectedExitCode, mainExitCode(tc.args, nil))
+			assert.Equal(t, tc.expectedActions, actions, "nothing must be created outside the sandbox account")
+		})
+	}
+}
+
+func TestSelftestChecks(t *testing.T) {
+	bucket := selftest.Resource{Type: "aws_s3_bucket", ID: "terradozer-selftest-1234abcd"}
+	sg := selftest.Resource{Type: "aws_security_group", ID: "sg-1"}
+	referencingSG := selftest.Resource{Type: "aws_security_group", ID: "sg-2"}
+
+	sandbox := &selftest.Sandbox{Bucket: &bucket, SecurityGroup: &sg, ReferencingSecurityGroup: &referencingSG}
+
+	reported := func(resources ...selftest.Resource) []reportedResource {
+		var result []reportedResource
+
+		for _, r := range resources {
+			result = append(result, reportedResource{Type: r.Type, ID: r.ID})
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name           string
+		report         *runReport
+		remaining      []selftest.Resource
+		expectedFailed map[string]string
+	}{
+		{
+			name:           "all gone",
+			report:         &runReport{Deleted: reported(bucket, sg, referencingSG)},
+			expectedFailed: map[string]string{},
+		},
+		{
+			name:      "bucket and security group remaining",
+			report:    &runReport{Deleted: reported(referencingSG), Failed: reported(bucket, sg)},
+			remaining: []selftest.Resource{bucket, sg},
+			expectedFailed: map[string]string{
+				"force_destroy (non-empty S3 bucket)":                "aws_s3_bucket (terradozer-selftest-1234abcd) still exists",
+				"retries (security group referenced by another one)": "aws_security_group (sg-1) still exists",
+				"destroy (all resources gone)": "aws_s3_bucket (terradozer-selftest-1234abcd) still exists, " +
+					"aws_security_group (sg-1) still exists",
+			},
+		},
+		{
+			name:      "not imported",
+			report:    &runReport{Deleted: reported(bucket, sg)},
+			remaining: []selftest.Resource{referencingSG},
+			expectedFailed: map[string]string{
+				"import (resources adopted by ID)": "aws_security_group (sg-2) not imported",
+				"destroy (all resources gone)":     "aws_security_group (sg-2) still exists",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualFailed := map[string]string{}
+
+			for _, c := range selftestChecks(sandbox, tc.report, tc.remaining) {
+				if !c.passed {
+					actualFailed[c.capability] = c.detail
+				}
+			}
+
+			assert.Equal(t, tc.expectedFailed, actualFailed)
+		})
+	}
+}
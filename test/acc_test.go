@@ -25,21 +25,185 @@ const (
 Terraform destroy using only the state - no *.tf files needed.
 
 USAGE:
-  $ terradozer [flags] <path/to/terraform.tfstate>
+  $ terradozer [flags] <command> [command flags]
+
+COMMANDS:
+  plan                  Show the resources that would be destroyed (read-only)
+  destroy               Destroy the resources of a Terraform state (after confirmation)
+  adopt-and-destroy     Destroy resources listed by type and ID in a CSV or JSON file (no state needed)
+  discover-and-destroy  Destroy AWS resources found by their tags via the Resource Groups Tagging API (no state needed)
+  verify                Check that the resources deleted by a previous run (see -report) are still gone (read-only)
+  selftest              Create, destroy, and check a few cheap resources to test terradozer in a sandbox account
+  list                  List the resources of a Terraform state (without starting any provider)
+  providers             Show the providers a Terraform state needs and whether terradozer supports them
+  validate              Check which resources of a Terraform state terradozer can destroy (without touching the cloud)
+  completion            Print the script to complete commands and flags in bash, zsh, or fish
 
 FLAGS:
+  -chdir string
+    	Switch to a different working directory before resolving any paths (e.g., of the state or the config file)
+  -connect
+    	Run the command in the daemon if its socket exists (otherwise, runs the command as usual)
+  -daemon
+    	Run as daemon, which keeps the providers running across runs of clients connecting via -connect
+  -daemon-idle-timeout string
+    	Amount of time without any request after that the daemon exits (default "10m")
+  -output string
+    	Output format (text or json) (default "text")
+  -socket string
+    	Path to the unix socket of the daemon (default "~/.terradozer/daemon.sock")
+  -version
+    	Show application version
+
+Run 'terradozer <command> -h' to see the flags of a command.
+`
+	destroyUsageMessage = `
+Terraform destroy using only the state - no *.tf files needed.
+
+USAGE:
+  $ terradozer destroy [flags] -state <path/to/terraform.tfstate>
+
+FLAGS:
+  -account-parallelism int
+    	Number of accounts of the manifest to run the command for in parallel (requires -force unless a dry run) (default 1)
+  -allow-only-types string
+    	Path to a file listing the only resource types that may be destroyed (one per line); resources of other types are skipped, regardless of other flags
+  -assert-empty
+    	Read all resources of the state again after destroying them and exit with code 9 if any still exists (listed in the -report)
+  -auto-upgrade-provider
+    	Retry resources whose schema version in the state is newer than the provider's with the latest version of the provider (never downgrades)
+  -aws-assume-role-arn string
+    	ARN of a role to assume (e.g., of another account) with the resolved credentials to destroy resources
+  -aws-endpoint-url string
+    	Custom endpoint URL for all AWS services (e.g., http://localhost:4566 for LocalStack) or comma-separated list of service=URL pairs
+  -aws-mfa-token string
+    	MFA token code to assume a role that requires MFA (prompted for if not set)
+  -aws-region string
+    	AWS region to destroy resources in (defaults to AWS_REGION, AWS_DEFAULT_REGION, or the region of the profile)
+  -batch-deletes
+    	Delete Route53 record sets, CloudWatch log groups, and S3 objects in batches directly via the AWS API
+  -beanstalk-timeout string
+    	Amount of time to wait for an Elastic Beanstalk environment to terminate (default "30m0s")
+  -block-on-consumers
+    	Don't delete anything if resources that would be deleted are referenced by other states (see -check-consumers)
+  -cap-behavior string
+    	What to do if a cap of -max-per-type is exceeded: abort (exit with code 10) or trim (delete only up to the cap, the oldest first, and defer the rest) (default "abort")
+  -check-consumers string
+    	Comma-separated list of paths to other Terraform states whose resources and data sources are checked for references to the IDs or ARNs of resources that would be deleted
+  -checkpoint-every int
+    	Pause after every N deleted resources to show a summary, write the -report, and ask whether to continue (exits with code 11 if not; disabled if stdin isn't a terminal, unless -checkpoint-timeout is set)
+  -checkpoint-timeout string
+    	Amount of time to wait for an answer at a checkpoint before continuing automatically (e.g., 5m for unattended runs; waits until answered if not set)
+  -config string
+    	Path to the config file setting defaults of flags (defaults to .terradozer.yaml if it exists)
   -debug
     	Enable debug logging
-  -dry-run
-    	Show what would be destroyed
+  -default-delete-timeout string
+    	Delete timeout of resources without a customized one in the state (e.g., 60m; defaults to the provider's)
+  -delete-log-groups
+    	Delete the CloudWatch log groups that Lambda functions, ECS task definitions, and VPC flow logs have created implicitly (e.g., /aws/lambda/<function name>) after deleting the resources
+  -diff string
+    	Path to a newer state of the same infrastructure; only resources of the state absent from it (matched by type and ID, so that moved resources are kept) are destroyed
+  -drift-report string
+    	Path to a file to write a report to (JSON) of how the attributes in the state differ from the current ones
+  -exclude value
+    	Don't destroy resources whose type or address matches one of the given patterns (same syntax as -include; takes precedence over it)
+  -exclude-addresses string
+    	Comma-separated list of resource addresses that are not destroyed (e.g., module.vpc.aws_vpc.shared)
+  -exclude-global
+    	Don't destroy resources of global services (e.g., IAM, Route53, CloudFront, WAF classic, and ACM certificates in us-east-1), which aren't bound to the region
+  -explain-blockers
+    	Look up resources outside the state (e.g., network interfaces in a subnet) that block the deletion of resources failing due to dependency violations
+  -fail-if-all-gone
+    	Exit with code 6 if all resources of the state don't exist anymore (i.e., the state is entirely stale)
   -force
-    	Destroy without asking for confirmation
+    	Destroy without asking for confirmation (required if stdin isn't a terminal, e.g., in CI)
+  -force-compat
+    	Read states written by a newer version of Terraform than supported (see -version), which might be misread
+  -grace-period string
+    	Amount of time to wait for destroys in flight to finish once interrupted (a second interrupt terminates immediately) (default "30s")
+  -graph string
+    	Path to a file to write the graph of the resources in the order they would be deleted to
+  -graph-format string
+    	Format of the graph written to the -graph file (dot or mermaid) (default "dot")
+  -graph-module string
+    	Only write the resources of the given module (and its child modules) to the -graph file (e.g., module.vpc)
+  -hash-values-over int
+    	Replace attribute values larger than the given number of bytes by their SHA-256 checksum in logs, the preview, and reports instead of truncating them (e.g., to diff reports; 0 disables it)
+  -ignore-region-mismatch
+    	Destroy without asking for confirmation if most resources are in other regions than the provider's region
+  -include value
+    	Only destroy resources whose type or address matches one of the given patterns, e.g., aws_instance or module.staging (repeatable or comma-separated; * and ? match any characters; covers sub-modules)
+  -include-default-resources
+    	Destroy resources adopting default infrastructure of the AWS account (aws_default_*), which are skipped otherwise
+  -inventory-compare
+    	List resources outside the state that share the tags of its resources (via the tagging API, limited to the VPCs, clusters, and name prefixes the state references) to clean them up manually; never deletes them
+  -keep-logs
+    	Keep the log groups created implicitly by deleted resources (overrides -delete-log-groups and -set-log-retention, e.g., if set via TERRADOZER_DELETE_LOG_GROUPS)
+  -keep-workdir
+    	Keep the workspace of the run in the system's temp directory (e.g., partial downloads) for debugging
+  -kms-deletion-window int
+    	Number of days (between 7 and 30) after that KMS keys scheduled for deletion are deleted (default 7)
+  -lock-file string
+    	Path to a dependency lock file (.terraform.lock.hcl) whose provider versions are used and whose hashes the providers must match (defaults to the one in the working directory, if any)
+  -log-sensitive
+    	Show sensitive values (marked values and values of sensitive attributes) in logs and reports instead of redacting them
+  -manifest string
+    	Path to a YAML file listing accounts (name, assume_role_arn, region, state) to run the command for with their own state each, instead of for a single state
+  -max-per-type string
+    	Comma-separated list of type=N pairs capping the number of resources of a type to delete (e.g., aws_s3_bucket=5,aws_db_instance=2); exceeding a cap aborts the run before anything is deleted
+  -max-retries int
+    	Maximum number of times a resource that failed to be deleted is retried, e.g., due to a dependency violation (0 retries as long as other resources are deleted in between) (default 5)
+  -max-value-size int
+    	Number of bytes after which attribute values are truncated in logs, the preview, and reports (0 disables it) (default 4096)
+  -no-cache
+    	Don't use or update the cache of how resources of each type have been imported during previous runs
+  -no-force address
+    	Don't set force_destroy or force_detach_policies of resources with the given address, so that deleting a non-empty bucket fails (repeatable; comma-separated, * and ? match any characters, e.g., aws_s3_bucket.audit_logs)
+  -no-refresh
+    	Destroy resources with the attributes recorded in the state, without reading or importing them first
+  -order-by string
+    	Destroy the resources in the given order as far as dependencies allow: cost (the most expensive first, by estimated monthly costs)
+  -order-by-module
+    	Destroy the resources of one top-level module instance completely before starting the next
+  -output string
+    	Output format (text or json) (default "text")
+  -override type:name=value,...
+    	Set attributes of resources of a type in the state before destroying them, given as type:name=value,... (repeatable, e.g., aws_lb:enable_deletion_protection=false); attributes enforced by the API, like deletion protection, are updated in the cloud first
+  -owner-tag string
+    	Name of the tag (or attribute) whose value is the owner of a resource (e.g., owner), which is logged with each resource and summarized at the end (resources without it are unowned)
   -parallel int
     	Limit the number of concurrent destroy operations (default 10)
+  -protected-types string
+    	Comma-separated list of resource types that are never destroyed (e.g., aws_s3_bucket)
+  -provider-version string
+    	Comma-separated list of name=version pairs of providers to use instead of the default versions (e.g., aws=v3.74.0)
+  -rds-take-final-snapshot
+    	Take a final snapshot of RDS instances and clusters (and of DocumentDB, Neptune, and Redshift clusters) before deleting them
+  -report string
+    	Path to a file to write a report to (JSON) listing the deleted and failed resources (e.g., to check later with the verify command that they are still gone)
+  -route53-empty-zones
+    	Delete all record sets of a hosted zone (except NS and SOA), also if not in the state, before deleting the zone
+  -secrets-force-delete
+    	Delete Secrets Manager secrets (and their replicas) immediately without recovery window
+  -set-log-retention int
+    	Set the retention of the log groups that would be deleted by -delete-log-groups to the given number of days instead of deleting them (e.g., 7)
+  -show-config
+    	Show the effective configuration and exit
+  -show-order
+    	Show the order in which the resources would be deleted (with their estimated monthly costs)
+  -simulate
+    	Only show the resources that would be destroyed and call the delete APIs supporting it with a dry run to check the permissions (e.g., of EC2 resources)
+  -state string
+    	Path or URL (s3://bucket/key[?versionId=version] or http(s)://) of the Terraform state file
   -timeout string
     	Amount of time to wait for a destroy of a resource to finish (default "30s")
-  -version
-    	Show application version
+  -trace-file string
+    	Path to a file to write a trace of the run to (Chrome trace event format, e.g., for https://ui.perfetto.dev)
+  -wait-for-object-lock-expiry
+    	Delete the object versions of S3 buckets whose object lock retention is in governance mode with the bypass header (requires s3:BypassGovernanceRetention) instead of waiting for it to expire
+  -window string
+    	Daily time window in which resources are deleted, e.g., "02:00-05:00 Europe/Prague" (everything else is done right away; exits with code 8 when the window closes before all resources are deleted)
 `
 )
 
@@ -50,34 +214,35 @@ func TestAcc_ConfirmDeletion(t *testing.T) {
 
 	tests := []struct {
 		name                    string
+		args                    []string
 		userInput               string
+		expectErr               bool
 		expectResourceIsDeleted bool
 		expectedLogs            []string
 		unexpectedLogs          []string
 	}{
 		{
-			name:                    "confirmed with YES",
-			userInput:               "YES\n",
-			expectResourceIsDeleted: true,
+			name:      "piped YES isn't accepted",
+			userInput: "YES\n",
+			expectErr: true,
 			expectedLogs: []string{
 				"SHOWING RESOURCES THAT WOULD BE DELETED (DRY RUN)",
 				"TOTAL NUMBER OF RESOURCES THAT WOULD BE DELETED: 1",
-				"Are you sure you want to delete these resources (cannot be undone)? Only YES will be accepted.",
+				"stdin isn't a terminal (use -force to destroy without confirmation)",
+			},
+			unexpectedLogs: []string{
 				"STARTING TO DELETE RESOURCES",
-				"TOTAL NUMBER OF DELETED RESOURCES: 1",
+				"TOTAL NUMBER OF DELETED RESOURCES:",
 			},
 		},
 		{
-			name:      "confirmed with yes",
-			userInput: "yes\n",
+			name:                    "forced",
+			args:                    []string{"-force"},
+			expectResourceIsDeleted: true,
 			expectedLogs: []string{
-				"SHOWING RESOURCES THAT WOULD BE DELETED (DRY RUN)",
-				"TOTAL NUMBER OF RESOURCES THAT WOULD BE DELETED: 1",
-				"Are you sure you want to delete these resources (cannot be undone)? Only YES will be accepted.",
-			},
-			unexpectedLogs: []string{
+				"USER WILL NOT BE ASKED FOR CONFIRMATION (FORCE MODE)",
 				"STARTING TO DELETE RESOURCES",
-				"TOTAL NUMBER OF DELETED RESOURCES:",
+				"TOTAL NUMBER OF DELETED RESOURCES: 1",
 			},
 		},
 	}
@@ -107,8 +272,13 @@ func TestAcc_ConfirmDeletion(t *testing.T) {
 
 			defer os.Remove(tfstateFile)
 
-			logBuffer, err := runBinary(t, tc.userInput, tfstateFile)
-			require.NoError(t, err)
+			logBuffer, err := runBinary(t, tc.userInput, append(append([]string{"destroy"}, tc.args...),
+				tfstateFile)...)
+			if tc.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
 
 			if tc.expectResourceIsDeleted {
 				AssertVpcDeleted(t, actualVpcID, env)
@@ -158,13 +328,13 @@ func TestAcc_AllResourcesAlreadyDeleted(t *testing.T) {
 	tfstateFile, err := WriteRemoteStateToLocalFile(t, env, terraformOptions)
 	defer os.Remove(tfstateFile)
 
-	_, err = runBinary(t, "YES\n", tfstateFile)
+	_, err = runBinary(t, "", "destroy", "-force", tfstateFile)
 	require.NoError(t, err)
 
 	AssertVpcDeleted(t, actualVpcID, env)
 
 	// run a second time
-	logBuffer, err := runBinary(t, "", tfstateFile)
+	logBuffer, err := runBinary(t, "", "destroy", tfstateFile)
 	require.NoError(t, err)
 
 	actualLogs := logBuffer.String()
@@ -187,8 +357,8 @@ func TestAcc_Version(t *testing.T) {
 
 	assert.Contains(t, actualLogs, fmt.Sprintf(`
 version: dev
-commit: ?
-built at: ?
+commit: dev
+built at: dev
 using: %s`, runtime.Version()))
 
 	fmt.Println(actualLogs)
@@ -199,13 +369,48 @@ func TestAcc_MissingStatePathArgument(t *testing.T) {
 		t.Skip("Skipping acceptance testUtil.")
 	}
 
+	logBuffer, err := runBinary(t, "", "destroy")
+	require.Error(t, err)
+
+	actualLogs := logBuffer.String()
+
+	assert.Contains(t, actualLogs, `Error: path to Terraform state file expected
+
+USAGE:
+  $ terradozer destroy [flags] -state <path/to/terraform.tfstate>
+
+Run 'terradozer destroy -h' to see the help.
+`)
+
+	fmt.Println(actualLogs)
+}
+
+func TestAcc_CommandHelp(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping acceptance testUtil.")
+	}
+
+	logBuffer, err := runBinary(t, "", "destroy", "-h")
+	require.NoError(t, err)
+
+	actualLogs := logBuffer.String()
+
+	assert.Contains(t, actualLogs, destroyUsageMessage)
+
+	fmt.Println(actualLogs)
+}
+
+func TestAcc_MissingCommand(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping acceptance testUtil.")
+	}
+
 	logBuffer, err := runBinary(t, "")
 	require.Error(t, err)
 
 	actualLogs := logBuffer.String()
 
-	assert.Contains(t, actualLogs, fmt.Sprintf(`Error: path to Terraform state file expected
-%s`, usageMessage))
+	assert.Contains(t, actualLogs, usageMessage)
 
 	fmt.Println(actualLogs)
 }
@@ -220,8 +425,11 @@ func TestAcc_UndefinedFlag(t *testing.T) {
 
 	actualLogs := logBuffer.String()
 
-	assert.Contains(t, actualLogs, fmt.Sprintf(`flag provided but not defined: -foo
-%s`, usageMessage))
+	assert.Contains(t, actualLogs, `Error: flag provided but not defined: -foo
+
+USAGE:
+  $ terradozer [flags] <command> [command flags]
+`)
 
 	fmt.Println(actualLogs)
 }
@@ -233,14 +441,15 @@ func TestAcc_DryRun(t *testing.T) {
 
 	tests := []struct {
 		name                    string
-		flag                    string
+		command                 string
+		args                    []string
 		expectedLogs            []string
 		unexpectedLogs          []string
 		expectResourceIsDeleted bool
 	}{
 		{
-			name: "with dry-run flag",
-			flag: "-dry-run",
+			name:    "plan command",
+			command: "plan",
 			expectedLogs: []string{
 				"SHOWING RESOURCES THAT WOULD BE DELETED (DRY RUN)",
 				"TOTAL NUMBER OF RESOURCES THAT WOULD BE DELETED: 1",
@@ -251,10 +460,10 @@ func TestAcc_DryRun(t *testing.T) {
 			},
 		},
 		{
-			name: "without dry-run flag",
+			name:    "destroy command",
+			command: "destroy",
+			args:    []string{"-force"},
 			expectedLogs: []string{
-				"SHOWING RESOURCES THAT WOULD BE DELETED (DRY RUN)",
-				"TOTAL NUMBER OF RESOURCES THAT WOULD BE DELETED: 1",
 				"STARTING TO DELETE RESOURCES",
 				"TOTAL NUMBER OF DELETED RESOURCES: 1",
 			},
@@ -285,12 +494,7 @@ func TestAcc_DryRun(t *testing.T) {
 			tfstateFile, err := WriteRemoteStateToLocalFile(t, env, terraformOptions)
 			defer os.Remove(tfstateFile)
 
-			args := []string{tfstateFile}
-			if tc.flag != "" {
-				args = []string{tc.flag, tfstateFile}
-			}
-
-			logBuffer, err := runBinary(t, "YES\n", args...)
+			logBuffer, err := runBinary(t, "", append(append([]string{tc.command}, tc.args...), tfstateFile)...)
 
 			require.NoError(t, err)
 
@@ -330,7 +534,7 @@ func TestAcc_Force(t *testing.T) {
 	}{
 		{
 			name:  "with force flag",
-			flags: []string{"-force"},
+			flags: []string{"destroy", "-force"},
 			expectedLogs: []string{
 				"STARTING TO DELETE RESOURCES",
 				"TOTAL NUMBER OF DELETED RESOURCES: 1",
@@ -342,7 +546,8 @@ func TestAcc_Force(t *testing.T) {
 			expectResourceIsDeleted: true,
 		},
 		{
-			name: "without force flag",
+			name:  "without force flag",
+			flags: []string{"destroy"},
 			expectedLogs: []string{
 				"SHOWING RESOURCES THAT WOULD BE DELETED (DRY RUN)",
 				"TOTAL NUMBER OF RESOURCES THAT WOULD BE DELETED: 1",
@@ -353,16 +558,16 @@ func TestAcc_Force(t *testing.T) {
 			},
 		},
 		{
-			name:  "with force and dry-run flag",
-			flags: []string{"-force", "-dry-run"},
+			name:  "plan command with force flag",
+			flags: []string{"plan", "-force"},
 			expectedLogs: []string{
-				"-force and -dry-run flag cannot be used together",
+				"flag provided but not defined: -force (-force is a flag of the destroy command)",
 			},
 			unexpectedLogs: []string{
 				"STARTING TO DELETE RESOURCES",
 				"TOTAL NUMBER OF DELETED RESOURCES:",
 			},
-			expectedErrCode: 1,
+			expectedErrCode: 64,
 		},
 	}
 	for _, tc := range tests {
@@ -393,7 +598,7 @@ func TestAcc_Force(t *testing.T) {
 			logBuffer, err := runBinary(t, "yes\n", args...)
 
 			if tc.expectedErrCode > 0 {
-				require.EqualError(t, err, "exit status 1")
+				require.EqualError(t, err, fmt.Sprintf("exit status %d", tc.expectedErrCode))
 			} else {
 				require.NoError(t, err)
 			}
@@ -452,7 +657,7 @@ func TestAcc_DeleteDependentResources(t *testing.T) {
 	tfstateFile, err := WriteRemoteStateToLocalFile(t, env, terraformOptions)
 	defer os.Remove(tfstateFile)
 
-	_, err = runBinary(t, "YES\n", tfstateFile)
+	_, err = runBinary(t, "", "destroy", "-force", tfstateFile)
 	require.NoError(t, err)
 
 	AssertVpcDeleted(t, actualVpcID, env)
@@ -487,7 +692,7 @@ func TestAcc_SkipUnsupportedProvider(t *testing.T) {
 	tfstateFile, err := WriteRemoteStateToLocalFile(t, env, terraformOptions)
 	defer os.Remove(tfstateFile)
 
-	_, err = runBinary(t, "YES\n", tfstateFile)
+	_, err = runBinary(t, "", "destroy", "-force", tfstateFile)
 	require.NoError(t, err)
 
 	AssertVpcDeleted(t, actualVpcID, env)
@@ -536,8 +741,8 @@ func TestAcc_DeleteTimeout(t *testing.T) {
 	tfstateFile, err := WriteRemoteStateToLocalFile(t, env, terraformOptions)
 	defer os.Remove(tfstateFile)
 
-	logBuffer, err := runBinary(t, "YES\n", "-timeout", "2s", tfstateFile)
-	require.NoError(t, err)
+	logBuffer, err := runBinary(t, "", "destroy", "-force", "-timeout", "2s", tfstateFile)
+	require.EqualError(t, err, "exit status 2")
 
 	actualLogs := logBuffer.String()
 
@@ -574,7 +779,7 @@ func TestAcc_DeleteNonEmptyAwsS3Bucket(t *testing.T) {
 	tfstateFile, err := WriteRemoteStateToLocalFile(t, env, terraformOptions)
 	defer os.Remove(tfstateFile)
 
-	_, err = runBinary(t, "YES\n", tfstateFile)
+	_, err = runBinary(t, "", "destroy", "-force", tfstateFile)
 	require.NoError(t, err)
 
 	time.Sleep(5 * time.Second)
@@ -609,7 +814,7 @@ func TestAcc_DeleteAwsIamRoleWithAttachedPolicy(t *testing.T) {
 	tfstateFile, err := WriteRemoteStateToLocalFile(t, env, terraformOptions)
 	defer os.Remove(tfstateFile)
 
-	_, err = runBinary(t, "YES\n", tfstateFile)
+	_, err = runBinary(t, "", "destroy", "-force", tfstateFile)
 	require.NoError(t, err)
 
 	AssertIamRoleDeleted(t, actualIamRole, env)
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	awsSDK "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	testUtil "github.com/jckuester/awstools-lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAcc_LocalStack destroys resources created in LocalStack. The test is skipped
+// unless the LOCALSTACK_ENDPOINT_URL environment variable is set (e.g., to http://localhost:4566).
+func TestAcc_LocalStack(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping acceptance testUtil.")
+	}
+
+	endpointURL := os.Getenv("LOCALSTACK_ENDPOINT_URL")
+	if endpointURL == "" {
+		t.Skip("Skipping LocalStack test: LOCALSTACK_ENDPOINT_URL is not set.")
+	}
+
+	err := testUtil.SetMultiEnvs(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "test",
+		"AWS_SECRET_ACCESS_KEY": "test",
+		"AWS_REGION":            "us-east-1",
+	})
+	require.NoError(t, err)
+
+	terraformDir := "./test-fixtures/localstack"
+
+	terraformOptions := &terraform.Options{
+		TerraformDir: terraformDir,
+		NoColor:      true,
+		Vars: map[string]interface{}{
+			"endpoint_url": endpointURL,
+			"name":         "terradozer-" + random.UniqueId(),
+		},
+	}
+
+	defer terraform.Destroy(t, terraformOptions)
+
+	terraform.InitAndApply(t, terraformOptions)
+
+	actualVpcID := terraform.Output(t, terraformOptions, "vpc_id")
+	actualQueueURL := terraform.Output(t, terraformOptions, "queue_url")
+
+	sess := newLocalStackSession(t, endpointURL)
+
+	assert.True(t, localStackVpcExists(t, sess, actualVpcID))
+	assert.True(t, localStackQueueExists(sess, actualQueueURL))
+
+	logBuffer, err := runBinary(t, "", "destroy", "-force", "-aws-endpoint-url", endpointURL,
+		terraformDir+"/terraform.tfstate")
+	require.NoError(t, err)
+
+	assert.False(t, localStackVpcExists(t, sess, actualVpcID), "resource hasn't been deleted")
+	assert.False(t, localStackQueueExists(sess, actualQueueURL), "resource hasn't been deleted")
+
+	actualLogs := logBuffer.String()
+
+	assert.Contains(t, actualLogs, "TOTAL NUMBER OF DELETED RESOURCES: 2")
+
+	fmt.Println(actualLogs)
+}
+
+func newLocalStackSession(t *testing.T, endpointURL string) *session.Session {
+	sess, err := session.NewSession(&awsSDK.Config{
+		Region:      awsSDK.String("us-east-1"),
+		Endpoint:    awsSDK.String(endpointURL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+	})
+	require.NoError(t, err)
+
+	return sess
+}
+
+func localStackVpcExists(t *testing.T, sess *session.Session, id string) bool {
+	resp, err := ec2.New(sess).DescribeVpcs(&ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   awsSDK.String("vpc-id"),
+				Values: []*string{&id},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	return len(resp.Vpcs) > 0
+}
+
+func localStackQueueExists(sess *session.Session, url string) bool {
+	_, err := sqs.New(sess).GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl: &url,
+	})
+
+	return err == nil
+}
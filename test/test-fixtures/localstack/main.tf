@@ -0,0 +1,34 @@
+provider "aws" {
+  version = "~> 3.0"
+
+  region                      = "us-east-1"
+  access_key                  = "test"
+  secret_key                  = "test"
+  s3_force_path_style         = true
+  skip_credentials_validation = true
+  skip_metadata_api_check     = true
+  skip_requesting_account_id  = true
+
+  endpoints {
+    ec2 = var.endpoint_url
+    sqs = var.endpoint_url
+    sts = var.endpoint_url
+  }
+}
+
+resource "aws_vpc" "test" {
+  cidr_block = "10.0.0.0/16"
+
+  tags = {
+    Name       = var.name
+    terradozer = "test-acc"
+  }
+}
+
+resource "aws_sqs_queue" "test" {
+  name = var.name
+
+  tags = {
+    terradozer = "test-acc"
+  }
+}
@@ -0,0 +1,7 @@
+output "vpc_id" {
+  value = aws_vpc.test.id
+}
+
+output "queue_url" {
+  value = aws_sqs_queue.test.id
+}
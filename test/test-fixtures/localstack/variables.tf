@@ -0,0 +1,7 @@
+variable "endpoint_url" {
+  description = "The endpoint URL of LocalStack"
+}
+
+variable "name" {
+  description = "The name of test"
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/discover"
+	"github.com/jckuester/terradozer/pkg/state"
+)
+
+//nolint:gochecknoglobals
+var (
+	// scopeAttributes are the attributes whose values (e.g., the ID of a VPC) limit the scope of the stack of a state
+	// (see stack.inScope).
+	scopeAttributes = []string{"vpc_id", "cluster_name", "cluster"}
+
+	// scopeTypes are the resource types whose attribute (e.g., the ID of a VPC) limits the scope of the stack
+	// of a state.
+	scopeTypes = map[string]string{
+		"aws_vpc":         "id",
+		"aws_eks_cluster": "name",
+		"aws_ecs_cluster": "name",
+	}
+)
+
+// inventoryComparison is the result of comparing the resources of a state with the inventory of tagged resources
+// (see -inventory-compare), which is part of the report of the run.
+type inventoryComparison struct {
+	// Tags are the tags that all tagged resources of the state share, by which the inventory is listed.
+	Tags map[string]string `json:"tags"`
+	// Scope are the IDs of VPCs, names of clusters, and name prefixes referenced by the state, one of which
+	// the resources of the inventory must reference (unless empty).
+	Scope []string `json:"scope,omitempty"`
+	// Unstated are the resources of the inventory within the scope that aren't part of the state, ordered by ARN.
+	Unstated []discover.TaggedResource `json:"unstated"`
+	// Error is why the state couldn't be compared with the inventory (e.g., permission to list tagged resources
+	// denied).
+	Error string `json:"error,omitempty"`
+}
+
+// stack describes the resources of a state by their recorded attributes, to find the resources of the inventory
+// that belong to the same stack.
+type stack struct {
+	// tags are the tags all tagged resources of the state share (except Name).
+	tags map[string]string
+	// anchors are the IDs of VPCs and names of clusters referenced by the state.
+	anchors []string
+	// prefixes are the name prefixes (i.e., name_prefix attributes) of the resources of the state.
+	prefixes []string
+	// known are the IDs and ARNs of the resources of the state.
+	known map[string]bool
+}
+
+// newStack returns the stack of the given state.
+func newStack(tfstate *state.State) (stack, error) {
+	instances, err := tfstate.ResourceInstances()
+	if err != nil {
+		return stack{}, err
+	}
+
+	// data sources are part of the consumers, but not of the stack
+	types := map[string]string{}
+
+	for _, instance := range instances {
+		types[instance.Address] = instance.Type
+	}
+
+	result := stack{known: map[string]bool{}}
+	seen := map[string]bool{}
+	add := func(values *[]string, v string) {
+		if strings.HasPrefix(v, "arn:") {
+			v = v[strings.LastIndex(v, "/")+1:]
+		}
+
+		if v != "" && !seen[v] {
+			seen[v] = true
+			*values = append(*values, v)
+		}
+	}
+
+	for _, c := range tfstate.Consumers() {
+		terraformType, ok := types[c.Address]
+		if !ok {
+			continue
+		}
+
+		for _, name := range []string{"id", "arn"} {
+			if v := c.Values[name]; v != "" {
+				result.known[v] = true
+			}
+		}
+
+		for _, name := range scopeAttributes {
+			add(&result.anchors, c.Values[name])
+		}
+
+		if name, ok := scopeTypes[terraformType]; ok {
+			add(&result.anchors, c.Values[name])
+		}
+
+		add(&result.prefixes, c.Values["name_prefix"])
+
+		tags := recordedTags(c.Values)
+		if len(tags) == 0 {
+			continue
+		}
+
+		if result.tags == nil {
+			result.tags = tags
+			continue
+		}
+
+		for k, v := range result.tags {
+			if tags[k] != v {
+				delete(result.tags, k)
+			}
+		}
+	}
+
+	sort.Strings(result.anchors)
+	sort.Strings(result.prefixes)
+
+	return result, nil
+}
+
+// recordedTags returns the tags (and default tags) among the given attribute values recorded in a state
+// (e.g., tags["team"]), except the Name tag, which differs between resources, and tags of AWS.
+func recordedTags(values map[string]string) map[string]string {
+	result := map[string]string{}
+
+	for path, v := range values {
+		for _, attr := range []string{"tags[", "tags_all["} {
+			if !strings.HasPrefix(path, attr) || !strings.HasSuffix(path, "]") {
+				continue
+			}
+
+			key, err := strconv.Unquote(path[len(attr) : len(path)-1])
+			if err != nil || key == "Name" || strings.HasPrefix(key, "aws:") {
+				continue
+			}
+
+			result[key] = v
+		}
+	}
+
+	return result
+}
+
+// inScope returns true if the given resource of the inventory references one of the VPCs or clusters of the stack
+// (by its ARN or tags, e.g., kubernetes.io/cluster/<name>) or has one of its name prefixes, or if the stack has
+// no scope.
+func (s stack) inScope(r discover.TaggedResource) bool {
+	if len(s.anchors) == 0 && len(s.prefixes) == 0 {
+		return true
+	}
+
+	for _, anchor := range s.anchors {
+		if strings.Contains(r.ARN, anchor) {
+			return true
+		}
+
+		for k, v := range r.Tags {
+			if strings.Contains(k, anchor) || strings.Contains(v, anchor) {
+				return true
+			}
+		}
+	}
+
+	for _, prefix := range s.prefixes {
+		if strings.Contains(r.ARN, "/"+prefix) || strings.Contains(r.ARN, ":"+prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contains returns true if the given resource of the inventory is part of the state (by its ARN or ID).
+func (s stack) contains(r discover.TaggedResource) bool {
+	return s.known[r.ARN] || (r.ID != "" && s.known[r.ID])
+}
+
+// compareInventory lists the resources (via the tagging API) that share the tags of the resources of the given state
+// and are within the scope of its stack (see stack.inScope), and logs the ones that aren't part of the state,
+// which are never deleted. Failures (e.g., missing permissions to list tagged resources) are only logged
+// and returned as part of the comparison.
+func compareInventory(ctx context.Context, tfstate *state.State, sess *session.Session) *inventoryComparison {
+	internal.LogTitle("comparing state with inventory of tagged resources")
+
+	s, err := newStack(tfstate)
+	if err != nil {
+		return failedInventoryComparison(&inventoryComparison{},
+			fmt.Errorf("failed to get resources from Terraform state: %s", err))
+	}
+
+	result := &inventoryComparison{Tags: s.tags, Scope: append(append([]string{}, s.anchors...), s.prefixes...)}
+
+	if len(s.tags) == 0 {
+		return failedInventoryComparison(result, fmt.Errorf("resources of the state share no tags"))
+	}
+
+	if sess == nil {
+		return failedInventoryComparison(result, fmt.Errorf("AWS session to list tagged resources is not configured"))
+	}
+
+	filters := map[string][]string{}
+
+	for k, v := range s.tags {
+		filters[k] = []string{v}
+	}
+
+	tagged, err := discover.Tagged(ctx, sess, filters)
+	if err != nil {
+		if destroy.Classify(err) == destroy.ErrorClassPermissionDenied {
+			err = fmt.Errorf("permission to list tagged resources denied (requires tag:GetResources): %s", err)
+		}
+
+		return failedInventoryComparison(result, err)
+	}
+
+	result.Unstated = []discover.TaggedResource{}
+
+	for _, r := range tagged {
+		if !s.contains(r) && s.inScope(r) {
+			result.Unstated = append(result.Unstated, r)
+		}
+	}
+
+	logInventoryComparison(result)
+
+	return result
+}
+
+// failedInventoryComparison logs why the state couldn't be compared with the inventory and adds it
+// to the given comparison.
+func failedInventoryComparison(comparison *inventoryComparison, err error) *inventoryComparison {
+	log.WithError(err).Warn(internal.Pad("skipped comparing state with inventory"))
+
+	comparison.Error = err.Error()
+
+	return comparison
+}
+
+// logInventoryComparison logs the resources of the inventory that aren't part of the state.
+func logInventoryComparison(comparison *inventoryComparison) {
+	log.WithFields(log.Fields{
+		"tags":  formatTags(comparison.Tags),
+		"scope": strings.Join(comparison.Scope, ","),
+	}).Info(internal.Pad("listed resources sharing the tags of the state"))
+
+	if len(comparison.Unstated) == 0 {
+		internal.LogTitle("no resources outside the state share its tags")
+
+		return
+	}
+
+	internal.LogTitle(fmt.Sprintf("resources outside the state sharing its tags (not deleted; clean up manually): %d",
+		len(comparison.Unstated)))
+
+	for _, r := range comparison.Unstated {
+		guessedType := r.Type
+		if guessedType == "" {
+			guessedType = fmt.Sprintf("unknown type (%s)", r.ResourceType)
+		}
+
+		log.WithFields(log.Fields{"arn": r.ARN, "tags": formatTags(r.Tags)}).Warn(internal.Pad(guessedType))
+	}
+}
+
+// formatTags returns the given tags as comma-separated list of key=value pairs, sorted by key.
+func formatTags(tags map[string]string) string {
+	var pairs []string
+
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jckuester/terradozer/pkg/discover"
+	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inventoryTags are the tags the resources of the tagged state share.
+var inventoryTags = map[string]string{"stack": "preview", "team": "platform"} //nolint:gochecknoglobals
+
+func TestCompareInventory(t *testing.T) {
+	tests := []struct {
+		name             string
+		denied           bool
+		expectedUnstated []discover.TaggedResource
+		expectedErrMsg   string
+	}{
+		{
+			name: "unstated resources",
+			expectedUnstated: []discover.TaggedResource{
+				{
+					ARN:  "arn:aws:ec2:us-west-2:123456789012:key-pair/key-1",
+					Tags: map[string]string{"stack": "preview", "team": "platform", "network": "vpc-1"},
+					// key pairs can't be mapped to a Terraform type
+					ResourceType: "ec2:key-pair",
+				},
+				{
+					ARN:  "arn:aws:ec2:us-west-2:123456789012:security-group/sg-hotfix",
+					Tags: map[string]string{"stack": "preview", "team": "platform", "VpcId": "vpc-1"},
+					Type: "aws_security_group",
+					ID:   "sg-hotfix",
+				},
+			},
+		},
+		{
+			name:           "permission denied",
+			denied:         true,
+			expectedErrMsg: "permission to list tagged resources denied",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var tagFilters []map[string]interface{}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				var input struct {
+					TagFilters []map[string]interface{}
+				}
+
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&input))
+
+				tagFilters = input.TagFilters
+
+				if tc.denied {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"__type":"AccessDeniedException","message":"not authorized"}`))
+
+					return
+				}
+
+				_, _ = w.Write([]byte(inventoryResponse))
+			}))
+			t.Cleanup(server.Close)
+
+			sess, err := session.NewSession(&aws.Config{
+				Credentials: credentials.NewStaticCredentials("test", "test", ""),
+				Endpoint:    aws.String(server.URL),
+				Region:      aws.String("us-west-2"),
+				MaxRetries:  aws.Int(0),
+			})
+			require.NoError(t, err)
+
+			tfstate, err := state.New("test/test-fixtures/tfstates/tagged.tfstate")
+			require.NoError(t, err)
+
+			actual := compareInventory(context.Background(), tfstate, sess)
+
+			assert.Equal(t, inventoryTags, actual.Tags, "tags must be shared by all tagged resources (except Name)")
+			assert.Equal(t, []string{"vpc-1"}, actual.Scope)
+			assert.Len(t, tagFilters, 2)
+
+			if tc.expectedErrMsg != "" {
+				assert.Contains(t, actual.Error, tc.expectedErrMsg)
+				assert.Empty(t, actual.Unstated)
+
+				return
+			}
+
+			assert.Empty(t, actual.Error)
+			assert.Equal(t, tc.expectedUnstated, actual.Unstated)
+		})
+	}
+}
+
+func TestCompareInventory_NoSharedTags(t *testing.T) {
+	tfstate, err := state.New("test/test-fixtures/tfstates/fake-providers.tfstate")
+	require.NoError(t, err)
+
+	actual := compareInventory(context.Background(), tfstate, nil)
+
+	assert.Equal(t, "resources of the state share no tags", actual.Error)
+}
+
+// inventoryResponse is a response of the fake tagging API listing the resources with the inventoryTags.
+const inventoryResponse = `{"ResourceTagMappingList": [
+	{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:vpc/vpc-1",
+		"Tags": [{"Key": "stack", "Value": "preview"}, {"Key": "team", "Value": "platform"}]},
+	{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:subnet/subnet-1",
+		"Tags": [{"Key": "stack", "Value": "preview"}, {"Key": "team", "Value": "platform"}]},
+	{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:security-group/sg-hotfix",
+		"Tags": [{"Key": "stack", "Value": "preview"}, {"Key": "team", "Value": "platform"},
+			{"Key": "VpcId", "Value": "vpc-1"}]},
+	{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:key-pair/key-1",
+		"Tags": [{"Key": "stack", "Value": "preview"}, {"Key": "team", "Value": "platform"},
+			{"Key": "network", "Value": "vpc-1"}]},
+	{"ResourceARN": "arn:aws:ec2:us-west-2:123456789012:instance/i-other",
+		"Tags": [{"Key": "stack", "Value": "preview"}, {"Key": "team", "Value": "platform"}]}
+]}`
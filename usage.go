@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// exitCodeUsage is the exit code if terradozer has been called with wrong arguments (EX_USAGE of sysexits.h),
+// so that wrappers can tell a user error from a failure at runtime.
+const exitCodeUsage = 64
+
+//nolint:gochecknoglobals
+var (
+	// flagHints are the hints shown for flags that don't exist (anymore).
+	flagHints = map[string]string{
+		"dry-run": "use the plan command instead",
+	}
+
+	// hiddenFlags are flags that aren't shown in the help, suggested, or completed (e.g., meant for benchmarks).
+	hiddenFlags = map[string]bool{
+		"provider-stub": true,
+	}
+)
+
+// printDefaults prints the flags of the given flag set as flag.PrintDefaults, but without the hidden ones.
+func printDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+
+		visible.Var(f.Value, f.Name, f.Usage)
+		visible.Lookup(f.Name).DefValue = f.DefValue
+	})
+
+	visible.PrintDefaults()
+}
+
+// parseFlags parses the given arguments with the given flag set. Returns flag.ErrHelp if the help has been
+// requested (and printed); an undefined flag is reported with the closest matching flag name.
+func parseFlags(fs *flag.FlagSet, arguments []string) error {
+	usage := fs.Usage
+
+	// the flag package calls Usage and prints the error for any error, but only the help is printed in full
+	fs.Usage = func() {}
+	fs.SetOutput(ioutil.Discard)
+
+	err := fs.Parse(arguments)
+
+	fs.Usage = usage
+	fs.SetOutput(nil)
+
+	if errors.Is(err, flag.ErrHelp) {
+		usage()
+
+		return err
+	}
+
+	if err != nil {
+		return withHint(fs, err)
+	}
+
+	return nil
+}
+
+// withHint adds a hint to the error of an undefined flag (e.g., the closest matching flag name).
+func withHint(fs *flag.FlagSet, err error) error {
+	const undefined = "flag provided but not defined: -"
+
+	if !strings.HasPrefix(err.Error(), undefined) {
+		return err
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(err.Error(), undefined), "-")
+
+	if hint, ok := flagHints[name]; ok {
+		return fmt.Errorf("%s (%s)", err, hint)
+	}
+
+	var names []string
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			names = append(names, f.Name)
+		}
+	})
+
+	if closest := closestMatch(name, names); closest != "" {
+		return fmt.Errorf("%s (did you mean -%s?)", err, closest)
+	}
+
+	for _, cmd := range commands() {
+		if cmd.flagSet == nil || cmd.name == fs.Name() {
+			continue
+		}
+
+		if cmd.flagSet().Lookup(name) == nil {
+			continue
+		}
+
+		if fs.Name() == mainFlagSetName {
+			return fmt.Errorf("%s (flags of a command are given after the command, e.g., terradozer %s -%s)",
+				err, cmd.name, name)
+		}
+
+		return fmt.Errorf("%s (-%s is a flag of the %s command)", err, name, cmd.name)
+	}
+
+	return err
+}
+
+// closestMatch returns the candidate with the smallest edit distance to the given word, if the distance is small
+// enough to be a typo (otherwise, an empty string).
+func closestMatch(word string, candidates []string) string {
+	maxDistance := len(word) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	var result string
+
+	for _, c := range candidates {
+		d := levenshtein(word, c)
+		if d <= maxDistance {
+			result, maxDistance = c, d-1
+		}
+	}
+
+	return result
+}
+
+// levenshtein returns the minimum number of single-character insertions, deletions, or substitutions
+// to change one word into the other.
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(first int, others ...int) int {
+	result := first
+
+	for _, v := range others {
+		if v < result {
+			result = v
+		}
+	}
+
+	return result
+}
+
+// usageError reports an error in the arguments of the command with the given name (empty for terradozer itself),
+// followed by a short usage, and returns the exit code. If the help has been requested, only returns exit code 0.
+func usageError(name string, err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	fmt.Fprint(os.Stderr, color.RedString("Error: %s\n", err))
+	printUsage(name)
+
+	return exitCodeUsage
+}
+
+// printUsage prints a short usage of the command with the given name (empty for terradozer itself),
+// instead of the full help listing all flags.
+func printUsage(name string) {
+	if name == "" {
+		var names []string
+
+		for _, cmd := range commands() {
+			if !cmd.hidden {
+				names = append(names, cmd.name)
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "\nUSAGE:\n  $ terradozer [flags] <command> [command flags]\n\n"+
+			"COMMANDS: %s\n\nRun 'terradozer -h' to see the help.\n", strings.Join(names, ", "))
+
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nUSAGE:\n  $ terradozer %s %s\n\nRun 'terradozer %s -h' to see the help.\n",
+		name, commandUsage(name), name)
+}
+
+// commandUsage returns the synopsis of the arguments of the command with the given name.
+func commandUsage(name string) string {
+	if cmd := findCommand(name); cmd != nil && cmd.usage != "" {
+		return cmd.usage
+	}
+
+	return "[flags] -state <path/to/terraform.tfstate>"
+}
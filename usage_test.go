@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("state", "state"))
+	assert.Equal(t, 1, levenshtein("stat", "state"))
+	assert.Equal(t, 1, levenshtein("paralel", "parallel"))
+	assert.Equal(t, 5, levenshtein("", "force"))
+}
+
+func TestClosestMatch(t *testing.T) {
+	candidates := []string{"state", "show-config", "parallel", "protected-types"}
+
+	assert.Equal(t, "state", closestMatch("stat", candidates))
+	assert.Equal(t, "parallel", closestMatch("paralell", candidates))
+	assert.Equal(t, "protected-types", closestMatch("protected-type", candidates))
+	assert.Empty(t, closestMatch("force", candidates))
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name           string
+		command        string
+		args           []string
+		expectedErrMsg string
+	}{
+		{
+			name:    "no error",
+			command: "destroy",
+			args:    []string{"-state", "foo.tfstate"},
+		},
+		{
+			name:           "typo",
+			command:        "destroy",
+			args:           []string{"-stat", "foo.tfstate"},
+			expectedErrMsg: "flag provided but not defined: -stat (did you mean -state?)",
+		},
+		{
+			name:           "removed flag",
+			command:        "destroy",
+			args:           []string{"-dry-run"},
+			expectedErrMsg: "flag provided but not defined: -dry-run (use the plan command instead)",
+		},
+		{
+			name:           "flag of other command",
+			command:        "plan",
+			args:           []string{"-force"},
+			expectedErrMsg: "flag provided but not defined: -force (-force is a flag of the destroy command)",
+		},
+		{
+			name:           "invalid value",
+			command:        "destroy",
+			args:           []string{"-parallel", "foo"},
+			expectedErrMsg: `invalid value "foo" for flag -parallel: parse error`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := parseFlags(findCommand(tc.command).flagSet(), tc.args)
+
+			if tc.expectedErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErrMsg)
+			}
+		})
+	}
+}
+
+func TestParseFlags_Help(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var helpPrinted bool
+
+	fs.Usage = func() {
+		helpPrinted = true
+	}
+
+	err := parseFlags(fs, []string{"-h"})
+
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.True(t, helpPrinted)
+	assert.Equal(t, 0, usageError("test", err))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/state"
+)
+
+// coverage classifies how terradozer can handle a resource of the state.
+type coverage string
+
+const (
+	// coverageDeletable means that the resource would be destroyed.
+	coverageDeletable coverage = "deletable"
+	// coverageNeedsFlag means that the resource is skipped or might fail to be destroyed unless a flag is set.
+	coverageNeedsFlag coverage = "needs-flag"
+	// coverageSkipped means that the resource is never destroyed on purpose (e.g., it is a protected type).
+	coverageSkipped coverage = "skipped"
+	// coverageUnsupported means that terradozer can't destroy the resource.
+	coverageUnsupported coverage = "unsupported"
+)
+
+// validatedResource is a resource of the state classified by the validate command.
+type validatedResource struct {
+	state.ResourceInstance
+	Coverage coverage `json:"coverage"`
+	// Reason is why the resource isn't deletable (empty if it is).
+	Reason string `json:"reason,omitempty"`
+}
+
+// newValidateFlagSet returns the flag set of the validate command, which accepts the same flags as the plan
+// command (so that a plan can be validated by changing the command only).
+func newValidateFlagSet(shared *stateFlags, f *destroyFlags, output *string) *flag.FlagSet {
+	fs := newCommandFlagSet("validate")
+
+	shared.register(fs)
+	f.register(fs, true)
+	outputFlag(fs, output, outputFormatsOf("validate"))
+
+	return fs
+}
+
+// runValidate classifies which resources of a Terraform state terradozer can destroy and returns the exit code,
+// which is exitCodeUnsupported if any resource is unsupported. The providers are started to fetch their schemas,
+// but nothing is imported or read in the cloud.
+func runValidate(arguments []string, providerFactory provider.Factory) int {
+	var shared stateFlags
+	var f destroyFlags
+	var output string
+
+	flags := newValidateFlagSet(&shared, &f, &output)
+
+	tfstate, code := readState("validate", flags, &shared, arguments, &output)
+	if tfstate == nil {
+		return code
+	}
+
+	versions, err := provider.ParseVersions(f.providerVersion)
+	if err != nil {
+		return usageError("validate", fmt.Errorf("failed to parse -provider-version flag: %s", err))
+	}
+
+	locked, err := readLockFile(f.lockFile)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to read lock file: %s\n", err))
+
+		return 1
+	}
+
+	workDir, removeWorkDir, err := newWorkDir(f.keepWorkDir)
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to create workspace of run: %s\n", err))
+
+		return 1
+	}
+	defer removeWorkDir()
+
+	providerConfig := provider.Config{InstallDir: installDir, WorkDir: workDir, Factory: providerFactory,
+		Versions: versions, Locked: locked}
+
+	resourceTypes := map[string]map[string]bool{}
+
+	for _, pName := range tfstate.ProviderNames() {
+		types, err := provider.ResourceTypes(pName, providerConfig)
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to get schema of provider: %s\n", err))
+
+			return 1
+		}
+
+		resourceTypes[pName] = types
+	}
+
+	instances, err := tfstate.ResourceInstances()
+	if err != nil {
+		fmt.Fprint(os.Stderr, color.RedString("Error:️ failed to get resources from Terraform state: %s\n", err))
+
+		return 1
+	}
+
+	options := destroy.Options{Route53EmptyZones: f.route53EmptyZones}
+
+	var resources []validatedResource
+
+	for _, instance := range instances {
+		c, reason := classify(instance, resourceTypes, providerConfig, shared, options)
+		resources = append(resources, validatedResource{ResourceInstance: instance, Coverage: c, Reason: reason})
+	}
+
+	for _, instance := range tfstate.DataSources() {
+		resources = append(resources, validatedResource{
+			ResourceInstance: instance,
+			Coverage:         coverageSkipped,
+			Reason:           destroy.SkipReasonDataSource.Description(),
+		})
+	}
+
+	counts := map[coverage]int{}
+
+	for _, r := range resources {
+		counts[r.Coverage]++
+	}
+
+	if output == "json" {
+		if code := printJSON(resources); code != 0 {
+			return code
+		}
+	} else {
+		logValidatedResources(resources, counts)
+	}
+
+	if counts[coverageUnsupported] > 0 {
+		return exitCodeUnsupported
+	}
+
+	return 0
+}
+
+// classify returns how terradozer can handle the given resource and the reason if it isn't deletable.
+// The resource types are the ones of the schema of each supported provider (by provider name), which are
+// initialized with the given config. Resources of types renamed by the provider are classified by their new type.
+func classify(instance state.ResourceInstance, resourceTypes map[string]map[string]bool,
+	providerConfig provider.Config, shared stateFlags, options destroy.Options) (coverage, string) {
+	types := resourceTypes[instance.Provider]
+
+	terraformType := instance.Type
+	if renamed, ok := destroy.RenamedType(instance.Type, func(t string) bool { return types[t] }); ok {
+		terraformType = renamed
+	}
+
+	candidate := candidateOf(instance)
+
+	if !shared.includeDefaultResources {
+		if ok, reason := (destroy.DefaultResourcesFilter{}).Match(candidate); !ok {
+			return coverageNeedsFlag, reason.Description()
+		}
+	}
+
+	if ok, reason := shared.filter().Match(candidate); !ok {
+		return coverageSkipped, reason.Description()
+	}
+
+	switch {
+	case types == nil:
+		return coverageUnsupported, fmt.Sprintf("provider %s is not (yet) supported by terradozer", instance.Provider)
+	case !types[terraformType]:
+		return coverageUnsupported, (&destroy.UnsupportedTypeError{
+			Type:     instance.Type,
+			Provider: instance.Provider,
+			Version:  providerConfig.Version(instance.Provider),
+		}).Error()
+	case instance.IDError != "":
+		return coverageUnsupported, instance.IDError
+	}
+
+	if reason := destroy.RequiredFlag(terraformType, options); reason != "" {
+		return coverageNeedsFlag, reason
+	}
+
+	return coverageDeletable, ""
+}
+
+// logValidatedResources logs each classified resource, followed by the number of resources per class.
+func logValidatedResources(resources []validatedResource, counts map[coverage]int) {
+	internal.LogTitle("validating resources")
+
+	for _, r := range resources {
+		entry := log.WithFields(log.Fields{
+			"address":  r.Address,
+			"coverage": r.Coverage,
+		})
+
+		if r.Reason != "" {
+			entry = entry.WithField("reason", r.Reason)
+		}
+
+		switch r.Coverage {
+		case coverageUnsupported:
+			entry.Error(internal.Pad(r.Type))
+		case coverageDeletable, coverageSkipped:
+			entry.Info(internal.Pad(r.Type))
+		default:
+			entry.Warn(internal.Pad(r.Type))
+		}
+	}
+
+	internal.LogTitle(fmt.Sprintf("total number of resources: %d", len(resources)))
+
+	for _, c := range []coverage{coverageDeletable, coverageNeedsFlag, coverageSkipped, coverageUnsupported} {
+		log.WithField("count", counts[c]).Info(internal.Pad(string(c)))
+	}
+}
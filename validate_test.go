@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	resourceTypes := map[string]map[string]bool{
+		"aws": {"aws_vpc": true, "aws_default_vpc": true, "aws_route53_zone": true, "aws_s3_object": true},
+	}
+
+	tests := []struct {
+		name             string
+		instance         state.ResourceInstance
+		shared           stateFlags
+		options          destroy.Options
+		expectedCoverage coverage
+	}{
+		{
+			name:             "deletable",
+			instance:         state.ResourceInstance{Type: "aws_vpc", ID: "vpc-1", Provider: "aws"},
+			expectedCoverage: coverageDeletable,
+		},
+		{
+			name:             "unsupported provider",
+			instance:         state.ResourceInstance{Type: "random_integer", ID: "1", Provider: "random"},
+			expectedCoverage: coverageUnsupported,
+		},
+		{
+			name:             "unknown resource type",
+			instance:         state.ResourceInstance{Type: "aws_foo", ID: "1", Provider: "aws"},
+			expectedCoverage: coverageUnsupported,
+		},
+		{
+			name:             "renamed resource type",
+			instance:         state.ResourceInstance{Type: "aws_s3_bucket_object", ID: "key", Provider: "aws"},
+			expectedCoverage: coverageDeletable,
+		},
+		{
+			name: "missing ID",
+			instance: state.ResourceInstance{Type: "aws_vpc", Provider: "aws",
+				IDError: "resource instance has no id attribute"},
+			expectedCoverage: coverageUnsupported,
+		},
+		{
+			name:             "default resource",
+			instance:         state.ResourceInstance{Type: "aws_default_vpc", ID: "vpc-1", Provider: "aws"},
+			expectedCoverage: coverageNeedsFlag,
+		},
+		{
+			name:             "default resource included",
+			instance:         state.ResourceInstance{Type: "aws_default_vpc", ID: "vpc-1", Provider: "aws"},
+			shared:           stateFlags{includeDefaultResources: true},
+			expectedCoverage: coverageDeletable,
+		},
+		{
+			name:             "protected type",
+			instance:         state.ResourceInstance{Type: "aws_vpc", ID: "vpc-1", Provider: "aws"},
+			shared:           stateFlags{protectedTypes: "aws_vpc"},
+			expectedCoverage: coverageSkipped,
+		},
+		{
+			name:             "route53 zone without flag",
+			instance:         state.ResourceInstance{Type: "aws_route53_zone", ID: "Z1", Provider: "aws"},
+			expectedCoverage: coverageNeedsFlag,
+		},
+		{
+			name:             "route53 zone with flag",
+			instance:         state.ResourceInstance{Type: "aws_route53_zone", ID: "Z1", Provider: "aws"},
+			options:          destroy.Options{Route53EmptyZones: true},
+			expectedCoverage: coverageDeletable,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualCoverage, actualReason := classify(tc.instance, resourceTypes, provider.Config{}, tc.shared, tc.options)
+
+			assert.Equal(t, tc.expectedCoverage, actualCoverage)
+
+			if tc.expectedCoverage == coverageDeletable {
+				assert.Empty(t, actualReason)
+			} else {
+				assert.NotEmpty(t, actualReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/jckuester/terradozer/internal"
+	"github.com/jckuester/terradozer/pkg/destroy"
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/jckuester/terradozer/pkg/state"
+)
+
+// verifyCommand is the name of the command that checks that the resources deleted by a previous run are still gone.
+const verifyCommand = "verify"
+
+// exitCodeReappeared is the exit code of the verify command if resources deleted by a previous run exist again.
+const exitCodeReappeared = 7
+
+// verification is the report of the verify command written to the file given by -verification-report.
+type verification struct {
+	// Report is the path to the report of the previous run whose deleted resources have been verified.
+	Report string `json:"report"`
+	// Absent are the resources that are still gone.
+	Absent []reportedResource `json:"absent"`
+	// Reappeared are the resources that exist again.
+	Reappeared []reportedResource `json:"reappeared"`
+	// Unverified are the resources that couldn't be read (e.g., due to missing permissions) or have been skipped
+	// (e.g., as they are a protected type).
+	Unverified []reportedResource `json:"unverified,omitempty"`
+}
+
+// adoptReportedResources returns a state of the resources deleted by the given run, which are imported by ID,
+// and the addresses of the resources in the state of the run by the addresses of the adopted ones.
+func adoptReportedResources(report *runReport) (*state.State, map[string]string, error) {
+	var ids []state.ResourceID
+
+	for _, r := range report.Deleted {
+		ids = append(ids, state.ResourceID{Type: r.Type, ID: r.ID})
+	}
+
+	tfstate, _, err := state.FromResourceIDs(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addresses := map[string]string{}
+
+	for _, r := range report.Deleted {
+		addresses[state.AdoptedAddress(r.Type, r.ID)] = r.Address
+	}
+
+	return tfstate, addresses, nil
+}
+
+// verify logs (and writes to the given path, if any) which of the resources deleted by a previous run
+// are still gone according to the given plan, whose resources have only been imported and read. Returns 0 if all
+// of them are gone, exitCodeReappeared if any exists again, and 1 if some couldn't be verified.
+func verify(plan *destroy.DestroyPlan, addresses map[string]string, reportPath, path string,
+	providerFailures []destroy.RetryDestroyError) int {
+	result := verifyPlan(plan, addresses, providerFailures)
+	result.Report = reportPath
+
+	for _, s := range plan.Skipped {
+		result.Unverified = append(result.Unverified, reportedResource{
+			Address:    addresses[s.Resource.Address()],
+			Type:       s.Resource.Type(),
+			ID:         s.Resource.ID(),
+			Error:      fmt.Sprintf("skipped: %s", s.Reason.Description()),
+			SkipReason: s.Reason,
+		})
+	}
+
+	sortReportedResources(result.Unverified)
+
+	logVerification(result)
+
+	if path != "" {
+		content, err := json.MarshalIndent(result, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(path, append(content, '\n'), 0600)
+		}
+
+		if err != nil {
+			fmt.Fprint(os.Stderr, color.RedString("\nError:️ failed to write verification report: %s\n", err))
+
+			return 1
+		}
+
+		log.WithField("path", path).Info(internal.Pad("wrote verification report"))
+	}
+
+	switch {
+	case len(result.Reappeared) > 0:
+		return exitCodeReappeared
+	case len(result.Unverified) > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// verifyPlan returns which resources of the given plan, whose resources have only been imported and read, are gone,
+// exist, or couldn't be read; skipped resources are left out. The addresses of the resources are the ones
+// of the given map by their addresses in the plan, if any.
+func verifyPlan(plan *destroy.DestroyPlan, addresses map[string]string,
+	providerFailures []destroy.RetryDestroyError) verification {
+	result := verification{Absent: []reportedResource{}, Reappeared: []reportedResource{}}
+
+	resource := func(address, rType, id string, err error) reportedResource {
+		if original, ok := addresses[address]; ok {
+			address = original
+		}
+
+		r := reportedResource{Address: address, Type: rType, ID: id}
+		if err != nil {
+			r.Error = err.Error()
+			r.Diagnostics = provider.DiagnosticsOf(err)
+		}
+
+		return r
+	}
+
+	for _, c := range plan.Candidates {
+		result.Reappeared = append(result.Reappeared, resource(c.Address, c.Type, c.ID, nil))
+	}
+
+	for _, e := range plan.AlreadyGone {
+		result.Absent = append(result.Absent, resource(e.Address, e.Type, e.ID, nil))
+	}
+
+	for _, e := range plan.Gone {
+		r := resource(e.Address, e.Type, e.ID, e.Err)
+		r.SkipReason = e.SkipReason
+
+		result.Unverified = append(result.Unverified, r)
+	}
+
+	for _, errs := range [][]destroy.RetryDestroyError{plan.Unsupported, providerFailures} {
+		for _, err := range errs {
+			result.Unverified = append(result.Unverified,
+				resource(err.Resource.Address(), err.Resource.Type(), err.Resource.ID(), err.Err))
+		}
+	}
+
+	sortReportedResources(result.Absent)
+	sortReportedResources(result.Reappeared)
+	sortReportedResources(result.Unverified)
+
+	return result
+}
+
+// logVerification logs the resources that exist again or couldn't be verified, and the number of each.
+func logVerification(result verification) {
+	if len(result.Reappeared) > 0 {
+		internal.LogTitle(fmt.Sprintf("the following deleted resources exist again: %d", len(result.Reappeared)))
+
+		for _, r := range result.Reappeared {
+			log.WithFields(log.Fields{"id": r.ID, "address": r.Address}).Error(internal.Pad(r.Type))
+		}
+	}
+
+	if len(result.Unverified) > 0 {
+		internal.LogTitle(fmt.Sprintf("failed to verify the following resources: %d", len(result.Unverified)))
+
+		for _, r := range result.Unverified {
+			log.WithFields(log.Fields{"id": r.ID, "address": r.Address, "error": r.Error}).
+				Warn(internal.Pad(r.Type))
+		}
+	}
+
+	internal.LogTitle(fmt.Sprintf("deleted resources still gone: %d, reappeared: %d, unverified: %d",
+		len(result.Absent), len(result.Reappeared), len(result.Unverified)))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jckuester/terradozer/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMainExitCode_Verify(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	dir := t.TempDir()
+	reportPath := filepath.Join(dir, "report.json")
+
+	fake := &fakeProvider{destroyed: map[string]bool{}}
+
+	factory := func(name, version string) (provider.Provider, error) {
+		return fake, nil
+	}
+
+	actualExitCode := mainExitCode([]string{"destroy", "-force", "-report", reportPath,
+		"-state", "test/test-fixtures/tfstates/fake-providers.tfstate"}, factory)
+	require.Equal(t, 0, actualExitCode)
+
+	report, err := readRunReport(reportPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, "us-west-2", report.Region)
+	assert.Equal(t, []reportedResource{
+		{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea"},
+		{Address: "random_integer.test", Type: "random_integer", ID: "12375"},
+	}, report.Deleted)
+
+	tests := []struct {
+		name               string
+		reappeared         []string
+		expectedExitCode   int
+		expectedReappeared []reportedResource
+		expectedAbsent     int
+	}{
+		{
+			name:               "all gone",
+			expectedReappeared: []reportedResource{},
+			expectedAbsent:     2,
+		},
+		{
+			name:             "reappeared",
+			reappeared:       []string{"vpc-039b3d3fb4ffcf0ea"},
+			expectedExitCode: exitCodeReappeared,
+			expectedReappeared: []reportedResource{
+				{Address: "aws_vpc.test", Type: "aws_vpc", ID: "vpc-039b3d3fb4ffcf0ea"},
+			},
+			expectedAbsent: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, id := range tc.reappeared {
+				fake.destroyed[id] = false
+			}
+
+			numOfDeleted := len(fake.deleted)
+			verificationPath := filepath.Join(t.TempDir(), "verification.json")
+
+			// flags of the destroy command don't change anything
+			actualExitCode := mainExitCode([]string{verifyCommand, "-report", reportPath,
+				"-verification-report", verificationPath, "-rds-take-final-snapshot", "-simulate"}, factory)
+
+			assert.Equal(t, tc.expectedExitCode, actualExitCode)
+			assert.Len(t, fake.deleted, numOfDeleted, "verify must not destroy anything")
+
+			content, err := ioutil.ReadFile(verificationPath)
+			require.NoError(t, err)
+
+			var actual verification
+
+			require.NoError(t, json.Unmarshal(content, &actual))
+
+			assert.Equal(t, reportPath, actual.Report)
+			assert.Equal(t, tc.expectedReappeared, actual.Reappeared)
+			assert.Len(t, actual.Absent, tc.expectedAbsent)
+			assert.Empty(t, actual.Unverified)
+		})
+	}
+}
+
+func TestMainExitCode_VerifyMissingReport(t *testing.T) {
+	assert.Equal(t, exitCodeUsage, mainExitCode([]string{verifyCommand}, nil))
+	assert.Equal(t, exitCodeUsage, mainExitCode([]string{verifyCommand, "-report", "does-not-exist.json"}, nil))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// exitCodeWindowClosed is the exit code if the deletion window has closed before all resources have been destroyed
+// (see -window); running the same command again in the next window destroys the remaining ones.
+const exitCodeWindowClosed = 8
+
+// deletionWindow is a daily time range in which resources may be destroyed (see -window).
+type deletionWindow struct {
+	// start and end are the minutes after midnight at which the window opens and closes;
+	// the window crosses midnight if end is before start.
+	start, end int
+	location   *time.Location
+}
+
+// parseWindow parses a deletion window given as "HH:MM-HH:MM" optionally followed by the name of
+// a time zone of the IANA database (e.g., "02:00-05:00 Europe/Prague"; defaults to the local time zone).
+func parseWindow(value string) (*deletionWindow, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("must be HH:MM-HH:MM optionally followed by a time zone, got: %s", value)
+	}
+
+	w := &deletionWindow{location: time.Local}
+
+	if len(fields) == 2 {
+		location, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone: %s", fields[1])
+		}
+
+		w.location = location
+	}
+
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("must be HH:MM-HH:MM optionally followed by a time zone, got: %s", value)
+	}
+
+	for i, target := range []*int{&w.start, &w.end} {
+		t, err := time.Parse("15:04", bounds[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of day (must be HH:MM): %s", bounds[i])
+		}
+
+		*target = t.Hour()*60 + t.Minute()
+	}
+
+	if w.start == w.end {
+		return nil, fmt.Errorf("window must not be empty: %s", value)
+	}
+
+	return w, nil
+}
+
+// next returns when the window opens next after the given time and when it closes then. If the window is open
+// at the given time, it has opened before (or at) that time.
+func (w deletionWindow) next(now time.Time) (time.Time, time.Time) {
+	now = now.In(w.location)
+
+	// the window of the previous day might still be open, if it crosses midnight
+	for day := -1; ; day++ {
+		opens := time.Date(now.Year(), now.Month(), now.Day()+day, 0, w.start, 0, 0, w.location)
+
+		closesDay := day
+		if w.end < w.start {
+			closesDay++
+		}
+
+		closes := time.Date(now.Year(), now.Month(), now.Day()+closesDay, 0, w.end, 0, 0, w.location)
+
+		if now.Before(closes) {
+			return opens, closes
+		}
+	}
+}
+
+// waitForWindow waits until the given deletion window (can be nil) is open and returns a context that is done
+// once the window closes. Returns the error of the given context if it is done before the window opens.
+func waitForWindow(ctx context.Context, w *deletionWindow) (context.Context, context.CancelFunc, error) {
+	if w == nil {
+		windowCtx, cancel := context.WithCancel(ctx)
+
+		return windowCtx, cancel, nil
+	}
+
+	opens, closes := w.next(time.Now())
+
+	if wait := time.Until(opens); wait > 0 {
+		log.WithFields(log.Fields{
+			"opens":  opens.Format(time.RFC3339),
+			"closes": closes.Format(time.RFC3339),
+			"wait":   wait.Round(time.Second).String(),
+		}).Info(internal.Pad("waiting for deletion window to open"))
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"closes":    closes.Format(time.RFC3339),
+		"remaining": time.Until(closes).Round(time.Second).String(),
+	}).Info(internal.Pad("deletion window is open"))
+
+	windowCtx, cancel := context.WithDeadline(ctx, closes)
+
+	return windowCtx, cancel, nil
+}
+
+// logWindowClosed logs the summary of a run stopped as the deletion window has closed and returns the exit code.
+func logWindowClosed(numOfDeletedResources int, numOfSkippedResources int) int {
+	internal.LogTitle(fmt.Sprintf("deletion window closed (total number of deleted resources: %d)",
+		numOfDeletedResources))
+	logNumOfSkippedResources(numOfSkippedResources)
+	internal.LogTitle("run the same command again in the next window to destroy the remaining resources")
+
+	return exitCodeWindowClosed
+}
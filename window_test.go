@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		name             string
+		value            string
+		expectedStart    int
+		expectedEnd      int
+		expectedLocation string
+		expectedErrMsg   string
+	}{
+		{
+			name:             "with time zone",
+			value:            "02:00-05:00 Europe/Prague",
+			expectedStart:    120,
+			expectedEnd:      300,
+			expectedLocation: "Europe/Prague",
+		},
+		{
+			name:             "without time zone",
+			value:            "22:30-01:15",
+			expectedStart:    1350,
+			expectedEnd:      75,
+			expectedLocation: "Local",
+		},
+		{
+			name:           "unknown time zone",
+			value:          "02:00-05:00 Europe/Atlantis",
+			expectedErrMsg: "unknown time zone: Europe/Atlantis",
+		},
+		{
+			name:           "invalid time of day",
+			value:          "2am-05:00",
+			expectedErrMsg: "invalid time of day (must be HH:MM): 2am",
+		},
+		{
+			name:           "missing end",
+			value:          "02:00",
+			expectedErrMsg: "must be HH:MM-HH:MM optionally followed by a time zone, got: 02:00",
+		},
+		{
+			name:           "empty window",
+			value:          "02:00-02:00",
+			expectedErrMsg: "window must not be empty: 02:00-02:00",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseWindow(tc.value)
+
+			if tc.expectedErrMsg != "" {
+				assert.EqualError(t, err, tc.expectedErrMsg)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStart, actual.start)
+			assert.Equal(t, tc.expectedEnd, actual.end)
+			assert.Equal(t, tc.expectedLocation, actual.location.String())
+		})
+	}
+}
+
+func TestDeletionWindow_Next(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	require.NoError(t, err)
+
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, prague)
+		require.NoError(t, err)
+
+		return parsed
+	}
+
+	tests := []struct {
+		name           string
+		window         string
+		now            time.Time
+		expectedOpens  time.Time
+		expectedCloses time.Time
+	}{
+		{
+			name:           "before window",
+			window:         "02:00-05:00 Europe/Prague",
+			now:            at("2026-03-10 01:00"),
+			expectedOpens:  at("2026-03-10 02:00"),
+			expectedCloses: at("2026-03-10 05:00"),
+		},
+		{
+			name:           "within window",
+			window:         "02:00-05:00 Europe/Prague",
+			now:            at("2026-03-10 04:59"),
+			expectedOpens:  at("2026-03-10 02:00"),
+			expectedCloses: at("2026-03-10 05:00"),
+		},
+		{
+			name:           "after window",
+			window:         "02:00-05:00 Europe/Prague",
+			now:            at("2026-03-10 05:00"),
+			expectedOpens:  at("2026-03-11 02:00"),
+			expectedCloses: at("2026-03-11 05:00"),
+		},
+		{
+			name:           "crossing midnight, after midnight",
+			window:         "22:00-02:00 Europe/Prague",
+			now:            at("2026-03-10 01:00"),
+			expectedOpens:  at("2026-03-09 22:00"),
+			expectedCloses: at("2026-03-10 02:00"),
+		},
+		{
+			name:           "crossing midnight, before window",
+			window:         "22:00-02:00 Europe/Prague",
+			now:            at("2026-03-10 03:00"),
+			expectedOpens:  at("2026-03-10 22:00"),
+			expectedCloses: at("2026-03-11 02:00"),
+		},
+		{
+			name:           "other time zone",
+			window:         "02:00-05:00 Europe/Prague",
+			now:            time.Date(2026, 3, 10, 2, 30, 0, 0, time.UTC),
+			expectedOpens:  at("2026-03-10 02:00"),
+			expectedCloses: at("2026-03-10 05:00"),
+		},
+		{
+			name:           "daylight saving time starts",
+			window:         "01:00-05:00 Europe/Prague",
+			now:            at("2026-03-29 00:00"),
+			expectedOpens:  at("2026-03-29 01:00"),
+			expectedCloses: at("2026-03-29 05:00"),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := parseWindow(tc.window)
+			require.NoError(t, err)
+
+			actualOpens, actualCloses := w.next(tc.now)
+
+			assert.True(t, tc.expectedOpens.Equal(actualOpens), "opens: %s", actualOpens)
+			assert.True(t, tc.expectedCloses.Equal(actualCloses), "closes: %s", actualCloses)
+		})
+	}
+}
+
+func TestWaitForWindow(t *testing.T) {
+	now := time.Now().UTC()
+
+	open := &deletionWindow{
+		start:    now.Add(-time.Hour).Hour() * 60,
+		end:      now.Add(2*time.Hour).Hour() * 60,
+		location: time.UTC,
+	}
+
+	ctx, closeWindow, err := waitForWindow(context.Background(), open)
+	require.NoError(t, err)
+	defer closeWindow()
+
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok, "context must be done once the window closes")
+	assert.True(t, deadline.After(now.Add(time.Hour)))
+
+	closed := &deletionWindow{
+		start:    now.Add(2*time.Hour).Hour() * 60,
+		end:      now.Add(3*time.Hour).Hour() * 60,
+		location: time.UTC,
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = waitForWindow(canceled, closed)
+	assert.Equal(t, context.Canceled, err, "must not wait for the window once interrupted")
+
+	ctx, closeWindow, err = waitForWindow(context.Background(), nil)
+	require.NoError(t, err)
+	defer closeWindow()
+
+	_, ok = ctx.Deadline()
+	assert.False(t, ok, "context without window must not be done")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/jckuester/terradozer/internal"
+)
+
+// newWorkDir creates the workspace of a run in the system's temp directory, so that concurrent runs
+// (e.g., from the same directory) never interfere with each other's files, such as partial downloads
+// of providers (the install directory is still shared). Returns a function that removes the workspace
+// on exit, unless it is kept for debugging (see -keep-workdir).
+func newWorkDir(keep bool) (string, func(), error) {
+	dir, err := ioutil.TempDir("", "terradozer-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	log.WithField("path", dir).Debug(internal.Pad("created workspace of run"))
+
+	return dir, func() {
+		if keep {
+			log.WithField("path", dir).Info(internal.Pad("keeping workspace of run (-keep-workdir)"))
+
+			return
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			log.WithError(err).WithField("path", dir).Debug(internal.Pad("failed to remove workspace of run"))
+		}
+	}, nil
+}
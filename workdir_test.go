@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWorkDir(t *testing.T) {
+	tests := []struct {
+		name           string
+		keep           bool
+		expectedExists bool
+	}{
+		{
+			name: "removed on exit",
+		},
+		{
+			name:           "kept",
+			keep:           true,
+			expectedExists: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actualDir, remove, err := newWorkDir(tc.keep)
+			require.NoError(t, err)
+			defer os.RemoveAll(actualDir)
+
+			otherDir, removeOther, err := newWorkDir(tc.keep)
+			require.NoError(t, err)
+			defer os.RemoveAll(otherDir)
+			defer removeOther()
+
+			assert.NotEqual(t, otherDir, actualDir)
+			assert.DirExists(t, actualDir)
+
+			remove()
+
+			_, err = os.Stat(actualDir)
+			assert.Equal(t, tc.expectedExists, err == nil)
+		})
+	}
+}